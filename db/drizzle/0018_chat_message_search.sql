@@ -0,0 +1,2 @@
+-- Full-text index over chat messages, used by the searchMessages query
+CREATE INDEX IF NOT EXISTS "idx_chats_messages_fts" ON "chats" USING gin (jsonb_to_tsvector('simple', "messages"::jsonb, '["string"]'));
@@ -0,0 +1,7 @@
+ALTER TABLE "user_files" ADD COLUMN IF NOT EXISTS "mime_type" varchar DEFAULT '' NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "user_files" ADD COLUMN IF NOT EXISTS "size" bigint DEFAULT 0 NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "user_files" ADD COLUMN IF NOT EXISTS "duration_ms" integer DEFAULT 0 NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "user_files" ADD COLUMN IF NOT EXISTS "waveform" json DEFAULT '[]'::json;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS "admin_audit_log" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"actor_id" varchar NOT NULL,
+	"action" varchar NOT NULL,
+	"target_type" varchar NOT NULL,
+	"target_id" varchar NOT NULL,
+	"before" json DEFAULT '{}'::json,
+	"after" json DEFAULT '{}'::json,
+	"reason" text DEFAULT '',
+	"created_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_admin_audit_log_created_at" ON "admin_audit_log" USING btree ("created_at","id");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_admin_audit_log_actor_id" ON "admin_audit_log" USING btree ("actor_id");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_admin_audit_log_target_id" ON "admin_audit_log" USING btree ("target_id");
+--> statement-breakpoint
+-- The audit log is append-only: reject any attempt to rewrite history
+CREATE OR REPLACE FUNCTION admin_audit_log_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'admin_audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+--> statement-breakpoint
+DROP TRIGGER IF EXISTS "admin_audit_log_no_update" ON "admin_audit_log";
+--> statement-breakpoint
+CREATE TRIGGER "admin_audit_log_no_update" BEFORE UPDATE OR DELETE ON "admin_audit_log" FOR EACH ROW EXECUTE FUNCTION admin_audit_log_immutable();
@@ -0,0 +1,7 @@
+-- Indexes backing the admin dashboard lists (adminUsers, adminVerifications, adminReports)
+CREATE EXTENSION IF NOT EXISTS pg_trgm;--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_users_search_trgm" ON "users" USING gin ((lower("first_name" || ' ' || "last_name" || ' ' || "email")) gin_trgm_ops);--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_users_created_at" ON "users" USING btree ("created_at","id");--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_user_verifications_status" ON "user_verifications" USING btree ("status","created_at","id");--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_reports_status" ON "reports" USING btree ("status","created_at","id");--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_reports_target_id" ON "reports" USING btree ("target_id");
@@ -0,0 +1,35 @@
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "suspended_until" timestamp;
+--> statement-breakpoint
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "is_shadow_banned" boolean DEFAULT false;
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "user_enforcements" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"user_id" varchar NOT NULL,
+	"actor_id" varchar NOT NULL,
+	"type" varchar NOT NULL,
+	"reason_code" varchar NOT NULL,
+	"note" text DEFAULT '',
+	"expires_at" timestamp,
+	"lifted_at" timestamp,
+	"lifted_by" varchar DEFAULT '',
+	"created_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_user_enforcements_user_id" ON "user_enforcements" USING btree ("user_id","created_at");
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "ban_appeals" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"user_id" varchar NOT NULL,
+	"enforcement_id" varchar NOT NULL,
+	"message" text NOT NULL,
+	"status" varchar DEFAULT 'pending' NOT NULL,
+	"reviewer_id" varchar DEFAULT '',
+	"review_note" text DEFAULT '',
+	"reviewed_at" timestamp,
+	"created_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+-- Each enforcement can only be appealed once
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_ban_appeals_enforcement_id" ON "ban_appeals" USING btree ("enforcement_id");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_ban_appeals_status" ON "ban_appeals" USING btree ("status","created_at");
@@ -0,0 +1,18 @@
+ALTER TABLE "user_verifications" ADD COLUMN IF NOT EXISTS "attempt" integer DEFAULT 1 NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "user_verifications" ADD COLUMN IF NOT EXISTS "rejection_reason" text DEFAULT '';
+--> statement-breakpoint
+ALTER TABLE "user_verifications" ADD COLUMN IF NOT EXISTS "reviewer_id" varchar DEFAULT '';
+--> statement-breakpoint
+ALTER TABLE "user_verifications" ADD COLUMN IF NOT EXISTS "reviewed_at" timestamp;
+--> statement-breakpoint
+ALTER TABLE "user_verifications" ADD COLUMN IF NOT EXISTS "face_match_score" double precision;
+--> statement-breakpoint
+ALTER TABLE "user_verifications" ADD COLUMN IF NOT EXISTS "face_matcher" varchar DEFAULT '';
+--> statement-breakpoint
+-- Older rows were created as "requested" but counted by the dashboard as "pending"
+UPDATE "user_verifications" SET "status" = 'requested' WHERE "status" = 'pending';
+--> statement-breakpoint
+UPDATE "user_verifications" SET "status" = 'rejected' WHERE "status" = 'failed';
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_user_verifications_user_id" ON "user_verifications" USING btree ("user_id","created_at");
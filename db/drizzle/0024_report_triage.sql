@@ -0,0 +1,101 @@
+ALTER TABLE "reports" ADD COLUMN IF NOT EXISTS "category" varchar DEFAULT 'other' NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "reports" ADD COLUMN IF NOT EXISTS "target_type" varchar DEFAULT 'user' NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "reports" ADD COLUMN IF NOT EXISTS "subject_id" varchar DEFAULT '' NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "reports" ADD COLUMN IF NOT EXISTS "chat_id" varchar DEFAULT '';
+--> statement-breakpoint
+ALTER TABLE "reports" ADD COLUMN IF NOT EXISTS "severity" integer DEFAULT 1 NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "reports" ADD COLUMN IF NOT EXISTS "group_id" varchar DEFAULT '';
+--> statement-breakpoint
+-- Reports used to be filed without a status and always against users
+UPDATE "reports" SET "status" = 'pending' WHERE "status" = '';
+--> statement-breakpoint
+UPDATE "reports" SET "subject_id" = "target_id" WHERE "subject_id" = '';
+--> statement-breakpoint
+UPDATE "reports" SET "category" = "reason"
+WHERE "reason" IN ('spam', 'harassment', 'hate_speech', 'nudity', 'scam', 'fake_profile', 'underage', 'violence', 'other');
+--> statement-breakpoint
+UPDATE "reports" SET "severity" = CASE "category"
+	WHEN 'underage' THEN 5
+	WHEN 'violence' THEN 5
+	WHEN 'hate_speech' THEN 4
+	WHEN 'harassment' THEN 4
+	WHEN 'scam' THEN 4
+	WHEN 'nudity' THEN 3
+	WHEN 'fake_profile' THEN 2
+	ELSE 1
+END;
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "report_groups" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"subject_id" varchar NOT NULL,
+	"status" varchar DEFAULT 'open' NOT NULL,
+	"category" varchar DEFAULT 'other' NOT NULL,
+	"severity" integer DEFAULT 1 NOT NULL,
+	"priority" integer DEFAULT 0 NOT NULL,
+	"report_count" integer DEFAULT 0 NOT NULL,
+	"reporter_count" integer DEFAULT 0 NOT NULL,
+	"assignee_id" varchar DEFAULT '',
+	"escalated_at" timestamp,
+	"escalated_by" varchar DEFAULT '',
+	"escalation_note" text DEFAULT '',
+	"last_reported_at" timestamp DEFAULT now() NOT NULL,
+	"resolved_at" timestamp,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"updated_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+-- At most one unresolved group per reported user; new reports join it
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_report_groups_open_subject" ON "report_groups" USING btree ("subject_id") WHERE "status" <> 'resolved';
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_report_groups_status_priority" ON "report_groups" USING btree ("status","priority","id");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_reports_group_id" ON "reports" USING btree ("group_id");
+--> statement-breakpoint
+-- Group the reports that are still pending
+INSERT INTO "report_groups" ("id", "subject_id", "category", "severity", "priority", "report_count", "reporter_count", "last_reported_at", "created_at", "updated_at")
+SELECT
+	'rg' || substr(md5("subject_id"), 1, 10),
+	"subject_id",
+	(array_agg("category" ORDER BY "severity" DESC, "created_at" DESC))[1],
+	max("severity"),
+	max("severity") * 20 + least(count(DISTINCT "user_id"), 10) * 5,
+	count(*),
+	count(DISTINCT "user_id"),
+	max("created_at"),
+	min("created_at"),
+	now()
+FROM "reports"
+WHERE "status" = 'pending' AND "group_id" = ''
+GROUP BY "subject_id"
+ON CONFLICT DO NOTHING;
+--> statement-breakpoint
+UPDATE "reports" r SET "group_id" = g."id"
+FROM "report_groups" g
+WHERE r."status" = 'pending' AND r."group_id" = '' AND g."subject_id" = r."subject_id" AND g."status" <> 'resolved';
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "report_evidence" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"report_id" varchar NOT NULL,
+	"kind" varchar NOT NULL,
+	"source_id" varchar NOT NULL,
+	"snapshot" json DEFAULT '{}'::json NOT NULL,
+	"content_hash" varchar NOT NULL,
+	"captured_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_report_evidence_report_id" ON "report_evidence" USING btree ("report_id");
+--> statement-breakpoint
+-- Evidence must survive the reported content being edited or deleted
+CREATE OR REPLACE FUNCTION report_evidence_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'report_evidence is append-only';
+END;
+$$ LANGUAGE plpgsql;
+--> statement-breakpoint
+DROP TRIGGER IF EXISTS "report_evidence_no_update" ON "report_evidence";
+--> statement-breakpoint
+CREATE TRIGGER "report_evidence_no_update" BEFORE UPDATE OR DELETE ON "report_evidence" FOR EACH ROW EXECUTE FUNCTION report_evidence_immutable();
@@ -0,0 +1,35 @@
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "last_active_at" timestamp;
+--> statement-breakpoint
+-- Best available guess for users active before this was tracked
+UPDATE "users" SET "last_active_at" = "updated_at" WHERE "last_active_at" IS NULL;
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_users_last_active_at" ON "users" USING btree ("last_active_at");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_push_tokens_active" ON "user_push_tokens" USING btree ("id") WHERE "is_active" = true;
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "notification_campaigns" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"title" varchar NOT NULL,
+	"body" text NOT NULL,
+	"segment" json DEFAULT '{}'::json NOT NULL,
+	"status" varchar DEFAULT 'scheduled' NOT NULL,
+	"send_at" timestamp NOT NULL,
+	"throttle_per_minute" integer DEFAULT 0 NOT NULL,
+	"created_by" varchar NOT NULL,
+	"target_users" integer DEFAULT 0 NOT NULL,
+	"target_devices" integer DEFAULT 0 NOT NULL,
+	"sent_count" integer DEFAULT 0 NOT NULL,
+	"failed_count" integer DEFAULT 0 NOT NULL,
+	"cursor" varchar DEFAULT '' NOT NULL,
+	"locked_by" varchar DEFAULT '',
+	"locked_until" timestamp,
+	"started_at" timestamp,
+	"completed_at" timestamp,
+	"last_error" text DEFAULT '',
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"updated_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_notification_campaigns_status_send_at" ON "notification_campaigns" USING btree ("status","send_at");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_notification_campaigns_created_at" ON "notification_campaigns" USING btree ("created_at","id");
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS "user_activity_days" (
+	"user_id" varchar NOT NULL,
+	"day" date NOT NULL
+);
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_activity_days_user_day" ON "user_activity_days" USING btree ("user_id","day");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_user_activity_days_day" ON "user_activity_days" USING btree ("day");
+--> statement-breakpoint
+-- Seed from the last activity we know of so retention has something to start from
+INSERT INTO "user_activity_days" ("user_id", "day")
+SELECT "id", "last_active_at"::date FROM "users" WHERE "last_active_at" IS NOT NULL
+ON CONFLICT DO NOTHING;
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "metric_rollups" (
+	"metric" varchar NOT NULL,
+	"day" date NOT NULL,
+	"numerator" bigint DEFAULT 0 NOT NULL,
+	"denominator" bigint DEFAULT 0 NOT NULL,
+	"computed_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_metric_rollups_metric_day" ON "metric_rollups" USING btree ("metric","day");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_swipes_created_at" ON "swipes" USING btree ("created_at");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_matches_matched_at" ON "matches" USING btree ("matched_at");
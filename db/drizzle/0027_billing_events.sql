@@ -0,0 +1,38 @@
+ALTER TABLE "user_subscriptions" ADD COLUMN IF NOT EXISTS "billing_period" varchar DEFAULT 'monthly' NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "user_subscriptions" ADD COLUMN IF NOT EXISTS "amount_paid" integer DEFAULT 0 NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "user_subscriptions" ADD COLUMN IF NOT EXISTS "currency" varchar DEFAULT 'USD' NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "user_subscriptions" ADD COLUMN IF NOT EXISTS "paused_at" timestamp;
+--> statement-breakpoint
+ALTER TABLE "user_subscriptions" ADD COLUMN IF NOT EXISTS "resume_at" timestamp;
+--> statement-breakpoint
+-- Periods longer than two months were bought yearly
+UPDATE "user_subscriptions" SET "billing_period" = 'yearly'
+WHERE "current_period_end" - "current_period_start" > interval '60 days';
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_user_subscriptions_resume_at" ON "user_subscriptions" USING btree ("resume_at") WHERE "status" = 'paused';
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "billing_events" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"user_id" varchar NOT NULL,
+	"subscription_id" varchar DEFAULT '' NOT NULL,
+	"type" varchar NOT NULL,
+	"plan_id" varchar DEFAULT '' NOT NULL,
+	"previous_plan_id" varchar DEFAULT '' NOT NULL,
+	"amount" integer DEFAULT 0 NOT NULL,
+	"currency" varchar DEFAULT 'USD' NOT NULL,
+	"provider" varchar DEFAULT '' NOT NULL,
+	"provider_event_id" varchar DEFAULT '' NOT NULL,
+	"actor_id" varchar DEFAULT '' NOT NULL,
+	"reason" text DEFAULT '' NOT NULL,
+	"details" json DEFAULT '{}'::json,
+	"created_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_billing_events_user_id" ON "billing_events" USING btree ("user_id","created_at");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_billing_events_subscription_id" ON "billing_events" USING btree ("subscription_id");
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_billing_events_provider_event" ON "billing_events" USING btree ("provider","provider_event_id","type") WHERE "provider_event_id" <> '';
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS "webhook_events" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"provider" varchar NOT NULL,
+	"event_id" varchar NOT NULL,
+	"event_type" varchar NOT NULL,
+	"subject" varchar DEFAULT '' NOT NULL,
+	"ordered" boolean DEFAULT false NOT NULL,
+	"occurred_at" timestamp NOT NULL,
+	"payload" text NOT NULL,
+	"status" varchar DEFAULT 'processing' NOT NULL,
+	"attempts" integer DEFAULT 0 NOT NULL,
+	"last_error" text DEFAULT '' NOT NULL,
+	"received_at" timestamp DEFAULT now() NOT NULL,
+	"attempted_at" timestamp,
+	"processed_at" timestamp
+);
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_webhook_events_provider_event" ON "webhook_events" USING btree ("provider","event_id");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_webhook_events_subject" ON "webhook_events" USING btree ("provider","subject","occurred_at") WHERE "ordered" AND "status" = 'processed';
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_webhook_events_status" ON "webhook_events" USING btree ("status","received_at");
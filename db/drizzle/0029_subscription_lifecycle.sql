@@ -0,0 +1,11 @@
+ALTER TABLE "user_subscriptions" ADD COLUMN IF NOT EXISTS "billing_issue_at" timestamp;
+--> statement-breakpoint
+ALTER TABLE "user_subscriptions" ADD COLUMN IF NOT EXISTS "grace_until" timestamp;
+--> statement-breakpoint
+ALTER TABLE "user_subscriptions" ADD COLUMN IF NOT EXISTS "dunning_reminders" integer DEFAULT 0 NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "user_subscriptions" ADD COLUMN IF NOT EXISTS "last_dunning_at" timestamp;
+--> statement-breakpoint
+ALTER TABLE "user_subscriptions" ADD COLUMN IF NOT EXISTS "renewal_reminded_for" timestamp;
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_user_subscriptions_active_period_end" ON "user_subscriptions" USING btree ("current_period_end") WHERE "status" = 'active';
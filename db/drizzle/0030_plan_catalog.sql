@@ -0,0 +1,35 @@
+ALTER TABLE "subscription_plans" ADD COLUMN IF NOT EXISTS "product_ids" json DEFAULT '{}'::json NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "subscription_plans" ADD COLUMN IF NOT EXISTS "base_plan_id" varchar DEFAULT '' NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "subscription_plans" ADD COLUMN IF NOT EXISTS "variant_weight" integer DEFAULT 0 NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "subscription_plans" ADD COLUMN IF NOT EXISTS "updated_at" timestamp DEFAULT now() NOT NULL;
+--> statement-breakpoint
+-- Plans used to be seeded by the API on startup
+INSERT INTO "subscription_plans" ("id", "name", "description", "price_monthly", "price_yearly", "features", "limits", "is_active", "sort_order") VALUES
+	('free', 'Free', 'Get started with basic features', 0, 0,
+		'{"see_who_liked":false,"priority_matching":false,"profile_boost":false,"advanced_filters":false,"verified_priority":false,"unlimited_rewinds":false,"read_receipts":false,"incognito_mode":false}',
+		'{"swipes_per_day":10,"ai_replies_per_day":0,"superlikes_per_day":1,"boosts_per_month":0}', true, 0),
+	('plus', 'Plus', 'See who liked you and more', 999, 7999,
+		'{"see_who_liked":true,"priority_matching":false,"profile_boost":false,"advanced_filters":false,"verified_priority":false,"unlimited_rewinds":true,"read_receipts":true,"incognito_mode":false}',
+		'{"swipes_per_day":-1,"ai_replies_per_day":5,"superlikes_per_day":5,"boosts_per_month":1}', true, 1),
+	('pro', 'Pro', 'Priority matching and unlimited AI', 1999, 15999,
+		'{"see_who_liked":true,"priority_matching":true,"profile_boost":false,"advanced_filters":true,"verified_priority":false,"unlimited_rewinds":true,"read_receipts":true,"incognito_mode":true}',
+		'{"swipes_per_day":-1,"ai_replies_per_day":-1,"superlikes_per_day":10,"boosts_per_month":3}', true, 2),
+	('elite', 'Elite', 'All features unlocked', 2999, 23999,
+		'{"see_who_liked":true,"priority_matching":true,"profile_boost":true,"advanced_filters":true,"verified_priority":true,"unlimited_rewinds":true,"read_receipts":true,"incognito_mode":true}',
+		'{"swipes_per_day":-1,"ai_replies_per_day":-1,"superlikes_per_day":-1,"boosts_per_month":10}', true, 3)
+ON CONFLICT ("id") DO NOTHING;
+--> statement-breakpoint
+-- Product ids the payment code used to keep in Go. A Dodo product set on the plan
+-- itself was sold monthly.
+UPDATE "subscription_plans" SET "product_ids" = json_build_object(
+	'dodo_monthly', COALESCE(NULLIF("dodo_product_id", ''), 'SPARK_' || "id" || '_monthly'),
+	'dodo_yearly', 'SPARK_' || "id" || '_yearly',
+	'revcat_monthly', 'SPARK_' || "id" || '_monthly',
+	'revcat_yearly', 'SPARK_' || "id" || '_annual'
+)
+WHERE "id" IN ('plus', 'pro', 'elite') AND "product_ids"::text = '{}';
+--> statement-breakpoint
+ALTER TABLE "subscription_plans" DROP COLUMN IF EXISTS "dodo_product_id";
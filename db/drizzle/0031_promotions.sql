@@ -0,0 +1,84 @@
+CREATE TABLE IF NOT EXISTS "promo_codes" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"code" varchar NOT NULL,
+	"kind" varchar NOT NULL,
+	"plan_id" varchar DEFAULT '' NOT NULL,
+	"percent_off" integer DEFAULT 0 NOT NULL,
+	"days" integer DEFAULT 0 NOT NULL,
+	"max_redemptions" integer DEFAULT 0 NOT NULL,
+	"redemptions" integer DEFAULT 0 NOT NULL,
+	"expires_at" timestamp,
+	"is_active" boolean DEFAULT true NOT NULL,
+	"created_by" varchar DEFAULT '' NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"updated_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_promo_codes_code" ON "promo_codes" USING btree ("code");
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "promo_redemptions" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"code_id" varchar NOT NULL,
+	"code" varchar NOT NULL,
+	"user_id" varchar NOT NULL,
+	"kind" varchar NOT NULL,
+	"plan_id" varchar DEFAULT '' NOT NULL,
+	"percent_off" integer DEFAULT 0 NOT NULL,
+	"subscription_id" varchar DEFAULT '' NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"used_at" timestamp
+);
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_promo_redemptions_code_user" ON "promo_redemptions" USING btree ("code_id","user_id");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_promo_redemptions_user_id" ON "promo_redemptions" USING btree ("user_id","created_at");
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "trial_claims" (
+	"kind" varchar NOT NULL,
+	"key" varchar NOT NULL,
+	"user_id" varchar NOT NULL,
+	"plan_id" varchar NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	PRIMARY KEY ("kind", "key")
+);
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "referral_codes" (
+	"user_id" varchar PRIMARY KEY NOT NULL,
+	"code" varchar NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_referral_codes_code" ON "referral_codes" USING btree ("code");
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "referrals" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"referrer_id" varchar NOT NULL,
+	"referee_id" varchar NOT NULL,
+	"code" varchar NOT NULL,
+	"device_id" varchar DEFAULT '' NOT NULL,
+	"status" varchar DEFAULT 'pending' NOT NULL,
+	"reason" text DEFAULT '' NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"rewarded_at" timestamp
+);
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_referrals_referee_id" ON "referrals" USING btree ("referee_id");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_referrals_referrer_id" ON "referrals" USING btree ("referrer_id","created_at");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_referrals_device_id" ON "referrals" USING btree ("device_id") WHERE "device_id" <> '';
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "credit_ledger" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"user_id" varchar NOT NULL,
+	"limit_name" varchar NOT NULL,
+	"amount" integer NOT NULL,
+	"source" varchar NOT NULL,
+	"source_id" varchar NOT NULL,
+	"expires_at" timestamp NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_credit_ledger_source" ON "credit_ledger" USING btree ("user_id","source","source_id","limit_name");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_credit_ledger_user_expires" ON "credit_ledger" USING btree ("user_id","expires_at");
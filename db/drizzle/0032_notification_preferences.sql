@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS "notification_preferences" (
+	"user_id" varchar PRIMARY KEY NOT NULL,
+	"events" json DEFAULT '{}'::json NOT NULL,
+	"quiet_hours_start" varchar DEFAULT '' NOT NULL,
+	"quiet_hours_end" varchar DEFAULT '' NOT NULL,
+	"timezone" varchar DEFAULT 'UTC' NOT NULL,
+	"updated_at" timestamp DEFAULT now() NOT NULL
+);
@@ -0,0 +1,14 @@
+ALTER TABLE "notification_preferences" ADD COLUMN IF NOT EXISTS "digest_frequency" varchar DEFAULT 'daily' NOT NULL;
+--> statement-breakpoint
+ALTER TABLE "notification_preferences" ADD COLUMN IF NOT EXISTS "last_digest_at" timestamp;
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "notification_digest_items" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"user_id" varchar NOT NULL,
+	"event" varchar NOT NULL,
+	"actor_id" varchar DEFAULT '' NOT NULL,
+	"summary" text NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_digest_items_user_created" ON "notification_digest_items" USING btree ("user_id","created_at");
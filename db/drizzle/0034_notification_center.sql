@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS "notifications" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"user_id" varchar NOT NULL,
+	"event" varchar NOT NULL,
+	"title" varchar NOT NULL,
+	"body" text DEFAULT '' NOT NULL,
+	"link" varchar DEFAULT '' NOT NULL,
+	"actor_id" varchar DEFAULT '' NOT NULL,
+	"dedupe_key" varchar DEFAULT '' NOT NULL,
+	"read_at" timestamp,
+	"created_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_notifications_user_created" ON "notifications" USING btree ("user_id","created_at","id");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_notifications_user_unread" ON "notifications" USING btree ("user_id") WHERE read_at IS NULL;
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_notifications_user_dedupe" ON "notifications" USING btree ("user_id","dedupe_key") WHERE dedupe_key <> '';
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS "push_messages" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"notification_id" varchar DEFAULT '' NOT NULL,
+	"user_id" varchar DEFAULT '' NOT NULL,
+	"token" varchar NOT NULL,
+	"message" json NOT NULL,
+	"status" varchar DEFAULT 'pending' NOT NULL,
+	"attempts" integer DEFAULT 0 NOT NULL,
+	"next_attempt_at" timestamp DEFAULT now() NOT NULL,
+	"locked_until" timestamp,
+	"ticket_id" varchar DEFAULT '' NOT NULL,
+	"last_error" text DEFAULT '' NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"updated_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_push_messages_due" ON "push_messages" USING btree ("next_attempt_at") WHERE status IN ('pending', 'sending');
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_push_messages_receipts" ON "push_messages" USING btree ("updated_at") WHERE status = 'sent';
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_push_messages_user_created" ON "push_messages" USING btree ("user_id","created_at");
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_push_messages_created" ON "push_messages" USING btree ("created_at");
@@ -0,0 +1 @@
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "preferred_locale" varchar DEFAULT 'en' NOT NULL;
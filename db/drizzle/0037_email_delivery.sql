@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS "email_messages" (
+	"id" varchar PRIMARY KEY NOT NULL,
+	"to_email" varchar NOT NULL,
+	"locale" varchar DEFAULT 'en' NOT NULL,
+	"subject" varchar NOT NULL,
+	"text" text DEFAULT '' NOT NULL,
+	"html" text DEFAULT '' NOT NULL,
+	"unsubscribe_url" varchar DEFAULT '' NOT NULL,
+	"status" varchar DEFAULT 'pending' NOT NULL,
+	"attempts" integer DEFAULT 0 NOT NULL,
+	"next_attempt_at" timestamp DEFAULT now() NOT NULL,
+	"locked_until" timestamp,
+	"last_error" text DEFAULT '' NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL,
+	"updated_at" timestamp DEFAULT now() NOT NULL
+);
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_email_messages_due" ON "email_messages" USING btree ("next_attempt_at") WHERE status IN ('pending', 'sending');
+--> statement-breakpoint
+CREATE INDEX IF NOT EXISTS "idx_email_messages_created" ON "email_messages" USING btree ("created_at");
+--> statement-breakpoint
+CREATE TABLE IF NOT EXISTS "email_suppressions" (
+	"email" varchar PRIMARY KEY NOT NULL,
+	"reason" varchar NOT NULL,
+	"details" text DEFAULT '' NOT NULL,
+	"created_at" timestamp DEFAULT now() NOT NULL
+);
@@ -0,0 +1,10 @@
+-- Keep only the newest pending attempt per user so the unique index can be built
+UPDATE "user_verifications" SET "status" = 'rejected', "rejection_reason" = 'Superseded by a newer request', "updated_at" = now()
+WHERE "status" IN ('requested', 'resubmitted', 'in_review')
+  AND "id" NOT IN (
+    SELECT DISTINCT ON ("user_id") "id" FROM "user_verifications"
+    WHERE "status" IN ('requested', 'resubmitted', 'in_review')
+    ORDER BY "user_id", "created_at" DESC, "attempt" DESC
+  );
+--> statement-breakpoint
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_verifications_pending_user" ON "user_verifications" USING btree ("user_id") WHERE status IN ('requested', 'resubmitted', 'in_review');
@@ -7,69 +7,110 @@ import {
   json,
   boolean,
   index,
+  uniqueIndex,
+  bigint,
+  doublePrecision,
+  date,
+  primaryKey,
 } from "drizzle-orm/pg-core";
+import { sql } from "drizzle-orm";
 
-export const users = pgTable("users", {
-  id: varchar("id").primaryKey().notNull(),
-  first_name: varchar("first_name").notNull(),
-  last_name: varchar("last_name").notNull(),
-  email: varchar("email").notNull(),
-  /** Bcrypt hash for native email/password auth; null when using WorkOS */
-  password_hash: varchar("password_hash"),
-  username: varchar("username"),
-  phone: varchar("phone").notNull(),
-  dob: timestamp("dob").notNull(),
-  gender: varchar("gender").notNull(),
-  pfp: varchar("pfp").default(""),
-  bio: text("bio").notNull(),
-  hobbies: json("hobbies").default([]),
-  interests: json("interests").default([]),
-  user_prompts: json("user_prompts").default([]),
-  personality_traits: json("personality_traits").default({}),
-  photos: json("photos").default([]),
-  blurred_photos: json("blurred_photos").default([]),
-  is_verified: boolean("is_verified").default(false),
-  address: json("address").notNull().default({}),
-  extra: json("extra").default({}),
-  // Admin & subscription fields
-  role: varchar("role").default("user"), // "user", "admin", "moderator"
-  is_banned: boolean("is_banned").default(false),
-  subscription_plan_id: varchar("subscription_plan_id").default("free"),
-  // AI usage tracking
-  ai_replies_used_today: integer("ai_replies_used_today").default(0),
-  last_ai_reset: timestamp("last_ai_reset").defaultNow(),
-  // Swipe tracking
-  swipes_today: integer("swipes_today").default(0),
-  last_swipe_reset: timestamp("last_swipe_reset").defaultNow(),
-  created_at: timestamp("created_at").defaultNow().notNull(),
-  updated_at: timestamp("updated_at").defaultNow().notNull(),
-});
+export const users = pgTable(
+  "users",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    first_name: varchar("first_name").notNull(),
+    last_name: varchar("last_name").notNull(),
+    email: varchar("email").notNull(),
+    /** Set once the user proved they own the email, e.g. by signing in with an emailed code */
+    email_verified_at: timestamp("email_verified_at"),
+    /** Bcrypt hash for native email/password auth; null when using WorkOS */
+    password_hash: varchar("password_hash"),
+    username: varchar("username"),
+    phone: varchar("phone").notNull(),
+    dob: timestamp("dob").notNull(),
+    gender: varchar("gender").notNull(),
+    pfp: varchar("pfp").default(""),
+    bio: text("bio").notNull(),
+    hobbies: json("hobbies").default([]),
+    interests: json("interests").default([]),
+    user_prompts: json("user_prompts").default([]),
+    personality_traits: json("personality_traits").default({}),
+    photos: json("photos").default([]),
+    blurred_photos: json("blurred_photos").default([]),
+    is_verified: boolean("is_verified").default(false),
+    address: json("address").notNull().default({}),
+    extra: json("extra").default({}),
+    /** Language for emails and push notifications, e.g. "en"; see services/internal/i18n */
+    preferred_locale: varchar("preferred_locale").default("en").notNull(),
+    // Admin & subscription fields
+    role: varchar("role").default("user"), // "user", "admin", "moderator"
+    is_banned: boolean("is_banned").default(false),
+    suspended_until: timestamp("suspended_until"), // suspension ends on its own after this
+    is_shadow_banned: boolean("is_shadow_banned").default(false),
+    subscription_plan_id: varchar("subscription_plan_id").default("free"),
+    // AI usage tracking
+    ai_replies_used_today: integer("ai_replies_used_today").default(0),
+    last_ai_reset: timestamp("last_ai_reset").defaultNow(),
+    // Swipe tracking
+    swipes_today: integer("swipes_today").default(0),
+    last_swipe_reset: timestamp("last_swipe_reset").defaultNow(),
+    last_active_at: timestamp("last_active_at"),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    updated_at: timestamp("updated_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    /** Backs adminUsers search; needs pg_trgm (see migration 0021) */
+    searchTrgmIdx: index("idx_users_search_trgm").using(
+      "gin",
+      sql`(lower(${table.first_name} || ' ' || ${table.last_name} || ' ' || ${table.email})) gin_trgm_ops`,
+    ),
+    createdAtIdx: index("idx_users_created_at").on(table.created_at, table.id),
+    lastActiveAtIdx: index("idx_users_last_active_at").on(table.last_active_at),
+  }),
+);
 
-export const matches = pgTable("matches", {
-  id: varchar("id").primaryKey().notNull(),
-  she_id: varchar("she_id").notNull(),
-  he_id: varchar("he_id").notNull(),
-  score: integer("score").notNull(),
-  post_unlock_rating: json("post_unlock_rating").default({}), // { she_rating: 0, he_rating: 0 }
-  is_unlocked: boolean("is_unlocked").default(false),
-  she_messages: integer("she_messages").default(0),
-  he_messages: integer("he_messages").default(0),
-  // Unlock request flow
-  unlock_requested_by: varchar("unlock_requested_by"), // user_id who requested
-  unlock_requested_at: timestamp("unlock_requested_at"),
-  unlock_accepted_at: timestamp("unlock_accepted_at"),
-  // Date status
-  is_date: boolean("is_date").default(false), // both rated >= 8
-  is_archived: boolean("is_archived").default(false), // one rated < 8 or blocked
-  matched_at: timestamp("matched_at").defaultNow().notNull(),
-});
+export const matches = pgTable(
+  "matches",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    she_id: varchar("she_id").notNull(),
+    he_id: varchar("he_id").notNull(),
+    score: integer("score").notNull(),
+    post_unlock_rating: json("post_unlock_rating").default({}), // { she_rating: 0, he_rating: 0 }
+    is_unlocked: boolean("is_unlocked").default(false),
+    she_messages: integer("she_messages").default(0),
+    he_messages: integer("he_messages").default(0),
+    // Unlock request flow
+    unlock_requested_by: varchar("unlock_requested_by"), // user_id who requested
+    unlock_requested_at: timestamp("unlock_requested_at"),
+    unlock_accepted_at: timestamp("unlock_accepted_at"),
+    // Date status
+    is_date: boolean("is_date").default(false), // both rated >= 8
+    is_archived: boolean("is_archived").default(false), // one rated < 8 or blocked
+    matched_at: timestamp("matched_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    matchedAtIdx: index("idx_matches_matched_at").on(table.matched_at),
+  }),
+);
 
-export const chats = pgTable("chats", {
-  id: varchar("id").primaryKey().notNull(),
-  match_id: varchar("match_id").notNull(),
-  created_at: timestamp("created_at").defaultNow().notNull(),
-  messages: json("messages").default([]),
-});
+export const chats = pgTable(
+  "chats",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    match_id: varchar("match_id").notNull(),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    messages: json("messages").default([]),
+  },
+  (table) => ({
+    /** Backs full-text message search */
+    messagesFtsIdx: index("idx_chats_messages_fts").using(
+      "gin",
+      sql`jsonb_to_tsvector('simple', ${table.messages}::jsonb, '["string"]')`,
+    ),
+  }),
+);
 
 export const posts = pgTable(
   "posts",
@@ -114,6 +155,12 @@ export const user_files = pgTable("user_files", {
   key: varchar("key").notNull(),
   s3_path: varchar("s3_path").notNull(),
   visibility: varchar("visibility").notNull(),
+  mime_type: varchar("mime_type").default("").notNull(),
+  size: bigint("size", { mode: "number" }).default(0).notNull(),
+  /** Audio only */
+  duration_ms: integer("duration_ms").default(0).notNull(),
+  /** Audio only, peak amplitudes scaled to 0-1 */
+  waveform: json("waveform").default([]),
   created_at: timestamp("created_at").defaultNow(),
   updated_at: timestamp("updated_at").defaultNow(),
 });
@@ -126,25 +173,99 @@ export const user_profile_activities = pgTable("user_profile_activities", {
   created_at: timestamp("created_at").defaultNow().notNull(),
 });
 
-export const swipes = pgTable("swipes", {
-  id: varchar("id").primaryKey().notNull(),
-  user_id: varchar("user_id").notNull(),
-  target_id: varchar("target_id").notNull(),
-  action_type: varchar("action_type").notNull(), // "like", "superlike", "dislike"
-  created_at: timestamp("created_at").defaultNow().notNull(),
-});
+export const swipes = pgTable(
+  "swipes",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    user_id: varchar("user_id").notNull(),
+    target_id: varchar("target_id").notNull(),
+    action_type: varchar("action_type").notNull(), // "like", "superlike", "dislike"
+    created_at: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    createdAtIdx: index("idx_swipes_created_at").on(table.created_at),
+  }),
+);
 
-export const reports = pgTable("reports", {
-  id: varchar("id").primaryKey().notNull(),
-  user_id: varchar("user_id").notNull(),
-  target_id: varchar("target_id").notNull(), // user_id, post_id, comment_id
-  reason: varchar("reason").notNull(),
-  additional_info: varchar("additional_info").notNull(),
-  media: json("media").default([]),
-  status: varchar("status").notNull(), // "pending", "resolved", "rejected"
-  created_at: timestamp("created_at").defaultNow().notNull(),
-  updated_at: timestamp("updated_at").defaultNow().notNull(),
-});
+export const reports = pgTable(
+  "reports",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    user_id: varchar("user_id").notNull(),
+    target_id: varchar("target_id").notNull(), // user_id, post_id, comment_id
+    target_type: varchar("target_type").notNull().default("user"), // "user", "post", "comment"
+    subject_id: varchar("subject_id").notNull().default(""), // The reported user; the author for posts and comments
+    chat_id: varchar("chat_id").default(""),
+    category: varchar("category").notNull().default("other"),
+    severity: integer("severity").notNull().default(1),
+    group_id: varchar("group_id").default(""),
+    reason: varchar("reason").notNull(),
+    additional_info: varchar("additional_info").notNull(),
+    media: json("media").default([]),
+    status: varchar("status").notNull(), // "pending", "resolved", "dismissed", "action_taken"
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    updated_at: timestamp("updated_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    statusIdx: index("idx_reports_status").on(
+      table.status,
+      table.created_at,
+      table.id,
+    ),
+    targetIdIdx: index("idx_reports_target_id").on(table.target_id),
+    groupIdIdx: index("idx_reports_group_id").on(table.group_id),
+  }),
+);
+
+export const report_groups = pgTable(
+  "report_groups",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    subject_id: varchar("subject_id").notNull(),
+    status: varchar("status").notNull().default("open"), // "open", "assigned", "escalated", "resolved"
+    category: varchar("category").notNull().default("other"),
+    severity: integer("severity").notNull().default(1),
+    priority: integer("priority").notNull().default(0),
+    report_count: integer("report_count").notNull().default(0),
+    reporter_count: integer("reporter_count").notNull().default(0),
+    assignee_id: varchar("assignee_id").default(""),
+    escalated_at: timestamp("escalated_at"),
+    escalated_by: varchar("escalated_by").default(""),
+    escalation_note: text("escalation_note").default(""),
+    last_reported_at: timestamp("last_reported_at").defaultNow().notNull(),
+    resolved_at: timestamp("resolved_at"),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    updated_at: timestamp("updated_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    /** At most one unresolved group per reported user */
+    openSubjectIdx: uniqueIndex("idx_report_groups_open_subject")
+      .on(table.subject_id)
+      .where(sql`status <> 'resolved'`),
+    statusPriorityIdx: index("idx_report_groups_status_priority").on(
+      table.status,
+      table.priority,
+      table.id,
+    ),
+  }),
+);
+
+/** Append-only; a trigger rejects UPDATE and DELETE (see migration 0024) */
+export const report_evidence = pgTable(
+  "report_evidence",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    report_id: varchar("report_id").notNull(),
+    kind: varchar("kind").notNull(), // "chat_messages", "post", "comment", "profile"
+    source_id: varchar("source_id").notNull(),
+    snapshot: json("snapshot").notNull().default({}),
+    content_hash: varchar("content_hash").notNull(),
+    captured_at: timestamp("captured_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    reportIdIdx: index("idx_report_evidence_report_id").on(table.report_id),
+  }),
+);
 
 export const aichat_chats = pgTable("aichat_chats", {
   id: varchar("id").primaryKey().notNull(),
@@ -154,14 +275,38 @@ export const aichat_chats = pgTable("aichat_chats", {
   created_at: timestamp("created_at").defaultNow().notNull(),
 });
 
-export const user_verifications = pgTable("user_verifications", {
-  id: varchar("id").primaryKey().notNull(),
-  user_id: varchar("user_id").notNull(),
-  media: json("media").default([]),
-  status: varchar("status").notNull(), // "pending", "verified", "failed"
-  created_at: timestamp("created_at").defaultNow().notNull(),
-  updated_at: timestamp("updated_at").defaultNow().notNull(),
-});
+export const user_verifications = pgTable(
+  "user_verifications",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    user_id: varchar("user_id").notNull(),
+    media: json("media").default([]),
+    status: varchar("status").notNull(), // "requested", "in_review", "verified", "rejected", "resubmitted"
+    attempt: integer("attempt").default(1).notNull(),
+    rejection_reason: text("rejection_reason").default(""),
+    reviewer_id: varchar("reviewer_id").default(""),
+    reviewed_at: timestamp("reviewed_at"),
+    face_match_score: doublePrecision("face_match_score"),
+    face_matcher: varchar("face_matcher").default(""),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    updated_at: timestamp("updated_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    statusIdx: index("idx_user_verifications_status").on(
+      table.status,
+      table.created_at,
+      table.id,
+    ),
+    userIdx: index("idx_user_verifications_user_id").on(
+      table.user_id,
+      table.created_at,
+    ),
+    /** At most one pending attempt per user */
+    pendingUserIdx: uniqueIndex("idx_user_verifications_pending_user")
+      .on(table.user_id)
+      .where(sql`status IN ('requested', 'resubmitted', 'in_review')`),
+  }),
+);
 
 export const blocked_users = pgTable("blocked_users", {
   id: varchar("id").primaryKey().notNull(),
@@ -191,6 +336,225 @@ export const user_push_tokens = pgTable(
       table.user_id,
       table.is_active,
     ),
+    /** Campaign delivery pages through active tokens by id */
+    activeIdx: index("idx_push_tokens_active")
+      .on(table.id)
+      .where(sql`is_active = true`),
+  }),
+);
+
+/** Per-user notification choices. events maps an event type to the channels it is
+ * delivered on ({ push, email, in_app }); missing types use the server defaults.
+ * Quiet hours are "HH:MM" in the user's timezone and only hold back pushes. */
+export const notification_preferences = pgTable("notification_preferences", {
+  user_id: varchar("user_id").primaryKey().notNull(),
+  events: json("events").default({}).notNull(),
+  quiet_hours_start: varchar("quiet_hours_start").default("").notNull(),
+  quiet_hours_end: varchar("quiet_hours_end").default("").notNull(),
+  timezone: varchar("timezone").default("UTC").notNull(),
+  /** "daily" or "weekly"; low-priority emails are batched into this digest */
+  digest_frequency: varchar("digest_frequency").default("daily").notNull(),
+  last_digest_at: timestamp("last_digest_at"),
+  updated_at: timestamp("updated_at").defaultNow().notNull(),
+});
+
+/** The in-app notification center. link is the app route the entry opens, like
+ * "spark://chat/<chat id>"; dedupe_key keeps fan-outs such as announcements from
+ * adding the same entry twice. */
+export const notifications = pgTable(
+  "notifications",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    user_id: varchar("user_id").notNull(),
+    event: varchar("event").notNull(),
+    title: varchar("title").notNull(),
+    body: text("body").default("").notNull(),
+    link: varchar("link").default("").notNull(),
+    actor_id: varchar("actor_id").default("").notNull(),
+    dedupe_key: varchar("dedupe_key").default("").notNull(),
+    read_at: timestamp("read_at"),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    userCreatedIdx: index("idx_notifications_user_created").on(
+      table.user_id,
+      table.created_at,
+      table.id,
+    ),
+    userUnreadIdx: index("idx_notifications_user_unread")
+      .on(table.user_id)
+      .where(sql`read_at IS NULL`),
+    userDedupeIdx: uniqueIndex("idx_notifications_user_dedupe")
+      .on(table.user_id, table.dedupe_key)
+      .where(sql`dedupe_key <> ''`),
+  }),
+);
+
+/**
+ * Push queue. One row per device; rows are retried with backoff until Expo accepts
+ * them, then checked against Expo's receipts.
+ */
+export const push_messages = pgTable(
+  "push_messages",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    /** Rows of the same notification to a user's devices share this */
+    notification_id: varchar("notification_id").default("").notNull(),
+    user_id: varchar("user_id").default("").notNull(),
+    token: varchar("token").notNull(),
+    /** The Expo message as sent */
+    message: json("message").notNull(),
+    status: varchar("status").default("pending").notNull(), // "pending", "sending", "sent", "delivered", "failed"
+    attempts: integer("attempts").default(0).notNull(),
+    next_attempt_at: timestamp("next_attempt_at").defaultNow().notNull(),
+    locked_until: timestamp("locked_until"),
+    ticket_id: varchar("ticket_id").default("").notNull(),
+    last_error: text("last_error").default("").notNull(),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    updated_at: timestamp("updated_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    dueIdx: index("idx_push_messages_due")
+      .on(table.next_attempt_at)
+      .where(sql`status IN ('pending', 'sending')`),
+    receiptsIdx: index("idx_push_messages_receipts")
+      .on(table.updated_at)
+      .where(sql`status = 'sent'`),
+    userCreatedIdx: index("idx_push_messages_user_created").on(
+      table.user_id,
+      table.created_at,
+    ),
+    createdIdx: index("idx_push_messages_created").on(table.created_at),
+  }),
+);
+
+/**
+ * Email retry queue. Emails that fail with a transient error wait here and are
+ * retried with backoff.
+ */
+export const email_messages = pgTable(
+  "email_messages",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    to_email: varchar("to_email").notNull(),
+    locale: varchar("locale").default("en").notNull(),
+    subject: varchar("subject").notNull(),
+    text: text("text").default("").notNull(),
+    html: text("html").default("").notNull(),
+    unsubscribe_url: varchar("unsubscribe_url").default("").notNull(),
+    status: varchar("status").default("pending").notNull(), // "pending", "sending", "sent", "failed"
+    attempts: integer("attempts").default(0).notNull(),
+    next_attempt_at: timestamp("next_attempt_at").defaultNow().notNull(),
+    locked_until: timestamp("locked_until"),
+    last_error: text("last_error").default("").notNull(),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    updated_at: timestamp("updated_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    dueIdx: index("idx_email_messages_due")
+      .on(table.next_attempt_at)
+      .where(sql`status IN ('pending', 'sending')`),
+    createdIdx: index("idx_email_messages_created").on(table.created_at),
+  }),
+);
+
+/** Addresses we no longer email because they bounced or complained */
+export const email_suppressions = pgTable("email_suppressions", {
+  /** Lowercased */
+  email: varchar("email").primaryKey().notNull(),
+  reason: varchar("reason").notNull(), // "bounce", "complaint", "manual"
+  details: text("details").default("").notNull(),
+  created_at: timestamp("created_at").defaultNow().notNull(),
+});
+
+/** Low-priority notifications waiting for the user's next digest email */
+export const notification_digest_items = pgTable(
+  "notification_digest_items",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    user_id: varchar("user_id").notNull(),
+    event: varchar("event").notNull(),
+    actor_id: varchar("actor_id").default("").notNull(),
+    summary: text("summary").notNull(),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    userCreatedIdx: index("idx_digest_items_user_created").on(
+      table.user_id,
+      table.created_at,
+    ),
+  }),
+);
+
+export const notification_campaigns = pgTable(
+  "notification_campaigns",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    title: varchar("title").notNull(),
+    body: text("body").notNull(),
+    segment: json("segment").notNull().default({}),
+    status: varchar("status").notNull().default("scheduled"), // "scheduled", "sending", "sent", "cancelled", "failed"
+    send_at: timestamp("send_at").notNull(),
+    throttle_per_minute: integer("throttle_per_minute").notNull().default(0),
+    created_by: varchar("created_by").notNull(),
+    target_users: integer("target_users").notNull().default(0),
+    target_devices: integer("target_devices").notNull().default(0),
+    sent_count: integer("sent_count").notNull().default(0),
+    failed_count: integer("failed_count").notNull().default(0),
+    cursor: varchar("cursor").notNull().default(""), // Last push token id delivered to
+    locked_by: varchar("locked_by").default(""),
+    locked_until: timestamp("locked_until"),
+    started_at: timestamp("started_at"),
+    completed_at: timestamp("completed_at"),
+    last_error: text("last_error").default(""),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    updated_at: timestamp("updated_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    statusSendAtIdx: index("idx_notification_campaigns_status_send_at").on(
+      table.status,
+      table.send_at,
+    ),
+    createdAtIdx: index("idx_notification_campaigns_created_at").on(
+      table.created_at,
+      table.id,
+    ),
+  }),
+);
+
+// ==================== Metrics ====================
+
+/** Days each user was seen online; filled from socket presence */
+export const user_activity_days = pgTable(
+  "user_activity_days",
+  {
+    user_id: varchar("user_id").notNull(),
+    day: date("day").notNull(),
+  },
+  (table) => ({
+    userDayIdx: uniqueIndex("idx_user_activity_days_user_day").on(
+      table.user_id,
+      table.day,
+    ),
+    dayIdx: index("idx_user_activity_days_day").on(table.day),
+  }),
+);
+
+/** Daily metric values written by the aggregation job. Counts only use numerator */
+export const metric_rollups = pgTable(
+  "metric_rollups",
+  {
+    metric: varchar("metric").notNull(), // "signups", "dau", "match_rate", ...
+    day: date("day").notNull(),
+    numerator: bigint("numerator", { mode: "number" }).notNull().default(0),
+    denominator: bigint("denominator", { mode: "number" }).notNull().default(0),
+    computed_at: timestamp("computed_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    metricDayIdx: uniqueIndex("idx_metric_rollups_metric_day").on(
+      table.metric,
+      table.day,
+    ),
   }),
 );
 
@@ -204,11 +568,16 @@ export const subscription_plans = pgTable("subscription_plans", {
   price_yearly: integer("price_yearly").default(0), // cents
   features: json("features").default({}), // { see_who_liked: true, priority_matching: false, ... }
   limits: json("limits").default({}), // { swipes_per_day: 10, ai_replies_per_day: 0, ... }
-  dodo_product_id: varchar("dodo_product_id"),
+  /** { dodo_monthly, dodo_yearly, revcat_monthly, revcat_yearly } product ids */
+  product_ids: json("product_ids").notNull().default({}),
   revcat_offering_id: varchar("revcat_offering_id"),
+  /** Set on A/B price variants, which share the base plan's features and limits */
+  base_plan_id: varchar("base_plan_id").notNull().default(""),
+  variant_weight: integer("variant_weight").notNull().default(0), // percent of users offered the variant
   is_active: boolean("is_active").default(true),
   sort_order: integer("sort_order").default(0),
   created_at: timestamp("created_at").defaultNow().notNull(),
+  updated_at: timestamp("updated_at").defaultNow().notNull(),
 });
 
 export const user_subscriptions = pgTable(
@@ -225,6 +594,18 @@ export const user_subscriptions = pgTable(
     current_period_end: timestamp("current_period_end").notNull(),
     cancel_at_period_end: boolean("cancel_at_period_end").default(false),
     cancelled_at: timestamp("cancelled_at"),
+    billing_period: varchar("billing_period").notNull().default("monthly"), // "monthly", "yearly"
+    amount_paid: integer("amount_paid").notNull().default(0), // cents, for the current period
+    currency: varchar("currency").notNull().default("USD"),
+    paused_at: timestamp("paused_at"),
+    resume_at: timestamp("resume_at"),
+    billing_issue_at: timestamp("billing_issue_at"),
+    /** Access continues until then while the provider retries a failed payment */
+    grace_until: timestamp("grace_until"),
+    dunning_reminders: integer("dunning_reminders").notNull().default(0),
+    last_dunning_at: timestamp("last_dunning_at"),
+    /** Period end the last renewal reminder was sent for */
+    renewal_reminded_for: timestamp("renewal_reminded_for"),
     created_at: timestamp("created_at").defaultNow().notNull(),
     updated_at: timestamp("updated_at").defaultNow().notNull(),
   },
@@ -235,6 +616,214 @@ export const user_subscriptions = pgTable(
       table.user_id,
       table.status,
     ),
+    resumeAtIdx: index("idx_user_subscriptions_resume_at")
+      .on(table.resume_at)
+      .where(sql`status = 'paused'`),
+    activePeriodEndIdx: index("idx_user_subscriptions_active_period_end")
+      .on(table.current_period_end)
+      .where(sql`status = 'active'`),
+  }),
+);
+
+/** Every change to a user's billing, newest last */
+export const billing_events = pgTable(
+  "billing_events",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    user_id: varchar("user_id").notNull(),
+    subscription_id: varchar("subscription_id").notNull().default(""),
+    type: varchar("type").notNull(), // "subscription.created", "plan.changed", "refund", ...
+    plan_id: varchar("plan_id").notNull().default(""),
+    previous_plan_id: varchar("previous_plan_id").notNull().default(""),
+    amount: integer("amount").notNull().default(0), // cents; negative for refunds and credits
+    currency: varchar("currency").notNull().default("USD"),
+    provider: varchar("provider").notNull().default(""),
+    provider_event_id: varchar("provider_event_id").notNull().default(""),
+    actor_id: varchar("actor_id").notNull().default(""),
+    reason: text("reason").notNull().default(""),
+    details: json("details").default({}),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    userIdIdx: index("idx_billing_events_user_id").on(
+      table.user_id,
+      table.created_at,
+    ),
+    subscriptionIdIdx: index("idx_billing_events_subscription_id").on(
+      table.subscription_id,
+    ),
+    /** A provider event is only recorded once */
+    providerEventIdx: uniqueIndex("idx_billing_events_provider_event")
+      .on(table.provider, table.provider_event_id, table.type)
+      .where(sql`provider_event_id <> ''`),
+  }),
+);
+
+/** Payment provider webhooks as received, for idempotency and replay */
+export const webhook_events = pgTable(
+  "webhook_events",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    provider: varchar("provider").notNull(), // "dodo", "revcat"
+    event_id: varchar("event_id").notNull(),
+    event_type: varchar("event_type").notNull(),
+    subject: varchar("subject").notNull().default(""), // Subscription or app user the event is about
+    ordered: boolean("ordered").notNull().default(false), // Older events for the subject are skipped
+    occurred_at: timestamp("occurred_at").notNull(),
+    payload: text("payload").notNull(),
+    status: varchar("status").notNull().default("processing"), // "processing", "processed", "failed", "skipped"
+    attempts: integer("attempts").notNull().default(0),
+    last_error: text("last_error").notNull().default(""),
+    received_at: timestamp("received_at").defaultNow().notNull(),
+    attempted_at: timestamp("attempted_at"),
+    processed_at: timestamp("processed_at"),
+  },
+  (table) => ({
+    providerEventIdx: uniqueIndex("idx_webhook_events_provider_event").on(
+      table.provider,
+      table.event_id,
+    ),
+    subjectIdx: index("idx_webhook_events_subject")
+      .on(table.provider, table.subject, table.occurred_at)
+      .where(sql`ordered AND status = 'processed'`),
+    statusIdx: index("idx_webhook_events_status").on(
+      table.status,
+      table.received_at,
+    ),
+  }),
+);
+
+// ==================== Promotions ====================
+
+/** Redeemable promo codes. "percent_off" discounts the next web checkout, "plan_days" and "trial" grant days of a plan */
+export const promo_codes = pgTable(
+  "promo_codes",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    code: varchar("code").notNull(), // Stored uppercase
+    kind: varchar("kind").notNull(), // "percent_off", "plan_days", "trial"
+    plan_id: varchar("plan_id").notNull().default(""),
+    percent_off: integer("percent_off").notNull().default(0),
+    days: integer("days").notNull().default(0),
+    max_redemptions: integer("max_redemptions").notNull().default(0), // 0 for no limit
+    redemptions: integer("redemptions").notNull().default(0),
+    expires_at: timestamp("expires_at"),
+    is_active: boolean("is_active").notNull().default(true),
+    created_by: varchar("created_by").notNull().default(""),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    updated_at: timestamp("updated_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    codeIdx: uniqueIndex("idx_promo_codes_code").on(table.code),
+  }),
+);
+
+/** Each user redeems a code at most once */
+export const promo_redemptions = pgTable(
+  "promo_redemptions",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    code_id: varchar("code_id").notNull(),
+    code: varchar("code").notNull(),
+    user_id: varchar("user_id").notNull(),
+    kind: varchar("kind").notNull(),
+    plan_id: varchar("plan_id").notNull().default(""),
+    percent_off: integer("percent_off").notNull().default(0),
+    subscription_id: varchar("subscription_id").notNull().default(""), // Granted subscription
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    used_at: timestamp("used_at"), // When a discount was spent on a subscription
+  },
+  (table) => ({
+    codeUserIdx: uniqueIndex("idx_promo_redemptions_code_user").on(
+      table.code_id,
+      table.user_id,
+    ),
+    userIdIdx: index("idx_promo_redemptions_user_id").on(
+      table.user_id,
+      table.created_at,
+    ),
+  }),
+);
+
+/** Who has had a free trial, by user, email and device. Kept after accounts are deleted */
+export const trial_claims = pgTable(
+  "trial_claims",
+  {
+    kind: varchar("kind").notNull(), // "user", "email", "device"
+    key: varchar("key").notNull(),
+    user_id: varchar("user_id").notNull(),
+    plan_id: varchar("plan_id").notNull(),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    pk: primaryKey({ columns: [table.kind, table.key] }),
+  }),
+);
+
+/** A user's referral code, created the first time they share it */
+export const referral_codes = pgTable(
+  "referral_codes",
+  {
+    user_id: varchar("user_id").primaryKey().notNull(),
+    code: varchar("code").notNull(),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    codeIdx: uniqueIndex("idx_referral_codes_code").on(table.code),
+  }),
+);
+
+/** Signups through a referral link. Both sides are rewarded once the new user is verified */
+export const referrals = pgTable(
+  "referrals",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    referrer_id: varchar("referrer_id").notNull(),
+    referee_id: varchar("referee_id").notNull(),
+    code: varchar("code").notNull(),
+    device_id: varchar("device_id").notNull().default(""),
+    status: varchar("status").notNull().default("pending"), // "pending", "rewarded", "rejected"
+    reason: text("reason").notNull().default(""), // Why it was rejected
+    created_at: timestamp("created_at").defaultNow().notNull(),
+    rewarded_at: timestamp("rewarded_at"),
+  },
+  (table) => ({
+    refereeIdx: uniqueIndex("idx_referrals_referee_id").on(table.referee_id),
+    referrerIdx: index("idx_referrals_referrer_id").on(
+      table.referrer_id,
+      table.created_at,
+    ),
+    deviceIdx: index("idx_referrals_device_id")
+      .on(table.device_id)
+      .where(sql`device_id <> ''`),
+  }),
+);
+
+/** Temporary additions to a user's plan limits from promotions and referrals */
+export const credit_ledger = pgTable(
+  "credit_ledger",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    user_id: varchar("user_id").notNull(),
+    limit_name: varchar("limit_name").notNull(), // "swipes_per_day", "superlikes_per_day", "ai_replies_per_day", "boosts_per_month"
+    amount: integer("amount").notNull(),
+    source: varchar("source").notNull(), // "referral", "promo"
+    source_id: varchar("source_id").notNull(),
+    expires_at: timestamp("expires_at").notNull(),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    /** A source grants each limit once */
+    sourceIdx: uniqueIndex("idx_credit_ledger_source").on(
+      table.user_id,
+      table.source,
+      table.source_id,
+      table.limit_name,
+    ),
+    userExpiresIdx: index("idx_credit_ledger_user_expires").on(
+      table.user_id,
+      table.expires_at,
+    ),
   }),
 );
 
@@ -258,3 +847,78 @@ export const match_streaks = pgTable(
     matchIdIdx: index("idx_match_streaks_match_id").on(table.match_id),
   }),
 );
+
+// ==================== Moderation ====================
+
+export const user_enforcements = pgTable(
+  "user_enforcements",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    user_id: varchar("user_id").notNull(),
+    actor_id: varchar("actor_id").notNull(), // staff user id or "system"
+    type: varchar("type").notNull(), // "warning", "suspension", "shadow_ban", "ban"
+    reason_code: varchar("reason_code").notNull(), // "spam", "harassment", ...
+    note: text("note").default(""),
+    expires_at: timestamp("expires_at"), // suspensions only
+    lifted_at: timestamp("lifted_at"),
+    lifted_by: varchar("lifted_by").default(""),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    userIdIdx: index("idx_user_enforcements_user_id").on(
+      table.user_id,
+      table.created_at,
+    ),
+  }),
+);
+
+export const ban_appeals = pgTable(
+  "ban_appeals",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    user_id: varchar("user_id").notNull(),
+    enforcement_id: varchar("enforcement_id").notNull(),
+    message: text("message").notNull(),
+    status: varchar("status").notNull().default("pending"), // "pending", "approved", "rejected"
+    reviewer_id: varchar("reviewer_id").default(""),
+    review_note: text("review_note").default(""),
+    reviewed_at: timestamp("reviewed_at"),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    /** Each enforcement can only be appealed once */
+    enforcementIdIdx: uniqueIndex("idx_ban_appeals_enforcement_id").on(
+      table.enforcement_id,
+    ),
+    statusIdx: index("idx_ban_appeals_status").on(
+      table.status,
+      table.created_at,
+    ),
+  }),
+);
+
+// ==================== Admin ====================
+
+/** Append-only; a trigger rejects UPDATE and DELETE (see migration 0020) */
+export const admin_audit_log = pgTable(
+  "admin_audit_log",
+  {
+    id: varchar("id").primaryKey().notNull(),
+    actor_id: varchar("actor_id").notNull(),
+    action: varchar("action").notNull(), // "user.ban", "user.role_change", ...
+    target_type: varchar("target_type").notNull(), // "user", "report", ...
+    target_id: varchar("target_id").notNull(),
+    before: json("before").default({}),
+    after: json("after").default({}),
+    reason: text("reason").default(""),
+    created_at: timestamp("created_at").defaultNow().notNull(),
+  },
+  (table) => ({
+    createdAtIdx: index("idx_admin_audit_log_created_at").on(
+      table.created_at,
+      table.id,
+    ),
+    actorIdIdx: index("idx_admin_audit_log_actor_id").on(table.actor_id),
+    targetIdIdx: index("idx_admin_audit_log_target_id").on(table.target_id),
+  }),
+);
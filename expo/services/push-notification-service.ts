@@ -38,8 +38,11 @@ export interface NotificationData {
   chat_id?: string;
   user_id?: string;
   streak_count?: number;
+  link?: string; // Deep link under the app scheme, e.g. "spark://chat/abc"
 }
 
+const LINK_SCHEME = "spark://";
+
 // Notification channel IDs (Android)
 export const NotificationChannels = {
   MESSAGES: "messages",
@@ -323,12 +326,18 @@ export const pushNotificationManager = new PushNotificationManager();
 
 // Hook for using push notifications in components
 import { useEffect, useCallback } from "react";
-import { useRouter } from "expo-router";
+import { useRouter, Href } from "expo-router";
 
 export function usePushNotifications() {
   const router = useRouter();
 
   const handleNotificationResponse = useCallback((data: NotificationData) => {
+    // Pushes carry the same deep link as their notification center entry
+    if (data.link?.startsWith(LINK_SCHEME)) {
+      router.push(`/${data.link.slice(LINK_SCHEME.length)}` as Href);
+      return;
+    }
+
     // Navigate based on notification type
     switch (data.type) {
       case "new_message":
@@ -21,6 +21,7 @@ require (
 	github.com/vektah/gqlparser/v2 v2.5.31
 	github.com/workos/workos-go/v4 v4.46.1
 	go.uber.org/zap v1.27.0
+	golang.org/x/crypto v0.46.0
 )
 
 require (
@@ -103,7 +104,6 @@ require (
 	go.opentelemetry.io/otel/metric v1.36.0 // indirect
 	go.opentelemetry.io/otel/trace v1.36.0 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	golang.org/x/crypto v0.46.0 // indirect
 	golang.org/x/net v0.48.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/text v0.32.0 // indirect
@@ -25,6 +25,18 @@ const (
 	USER_ONLINE       Events = "user_online"
 	USER_OFFLINE      Events = "user_offline"
 
+	// Subscription events
+	SUBSCRIPTION_BILLING_ISSUE    Events = "subscription_billing_issue"
+	SUBSCRIPTION_DUNNING_REMINDER Events = "subscription_dunning_reminder"
+	SUBSCRIPTION_RENEWAL_REMINDER Events = "subscription_renewal_reminder"
+	SUBSCRIPTION_EXPIRED          Events = "subscription_expired"
+
+	// Promotion events
+	PROMO_CODE_REDEEMED Events = "promo_code_redeemed"
+	TRIAL_STARTED       Events = "trial_started"
+	REFERRAL_SIGNUP     Events = "referral_signup"
+	REFERRAL_REWARDED   Events = "referral_rewarded"
+
 	// DB issues
 	DB_CONNECTION_ISSUE Events = "db_connection_issue"
 )
@@ -52,6 +64,19 @@ const (
 	POST_ID        Properties = "post_id"
 	COMMENT_ID     Properties = "comment_id"
 
+	// Subscription specific
+	SUBSCRIPTION_ID Properties = "subscription_id"
+	PROVIDER        Properties = "provider"
+	EXPIRY_REASON   Properties = "expiry_reason"
+	REMINDER_NUMBER Properties = "reminder_number"
+	PERIOD_END      Properties = "period_end"
+
+	// Promotion specific
+	PROMO_CODE  Properties = "promo_code"
+	PROMO_KIND  Properties = "promo_kind"
+	PLAN_ID     Properties = "plan_id"
+	REFERRER_ID Properties = "referrer_id"
+
 	// Errors
 	ERROR_LIST        Properties = "$exception_list"
 	ERROR_FINGERPRINT Properties = "$exception_fingerprint"
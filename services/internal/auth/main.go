@@ -37,3 +37,23 @@ func CreateJWT(u models.User) (string, error) {
 	}
 	return token, nil
 }
+
+// CreateImpersonationJWT issues a read-only token for actorId to view the app as u.
+func CreateImpersonationJWT(u models.User, actorId, sessionId string, expiresAt time.Time) (string, error) {
+	claims := models.Claims{
+		UserID:          u.Id,
+		Name:            u.FirstName + " " + u.LastName,
+		Email:           u.Email,
+		Gender:          u.Gender,
+		DateOfBirth:     u.Dob.Format(time.RFC3339),
+		Pfp:             u.Pfp,
+		ImpersonatedBy:  actorId,
+		ImpersonationId: sessionId,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "spark",
+		},
+	}
+	return utils.GenerateJWT(claims)
+}
@@ -4,10 +4,12 @@ import (
 	"spark/internal/auth"
 	"spark/internal/graph/model"
 	"spark/internal/helpers/users"
+	"spark/internal/i18n"
 	"spark/internal/mailer"
 	"spark/internal/models"
 	"context"
 	"errors"
+	"log"
 	"strings"
 
 	"github.com/MelloB1989/karma/config"
@@ -105,6 +107,11 @@ func (*WorkosAuth) LoginWithPassword(email, password string) (*model.AuthPayload
 		}
 		return nil, errors.New("user not found")
 	}
+	if response.User.EmailVerified {
+		if err := users.MarkEmailVerified(fu.Id); err != nil {
+			log.Printf("[Auth] %v", err)
+		}
+	}
 
 	t, err := auth.CreateJWT(*fu)
 	if err != nil {
@@ -131,7 +138,11 @@ func (*WorkosAuth) RequestEmailLoginCode(email string) (bool, error) {
 		},
 	)
 
-	mail := mailer.BuildMagicLogin(email, response.Code)
+	locale := i18n.DefaultLocale
+	if u, err := users.GetUserByEmail(email); err == nil && u != nil {
+		locale = users.LocaleOf(u)
+	}
+	mail := mailer.BuildMagicLogin(email, locale, response.Code)
 	err = mail.Send()
 	if err != nil {
 		return false, err
@@ -165,6 +176,10 @@ func (*WorkosAuth) VerifyEmailLoginCode(email, code string) (*model.AuthPayload,
 		}
 		return nil, errors.New("user not found")
 	}
+	// The code was sent to the address, so signing in with it proves the user owns it
+	if err := users.MarkEmailVerified(fu.Id); err != nil {
+		log.Printf("[Auth] %v", err)
+	}
 
 	t, err := auth.CreateJWT(*fu)
 	if err != nil {
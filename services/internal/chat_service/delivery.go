@@ -0,0 +1,347 @@
+package chatservice
+
+import (
+	"spark/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/MelloB1989/karma/v2/orm"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrDuplicateMessage is returned by SendMessage when the sender already sent a
+// message with the same client id. The message passed in is replaced by the original.
+var ErrDuplicateMessage = errors.New("message already sent")
+
+// ClientIdTTL is how long a client message id is remembered for deduplication.
+const ClientIdTTL = 24 * time.Hour
+
+const MessageEventStatus MessageEvents = "status"
+
+type DeliveryStatus string
+
+const (
+	StatusSent      DeliveryStatus = "sent"
+	StatusDelivered DeliveryStatus = "delivered"
+	StatusSeen      DeliveryStatus = "seen"
+)
+
+func chatClientIdKey(chatId, senderId, clientId string) string {
+	return fmt.Sprintf("spark:chat:%s:client:%s:%s", chatId, senderId, clientId)
+}
+
+// MessageStatus is one step of a message's status timeline. UserId is the
+// recipient who acknowledged it, or the sender for StatusSent.
+type MessageStatus struct {
+	MessageId string         `json:"message_id"`
+	ClientId  string         `json:"client_id,omitempty"`
+	SenderId  string         `json:"sender_id"`
+	UserId    string         `json:"user_id"`
+	Status    DeliveryStatus `json:"status"`
+	At        time.Time      `json:"at"`
+}
+
+// ackScript records a delivered (and optionally seen) ack from ARGV[1] on the buffered
+// messages listed in ARGV[4..]. Existing timestamps are never overwritten, so acks are
+// idempotent. It returns the messages that changed and the ids found in the buffer.
+//
+// cjson can't tell an empty array from an empty object and encodes both as {}, which
+// the Go side can't read into a slice. Empty arrays are written as null instead, the
+// way Go encodes a nil slice.
+var ackScript = redis.NewScript(`
+	local function emptyArraysToNull(msg)
+		for _, k in ipairs({'media', 'reactions'}) do
+			if type(msg[k]) == 'table' and next(msg[k]) == nil then
+				msg[k] = cjson.null
+			end
+		end
+		if type(msg.media) == 'table' then
+			for _, m in ipairs(msg.media) do
+				if type(m.waveform) == 'table' and next(m.waveform) == nil then
+					m.waveform = nil
+				end
+			end
+		end
+	end
+
+	local uid = ARGV[1]
+	local seen = ARGV[2] == 'seen'
+	local ts = ARGV[3]
+	local wanted = {}
+	for i = 4, #ARGV do
+		wanted[ARGV[i]] = true
+	end
+
+	local changed = {}
+	local found = {}
+	local messages = redis.call('LRANGE', KEYS[1], 0, -1)
+	for i, msgJson in ipairs(messages) do
+		local msg = cjson.decode(msgJson)
+		if wanted[msg.id] then
+			table.insert(found, msg.id)
+			if msg.sender_id ~= uid then
+				local dirty = false
+				if type(msg.delivered_at) ~= 'table' then
+					msg.delivered_at = {}
+				end
+				if msg.delivered_at[uid] == nil then
+					msg.delivered_at[uid] = ts
+					msg.received = true
+					dirty = true
+				end
+				if seen then
+					if type(msg.seen_at) ~= 'table' then
+						msg.seen_at = {}
+					end
+					if msg.seen_at[uid] == nil then
+						msg.seen_at[uid] = ts
+						msg.seen = true
+						dirty = true
+					end
+				end
+				if dirty then
+					emptyArraysToNull(msg)
+					local updated = cjson.encode(msg)
+					redis.call('LSET', KEYS[1], i - 1, updated)
+					table.insert(changed, updated)
+				end
+			end
+		end
+	end
+	return {changed, found}
+`)
+
+// applyAck records userId's ack on msg and reports whether anything changed.
+// Senders can't ack their own messages and existing timestamps are kept.
+func applyAck(msg *models.Message, userId string, status DeliveryStatus, at time.Time) bool {
+	if msg.SenderId == userId {
+		return false
+	}
+
+	changed := false
+	if _, ok := msg.DeliveredAt[userId]; !ok {
+		if msg.DeliveredAt == nil {
+			msg.DeliveredAt = make(map[string]time.Time)
+		}
+		msg.DeliveredAt[userId] = at
+		msg.Received = true
+		changed = true
+	}
+	if status == StatusSeen {
+		if _, ok := msg.SeenAt[userId]; !ok {
+			if msg.SeenAt == nil {
+				msg.SeenAt = make(map[string]time.Time)
+			}
+			msg.SeenAt[userId] = at
+			msg.Seen = true
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// MarkMessagesDelivered records that messageIds reached userId's device. Besides the
+// status events, each newly delivered message is published as an update, which older
+// clients read as message_received.
+func (s *Store) MarkMessagesDelivered(messageIds []string, userId string) error {
+	_, changed, err := s.ack(messageIds, userId, StatusDelivered)
+	for i := range changed {
+		s.publishUpdateEvent(&changed[i])
+	}
+	return err
+}
+
+// ack applies a delivered or seen ack to buffered and persisted messages and
+// publishes the resulting status changes. It returns them along with the messages
+// that changed.
+func (s *Store) ack(messageIds []string, userId string, status DeliveryStatus) ([]MessageStatus, []models.Message, error) {
+	s.ensureRedis()
+
+	if len(messageIds) == 0 {
+		return nil, nil, nil
+	}
+
+	at := time.Now()
+	args := []any{userId, string(status), at.Format(time.RFC3339Nano)}
+	for _, id := range messageIds {
+		args = append(args, id)
+	}
+
+	res, err := ackScript.Run(ctx, s.rc, []string{chatMsgsKey(s.chatId)}, args...).Slice()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to ack buffered messages: %w", err)
+	}
+
+	changed := make([]models.Message, 0)
+	found := make(map[string]bool)
+	if len(res) == 2 {
+		if raw, ok := res[0].([]any); ok {
+			for _, r := range raw {
+				str, ok := r.(string)
+				if !ok {
+					continue
+				}
+				var msg models.Message
+				if err := json.Unmarshal([]byte(str), &msg); err != nil {
+					log.Printf("failed to unmarshal acked message: %v", err)
+					continue
+				}
+				changed = append(changed, msg)
+			}
+		}
+		if ids, ok := res[1].([]any); ok {
+			for _, id := range ids {
+				if str, ok := id.(string); ok {
+					found[str] = true
+				}
+			}
+		}
+	}
+
+	persisted := make([]string, 0)
+	for _, id := range messageIds {
+		if !found[id] {
+			persisted = append(persisted, id)
+		}
+	}
+	if len(persisted) > 0 {
+		fromDB, err := s.ackInDB(persisted, userId, status, at)
+		if err != nil {
+			log.Printf("failed to ack persisted messages in chat %s: %v", s.chatId, err)
+		}
+		changed = append(changed, fromDB...)
+	}
+
+	statuses := statusesFor(changed, userId, at)
+	if len(statuses) > 0 {
+		s.publishStatuses(statuses)
+	}
+
+	return statuses, changed, nil
+}
+
+// ackInDB applies an ack to already flushed messages in a single chat update.
+func (s *Store) ackInDB(messageIds []string, userId string, status DeliveryStatus, at time.Time) ([]models.Message, error) {
+	chatORM := orm.Load(&models.Chat{})
+	defer chatORM.Close()
+
+	var chats []models.Chat
+	if err := chatORM.GetByFieldEquals("Id", s.chatId).Scan(&chats); err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+
+	if len(chats) == 0 {
+		return nil, fmt.Errorf("chat not found: %s", s.chatId)
+	}
+
+	chat := chats[0]
+	ids := make(map[string]bool, len(messageIds))
+	for _, id := range messageIds {
+		ids[id] = true
+	}
+
+	changed := make([]models.Message, 0)
+	for i := range chat.Messages {
+		if ids[chat.Messages[i].Id] && applyAck(&chat.Messages[i], userId, status, at) {
+			changed = append(changed, chat.Messages[i])
+		}
+	}
+
+	if len(changed) == 0 {
+		return changed, nil
+	}
+
+	updateORM := orm.Load(&models.Chat{})
+	defer updateORM.Close()
+
+	if err := updateORM.Update(&chat, s.chatId); err != nil {
+		return nil, fmt.Errorf("failed to update chat: %w", err)
+	}
+
+	s.rc.Del(ctx, chatCacheKey(s.chatId))
+
+	return changed, nil
+}
+
+// statusesFor lists the status changes an ack made at `at` caused on msgs.
+func statusesFor(msgs []models.Message, userId string, at time.Time) []MessageStatus {
+	statuses := make([]MessageStatus, 0, len(msgs))
+	for _, msg := range msgs {
+		status := MessageStatus{
+			MessageId: msg.Id,
+			ClientId:  msg.ClientId,
+			SenderId:  msg.SenderId,
+			UserId:    userId,
+			At:        at,
+		}
+		if t, ok := msg.DeliveredAt[userId]; ok && t.Equal(at) {
+			status.Status = StatusDelivered
+			statuses = append(statuses, status)
+		}
+		if t, ok := msg.SeenAt[userId]; ok && t.Equal(at) {
+			status.Status = StatusSeen
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+func (s *Store) publishStatuses(statuses []MessageStatus) {
+	data, err := json.Marshal(statuses)
+	if err != nil {
+		log.Printf("failed to marshal statuses: %v", err)
+		return
+	}
+	eventJSON, _ := json.Marshal(PubSubEvent{
+		Type: MessageEventStatus,
+		Data: data,
+	})
+	if err := s.rc.Publish(ctx, chatPubKey(s.chatId), eventJSON).Err(); err != nil {
+		log.Printf("failed to publish statuses for chat %s: %v", s.chatId, err)
+	}
+}
+
+// claimClientId reserves msg.ClientId for msg. If the sender already used it, the
+// original message is returned instead.
+func (s *Store) claimClientId(msg *models.Message) (*models.Message, error) {
+	key := chatClientIdKey(s.chatId, msg.SenderId, msg.ClientId)
+	ok, err := s.rc.SetNX(ctx, key, msg.Id, ClientIdTTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim client id: %w", err)
+	}
+	if ok {
+		return nil, nil
+	}
+
+	existingId, err := s.rc.Get(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message for client id: %w", err)
+	}
+	existing, err := s.GetMessageById(existingId)
+	if err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// releaseScript deletes KEYS[1] only while it still holds ARGV[1]
+var releaseScript = redis.NewScript(`
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('DEL', KEYS[1])
+	end
+	return 0
+`)
+
+// releaseClientId gives up msg's claim on its client id after the message couldn't be
+// stored, so a resend isn't mistaken for a duplicate of a message that doesn't exist.
+func (s *Store) releaseClientId(msg *models.Message) {
+	key := chatClientIdKey(s.chatId, msg.SenderId, msg.ClientId)
+	if err := releaseScript.Run(ctx, s.rc, []string{key}, msg.Id).Err(); err != nil {
+		log.Printf("failed to release client id %s in chat %s: %v", msg.ClientId, s.chatId, err)
+	}
+}
@@ -0,0 +1,110 @@
+package chatservice
+
+import (
+	"spark/internal/models"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const DefaultQueryLimit = 10
+
+// MessageQuery selects a page of chat history. At most one of BeforeId, AfterId,
+// AroundId and Since should be set; with none of them the latest messages are returned.
+type MessageQuery struct {
+	Limit    int
+	BeforeId string
+	AfterId  string
+	AroundId string
+	Since    *time.Time
+}
+
+// MessagePage is a contiguous slice of chat history in chronological order.
+type MessagePage struct {
+	Messages      []models.Message
+	HasMoreBefore bool
+	HasMoreAfter  bool
+}
+
+// mergeMessages combines persisted and buffered messages into a single chronological
+// history. A message present in both (e.g. pushed back after a failed flush) is kept
+// once, preferring the buffered copy since it carries the latest updates.
+func mergeMessages(persisted, buffered []models.Message) []models.Message {
+	bufferedIds := make(map[string]bool, len(buffered))
+	for _, msg := range buffered {
+		bufferedIds[msg.Id] = true
+	}
+
+	all := make([]models.Message, 0, len(persisted)+len(buffered))
+	for _, msg := range persisted {
+		if !bufferedIds[msg.Id] {
+			all = append(all, msg)
+		}
+	}
+	all = append(all, buffered...)
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].CreatedAt.Before(all[j].CreatedAt)
+	})
+
+	return all
+}
+
+func indexOfMessage(msgs []models.Message, id string) int {
+	for i, msg := range msgs {
+		if msg.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// pageMessages cuts the page described by q out of a chronological history.
+func pageMessages(all []models.Message, q MessageQuery) (*MessagePage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultQueryLimit
+	}
+
+	var start, end int
+	switch {
+	case q.AroundId != "":
+		idx := indexOfMessage(all, q.AroundId)
+		if idx == -1 {
+			return nil, fmt.Errorf("message not found: %s", q.AroundId)
+		}
+		start = max(idx-limit/2, 0)
+		end = min(start+limit, len(all))
+		start = max(end-limit, 0)
+	case q.AfterId != "":
+		idx := indexOfMessage(all, q.AfterId)
+		if idx == -1 {
+			return nil, fmt.Errorf("message not found: %s", q.AfterId)
+		}
+		start = idx + 1
+		end = min(start+limit, len(all))
+	case q.Since != nil:
+		start = sort.Search(len(all), func(i int) bool {
+			return all[i].CreatedAt.After(*q.Since)
+		})
+		end = min(start+limit, len(all))
+	default:
+		end = len(all)
+		if q.BeforeId != "" {
+			// An unknown cursor falls back to the latest messages
+			if idx := indexOfMessage(all, q.BeforeId); idx != -1 {
+				end = idx
+			}
+		}
+		start = max(end-limit, 0)
+	}
+
+	msgs := make([]models.Message, end-start)
+	copy(msgs, all[start:end])
+
+	return &MessagePage{
+		Messages:      msgs,
+		HasMoreBefore: start > 0,
+		HasMoreAfter:  end < len(all),
+	}, nil
+}
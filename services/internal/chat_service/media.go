@@ -0,0 +1,183 @@
+package chatservice
+
+import (
+	"spark/internal/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/v2/orm"
+	"github.com/redis/go-redis/v9"
+)
+
+// IsUnlocked reports whether the chat's match has been unlocked. Unlocking is
+// permanent, so once seen it is not looked up again.
+func (s *Store) IsUnlocked() bool {
+	if s.unlocked.Load() || s.matchId == "" {
+		return s.unlocked.Load()
+	}
+
+	matchORM := orm.Load(&models.Match{})
+	defer matchORM.Close()
+
+	var matches []models.Match
+	if err := matchORM.GetByFieldEquals("Id", s.matchId).Scan(&matches); err != nil {
+		log.Printf("failed to get match %s: %v", s.matchId, err)
+		return false
+	}
+	if len(matches) > 0 && matches[0].IsUnlocked {
+		s.unlocked.Store(true)
+	}
+
+	return s.unlocked.Load()
+}
+
+// MaskMedia hides the original media of the other participant's messages while
+// the match is locked.
+func (s *Store) MaskMedia(msgs []models.Message) []models.Message {
+	if s.IsUnlocked() {
+		return msgs
+	}
+	return MaskLockedMedia(msgs, s.userId)
+}
+
+// MaskLockedMedia returns copies of msgs in which media sent by anyone but viewerId
+// points at its blurred version. Media without a blurred version, including media
+// whose blur is still pending, is left without a URL.
+func MaskLockedMedia(msgs []models.Message, viewerId string) []models.Message {
+	masked := make([]models.Message, len(msgs))
+	for i, msg := range msgs {
+		masked[i] = msg
+		if msg.SenderId == viewerId || len(msg.Media) == 0 {
+			continue
+		}
+		masked[i].Media = make([]models.Media, len(msg.Media))
+		for j, m := range msg.Media {
+			switch models.MessageType(strings.ToUpper(m.Type)) {
+			case models.IMAGE, models.VIDEO:
+				m.Url = m.BlurredUrl
+			}
+			masked[i].Media[j] = m
+		}
+	}
+	return masked
+}
+
+// SetBlurredMedia records the blurred copies made for a message's media, by file id,
+// and tells the participants the message changed.
+func (s *Store) SetBlurredMedia(messageId string, blurred map[string]string) (*models.Message, error) {
+	s.ensureRedis()
+
+	apply := func(msg *models.Message) {
+		applyBlurredMedia(msg, blurred, time.Now())
+	}
+
+	updated, err := s.updateBufferedMessage(messageId, apply)
+	if err != nil {
+		return nil, err
+	}
+	if updated == nil {
+		updated, err = s.updatePersistedMessage(messageId, apply)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.publishUpdateEvent(updated)
+	return updated, nil
+}
+
+// applyBlurredMedia sets the blurred copies on msg's media. The message counts as
+// updated at now, which is how recipients tell its update apart from an ack.
+func applyBlurredMedia(msg *models.Message, blurred map[string]string, now time.Time) {
+	changed := false
+	for i, m := range msg.Media {
+		if url, ok := blurred[m.FileId]; ok {
+			msg.Media[i].BlurredUrl = url
+			msg.Media[i].BlurPending = false
+			changed = true
+		}
+	}
+	if changed {
+		msg.UpdatedAt = now
+	}
+}
+
+// updateBufferedMessage applies change to a message still in the Redis buffer. It
+// returns nil when the message isn't buffered.
+func (s *Store) updateBufferedMessage(messageId string, change func(*models.Message)) (*models.Message, error) {
+	msgsKey := chatMsgsKey(s.chatId)
+	var updated *models.Message
+	txn := func(tx *redis.Tx) error {
+		updated = nil
+		raw, err := tx.LRange(ctx, msgsKey, 0, -1).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		for i, str := range raw {
+			var msg models.Message
+			if err := json.Unmarshal([]byte(str), &msg); err != nil || msg.Id != messageId {
+				continue
+			}
+			change(&msg)
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.LSet(ctx, msgsKey, int64(i), data)
+				return nil
+			}); err != nil {
+				return err
+			}
+			updated = &msg
+			return nil
+		}
+		return nil
+	}
+
+	// A flush or another update in between makes the transaction fail; read again
+	for range 3 {
+		err := s.rc.Watch(ctx, txn, msgsKey)
+		if err == redis.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to update buffered message: %w", err)
+		}
+		return updated, nil
+	}
+	return nil, fmt.Errorf("failed to update buffered message: %w", redis.TxFailedErr)
+}
+
+// updatePersistedMessage applies change to a message that was flushed to Postgres.
+func (s *Store) updatePersistedMessage(messageId string, change func(*models.Message)) (*models.Message, error) {
+	chatORM := orm.Load(&models.Chat{})
+	defer chatORM.Close()
+
+	var chats []models.Chat
+	if err := chatORM.GetByFieldEquals("Id", s.chatId).Scan(&chats); err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+	if len(chats) == 0 {
+		return nil, fmt.Errorf("chat not found: %s", s.chatId)
+	}
+
+	chat := chats[0]
+	for i := range chat.Messages {
+		if chat.Messages[i].Id != messageId {
+			continue
+		}
+		change(&chat.Messages[i])
+		updateORM := orm.Load(&models.Chat{})
+		defer updateORM.Close()
+		if err := updateORM.Update(&chat, s.chatId); err != nil {
+			return nil, fmt.Errorf("failed to update chat: %w", err)
+		}
+		s.rc.Del(ctx, chatCacheKey(s.chatId))
+		return &chat.Messages[i], nil
+	}
+	return nil, fmt.Errorf("message not found: %s", messageId)
+}
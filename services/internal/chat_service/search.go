@@ -0,0 +1,292 @@
+package chatservice
+
+import (
+	"spark/internal/models"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	SearchDefaultLimit = 20
+	SearchMaxLimit     = 50
+	// SearchContextSize is the number of messages returned on each side of a hit
+	SearchContextSize = 2
+)
+
+// SearchHit is a single message matching a search, along with its neighbours.
+// AnchorId is the message id clients pass as around_id in query_messages to jump to the hit.
+type SearchHit struct {
+	ChatId   string
+	AnchorId string
+	Message  models.Message
+	Snippet  string
+	Rank     float64
+	Before   []models.Message
+	After    []models.Message
+}
+
+type searchRow struct {
+	ChatId  string
+	Ord     int
+	Rank    float64
+	Snippet string
+	Window  json.RawMessage
+}
+
+// SearchMessages runs a full-text search over every chat userId participates in,
+// optionally restricted to a single chat. Persisted messages are matched with Postgres
+// full-text search, and so are messages still sitting in the Redis buffer.
+func SearchMessages(userId, query, chatId string, limit int) ([]SearchHit, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []SearchHit{}, nil
+	}
+	if limit <= 0 {
+		limit = SearchDefaultLimit
+	}
+	if limit > SearchMaxLimit {
+		limit = SearchMaxLimit
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	chatRows, err := db.Query(`
+		SELECT c.id, m.is_unlocked
+		FROM chats c
+		JOIN matches m ON m.id::text = c.match_id
+		WHERE (m.she_id = $1 OR m.he_id = $1)
+		  AND ($2 = '' OR c.id = $2)
+	`, userId, chatId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chats: %w", err)
+	}
+	chatIds := make([]string, 0)
+	locked := make(map[string]bool)
+	for chatRows.Next() {
+		var id string
+		var unlocked bool
+		if err := chatRows.Scan(&id, &unlocked); err != nil {
+			chatRows.Close()
+			return nil, fmt.Errorf("failed to scan chat id: %w", err)
+		}
+		chatIds = append(chatIds, id)
+		locked[id] = !unlocked
+	}
+	chatRows.Close()
+
+	if len(chatIds) == 0 {
+		if chatId != "" {
+			return nil, ErrUnauthorized
+		}
+		return []SearchHit{}, nil
+	}
+
+	rows, err := db.Query(`
+		WITH q AS (
+			SELECT websearch_to_tsquery('simple', $2) AS query
+		), my_chats AS (
+			SELECT c.id, c.messages::jsonb AS msgs
+			FROM chats c
+			JOIN matches m ON m.id::text = c.match_id, q
+			WHERE (m.she_id = $1 OR m.he_id = $1)
+			  AND ($3 = '' OR c.id = $3)
+			  AND jsonb_to_tsvector('simple', c.messages::jsonb, '["string"]') @@ q.query
+		)
+		SELECT
+			mc.id,
+			msg.ord,
+			ts_rank(to_tsvector('simple', msg.value->>'content'), q.query) AS rank,
+			ts_headline('simple', msg.value->>'content', q.query, 'StartSel=<mark>, StopSel=</mark>, MaxWords=24, MinWords=8') AS snippet,
+			(
+				SELECT jsonb_agg(w.value ORDER BY w.ord)
+				FROM jsonb_array_elements(mc.msgs) WITH ORDINALITY AS w(value, ord)
+				WHERE w.ord BETWEEN msg.ord - $5 AND msg.ord + $5
+			) AS msg_window
+		FROM my_chats mc
+		CROSS JOIN q
+		CROSS JOIN LATERAL jsonb_array_elements(mc.msgs) WITH ORDINALITY AS msg(value, ord)
+		WHERE to_tsvector('simple', msg.value->>'content') @@ q.query
+		ORDER BY msg.value->>'created_at' DESC
+		LIMIT $4
+	`, userId, query, chatId, limit, SearchContextSize)
+	if err != nil {
+		return nil, fmt.Errorf("search query failed: %w", err)
+	}
+	defer rows.Close()
+
+	hits := make([]SearchHit, 0)
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var row searchRow
+		if err := rows.Scan(&row.ChatId, &row.Ord, &row.Rank, &row.Snippet, &row.Window); err != nil {
+			return nil, fmt.Errorf("failed to scan search row: %w", err)
+		}
+
+		var window []models.Message
+		if err := json.Unmarshal(row.Window, &window); err != nil {
+			log.Printf("failed to unmarshal search window for chat %s: %v", row.ChatId, err)
+			continue
+		}
+
+		// The window starts SearchContextSize messages before the hit, or at the first message
+		anchorIdx := min(row.Ord-1, SearchContextSize)
+		if anchorIdx < 0 || anchorIdx >= len(window) {
+			continue
+		}
+
+		hit := newSearchHit(row.ChatId, window, anchorIdx)
+		hit.Rank = row.Rank
+		hit.Snippet = row.Snippet
+		seen[hit.AnchorId] = true
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("search rows iteration error: %w", err)
+	}
+
+	buffered, err := searchBufferedMessages(db, chatIds, query)
+	if err != nil {
+		log.Printf("failed to search buffered messages for user %s: %v", userId, err)
+	}
+	for _, hit := range buffered {
+		if !seen[hit.AnchorId] {
+			hits = append(hits, hit)
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Message.CreatedAt.After(hits[j].Message.CreatedAt)
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	for i := range hits {
+		if locked[hits[i].ChatId] {
+			hits[i].Message = MaskLockedMedia([]models.Message{hits[i].Message}, userId)[0]
+			hits[i].Before = MaskLockedMedia(hits[i].Before, userId)
+			hits[i].After = MaskLockedMedia(hits[i].After, userId)
+		}
+	}
+
+	return hits, nil
+}
+
+// searchBufferedMessages matches messages that have not been flushed to Postgres yet.
+// Their contents go through the same full-text query as persisted messages, so a search
+// finds the same words whatever the age of the message.
+func searchBufferedMessages(db queryer, chatIds []string, query string) ([]SearchHit, error) {
+	rc := utils.RedisConnect()
+	defer rc.Close()
+
+	pipe := rc.Pipeline()
+	cmds := make([]*redis.StringSliceCmd, len(chatIds))
+	for i, id := range chatIds {
+		cmds[i] = pipe.LRange(ctx, chatMsgsKey(id), 0, -1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read buffered messages: %w", err)
+	}
+
+	type ref struct{ chat, idx int }
+	buffers := make([][]models.Message, len(chatIds))
+	contents := make([]string, 0)
+	refs := make([]ref, 0)
+	for i, cmd := range cmds {
+		raw, err := cmd.Result()
+		if err != nil {
+			continue
+		}
+		for _, str := range raw {
+			var msg models.Message
+			if err := json.Unmarshal([]byte(str), &msg); err != nil {
+				continue
+			}
+			refs = append(refs, ref{i, len(buffers[i])})
+			contents = append(contents, msg.Content)
+			buffers[i] = append(buffers[i], msg)
+		}
+	}
+	if len(contents) == 0 {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal buffered messages: %w", err)
+	}
+	rows, err := db.Query(`
+		WITH q AS (
+			SELECT websearch_to_tsquery('simple', $2) AS query
+		)
+		SELECT
+			msg.ord,
+			ts_rank(to_tsvector('simple', msg.content), q.query) AS rank,
+			ts_headline('simple', msg.content, q.query, 'StartSel=<mark>, StopSel=</mark>, MaxWords=24, MinWords=8') AS snippet
+		FROM jsonb_array_elements_text($1::jsonb) WITH ORDINALITY AS msg(content, ord)
+		CROSS JOIN q
+		WHERE to_tsvector('simple', msg.content) @@ q.query
+	`, string(payload), query)
+	if err != nil {
+		return nil, fmt.Errorf("buffered search query failed: %w", err)
+	}
+	defer rows.Close()
+
+	hits := make([]SearchHit, 0)
+	for rows.Next() {
+		var ord int
+		var rank float64
+		var snippet string
+		if err := rows.Scan(&ord, &rank, &snippet); err != nil {
+			return nil, fmt.Errorf("failed to scan buffered search row: %w", err)
+		}
+		if ord < 1 || ord > len(refs) {
+			continue
+		}
+		r := refs[ord-1]
+		window, anchorIdx := windowAround(buffers[r.chat], r.idx)
+		hit := newSearchHit(chatIds[r.chat], window, anchorIdx)
+		hit.Rank = rank
+		hit.Snippet = snippet
+		hits = append(hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("buffered search rows iteration error: %w", err)
+	}
+	return hits, nil
+}
+
+// queryer is the part of a database handle search reads through
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// windowAround returns the messages within SearchContextSize of msgs[idx], and where
+// msgs[idx] is in them.
+func windowAround(msgs []models.Message, idx int) ([]models.Message, int) {
+	start := max(idx-SearchContextSize, 0)
+	end := min(idx+SearchContextSize+1, len(msgs))
+	return msgs[start:end], idx - start
+}
+
+func newSearchHit(chatId string, window []models.Message, anchorIdx int) SearchHit {
+	return SearchHit{
+		ChatId:   chatId,
+		AnchorId: window[anchorIdx].Id,
+		Message:  window[anchorIdx],
+		Before:   append([]models.Message{}, window[:anchorIdx]...),
+		After:    append([]models.Message{}, window[anchorIdx+1:]...),
+	}
+}
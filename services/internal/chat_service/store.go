@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"log"
 	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/MelloB1989/karma/config"
@@ -46,7 +47,9 @@ const (
 type Store struct {
 	chatId       string
 	userId       string
+	matchId      string
 	participants []string
+	unlocked     atomic.Bool
 	rc           *redis.Client
 }
 
@@ -105,7 +108,9 @@ func (s *Store) loadParticipants() error {
 	}
 
 	match := matches[0]
+	s.matchId = match.Id
 	s.participants = []string{match.SheId, match.HeId}
+	s.unlocked.Store(match.IsUnlocked)
 
 	return nil
 }
@@ -146,8 +151,22 @@ func (s *Store) SendMessage(msg *models.Message) error {
 	}
 	msg.UpdatedAt = msg.CreatedAt
 
+	if msg.ClientId != "" {
+		existing, err := s.claimClientId(msg)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			*msg = *existing
+			return ErrDuplicateMessage
+		}
+	}
+
 	msgJSON, err := json.Marshal(msg)
 	if err != nil {
+		if msg.ClientId != "" {
+			s.releaseClientId(msg)
+		}
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
@@ -166,6 +185,8 @@ func (s *Store) SendMessage(msg *models.Message) error {
 	metaKey := chatMetaKey(s.chatId)
 	now := time.Now().Unix()
 	pipe.HSet(ctx, metaKey, "last_activity_ts", now)
+	s.queueLastMessageMeta(pipe, msg)
+	s.queueUnreadIncrements(pipe, msg.SenderId)
 
 	pipe.ZAdd(ctx, chatActiveKey(), redis.Z{
 		Score:  float64(now),
@@ -174,6 +195,9 @@ func (s *Store) SendMessage(msg *models.Message) error {
 
 	_, err = pipe.Exec(ctx)
 	if err != nil {
+		if msg.ClientId != "" {
+			s.releaseClientId(msg)
+		}
 		return fmt.Errorf("redis pipeline failed: %w", err)
 	}
 
@@ -251,7 +275,9 @@ func (s *Store) incrementMessageCountAndCheckUnlock(senderId string) {
 	_ = result
 }
 
-func (s *Store) GetMessages(limit int, beforeId string) ([]models.Message, error) {
+// QueryMessages returns a page of the chat history selected by q, merging the
+// persisted messages with the ones still sitting in the Redis buffer.
+func (s *Store) QueryMessages(q MessageQuery) (*MessagePage, error) {
 	s.ensureRedis()
 
 	chat, err := s.GetChat()
@@ -265,30 +291,7 @@ func (s *Store) GetMessages(limit int, beforeId string) ([]models.Message, error
 		bufferedMsgs = []models.Message{}
 	}
 
-	allMessages := append(chat.Messages, bufferedMsgs...)
-
-	if beforeId != "" {
-		filtered := make([]models.Message, 0)
-		found := false
-		for _, msg := range allMessages {
-			if msg.Id == beforeId {
-				found = true
-				continue
-			}
-			if found {
-				filtered = append(filtered, msg)
-			}
-		}
-		if found {
-			allMessages = filtered
-		}
-	}
-
-	if limit > 0 && len(allMessages) > limit {
-		allMessages = allMessages[len(allMessages)-limit:]
-	}
-
-	return allMessages, nil
+	return pageMessages(mergeMessages(chat.Messages, bufferedMsgs), q)
 }
 
 func (s *Store) GetMessageById(messageId string) (*models.Message, error) {
@@ -388,8 +391,19 @@ func (s *Store) StopTypingEvent(userId string) error {
 func (s *Store) MarkMessagesSeen(messageIds []string, userId string) error {
 	s.ensureRedis()
 
-	for _, msgId := range messageIds {
-		s.updateMessageInBuffer(msgId, &models.Message{Seen: true, Received: true})
+	statuses, _, err := s.ack(messageIds, userId, StatusSeen)
+	if err != nil {
+		return err
+	}
+
+	newlySeen := 0
+	for _, st := range statuses {
+		if st.Status == StatusSeen {
+			newlySeen++
+		}
+	}
+	if err := s.decrementUnread(userId, newlySeen); err != nil {
+		log.Printf("failed to update unread count for user %s: %v", userId, err)
 	}
 
 	event := PubSubEvent{
@@ -538,6 +538,354 @@ func TestChatKeyGeneration(t *testing.T) {
 	}
 }
 
+func TestUnreadKeyGeneration(t *testing.T) {
+	key := userUnreadKey("user-123")
+	t.Logf("DEBUG: unreadKey = %s", key)
+
+	expected := "spark:user:user-123:unread"
+	if key != expected {
+		t.Errorf("Expected unreadKey '%s', got '%s'", expected, key)
+	}
+}
+
+func TestParseLastMessageMeta(t *testing.T) {
+	if meta := parseLastMessageMeta(map[string]string{"last_activity_ts": "1700000000"}); meta != nil {
+		t.Errorf("Expected nil meta for chat without last message, got %+v", meta)
+	}
+
+	sentAt := time.Now().UTC().Truncate(time.Millisecond)
+	meta := parseLastMessageMeta(map[string]string{
+		metaLastMessageId:       "msg-001",
+		metaLastMessageContent:  "hey there",
+		metaLastMessageType:     string(models.TEXT),
+		metaLastMessageSenderId: "user-001",
+		metaLastMessageAt:       sentAt.Format(time.RFC3339Nano),
+	})
+	t.Logf("DEBUG: Parsed meta: %+v", meta)
+
+	if meta == nil {
+		t.Fatal("Expected meta to be parsed")
+	}
+	if meta.Id != "msg-001" || meta.Content != "hey there" || meta.SenderId != "user-001" {
+		t.Errorf("Unexpected meta fields: %+v", meta)
+	}
+	if meta.Type != models.TEXT {
+		t.Errorf("Expected type TEXT, got %s", meta.Type)
+	}
+	if !meta.SentAt.Equal(sentAt) {
+		t.Errorf("Expected SentAt %v, got %v", sentAt, meta.SentAt)
+	}
+}
+
+func TestWindowAround(t *testing.T) {
+	msgs := []models.Message{{Id: "msg-1"}, {Id: "msg-2"}, {Id: "msg-3"}, {Id: "msg-4"}, {Id: "msg-5"}, {Id: "msg-6"}}
+
+	tests := []struct {
+		idx        int
+		wantFirst  string
+		wantLen    int
+		wantAnchor int
+	}{
+		{0, "msg-1", 3, 0},
+		{2, "msg-1", 5, 2},
+		{3, "msg-2", 5, 2},
+		{5, "msg-4", 3, 2},
+	}
+	for _, tt := range tests {
+		window, anchor := windowAround(msgs, tt.idx)
+		if len(window) != tt.wantLen || window[0].Id != tt.wantFirst || anchor != tt.wantAnchor {
+			t.Errorf("windowAround(%d) = %d messages from %s, anchor %d", tt.idx, len(window), window[0].Id, anchor)
+		}
+		if window[anchor].Id != msgs[tt.idx].Id {
+			t.Errorf("windowAround(%d) anchored on %s", tt.idx, window[anchor].Id)
+		}
+	}
+}
+
+func TestNewSearchHitWindow(t *testing.T) {
+	window := []models.Message{{Id: "msg-1"}, {Id: "msg-2"}, {Id: "msg-3"}, {Id: "msg-4"}}
+
+	hit := newSearchHit("chat-001", window, 1)
+	if hit.AnchorId != "msg-2" || hit.Message.Id != "msg-2" {
+		t.Errorf("Expected anchor msg-2, got %s", hit.AnchorId)
+	}
+	if len(hit.Before) != 1 || hit.Before[0].Id != "msg-1" {
+		t.Errorf("Unexpected before context: %+v", hit.Before)
+	}
+	if len(hit.After) != 2 || hit.After[0].Id != "msg-3" || hit.After[1].Id != "msg-4" {
+		t.Errorf("Unexpected after context: %+v", hit.After)
+	}
+}
+
+func historyFixture(n int) []models.Message {
+	base := time.Now().Add(-time.Hour)
+	msgs := make([]models.Message, n)
+	for i := range msgs {
+		msgs[i] = models.Message{
+			Id:        fmt.Sprintf("msg-%d", i),
+			Content:   fmt.Sprintf("message %d", i),
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	return msgs
+}
+
+func pageIds(page *MessagePage) []string {
+	ids := make([]string, len(page.Messages))
+	for i, msg := range page.Messages {
+		ids[i] = msg.Id
+	}
+	return ids
+}
+
+func TestMergeMessages(t *testing.T) {
+	all := historyFixture(5)
+	persisted := []models.Message{all[0], all[1], all[2]}
+	// msg-2 was pushed back to the buffer after a failed flush and then edited
+	edited := all[2]
+	edited.Content = "edited"
+	buffered := []models.Message{all[4], edited, all[3]}
+
+	merged := mergeMessages(persisted, buffered)
+	t.Logf("DEBUG: merged = %+v", merged)
+
+	if len(merged) != 5 {
+		t.Fatalf("Expected 5 merged messages, got %d", len(merged))
+	}
+	for i, msg := range merged {
+		if msg.Id != fmt.Sprintf("msg-%d", i) {
+			t.Errorf("Expected msg-%d at position %d, got %s", i, i, msg.Id)
+		}
+	}
+	if merged[2].Content != "edited" {
+		t.Errorf("Expected buffered copy to win, got content %q", merged[2].Content)
+	}
+}
+
+func TestPageMessages(t *testing.T) {
+	all := historyFixture(10)
+	since := all[6].CreatedAt
+
+	tests := []struct {
+		name          string
+		query         MessageQuery
+		expected      []string
+		hasMoreBefore bool
+		hasMoreAfter  bool
+	}{
+		{"latest", MessageQuery{Limit: 3}, []string{"msg-7", "msg-8", "msg-9"}, true, false},
+		{"before", MessageQuery{Limit: 3, BeforeId: "msg-4"}, []string{"msg-1", "msg-2", "msg-3"}, true, true},
+		{"before start", MessageQuery{Limit: 3, BeforeId: "msg-2"}, []string{"msg-0", "msg-1"}, false, true},
+		{"unknown before", MessageQuery{Limit: 2, BeforeId: "missing"}, []string{"msg-8", "msg-9"}, true, false},
+		{"after", MessageQuery{Limit: 3, AfterId: "msg-2"}, []string{"msg-3", "msg-4", "msg-5"}, true, true},
+		{"after end", MessageQuery{Limit: 3, AfterId: "msg-8"}, []string{"msg-9"}, true, false},
+		{"after last", MessageQuery{Limit: 3, AfterId: "msg-9"}, []string{}, true, false},
+		{"around", MessageQuery{Limit: 3, AroundId: "msg-5"}, []string{"msg-4", "msg-5", "msg-6"}, true, true},
+		{"around start", MessageQuery{Limit: 4, AroundId: "msg-0"}, []string{"msg-0", "msg-1", "msg-2", "msg-3"}, false, true},
+		{"around end", MessageQuery{Limit: 4, AroundId: "msg-9"}, []string{"msg-6", "msg-7", "msg-8", "msg-9"}, true, false},
+		{"since", MessageQuery{Limit: 2, Since: &since}, []string{"msg-7", "msg-8"}, true, true},
+		{"default limit", MessageQuery{}, []string{"msg-0", "msg-1", "msg-2", "msg-3", "msg-4", "msg-5", "msg-6", "msg-7", "msg-8", "msg-9"}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := pageMessages(all, tt.query)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			ids := pageIds(page)
+			t.Logf("DEBUG: %s -> %v (before=%v after=%v)", tt.name, ids, page.HasMoreBefore, page.HasMoreAfter)
+
+			if fmt.Sprint(ids) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, ids)
+			}
+			if page.HasMoreBefore != tt.hasMoreBefore {
+				t.Errorf("Expected HasMoreBefore %v, got %v", tt.hasMoreBefore, page.HasMoreBefore)
+			}
+			if page.HasMoreAfter != tt.hasMoreAfter {
+				t.Errorf("Expected HasMoreAfter %v, got %v", tt.hasMoreAfter, page.HasMoreAfter)
+			}
+		})
+	}
+
+	for _, q := range []MessageQuery{{AfterId: "missing"}, {AroundId: "missing"}} {
+		if _, err := pageMessages(all, q); err == nil {
+			t.Errorf("Expected error for unknown cursor in %+v", q)
+		}
+	}
+}
+
+func TestMaskLockedMedia(t *testing.T) {
+	msgs := []models.Message{
+		{
+			Id:       "msg-001",
+			SenderId: "user-001",
+			Type:     models.IMAGE,
+			Media:    []models.Media{{Id: "media-1", Type: string(models.IMAGE), Url: "https://cdn/own.jpg", BlurredUrl: "https://cdn/own_blurred.jpg"}},
+		},
+		{
+			Id:       "msg-002",
+			SenderId: "user-002",
+			Type:     models.IMAGE,
+			Media:    []models.Media{{Id: "media-2", Type: string(models.IMAGE), Url: "https://cdn/other.jpg", BlurredUrl: "https://cdn/other_blurred.jpg"}},
+		},
+		{
+			Id:       "msg-003",
+			SenderId: "user-002",
+			Type:     models.VIDEO,
+			Media:    []models.Media{{Id: "media-3", Type: string(models.VIDEO), Url: "https://cdn/other.mp4"}},
+		},
+		{
+			Id:       "msg-004",
+			SenderId: "user-002",
+			Type:     models.AUDIO,
+			Media:    []models.Media{{Id: "media-4", Type: string(models.AUDIO), Url: "https://cdn/voice.m4a", DurationMs: 4200}},
+		},
+		{
+			Id:       "msg-005",
+			SenderId: "user-002",
+			Type:     models.IMAGE,
+			Media:    []models.Media{{Id: "media-5", Type: string(models.IMAGE), Url: "https://cdn/pending.jpg", BlurPending: true}},
+		},
+	}
+
+	masked := MaskLockedMedia(msgs, "user-001")
+	t.Logf("DEBUG: masked = %+v", masked)
+
+	if masked[0].Media[0].Url != "https://cdn/own.jpg" {
+		t.Errorf("Sender should see their own original media, got %s", masked[0].Media[0].Url)
+	}
+	if masked[1].Media[0].Url != "https://cdn/other_blurred.jpg" {
+		t.Errorf("Expected blurred URL for other participant's image, got %s", masked[1].Media[0].Url)
+	}
+	if masked[2].Media[0].Url != "" {
+		t.Errorf("Expected video without blurred copy to have no URL, got %s", masked[2].Media[0].Url)
+	}
+	if m := masked[4].Media[0]; m.Url != "" || !m.BlurPending {
+		t.Errorf("Expected image waiting for its blur to have no URL and stay pending, got %+v", m)
+	}
+	if masked[3].Media[0].Url != "https://cdn/voice.m4a" {
+		t.Errorf("Audio should not be masked, got %s", masked[3].Media[0].Url)
+	}
+	if msgs[1].Media[0].Url != "https://cdn/other.jpg" {
+		t.Error("MaskLockedMedia must not modify its input")
+	}
+}
+
+// Recipients are only sent message_updated for updates whose UpdatedAt differs from
+// CreatedAt, so the blurred media must move it.
+func TestApplyBlurredMedia(t *testing.T) {
+	created := time.Date(2025, 11, 2, 10, 15, 0, 0, time.UTC)
+	msg := models.Message{
+		Id:        "msg-blur",
+		SenderId:  "user-a",
+		CreatedAt: created,
+		UpdatedAt: created,
+		Media: []models.Media{
+			{FileId: "file-1", Type: "image", Url: "https://media.spark.test/1.jpg", BlurPending: true},
+			{FileId: "file-2", Type: "image", Url: "https://media.spark.test/2.jpg", BlurPending: true},
+		},
+	}
+
+	applyBlurredMedia(&msg, map[string]string{"file-1": "https://media.spark.test/1-blur.jpg"}, created.Add(time.Minute))
+	if msg.Media[0].BlurredUrl != "https://media.spark.test/1-blur.jpg" || msg.Media[0].BlurPending {
+		t.Errorf("first media not blurred: %+v", msg.Media[0])
+	}
+	if msg.Media[1].BlurredUrl != "" || !msg.Media[1].BlurPending {
+		t.Errorf("second media changed: %+v", msg.Media[1])
+	}
+
+	data, _ := json.Marshal(PubSubEvent{Type: MessageEventUpdate, Message: &msg})
+	var event PubSubEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		t.Fatalf("failed to decode event: %v", err)
+	}
+	if event.Type != MessageEventUpdate || event.Message.CreatedAt == event.Message.UpdatedAt {
+		t.Errorf("update event %s at %s wouldn't be sent as message_updated", event.Type, event.Message.UpdatedAt)
+	}
+
+	unchanged := msg
+	applyBlurredMedia(&unchanged, map[string]string{"file-9": "https://media.spark.test/9-blur.jpg"}, created.Add(time.Hour))
+	if !unchanged.UpdatedAt.Equal(msg.UpdatedAt) {
+		t.Error("blurring no media should leave UpdatedAt alone")
+	}
+}
+
+func TestApplyAckIsIdempotent(t *testing.T) {
+	msg := models.Message{Id: "msg-001", ClientId: "client-001", SenderId: "user-001"}
+	deliveredAt := time.Now().Add(-time.Minute)
+
+	if applyAck(&msg, "user-001", StatusSeen, deliveredAt) {
+		t.Error("Sender should not be able to ack their own message")
+	}
+
+	if !applyAck(&msg, "user-002", StatusDelivered, deliveredAt) {
+		t.Fatal("Expected first delivered ack to change the message")
+	}
+	if !msg.Received || msg.Seen {
+		t.Errorf("Expected received but not seen, got received=%v seen=%v", msg.Received, msg.Seen)
+	}
+	if applyAck(&msg, "user-002", StatusDelivered, time.Now()) {
+		t.Error("Repeated delivered ack should be a no-op")
+	}
+	if !msg.DeliveredAt["user-002"].Equal(deliveredAt) {
+		t.Errorf("Delivered timestamp was overwritten: %v", msg.DeliveredAt["user-002"])
+	}
+
+	seenAt := time.Now()
+	if !applyAck(&msg, "user-002", StatusSeen, seenAt) {
+		t.Fatal("Expected seen ack to change the message")
+	}
+	if applyAck(&msg, "user-002", StatusSeen, time.Now().Add(time.Minute)) {
+		t.Error("Repeated seen ack should be a no-op")
+	}
+	if !msg.Seen || !msg.SeenAt["user-002"].Equal(seenAt) {
+		t.Errorf("Unexpected seen state: seen=%v seen_at=%v", msg.Seen, msg.SeenAt)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal message: %v", err)
+	}
+	var decoded models.Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal message: %v", err)
+	}
+	if !decoded.SeenAt["user-002"].Equal(seenAt) || decoded.ClientId != "client-001" {
+		t.Errorf("Timeline did not survive serialization: %s", data)
+	}
+}
+
+func TestStatusesFor(t *testing.T) {
+	at := time.Now()
+	earlier := at.Add(-time.Minute)
+	msgs := []models.Message{
+		// Never acked before, a seen ack reports delivery too
+		{Id: "msg-001", SenderId: "user-001", DeliveredAt: map[string]time.Time{"user-002": at}, SeenAt: map[string]time.Time{"user-002": at}},
+		// Already delivered earlier, only the seen step is new
+		{Id: "msg-002", SenderId: "user-001", DeliveredAt: map[string]time.Time{"user-002": earlier}, SeenAt: map[string]time.Time{"user-002": at}},
+	}
+
+	statuses := statusesFor(msgs, "user-002", at)
+	t.Logf("DEBUG: statuses = %+v", statuses)
+
+	if len(statuses) != 3 {
+		t.Fatalf("Expected 3 statuses, got %d", len(statuses))
+	}
+	expected := []struct {
+		id     string
+		status DeliveryStatus
+	}{{"msg-001", StatusDelivered}, {"msg-001", StatusSeen}, {"msg-002", StatusSeen}}
+	for i, e := range expected {
+		if statuses[i].MessageId != e.id || statuses[i].Status != e.status {
+			t.Errorf("Status %d: expected %s %s, got %s %s", i, e.id, e.status, statuses[i].MessageId, statuses[i].Status)
+		}
+		if statuses[i].SenderId != "user-001" || statuses[i].UserId != "user-002" {
+			t.Errorf("Status %d has wrong users: %+v", i, statuses[i])
+		}
+	}
+}
+
 func TestMessageSeenEventSerialization(t *testing.T) {
 	messageIds := []string{"msg-001", "msg-002", "msg-003"}
 	userId := "user-008"
@@ -0,0 +1,140 @@
+package chatservice
+
+import (
+	"spark/internal/models"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MelloB1989/karma/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// userUnreadKey holds a hash of chatId -> unread message count for a single user.
+func userUnreadKey(userId string) string { return fmt.Sprintf("spark:user:%s:unread", userId) }
+
+const (
+	metaLastMessageId       = "last_message_id"
+	metaLastMessageContent  = "last_message_content"
+	metaLastMessageType     = "last_message_type"
+	metaLastMessageSenderId = "last_message_sender_id"
+	metaLastMessageAt       = "last_message_at"
+)
+
+// decrUnreadScript decrements an unread counter without letting it go below zero.
+var decrUnreadScript = redis.NewScript(`
+	local current = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+	local next = current - tonumber(ARGV[2])
+	if next < 0 then
+		next = 0
+	end
+	redis.call('HSET', KEYS[1], ARGV[1], next)
+	return next
+`)
+
+// LastMessageMeta describes the most recent message of a chat.
+type LastMessageMeta struct {
+	Id       string
+	Content  string
+	Type     models.MessageType
+	SenderId string
+	SentAt   time.Time
+}
+
+// queueLastMessageMeta records msg as the latest message of the chat on the given pipeline.
+func (s *Store) queueLastMessageMeta(pipe redis.Pipeliner, msg *models.Message) {
+	pipe.HSet(ctx, chatMetaKey(s.chatId), map[string]any{
+		metaLastMessageId:       msg.Id,
+		metaLastMessageContent:  msg.Content,
+		metaLastMessageType:     string(msg.Type),
+		metaLastMessageSenderId: msg.SenderId,
+		metaLastMessageAt:       msg.CreatedAt.Format(time.RFC3339Nano),
+	})
+}
+
+// queueUnreadIncrements bumps the unread counter of every participant except the sender.
+func (s *Store) queueUnreadIncrements(pipe redis.Pipeliner, senderId string) {
+	for _, participant := range s.participants {
+		if participant == senderId {
+			continue
+		}
+		pipe.HIncrBy(ctx, userUnreadKey(participant), s.chatId, 1)
+	}
+}
+
+// decrementUnread lowers userId's unread counter for this chat by count.
+func (s *Store) decrementUnread(userId string, count int) error {
+	if count <= 0 {
+		return nil
+	}
+	return decrUnreadScript.Run(ctx, s.rc, []string{userUnreadKey(userId)}, s.chatId, count).Err()
+}
+
+// GetLastMessageMeta returns the last message metadata recorded for chatId.
+// It returns nil when nothing has been sent since the counters were introduced.
+func GetLastMessageMeta(chatId string) (*LastMessageMeta, error) {
+	rc := utils.RedisConnect()
+	defer rc.Close()
+
+	fields, err := rc.HGetAll(ctx, chatMetaKey(chatId)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat meta: %w", err)
+	}
+
+	return parseLastMessageMeta(fields), nil
+}
+
+func parseLastMessageMeta(fields map[string]string) *LastMessageMeta {
+	if fields[metaLastMessageId] == "" {
+		return nil
+	}
+
+	meta := &LastMessageMeta{
+		Id:       fields[metaLastMessageId],
+		Content:  fields[metaLastMessageContent],
+		Type:     models.MessageType(fields[metaLastMessageType]),
+		SenderId: fields[metaLastMessageSenderId],
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, fields[metaLastMessageAt]); err == nil {
+		meta.SentAt = ts
+	}
+
+	return meta
+}
+
+// GetUnreadCounts returns the unread message count of every chat userId has unread messages in.
+func GetUnreadCounts(userId string) (map[string]int, error) {
+	rc := utils.RedisConnect()
+	defer rc.Close()
+
+	raw, err := rc.HGetAll(ctx, userUnreadKey(userId)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unread counts: %w", err)
+	}
+
+	counts := make(map[string]int, len(raw))
+	for chatId, v := range raw {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			n = 0
+		}
+		counts[chatId] = n
+	}
+
+	return counts, nil
+}
+
+// GetTotalUnread returns the number of unread messages across all of userId's chats.
+func GetTotalUnread(userId string) (int, error) {
+	counts, err := GetUnreadCounts(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+
+	return total, nil
+}
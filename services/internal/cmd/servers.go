@@ -3,10 +3,8 @@ package cmd
 import (
 	"spark/internal/constants"
 	"spark/internal/graph"
-	"spark/internal/helpers/subscriptions"
 	"spark/internal/routes"
 	"context"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -23,17 +21,6 @@ import (
 	"github.com/vektah/gqlparser/v2/ast"
 )
 
-func init() {
-	// Seed default subscription plans on startup
-	go func() {
-		// Wait a bit for database connection to be ready
-		time.Sleep(3 * time.Second)
-		if err := subscriptions.SeedDefaultPlans(); err != nil {
-			log.Printf("[Subscriptions] Failed to seed default plans: %v", err)
-		}
-	}()
-}
-
 func StartGoFiber(ctx context.Context) {
 	godotenv.Load()
 	app := routes.Routes()
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"spark/internal/helpers/campaigns"
+	"spark/internal/helpers/metrics"
+	"spark/internal/helpers/notifications"
+	"spark/internal/helpers/payments"
+	"spark/internal/helpers/pushnotify"
+	"spark/internal/helpers/subscriptions"
+	"spark/internal/mailer"
+	"context"
+
+	"github.com/joho/godotenv"
+)
+
+// StartWorkers runs the background jobs until ctx is cancelled. Every replica runs
+// them; the jobs coordinate through the database.
+func StartWorkers(ctx context.Context) {
+	godotenv.Load()
+	go campaigns.Run(ctx)
+	go metrics.Run(ctx)
+	subscriptions.SetProviderResumer(payments.ResumeAtProvider)
+	go subscriptions.Run(ctx)
+	go notifications.Run(ctx)
+	go pushnotify.Run(ctx)
+	go mailer.Run(ctx)
+}
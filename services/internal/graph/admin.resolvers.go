@@ -8,74 +8,250 @@ package graph
 import (
 	"spark/internal/graph/directives"
 	"spark/internal/graph/model"
+	"spark/internal/handlers/webhooks"
+	"spark/internal/helpers/admin"
+	"spark/internal/helpers/audit"
+	"spark/internal/helpers/campaigns"
+	"spark/internal/helpers/impersonation"
+	"spark/internal/helpers/metrics"
+	"spark/internal/helpers/moderation"
 	"spark/internal/helpers/ormcompat"
-	"spark/internal/helpers/pushnotify"
+	"spark/internal/helpers/payments"
+	"spark/internal/helpers/promotions"
+	"spark/internal/helpers/rbac"
+	"spark/internal/helpers/reporting"
 	"spark/internal/helpers/subscriptions"
 	"spark/internal/helpers/users"
+	"spark/internal/helpers/verification"
 	"spark/internal/models"
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/MelloB1989/karma/orm"
 )
 
-// checkAdminRole verifies the user has admin or moderator role
-func checkAdminRole(ctx context.Context) error {
+// adminActorID returns the id of the staff member making the request. Permission
+// checks are done by the @hasPermission directive before resolvers run.
+func adminActorID(ctx context.Context) (string, error) {
 	claims, _, err := directives.GetAuthClaims(ctx)
 	if err != nil {
-		return fmt.Errorf("unauthorized")
+		return "", fmt.Errorf("unauthorized")
 	}
+	return claims.UserID, nil
+}
+
+// recordAudit writes an audit entry for an admin action that has already been applied.
+func recordAudit(entry audit.Entry) {
+	if err := audit.Record(entry); err != nil {
+		log.Printf("[Admin] Failed to record audit entry %s on %s %s by %s: %v", entry.Action, entry.TargetType, entry.TargetId, entry.ActorId, err)
+	}
+}
 
-	user, err := users.GetUserByID(claims.UserID)
-	if err != nil || user == nil {
-		return fmt.Errorf("user not found")
+// AdminBanUser is the resolver for the adminBanUser field.
+func (r *mutationResolver) AdminBanUser(ctx context.Context, userID string, banned bool, reason *string, reasonCode *string) (*model.AdminUser, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if actorID == userID {
+		return nil, fmt.Errorf("you can't ban yourself")
+	}
+	if found, err := admin.UsersByIds([]string{userID}); err != nil {
+		return nil, err
+	} else if found[userID] == nil {
+		return nil, fmt.Errorf("user not found")
 	}
 
-	if user.Role != "admin" && user.Role != "moderator" {
-		return fmt.Errorf("insufficient permissions")
+	if banned {
+		code := moderation.ReasonOther
+		if reasonCode != nil {
+			code = *reasonCode
+		}
+		_, err = enforceAndAudit(actorID, moderation.Action{
+			UserId:     userID,
+			ActorId:    actorID,
+			Type:       moderation.TypeBan,
+			ReasonCode: code,
+			Note:       derefString(reason),
+		}, derefString(reason))
+	} else {
+		if err := rbac.CheckOutranks(actorID, userID); err != nil {
+			return nil, err
+		}
+		before, _ := moderation.GetStatus(userID)
+		if err = moderation.LiftAll(userID, moderation.TypeBan, actorID); err == nil {
+			after, _ := moderation.GetStatus(userID)
+			recordAudit(audit.Entry{
+				ActorId:    actorID,
+				Action:     audit.ActionUserUnban,
+				TargetType: audit.TargetUser,
+				TargetId:   userID,
+				Before:     before,
+				After:      after,
+				Reason:     derefString(reason),
+			})
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	user, err := admin.UsersByIds([]string{userID})
+	if err != nil {
+		return nil, err
+	}
+	if user[userID] == nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	return userToAdminUser(user[userID]), nil
 }
 
-// AdminBanUser is the resolver for the adminBanUser field.
-func (r *mutationResolver) AdminBanUser(ctx context.Context, userID string, banned bool) (*model.AdminUser, error) {
-	if err := checkAdminRole(ctx); err != nil {
+// AdminEnforce is the resolver for the adminEnforce field.
+func (r *mutationResolver) AdminEnforce(ctx context.Context, input model.EnforcementInput) (*models.UserEnforcement, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
 		return nil, err
 	}
+	if actorID == input.UserID {
+		return nil, fmt.Errorf("you can't take action against yourself")
+	}
 
-	userORM := orm.Load(&models.User{})
-	foundUsers, err := ormcompat.GetByFieldEqualsSlice[models.User](userORM, "Id", userID)
+	action := moderation.Action{
+		UserId:     input.UserID,
+		ActorId:    actorID,
+		Type:       input.Type,
+		ReasonCode: input.ReasonCode,
+		Note:       derefString(input.Note),
+	}
+	if input.DurationHours != nil {
+		action.Duration = time.Duration(*input.DurationHours) * time.Hour
+	}
+
+	return enforceAndAudit(actorID, action, derefString(input.Note))
+}
+
+// AdminLiftEnforcement is the resolver for the adminLiftEnforcement field.
+func (r *mutationResolver) AdminLiftEnforcement(ctx context.Context, enforcementID string, reason *string) (*models.UserEnforcement, error) {
+	actorID, err := adminActorID(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if len(foundUsers) == 0 {
-		return nil, fmt.Errorf("user not found")
+
+	existing, err := moderation.GetEnforcement(enforcementID)
+	if err != nil {
+		return nil, err
+	}
+	if err := rbac.CheckOutranks(actorID, existing.UserId); err != nil {
+		return nil, err
 	}
+	before, _ := moderation.GetStatus(existing.UserId)
 
-	user := foundUsers[0]
-	user.IsBanned = banned
-	user.UpdatedAt = time.Now()
+	enforcement, err := moderation.Lift(enforcementID, actorID)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := userORM.Update(&user, user.Id); err != nil {
+	after, _ := moderation.GetStatus(enforcement.UserId)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionEnforcementLift,
+		TargetType: audit.TargetEnforcement,
+		TargetId:   enforcement.Id,
+		Before:     before,
+		After:      after,
+		Reason:     derefString(reason),
+	})
+
+	return enforcement, nil
+}
+
+// AdminReviewAppeal is the resolver for the adminReviewAppeal field.
+func (r *mutationResolver) AdminReviewAppeal(ctx context.Context, appealID string, approve bool, note *string) (*models.BanAppeal, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := moderation.GetAppeal(appealID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.UserId == actorID {
+		return nil, fmt.Errorf("you can't review your own appeal")
+	}
+
+	appeal, err := moderation.ReviewAppeal(appealID, actorID, approve, derefString(note))
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionAppealReview,
+		TargetType: audit.TargetAppeal,
+		TargetId:   appeal.Id,
+		Before:     map[string]any{"status": existing.Status, "enforcement_id": existing.EnforcementId},
+		After:      map[string]any{"status": appeal.Status, "enforcement_id": appeal.EnforcementId},
+		Reason:     derefString(note),
+	})
+
+	return appeal, nil
+}
+
+// AdminImpersonate is the resolver for the adminImpersonate field.
+func (r *mutationResolver) AdminImpersonate(ctx context.Context, userID string, reason string) (*model.ImpersonationSession, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	return userToAdminUser(&user), nil
+	session, err := impersonation.Start(actorID, userID, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unlike other actions the token isn't handed out unless the audit entry is stored
+	if err := audit.Record(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionUserImpersonate,
+		TargetType: audit.TargetUser,
+		TargetId:   userID,
+		After:      map[string]any{"session_id": session.Id, "expires_at": session.ExpiresAt},
+		Reason:     reason,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to record impersonation: %w", err)
+	}
+
+	return &model.ImpersonationSession{
+		SessionID: session.Id,
+		Token:     session.Token,
+		ExpiresAt: session.ExpiresAt,
+		User:      userToAdminUser(session.User),
+	}, nil
 }
 
 // AdminChangeRole is the resolver for the adminChangeRole field.
-func (r *mutationResolver) AdminChangeRole(ctx context.Context, userID string, role string) (*model.AdminUser, error) {
-	if err := checkAdminRole(ctx); err != nil {
+func (r *mutationResolver) AdminChangeRole(ctx context.Context, userID string, role string, reason *string) (*model.AdminUser, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
 		return nil, err
 	}
 
 	// Validate role
-	if role != "user" && role != "admin" && role != "moderator" {
+	if !rbac.IsValidRole(role) {
 		return nil, fmt.Errorf("invalid role: must be user, admin, or moderator")
 	}
+	// Nobody can promote or demote themselves, another admin has to do it
+	if actorID == userID {
+		return nil, fmt.Errorf("you can't change your own role")
+	}
+	if err := rbac.CheckRoleChange(actorID, userID, role); err != nil {
+		return nil, err
+	}
 
 	userORM := orm.Load(&models.User{})
 	foundUsers, err := ormcompat.GetByFieldEqualsSlice[models.User](userORM, "Id", userID)
@@ -87,6 +263,7 @@ func (r *mutationResolver) AdminChangeRole(ctx context.Context, userID string, r
 	}
 
 	user := foundUsers[0]
+	before := userToAdminUser(&user)
 	user.Role = role
 	user.UpdatedAt = time.Now()
 
@@ -94,188 +271,309 @@ func (r *mutationResolver) AdminChangeRole(ctx context.Context, userID string, r
 		return nil, err
 	}
 
-	return userToAdminUser(&user), nil
+	after := userToAdminUser(&user)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionUserRoleChange,
+		TargetType: audit.TargetUser,
+		TargetId:   user.Id,
+		Before:     before,
+		After:      after,
+		Reason:     derefString(reason),
+	})
+
+	return after, nil
 }
 
 // AdminResolveVerification is the resolver for the adminResolveVerification field.
 func (r *mutationResolver) AdminResolveVerification(ctx context.Context, verificationID string, status string, reason *string) (*model.AdminVerification, error) {
-	if err := checkAdminRole(ctx); err != nil {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	verORM := orm.Load(&models.UserVerification{})
-	vers, err := ormcompat.GetByFieldEqualsSlice[models.UserVerification](verORM, "Id", verificationID)
+	before, err := verification.Get(verificationID)
 	if err != nil {
 		return nil, err
 	}
-	if len(vers) == 0 {
-		return nil, fmt.Errorf("verification not found")
+	ver, err := verification.Resolve(verificationID, actorID, status, derefString(reason))
+	if err != nil {
+		return nil, err
 	}
 
-	ver := vers[0]
-	ver.Status = status
-	ver.UpdatedAt = time.Now()
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionVerificationResolve,
+		TargetType: audit.TargetVerification,
+		TargetId:   ver.Id,
+		Before:     map[string]any{"status": before.Status, "user_id": ver.UserId},
+		After:      map[string]any{"status": ver.Status, "user_id": ver.UserId, "rejection_reason": ver.RejectionReason},
+		Reason:     derefString(reason),
+	})
+
+	user, _ := users.GetUserByID(ver.UserId)
+	return verificationToAdmin(ver, user), nil
+}
 
-	if err := verORM.Update(&ver, ver.Id); err != nil {
+// AdminStartVerificationReview is the resolver for the adminStartVerificationReview field.
+func (r *mutationResolver) AdminStartVerificationReview(ctx context.Context, verificationID string) (*model.AdminVerification, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	// If verified, update user's is_verified status
-	if status == "verified" {
-		userORM := orm.Load(&models.User{})
-		foundUsers, _ := ormcompat.GetByFieldEqualsSlice[models.User](userORM, "Id", ver.UserId)
-		if len(foundUsers) > 0 {
-			foundUsers[0].IsVerified = true
-			foundUsers[0].UpdatedAt = time.Now()
-			userORM.Update(&foundUsers[0], foundUsers[0].Id)
-		}
+	before, err := verification.Get(verificationID)
+	if err != nil {
+		return nil, err
 	}
-
-	// Get user for response
-	user, _ := users.GetUserByID(ver.UserId)
-
-	media := make([]string, 0)
-	for _, m := range ver.Media {
-		media = append(media, m.Url)
+	ver, err := verification.StartReview(verificationID, actorID)
+	if err != nil {
+		return nil, err
 	}
 
-	return &model.AdminVerification{
-		ID:        ver.Id,
-		UserID:    ver.UserId,
-		User:      userToAdminUser(user),
-		Media:     media,
-		Status:    ver.Status,
-		CreatedAt: ver.CreatedAt,
-	}, nil
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionVerificationClaim,
+		TargetType: audit.TargetVerification,
+		TargetId:   ver.Id,
+		Before:     map[string]any{"status": before.Status, "user_id": ver.UserId},
+		After:      map[string]any{"status": ver.Status, "user_id": ver.UserId},
+	})
+
+	user, _ := users.GetUserByID(ver.UserId)
+	return verificationToAdmin(ver, user), nil
 }
 
 // AdminResolveReport is the resolver for the adminResolveReport field.
-func (r *mutationResolver) AdminResolveReport(ctx context.Context, reportID string, status string, action *string) (*model.AdminReport, error) {
-	if err := checkAdminRole(ctx); err != nil {
+func (r *mutationResolver) AdminResolveReport(ctx context.Context, reportID string, status string, action *string, reason *string) (*model.AdminReport, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
 		return nil, err
 	}
+	if action != nil && !validReportActions[*action] {
+		return nil, fmt.Errorf("invalid action %q", *action)
+	}
+	if action != nil && *action != "none" && *action != "" {
+		if err := rbac.Check(actorID, rbac.UsersBan); err != nil {
+			return nil, err
+		}
+	}
 
-	reportORM := orm.Load(&models.Report{})
-	reports, err := ormcompat.GetByFieldEqualsSlice[models.Report](reportORM, "Id", reportID)
+	before, err := reporting.Get(reportID)
 	if err != nil {
 		return nil, err
 	}
-
-	if len(reports) == 0 {
-		return nil, fmt.Errorf("report not found")
-	}
-
-	report := reports[0]
-	report.Status = status
-	report.UpdatedAt = time.Now()
-
-	if err := reportORM.Update(&report, report.Id); err != nil {
+	// Everything that can refuse the resolution is checked before the account is acted
+	// on, and the report is only resolved once the action went through, so a failure
+	// leaves it in the triage queue
+	if err := reporting.CheckResolvable(before, status); err != nil {
 		return nil, err
 	}
 
-	// Handle action if provided
 	if action != nil {
+		enforcement := moderation.Action{
+			UserId:     before.SubjectId,
+			ActorId:    actorID,
+			ReasonCode: moderation.ReasonOther,
+			Note:       fmt.Sprintf("report %s: %s", before.Id, derefString(reason)),
+		}
+		if moderation.IsValidReasonCode(before.Category) {
+			enforcement.ReasonCode = before.Category
+		}
+
 		switch *action {
 		case "ban":
-			userORM := orm.Load(&models.User{})
-			foundUsers, _ := ormcompat.GetByFieldEqualsSlice[models.User](userORM, "Id", report.TargetId)
-			if len(foundUsers) > 0 {
-				foundUsers[0].IsBanned = true
-				foundUsers[0].UpdatedAt = time.Now()
-				userORM.Update(&foundUsers[0], foundUsers[0].Id)
-			}
+			enforcement.Type = moderation.TypeBan
+		case "suspend":
+			enforcement.Type = moderation.TypeSuspension
+			enforcement.Duration = moderation.StrikeSuspension
 		case "warn":
-			// TODO: Implement warning system
-			log.Printf("[Admin] Warning issued to user %s for report %s", report.TargetId, report.Id)
+			enforcement.Type = moderation.TypeWarning
 		}
+		if enforcement.Type != "" {
+			if _, err := enforceAndAudit(actorID, enforcement, enforcement.Note); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	report, closed, err := reporting.Resolve(reportID, status)
+	if err != nil {
+		return nil, err
 	}
 
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionReportResolve,
+		TargetType: audit.TargetReport,
+		TargetId:   report.Id,
+		Before:     map[string]any{"status": before.Status, "subject_id": report.SubjectId, "group_id": report.GroupId},
+		After:      map[string]any{"status": report.Status, "subject_id": report.SubjectId, "group_id": report.GroupId, "action": derefString(action), "reports_closed": closed},
+		Reason:     derefString(reason),
+	})
+
 	reporter, _ := users.GetUserByID(report.UserId)
-	target, _ := users.GetUserByID(report.TargetId)
+	target, _ := users.GetUserByID(report.SubjectId)
+	return reportToAdmin(report, reporter, target), nil
+}
 
-	media := make([]string, 0)
-	for _, m := range report.Media {
-		media = append(media, m.Url)
+// AssignReport is the resolver for the assignReport field.
+func (r *mutationResolver) AssignReport(ctx context.Context, groupID string, assigneeID *string) (*model.AdminReportGroup, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	assignee := actorID
+	if assigneeID != nil && *assigneeID != "" {
+		assignee = *assigneeID
 	}
 
-	return &model.AdminReport{
-		ID:             report.Id,
-		UserID:         report.UserId,
-		Reporter:       userToAdminUser(reporter),
-		TargetID:       report.TargetId,
-		Target:         userToAdminUser(target),
-		Reason:         report.Reason,
-		AdditionalInfo: &report.AdditionalInfo,
-		Media:          media,
-		Status:         report.Status,
-		CreatedAt:      report.CreatedAt,
-	}, nil
+	before, err := reporting.GetGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	group, err := reporting.Assign(groupID, assignee)
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionReportAssign,
+		TargetType: audit.TargetReportGroup,
+		TargetId:   group.Id,
+		Before:     map[string]any{"status": before.Status, "assignee_id": before.AssigneeId},
+		After:      map[string]any{"status": group.Status, "assignee_id": group.AssigneeId},
+	})
+
+	return reportGroupWithUsers(group)
 }
 
-// AdminSendNotification is the resolver for the adminSendNotification field.
-func (r *mutationResolver) AdminSendNotification(ctx context.Context, input model.MassNotificationInput) (*model.MassNotificationResult, error) {
-	if err := checkAdminRole(ctx); err != nil {
+// EscalateReport is the resolver for the escalateReport field.
+func (r *mutationResolver) EscalateReport(ctx context.Context, groupID string, note string) (*model.AdminReportGroup, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	// If specific user IDs provided, send to them
-	if input.UserIds != nil && len(input.UserIds) > 0 {
-		notification := pushnotify.PushNotification{
-			Title:     input.Title,
-			Body:      input.Body,
-			ChannelId: "announcements",
-		}
+	before, err := reporting.GetGroup(groupID)
+	if err != nil {
+		return nil, err
+	}
+	group, err := reporting.Escalate(groupID, actorID, note)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := pushnotify.SendToUsers(input.UserIds, notification); err != nil {
-			return &model.MassNotificationResult{
-				Success:     false,
-				SentCount:   0,
-				FailedCount: int32(len(input.UserIds)),
-				Message:     strPtr(fmt.Sprintf("Failed to send: %v", err)),
-			}, nil
-		}
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionReportEscalate,
+		TargetType: audit.TargetReportGroup,
+		TargetId:   group.Id,
+		Before:     map[string]any{"status": before.Status, "assignee_id": before.AssigneeId, "priority": before.Priority},
+		After:      map[string]any{"status": group.Status, "priority": group.Priority},
+		Reason:     note,
+	})
+
+	return reportGroupWithUsers(group)
+}
 
-		return &model.MassNotificationResult{
-			Success:     true,
-			SentCount:   int32(len(input.UserIds)),
-			FailedCount: 0,
-			Message:     strPtr("Notifications sent successfully"),
-		}, nil
+// AdminSendNotification is the resolver for the adminSendNotification field.
+func (r *mutationResolver) AdminSendNotification(ctx context.Context, input model.MassNotificationInput) (*model.MassNotificationResult, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// Send to segment
-	segment := "all"
-	if input.Segment != nil {
-		segment = *input.Segment
+	seg := segmentFromInput(input.Segment, input.SegmentFilters, input.UserIds)
+	var sendAt time.Time
+	if input.SendAt != nil {
+		sendAt = *input.SendAt
+	}
+	throttle := 0
+	if input.ThrottlePerMinute != nil {
+		throttle = int(*input.ThrottlePerMinute)
 	}
 
-	if err := pushnotify.SendMassNotification(input.Title, input.Body, segment); err != nil {
-		return &model.MassNotificationResult{
-			Success:     false,
-			SentCount:   0,
-			FailedCount: 0,
-			Message:     strPtr(fmt.Sprintf("Failed to send: %v", err)),
-		}, nil
+	campaign, err := campaigns.Create(input.Title, input.Body, seg, sendAt, throttle, actorID)
+	if err != nil {
+		return nil, err
 	}
 
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionNotificationBroadcast,
+		TargetType: audit.TargetNotification,
+		TargetId:   campaign.Id,
+		After: map[string]any{
+			"title":               campaign.Title,
+			"body":                campaign.Body,
+			"segment":             campaign.Segment,
+			"send_at":             campaign.SendAt,
+			"throttle_per_minute": campaign.ThrottlePerMinute,
+		},
+		Reason: derefString(input.Reason),
+	})
+	campaigns.Kick()
+
 	return &model.MassNotificationResult{
 		Success:     true,
-		SentCount:   0, // Unknown count for mass notification
+		SentCount:   0, // Delivery happens in the background; see adminNotificationCampaign
 		FailedCount: 0,
-		Message:     strPtr("Mass notification sent to segment: " + segment),
+		Message:     strPtr("Campaign scheduled for " + campaign.SendAt.UTC().Format(time.RFC3339)),
+		CampaignID:  &campaign.Id,
 	}, nil
 }
 
+// AdminCancelNotificationCampaign is the resolver for the adminCancelNotificationCampaign field.
+func (r *mutationResolver) AdminCancelNotificationCampaign(ctx context.Context, id string, reason *string) (*model.AdminNotificationCampaign, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := campaigns.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	campaign, err := campaigns.Cancel(id, derefString(reason))
+	if err != nil {
+		return nil, err
+	}
+
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionNotificationCancel,
+		TargetType: audit.TargetNotification,
+		TargetId:   campaign.Id,
+		Before:     map[string]any{"status": before.Status, "sent_count": before.SentCount},
+		After:      map[string]any{"status": campaign.Status, "sent_count": campaign.SentCount},
+		Reason:     derefString(reason),
+	})
+
+	return campaignToAdmin(campaign), nil
+}
+
 // AdminGrantSubscription is the resolver for the adminGrantSubscription field.
-func (r *mutationResolver) AdminGrantSubscription(ctx context.Context, userID string, planID string, durationDays int32) (bool, error) {
-	if err := checkAdminRole(ctx); err != nil {
+func (r *mutationResolver) AdminGrantSubscription(ctx context.Context, userID string, planID string, durationDays int32, reason *string) (bool, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
 		return false, err
 	}
 
+	if _, err := subscriptions.GetPlan(planID); err != nil {
+		return false, err
+	}
+
+	var before map[string]any
+	if user, err := users.GetUserByID(userID); err == nil && user != nil {
+		before = map[string]any{"subscription_plan_id": user.SubscriptionPlanId}
+	}
+
 	periodStart := time.Now()
 	periodEnd := periodStart.AddDate(0, 0, int(durationDays))
 
-	_, err := subscriptions.CreateSubscription(
+	_, err = subscriptions.CreateSubscription(
 		userID,
 		planID,
 		"manual",
@@ -290,262 +588,1056 @@ func (r *mutationResolver) AdminGrantSubscription(ctx context.Context, userID st
 	}
 
 	log.Printf("[Admin] Granted %s subscription to user %s for %d days", planID, userID, durationDays)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionSubscriptionGrant,
+		TargetType: audit.TargetUser,
+		TargetId:   userID,
+		Before:     before,
+		After: map[string]any{
+			"subscription_plan_id": planID,
+			"duration_days":        durationDays,
+			"period_end":           periodEnd,
+		},
+		Reason: derefString(reason),
+	})
 	return true, nil
 }
 
-// AdminStats is the resolver for the adminStats field.
-func (r *queryResolver) AdminStats(ctx context.Context) (*model.AdminStats, error) {
-	if err := checkAdminRole(ctx); err != nil {
+// AdminRefundSubscription is the resolver for the adminRefundSubscription field.
+func (r *mutationResolver) AdminRefundSubscription(ctx context.Context, subscriptionID string, amount *int32, reason string, revokeAccess *bool) (*models.BillingEvent, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
 		return nil, err
 	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, fmt.Errorf("a reason is required")
+	}
 
-	// These would be real database queries in production
-	// For now, return placeholder stats
-
-	userORM := orm.Load(&models.User{})
-	var allUsers []models.User
-	if res, err := userORM.GetAll(); err == nil {
-		if s, ok := res.(*[]models.User); ok {
-			allUsers = *s
-		} else if s, ok := res.([]models.User); ok {
-			allUsers = s
-		}
+	before, err := subscriptions.GetSubscription(subscriptionID)
+	if err != nil {
+		return nil, err
 	}
-	totalUsers := int32(len(allUsers))
 
-	// Count subscribers by plan
-	subscriberCounts := make([]*model.PlanSubscriberCount, 0)
-	planCounts := map[string]int32{"free": 0, "plus": 0, "pro": 0, "elite": 0}
-	for _, u := range allUsers {
-		if u.SubscriptionPlanId != "" {
-			planCounts[u.SubscriptionPlanId]++
-		} else {
-			planCounts["free"]++
+	cents := 0
+	if amount != nil {
+		if *amount <= 0 {
+			return nil, subscriptions.ErrInvalidAmount
 		}
+		cents = int(*amount)
 	}
+	revoke := revokeAccess != nil && *revokeAccess
 
-	for planID, count := range planCounts {
-		if planID != "free" && count > 0 {
-			subscriberCounts = append(subscriberCounts, &model.PlanSubscriberCount{
-				PlanID:   planID,
-				PlanName: planID,
-				Count:    count,
-			})
-		}
+	event, err := payments.Refund(ctx, subscriptionID, cents, reason, actorID, revoke)
+	if err != nil {
+		return nil, err
 	}
 
-	totalSubscribers := planCounts["plus"] + planCounts["pro"] + planCounts["elite"]
+	log.Printf("[Admin] Refunded %d cents of subscription %s for user %s", -event.Amount, subscriptionID, before.UserId)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionSubscriptionRefund,
+		TargetType: audit.TargetSubscription,
+		TargetId:   subscriptionID,
+		Before:     map[string]any{"user_id": before.UserId, "plan_id": before.PlanId, "status": before.Status, "amount_paid": before.AmountPaid},
+		After:      map[string]any{"amount": -event.Amount, "revoke_access": event.Details["revoke_access"], "billing_event_id": event.Id},
+		Reason:     reason,
+	})
+	return event, nil
+}
 
-	// Count pending items
-	verORM := orm.Load(&models.UserVerification{})
-	pendingVers, _ := ormcompat.GetByFieldEqualsSlice[models.UserVerification](verORM, "Status", "pending")
-	reportORM := orm.Load(&models.Report{})
-	pendingReports, _ := ormcompat.GetByFieldEqualsSlice[models.Report](reportORM, "Status", "pending")
-	matchORM := orm.Load(&models.Match{})
-	var allMatches []models.Match
-	if res, err := matchORM.GetAll(); err == nil {
-		if s, ok := res.(*[]models.Match); ok {
-			allMatches = *s
-		} else if s, ok := res.([]models.Match); ok {
-			allMatches = s
-		}
+// AdminReplayWebhookEvent is the resolver for the adminReplayWebhookEvent field.
+func (r *mutationResolver) AdminReplayWebhookEvent(ctx context.Context, id string, reason *string) (*model.AdminWebhookEvent, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	return &model.AdminStats{
-		TotalUsers:           totalUsers,
-		ActiveUsersToday:     0, // Would need activity tracking
-		ActiveUsersWeek:      0,
-		TotalMatches:         int32(len(allMatches)),
-		MatchesToday:         0,
-		TotalMessages:        0, // Would need message count
-		MessagesToday:        0,
-		PendingVerifications: int32(len(pendingVers)),
-		PendingReports:       int32(len(pendingReports)),
-		TotalSubscribers:     totalSubscribers,
-		SubscribersByPlan:    subscriberCounts,
-		RevenueThisMonth:     0, // Would need payment integration
-	}, nil
+	ev, err := webhooks.Replay(id)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Admin] Replayed %s webhook event %s: %s", ev.Provider, ev.EventId, ev.Status)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionWebhookReplay,
+		TargetType: audit.TargetWebhookEvent,
+		TargetId:   id,
+		After:      map[string]any{"provider": ev.Provider, "event_id": ev.EventId, "status": ev.Status, "last_error": ev.LastError},
+		Reason:     derefString(reason),
+	})
+	return webhookEventToAdmin(ev), nil
 }
 
-// AdminUsers is the resolver for the adminUsers field.
-func (r *queryResolver) AdminUsers(ctx context.Context, filters *model.AdminUserFilters, page *int32, perPage *int32) (*model.AdminUserList, error) {
-	if err := checkAdminRole(ctx); err != nil {
+// AdminCreatePlan is the resolver for the adminCreatePlan field.
+func (r *mutationResolver) AdminCreatePlan(ctx context.Context, id string, basePlanID *string, input model.PlanInput, reason *string) (*models.SubscriptionPlan, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	pageNum := int32(1)
-	perPageNum := int32(20)
-	if page != nil {
-		pageNum = *page
+	plan, err := subscriptions.CreatePlan(id, derefString(basePlanID), planInputFromModel(input))
+	if err != nil {
+		return nil, err
 	}
-	if perPage != nil {
-		perPageNum = *perPage
+
+	log.Printf("[Admin] Created plan %s", plan.Id)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionPlanCreate,
+		TargetType: audit.TargetPlan,
+		TargetId:   plan.Id,
+		After:      planSnapshot(plan),
+		Reason:     derefString(reason),
+	})
+	return plan, nil
+}
+
+// AdminUpdatePlan is the resolver for the adminUpdatePlan field.
+func (r *mutationResolver) AdminUpdatePlan(ctx context.Context, id string, input model.PlanInput, reason *string) (*models.SubscriptionPlan, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	userORM := orm.Load(&models.User{})
-	var allUsers []models.User
-	if res, err := userORM.GetAll(); err != nil {
+	before, err := subscriptions.GetPlan(id)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := subscriptions.UpdatePlan(id, planInputFromModel(input))
+	if err != nil {
 		return nil, err
-	} else if s, ok := res.(*[]models.User); ok {
-		allUsers = *s
-	} else if s, ok := res.([]models.User); ok {
-		allUsers = s
 	}
 
-	// Apply filters
-	filteredUsers := make([]models.User, 0)
+	log.Printf("[Admin] Updated plan %s", plan.Id)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionPlanUpdate,
+		TargetType: audit.TargetPlan,
+		TargetId:   plan.Id,
+		Before:     planSnapshot(before),
+		After:      planSnapshot(plan),
+		Reason:     derefString(reason),
+	})
+	return plan, nil
+}
+
+// AdminRetirePlan is the resolver for the adminRetirePlan field.
+func (r *mutationResolver) AdminRetirePlan(ctx context.Context, id string, reason *string) (*models.SubscriptionPlan, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := subscriptions.RetirePlan(id)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Admin] Retired plan %s", plan.Id)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionPlanRetire,
+		TargetType: audit.TargetPlan,
+		TargetId:   plan.Id,
+		Before:     map[string]any{"is_active": true},
+		After:      map[string]any{"is_active": false},
+		Reason:     derefString(reason),
+	})
+	return plan, nil
+}
+
+// AdminCreatePromoCode is the resolver for the adminCreatePromoCode field.
+func (r *mutationResolver) AdminCreatePromoCode(ctx context.Context, input model.PromoCodeInput, reason *string) (*models.PromoCode, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	in := promotions.CodeInput{
+		Code:      input.Code,
+		Kind:      input.Kind,
+		PlanId:    derefString(input.PlanID),
+		ExpiresAt: input.ExpiresAt,
+	}
+	if input.PercentOff != nil {
+		in.PercentOff = int(*input.PercentOff)
+	}
+	if input.Days != nil {
+		in.Days = int(*input.Days)
+	}
+	if input.MaxRedemptions != nil {
+		in.MaxRedemptions = int(*input.MaxRedemptions)
+	}
+	code, err := promotions.CreateCode(in, actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Admin] Created promo code %s", code.Code)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionPromoCodeCreate,
+		TargetType: audit.TargetPromoCode,
+		TargetId:   code.Id,
+		After: map[string]any{
+			"code":            code.Code,
+			"kind":            code.Kind,
+			"plan_id":         code.PlanId,
+			"percent_off":     code.PercentOff,
+			"days":            code.Days,
+			"max_redemptions": code.MaxRedemptions,
+			"expires_at":      code.ExpiresAt,
+		},
+		Reason: derefString(reason),
+	})
+	return code, nil
+}
+
+// AdminDeactivatePromoCode is the resolver for the adminDeactivatePromoCode field.
+func (r *mutationResolver) AdminDeactivatePromoCode(ctx context.Context, id string, reason *string) (*models.PromoCode, error) {
+	actorID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := promotions.DeactivateCode(id)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[Admin] Deactivated promo code %s", code.Code)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     audit.ActionPromoCodeDeactivate,
+		TargetType: audit.TargetPromoCode,
+		TargetId:   code.Id,
+		Before:     map[string]any{"is_active": true, "redemptions": code.Redemptions},
+		After:      map[string]any{"is_active": false},
+		Reason:     derefString(reason),
+	})
+	return code, nil
+}
+
+// AdminStats is the resolver for the adminStats field.
+func (r *queryResolver) AdminStats(ctx context.Context) (*model.AdminStats, error) {
+	// These would be real database queries in production
+	// For now, return placeholder stats
+
+	userORM := orm.Load(&models.User{})
+	var allUsers []models.User
+	if res, err := userORM.GetAll(); err == nil {
+		if s, ok := res.(*[]models.User); ok {
+			allUsers = *s
+		} else if s, ok := res.([]models.User); ok {
+			allUsers = s
+		}
+	}
+	totalUsers := int32(len(allUsers))
+
+	// Count subscribers by plan
+	subscriberCounts := make([]*model.PlanSubscriberCount, 0)
+	planCounts := map[string]int32{"free": 0, "plus": 0, "pro": 0, "elite": 0}
 	for _, u := range allUsers {
-		include := true
-
-		if filters != nil {
-			if filters.Search != nil && *filters.Search != "" {
-				search := *filters.Search
-				if !contains(u.FirstName, search) && !contains(u.LastName, search) && !contains(u.Email, search) {
-					include = false
-				}
-			}
-			if filters.IsVerified != nil && u.IsVerified != *filters.IsVerified {
-				include = false
-			}
-			if filters.IsBanned != nil && u.IsBanned != *filters.IsBanned {
-				include = false
-			}
-			if filters.Role != nil && u.Role != *filters.Role {
-				include = false
-			}
-			if filters.SubscriptionPlanID != nil && u.SubscriptionPlanId != *filters.SubscriptionPlanID {
-				include = false
-			}
+		if u.SubscriptionPlanId != "" {
+			planCounts[u.SubscriptionPlanId]++
+		} else {
+			planCounts["free"]++
+		}
+	}
+
+	for planID, count := range planCounts {
+		if planID != "free" && count > 0 {
+			subscriberCounts = append(subscriberCounts, &model.PlanSubscriberCount{
+				PlanID:   planID,
+				PlanName: planID,
+				Count:    count,
+			})
 		}
+	}
+
+	totalSubscribers := planCounts["plus"] + planCounts["pro"] + planCounts["elite"]
 
-		if include {
-			filteredUsers = append(filteredUsers, u)
+	// Count pending items
+	pendingVers, _ := verification.CountPending()
+	reportORM := orm.Load(&models.Report{})
+	pendingReports, _ := ormcompat.GetByFieldEqualsSlice[models.Report](reportORM, "Status", "pending")
+	matchORM := orm.Load(&models.Match{})
+	var allMatches []models.Match
+	if res, err := matchORM.GetAll(); err == nil {
+		if s, ok := res.(*[]models.Match); ok {
+			allMatches = *s
+		} else if s, ok := res.([]models.Match); ok {
+			allMatches = s
 		}
 	}
 
-	total := int32(len(filteredUsers))
+	now := time.Now()
+	activeToday, _ := metrics.ActiveUsers(now)
+	activeWeek, _ := metrics.ActiveUsers(now.AddDate(0, 0, -6))
+
+	return &model.AdminStats{
+		TotalUsers:           totalUsers,
+		ActiveUsersToday:     int32(activeToday),
+		ActiveUsersWeek:      int32(activeWeek),
+		TotalMatches:         int32(len(allMatches)),
+		MatchesToday:         0,
+		TotalMessages:        0, // Would need message count
+		MessagesToday:        0,
+		PendingVerifications: int32(pendingVers),
+		PendingReports:       int32(len(pendingReports)),
+		TotalSubscribers:     totalSubscribers,
+		SubscribersByPlan:    subscriberCounts,
+		RevenueThisMonth:     0, // Would need payment integration
+	}, nil
+}
+
+// AdminMetrics is the resolver for the adminMetrics field.
+func (r *queryResolver) AdminMetrics(ctx context.Context, metric model.AdminMetric, from time.Time, to time.Time, granularity *model.MetricGranularity) (*model.AdminMetricSeries, error) {
+	g := model.MetricGranularityDay
+	if granularity != nil {
+		g = *granularity
+	}
+
+	series, err := metrics.Query(strings.ToLower(string(metric)), from, to, strings.ToLower(string(g)))
+	if err != nil {
+		return nil, err
+	}
 
-	// Paginate
-	start := (pageNum - 1) * perPageNum
-	end := start + perPageNum
-	if start > total {
-		start = total
+	points := make([]*model.AdminMetricPoint, len(series.Points))
+	for i, p := range series.Points {
+		points[i] = &model.AdminMetricPoint{
+			Bucket:      p.Bucket,
+			Value:       p.Value,
+			Numerator:   int32(p.Numerator),
+			Denominator: int32(p.Denominator),
+		}
 	}
-	if end > total {
-		end = total
+
+	return &model.AdminMetricSeries{
+		Metric:      metric,
+		Granularity: g,
+		Points:      points,
+		ComputedAt:  series.ComputedAt,
+	}, nil
+}
+
+// AdminUsers is the resolver for the adminUsers field.
+func (r *queryResolver) AdminUsers(ctx context.Context, filters *model.AdminUserFilters, sort *model.SortInput, cursor *string, page *int32, perPage *int32) (*model.AdminUserList, error) {
+	list, err := admin.ListUsers(filters, sort, adminPage(cursor, page, perPage))
+	if err != nil {
+		return nil, err
 	}
 
-	paginatedUsers := filteredUsers[start:end]
-	adminUsers := make([]*model.AdminUser, len(paginatedUsers))
-	for i := range paginatedUsers {
-		adminUsers[i] = userToAdminUser(&paginatedUsers[i])
+	adminUsers := make([]*model.AdminUser, len(list.Items))
+	for i := range list.Items {
+		adminUsers[i] = userToAdminUser(&list.Items[i])
 	}
 
 	return &model.AdminUserList{
-		Users:   adminUsers,
-		Total:   total,
-		Page:    pageNum,
-		PerPage: perPageNum,
+		Users:      adminUsers,
+		Total:      int32(list.Total),
+		Page:       int32(list.Page),
+		PerPage:    int32(list.PerPage),
+		NextCursor: nextCursorPtr(list.NextCursor),
 	}, nil
 }
 
 // AdminUser is the resolver for the adminUser field.
 func (r *queryResolver) AdminUser(ctx context.Context, id string) (*model.AdminUser, error) {
-	if err := checkAdminRole(ctx); err != nil {
+	user, err := users.GetUserByID(id)
+	if err != nil {
 		return nil, err
 	}
 
-	user, err := users.GetUserByID(id)
+	return userToAdminUser(user), nil
+}
+
+// AdminBillingHistory is the resolver for the adminBillingHistory field.
+func (r *queryResolver) AdminBillingHistory(ctx context.Context, userID string, limit *int32) ([]*models.BillingEvent, error) {
+	n := 0
+	if limit != nil {
+		n = int(*limit)
+	}
+	return subscriptions.History(userID, n)
+}
+
+// AdminPlans is the resolver for the adminPlans field.
+func (r *queryResolver) AdminPlans(ctx context.Context) ([]*models.SubscriptionPlan, error) {
+	plans := subscriptions.AllPlans()
+	result := make([]*models.SubscriptionPlan, len(plans))
+	for i := range plans {
+		result[i] = &plans[i]
+	}
+	return result, nil
+}
+
+// AdminPromoCodes is the resolver for the adminPromoCodes field.
+func (r *queryResolver) AdminPromoCodes(ctx context.Context, activeOnly *bool) ([]*models.PromoCode, error) {
+	return promotions.ListCodes(activeOnly != nil && *activeOnly)
+}
+
+// AdminWebhookEvents is the resolver for the adminWebhookEvents field.
+func (r *queryResolver) AdminWebhookEvents(ctx context.Context, provider *string, status *string, eventType *string, cursor *string, page *int32, perPage *int32) (*model.AdminWebhookEventList, error) {
+	list, err := admin.ListWebhookEvents(derefString(provider), derefString(status), derefString(eventType), adminPage(cursor, page, perPage))
 	if err != nil {
 		return nil, err
 	}
 
-	return userToAdminUser(user), nil
+	result := make([]*model.AdminWebhookEvent, len(list.Items))
+	for i := range list.Items {
+		result[i] = webhookEventToAdmin(&list.Items[i])
+	}
+
+	return &model.AdminWebhookEventList{
+		Events:     result,
+		Total:      int32(list.Total),
+		Page:       int32(list.Page),
+		PerPage:    int32(list.PerPage),
+		NextCursor: nextCursorPtr(list.NextCursor),
+	}, nil
 }
 
 // AdminVerifications is the resolver for the adminVerifications field.
-func (r *queryResolver) AdminVerifications(ctx context.Context, status *string, page *int32, perPage *int32) ([]*model.AdminVerification, error) {
-	if err := checkAdminRole(ctx); err != nil {
+func (r *queryResolver) AdminVerifications(ctx context.Context, status *string, filters *model.AdminVerificationFilters, sort *model.SortInput, cursor *string, page *int32, perPage *int32) ([]*model.AdminVerification, error) {
+	if filters == nil {
+		filters = &model.AdminVerificationFilters{}
+	}
+	if filters.Status == nil {
+		filters.Status = status
+	}
+
+	list, err := r.AdminVerificationList(ctx, filters, sort, cursor, page, perPage)
+	if err != nil {
 		return nil, err
 	}
+	return list.Verifications, nil
+}
+
+// AdminVerificationList is the resolver for the adminVerificationList field.
+func (r *queryResolver) AdminVerificationList(ctx context.Context, filters *model.AdminVerificationFilters, sort *model.SortInput, cursor *string, page *int32, perPage *int32) (*model.AdminVerificationList, error) {
+	if filters == nil {
+		filters = &model.AdminVerificationFilters{}
+	}
 
-	verORM := orm.Load(&models.UserVerification{})
-	var vers []models.UserVerification
-	if status != nil {
-		vers, _ = ormcompat.GetByFieldEqualsSlice[models.UserVerification](verORM, "Status", *status)
-	} else if res, err := verORM.GetAll(); err == nil {
-		if s, ok := res.(*[]models.UserVerification); ok {
-			vers = *s
-		} else if s, ok := res.([]models.UserVerification); ok {
-			vers = s
+	list, err := admin.ListVerifications(filters, sort, adminPage(cursor, page, perPage))
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, len(list.Items))
+	for i, v := range list.Items {
+		userIDs[i] = v.UserId
+	}
+	usersByID, err := admin.UsersByIds(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.AdminVerification, len(list.Items))
+	for i := range list.Items {
+		result[i] = verificationToAdmin(&list.Items[i], usersByID[list.Items[i].UserId])
+	}
+
+	return &model.AdminVerificationList{
+		Verifications: result,
+		Total:         int32(list.Total),
+		Page:          int32(list.Page),
+		PerPage:       int32(list.PerPage),
+		NextCursor:    nextCursorPtr(list.NextCursor),
+	}, nil
+}
+
+// AdminReports is the resolver for the adminReports field.
+func (r *queryResolver) AdminReports(ctx context.Context, status *string, filters *model.AdminReportFilters, sort *model.SortInput, cursor *string, page *int32, perPage *int32) ([]*model.AdminReport, error) {
+	if filters == nil {
+		filters = &model.AdminReportFilters{}
+	}
+	if filters.Status == nil {
+		filters.Status = status
+	}
+
+	list, err := r.AdminReportList(ctx, filters, sort, cursor, page, perPage)
+	if err != nil {
+		return nil, err
+	}
+	return list.Reports, nil
+}
+
+// AdminReportList is the resolver for the adminReportList field.
+func (r *queryResolver) AdminReportList(ctx context.Context, filters *model.AdminReportFilters, sort *model.SortInput, cursor *string, page *int32, perPage *int32) (*model.AdminReportList, error) {
+	if filters == nil {
+		filters = &model.AdminReportFilters{}
+	}
+
+	list, err := admin.ListReports(filters, sort, adminPage(cursor, page, perPage))
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, 0, len(list.Items)*2)
+	for _, rep := range list.Items {
+		userIDs = append(userIDs, rep.UserId, rep.SubjectId)
+	}
+	usersByID, err := admin.UsersByIds(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.AdminReport, len(list.Items))
+	for i := range list.Items {
+		rep := &list.Items[i]
+		result[i] = reportToAdmin(rep, usersByID[rep.UserId], usersByID[rep.SubjectId])
+	}
+
+	return &model.AdminReportList{
+		Reports:    result,
+		Total:      int32(list.Total),
+		Page:       int32(list.Page),
+		PerPage:    int32(list.PerPage),
+		NextCursor: nextCursorPtr(list.NextCursor),
+	}, nil
+}
+
+// AdminReportGroups is the resolver for the adminReportGroups field.
+func (r *queryResolver) AdminReportGroups(ctx context.Context, filters *model.AdminReportGroupFilters, sort *model.SortInput, cursor *string, page *int32, perPage *int32) (*model.AdminReportGroupList, error) {
+	list, err := admin.ListReportGroups(filters, sort, adminPage(cursor, page, perPage))
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, 0, len(list.Items)*2)
+	for _, g := range list.Items {
+		userIDs = append(userIDs, g.SubjectId)
+		if g.AssigneeId != "" {
+			userIDs = append(userIDs, g.AssigneeId)
 		}
 	}
+	usersByID, err := admin.UsersByIds(userIDs)
+	if err != nil {
+		return nil, err
+	}
 
-	result := make([]*model.AdminVerification, len(vers))
-	for i, v := range vers {
-		user, _ := users.GetUserByID(v.UserId)
-		media := make([]string, 0)
-		for _, m := range v.Media {
-			media = append(media, m.Url)
+	result := make([]*model.AdminReportGroup, len(list.Items))
+	for i := range list.Items {
+		g := &list.Items[i]
+		result[i] = reportGroupToAdmin(g, usersByID[g.SubjectId], usersByID[g.AssigneeId])
+	}
+
+	return &model.AdminReportGroupList{
+		Groups:     result,
+		Total:      int32(list.Total),
+		Page:       int32(list.Page),
+		PerPage:    int32(list.PerPage),
+		NextCursor: nextCursorPtr(list.NextCursor),
+	}, nil
+}
+
+// AdminReportGroup is the resolver for the adminReportGroup field.
+func (r *queryResolver) AdminReportGroup(ctx context.Context, id string) (*model.AdminReportGroupDetail, error) {
+	group, err := reporting.GetGroup(id)
+	if err != nil {
+		return nil, err
+	}
+	reports, err := reporting.GroupReports(id)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := []string{group.SubjectId, group.AssigneeId}
+	reportIDs := make([]string, len(reports))
+	for i, rep := range reports {
+		userIDs = append(userIDs, rep.UserId)
+		reportIDs[i] = rep.Id
+	}
+	usersByID, err := admin.UsersByIds(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	evidence, err := reporting.Evidence(reportIDs...)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &model.AdminReportGroupDetail{
+		Group:    reportGroupToAdmin(group, usersByID[group.SubjectId], usersByID[group.AssigneeId]),
+		Reports:  make([]*model.AdminReport, len(reports)),
+		Evidence: evidenceToAdmin(evidence),
+	}
+	for i := range reports {
+		detail.Reports[i] = reportToAdmin(&reports[i], usersByID[reports[i].UserId], usersByID[group.SubjectId])
+	}
+	return detail, nil
+}
+
+// AdminReportEvidence is the resolver for the adminReportEvidence field.
+func (r *queryResolver) AdminReportEvidence(ctx context.Context, reportID string) ([]*model.AdminReportEvidence, error) {
+	evidence, err := reporting.Evidence(reportID)
+	if err != nil {
+		return nil, err
+	}
+	return evidenceToAdmin(evidence), nil
+}
+
+// AdminAuditLog is the resolver for the adminAuditLog field.
+func (r *queryResolver) AdminAuditLog(ctx context.Context, actorID *string, targetID *string, action *string, cursor *string, limit *int32) (*model.AdminAuditLogPage, error) {
+	filter := audit.Filter{
+		ActorId:  derefString(actorID),
+		TargetId: derefString(targetID),
+		Action:   derefString(action),
+		Cursor:   derefString(cursor),
+	}
+	if limit != nil {
+		filter.Limit = int(*limit)
+	}
+
+	entries, next, err := audit.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	actors := make(map[string]*model.AdminUser)
+	result := make([]*model.AdminAuditEntry, len(entries))
+	for i, e := range entries {
+		actor, ok := actors[e.ActorId]
+		if !ok {
+			user, _ := users.GetUserByID(e.ActorId)
+			actor = userToAdminUser(user)
+			actors[e.ActorId] = actor
 		}
-		result[i] = &model.AdminVerification{
-			ID:        v.Id,
-			UserID:    v.UserId,
-			User:      userToAdminUser(user),
-			Media:     media,
-			Status:    v.Status,
-			CreatedAt: v.CreatedAt,
+		result[i] = &model.AdminAuditEntry{
+			ID:         e.Id,
+			ActorID:    e.ActorId,
+			Actor:      actor,
+			Action:     e.Action,
+			TargetType: e.TargetType,
+			TargetID:   e.TargetId,
+			Before:     snapshotJSON(e.Before),
+			After:      snapshotJSON(e.After),
+			CreatedAt:  e.CreatedAt,
 		}
+		if e.Reason != "" {
+			result[i].Reason = strPtr(e.Reason)
+		}
+	}
+
+	page := &model.AdminAuditLogPage{Entries: result}
+	if next != "" {
+		page.NextCursor = &next
 	}
+	return page, nil
+}
 
+// AdminUserEnforcements is the resolver for the adminUserEnforcements field.
+func (r *queryResolver) AdminUserEnforcements(ctx context.Context, userID string) ([]*models.UserEnforcement, error) {
+	enforcements, err := moderation.ListEnforcements(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.UserEnforcement, len(enforcements))
+	for i := range enforcements {
+		result[i] = &enforcements[i]
+	}
 	return result, nil
 }
 
-// AdminReports is the resolver for the adminReports field.
-func (r *queryResolver) AdminReports(ctx context.Context, status *string, page *int32, perPage *int32) ([]*model.AdminReport, error) {
-	if err := checkAdminRole(ctx); err != nil {
+// AdminEnforcementReasonCodes is the resolver for the adminEnforcementReasonCodes field.
+func (r *queryResolver) AdminEnforcementReasonCodes(ctx context.Context) ([]string, error) {
+	return moderation.ReasonCodes(), nil
+}
+
+// AdminBanAppeals is the resolver for the adminBanAppeals field.
+func (r *queryResolver) AdminBanAppeals(ctx context.Context, status *string, page *int32, perPage *int32) (*model.AdminBanAppealList, error) {
+	p := adminPage(nil, page, perPage)
+	if p.PerPage <= 0 {
+		p.PerPage = admin.DefaultPerPage
+	}
+	p.PerPage = min(p.PerPage, admin.MaxPerPage)
+	p.Page = max(p.Page, 1)
+
+	appeals, total, err := moderation.ListAppeals(derefString(status), p.PerPage, (p.Page-1)*p.PerPage)
+	if err != nil {
 		return nil, err
 	}
 
-	reportORM := orm.Load(&models.Report{})
-	var reports []models.Report
-	if status != nil {
-		reports, _ = ormcompat.GetByFieldEqualsSlice[models.Report](reportORM, "Status", *status)
-	} else if res, err := reportORM.GetAll(); err == nil {
-		if s, ok := res.(*[]models.Report); ok {
-			reports = *s
-		} else if s, ok := res.([]models.Report); ok {
-			reports = s
-		}
+	userIDs := make([]string, len(appeals))
+	for i, a := range appeals {
+		userIDs[i] = a.UserId
+	}
+	usersByID, err := admin.UsersByIds(userIDs)
+	if err != nil {
+		return nil, err
 	}
 
-	result := make([]*model.AdminReport, len(reports))
-	for i, r := range reports {
-		reporter, _ := users.GetUserByID(r.UserId)
-		target, _ := users.GetUserByID(r.TargetId)
-		media := make([]string, 0)
-		for _, m := range r.Media {
-			media = append(media, m.Url)
+	result := make([]*model.AdminBanAppeal, len(appeals))
+	for i := range appeals {
+		enforcement, err := moderation.GetEnforcement(appeals[i].EnforcementId)
+		if err != nil {
+			log.Printf("[Admin] Failed to load enforcement %s for appeal %s: %v", appeals[i].EnforcementId, appeals[i].Id, err)
 		}
-		result[i] = &model.AdminReport{
-			ID:             r.Id,
-			UserID:         r.UserId,
-			Reporter:       userToAdminUser(reporter),
-			TargetID:       r.TargetId,
-			Target:         userToAdminUser(target),
-			Reason:         r.Reason,
-			AdditionalInfo: &r.AdditionalInfo,
-			Media:          media,
-			Status:         r.Status,
-			CreatedAt:      r.CreatedAt,
+		result[i] = &model.AdminBanAppeal{
+			Appeal:      &appeals[i],
+			User:        userToAdminUser(usersByID[appeals[i].UserId]),
+			Enforcement: enforcement,
 		}
 	}
 
+	return &model.AdminBanAppealList{
+		Appeals: result,
+		Total:   int32(total),
+		Page:    int32(p.Page),
+		PerPage: int32(p.PerPage),
+	}, nil
+}
+
+// AdminNotificationCampaigns is the resolver for the adminNotificationCampaigns field.
+func (r *queryResolver) AdminNotificationCampaigns(ctx context.Context, status *string, cursor *string, page *int32, perPage *int32) (*model.AdminNotificationCampaignList, error) {
+	list, err := admin.ListCampaigns(derefString(status), adminPage(cursor, page, perPage))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*model.AdminNotificationCampaign, len(list.Items))
+	for i := range list.Items {
+		result[i] = campaignToAdmin(&list.Items[i])
+	}
+
+	return &model.AdminNotificationCampaignList{
+		Campaigns:  result,
+		Total:      int32(list.Total),
+		Page:       int32(list.Page),
+		PerPage:    int32(list.PerPage),
+		NextCursor: nextCursorPtr(list.NextCursor),
+	}, nil
+}
+
+// AdminNotificationCampaign is the resolver for the adminNotificationCampaign field.
+func (r *queryResolver) AdminNotificationCampaign(ctx context.Context, id string) (*model.AdminNotificationCampaign, error) {
+	campaign, err := campaigns.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return campaignToAdmin(campaign), nil
+}
+
+// AdminPreviewAudience is the resolver for the adminPreviewAudience field.
+func (r *queryResolver) AdminPreviewAudience(ctx context.Context, segment *string, segmentFilters *model.NotificationSegmentInput, userIds []string) (*model.AdminAudiencePreview, error) {
+	audience, err := campaigns.Preview(segmentFromInput(segment, segmentFilters, userIds))
+	if err != nil {
+		return nil, err
+	}
+	return &model.AdminAudiencePreview{
+		Users:          int32(audience.Users),
+		ReachableUsers: int32(audience.ReachableUsers),
+		Devices:        int32(audience.Devices),
+	}, nil
+}
+
+// AdminMyPermissions is the resolver for the adminMyPermissions field.
+func (r *queryResolver) AdminMyPermissions(ctx context.Context) ([]string, error) {
+	userID, err := adminActorID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := rbac.GetRole(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	perms := rbac.PermissionsFor(role)
+	result := make([]string, len(perms))
+	for i, p := range perms {
+		result[i] = string(p)
+	}
 	return result, nil
 }
 
 // Helper functions
 
+// enforceAndAudit applies an enforcement and records it in the audit log along with the
+// user's moderation status before and after.
+func enforceAndAudit(actorID string, action moderation.Action, reason string) (*models.UserEnforcement, error) {
+	if err := rbac.CheckOutranks(actorID, action.UserId); err != nil {
+		return nil, err
+	}
+	before, _ := moderation.GetStatus(action.UserId)
+
+	enforcement, err := moderation.Enforce(action)
+	if err != nil {
+		return nil, err
+	}
+
+	auditAction := map[string]string{
+		moderation.TypeWarning:    audit.ActionUserWarn,
+		moderation.TypeSuspension: audit.ActionUserSuspend,
+		moderation.TypeShadowBan:  audit.ActionUserShadowBan,
+		moderation.TypeBan:        audit.ActionUserBan,
+	}[enforcement.Type]
+	after, _ := moderation.GetStatus(action.UserId)
+	recordAudit(audit.Entry{
+		ActorId:    actorID,
+		Action:     auditAction,
+		TargetType: audit.TargetUser,
+		TargetId:   action.UserId,
+		Before:     before,
+		After:      after,
+		Reason:     reason,
+	})
+
+	return enforcement, nil
+}
+
+func adminPage(cursor *string, page *int32, perPage *int32) admin.Page {
+	p := admin.Page{Cursor: derefString(cursor)}
+	if page != nil {
+		p.Page = int(*page)
+	}
+	if perPage != nil {
+		p.PerPage = int(*perPage)
+	}
+	return p
+}
+
+func nextCursorPtr(cursor string) *string {
+	if cursor == "" {
+		return nil
+	}
+	return &cursor
+}
+
+// validReportActions are the action values adminResolveReport accepts. An empty
+// action or "none" resolves the report without an enforcement.
+var validReportActions = map[string]bool{
+	"":        true,
+	"none":    true,
+	"ban":     true,
+	"suspend": true,
+	"warn":    true,
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func snapshotJSON(m map[string]any) *string {
+	if len(m) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil
+	}
+	str := string(data)
+	return &str
+}
+
+// reportGroupWithUsers converts a group for a single-group response.
+func reportGroupWithUsers(g *models.ReportGroup) (*model.AdminReportGroup, error) {
+	usersByID, err := admin.UsersByIds([]string{g.SubjectId, g.AssigneeId})
+	if err != nil {
+		return nil, err
+	}
+	return reportGroupToAdmin(g, usersByID[g.SubjectId], usersByID[g.AssigneeId]), nil
+}
+
+func reportToAdmin(rep *models.Report, reporter, target *models.User) *model.AdminReport {
+	media := make([]string, 0)
+	for _, m := range rep.Media {
+		media = append(media, m.Url)
+	}
+	return &model.AdminReport{
+		ID:             rep.Id,
+		UserID:         rep.UserId,
+		Reporter:       userToAdminUser(reporter),
+		TargetID:       rep.TargetId,
+		TargetType:     rep.TargetType,
+		Target:         userToAdminUser(target),
+		Category:       rep.Category,
+		Severity:       int32(rep.Severity),
+		GroupID:        optionalString(rep.GroupId),
+		ChatID:         optionalString(rep.ChatId),
+		Reason:         rep.Reason,
+		AdditionalInfo: &rep.AdditionalInfo,
+		Media:          media,
+		Status:         rep.Status,
+		CreatedAt:      rep.CreatedAt,
+	}
+}
+
+func reportGroupToAdmin(g *models.ReportGroup, subject, assignee *models.User) *model.AdminReportGroup {
+	return &model.AdminReportGroup{
+		ID:             g.Id,
+		SubjectID:      g.SubjectId,
+		Subject:        userToAdminUser(subject),
+		Status:         g.Status,
+		Category:       g.Category,
+		Severity:       int32(g.Severity),
+		Priority:       int32(g.Priority),
+		ReportCount:    int32(g.ReportCount),
+		ReporterCount:  int32(g.ReporterCount),
+		AssigneeID:     optionalString(g.AssigneeId),
+		Assignee:       userToAdminUser(assignee),
+		EscalatedAt:    g.EscalatedAt,
+		EscalatedBy:    optionalString(g.EscalatedBy),
+		EscalationNote: optionalString(g.EscalationNote),
+		LastReportedAt: g.LastReportedAt,
+		ResolvedAt:     g.ResolvedAt,
+		CreatedAt:      g.CreatedAt,
+	}
+}
+
+func evidenceToAdmin(evidence []models.ReportEvidence) []*model.AdminReportEvidence {
+	result := make([]*model.AdminReportEvidence, len(evidence))
+	for i, e := range evidence {
+		snapshot := "{}"
+		if s := snapshotJSON(e.Snapshot); s != nil {
+			snapshot = *s
+		}
+		result[i] = &model.AdminReportEvidence{
+			ID:          e.Id,
+			ReportID:    e.ReportId,
+			Kind:        e.Kind,
+			SourceID:    e.SourceId,
+			Snapshot:    snapshot,
+			ContentHash: e.ContentHash,
+			CapturedAt:  e.CapturedAt,
+		}
+	}
+	return result
+}
+
+// optionalString maps empty strings to null.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func webhookEventToAdmin(ev *models.WebhookEvent) *model.AdminWebhookEvent {
+	return &model.AdminWebhookEvent{
+		ID:          ev.Id,
+		Provider:    ev.Provider,
+		EventID:     ev.EventId,
+		EventType:   ev.EventType,
+		Subject:     ev.Subject,
+		OccurredAt:  ev.OccurredAt,
+		Status:      ev.Status,
+		Attempts:    int32(ev.Attempts),
+		LastError:   optionalString(ev.LastError),
+		Payload:     ev.Payload,
+		ReceivedAt:  ev.ReceivedAt,
+		ProcessedAt: ev.ProcessedAt,
+	}
+}
+
+func verificationToAdmin(v *models.UserVerification, user *models.User) *model.AdminVerification {
+	media := make([]string, 0, len(v.Media))
+	for _, m := range v.Media {
+		media = append(media, m.Url)
+	}
+	photos := make([]string, 0)
+	if user != nil {
+		photos = append(photos, user.Photos...)
+	}
+	result := &model.AdminVerification{
+		ID:             v.Id,
+		UserID:         v.UserId,
+		User:           userToAdminUser(user),
+		Media:          media,
+		Status:         v.Status,
+		Attempt:        int32(v.Attempt),
+		ReviewedAt:     v.ReviewedAt,
+		FaceMatchScore: v.FaceMatchScore,
+		ProfilePhotos:  photos,
+		CreatedAt:      v.CreatedAt,
+	}
+	if v.RejectionReason != "" {
+		result.RejectionReason = &v.RejectionReason
+	}
+	if v.ReviewerId != "" {
+		result.ReviewerID = &v.ReviewerId
+	}
+	if v.FaceMatcher != "" {
+		result.FaceMatcher = &v.FaceMatcher
+	}
+	return result
+}
+
+func segmentFromInput(preset *string, filters *model.NotificationSegmentInput, userIDs []string) models.AudienceSegment {
+	seg := models.AudienceSegment{Preset: derefString(preset), UserIds: userIDs}
+	if filters == nil {
+		return seg
+	}
+	if filters.Preset != nil && seg.Preset == "" {
+		seg.Preset = *filters.Preset
+	}
+	seg.PlanIds = filters.PlanIds
+	seg.Verified = filters.Verified
+	seg.Genders = filters.Genders
+	seg.Countries = filters.Countries
+	seg.SignedUpAfter = filters.SignedUpAfter
+	seg.SignedUpBefore = filters.SignedUpBefore
+	if filters.ActiveWithinDays != nil {
+		days := int(*filters.ActiveWithinDays)
+		seg.ActiveWithinDays = &days
+	}
+	if filters.InactiveForDays != nil {
+		days := int(*filters.InactiveForDays)
+		seg.InactiveForDays = &days
+	}
+	return seg
+}
+
+func campaignToAdmin(c *models.NotificationCampaign) *model.AdminNotificationCampaign {
+	seg := &model.AdminNotificationSegment{
+		Preset:         c.Segment.Preset,
+		PlanIds:        c.Segment.PlanIds,
+		Verified:       c.Segment.Verified,
+		Genders:        c.Segment.Genders,
+		Countries:      c.Segment.Countries,
+		SignedUpAfter:  c.Segment.SignedUpAfter,
+		SignedUpBefore: c.Segment.SignedUpBefore,
+		UserIds:        c.Segment.UserIds,
+	}
+	if seg.Preset == "" {
+		seg.Preset = campaigns.PresetAll
+	}
+	if c.Segment.ActiveWithinDays != nil {
+		days := int32(*c.Segment.ActiveWithinDays)
+		seg.ActiveWithinDays = &days
+	}
+	if c.Segment.InactiveForDays != nil {
+		days := int32(*c.Segment.InactiveForDays)
+		seg.InactiveForDays = &days
+	}
+
+	return &model.AdminNotificationCampaign{
+		ID:                c.Id,
+		Title:             c.Title,
+		Body:              c.Body,
+		Segment:           seg,
+		Status:            c.Status,
+		SendAt:            c.SendAt,
+		ThrottlePerMinute: int32(c.ThrottlePerMinute),
+		CreatedBy:         c.CreatedBy,
+		TargetUsers:       int32(c.TargetUsers),
+		TargetDevices:     int32(c.TargetDevices),
+		SentCount:         int32(c.SentCount),
+		FailedCount:       int32(c.FailedCount),
+		LastError:         optionalString(c.LastError),
+		StartedAt:         c.StartedAt,
+		CompletedAt:       c.CompletedAt,
+		CreatedAt:         c.CreatedAt,
+	}
+}
+
 func userToAdminUser(user *models.User) *model.AdminUser {
 	if user == nil {
 		return nil
@@ -559,42 +1651,77 @@ func userToAdminUser(user *models.User) *model.AdminUser {
 		Gender:             &user.Gender,
 		IsVerified:         user.IsVerified,
 		IsBanned:           user.IsBanned,
+		SuspendedUntil:     user.SuspendedUntil,
+		IsShadowBanned:     user.IsShadowBanned,
 		Role:               user.Role,
 		SubscriptionPlanID: &user.SubscriptionPlanId,
 		CreatedAt:          user.CreatedAt,
-		LastActive:         nil, // Would need activity tracking
+		LastActive:         user.LastActiveAt,
 	}
 }
 
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
-		(len(s) > 0 && len(substr) > 0 && containsIgnoreCase(s, substr)))
-}
-
-func containsIgnoreCase(s, substr string) bool {
-	for i := 0; i+len(substr) <= len(s); i++ {
-		if equalFoldSlice(s[i:i+len(substr)], substr) {
-			return true
+func planInputFromModel(in model.PlanInput) subscriptions.PlanInput {
+	out := subscriptions.PlanInput{
+		Name:             in.Name,
+		Description:      in.Description,
+		PriceMonthly:     intPtr(in.PriceMonthly),
+		PriceYearly:      intPtr(in.PriceYearly),
+		RevcatOfferingId: in.RevcatOfferingID,
+		SortOrder:        intPtr(in.SortOrder),
+		VariantWeight:    intPtr(in.VariantWeight),
+		IsActive:         in.IsActive,
+	}
+	if f := in.Features; f != nil {
+		out.Features = &models.SubscriptionFeatures{
+			SeeWhoLiked:      f.SeeWhoLiked,
+			PriorityMatching: f.PriorityMatching,
+			ProfileBoost:     f.ProfileBoost,
+			AdvancedFilters:  f.AdvancedFilters,
+			VerifiedPriority: f.VerifiedPriority,
+			UnlimitedRewinds: f.UnlimitedRewinds,
+			ReadReceipts:     f.ReadReceipts,
+			IncognitoMode:    f.IncognitoMode,
+		}
+	}
+	if l := in.Limits; l != nil {
+		out.Limits = &models.SubscriptionLimits{
+			SwipesPerDay:     int(l.SwipesPerDay),
+			AiRepliesPerDay:  int(l.AiRepliesPerDay),
+			SuperlikesPerDay: int(l.SuperlikesPerDay),
+			BoostsPerMonth:   int(l.BoostsPerMonth),
 		}
 	}
-	return false
+	if p := in.ProductIds; p != nil {
+		out.ProductIds = &models.PlanProducts{
+			DodoMonthly:   strings.TrimSpace(p.DodoMonthly),
+			DodoYearly:    strings.TrimSpace(p.DodoYearly),
+			RevcatMonthly: strings.TrimSpace(p.RevcatMonthly),
+			RevcatYearly:  strings.TrimSpace(p.RevcatYearly),
+		}
+	}
+	return out
 }
 
-func equalFoldSlice(a, b string) bool {
-	if len(a) != len(b) {
-		return false
+func intPtr(n *int32) *int {
+	if n == nil {
+		return nil
 	}
-	for i := 0; i < len(a); i++ {
-		ca, cb := a[i], b[i]
-		if ca >= 'A' && ca <= 'Z' {
-			ca += 'a' - 'A'
-		}
-		if cb >= 'A' && cb <= 'Z' {
-			cb += 'a' - 'A'
-		}
-		if ca != cb {
-			return false
-		}
+	v := int(*n)
+	return &v
+}
+
+// planSnapshot is what the audit log keeps of a plan.
+func planSnapshot(p *models.SubscriptionPlan) map[string]any {
+	return map[string]any{
+		"name":           p.Name,
+		"base_plan_id":   p.BasePlanId,
+		"price_monthly":  p.PriceMonthly,
+		"price_yearly":   p.PriceYearly,
+		"features":       p.Features,
+		"limits":         p.Limits,
+		"product_ids":    p.ProductIds,
+		"variant_weight": p.VariantWeight,
+		"is_active":      p.IsActive,
+		"sort_order":     p.SortOrder,
 	}
-	return true
 }
@@ -12,6 +12,14 @@ import (
 	"fmt"
 )
 
+// Type is the resolver for the type field.
+func (r *chatMessageResolver) Type(ctx context.Context, obj *models.Message) (string, error) {
+	if obj == nil {
+		return "", fmt.Errorf("message is nil")
+	}
+	return string(obj.Type), nil
+}
+
 // Score is the resolver for the score field.
 func (r *matchResolver) Score(ctx context.Context, obj *models.Match) (int32, error) {
 	if obj == nil {
@@ -41,11 +49,25 @@ func (r *queryResolver) GetMyConnections(ctx context.Context) ([]*model.Connecti
 	return r.ChatsResolver.GetMyConnections(ctx)
 }
 
+// TotalUnread is the resolver for the totalUnread field.
+func (r *queryResolver) TotalUnread(ctx context.Context) (int32, error) {
+	return r.ChatsResolver.TotalUnread(ctx)
+}
+
+// SearchMessages is the resolver for the searchMessages field.
+func (r *queryResolver) SearchMessages(ctx context.Context, query string, chatID *string, limit *int32) ([]*model.MessageSearchHit, error) {
+	return r.ChatsResolver.SearchMessages(ctx, query, chatID, limit)
+}
+
+// ChatMessage returns ChatMessageResolver implementation.
+func (r *Resolver) ChatMessage() ChatMessageResolver { return &chatMessageResolver{r} }
+
 // Match returns MatchResolver implementation.
 func (r *Resolver) Match() MatchResolver { return &matchResolver{r} }
 
 // PostUnlockRating returns PostUnlockRatingResolver implementation.
 func (r *Resolver) PostUnlockRating() PostUnlockRatingResolver { return &postUnlockRatingResolver{r} }
 
+type chatMessageResolver struct{ *Resolver }
 type matchResolver struct{ *Resolver }
 type postUnlockRatingResolver struct{ *Resolver }
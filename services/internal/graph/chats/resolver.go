@@ -2,16 +2,20 @@ package chats
 
 import (
 	"spark/internal/anal"
+	chatservice "spark/internal/chat_service"
 	"spark/internal/graph/directives"
 	"spark/internal/graph/model"
 	"spark/internal/graph/shared"
+	"spark/internal/helpers/impersonation"
 	"spark/internal/models"
 	"context"
 	"database/sql"
+	"errors"
 	"encoding/json"
 	"fmt"
 	"log"
 	"math"
+	"time"
 
 	"github.com/MelloB1989/karma/database"
 )
@@ -92,6 +96,12 @@ ORDER BY m.matched_at DESC;
 		return nil, fmt.Errorf("rows iteration error: %w", err)
 	}
 
+	unreadCounts, err := chatservice.GetUnreadCounts(claims.UserID)
+	if err != nil {
+		log.Printf("[WARN] Failed to load unread counters for %s: %v", claims.UserID, err)
+		unreadCounts = map[string]int{}
+	}
+
 	conns := make([]*model.Connection, 0, len(rows))
 	for _, rrow := range rows {
 		var chat models.Chat
@@ -131,8 +141,33 @@ ORDER BY m.matched_at DESC;
 			lastMsg = rrow.LastMessage.String
 		}
 
-		var unread int32 = 0
+		var lastMsgAt *time.Time
+		var lastMsgSender *string
 		if len(chat.Messages) > 0 {
+			last := chat.Messages[len(chat.Messages)-1]
+			lastMsgAt = &last.CreatedAt
+			lastMsgSender = &last.SenderId
+		}
+		// Messages still buffered in Redis are newer than anything persisted
+		if chat.Id != "" {
+			if meta, err := chatservice.GetLastMessageMeta(chat.Id); err == nil && meta != nil {
+				if lastMsgAt == nil || meta.SentAt.After(*lastMsgAt) {
+					lastMsg = meta.Content
+					lastMsgAt = &meta.SentAt
+					lastMsgSender = &meta.SenderId
+				}
+			}
+		}
+
+		if lastMsg != "" && !impersonation.CanReadChat(claims, chat.Id) {
+			lastMsg = impersonation.HiddenContent
+		}
+
+		var unread int32 = 0
+		if n, ok := unreadCounts[chat.Id]; ok {
+			unread = int32(n)
+		} else if len(chat.Messages) > 0 {
+			// No counter yet for this chat, fall back to the persisted messages
 			for i := len(chat.Messages) - 1; i >= 0; i-- {
 				if chat.Messages[i].SenderId != claims.UserID && !chat.Messages[i].Seen {
 					unread++
@@ -150,12 +185,14 @@ ORDER BY m.matched_at DESC;
 		pct = math.Round(pct*100) / 100
 
 		conn := &model.Connection{
-			Chat:               nil,
-			Match:              nil,
-			LastMessage:        lastMsg,
-			UnreadMessages:     unread,
-			PercentageComplete: pct,
-			ConnectionProfile:  profile,
+			Chat:                nil,
+			Match:               nil,
+			LastMessage:         lastMsg,
+			LastMessageAt:       lastMsgAt,
+			LastMessageSenderID: lastMsgSender,
+			UnreadMessages:      unread,
+			PercentageComplete:  pct,
+			ConnectionProfile:   profile,
 		}
 		if chat.Id != "" {
 			conn.Chat = &chat
@@ -169,3 +206,74 @@ ORDER BY m.matched_at DESC;
 
 	return conns, nil
 }
+
+func (r *Resolver) TotalUnread(ctx context.Context) (int32, error) {
+	claims, ae, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		ae.SendRequestError(anal.UNAUTHORIZED_401, err)
+		return 0, fmt.Errorf("unauthorized: %w", err)
+	}
+
+	total, err := chatservice.GetTotalUnread(claims.UserID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to get total unread for %s: %v", claims.UserID, err)
+		return 0, fmt.Errorf("failed to get unread count: %w", err)
+	}
+
+	return int32(total), nil
+}
+
+func (r *Resolver) SearchMessages(ctx context.Context, query string, chatID *string, limit *int32) ([]*model.MessageSearchHit, error) {
+	claims, ae, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		ae.SendRequestError(anal.UNAUTHORIZED_401, err)
+		return nil, fmt.Errorf("unauthorized: %w", err)
+	}
+
+	chatId := ""
+	if chatID != nil {
+		chatId = *chatID
+	}
+	n := 0
+	if limit != nil {
+		n = int(*limit)
+	}
+	// Impersonators can only search a chat they're allowed to read
+	if claims.IsImpersonation() && !impersonation.CanReadChat(claims, chatId) {
+		ae.SendRequestError(anal.UNAUTHORIZED_401, impersonation.ErrNotAllowed)
+		return nil, fmt.Errorf("message search is %w without an open report on the chat", impersonation.ErrNotAllowed)
+	}
+
+	hits, err := chatservice.SearchMessages(claims.UserID, query, chatId, n)
+	if err != nil {
+		if errors.Is(err, chatservice.ErrUnauthorized) {
+			ae.SendRequestError(anal.UNAUTHORIZED_401, err)
+			return nil, fmt.Errorf("chat not found")
+		}
+		log.Printf("[ERROR] Failed to search messages for %s: %v", claims.UserID, err)
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	results := make([]*model.MessageSearchHit, 0, len(hits))
+	for _, hit := range hits {
+		msg := hit.Message
+		results = append(results, &model.MessageSearchHit{
+			ChatID:   hit.ChatId,
+			AnchorID: hit.AnchorId,
+			Snippet:  hit.Snippet,
+			Message:  &msg,
+			Before:   toMessagePtrs(hit.Before),
+			After:    toMessagePtrs(hit.After),
+		})
+	}
+
+	return results, nil
+}
+
+func toMessagePtrs(msgs []models.Message) []*models.Message {
+	out := make([]*models.Message, len(msgs))
+	for i := range msgs {
+		out[i] = &msgs[i]
+	}
+	return out
+}
@@ -48,6 +48,24 @@ func (r *mediaResolver) Type(ctx context.Context, obj *models.Media) (model.Medi
 	return model.MediaType(obj.Type), nil
 }
 
+// Size is the resolver for the size field.
+func (r *mediaResolver) Size(ctx context.Context, obj *models.Media) (*int32, error) {
+	if obj == nil || obj.Size == 0 {
+		return nil, nil
+	}
+	size := int32(obj.Size)
+	return &size, nil
+}
+
+// DurationMs is the resolver for the duration_ms field.
+func (r *mediaResolver) DurationMs(ctx context.Context, obj *models.Media) (*int32, error) {
+	if obj == nil || obj.DurationMs == 0 {
+		return nil, nil
+	}
+	duration := int32(obj.DurationMs)
+	return &duration, nil
+}
+
 // CreatePost is the resolver for the create_post field.
 func (r *mutationResolver) CreatePost(ctx context.Context, input model.CreatePostInput) (*models.Post, error) {
 	return r.CommunityResolver.CreatePost(ctx, input)
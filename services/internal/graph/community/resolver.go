@@ -5,6 +5,7 @@ import (
 	"spark/internal/graph/directives"
 	"spark/internal/graph/model"
 	"spark/internal/helpers/community"
+	"spark/internal/helpers/notifications"
 	"spark/internal/models"
 	"context"
 	"encoding/base64"
@@ -164,6 +165,21 @@ func (r *Resolver) CreateComment(ctx context.Context, input model.CreateCommentI
 		return nil, err
 	}
 
+	go func() {
+		postAuthorID := ""
+		if post, err := community.GetPostById(input.PostID); err == nil {
+			postAuthorID = post.UserId
+			notifications.SendCommentNotification(post.UserId, claims.UserID, post.Id, comment.Content)
+		}
+		if replyToId == "" {
+			return
+		}
+		// A post author replied to on their own post already heard about the comment
+		if parent, err := community.GetCommentById(replyToId); err == nil && parent.UserId != postAuthorID {
+			notifications.SendCommentReplyNotification(parent.UserId, claims.UserID, comment.PostId, comment.Content)
+		}
+	}()
+
 	go func() {
 		ae.SetProperty(anal.COMMENT_ID, comment.Id)
 		ae.SetProperty(anal.POST_ID, input.PostID)
@@ -258,6 +274,10 @@ func (r *Resolver) TogglePostLike(ctx context.Context, postID string) (*models.P
 		return nil, err
 	}
 
+	if !isLiked {
+		notifications.SendPostLikeNotification(post.UserId, claims.UserID, post.Id)
+	}
+
 	return post, nil
 }
 
@@ -347,7 +367,7 @@ func (r *Resolver) GetPosts(ctx context.Context, filter *model.PostFilterInput,
 		offset = decodedCursor
 	}
 
-	posts, total, err := community.GetPosts(filter, sort, pageLimit, offset)
+	posts, total, err := community.GetPosts(claims.UserID, filter, sort, pageLimit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -479,7 +499,7 @@ func (r *Resolver) GetComments(ctx context.Context, filter model.CommentFilterIn
 		offset = decodedCursor
 	}
 
-	comments, total, err := community.GetComments(&filter, sort, pageLimit, offset)
+	comments, total, err := community.GetComments(claims.UserID, &filter, sort, pageLimit, offset)
 	if err != nil {
 		return nil, err
 	}
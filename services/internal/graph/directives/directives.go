@@ -2,6 +2,10 @@ package directives
 
 import (
 	analytics "spark/internal/anal"
+	"spark/internal/helpers/impersonation"
+	"spark/internal/helpers/moderation"
+	"spark/internal/helpers/rbac"
+	"spark/internal/helpers/users"
 	"spark/internal/models"
 	"context"
 	"errors"
@@ -19,6 +23,12 @@ type contextKey string
 const ClaimsContextKey = contextKey("authClaims")
 const AnalyticsContextKey = contextKey("analytics")
 
+// restrictedUserFields stay reachable for banned and suspended users.
+var restrictedUserFields = map[string]bool{
+	"myModerationStatus": true,
+	"appealBan":          true,
+}
+
 func AuthDirective(ctx context.Context, obj any, next graphql.Resolver) (any, error) {
 	analyticsClient := analytics.CreateAnalytics("anoynomous-" + utils.GenerateID(4))
 	reqCtx := ctx.Value("httpRequest").(*http.Request)
@@ -57,12 +67,68 @@ func AuthDirective(ctx context.Context, obj any, next graphql.Resolver) (any, er
 	analyticsClient.SetProperty(analytics.USER_NAME, claims.Name)
 	analyticsClient.SetProperty(analytics.USER_PFP, claims.Pfp)
 
+	if claims.IsImpersonation() {
+		if err := authorizeImpersonation(ctx, claims); err != nil {
+			analyticsClient.SendRequestError(analytics.UNAUTHORIZED_401, err)
+			return nil, err
+		}
+	}
+
+	// Banned and suspended users can only look at their status and appeal
+	if fc := graphql.GetFieldContext(ctx); fc == nil || !restrictedUserFields[fc.Field.Name] {
+		if err := moderation.CheckAccess(claims.UserID); err != nil {
+			analyticsClient.SendRequestError(analytics.UNAUTHORIZED_401, err)
+			return nil, err
+		}
+	}
+	// Staff looking around shouldn't count as the user being active
+	if !claims.IsImpersonation() {
+		go users.TouchLastActive(claims.UserID)
+	}
+
 	// Inject claims into context
 	ctx = context.WithValue(ctx, ClaimsContextKey, claims)
 	ctx = context.WithValue(ctx, AnalyticsContextKey, analyticsClient)
 	return next(ctx)
 }
 
+// authorizeImpersonation only lets impersonation tokens run queries, and audits each
+// field they resolve.
+func authorizeImpersonation(ctx context.Context, claims *models.Claims) error {
+	if !graphql.HasOperationContext(ctx) {
+		return impersonation.ErrReadOnly
+	}
+	op := graphql.GetOperationContext(ctx)
+	field := ""
+	if fc := graphql.GetFieldContext(ctx); fc != nil {
+		field = fc.Field.Name
+	}
+	return impersonation.Authorize(claims, string(op.Operation.Operation), op.OperationName, field)
+}
+
+// HasPermissionDirective must come after @auth on a field. It rejects callers whose
+// current role doesn't grant permission.
+func HasPermissionDirective(ctx context.Context, obj any, next graphql.Resolver, permission string) (any, error) {
+	claims, analyticsClient, err := GetAuthClaims(ctx)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	// Impersonation tokens never carry staff permissions
+	if claims.IsImpersonation() {
+		return nil, rbac.ErrForbidden
+	}
+
+	if err := rbac.Check(claims.UserID, rbac.Permission(permission)); err != nil {
+		analyticsClient.SendRequestError(analytics.UNAUTHORIZED_401, err)
+		if errors.Is(err, rbac.ErrForbidden) || errors.Is(err, rbac.ErrNotFound) {
+			return nil, rbac.ErrForbidden
+		}
+		return nil, err
+	}
+
+	return next(ctx)
+}
+
 func GetAuthClaims(ctx context.Context) (*models.Claims, *analytics.AnalyticsEngine, error) {
 	claims, ok := ctx.Value(ClaimsContextKey).(*models.Claims)
 	if !ok {
@@ -34,12 +34,108 @@ type AddressInput struct {
 	Country string `json:"country"`
 }
 
+type AdminAudiencePreview struct {
+	Users          int32 `json:"users"`
+	ReachableUsers int32 `json:"reachable_users"`
+	Devices        int32 `json:"devices"`
+}
+
+type AdminAuditEntry struct {
+	ID         string     `json:"id"`
+	ActorID    string     `json:"actor_id"`
+	Actor      *AdminUser `json:"actor,omitempty"`
+	Action     string     `json:"action"`
+	TargetType string     `json:"target_type"`
+	TargetID   string     `json:"target_id"`
+	Before     *string    `json:"before,omitempty"`
+	After      *string    `json:"after,omitempty"`
+	Reason     *string    `json:"reason,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type AdminAuditLogPage struct {
+	Entries    []*AdminAuditEntry `json:"entries"`
+	NextCursor *string            `json:"next_cursor,omitempty"`
+}
+
+type AdminBanAppeal struct {
+	Appeal      *models.BanAppeal       `json:"appeal"`
+	User        *AdminUser              `json:"user,omitempty"`
+	Enforcement *models.UserEnforcement `json:"enforcement,omitempty"`
+}
+
+type AdminBanAppealList struct {
+	Appeals []*AdminBanAppeal `json:"appeals"`
+	Total   int32             `json:"total"`
+	Page    int32             `json:"page"`
+	PerPage int32             `json:"per_page"`
+}
+
+type AdminMetricPoint struct {
+	Bucket      time.Time `json:"bucket"`
+	Value       *float64  `json:"value,omitempty"`
+	Numerator   int32     `json:"numerator"`
+	Denominator int32     `json:"denominator"`
+}
+
+type AdminMetricSeries struct {
+	Metric      AdminMetric         `json:"metric"`
+	Granularity MetricGranularity   `json:"granularity"`
+	Points      []*AdminMetricPoint `json:"points"`
+	ComputedAt  *time.Time          `json:"computed_at,omitempty"`
+}
+
+type AdminNotificationCampaign struct {
+	ID                string                    `json:"id"`
+	Title             string                    `json:"title"`
+	Body              string                    `json:"body"`
+	Segment           *AdminNotificationSegment `json:"segment"`
+	Status            string                    `json:"status"`
+	SendAt            time.Time                 `json:"send_at"`
+	ThrottlePerMinute int32                     `json:"throttle_per_minute"`
+	CreatedBy         string                    `json:"created_by"`
+	TargetUsers       int32                     `json:"target_users"`
+	TargetDevices     int32                     `json:"target_devices"`
+	SentCount         int32                     `json:"sent_count"`
+	FailedCount       int32                     `json:"failed_count"`
+	LastError         *string                   `json:"last_error,omitempty"`
+	StartedAt         *time.Time                `json:"started_at,omitempty"`
+	CompletedAt       *time.Time                `json:"completed_at,omitempty"`
+	CreatedAt         time.Time                 `json:"created_at"`
+}
+
+type AdminNotificationCampaignList struct {
+	Campaigns  []*AdminNotificationCampaign `json:"campaigns"`
+	Total      int32                        `json:"total"`
+	Page       int32                        `json:"page"`
+	PerPage    int32                        `json:"per_page"`
+	NextCursor *string                      `json:"next_cursor,omitempty"`
+}
+
+type AdminNotificationSegment struct {
+	Preset           string     `json:"preset"`
+	PlanIds          []string   `json:"plan_ids"`
+	ActiveWithinDays *int32     `json:"active_within_days,omitempty"`
+	InactiveForDays  *int32     `json:"inactive_for_days,omitempty"`
+	Verified         *bool      `json:"verified,omitempty"`
+	Genders          []string   `json:"genders"`
+	Countries        []string   `json:"countries"`
+	SignedUpAfter    *time.Time `json:"signed_up_after,omitempty"`
+	SignedUpBefore   *time.Time `json:"signed_up_before,omitempty"`
+	UserIds          []string   `json:"user_ids"`
+}
+
 type AdminReport struct {
 	ID             string     `json:"id"`
 	UserID         string     `json:"user_id"`
 	Reporter       *AdminUser `json:"reporter,omitempty"`
 	TargetID       string     `json:"target_id"`
+	TargetType     string     `json:"target_type"`
 	Target         *AdminUser `json:"target,omitempty"`
+	Category       string     `json:"category"`
+	Severity       int32      `json:"severity"`
+	GroupID        *string    `json:"group_id,omitempty"`
+	ChatID         *string    `json:"chat_id,omitempty"`
 	Reason         string     `json:"reason"`
 	AdditionalInfo *string    `json:"additional_info,omitempty"`
 	Media          []string   `json:"media,omitempty"`
@@ -47,6 +143,79 @@ type AdminReport struct {
 	CreatedAt      time.Time  `json:"created_at"`
 }
 
+type AdminReportEvidence struct {
+	ID          string    `json:"id"`
+	ReportID    string    `json:"report_id"`
+	Kind        string    `json:"kind"`
+	SourceID    string    `json:"source_id"`
+	Snapshot    string    `json:"snapshot"`
+	ContentHash string    `json:"content_hash"`
+	CapturedAt  time.Time `json:"captured_at"`
+}
+
+type AdminReportFilters struct {
+	Status        *string    `json:"status,omitempty"`
+	ReporterID    *string    `json:"reporter_id,omitempty"`
+	TargetID      *string    `json:"target_id,omitempty"`
+	Category      *string    `json:"category,omitempty"`
+	GroupID       *string    `json:"group_id,omitempty"`
+	Reason        *string    `json:"reason,omitempty"`
+	Search        *string    `json:"search,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+}
+
+type AdminReportGroup struct {
+	ID             string     `json:"id"`
+	SubjectID      string     `json:"subject_id"`
+	Subject        *AdminUser `json:"subject,omitempty"`
+	Status         string     `json:"status"`
+	Category       string     `json:"category"`
+	Severity       int32      `json:"severity"`
+	Priority       int32      `json:"priority"`
+	ReportCount    int32      `json:"report_count"`
+	ReporterCount  int32      `json:"reporter_count"`
+	AssigneeID     *string    `json:"assignee_id,omitempty"`
+	Assignee       *AdminUser `json:"assignee,omitempty"`
+	EscalatedAt    *time.Time `json:"escalated_at,omitempty"`
+	EscalatedBy    *string    `json:"escalated_by,omitempty"`
+	EscalationNote *string    `json:"escalation_note,omitempty"`
+	LastReportedAt time.Time  `json:"last_reported_at"`
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+type AdminReportGroupDetail struct {
+	Group    *AdminReportGroup      `json:"group"`
+	Reports  []*AdminReport         `json:"reports"`
+	Evidence []*AdminReportEvidence `json:"evidence"`
+}
+
+type AdminReportGroupFilters struct {
+	Status      *string `json:"status,omitempty"`
+	Category    *string `json:"category,omitempty"`
+	SubjectID   *string `json:"subject_id,omitempty"`
+	AssigneeID  *string `json:"assignee_id,omitempty"`
+	Escalated   *bool   `json:"escalated,omitempty"`
+	MinPriority *int32  `json:"min_priority,omitempty"`
+}
+
+type AdminReportGroupList struct {
+	Groups     []*AdminReportGroup `json:"groups"`
+	Total      int32               `json:"total"`
+	Page       int32               `json:"page"`
+	PerPage    int32               `json:"per_page"`
+	NextCursor *string             `json:"next_cursor,omitempty"`
+}
+
+type AdminReportList struct {
+	Reports    []*AdminReport `json:"reports"`
+	Total      int32          `json:"total"`
+	Page       int32          `json:"page"`
+	PerPage    int32          `json:"per_page"`
+	NextCursor *string        `json:"next_cursor,omitempty"`
+}
+
 type AdminStats struct {
 	TotalUsers           int32                  `json:"total_users"`
 	ActiveUsersToday     int32                  `json:"active_users_today"`
@@ -71,6 +240,8 @@ type AdminUser struct {
 	Gender             *string    `json:"gender,omitempty"`
 	IsVerified         bool       `json:"is_verified"`
 	IsBanned           bool       `json:"is_banned"`
+	SuspendedUntil     *time.Time `json:"suspended_until,omitempty"`
+	IsShadowBanned     bool       `json:"is_shadow_banned"`
 	Role               string     `json:"role"`
 	SubscriptionPlanID *string    `json:"subscription_plan_id,omitempty"`
 	CreatedAt          time.Time  `json:"created_at"`
@@ -88,19 +259,67 @@ type AdminUserFilters struct {
 }
 
 type AdminUserList struct {
-	Users   []*AdminUser `json:"users"`
-	Total   int32        `json:"total"`
-	Page    int32        `json:"page"`
-	PerPage int32        `json:"per_page"`
+	Users      []*AdminUser `json:"users"`
+	Total      int32        `json:"total"`
+	Page       int32        `json:"page"`
+	PerPage    int32        `json:"per_page"`
+	NextCursor *string      `json:"next_cursor,omitempty"`
 }
 
 type AdminVerification struct {
-	ID        string     `json:"id"`
-	UserID    string     `json:"user_id"`
-	User      *AdminUser `json:"user,omitempty"`
-	Media     []string   `json:"media"`
-	Status    string     `json:"status"`
-	CreatedAt time.Time  `json:"created_at"`
+	ID              string     `json:"id"`
+	UserID          string     `json:"user_id"`
+	User            *AdminUser `json:"user,omitempty"`
+	Media           []string   `json:"media"`
+	Status          string     `json:"status"`
+	Attempt         int32      `json:"attempt"`
+	RejectionReason *string    `json:"rejection_reason,omitempty"`
+	ReviewerID      *string    `json:"reviewer_id,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	FaceMatchScore  *float64   `json:"face_match_score,omitempty"`
+	FaceMatcher     *string    `json:"face_matcher,omitempty"`
+	ProfilePhotos   []string   `json:"profile_photos"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+type AdminVerificationFilters struct {
+	Status        *string    `json:"status,omitempty"`
+	UserID        *string    `json:"user_id,omitempty"`
+	Search        *string    `json:"search,omitempty"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+}
+
+type AdminVerificationList struct {
+	Verifications []*AdminVerification `json:"verifications"`
+	Total         int32                `json:"total"`
+	Page          int32                `json:"page"`
+	PerPage       int32                `json:"per_page"`
+	NextCursor    *string              `json:"next_cursor,omitempty"`
+}
+
+// A payment provider webhook as received.
+type AdminWebhookEvent struct {
+	ID          string     `json:"id"`
+	Provider    string     `json:"provider"`
+	EventID     string     `json:"event_id"`
+	EventType   string     `json:"event_type"`
+	Subject     string     `json:"subject"`
+	OccurredAt  time.Time  `json:"occurred_at"`
+	Status      string     `json:"status"`
+	Attempts    int32      `json:"attempts"`
+	LastError   *string    `json:"last_error,omitempty"`
+	Payload     string     `json:"payload"`
+	ReceivedAt  time.Time  `json:"received_at"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+}
+
+type AdminWebhookEventList struct {
+	Events     []*AdminWebhookEvent `json:"events"`
+	Total      int32                `json:"total"`
+	Page       int32                `json:"page"`
+	PerPage    int32                `json:"per_page"`
+	NextCursor *string              `json:"next_cursor,omitempty"`
 }
 
 // Return value after successful auth
@@ -140,12 +359,14 @@ type CommentsConnection struct {
 }
 
 type Connection struct {
-	Chat               *models.Chat  `json:"chat"`
-	Match              *models.Match `json:"match"`
-	LastMessage        string        `json:"last_message"`
-	UnreadMessages     int32         `json:"unread_messages"`
-	PercentageComplete float64       `json:"percentage_complete"`
-	ConnectionProfile  *UserPublic   `json:"connection_profile"`
+	Chat                *models.Chat  `json:"chat"`
+	Match               *models.Match `json:"match"`
+	LastMessage         string        `json:"last_message"`
+	LastMessageAt       *time.Time    `json:"last_message_at,omitempty"`
+	LastMessageSenderID *string       `json:"last_message_sender_id,omitempty"`
+	UnreadMessages      int32         `json:"unread_messages"`
+	PercentageComplete  float64       `json:"percentage_complete"`
+	ConnectionProfile   *UserPublic   `json:"connection_profile"`
 }
 
 type CreateCommentInput struct {
@@ -160,26 +381,39 @@ type CreatePostInput struct {
 }
 
 type CreateReportInput struct {
-	TargetID       string        `json:"target_id"`
-	Reason         string        `json:"reason"`
-	AdditionalInfo *string       `json:"additional_info,omitempty"`
-	Media          []*MediaInput `json:"media"`
+	TargetID       string            `json:"target_id"`
+	TargetType     *ReportTargetType `json:"target_type,omitempty"`
+	Category       *ReportCategory   `json:"category,omitempty"`
+	ChatID         *string           `json:"chat_id,omitempty"`
+	Reason         *string           `json:"reason,omitempty"`
+	AdditionalInfo *string           `json:"additional_info,omitempty"`
+	Media          []*MediaInput     `json:"media"`
 }
 
 type CreateUserInput struct {
-	Email       string        `json:"email"`
-	Password    string        `json:"password"`
-	FirstName   string        `json:"first_name"`
-	LastName    string        `json:"last_name"`
-	Dob         time.Time     `json:"dob"`
-	Gender      string        `json:"gender"`
-	Pfp         *string       `json:"pfp,omitempty"`
-	Bio         *string       `json:"bio,omitempty"`
-	Hobbies     []string      `json:"hobbies,omitempty"`
-	Interests   []string      `json:"interests,omitempty"`
-	UserPrompts []string      `json:"user_prompts,omitempty"`
-	Photos      []string      `json:"photos,omitempty"`
-	Address     *AddressInput `json:"address,omitempty"`
+	Email        string        `json:"email"`
+	Password     string        `json:"password"`
+	FirstName    string        `json:"first_name"`
+	LastName     string        `json:"last_name"`
+	Dob          time.Time     `json:"dob"`
+	Gender       string        `json:"gender"`
+	Pfp          *string       `json:"pfp,omitempty"`
+	Bio          *string       `json:"bio,omitempty"`
+	Hobbies      []string      `json:"hobbies,omitempty"`
+	Interests    []string      `json:"interests,omitempty"`
+	UserPrompts  []string      `json:"user_prompts,omitempty"`
+	Photos       []string      `json:"photos,omitempty"`
+	Address      *AddressInput `json:"address,omitempty"`
+	ReferralCode *string       `json:"referral_code,omitempty"`
+	DeviceID     *string       `json:"device_id,omitempty"`
+}
+
+type EnforcementInput struct {
+	UserID        string  `json:"user_id"`
+	Type          string  `json:"type"`
+	ReasonCode    string  `json:"reason_code"`
+	Note          *string `json:"note,omitempty"`
+	DurationHours *int32  `json:"duration_hours,omitempty"`
 }
 
 type ExtraMetadataInput struct {
@@ -203,11 +437,22 @@ type GenerateAIRepliesInput struct {
 	Tone            *string `json:"tone,omitempty"`
 }
 
+type ImpersonationSession struct {
+	SessionID string     `json:"session_id"`
+	Token     string     `json:"token"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	User      *AdminUser `json:"user"`
+}
+
 type MassNotificationInput struct {
-	Title   string   `json:"title"`
-	Body    string   `json:"body"`
-	Segment *string  `json:"segment,omitempty"`
-	UserIds []string `json:"user_ids,omitempty"`
+	Title             string                    `json:"title"`
+	Body              string                    `json:"body"`
+	Segment           *string                   `json:"segment,omitempty"`
+	SegmentFilters    *NotificationSegmentInput `json:"segment_filters,omitempty"`
+	UserIds           []string                  `json:"user_ids,omitempty"`
+	SendAt            *time.Time                `json:"send_at,omitempty"`
+	ThrottlePerMinute *int32                    `json:"throttle_per_minute,omitempty"`
+	Reason            *string                   `json:"reason,omitempty"`
 }
 
 type MassNotificationResult struct {
@@ -215,6 +460,7 @@ type MassNotificationResult struct {
 	SentCount   int32   `json:"sent_count"`
 	FailedCount int32   `json:"failed_count"`
 	Message     *string `json:"message,omitempty"`
+	CampaignID  *string `json:"campaign_id,omitempty"`
 }
 
 type MediaInput struct {
@@ -224,9 +470,80 @@ type MediaInput struct {
 	CreatedAt string    `json:"created_at"`
 }
 
+// A message matching a search, with a few messages of context on each side.
+// Pass anchor_id as around_id in the query_messages socket event to jump to it.
+type MessageSearchHit struct {
+	ChatID   string            `json:"chat_id"`
+	AnchorID string            `json:"anchor_id"`
+	Snippet  string            `json:"snippet"`
+	Message  *models.Message   `json:"message"`
+	Before   []*models.Message `json:"before"`
+	After    []*models.Message `json:"after"`
+}
+
+type ModerationStatus struct {
+	IsBanned       bool              `json:"is_banned"`
+	SuspendedUntil *time.Time        `json:"suspended_until,omitempty"`
+	ReasonCode     *string           `json:"reason_code,omitempty"`
+	Strikes        int32             `json:"strikes"`
+	StrikeLimit    int32             `json:"strike_limit"`
+	CanAppeal      bool              `json:"can_appeal"`
+	Appeal         *models.BanAppeal `json:"appeal,omitempty"`
+}
+
 type Mutation struct {
 }
 
+// Where one type of notification is delivered.
+type NotificationChannels struct {
+	Push  bool `json:"push"`
+	Email bool `json:"email"`
+	InApp bool `json:"in_app"`
+}
+
+type NotificationChannelsInput struct {
+	Push  bool `json:"push"`
+	Email bool `json:"email"`
+	InApp bool `json:"in_app"`
+}
+
+type NotificationEventSettings struct {
+	Event    string                `json:"event"`
+	Channels *NotificationChannels `json:"channels"`
+}
+
+type NotificationEventSettingsInput struct {
+	Event    string                     `json:"event"`
+	Channels *NotificationChannelsInput `json:"channels"`
+}
+
+type NotificationPage struct {
+	Notifications []*models.Notification `json:"notifications"`
+	NextCursor    *string                `json:"next_cursor,omitempty"`
+}
+
+type NotificationSegmentInput struct {
+	Preset           *string    `json:"preset,omitempty"`
+	PlanIds          []string   `json:"plan_ids,omitempty"`
+	ActiveWithinDays *int32     `json:"active_within_days,omitempty"`
+	InactiveForDays  *int32     `json:"inactive_for_days,omitempty"`
+	Verified         *bool      `json:"verified,omitempty"`
+	Genders          []string   `json:"genders,omitempty"`
+	Countries        []string   `json:"countries,omitempty"`
+	SignedUpAfter    *time.Time `json:"signed_up_after,omitempty"`
+	SignedUpBefore   *time.Time `json:"signed_up_before,omitempty"`
+}
+
+type NotificationSettings struct {
+	Events          []*NotificationEventSettings `json:"events"`
+	QuietHoursStart *string                      `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   *string                      `json:"quiet_hours_end,omitempty"`
+	Timezone        string                       `json:"timezone"`
+	// "daily" or "weekly". Emails about matches, superlikes and unlock requests go out
+	// right away; emails about everything else are collected into this digest.
+	DigestFrequency string `json:"digest_frequency"`
+}
+
 type PageInfo struct {
 	HasNextPage     bool    `json:"has_next_page"`
 	NextCursor      *string `json:"next_cursor,omitempty"`
@@ -244,6 +561,34 @@ type PersonalityTraitInput struct {
 	Value int32  `json:"value"`
 }
 
+type PlanChangeResult struct {
+	Subscription *models.UserSubscription `json:"subscription"`
+	Proration    *Proration               `json:"proration"`
+}
+
+// Fields of a subscription plan. Omitted fields are left unchanged. Variants share their
+// plan's features and limits, so they can't set them.
+type PlanInput struct {
+	Name             *string                    `json:"name,omitempty"`
+	Description      *string                    `json:"description,omitempty"`
+	PriceMonthly     *int32                     `json:"price_monthly,omitempty"`
+	PriceYearly      *int32                     `json:"price_yearly,omitempty"`
+	Features         *SubscriptionFeaturesInput `json:"features,omitempty"`
+	Limits           *SubscriptionLimitsInput   `json:"limits,omitempty"`
+	ProductIds       *PlanProductIdsInput       `json:"product_ids,omitempty"`
+	RevcatOfferingID *string                    `json:"revcat_offering_id,omitempty"`
+	SortOrder        *int32                     `json:"sort_order,omitempty"`
+	VariantWeight    *int32                     `json:"variant_weight,omitempty"`
+	IsActive         *bool                      `json:"is_active,omitempty"`
+}
+
+type PlanProductIdsInput struct {
+	DodoMonthly   string `json:"dodo_monthly"`
+	DodoYearly    string `json:"dodo_yearly"`
+	RevcatMonthly string `json:"revcat_monthly"`
+	RevcatYearly  string `json:"revcat_yearly"`
+}
+
 type PlanSubscriberCount struct {
 	PlanID   string `json:"plan_id"`
 	PlanName string `json:"plan_name"`
@@ -267,6 +612,29 @@ type PostsConnection struct {
 	TotalCount int32          `json:"total_count"`
 }
 
+// A new promo code. percent_off codes discount the user's next web checkout; plan_days
+// and trial codes give days of plan_id, and trial codes count as the user's free trial.
+type PromoCodeInput struct {
+	Code           string     `json:"code"`
+	Kind           string     `json:"kind"`
+	PlanID         *string    `json:"plan_id,omitempty"`
+	PercentOff     *int32     `json:"percent_off,omitempty"`
+	Days           *int32     `json:"days,omitempty"`
+	MaxRedemptions *int32     `json:"max_redemptions,omitempty"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
+
+// The cost of switching plans for the rest of the current period. Amounts are in cents.
+type Proration struct {
+	PlanID         string    `json:"plan_id"`
+	PreviousPlanID string    `json:"previous_plan_id"`
+	BillingPeriod  string    `json:"billing_period"`
+	Credit         int32     `json:"credit"`
+	Charge         int32     `json:"charge"`
+	AmountDue      int32     `json:"amount_due"`
+	PeriodEnd      time.Time `json:"period_end"`
+}
+
 type PushNotificationResult struct {
 	Success bool    `json:"success"`
 	Message *string `json:"message,omitempty"`
@@ -299,6 +667,20 @@ type RecommendedProfile struct {
 	Reason             *string     `json:"reason,omitempty"`
 }
 
+type RedeemCodeResult struct {
+	Code         *models.PromoCode        `json:"code"`
+	Subscription *models.UserSubscription `json:"subscription,omitempty"`
+}
+
+// The current user's referral link and how their invites are doing. Both sides get bonus
+// swipes and a boost once the invited user is verified.
+type ReferralInfo struct {
+	Code     string `json:"code"`
+	Link     string `json:"link"`
+	Pending  int32  `json:"pending"`
+	Rewarded int32  `json:"rewarded"`
+}
+
 type RegisterPushTokenInput struct {
 	Token    string  `json:"token"`
 	Platform string  `json:"platform"`
@@ -317,6 +699,24 @@ type StreakMilestone struct {
 	AchievedAt *time.Time `json:"achieved_at,omitempty"`
 }
 
+type SubscriptionFeaturesInput struct {
+	SeeWhoLiked      bool `json:"see_who_liked"`
+	PriorityMatching bool `json:"priority_matching"`
+	ProfileBoost     bool `json:"profile_boost"`
+	AdvancedFilters  bool `json:"advanced_filters"`
+	VerifiedPriority bool `json:"verified_priority"`
+	UnlimitedRewinds bool `json:"unlimited_rewinds"`
+	ReadReceipts     bool `json:"read_receipts"`
+	IncognitoMode    bool `json:"incognito_mode"`
+}
+
+type SubscriptionLimitsInput struct {
+	SwipesPerDay     int32 `json:"swipes_per_day"`
+	AiRepliesPerDay  int32 `json:"ai_replies_per_day"`
+	SuperlikesPerDay int32 `json:"superlikes_per_day"`
+	BoostsPerMonth   int32 `json:"boosts_per_month"`
+}
+
 type SwipeResponse struct {
 	Swipe *models.Swipe `json:"swipe"`
 	Match *models.Match `json:"match,omitempty"`
@@ -332,6 +732,17 @@ type UpdateCommentInput struct {
 	Content   string `json:"content"`
 }
 
+type UpdateNotificationSettingsInput struct {
+	// Only the event types being changed.
+	Events []*NotificationEventSettingsInput `json:"events,omitempty"`
+	// Quiet hours hold back pushes between start and end in the user's timezone.
+	// Send empty strings for both to turn them off.
+	QuietHoursStart *string `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   *string `json:"quiet_hours_end,omitempty"`
+	Timezone        *string `json:"timezone,omitempty"`
+	DigestFrequency *string `json:"digest_frequency,omitempty"`
+}
+
 type UpdatePostInput struct {
 	PostID  string        `json:"post_id"`
 	Content *string       `json:"content,omitempty"`
@@ -353,6 +764,7 @@ type UpdateUserInput struct {
 	IsVerified        *bool                    `json:"is_verified,omitempty"`
 	Address           *AddressInput            `json:"address,omitempty"`
 	Extra             *ExtraMetadataInput      `json:"extra,omitempty"`
+	PreferredLocale   *string                  `json:"preferred_locale,omitempty"`
 }
 
 type UserPublic struct {
@@ -454,6 +866,248 @@ func (e ActivityClass) MarshalJSON() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+type AdminMetric string
+
+const (
+	AdminMetricSignups          AdminMetric = "SIGNUPS"
+	AdminMetricDailyActiveUsers AdminMetric = "DAILY_ACTIVE_USERS"
+	AdminMetricSwipes           AdminMetric = "SWIPES"
+	AdminMetricMatchRate        AdminMetric = "MATCH_RATE"
+	AdminMetricMessagesPerMatch AdminMetric = "MESSAGES_PER_MATCH"
+	AdminMetricUnlockConversion AdminMetric = "UNLOCK_CONVERSION"
+	AdminMetricDateRate         AdminMetric = "DATE_RATE"
+	AdminMetricRetentionD1      AdminMetric = "RETENTION_D1"
+	AdminMetricRetentionD7      AdminMetric = "RETENTION_D7"
+	AdminMetricRetentionD30     AdminMetric = "RETENTION_D30"
+)
+
+var AllAdminMetric = []AdminMetric{
+	AdminMetricSignups,
+	AdminMetricDailyActiveUsers,
+	AdminMetricSwipes,
+	AdminMetricMatchRate,
+	AdminMetricMessagesPerMatch,
+	AdminMetricUnlockConversion,
+	AdminMetricDateRate,
+	AdminMetricRetentionD1,
+	AdminMetricRetentionD7,
+	AdminMetricRetentionD30,
+}
+
+func (e AdminMetric) IsValid() bool {
+	switch e {
+	case AdminMetricSignups, AdminMetricDailyActiveUsers, AdminMetricSwipes, AdminMetricMatchRate, AdminMetricMessagesPerMatch, AdminMetricUnlockConversion, AdminMetricDateRate, AdminMetricRetentionD1, AdminMetricRetentionD7, AdminMetricRetentionD30:
+		return true
+	}
+	return false
+}
+
+func (e AdminMetric) String() string {
+	return string(e)
+}
+
+func (e *AdminMetric) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AdminMetric(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AdminMetric", str)
+	}
+	return nil
+}
+
+func (e AdminMetric) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *AdminMetric) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e AdminMetric) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type AdminQueueSortField string
+
+const (
+	AdminQueueSortFieldCreatedAt AdminQueueSortField = "CREATED_AT"
+	AdminQueueSortFieldUpdatedAt AdminQueueSortField = "UPDATED_AT"
+)
+
+var AllAdminQueueSortField = []AdminQueueSortField{
+	AdminQueueSortFieldCreatedAt,
+	AdminQueueSortFieldUpdatedAt,
+}
+
+func (e AdminQueueSortField) IsValid() bool {
+	switch e {
+	case AdminQueueSortFieldCreatedAt, AdminQueueSortFieldUpdatedAt:
+		return true
+	}
+	return false
+}
+
+func (e AdminQueueSortField) String() string {
+	return string(e)
+}
+
+func (e *AdminQueueSortField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AdminQueueSortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AdminQueueSortField", str)
+	}
+	return nil
+}
+
+func (e AdminQueueSortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *AdminQueueSortField) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e AdminQueueSortField) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type AdminReportGroupSortField string
+
+const (
+	AdminReportGroupSortFieldPriority       AdminReportGroupSortField = "PRIORITY"
+	AdminReportGroupSortFieldLastReportedAt AdminReportGroupSortField = "LAST_REPORTED_AT"
+	AdminReportGroupSortFieldCreatedAt      AdminReportGroupSortField = "CREATED_AT"
+)
+
+var AllAdminReportGroupSortField = []AdminReportGroupSortField{
+	AdminReportGroupSortFieldPriority,
+	AdminReportGroupSortFieldLastReportedAt,
+	AdminReportGroupSortFieldCreatedAt,
+}
+
+func (e AdminReportGroupSortField) IsValid() bool {
+	switch e {
+	case AdminReportGroupSortFieldPriority, AdminReportGroupSortFieldLastReportedAt, AdminReportGroupSortFieldCreatedAt:
+		return true
+	}
+	return false
+}
+
+func (e AdminReportGroupSortField) String() string {
+	return string(e)
+}
+
+func (e *AdminReportGroupSortField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AdminReportGroupSortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AdminReportGroupSortField", str)
+	}
+	return nil
+}
+
+func (e AdminReportGroupSortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *AdminReportGroupSortField) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e AdminReportGroupSortField) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type AdminUserSortField string
+
+const (
+	AdminUserSortFieldCreatedAt AdminUserSortField = "CREATED_AT"
+	AdminUserSortFieldFirstName AdminUserSortField = "FIRST_NAME"
+	AdminUserSortFieldLastName  AdminUserSortField = "LAST_NAME"
+	AdminUserSortFieldEmail     AdminUserSortField = "EMAIL"
+)
+
+var AllAdminUserSortField = []AdminUserSortField{
+	AdminUserSortFieldCreatedAt,
+	AdminUserSortFieldFirstName,
+	AdminUserSortFieldLastName,
+	AdminUserSortFieldEmail,
+}
+
+func (e AdminUserSortField) IsValid() bool {
+	switch e {
+	case AdminUserSortFieldCreatedAt, AdminUserSortFieldFirstName, AdminUserSortFieldLastName, AdminUserSortFieldEmail:
+		return true
+	}
+	return false
+}
+
+func (e AdminUserSortField) String() string {
+	return string(e)
+}
+
+func (e *AdminUserSortField) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AdminUserSortField(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AdminUserSortField", str)
+	}
+	return nil
+}
+
+func (e AdminUserSortField) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *AdminUserSortField) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e AdminUserSortField) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
 type CommentSortField string
 
 const (
@@ -568,6 +1222,63 @@ func (e MediaType) MarshalJSON() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+type MetricGranularity string
+
+const (
+	MetricGranularityDay   MetricGranularity = "DAY"
+	MetricGranularityWeek  MetricGranularity = "WEEK"
+	MetricGranularityMonth MetricGranularity = "MONTH"
+)
+
+var AllMetricGranularity = []MetricGranularity{
+	MetricGranularityDay,
+	MetricGranularityWeek,
+	MetricGranularityMonth,
+}
+
+func (e MetricGranularity) IsValid() bool {
+	switch e {
+	case MetricGranularityDay, MetricGranularityWeek, MetricGranularityMonth:
+		return true
+	}
+	return false
+}
+
+func (e MetricGranularity) String() string {
+	return string(e)
+}
+
+func (e *MetricGranularity) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = MetricGranularity(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid MetricGranularity", str)
+	}
+	return nil
+}
+
+func (e MetricGranularity) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *MetricGranularity) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e MetricGranularity) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
 type PostSortField string
 
 const (
@@ -627,6 +1338,132 @@ func (e PostSortField) MarshalJSON() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+type ReportCategory string
+
+const (
+	ReportCategorySpam        ReportCategory = "SPAM"
+	ReportCategoryHarassment  ReportCategory = "HARASSMENT"
+	ReportCategoryHateSpeech  ReportCategory = "HATE_SPEECH"
+	ReportCategoryNudity      ReportCategory = "NUDITY"
+	ReportCategoryScam        ReportCategory = "SCAM"
+	ReportCategoryFakeProfile ReportCategory = "FAKE_PROFILE"
+	ReportCategoryUnderage    ReportCategory = "UNDERAGE"
+	ReportCategoryViolence    ReportCategory = "VIOLENCE"
+	ReportCategoryOther       ReportCategory = "OTHER"
+)
+
+var AllReportCategory = []ReportCategory{
+	ReportCategorySpam,
+	ReportCategoryHarassment,
+	ReportCategoryHateSpeech,
+	ReportCategoryNudity,
+	ReportCategoryScam,
+	ReportCategoryFakeProfile,
+	ReportCategoryUnderage,
+	ReportCategoryViolence,
+	ReportCategoryOther,
+}
+
+func (e ReportCategory) IsValid() bool {
+	switch e {
+	case ReportCategorySpam, ReportCategoryHarassment, ReportCategoryHateSpeech, ReportCategoryNudity, ReportCategoryScam, ReportCategoryFakeProfile, ReportCategoryUnderage, ReportCategoryViolence, ReportCategoryOther:
+		return true
+	}
+	return false
+}
+
+func (e ReportCategory) String() string {
+	return string(e)
+}
+
+func (e *ReportCategory) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReportCategory(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReportCategory", str)
+	}
+	return nil
+}
+
+func (e ReportCategory) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ReportCategory) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ReportCategory) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
+type ReportTargetType string
+
+const (
+	ReportTargetTypeUser    ReportTargetType = "USER"
+	ReportTargetTypePost    ReportTargetType = "POST"
+	ReportTargetTypeComment ReportTargetType = "COMMENT"
+)
+
+var AllReportTargetType = []ReportTargetType{
+	ReportTargetTypeUser,
+	ReportTargetTypePost,
+	ReportTargetTypeComment,
+}
+
+func (e ReportTargetType) IsValid() bool {
+	switch e {
+	case ReportTargetTypeUser, ReportTargetTypePost, ReportTargetTypeComment:
+		return true
+	}
+	return false
+}
+
+func (e ReportTargetType) String() string {
+	return string(e)
+}
+
+func (e *ReportTargetType) UnmarshalGQL(v any) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReportTargetType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReportTargetType", str)
+	}
+	return nil
+}
+
+func (e ReportTargetType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+func (e *ReportTargetType) UnmarshalJSON(b []byte) error {
+	s, err := strconv.Unquote(string(b))
+	if err != nil {
+		return err
+	}
+	return e.UnmarshalGQL(s)
+}
+
+func (e ReportTargetType) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	e.MarshalGQL(&buf)
+	return buf.Bytes(), nil
+}
+
 type SortOrder string
 
 const (
@@ -0,0 +1,22 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver
+// implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.84
+
+import (
+	"spark/internal/graph/model"
+	"spark/internal/models"
+	"context"
+)
+
+// AppealBan is the resolver for the appealBan field.
+func (r *mutationResolver) AppealBan(ctx context.Context, message string) (*models.BanAppeal, error) {
+	return r.ModerationResolver.AppealBan(ctx, message)
+}
+
+// MyModerationStatus is the resolver for the myModerationStatus field.
+func (r *queryResolver) MyModerationStatus(ctx context.Context) (*model.ModerationStatus, error) {
+	return r.ModerationResolver.MyModerationStatus(ctx)
+}
@@ -0,0 +1,90 @@
+package moderation
+
+import (
+	"spark/internal/anal"
+	"spark/internal/graph/directives"
+	"spark/internal/graph/model"
+	"spark/internal/helpers/moderation"
+	"spark/internal/models"
+	"context"
+	"errors"
+	"fmt"
+)
+
+type Resolver struct {
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{}
+}
+
+func (r *Resolver) MyModerationStatus(ctx context.Context) (*model.ModerationStatus, error) {
+	claims, ae, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		ae.SendRequestError(anal.UNAUTHORIZED_401, err)
+		return nil, fmt.Errorf("unauthorized: %w", err)
+	}
+
+	status, err := moderation.GetStatus(claims.UserID)
+	if err != nil {
+		ae.SendRequestError(anal.SERVER_ERROR_500, err)
+		return nil, err
+	}
+
+	result := &model.ModerationStatus{
+		IsBanned:    status.Banned,
+		Strikes:     int32(status.Strikes),
+		StrikeLimit: moderation.StrikeLimit,
+	}
+	if status.Suspended() {
+		result.SuspendedUntil = status.SuspendedUntil
+	}
+	if !status.Restricted() {
+		return result, nil
+	}
+
+	restriction, err := moderation.ActiveRestriction(claims.UserID)
+	if err != nil {
+		ae.SendRequestError(anal.SERVER_ERROR_500, err)
+		return nil, err
+	}
+	if restriction == nil {
+		// Banned before enforcements were recorded, there's nothing to attach an appeal to
+		return result, nil
+	}
+
+	result.ReasonCode = &restriction.ReasonCode
+	appeal, err := moderation.GetAppealForEnforcement(restriction.Id)
+	if err != nil {
+		ae.SendRequestError(anal.SERVER_ERROR_500, err)
+		return nil, err
+	}
+	result.Appeal = appeal
+	result.CanAppeal = appeal == nil
+
+	return result, nil
+}
+
+func (r *Resolver) AppealBan(ctx context.Context, message string) (*models.BanAppeal, error) {
+	claims, ae, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		ae.SendRequestError(anal.UNAUTHORIZED_401, err)
+		return nil, fmt.Errorf("unauthorized: %w", err)
+	}
+
+	appeal, err := moderation.Appeal(claims.UserID, message)
+	if err != nil {
+		switch {
+		case errors.Is(err, moderation.ErrNothingToAppeal),
+			errors.Is(err, moderation.ErrAlreadyAppealed),
+			errors.Is(err, moderation.ErrEmptyAppeal),
+			errors.Is(err, moderation.ErrAppealTooLong):
+			ae.SendRequestError(anal.BAD_REQUEST_400, err)
+		default:
+			ae.SendRequestError(anal.SERVER_ERROR_500, err)
+		}
+		return nil, err
+	}
+
+	return appeal, nil
+}
@@ -8,7 +8,10 @@ package graph
 import (
 	"spark/internal/graph/directives"
 	"spark/internal/graph/model"
+	"spark/internal/helpers/impersonation"
+	"spark/internal/helpers/notifications"
 	"spark/internal/helpers/pushnotify"
+	"spark/internal/models"
 	"context"
 	"fmt"
 )
@@ -64,6 +67,141 @@ func (r *mutationResolver) RemovePushToken(ctx context.Context, token string) (*
 	}, nil
 }
 
+// UpdateNotificationSettings is the resolver for the updateNotificationSettings field.
+func (r *mutationResolver) UpdateNotificationSettings(ctx context.Context, input model.UpdateNotificationSettingsInput) (*model.NotificationSettings, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	update := notifications.SettingsUpdate{
+		QuietHoursStart: input.QuietHoursStart,
+		QuietHoursEnd:   input.QuietHoursEnd,
+		Timezone:        input.Timezone,
+		DigestFrequency: input.DigestFrequency,
+	}
+	if len(input.Events) > 0 {
+		update.Events = make(map[string]models.NotificationChannels, len(input.Events))
+		for _, e := range input.Events {
+			update.Events[e.Event] = models.NotificationChannels{
+				Push:  e.Channels.Push,
+				Email: e.Channels.Email,
+				InApp: e.Channels.InApp,
+			}
+		}
+	}
+
+	settings, err := notifications.UpdateSettings(claims.UserID, update)
+	if err != nil {
+		return nil, err
+	}
+	return toNotificationSettings(settings), nil
+}
+
+// MarkNotificationsRead is the resolver for the markNotificationsRead field.
+func (r *mutationResolver) MarkNotificationsRead(ctx context.Context, ids []string) (int32, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unauthorized")
+	}
+
+	n, err := notifications.MarkRead(claims.UserID, ids)
+	if err != nil {
+		return 0, err
+	}
+	return int32(n), nil
+}
+
+// Read is the resolver for the read field.
+func (r *notificationResolver) Read(ctx context.Context, obj *models.Notification) (bool, error) {
+	return obj.ReadAt != nil, nil
+}
+
+// NotificationSettings is the resolver for the notificationSettings field.
+func (r *queryResolver) NotificationSettings(ctx context.Context) (*model.NotificationSettings, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	settings, err := notifications.GetSettings(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return toNotificationSettings(settings), nil
+}
+
+// Notifications is the resolver for the notifications field.
+func (r *queryResolver) Notifications(ctx context.Context, cursor *string, limit *int32) (*model.NotificationPage, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	after, n := "", 0
+	if cursor != nil {
+		after = *cursor
+	}
+	if limit != nil {
+		n = int(*limit)
+	}
+	list, next, err := notifications.ListInbox(claims.UserID, after, n)
+	if err != nil {
+		return nil, err
+	}
+	// Message entries carry a preview of the chat
+	for _, item := range list {
+		if chatID := notifications.ChatIDFromLink(item.Link); chatID != "" && !impersonation.CanReadChat(claims, chatID) {
+			item.Body = impersonation.HiddenContent
+		}
+	}
+	page := &model.NotificationPage{Notifications: list}
+	if next != "" {
+		page.NextCursor = strPtr(next)
+	}
+	return page, nil
+}
+
+// UnreadNotificationCount is the resolver for the unreadNotificationCount field.
+func (r *queryResolver) UnreadNotificationCount(ctx context.Context) (int32, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("unauthorized")
+	}
+
+	n, err := notifications.UnreadCount(claims.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return int32(n), nil
+}
+
+// Notification returns NotificationResolver implementation.
+func (r *Resolver) Notification() NotificationResolver { return &notificationResolver{r} }
+
+type notificationResolver struct{ *Resolver }
+
+// toNotificationSettings lists settings in the order the app shows them
+func toNotificationSettings(s *models.NotificationSettings) *model.NotificationSettings {
+	out := &model.NotificationSettings{Timezone: s.Timezone, DigestFrequency: s.DigestFrequency}
+	for _, event := range notifications.EventTypes {
+		channels := s.Events[event]
+		out.Events = append(out.Events, &model.NotificationEventSettings{
+			Event: event,
+			Channels: &model.NotificationChannels{
+				Push:  channels.Push,
+				Email: channels.Email,
+				InApp: channels.InApp,
+			},
+		})
+	}
+	if s.QuietHoursStart != "" {
+		out.QuietHoursStart = strPtr(s.QuietHoursStart)
+		out.QuietHoursEnd = strPtr(s.QuietHoursEnd)
+	}
+	return out
+}
+
 // Helper function for string pointers
 func strPtr(s string) *string {
 	return &s
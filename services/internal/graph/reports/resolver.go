@@ -4,13 +4,15 @@ import (
 	"spark/internal/anal"
 	"spark/internal/graph/directives"
 	"spark/internal/graph/model"
+	"spark/internal/helpers/moderation"
+	"spark/internal/helpers/reporting"
 	"spark/internal/models"
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/MelloB1989/karma/utils"
-	"github.com/MelloB1989/karma/v2/orm"
 )
 
 type Resolver struct {
@@ -28,36 +30,46 @@ func (r *Resolver) CreateReport(ctx context.Context, input model.CreateReportInp
 	}
 
 	now := time.Now()
-
-	reportORM := orm.Load(&models.Report{})
-	defer reportORM.Close()
-
-	report := &models.Report{
-		Id:        utils.GenerateID(10),
-		UserId:    claims.UserID,
-		TargetId:  input.TargetID,
-		CreatedAt: now,
-		UpdatedAt: now,
-		Reason:    input.Reason,
+	in := reporting.Input{
+		ReporterId: claims.UserID,
+		TargetId:   input.TargetID,
+		TargetType: reporting.TargetUser,
+		Category:   moderation.ReasonOther,
+	}
+	if input.TargetType != nil {
+		in.TargetType = strings.ToLower(string(*input.TargetType))
+	}
+	if input.Reason != nil {
+		in.Reason = *input.Reason
+		// Older clients send the category as the reason
+		if reporting.IsValidCategory(in.Reason) {
+			in.Category = in.Reason
+		}
+	}
+	if input.Category != nil {
+		in.Category = strings.ToLower(string(*input.Category))
+	}
+	if input.ChatID != nil {
+		in.ChatId = *input.ChatID
 	}
-
 	if input.AdditionalInfo != nil {
-		report.AdditionalInfo = *input.AdditionalInfo
+		in.AdditionalInfo = *input.AdditionalInfo
 	}
-	if len(input.Media) > 0 {
-		for _, media := range input.Media {
-			report.Media = append(report.Media, models.Media{
-				Id:        utils.GenerateID(10),
-				CreatedAt: now,
-				Type:      string(media.Type),
-				Url:       media.URL,
-			})
+	for _, media := range input.Media {
+		if media == nil {
+			continue
 		}
+		in.Media = append(in.Media, models.Media{
+			Id:        utils.GenerateID(10),
+			CreatedAt: now,
+			Type:      string(media.Type),
+			Url:       media.URL,
+		})
 	}
 
-	err = reportORM.Insert(report)
+	report, err := reporting.File(in)
 	if err != nil {
-		ae.SendRequestError(anal.SERVER_ERROR_500, err)
+		ae.SendRequestError(anal.BAD_REQUEST_400, err)
 		return nil, fmt.Errorf("failed to create report: %w", err)
 	}
 
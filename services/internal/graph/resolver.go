@@ -4,6 +4,7 @@ import (
 	blockedusers "spark/internal/graph/blocked_users"
 	"spark/internal/graph/chats"
 	"spark/internal/graph/community"
+	"spark/internal/graph/moderation"
 	profileactivities "spark/internal/graph/profile_activities"
 	"spark/internal/graph/reports"
 	"spark/internal/graph/swipes"
@@ -20,6 +21,7 @@ type Resolver struct {
 	ReportResolver          *reports.Resolver
 	VerificationResolver    *verifications.Resolver
 	BlockedUsersResolver    *blockedusers.Resolver
+	ModerationResolver      *moderation.Resolver
 }
 
 func NewResolver() *Resolver {
@@ -32,5 +34,6 @@ func NewResolver() *Resolver {
 		ReportResolver:          reports.NewResolver(),
 		VerificationResolver:    verifications.NewResolver(),
 		BlockedUsersResolver:    blockedusers.NewResolver(),
+		ModerationResolver:      moderation.NewResolver(),
 	}
 }
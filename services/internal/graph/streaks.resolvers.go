@@ -9,6 +9,7 @@ import (
 	"spark/internal/graph/directives"
 	"spark/internal/graph/model"
 	"spark/internal/helpers/streaks"
+	"spark/internal/helpers/users"
 	"spark/internal/models"
 	"context"
 	"fmt"
@@ -87,7 +88,7 @@ func (r *queryResolver) MyStreakStats(ctx context.Context) (*model.UserStreakSta
 	}
 
 	// Get milestone info for the longest streak
-	milestoneInfos := streaks.GetMilestoneInfo(longestEver)
+	milestoneInfos := streaks.GetMilestoneInfo(users.Locale(claims.UserID), longestEver)
 	currentMilestones := make([]*model.StreakMilestone, 0)
 	for _, mi := range milestoneInfos {
 		if mi.Achieved {
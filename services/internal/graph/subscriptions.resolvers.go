@@ -8,30 +8,46 @@ package graph
 import (
 	"spark/internal/graph/directives"
 	"spark/internal/graph/model"
+	"spark/internal/helpers/payments"
+	"spark/internal/helpers/promotions"
 	"spark/internal/helpers/subscriptions"
+	"spark/internal/helpers/users"
 	"spark/internal/models"
 	"context"
+	"errors"
 	"fmt"
 	"time"
 )
 
 // CreateCheckoutSession is the resolver for the createCheckoutSession field.
-func (r *mutationResolver) CreateCheckoutSession(ctx context.Context, planID string, billingPeriod string) (*model.CheckoutSession, error) {
+func (r *mutationResolver) CreateCheckoutSession(ctx context.Context, planID string, billingPeriod string, platform *string, returnURL *string) (*model.CheckoutSession, error) {
 	claims, _, err := directives.GetAuthClaims(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("unauthorized")
 	}
 
 	// Get the plan
-	plan, err := subscriptions.GetPlan(planID)
-	if err != nil {
+	if _, err := subscriptions.GetPlan(planID); err != nil {
 		return nil, fmt.Errorf("plan not found: %w", err)
 	}
 
-	// TODO: Integrate with DodoPayments or RevenueCat to create actual checkout session
-	// For now, return a placeholder that frontend will handle with RevenueCat SDK
-	_ = plan
+	if platform != nil && *platform == "web" {
+		user, err := users.GetUserByID(claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+		checkout, err := payments.StartCheckout(ctx, user, planID, billingPeriod, derefString(returnURL))
+		if err != nil {
+			return nil, err
+		}
+		return &model.CheckoutSession{
+			CheckoutURL: checkout.URL,
+			SessionID:   checkout.SessionId,
+			Provider:    checkout.Provider,
+		}, nil
+	}
 
+	// Apps buy through the RevenueCat SDK, which this URL hands the purchase to
 	return &model.CheckoutSession{
 		CheckoutURL: fmt.Sprintf("revenuecat://purchase?plan=%s&period=%s&user=%s", planID, billingPeriod, claims.UserID),
 		SessionID:   fmt.Sprintf("session_%s_%d", claims.UserID, time.Now().Unix()),
@@ -46,7 +62,7 @@ func (r *mutationResolver) CancelSubscription(ctx context.Context) (bool, error)
 		return false, fmt.Errorf("unauthorized")
 	}
 
-	if err := subscriptions.CancelSubscription(claims.UserID); err != nil {
+	if err := payments.Cancel(ctx, claims.UserID); err != nil {
 		return false, err
 	}
 
@@ -60,7 +76,7 @@ func (r *mutationResolver) ReactivateSubscription(ctx context.Context) (bool, er
 		return false, fmt.Errorf("unauthorized")
 	}
 
-	if err := subscriptions.ReactivateSubscription(claims.UserID); err != nil {
+	if err := payments.Reactivate(ctx, claims.UserID); err != nil {
 		return false, err
 	}
 
@@ -74,9 +90,77 @@ func (r *mutationResolver) SyncSubscriptionStatus(ctx context.Context) (*model.U
 		return nil, fmt.Errorf("unauthorized")
 	}
 
+	if err := payments.Sync(ctx, claims.UserID); err != nil {
+		return nil, err
+	}
 	return getSubscriptionStatus(claims.UserID)
 }
 
+// ChangeSubscriptionPlan is the resolver for the changeSubscriptionPlan field.
+func (r *mutationResolver) ChangeSubscriptionPlan(ctx context.Context, planID string) (*model.PlanChangeResult, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	sub, proration, err := payments.ChangePlan(ctx, claims.UserID, planID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.PlanChangeResult{
+		Subscription: sub,
+		Proration:    prorationToModel(proration),
+	}, nil
+}
+
+// PauseSubscription is the resolver for the pauseSubscription field.
+func (r *mutationResolver) PauseSubscription(ctx context.Context, resumeAt *time.Time) (*models.UserSubscription, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	return payments.Pause(ctx, claims.UserID, resumeAt)
+}
+
+// ResumeSubscription is the resolver for the resumeSubscription field.
+func (r *mutationResolver) ResumeSubscription(ctx context.Context) (*models.UserSubscription, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	return payments.Resume(ctx, claims.UserID)
+}
+
+// RedeemCode is the resolver for the redeemCode field.
+func (r *mutationResolver) RedeemCode(ctx context.Context, code string, deviceID *string) (*model.RedeemCodeResult, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	redemption, err := promotions.RedeemCode(claims.UserID, code, derefString(deviceID))
+	if err != nil {
+		return nil, err
+	}
+	return &model.RedeemCodeResult{
+		Code:         redemption.Code,
+		Subscription: redemption.Subscription,
+	}, nil
+}
+
+// StartFreeTrial is the resolver for the startFreeTrial field.
+func (r *mutationResolver) StartFreeTrial(ctx context.Context, planID string, deviceID *string) (*models.UserSubscription, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	return promotions.StartTrial(claims.UserID, planID, derefString(deviceID))
+}
+
 // SubscriptionPlans is the resolver for the subscriptionPlans field.
 func (r *queryResolver) SubscriptionPlans(ctx context.Context) ([]*models.SubscriptionPlan, error) {
 	plans, err := subscriptions.GetAllPlans()
@@ -84,9 +168,23 @@ func (r *queryResolver) SubscriptionPlans(ctx context.Context) ([]*models.Subscr
 		return nil, err
 	}
 
-	// If no plans in DB, return default plans
-	if len(plans) == 0 {
-		return getDefaultPlans(), nil
+	result := make([]*models.SubscriptionPlan, len(plans))
+	for i := range plans {
+		result[i] = &plans[i]
+	}
+	return result, nil
+}
+
+// PlanOffers is the resolver for the planOffers field.
+func (r *queryResolver) PlanOffers(ctx context.Context) ([]*models.SubscriptionPlan, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	plans, err := subscriptions.PlansForUser(claims.UserID)
+	if err != nil {
+		return nil, err
 	}
 
 	result := make([]*models.SubscriptionPlan, len(plans))
@@ -131,6 +229,107 @@ func (r *queryResolver) CanPerformAction(ctx context.Context, action string) (bo
 	}
 }
 
+// BillingPortalURL is the resolver for the billingPortalUrl field.
+func (r *queryResolver) BillingPortalURL(ctx context.Context) (string, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unauthorized")
+	}
+
+	return payments.PortalURL(ctx, claims.UserID)
+}
+
+// PreviewPlanChange is the resolver for the previewPlanChange field.
+func (r *queryResolver) PreviewPlanChange(ctx context.Context, planID string) (*model.Proration, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	proration, err := subscriptions.PreviewPlanChange(claims.UserID, planID)
+	if err != nil {
+		return nil, err
+	}
+	return prorationToModel(proration), nil
+}
+
+// MyBillingHistory is the resolver for the myBillingHistory field.
+func (r *queryResolver) MyBillingHistory(ctx context.Context, limit *int32) ([]*models.BillingEvent, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	n := 0
+	if limit != nil {
+		n = int(*limit)
+	}
+	return subscriptions.History(claims.UserID, n)
+}
+
+// MyCredits is the resolver for the myCredits field.
+func (r *queryResolver) MyCredits(ctx context.Context) ([]*models.Credit, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	return subscriptions.ActiveCredits(claims.UserID)
+}
+
+// MyReferral is the resolver for the myReferral field.
+func (r *queryResolver) MyReferral(ctx context.Context) (*model.ReferralInfo, error) {
+	claims, _, err := directives.GetAuthClaims(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unauthorized")
+	}
+
+	code, err := promotions.ReferralCode(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := promotions.GetReferralStats(claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ReferralInfo{
+		Code:     code,
+		Link:     promotions.ReferralLink(code),
+		Pending:  int32(stats.Pending),
+		Rewarded: int32(stats.Rewarded),
+	}, nil
+}
+
+// Amount is the resolver for the amount field.
+func (r *billingEventResolver) Amount(ctx context.Context, obj *models.BillingEvent) (int32, error) {
+	return int32(obj.Amount), nil
+}
+
+// Amount is the resolver for the amount field.
+func (r *limitCreditResolver) Amount(ctx context.Context, obj *models.Credit) (int32, error) {
+	return int32(obj.Amount), nil
+}
+
+// PercentOff is the resolver for the percent_off field.
+func (r *promoCodeResolver) PercentOff(ctx context.Context, obj *models.PromoCode) (int32, error) {
+	return int32(obj.PercentOff), nil
+}
+
+// Days is the resolver for the days field.
+func (r *promoCodeResolver) Days(ctx context.Context, obj *models.PromoCode) (int32, error) {
+	return int32(obj.Days), nil
+}
+
+// MaxRedemptions is the resolver for the max_redemptions field.
+func (r *promoCodeResolver) MaxRedemptions(ctx context.Context, obj *models.PromoCode) (int32, error) {
+	return int32(obj.MaxRedemptions), nil
+}
+
+// Redemptions is the resolver for the redemptions field.
+func (r *promoCodeResolver) Redemptions(ctx context.Context, obj *models.PromoCode) (int32, error) {
+	return int32(obj.Redemptions), nil
+}
+
 // SwipesPerDay is the resolver for the swipes_per_day field.
 func (r *subscriptionLimitsResolver) SwipesPerDay(ctx context.Context, obj *models.SubscriptionLimits) (int32, error) {
 	return int32(obj.SwipesPerDay), nil
@@ -166,15 +365,32 @@ func (r *subscriptionPlanResolver) SortOrder(ctx context.Context, obj *models.Su
 	return int32(obj.SortOrder), nil
 }
 
+// VariantWeight is the resolver for the variant_weight field.
+func (r *subscriptionPlanResolver) VariantWeight(ctx context.Context, obj *models.SubscriptionPlan) (int32, error) {
+	return int32(obj.VariantWeight), nil
+}
+
 // Plan is the resolver for the plan field.
 func (r *userSubscriptionResolver) Plan(ctx context.Context, obj *models.UserSubscription) (*models.SubscriptionPlan, error) {
 	plan, err := subscriptions.GetPlan(obj.PlanId)
+	if errors.Is(err, subscriptions.ErrUnknownPlan) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 	return plan, nil
 }
 
+// BillingEvent returns BillingEventResolver implementation.
+func (r *Resolver) BillingEvent() BillingEventResolver { return &billingEventResolver{r} }
+
+// LimitCredit returns LimitCreditResolver implementation.
+func (r *Resolver) LimitCredit() LimitCreditResolver { return &limitCreditResolver{r} }
+
+// PromoCode returns PromoCodeResolver implementation.
+func (r *Resolver) PromoCode() PromoCodeResolver { return &promoCodeResolver{r} }
+
 // SubscriptionLimits returns SubscriptionLimitsResolver implementation.
 func (r *Resolver) SubscriptionLimits() SubscriptionLimitsResolver {
 	return &subscriptionLimitsResolver{r}
@@ -186,6 +402,9 @@ func (r *Resolver) SubscriptionPlan() SubscriptionPlanResolver { return &subscri
 // UserSubscription returns UserSubscriptionResolver implementation.
 func (r *Resolver) UserSubscription() UserSubscriptionResolver { return &userSubscriptionResolver{r} }
 
+type billingEventResolver struct{ *Resolver }
+type limitCreditResolver struct{ *Resolver }
+type promoCodeResolver struct{ *Resolver }
 type subscriptionLimitsResolver struct{ *Resolver }
 type subscriptionPlanResolver struct{ *Resolver }
 type userSubscriptionResolver struct{ *Resolver }
@@ -193,14 +412,15 @@ type userSubscriptionResolver struct{ *Resolver }
 // Helper functions
 
 func getSubscriptionStatus(userID string) (*model.UserSubscriptionStatus, error) {
-	planID := subscriptions.GetUserPlanID(userID)
-	plan, err := subscriptions.GetPlan(planID)
-	if err != nil {
-		return nil, err
-	}
+	plan := subscriptions.GetUserPlan(userID)
+	planID := plan.Id
 
 	sub, _ := subscriptions.GetUserSubscription(userID)
 	isSubscribed := sub != nil && sub.Status == "active"
+	if sub == nil {
+		// Show a paused subscription so the app can offer to resume it
+		sub, _ = subscriptions.GetPausedSubscription(userID)
+	}
 
 	limits := subscriptions.GetUserLimits(userID)
 	features := subscriptions.GetUserFeatures(userID)
@@ -221,56 +441,14 @@ func getSubscriptionStatus(userID string) (*model.UserSubscriptionStatus, error)
 	}, nil
 }
 
-func getDefaultPlans() []*models.SubscriptionPlan {
-	now := time.Now()
-	return []*models.SubscriptionPlan{
-		{
-			Id:           "free",
-			Name:         "Free",
-			Description:  "Get started with basic features",
-			PriceMonthly: 0,
-			PriceYearly:  0,
-			Features:     subscriptions.PlanFeatures["free"],
-			Limits:       subscriptions.PlanLimits["free"],
-			IsActive:     true,
-			SortOrder:    0,
-			CreatedAt:    now,
-		},
-		{
-			Id:           "plus",
-			Name:         "Plus",
-			Description:  "See who liked you and more",
-			PriceMonthly: 999,
-			PriceYearly:  7999,
-			Features:     subscriptions.PlanFeatures["plus"],
-			Limits:       subscriptions.PlanLimits["plus"],
-			IsActive:     true,
-			SortOrder:    1,
-			CreatedAt:    now,
-		},
-		{
-			Id:           "pro",
-			Name:         "Pro",
-			Description:  "Priority matching and unlimited AI",
-			PriceMonthly: 1999,
-			PriceYearly:  15999,
-			Features:     subscriptions.PlanFeatures["pro"],
-			Limits:       subscriptions.PlanLimits["pro"],
-			IsActive:     true,
-			SortOrder:    2,
-			CreatedAt:    now,
-		},
-		{
-			Id:           "elite",
-			Name:         "Elite",
-			Description:  "All features unlocked",
-			PriceMonthly: 2999,
-			PriceYearly:  23999,
-			Features:     subscriptions.PlanFeatures["elite"],
-			Limits:       subscriptions.PlanLimits["elite"],
-			IsActive:     true,
-			SortOrder:    3,
-			CreatedAt:    now,
-		},
+func prorationToModel(p *subscriptions.Proration) *model.Proration {
+	return &model.Proration{
+		PlanID:         p.PlanId,
+		PreviousPlanID: p.PreviousPlanId,
+		BillingPeriod:  p.BillingPeriod,
+		Credit:         int32(p.Credit),
+		Charge:         int32(p.Charge),
+		AmountDue:      int32(p.AmountDue),
+		PeriodEnd:      p.PeriodEnd,
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"spark/internal/graph/directives"
 	"spark/internal/graph/model"
 	"spark/internal/graph/shared"
+	"spark/internal/helpers/moderation"
 	"spark/internal/helpers/notifications"
 	"spark/internal/models"
 	"context"
@@ -135,6 +136,8 @@ func (r *Resolver) Swipe(ctx context.Context, targetID string, actionType models
 			log.Printf("[DEBUG] Match created: %+v", match)
 			// Send match email notifications to both users
 			notifications.SendMatchNotification(claims.UserID, targetID)
+		} else if actionType == models.LIKE {
+			notifications.SendLikeNotification(targetID, claims.UserID)
 		}
 	}
 
@@ -252,6 +255,7 @@ func (r *Resolver) Recommendations(ctx context.Context, cursor *string, limit *i
 		"NOT EXISTS (SELECT 1 FROM swipes s WHERE s.user_id = $1 AND s.target_id = u.id)",
 		"NOT EXISTS (SELECT 1 FROM matches m WHERE (m.she_id = $1 AND m.he_id = u.id) OR (m.she_id = u.id AND m.he_id = $1))",
 		"NOT EXISTS (SELECT 1 FROM blocked_users b WHERE (b.user_id = $1 AND b.blocked_user_id = u.id) OR (b.user_id = u.id AND b.blocked_user_id = $1))",
+		"NOT " + moderation.HiddenUserSQL("u.id"),
 	}
 	args := []any{claims.UserID}
 	argIndex := 2 // $1 is already used for claims.UserID
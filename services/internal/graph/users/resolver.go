@@ -8,7 +8,9 @@ import (
 	"spark/internal/blurer"
 	"spark/internal/graph/directives"
 	"spark/internal/graph/model"
+	"spark/internal/helpers/promotions"
 	"spark/internal/helpers/users"
+	"spark/internal/i18n"
 	"spark/internal/mailer"
 	"spark/internal/models"
 	"context"
@@ -62,6 +64,17 @@ func (r *Resolver) CreateUser(ctx context.Context, input model.CreateUserInput)
 			analyticsClient := anal.CreateAnalytics(payload.User.Id)
 			analyticsClient.SendEvent(anal.USER_SIGNUP)
 		}()
+
+		// A bad referral code shouldn't fail the signup
+		if input.ReferralCode != nil && strings.TrimSpace(*input.ReferralCode) != "" {
+			deviceID := ""
+			if input.DeviceID != nil {
+				deviceID = *input.DeviceID
+			}
+			if _, err := promotions.TrackReferral(payload.User.Id, *input.ReferralCode, deviceID); err != nil {
+				log.Printf("[WARN] Failed to track referral for %s: %v", payload.User.Id, err)
+			}
+		}
 	}
 
 	return payload, err
@@ -225,6 +238,12 @@ func (r *Resolver) UpdateMe(ctx context.Context, input model.UpdateUserInput) (*
 			user.Extra.Sexuality = *input.Extra.Sexuality
 		}
 	}
+	if input.PreferredLocale != nil {
+		if !i18n.IsSupported(*input.PreferredLocale) {
+			return nil, fmt.Errorf("unsupported locale %q, expected one of %s", *input.PreferredLocale, strings.Join(i18n.Locales(), ", "))
+		}
+		user.PreferredLocale = i18n.Normalize(*input.PreferredLocale)
+	}
 
 	return users.UpdateUser(*user)
 }
@@ -318,7 +337,7 @@ func (r *Resolver) RequestAccountDeletion(ctx context.Context) (bool, error) {
 	}
 
 	// Send email with confirmation code
-	if err := mailer.AccountDeletion(user.Email, code).Send(); err != nil {
+	if err := mailer.AccountDeletion(user.Email, users.LocaleOf(user), code).Send(); err != nil {
 		fmt.Printf("Warning: failed to send deletion email to %s: %v\n", user.Email, err)
 		// Don't fail the request if email fails - code is still stored in Redis
 	}
@@ -7,10 +7,26 @@ package graph
 
 import (
 	"spark/internal/graph/model"
+	"spark/internal/helpers/verification"
 	"spark/internal/models"
 	"context"
+	"fmt"
+	"time"
 )
 
+// Attempt is the resolver for the attempt field.
+func (r *userVerificationResolver) Attempt(ctx context.Context, obj *models.UserVerification) (int32, error) {
+	if obj == nil {
+		return 0, fmt.Errorf("verification is nil")
+	}
+	return int32(obj.Attempt), nil
+}
+
+// CanResubmitAt is the resolver for the can_resubmit_at field.
+func (r *userVerificationResolver) CanResubmitAt(ctx context.Context, obj *models.UserVerification) (*time.Time, error) {
+	return verification.ResubmitAt(obj), nil
+}
+
 // CreateVerification is the resolver for the createVerification field.
 func (r *mutationResolver) CreateVerification(ctx context.Context, input model.UserVerificationInput) (*models.UserVerification, error) {
 	return r.VerificationResolver.CreateVerification(ctx, input)
@@ -20,3 +36,8 @@ func (r *mutationResolver) CreateVerification(ctx context.Context, input model.U
 func (r *queryResolver) GetUserVerificationStatus(ctx context.Context) (*models.UserVerification, error) {
 	return r.VerificationResolver.GetUserVerificationStatus(ctx)
 }
+
+// UserVerification returns UserVerificationResolver implementation.
+func (r *Resolver) UserVerification() UserVerificationResolver { return &userVerificationResolver{r} }
+
+type userVerificationResolver struct{ *Resolver }
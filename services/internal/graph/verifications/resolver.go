@@ -4,13 +4,11 @@ import (
 	"spark/internal/anal"
 	"spark/internal/graph/directives"
 	"spark/internal/graph/model"
+	"spark/internal/helpers/verification"
 	"spark/internal/models"
 	"context"
 	"fmt"
 	"time"
-
-	"github.com/MelloB1989/karma/utils"
-	"github.com/MelloB1989/karma/v2/orm"
 )
 
 type Resolver struct {
@@ -26,39 +24,26 @@ func (r *Resolver) CreateVerification(ctx context.Context, input model.UserVerif
 		ae.SendRequestError(anal.UNAUTHORIZED_401, err)
 		return nil, fmt.Errorf("unauthorized: %w", err)
 	}
-	if input.Media == nil {
-		return nil, fmt.Errorf("media is required")
-	}
-	verificationORM := orm.Load(&models.UserVerification{})
-	defer verificationORM.Close()
 
 	now := time.Now()
-
-	verification := &models.UserVerification{
-		Id:        utils.GenerateID(),
-		UserId:    claims.UserID,
-		Status:    "requested",
-		CreatedAt: now,
-		UpdatedAt: now,
-	}
-
+	media := make([]models.Media, 0, len(input.Media))
 	for _, m := range input.Media {
 		if m == nil {
-			return nil, fmt.Errorf("media is required")
+			return nil, verification.ErrNoMedia
 		}
-		media := models.Media{
+		media = append(media, models.Media{
 			Type:      string(m.Type),
 			Url:       m.URL,
 			CreatedAt: now,
-		}
-		verification.Media = append(verification.Media, media)
+		})
 	}
 
-	if err := verificationORM.Insert(verification); err != nil {
-		return nil, fmt.Errorf("failed to create verification: %w", err)
+	v, err := verification.Submit(claims.UserID, media)
+	if err != nil {
+		ae.SendRequestError(anal.BAD_REQUEST_400, err)
+		return nil, err
 	}
-
-	return verification, nil
+	return v, nil
 }
 
 func (r *Resolver) GetUserVerificationStatus(ctx context.Context) (*models.UserVerification, error) {
@@ -67,15 +52,13 @@ func (r *Resolver) GetUserVerificationStatus(ctx context.Context) (*models.UserV
 		ae.SendRequestError(anal.UNAUTHORIZED_401, err)
 		return nil, fmt.Errorf("unauthorized: %w", err)
 	}
-	verificationORM := orm.Load(&models.UserVerification{})
-	defer verificationORM.Close()
 
-	var vr []models.UserVerification
-	if err := verificationORM.GetByFieldEquals("UserId", claims.UserID); err != nil {
-		return nil, fmt.Errorf("failed to get verification status: %w", err)
+	v, err := verification.Latest(claims.UserID)
+	if err != nil {
+		return nil, err
 	}
-	if len(vr) == 0 {
+	if v == nil {
 		return nil, fmt.Errorf("no verification status found")
 	}
-	return &vr[0], nil
+	return v, nil
 }
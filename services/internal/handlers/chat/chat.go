@@ -3,9 +3,11 @@ package chat
 import (
 	"spark/internal/anal"
 	chatservice "spark/internal/chat_service"
+	"spark/internal/helpers/impersonation"
 	"spark/internal/helpers/notifications"
 	"spark/internal/models"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -74,6 +76,9 @@ const (
 	// Query events
 	queryMessages events = "query_messages"
 
+	// Sent to the sender of a message as it moves from sent to delivered to seen
+	messageStatus events = "message_status"
+
 	// Service events
 	errorEvent           events = "error"
 	unauthorizedEvent    events = "unauthorized"
@@ -87,36 +92,43 @@ type reaction struct {
 }
 
 type messageQuery struct {
-	Limit    int    `json:"limit"`
-	BeforeId string `json:"before_id"`
+	Limit    int        `json:"limit"`
+	BeforeId string     `json:"before_id"`
+	AfterId  string     `json:"after_id"`
+	AroundId string     `json:"around_id"`
+	Since    *time.Time `json:"since"`
 }
 
+// incomingMedia references a file previously uploaded through /v1/fs/upload.
 type incomingMedia struct {
-	Type      string    `json:"type"`
-	Url       string    `json:"url"`
-	CreatedAt time.Time `json:"created_at"`
+	FileId string `json:"file_id"`
 }
 
 type incomingMessage struct {
-	Id        *string            `json:"id"` //For updating
+	Id        *string            `json:"id"`        //For updating
+	ClientId  string             `json:"client_id"` // Resending with the same client_id never creates a duplicate
 	Type      models.MessageType `json:"type"`
 	Content   string             `json:"content"`
 	Media     []incomingMedia    `json:"media"`
 	CreatedAt time.Time          `json:"created_at"`
 }
 
-var incoming struct {
-	Message      *incomingMessage `json:"message"`
-	Reaction     *reaction        `json:"reaction"`
-	Event        events           `json:"event"`
-	MarkSeen     []string         `json:"mark_seen"`
-	MessageQuery *messageQuery    `json:"message_query"`
+type incomingPayload struct {
+	Message       *incomingMessage `json:"message"`
+	Reaction      *reaction        `json:"reaction"`
+	Event         events           `json:"event"`
+	MarkSeen      []string         `json:"mark_seen"`
+	MarkDelivered []string         `json:"mark_delivered"`
+	MessageQuery  *messageQuery    `json:"message_query"`
 }
 
 type outgoing struct {
-	Messages []models.Message `json:"message"`
-	Event    events           `json:"event"`
-	Error    string           `json:"error"`
+	Messages      []models.Message            `json:"message"`
+	Event         events                      `json:"event"`
+	Error         string                      `json:"error"`
+	HasMoreBefore *bool                       `json:"has_more_before,omitempty"`
+	HasMoreAfter  *bool                       `json:"has_more_after,omitempty"`
+	Statuses      []chatservice.MessageStatus `json:"statuses,omitempty"`
 }
 
 const (
@@ -138,6 +150,12 @@ func WSHandler(c *websocket.Conn) {
 		c.Close()
 		return
 	}
+	// Impersonated sockets can only read, and only see messages while the chat has an
+	// open report
+	readOnly, canRead := false, true
+	if claims, ok := c.Locals("claims").(*models.Claims); ok && claims.IsImpersonation() {
+		readOnly, canRead = true, impersonation.CanReadChat(claims, chatId)
+	}
 
 	var writeMu sync.Mutex
 	writeJSON := func(v any) error {
@@ -223,13 +241,13 @@ func WSHandler(c *websocket.Conn) {
 			}
 			switch event.Type {
 			case chatservice.MessageEventMessage:
-				if event.Message == nil || event.Message.SenderId == userId {
+				if event.Message == nil || event.Message.SenderId == userId || !canRead {
 					continue
 				}
 				writeJSON(outgoing{
-					Messages: []models.Message{
+					Messages: store.MaskMedia([]models.Message{
 						*event.Message,
-					},
+					}),
 					Event: messageSent,
 				})
 
@@ -257,15 +275,15 @@ func WSHandler(c *websocket.Conn) {
 				}
 
 			case chatservice.MessageEventUpdate:
-				if event.Message == nil || event.Message.SenderId == userId {
+				if event.Message == nil || event.Message.SenderId == userId || !canRead {
 					continue
 				}
 				if event.Message.CreatedAt != event.Message.UpdatedAt {
 					writeJSON(outgoing{
 						Event: messageUpdated,
-						Messages: []models.Message{
+						Messages: store.MaskMedia([]models.Message{
 							*event.Message,
-						},
+						}),
 					})
 				} else {
 					if event.Message.Received {
@@ -285,6 +303,25 @@ func WSHandler(c *websocket.Conn) {
 					}
 				}
 
+			case chatservice.MessageEventStatus:
+				var statuses []chatservice.MessageStatus
+				if err := json.Unmarshal(event.Data, &statuses); err != nil {
+					log.Printf("failed to unmarshal status data: %v", err)
+					continue
+				}
+				mine := make([]chatservice.MessageStatus, 0, len(statuses))
+				for _, st := range statuses {
+					if st.SenderId == userId {
+						mine = append(mine, st)
+					}
+				}
+				if len(mine) > 0 {
+					writeJSON(outgoing{
+						Event:    messageStatus,
+						Statuses: mine,
+					})
+				}
+
 			case chatservice.MessageEventSeen:
 				if event.Data == nil {
 					continue
@@ -299,6 +336,9 @@ func WSHandler(c *websocket.Conn) {
 				if seenUserId, ok := seenData["user_id"].(string); ok && seenUserId == userId {
 					continue
 				}
+				if !canRead {
+					continue
+				}
 
 				idsAny, ok := seenData["message_ids"].([]any)
 				if !ok {
@@ -367,6 +407,8 @@ func WSHandler(c *websocket.Conn) {
 			return
 		}
 		c.SetReadDeadline(time.Now().Add(pongWait))
+		// Decode into a fresh payload so fields of the previous event never leak into this one
+		var incoming incomingPayload
 		if err := json.Unmarshal(msgBytes, &incoming); err != nil {
 			writeJSON(outgoing{
 				Event: errorEvent,
@@ -375,6 +417,14 @@ func WSHandler(c *websocket.Conn) {
 			continue
 		}
 
+		if readOnly && incoming.Event != queryMessages {
+			writeJSON(outgoing{
+				Event: errorEvent,
+				Error: impersonation.ErrReadOnly.Error(),
+			})
+			continue
+		}
+
 		switch incoming.Event {
 		case messageSent:
 			if incoming.Message == nil {
@@ -384,6 +434,14 @@ func WSHandler(c *websocket.Conn) {
 				})
 				continue
 			}
+			msgMedia, err := resolveMedia(store, userId, incoming.Message.Type, incoming.Message.Media)
+			if err != nil {
+				writeJSON(outgoing{
+					Event: errorEvent,
+					Error: err.Error(),
+				})
+				continue
+			}
 			userMgs := &models.Message{
 				Id:        strings.ToUpper(utils.GenerateID(20)),
 				SenderId:  userId,
@@ -391,23 +449,34 @@ func WSHandler(c *websocket.Conn) {
 				CreatedAt: incoming.Message.CreatedAt,
 				UpdatedAt: incoming.Message.CreatedAt,
 				Type:      incoming.Message.Type,
+				Media:     msgMedia,
+				ClientId:  incoming.Message.ClientId,
 			}
-			if len(incoming.Message.Media) > 0 {
-				for _, media := range incoming.Message.Media {
-					userMgs.Media = append(userMgs.Media, models.Media{
-						Id:        strings.ToUpper(utils.GenerateID(20)),
-						Type:      media.Type,
-						Url:       media.Url,
-						CreatedAt: media.CreatedAt,
-					})
-				}
+			err = store.SendMessage(userMgs)
+			if err == nil || errors.Is(err, chatservice.ErrDuplicateMessage) {
+				writeJSON(outgoing{
+					Event: messageStatus,
+					Statuses: []chatservice.MessageStatus{{
+						MessageId: userMgs.Id,
+						ClientId:  userMgs.ClientId,
+						SenderId:  userId,
+						UserId:    userId,
+						Status:    chatservice.StatusSent,
+						At:        userMgs.CreatedAt,
+					}},
+				})
 			}
-			if err := store.SendMessage(userMgs); err != nil {
+			if errors.Is(err, chatservice.ErrDuplicateMessage) {
+				// Resent after a flaky connection, the original was already delivered
+				continue
+			}
+			if err != nil {
 				writeJSON(outgoing{
 					Event: errorEvent,
 					Error: err.Error(),
 				})
 			} else {
+				queueBlur(chatId, userMgs.Id, userId, userMgs.Media)
 				go func() {
 					if c.Locals("analytics") != nil {
 						if ae, ok := c.Locals("analytics").(*anal.AnalyticsEngine); ok {
@@ -416,12 +485,12 @@ func WSHandler(c *websocket.Conn) {
 						}
 					}
 				}()
-				// Send email notification to the other participant
+				// Notify the other participant
 				go func(senderID string, messageContent string) {
 					participants := store.GetParticipants()
 					for _, participantID := range participants {
 						if participantID != senderID {
-							notifications.SendNewMessageNotification(participantID, senderID, messageContent)
+							notifications.SendNewMessageNotification(participantID, senderID, chatId, messageContent)
 							break
 						}
 					}
@@ -441,20 +510,23 @@ func WSHandler(c *websocket.Conn) {
 				Content:  incoming.Message.Content,
 			}
 			if len(incoming.Message.Media) > 0 {
-				for _, media := range incoming.Message.Media {
-					userMgs.Media = append(userMgs.Media, models.Media{
-						Id:        strings.ToUpper(utils.GenerateID(20)),
-						Type:      media.Type,
-						Url:       media.Url,
-						CreatedAt: media.CreatedAt,
+				msgMedia, err := resolveMedia(store, userId, incoming.Message.Type, incoming.Message.Media)
+				if err != nil {
+					writeJSON(outgoing{
+						Event: errorEvent,
+						Error: err.Error(),
 					})
+					continue
 				}
+				userMgs.Media = msgMedia
 			}
 			if _, err := store.UpdateMessage(*incoming.Message.Id, userMgs); err != nil {
 				writeJSON(outgoing{
 					Event: errorEvent,
 					Error: err.Error(),
 				})
+			} else {
+				queueBlur(chatId, userMgs.Id, userId, userMgs.Media)
 			}
 		case typingStarted:
 			if err := store.SendTypingEvent(userId); err != nil {
@@ -528,21 +600,18 @@ func WSHandler(c *websocket.Conn) {
 				}
 			}
 		case messageReceived:
-			if incoming.Message == nil || incoming.Message.Id == nil {
-				writeJSON(outgoing{
-					Event: errorEvent,
-					Error: "message id is required",
-				})
+			ids := incoming.MarkDelivered
+			if len(ids) == 0 && incoming.Message != nil && incoming.Message.Id != nil {
+				ids = []string{*incoming.Message.Id}
 			}
-			mgs, err := store.GetMessageById(*incoming.Message.Id)
-			if err != nil {
+			if len(ids) == 0 {
 				writeJSON(outgoing{
 					Event: errorEvent,
-					Error: err.Error(),
+					Error: "message id is required",
 				})
+				continue
 			}
-			mgs.Received = true
-			if _, err := store.UpdateMessage(mgs.Id, mgs); err != nil {
+			if err := store.MarkMessagesDelivered(ids, userId); err != nil {
 				writeJSON(outgoing{
 					Event: errorEvent,
 					Error: err.Error(),
@@ -569,19 +638,32 @@ func WSHandler(c *websocket.Conn) {
 				})
 				continue
 			}
-			if incoming.MessageQuery.Limit == 0 {
-				incoming.MessageQuery.Limit = 10
+			if !canRead {
+				writeJSON(outgoing{
+					Event: errorEvent,
+					Error: impersonation.ErrNotAllowed.Error(),
+				})
+				continue
 			}
-			mgs, err := store.GetMessages(incoming.MessageQuery.Limit, incoming.MessageQuery.BeforeId)
+			page, err := store.QueryMessages(chatservice.MessageQuery{
+				Limit:    incoming.MessageQuery.Limit,
+				BeforeId: incoming.MessageQuery.BeforeId,
+				AfterId:  incoming.MessageQuery.AfterId,
+				AroundId: incoming.MessageQuery.AroundId,
+				Since:    incoming.MessageQuery.Since,
+			})
 			if err != nil {
 				writeJSON(outgoing{
 					Event: errorEvent,
 					Error: err.Error(),
 				})
+				continue
 			}
 			writeJSON(outgoing{
-				Event:    messagesQuerySuccess,
-				Messages: mgs,
+				Event:         messagesQuerySuccess,
+				Messages:      store.MaskMedia(page.Messages),
+				HasMoreBefore: &page.HasMoreBefore,
+				HasMoreAfter:  &page.HasMoreAfter,
 			})
 		}
 	}
@@ -39,6 +39,7 @@ const (
 	QueryMessages        Event = "query_messages"
 	ErrorEvent           Event = "error"
 	MessagesQuerySuccess Event = "messages_query_success"
+	MessageStatus        Event = "message_status"
 )
 
 type Media struct {
@@ -57,6 +58,7 @@ type Reaction struct {
 
 type Message struct {
 	ID        string      `json:"id"`
+	ClientID  string      `json:"client_id,omitempty"`
 	Type      MessageType `json:"type"`
 	Content   string      `json:"content"`
 	SenderID  string      `json:"sender_id"`
@@ -70,6 +72,7 @@ type Message struct {
 
 type IncomingMessage struct {
 	ID        *string     `json:"id,omitempty"`
+	ClientID  string      `json:"client_id,omitempty"`
 	Type      MessageType `json:"type"`
 	Content   string      `json:"content"`
 	Media     []Media     `json:"media,omitempty"`
@@ -77,21 +80,37 @@ type IncomingMessage struct {
 }
 
 type MessageQuery struct {
-	Limit    int    `json:"limit"`
-	BeforeID string `json:"before_id,omitempty"`
+	Limit    int        `json:"limit"`
+	BeforeID string     `json:"before_id,omitempty"`
+	AfterID  string     `json:"after_id,omitempty"`
+	AroundID string     `json:"around_id,omitempty"`
+	Since    *time.Time `json:"since,omitempty"`
 }
 
 type OutgoingPayload struct {
-	Message      *IncomingMessage `json:"message,omitempty"`
-	Event        Event            `json:"event"`
-	MarkSeen     []string         `json:"mark_seen,omitempty"`
-	MessageQuery *MessageQuery    `json:"message_query,omitempty"`
+	Message       *IncomingMessage `json:"message,omitempty"`
+	Event         Event            `json:"event"`
+	MarkSeen      []string         `json:"mark_seen,omitempty"`
+	MarkDelivered []string         `json:"mark_delivered,omitempty"`
+	MessageQuery  *MessageQuery    `json:"message_query,omitempty"`
+}
+
+type Status struct {
+	MessageID string    `json:"message_id"`
+	ClientID  string    `json:"client_id,omitempty"`
+	SenderID  string    `json:"sender_id"`
+	UserID    string    `json:"user_id"`
+	Status    string    `json:"status"`
+	At        time.Time `json:"at"`
 }
 
 type IncomingPayload struct {
-	Messages []Message `json:"message"`
-	Event    Event     `json:"event"`
-	Error    string    `json:"error,omitempty"`
+	Messages      []Message `json:"message"`
+	Event         Event     `json:"event"`
+	Error         string    `json:"error,omitempty"`
+	HasMoreBefore *bool     `json:"has_more_before,omitempty"`
+	HasMoreAfter  *bool     `json:"has_more_after,omitempty"`
+	Statuses      []Status  `json:"statuses,omitempty"`
 }
 
 type TestClient struct {
@@ -199,6 +218,26 @@ func (tc *TestClient) SendMessage(content string) error {
 	return tc.send(payload)
 }
 
+func (tc *TestClient) SendMessageWithClientID(content, clientID string, createdAt time.Time) error {
+	payload := OutgoingPayload{
+		Event: MessageSent,
+		Message: &IncomingMessage{
+			ClientID:  clientID,
+			Type:      TEXT,
+			Content:   content,
+			CreatedAt: createdAt,
+		},
+	}
+	return tc.send(payload)
+}
+
+func (tc *TestClient) MarkDelivered(messageIDs []string) error {
+	return tc.send(OutgoingPayload{
+		Event:         MessageReceived,
+		MarkDelivered: messageIDs,
+	})
+}
+
 func (tc *TestClient) SendTyping(started bool) error {
 	event := TypingStarted
 	if !started {
@@ -218,6 +257,13 @@ func (tc *TestClient) QueryMessages(limit int, beforeID string) error {
 	return tc.send(payload)
 }
 
+func (tc *TestClient) Query(query MessageQuery) error {
+	return tc.send(OutgoingPayload{
+		Event:        QueryMessages,
+		MessageQuery: &query,
+	})
+}
+
 func (tc *TestClient) MarkSeen(messageIDs []string) error {
 	payload := OutgoingPayload{
 		Event:    MessageSeen,
@@ -386,11 +432,13 @@ func TestMessageQueryPagination(t *testing.T) {
 	payload1, err := client1.WaitForEvent(MessagesQuerySuccess, 5*time.Second)
 	require.NoError(t, err)
 	require.NotEmpty(t, payload1.Messages)
+	require.NotNil(t, payload1.HasMoreAfter)
+	assert.False(t, *payload1.HasMoreAfter, "Latest page should have nothing after it")
 
 	t.Logf("First query returned %d messages", len(payload1.Messages))
 
 	if len(payload1.Messages) > 0 {
-		beforeID := payload1.Messages[len(payload1.Messages)-1].ID
+		beforeID := payload1.Messages[0].ID
 		t.Logf("Querying before message ID: %s", beforeID)
 
 		err = client1.QueryMessages(5, beforeID)
@@ -407,10 +455,138 @@ func TestMessageQueryPagination(t *testing.T) {
 					assert.NotEqual(t, msg1.ID, msg2.ID, "Paginated results should not overlap")
 				}
 			}
+			require.NotNil(t, payload2.HasMoreAfter)
+			assert.True(t, *payload2.HasMoreAfter, "Older page should report newer messages")
+			assert.False(t, payload2.Messages[len(payload2.Messages)-1].CreatedAt.After(payload1.Messages[0].CreatedAt),
+				"Messages before the cursor should be older than it")
 		}
 	}
 }
 
+func TestMessageQueryAfterID(t *testing.T) {
+	client1 := NewTestClient(t, USER1_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client1.Connect())
+	defer client1.Close()
+
+	client2 := NewTestClient(t, USER2_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client2.Connect())
+	defer client2.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	require.NoError(t, client1.SendMessage(fmt.Sprintf("after_anchor_%d", time.Now().UnixNano())))
+	anchor, err := client2.WaitForEvent(MessageSent, 5*time.Second)
+	require.NoError(t, err)
+	require.NotEmpty(t, anchor.Messages)
+	anchorID := anchor.Messages[0].ID
+
+	missed := []string{}
+	for i := 0; i < 3; i++ {
+		msg := fmt.Sprintf("after_missed_%d_%d", i, time.Now().UnixNano())
+		missed = append(missed, msg)
+		require.NoError(t, client1.SendMessage(msg))
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	time.Sleep(1 * time.Second)
+
+	require.NoError(t, client1.Query(MessageQuery{Limit: 10, AfterID: anchorID}))
+	payload, err := client1.WaitForEvent(MessagesQuerySuccess, 5*time.Second)
+	require.NoError(t, err)
+
+	contents := []string{}
+	for _, msg := range payload.Messages {
+		assert.NotEqual(t, anchorID, msg.ID, "after_id should not include the cursor itself")
+		contents = append(contents, msg.Content)
+	}
+	assert.Equal(t, missed, contents, "after_id should return exactly the messages sent after the cursor, in order")
+	require.NotNil(t, payload.HasMoreBefore)
+	require.NotNil(t, payload.HasMoreAfter)
+	assert.True(t, *payload.HasMoreBefore)
+	assert.False(t, *payload.HasMoreAfter)
+
+	require.NoError(t, client1.Query(MessageQuery{Limit: 2, AfterID: anchorID}))
+	payload, err = client1.WaitForEvent(MessagesQuerySuccess, 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, payload.Messages, 2)
+	assert.True(t, *payload.HasMoreAfter, "A truncated after_id page should report more messages")
+}
+
+func TestMessageQueryAroundID(t *testing.T) {
+	client1 := NewTestClient(t, USER1_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client1.Connect())
+	defer client1.Close()
+
+	client2 := NewTestClient(t, USER2_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client2.Connect())
+	defer client2.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	ids := []string{}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, client1.SendMessage(fmt.Sprintf("around_%d_%d", i, time.Now().UnixNano())))
+		payload, err := client2.WaitForEvent(MessageSent, 5*time.Second)
+		require.NoError(t, err)
+		require.NotEmpty(t, payload.Messages)
+		ids = append(ids, payload.Messages[0].ID)
+	}
+
+	time.Sleep(1 * time.Second)
+
+	require.NoError(t, client1.Query(MessageQuery{Limit: 3, AroundID: ids[2]}))
+	payload, err := client1.WaitForEvent(MessagesQuerySuccess, 5*time.Second)
+	require.NoError(t, err)
+
+	got := []string{}
+	for _, msg := range payload.Messages {
+		got = append(got, msg.ID)
+	}
+	assert.Equal(t, ids[1:4], got, "around_id should centre the page on the anchor")
+	require.NotNil(t, payload.HasMoreBefore)
+	require.NotNil(t, payload.HasMoreAfter)
+	assert.True(t, *payload.HasMoreBefore)
+	assert.True(t, *payload.HasMoreAfter)
+
+	require.NoError(t, client1.Query(MessageQuery{Limit: 3, AroundID: "does-not-exist"}))
+	_, err = client1.WaitForEvent(ErrorEvent, 5*time.Second)
+	assert.NoError(t, err, "Unknown around_id should return an error")
+}
+
+func TestMessageQuerySince(t *testing.T) {
+	client1 := NewTestClient(t, USER1_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client1.Connect())
+	defer client1.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	since := time.Now()
+	time.Sleep(50 * time.Millisecond)
+
+	sent := []string{}
+	for i := 0; i < 3; i++ {
+		msg := fmt.Sprintf("since_%d_%d", i, time.Now().UnixNano())
+		sent = append(sent, msg)
+		require.NoError(t, client1.SendMessage(msg))
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	time.Sleep(1 * time.Second)
+
+	require.NoError(t, client1.Query(MessageQuery{Limit: 10, Since: &since}))
+	payload, err := client1.WaitForEvent(MessagesQuerySuccess, 5*time.Second)
+	require.NoError(t, err)
+
+	contents := []string{}
+	for _, msg := range payload.Messages {
+		assert.True(t, msg.CreatedAt.After(since), "since should only return newer messages")
+		contents = append(contents, msg.Content)
+	}
+	assert.Equal(t, sent, contents)
+	require.NotNil(t, payload.HasMoreAfter)
+	assert.False(t, *payload.HasMoreAfter)
+}
+
 func TestTypingIndicators(t *testing.T) {
 	client1 := NewTestClient(t, USER1_JWT, DEFAULT_CHAT_ID)
 	require.NoError(t, client1.Connect())
@@ -472,6 +648,139 @@ func TestMessageSeenStatus(t *testing.T) {
 	t.Logf("Received message seen event for %d messages", len(seenPayload.Messages))
 }
 
+func TestDuplicateSendIsDeduplicated(t *testing.T) {
+	client1 := NewTestClient(t, USER1_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client1.Connect())
+	defer client1.Close()
+
+	client2 := NewTestClient(t, USER2_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client2.Connect())
+	defer client2.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	clientID := fmt.Sprintf("client_%d", time.Now().UnixNano())
+	content := fmt.Sprintf("dedupe_test_%d", time.Now().UnixNano())
+	createdAt := time.Now()
+
+	// The client retries before the first send was acknowledged
+	require.NoError(t, client1.SendMessageWithClientID(content, clientID, createdAt))
+	require.NoError(t, client1.SendMessageWithClientID(content, clientID, createdAt))
+
+	ack1, err := client1.WaitForEvent(MessageStatus, 5*time.Second)
+	require.NoError(t, err)
+	ack2, err := client1.WaitForEvent(MessageStatus, 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, ack1.Statuses, 1)
+	require.Len(t, ack2.Statuses, 1)
+	assert.Equal(t, "sent", ack1.Statuses[0].Status)
+	assert.Equal(t, clientID, ack1.Statuses[0].ClientID)
+	assert.Equal(t, ack1.Statuses[0].MessageID, ack2.Statuses[0].MessageID, "Resends should map to the same message")
+
+	_, err = client2.WaitForEvent(MessageSent, 5*time.Second)
+	require.NoError(t, err)
+	_, err = client2.WaitForEvent(MessageSent, 2*time.Second)
+	assert.Error(t, err, "Recipient should only receive the message once")
+
+	time.Sleep(1 * time.Second)
+
+	require.NoError(t, client1.QueryMessages(50, ""))
+	payload, err := client1.WaitForEvent(MessagesQuerySuccess, 5*time.Second)
+	require.NoError(t, err)
+
+	count := 0
+	for _, msg := range payload.Messages {
+		if msg.ClientID == clientID {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count, "Only one copy of the message should be stored")
+}
+
+func TestDuplicateSendAfterReconnect(t *testing.T) {
+	client1 := NewTestClient(t, USER1_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client1.Connect())
+
+	time.Sleep(500 * time.Millisecond)
+
+	clientID := fmt.Sprintf("client_%d", time.Now().UnixNano())
+	content := fmt.Sprintf("reconnect_dedupe_%d", time.Now().UnixNano())
+	createdAt := time.Now()
+
+	// The connection drops right after sending, before the ack is read
+	require.NoError(t, client1.SendMessageWithClientID(content, clientID, createdAt))
+	time.Sleep(200 * time.Millisecond)
+	client1.Close()
+
+	client1 = NewTestClient(t, USER1_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client1.Connect())
+	defer client1.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	require.NoError(t, client1.SendMessageWithClientID(content, clientID, createdAt))
+	ack, err := client1.WaitForEvent(MessageStatus, 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, ack.Statuses, 1)
+	assert.Equal(t, clientID, ack.Statuses[0].ClientID)
+
+	time.Sleep(1 * time.Second)
+
+	require.NoError(t, client1.QueryMessages(50, ""))
+	payload, err := client1.WaitForEvent(MessagesQuerySuccess, 5*time.Second)
+	require.NoError(t, err)
+
+	ids := []string{}
+	for _, msg := range payload.Messages {
+		if msg.ClientID == clientID {
+			ids = append(ids, msg.ID)
+		}
+	}
+	require.Len(t, ids, 1, "Resending after reconnect should not duplicate the message")
+	assert.Equal(t, ids[0], ack.Statuses[0].MessageID)
+}
+
+func TestDeliveryStatusTimeline(t *testing.T) {
+	client1 := NewTestClient(t, USER1_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client1.Connect())
+	defer client1.Close()
+
+	client2 := NewTestClient(t, USER2_JWT, DEFAULT_CHAT_ID)
+	require.NoError(t, client2.Connect())
+	defer client2.Close()
+
+	time.Sleep(500 * time.Millisecond)
+
+	clientID := fmt.Sprintf("client_%d", time.Now().UnixNano())
+	require.NoError(t, client1.SendMessageWithClientID("status_timeline", clientID, time.Now()))
+
+	sent, err := client1.WaitForEvent(MessageStatus, 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, sent.Statuses, 1)
+	assert.Equal(t, "sent", sent.Statuses[0].Status)
+	messageID := sent.Statuses[0].MessageID
+
+	_, err = client2.WaitForEvent(MessageSent, 5*time.Second)
+	require.NoError(t, err)
+
+	// Acks are retried by flaky clients, only the first one counts
+	require.NoError(t, client2.MarkDelivered([]string{messageID}))
+	require.NoError(t, client2.MarkDelivered([]string{messageID}))
+
+	delivered, err := client1.WaitForEvent(MessageStatus, 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, delivered.Statuses, 1)
+	assert.Equal(t, "delivered", delivered.Statuses[0].Status)
+	assert.Equal(t, clientID, delivered.Statuses[0].ClientID)
+
+	require.NoError(t, client2.MarkSeen([]string{messageID}))
+	seen, err := client1.WaitForEvent(MessageStatus, 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, seen.Statuses, 1)
+	assert.Equal(t, "seen", seen.Statuses[0].Status)
+	assert.False(t, seen.Statuses[0].At.Before(delivered.Statuses[0].At))
+}
+
 func TestLongInactivityKeepAlive(t *testing.T) {
 	client1 := NewTestClient(t, USER1_JWT, DEFAULT_CHAT_ID)
 	require.NoError(t, client1.Connect())
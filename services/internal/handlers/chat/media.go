@@ -0,0 +1,130 @@
+package chat
+
+import (
+	"spark/internal/blurer"
+	chatservice "spark/internal/chat_service"
+	"spark/internal/helpers/media"
+	"spark/internal/models"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// resolveMedia validates the files referenced by an incoming message and turns them
+// into message media. While the match is locked, images and videos are marked as
+// waiting for the blurred copy the other participant sees instead; queueBlur makes it
+// once the message is stored.
+func resolveMedia(store *chatservice.Store, userId string, msgType models.MessageType, incoming []incomingMedia) ([]models.Media, error) {
+	if !media.IsMediaType(msgType) {
+		if len(incoming) > 0 {
+			return nil, fmt.Errorf("%s messages can't carry media", msgType)
+		}
+		return nil, nil
+	}
+	if len(incoming) == 0 {
+		return nil, fmt.Errorf("media is required for %s messages", msgType)
+	}
+
+	locked := !store.IsUnlocked()
+	resolved := make([]models.Media, 0, len(incoming))
+	for _, in := range incoming {
+		if in.FileId == "" {
+			return nil, fmt.Errorf("media file_id is required")
+		}
+
+		m, err := media.ResolveMessageMedia(in.FileId, userId, msgType)
+		if err != nil {
+			return nil, err
+		}
+
+		if locked && (msgType == models.IMAGE || msgType == models.VIDEO) {
+			m.BlurPending = true
+		}
+
+		resolved = append(resolved, *m)
+	}
+
+	return resolved, nil
+}
+
+const (
+	// blurWorkers is how many blurs run at once, so a burst of media can't take over the CPU
+	blurWorkers = 2
+	blurQueue   = 256
+	// blurRetries is how many times a blurred copy is saved before it's given up on. The
+	// message may be between the buffer and Postgres while it's being flushed.
+	blurRetries = 3
+	blurBackoff = 2 * time.Second
+)
+
+// blurJob is a message whose media is waiting for blurred copies
+type blurJob struct {
+	chatId    string
+	messageId string
+	senderId  string
+	media     []models.Media
+}
+
+var (
+	blurJobs  = make(chan blurJob, blurQueue)
+	startBlur sync.Once
+)
+
+// queueBlur makes the blurred copies of a stored message's pending media in the
+// background. The message is updated for both participants once they're ready.
+func queueBlur(chatId, messageId, senderId string, msgMedia []models.Media) {
+	pending := make([]models.Media, 0, len(msgMedia))
+	for _, m := range msgMedia {
+		if m.BlurPending {
+			pending = append(pending, m)
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	startBlur.Do(func() {
+		for range blurWorkers {
+			go blurWorker()
+		}
+	})
+	select {
+	case blurJobs <- blurJob{chatId: chatId, messageId: messageId, senderId: senderId, media: pending}:
+	default:
+		log.Printf("blur queue full, message %s in chat %s stays blurred without a preview", messageId, chatId)
+	}
+}
+
+func blurWorker() {
+	for job := range blurJobs {
+		blurMessage(job)
+	}
+}
+
+// blurMessage blurs a job's media and saves the copies. Media that fails to blur is
+// no longer pending and stays hidden.
+func blurMessage(job blurJob) {
+	blurred := make(map[string]string, len(job.media))
+	for _, m := range job.media {
+		url, err := blurer.BlurPhoto(m.Url, job.senderId)
+		if err != nil {
+			log.Printf("failed to blur media %s: %v", m.FileId, err)
+		}
+		blurred[m.FileId] = url
+	}
+
+	store := chatservice.NewStoreWithoutAuth(job.chatId)
+	defer store.Close()
+	for attempt := 1; ; attempt++ {
+		_, err := store.SetBlurredMedia(job.messageId, blurred)
+		if err == nil {
+			return
+		}
+		if attempt == blurRetries {
+			log.Printf("failed to save blurred media for message %s: %v", job.messageId, err)
+			return
+		}
+		time.Sleep(blurBackoff * time.Duration(attempt))
+	}
+}
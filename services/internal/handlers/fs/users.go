@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"spark/internal/helpers/media"
 	"spark/internal/models"
 	"context"
 	"encoding/json"
@@ -124,6 +125,20 @@ func StoreUserFile(c *fiber.Ctx) error {
 				return
 			}
 
+			// Record what was actually uploaded so chat media can be validated against it
+			info, err := media.InspectUpload(uploadedFiles[0])
+			if err != nil {
+				resultChan <- uploadResult{
+					Index: i,
+					Error: fmt.Errorf("failed to inspect file %d: %w", i, err),
+				}
+				return
+			}
+			fileToSave.MimeType = info.MimeType
+			fileToSave.Size = info.Size
+			fileToSave.DurationMs = info.DurationMs
+			fileToSave.Waveform = info.Waveform
+
 			// Upload the file to S3
 			s3Path, err := kf.HandleSingleFileUpload(uploadedFiles[0])
 			if err != nil {
@@ -0,0 +1,77 @@
+package notifications
+
+import (
+	"spark/internal/helpers/notifications"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UnsubscribeConfirmHandler serves links clicked in the email. It only asks for
+// confirmation, since mail scanners and link previews fetch links on their own.
+func UnsubscribeConfirmHandler(c *fiber.Ctx) error {
+	token := c.Query("token")
+	_, event, err := notifications.ParseUnsubscribeToken(token)
+	if err != nil {
+		return invalidUnsubscribePage(c)
+	}
+	form := fmt.Sprintf(`<form method="post" action="?token=%s"><button type="submit" style="padding:12px 24px;border:0;border-radius:8px;background:#8A3CFF;color:#ffffff;font-size:16px;">Unsubscribe</button></form>`, html.EscapeString(url.QueryEscape(token)))
+	return unsubscribePage(c, fiber.StatusOK, "Unsubscribe from Spark emails?", fmt.Sprintf("You'll stop getting %s emails from Spark.", eventLabel(event)), form)
+}
+
+// UnsubscribeHandler turns off the email an unsubscribe link was sent with. It serves
+// the confirmation form and one-click unsubscribes from mail clients (RFC 8058).
+func UnsubscribeHandler(c *fiber.Ctx) error {
+	token := c.Query("token")
+	event, err := notifications.Unsubscribe(token)
+	if errors.Is(err, notifications.ErrInvalidUnsubscribe) {
+		return invalidUnsubscribePage(c)
+	}
+	if err != nil {
+		log.Printf("[Notifications] Failed to unsubscribe: %v", err)
+		return unsubscribePage(c, fiber.StatusInternalServerError, "Something went wrong.", "Please try the link again in a moment.", "")
+	}
+	return unsubscribePage(c, fiber.StatusOK, "You're unsubscribed.", fmt.Sprintf("You won't get %s emails from Spark anymore. You can turn them back on in the app's notification settings.", eventLabel(event)), "")
+}
+
+func invalidUnsubscribePage(c *fiber.Ctx) error {
+	return unsubscribePage(c, fiber.StatusBadRequest, "This unsubscribe link isn't valid.", "You can change which emails you get in the Spark app's notification settings.", "")
+}
+
+func eventLabel(event string) string {
+	switch event {
+	case notifications.EventMessage:
+		return "new message"
+	case notifications.EventMatch:
+		return "new match"
+	case notifications.EventProfileView:
+		return "profile view"
+	case notifications.EventAnnouncements:
+		return "announcement"
+	case notifications.EventUnlockRequest:
+		return "photo unlock request"
+	case notifications.EventRewards:
+		return "reward"
+	case "digest":
+		return "digest"
+	default:
+		return event
+	}
+}
+
+func unsubscribePage(c *fiber.Ctx, status int, title, message, form string) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.Status(status).SendString(fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Spark</title></head>
+<body style="margin:0;padding:32px;background:#0B0B10;font-family:-apple-system,BlinkMacSystemFont,Segoe UI,Roboto,Helvetica,Arial,sans-serif;text-align:center;">
+	<h2 style="color:#ffffff;">%s</h2>
+	<p style="color:rgba(255,255,255,0.7);">%s</p>
+	%s
+</body>
+</html>`, title, message, form))
+}
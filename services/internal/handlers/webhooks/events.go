@@ -0,0 +1,252 @@
+package webhooks
+
+import (
+	"spark/internal/helpers/payments"
+	"spark/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// Providers
+const (
+	ProviderDodo       = payments.ProviderDodo
+	ProviderRevenueCat = payments.ProviderRevenueCat
+	ProviderSES        = "ses"
+)
+
+// Webhook event statuses
+const (
+	StatusProcessing = "processing"
+	StatusProcessed  = "processed"
+	StatusFailed     = "failed"
+	StatusSkipped    = "skipped"
+)
+
+// processingLease is how long a delivery may stay in processing before a redelivery
+// takes it over, in case the replica handling it died.
+const processingLease = 5 * time.Minute
+
+var (
+	ErrInProgress      = errors.New("event is already being processed")
+	ErrEventNotFound   = errors.New("webhook event not found")
+	ErrNotReplayable   = errors.New("only failed or skipped events can be replayed")
+	errUnknownProvider = errors.New("unknown webhook provider")
+)
+
+// inbound is what a delivery says about itself, read before it is applied.
+type inbound struct {
+	Provider   string
+	EventId    string
+	EventType  string
+	Subject    string
+	Ordered    bool
+	OccurredAt time.Time
+}
+
+// skipError marks an event that was handled without changing anything.
+type skipError struct{ reason string }
+
+func (e skipError) Error() string { return e.reason }
+
+func skip(format string, args ...any) error {
+	return skipError{reason: fmt.Sprintf(format, args...)}
+}
+
+// processors apply a stored event by provider
+var processors = map[string]func(ev *models.WebhookEvent) error{
+	ProviderDodo:       processDodo,
+	ProviderRevenueCat: processRevenueCat,
+	ProviderSES:        processSES,
+}
+
+// claim stores a delivery and takes it for processing. It returns nil when the event
+// was already handled, and ErrInProgress while another delivery of it is processing.
+// Failed events are retried by their redeliveries.
+func claim(in inbound, body []byte) (*models.WebhookEvent, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	ev := &models.WebhookEvent{
+		Id:          utils.GenerateID(),
+		Provider:    in.Provider,
+		EventId:     in.EventId,
+		EventType:   in.EventType,
+		Subject:     in.Subject,
+		Ordered:     in.Ordered,
+		OccurredAt:  in.OccurredAt,
+		Payload:     string(body),
+		Status:      StatusProcessing,
+		Attempts:    1,
+		ReceivedAt:  now,
+		AttemptedAt: &now,
+	}
+	res, err := db.Exec(`
+		INSERT INTO webhook_events (id, provider, event_id, event_type, subject, ordered, occurred_at, payload, status, attempts, received_at, attempted_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 1, $10, $10)
+		ON CONFLICT (provider, event_id) DO NOTHING
+	`, ev.Id, ev.Provider, ev.EventId, ev.EventType, ev.Subject, ev.Ordered, ev.OccurredAt, ev.Payload, StatusProcessing, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store webhook event: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return ev, nil
+	}
+
+	// Seen before: retry it if it failed or its processing was abandoned
+	var id, status string
+	err = db.QueryRow(`
+		UPDATE webhook_events SET status = $3, attempts = attempts + 1, attempted_at = $4
+		WHERE provider = $1 AND event_id = $2
+			AND (status = $5 OR (status = $3 AND attempted_at < $6))
+		RETURNING id
+	`, in.Provider, in.EventId, StatusProcessing, now, StatusFailed, now.Add(-processingLease)).Scan(&id)
+	if err == nil {
+		return get(id)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to claim webhook event: %w", err)
+	}
+
+	if err := db.QueryRow(`SELECT status FROM webhook_events WHERE provider = $1 AND event_id = $2`, in.Provider, in.EventId).Scan(&status); err != nil {
+		return nil, fmt.Errorf("failed to load webhook event: %w", err)
+	}
+	if status == StatusProcessing {
+		return nil, ErrInProgress
+	}
+	return nil, nil
+}
+
+// apply processes a claimed event and records the outcome. Ordered events older than
+// the last one applied for the same subject are skipped, so a late retry can't undo a
+// newer state change.
+func apply(ev *models.WebhookEvent) error {
+	process, ok := processors[ev.Provider]
+	if !ok {
+		return finish(ev, errUnknownProvider)
+	}
+
+	err := stale(ev)
+	if err == nil {
+		err = process(ev)
+	}
+	return finish(ev, err)
+}
+
+// stale skips an ordered event when a newer one for the same subject was applied.
+func stale(ev *models.WebhookEvent) error {
+	if !ev.Ordered || ev.Subject == "" {
+		return nil
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var newer bool
+	if err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM webhook_events
+			WHERE provider = $1 AND subject = $2 AND ordered AND status = $3 AND occurred_at > $4 AND id <> $5
+		)
+	`, ev.Provider, ev.Subject, StatusProcessed, ev.OccurredAt, ev.Id).Scan(&newer); err != nil {
+		return fmt.Errorf("failed to check event order: %w", err)
+	}
+	if newer {
+		return skip("superseded by a newer event for %s", ev.Subject)
+	}
+	return nil
+}
+
+// finish stores how processing went. Skipped events aren't errors to the caller.
+func finish(ev *models.WebhookEvent, err error) error {
+	status, lastError := StatusProcessed, ""
+	var skipped skipError
+	switch {
+	case errors.As(err, &skipped):
+		status, lastError = StatusSkipped, skipped.reason
+		err = nil
+	case err != nil:
+		status, lastError = StatusFailed, err.Error()
+	}
+
+	db, dbErr := database.PostgresConn()
+	if dbErr != nil {
+		return fmt.Errorf("failed to connect to database: %w", dbErr)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	var processedAt *time.Time
+	if status != StatusFailed {
+		processedAt = &now
+	}
+	if _, dbErr := db.Exec(`
+		UPDATE webhook_events SET status = $2, last_error = $3, processed_at = $4 WHERE id = $1
+	`, ev.Id, status, lastError, processedAt); dbErr != nil {
+		log.Printf("[Webhook] Failed to store outcome of %s event %s: %v", ev.Provider, ev.EventId, dbErr)
+	}
+	ev.Status, ev.LastError, ev.ProcessedAt = status, lastError, processedAt
+
+	if status != StatusProcessed {
+		log.Printf("[Webhook] %s event %s (%s) %s: %s", ev.Provider, ev.EventId, ev.EventType, status, lastError)
+	}
+	return err
+}
+
+func get(id string) (*models.WebhookEvent, error) {
+	eventORM := orm.Load(&models.WebhookEvent{})
+	defer eventORM.Close()
+
+	var evs []models.WebhookEvent
+	if err := eventORM.GetByFieldEquals("Id", id).Scan(&evs); err != nil {
+		return nil, fmt.Errorf("failed to get webhook event: %w", err)
+	}
+	if len(evs) == 0 {
+		return nil, ErrEventNotFound
+	}
+	return &evs[0], nil
+}
+
+// Replay processes a failed or skipped event again, as if it had just been delivered.
+func Replay(id string) (*models.WebhookEvent, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	res, err := db.Exec(`
+		UPDATE webhook_events SET status = $2, attempts = attempts + 1, attempted_at = $3
+		WHERE id = $1 AND status IN ($4, $5)
+	`, id, StatusProcessing, time.Now(), StatusFailed, StatusSkipped)
+	db.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook event: %w", err)
+	}
+
+	ev, err := get(id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if ev.Status == StatusProcessing {
+			return nil, ErrInProgress
+		}
+		return nil, ErrNotReplayable
+	}
+
+	// The outcome is stored on the event; the caller reads it from there
+	apply(ev)
+	return ev, nil
+}
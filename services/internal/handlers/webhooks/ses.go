@@ -0,0 +1,180 @@
+package webhooks
+
+import (
+	"spark/internal/mailer"
+	"spark/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SESNotification is the bounce or complaint SES publishes to SNS. Topics fed by a
+// configuration set's event destination say eventType instead of notificationType.
+type SESNotification struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+	Bounce           struct {
+		BounceType        string `json:"bounceType"` // "Permanent", "Transient", "Undetermined"
+		BounceSubType     string `json:"bounceSubType"`
+		BouncedRecipients []struct {
+			EmailAddress   string `json:"emailAddress"`
+			DiagnosticCode string `json:"diagnosticCode"`
+		} `json:"bouncedRecipients"`
+		Timestamp string `json:"timestamp"`
+	} `json:"bounce"`
+	Complaint struct {
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+		ComplainedRecipients  []struct {
+			EmailAddress string `json:"emailAddress"`
+		} `json:"complainedRecipients"`
+		Timestamp string `json:"timestamp"`
+	} `json:"complaint"`
+	Mail struct {
+		MessageId   string   `json:"messageId"`
+		Destination []string `json:"destination"`
+	} `json:"mail"`
+}
+
+func (n SESNotification) Type() string {
+	if n.NotificationType != "" {
+		return n.NotificationType
+	}
+	return n.EventType
+}
+
+// Tests replace them.
+var (
+	suppressEmail       = mailer.Suppress
+	confirmSubscription = func(subscribeURL string) error {
+		resp, err := snsClient.Get(subscribeURL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		return nil
+	}
+)
+
+// HandleSESWebhook handles the SES bounce and complaint notifications SNS delivers,
+// and confirms the subscription when the topic is first pointed here.
+func HandleSESWebhook(c *fiber.Ctx) error {
+	var msg snsMessage
+	if err := json.Unmarshal(c.Body(), &msg); err != nil {
+		log.Printf("[Webhook] Failed to parse SNS message: %v", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err := verifySNSSignature(config.GetEnvRaw("SES_SNS_TOPIC_ARN"), msg, time.Now()); err != nil {
+		return reject(c, ProviderSES, err)
+	}
+
+	switch msg.Type {
+	case snsSubscriptionConfirmation:
+		if !isSNSURL(msg.SubscribeURL) {
+			log.Printf("[Webhook] Refusing to confirm SNS subscription at %s", msg.SubscribeURL)
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		if err := confirmSubscription(msg.SubscribeURL); err != nil {
+			log.Printf("[Webhook] Failed to confirm SNS subscription to %s: %v", msg.TopicArn, err)
+			return c.SendStatus(fiber.StatusBadGateway)
+		}
+		log.Printf("[Webhook] Confirmed SNS subscription to %s", msg.TopicArn)
+		return c.SendStatus(fiber.StatusOK)
+	case snsUnsubscribeConfirmation:
+		log.Printf("[Webhook] Unsubscribed from %s", msg.TopicArn)
+		return c.SendStatus(fiber.StatusOK)
+	case snsNotification:
+	default:
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	in, err := sesInbound(msg)
+	if err != nil {
+		log.Printf("[Webhook] Failed to parse SES notification: %v", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	log.Printf("[Webhook] SES event %s: %s for %s", in.EventId, in.EventType, in.Subject)
+	return receive(c, in, c.Body())
+}
+
+// sesInbound reads an SES notification. Suppressing an address twice is harmless, so
+// they aren't ordered.
+func sesInbound(msg snsMessage) (inbound, error) {
+	if msg.MessageId == "" {
+		return inbound{}, errors.New("missing message id")
+	}
+	var n SESNotification
+	if err := json.Unmarshal([]byte(msg.Message), &n); err != nil {
+		return inbound{}, err
+	}
+	if n.Type() == "" {
+		return inbound{}, errors.New("missing notification type")
+	}
+
+	in := inbound{
+		Provider:   ProviderSES,
+		EventId:    msg.MessageId,
+		EventType:  n.Type(),
+		Subject:    strings.Join(n.Mail.Destination, ","),
+		OccurredAt: time.Now(),
+	}
+	if t, err := time.Parse(time.RFC3339, msg.Timestamp); err == nil {
+		in.OccurredAt = t
+	}
+	return in, nil
+}
+
+// processSES applies a stored SES notification: addresses that bounce for good or
+// complain stop getting email.
+func processSES(ev *models.WebhookEvent) error {
+	var msg snsMessage
+	if err := json.Unmarshal([]byte(ev.Payload), &msg); err != nil {
+		return fmt.Errorf("failed to parse SNS message: %w", err)
+	}
+	var n SESNotification
+	if err := json.Unmarshal([]byte(msg.Message), &n); err != nil {
+		return fmt.Errorf("failed to parse SES notification: %w", err)
+	}
+
+	var reason string
+	var recipients, details []string
+	switch n.Type() {
+	case "Bounce":
+		if n.Bounce.BounceType != "Permanent" {
+			return skip("%s bounce", strings.ToLower(n.Bounce.BounceType))
+		}
+		reason = mailer.ReasonBounce
+		for _, r := range n.Bounce.BouncedRecipients {
+			recipients = append(recipients, r.EmailAddress)
+			details = append(details, strings.TrimSpace(n.Bounce.BounceSubType+" "+r.DiagnosticCode))
+		}
+	case "Complaint":
+		reason = mailer.ReasonComplaint
+		for _, r := range n.Complaint.ComplainedRecipients {
+			recipients = append(recipients, r.EmailAddress)
+			details = append(details, n.Complaint.ComplaintFeedbackType)
+		}
+	default:
+		return skip("unhandled notification type %s", n.Type())
+	}
+	if len(recipients) == 0 {
+		return skip("no recipients")
+	}
+
+	for i, email := range recipients {
+		if err := suppressEmail(email, reason, details[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package webhooks
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// signatureTolerance is how far a signed timestamp may be from now. Older deliveries
+// are refused so a captured request can't be replayed later.
+const signatureTolerance = 5 * time.Minute
+
+var (
+	ErrNotConfigured    = errors.New("webhook secret is not configured")
+	ErrMissingSignature = errors.New("missing webhook signature")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrStaleTimestamp   = errors.New("webhook timestamp outside tolerance")
+	ErrUnknownTopic     = errors.New("SNS topic is not allowed")
+)
+
+// verifyDodoSignature checks a Dodo delivery against the Standard Webhooks scheme Dodo
+// signs with: an HMAC-SHA256 of "id.timestamp.body", sent base64 encoded as one or more
+// space separated "v1,<signature>" entries.
+func verifyDodoSignature(secret, id, timestamp, signatures string, body []byte, now time.Time) error {
+	if secret == "" {
+		return ErrNotConfigured
+	}
+	if id == "" || timestamp == "" || signatures == "" {
+		return ErrMissingSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > signatureTolerance || d < -signatureTolerance {
+		return ErrStaleTimestamp
+	}
+
+	mac := hmac.New(sha256.New, dodoKey(secret))
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	for _, entry := range strings.Fields(signatures) {
+		version, sig, ok := strings.Cut(entry, ",")
+		if !ok || version != "v1" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			continue
+		}
+		if hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// dodoKey decodes a "whsec_" prefixed secret. Secrets in any other form are used as is.
+func dodoKey(secret string) []byte {
+	if raw, ok := strings.CutPrefix(secret, "whsec_"); ok {
+		if key, err := base64.StdEncoding.DecodeString(raw); err == nil {
+			return key
+		}
+	}
+	return []byte(secret)
+}
+
+// verifyRevenueCatAuth checks the Authorization header RevenueCat sends with every
+// delivery against the configured secret.
+func verifyRevenueCatAuth(secret, header string) error {
+	if secret == "" {
+		return ErrNotConfigured
+	}
+	if header == "" {
+		return ErrMissingSignature
+	}
+	if subtle.ConstantTimeCompare([]byte(header), []byte("Bearer "+secret)) != 1 {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// snsTolerance is how old an SNS message may be. SNS keeps the publish time on its
+// retries, which can go on for an hour.
+const snsTolerance = time.Hour
+
+// snsCertHost is where SNS keeps the certificates it signs with
+var snsCertHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// snsMessage is the envelope SNS posts to HTTPS subscribers.
+type snsMessage struct {
+	Type             string `json:"Type"`
+	MessageId        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicArn         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL"`
+}
+
+// SNS message types
+const (
+	snsNotification             = "Notification"
+	snsSubscriptionConfirmation = "SubscriptionConfirmation"
+	snsUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+// stringToSign is what SNS signs for msg: the message's fields in a fixed order, each
+// as "name\nvalue\n".
+func (msg snsMessage) stringToSign() string {
+	fields := [][2]string{{"Message", msg.Message}, {"MessageId", msg.MessageId}}
+	if msg.Type == snsNotification {
+		if msg.Subject != "" {
+			fields = append(fields, [2]string{"Subject", msg.Subject})
+		}
+		fields = append(fields, [2]string{"Timestamp", msg.Timestamp})
+	} else {
+		fields = append(fields, [2]string{"SubscribeURL", msg.SubscribeURL}, [2]string{"Timestamp", msg.Timestamp}, [2]string{"Token", msg.Token})
+	}
+	fields = append(fields, [2]string{"TopicArn", msg.TopicArn}, [2]string{"Type", msg.Type})
+
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(f[0] + "\n" + f[1] + "\n")
+	}
+	return b.String()
+}
+
+// isSNSURL reports whether raw is an https URL on an SNS host
+func isSNSURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && snsCertHost.MatchString(u.Hostname()) && u.Port() == ""
+}
+
+// verifySNSSignature checks an SNS message came from one of topics, a comma separated
+// list of topic ARNs, and is signed with the certificate SNS points to.
+func verifySNSSignature(topics string, msg snsMessage, now time.Time) error {
+	allowed := strings.FieldsFunc(topics, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(allowed) == 0 {
+		return ErrNotConfigured
+	}
+	if msg.Signature == "" || msg.SigningCertURL == "" {
+		return ErrMissingSignature
+	}
+	if !slices.Contains(allowed, msg.TopicArn) {
+		return ErrUnknownTopic
+	}
+
+	ts, err := time.Parse(time.RFC3339, msg.Timestamp)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if d := now.Sub(ts); d > snsTolerance || d < -signatureTolerance {
+		return ErrStaleTimestamp
+	}
+
+	var hash crypto.Hash
+	var digest []byte
+	switch msg.SignatureVersion {
+	case "1":
+		sum := sha1.Sum([]byte(msg.stringToSign()))
+		hash, digest = crypto.SHA1, sum[:]
+	case "2":
+		sum := sha256.Sum256([]byte(msg.stringToSign()))
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return ErrInvalidSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(msg.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if !isSNSURL(msg.SigningCertURL) || !strings.HasSuffix(msg.SigningCertURL, ".pem") {
+		return ErrInvalidSignature
+	}
+	key, err := snsSigningKey(msg.SigningCertURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if rsa.VerifyPKCS1v15(key, hash, digest, sig) != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+var snsCerts sync.Map // certificate URL -> *rsa.PublicKey
+
+func snsSigningKey(certURL string) (*rsa.PublicKey, error) {
+	if key, ok := snsCerts.Load(certURL); ok {
+		return key.(*rsa.PublicKey), nil
+	}
+	raw, err := fetchSNSCert(certURL)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, errors.New("signing certificate is not PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing certificate: %w", err)
+	}
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("signing certificate does not hold an RSA key")
+	}
+	snsCerts.Store(certURL, key)
+	return key, nil
+}
+
+var snsClient = &http.Client{Timeout: 10 * time.Second}
+
+// fetchSNSCert downloads a signing certificate. Tests replace it.
+var fetchSNSCert = func(certURL string) ([]byte, error) {
+	resp, err := snsClient.Get(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch signing certificate: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+}
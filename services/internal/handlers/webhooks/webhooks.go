@@ -1,13 +1,17 @@
 package webhooks
 
 import (
+	"spark/internal/helpers/payments"
+	"spark/internal/helpers/promotions"
 	"spark/internal/helpers/subscriptions"
 	"spark/internal/helpers/users"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"spark/internal/models"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/MelloB1989/karma/config"
@@ -30,6 +34,12 @@ type DodoWebhookPayload struct {
 		PreviousBillingDate string `json:"previous_billing_date"`
 		NextBillingDate     string `json:"next_billing_date"`
 		Metadata            map[string]string `json:"metadata"`
+		// Refund events
+		RefundId  string `json:"refund_id"`
+		PaymentId string `json:"payment_id"`
+		Amount    int    `json:"amount"` // cents
+		Currency  string `json:"currency"`
+		Reason    string `json:"reason"`
 	} `json:"data"`
 	Timestamp string `json:"timestamp"`
 }
@@ -43,6 +53,13 @@ type RevCatWebhookPayload struct {
 		AppUserID           string `json:"app_user_id"`
 		OriginalAppUserID   string `json:"original_app_user_id"`
 		ProductID           string `json:"product_id"`
+		NewProductID         string   `json:"new_product_id"` // PRODUCT_CHANGE
+		CancelReason         string   `json:"cancel_reason"`  // CANCELLATION: "CUSTOMER_SUPPORT" is a refund
+		Price                float64  `json:"price"`          // USD; negative for refunds
+		Currency             string   `json:"currency"`
+		TransactionID        string   `json:"transaction_id"`
+		AutoResumeAtMs       int64    `json:"auto_resume_at_ms"` // SUBSCRIPTION_PAUSED
+		EventTimestampMs     int64    `json:"event_timestamp_ms"`
 		EntitlementIDs      []string `json:"entitlement_ids"`
 		PeriodType          string `json:"period_type"`
 		PurchasedAtMs       int64  `json:"purchased_at_ms"`
@@ -56,49 +73,179 @@ type RevCatWebhookPayload struct {
 	} `json:"event"`
 }
 
-// Dodo product ID to plan ID mapping
-var dodoProductToPlan = map[string]string{
-	"SPARK_plus_monthly":  subscriptions.PlanPlus,
-	"SPARK_plus_yearly":   subscriptions.PlanPlus,
-	"SPARK_pro_monthly":   subscriptions.PlanPro,
-	"SPARK_pro_yearly":    subscriptions.PlanPro,
-	"SPARK_elite_monthly": subscriptions.PlanElite,
-	"SPARK_elite_yearly":  subscriptions.PlanElite,
+// HandleDodoWebhook handles DodoPayments webhooks
+func HandleDodoWebhook(c *fiber.Ctx) error {
+	body := c.Body()
+	id := c.Get("webhook-id")
+	if err := verifyDodoSignature(config.GetEnvRaw("DODO_WEBHOOK_SECRET"), id, c.Get("webhook-timestamp"), c.Get("webhook-signature"), body, time.Now()); err != nil {
+		return reject(c, ProviderDodo, err)
+	}
+
+	in, err := dodoInbound(id, body)
+	if err != nil {
+		log.Printf("[Webhook] Failed to parse Dodo payload: %v", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	log.Printf("[Webhook] Dodo event %s: %s for %s", in.EventId, in.EventType, in.Subject)
+	return receive(c, in, body)
+}
+
+// HandleRevenueCatWebhook handles RevenueCat webhooks
+func HandleRevenueCatWebhook(c *fiber.Ctx) error {
+	body := c.Body()
+	if err := verifyRevenueCatAuth(config.GetEnvRaw("REVENUECAT_WEBHOOK_SECRET"), c.Get("Authorization")); err != nil {
+		return reject(c, ProviderRevenueCat, err)
+	}
+
+	in, err := revenueCatInbound(body)
+	if err != nil {
+		log.Printf("[Webhook] Failed to parse RevenueCat payload: %v", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	log.Printf("[Webhook] RevenueCat event %s: %s for user %s", in.EventId, in.EventType, in.Subject)
+	return receive(c, in, body)
 }
 
-// RevenueCat product ID to plan ID mapping
-var revcatProductToPlan = map[string]string{
-	"SPARK_plus_monthly":  subscriptions.PlanPlus,
-	"SPARK_plus_annual":   subscriptions.PlanPlus,
-	"SPARK_pro_monthly":   subscriptions.PlanPro,
-	"SPARK_pro_annual":    subscriptions.PlanPro,
-	"SPARK_elite_monthly": subscriptions.PlanElite,
-	"SPARK_elite_annual":  subscriptions.PlanElite,
+// reject refuses a delivery that failed verification. A missing secret is our fault,
+// so the provider is asked to retry rather than told the request was bad.
+func reject(c *fiber.Ctx, provider string, err error) error {
+	log.Printf("[Webhook] Rejected %s delivery: %v", provider, err)
+	if errors.Is(err, ErrNotConfigured) {
+		return c.SendStatus(fiber.StatusServiceUnavailable)
+	}
+	return c.SendStatus(fiber.StatusUnauthorized)
 }
 
-// HandleDodoWebhook handles DodoPayments webhooks
-func HandleDodoWebhook(c *fiber.Ctx) error {
-	// Verify webhook signature
-	signature := c.Get("X-Dodo-Signature")
-	secret := config.GetEnvRaw("DODO_WEBHOOK_SECRET")
-
-	if secret != "" && signature != "" {
-		mac := hmac.New(sha256.New, []byte(secret))
-		mac.Write(c.Body())
-		expectedSig := hex.EncodeToString(mac.Sum(nil))
-		if signature != expectedSig {
-			log.Printf("[Webhook] Invalid Dodo signature")
-			return c.SendStatus(fiber.StatusUnauthorized)
-		}
+// receive stores a verified delivery and applies it once. Failures answer 500 so the
+// provider redelivers; a redelivery of a processed event is acknowledged untouched.
+func receive(c *fiber.Ctx, in inbound, body []byte) error {
+	ev, err := claim(in, body)
+	if errors.Is(err, ErrInProgress) {
+		return c.SendStatus(fiber.StatusConflict)
+	}
+	if err != nil {
+		log.Printf("[Webhook] Failed to store %s event %s: %v", in.Provider, in.EventId, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if ev == nil {
+		log.Printf("[Webhook] Ignoring duplicate %s event %s", in.Provider, in.EventId)
+		return c.SendStatus(fiber.StatusOK)
 	}
 
+	if err := apply(ev); err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// dodoInbound reads a Dodo delivery. Subscription events are ordered per subscription
+// by the payload timestamp.
+func dodoInbound(id string, body []byte) (inbound, error) {
 	var payload DodoWebhookPayload
-	if err := json.Unmarshal(c.Body(), &payload); err != nil {
-		log.Printf("[Webhook] Failed to parse Dodo payload: %v", err)
-		return c.SendStatus(fiber.StatusBadRequest)
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return inbound{}, err
+	}
+	if payload.Type == "" {
+		return inbound{}, errors.New("missing event type")
+	}
+
+	in := inbound{
+		Provider:   ProviderDodo,
+		EventId:    id,
+		EventType:  payload.Type,
+		Ordered:    strings.HasPrefix(payload.Type, "subscription."),
+		OccurredAt: time.Now(),
+	}
+	if payload.Data.SubscriptionId != "" {
+		in.Subject = "subscription:" + payload.Data.SubscriptionId
+	}
+	if t, err := time.Parse(time.RFC3339, payload.Timestamp); err == nil {
+		in.OccurredAt = t
+	}
+	return in, nil
+}
+
+// RevenueCat events that replace the state of a subscriber's subscription
+var revcatOrderedEvents = map[string]bool{
+	"INITIAL_PURCHASE":    true,
+	"RENEWAL":             true,
+	"PRODUCT_CHANGE":      true,
+	"CANCELLATION":        true,
+	"UNCANCELLATION":      true,
+	"EXPIRATION":          true,
+	"SUBSCRIPTION_PAUSED": true,
+}
+
+// revenueCatInbound reads a RevenueCat delivery. State changes are ordered per app
+// user by the event timestamp; refunds always apply.
+func revenueCatInbound(body []byte) (inbound, error) {
+	var payload RevCatWebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return inbound{}, err
+	}
+	e := payload.Event
+	if e.ID == "" || e.Type == "" {
+		return inbound{}, errors.New("missing event id or type")
+	}
+
+	in := inbound{
+		Provider:   ProviderRevenueCat,
+		EventId:    e.ID,
+		EventType:  e.Type,
+		Subject:    e.OriginalAppUserID,
+		Ordered:    revcatOrderedEvents[e.Type] && !isRevenueCatRefund(e.Type, e.CancelReason),
+		OccurredAt: time.Now(),
 	}
+	if in.Subject == "" {
+		in.Subject = e.AppUserID
+	}
+	switch {
+	case e.EventTimestampMs > 0:
+		in.OccurredAt = time.UnixMilli(e.EventTimestampMs)
+	case e.PurchasedAtMs > 0:
+		in.OccurredAt = time.UnixMilli(e.PurchasedAtMs)
+	}
+	return in, nil
+}
+
+func isRevenueCatRefund(eventType, cancelReason string) bool {
+	return eventType == "CANCELLATION" && cancelReason == "CUSTOMER_SUPPORT"
+}
 
-	log.Printf("[Webhook] Dodo event: %s for subscription %s", payload.Type, payload.Data.SubscriptionId)
+// outcome maps what subscriptions reports to how the event is recorded: changes that
+// were already applied succeed, changes with nothing to apply to are skipped.
+func outcome(err error) error {
+	switch {
+	case err == nil, errors.Is(err, subscriptions.ErrAlreadyRecorded):
+		return nil
+	case errors.Is(err, subscriptions.ErrNoSubscription), errors.Is(err, subscriptions.ErrNotPaused), errors.Is(err, subscriptions.ErrSamePlan),
+		errors.Is(err, subscriptions.ErrNothingToRefund):
+		return skip("%v", err)
+	}
+	return err
+}
+
+// The subscription changes processDodo makes. Tests replace them.
+var (
+	subscriptionByProviderID = func(provider, providerSubID string) (*models.UserSubscription, error) {
+		if providerSubID == "" {
+			return nil, nil
+		}
+		return subscriptions.GetSubscriptionByProviderID(provider, providerSubID)
+	}
+	createSubscription = subscriptions.CreateSubscription
+	pauseSubscription  = subscriptions.Pause
+	resumeSubscription = subscriptions.Resume
+)
+
+// processDodo applies a stored Dodo event.
+func processDodo(ev *models.WebhookEvent) error {
+	var payload DodoWebhookPayload
+	if err := json.Unmarshal([]byte(ev.Payload), &payload); err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
+	}
 
 	// Find user by email or metadata
 	var userID string
@@ -113,144 +260,252 @@ func HandleDodoWebhook(c *fiber.Ctx) error {
 			userID = user.Id
 		}
 	}
-
 	if userID == "" {
-		log.Printf("[Webhook] Could not find user for Dodo webhook")
-		return c.SendStatus(fiber.StatusOK) // Still return 200 to prevent retries
+		return skip("no user found for the event")
 	}
 
 	// Get plan from product
 	planID := subscriptions.PlanPlus // default
-	if p, ok := dodoProductToPlan[payload.Data.ProductId]; ok {
+	if p, _, ok := payments.PlanForProduct(ProviderDodo, payload.Data.ProductId); ok {
 		planID = p
 	}
 
+	periodEnd := time.Now().AddDate(0, 1, 0) // Default 1 month
+	if payload.Data.NextBillingDate != "" {
+		if t, err := time.Parse(time.RFC3339, payload.Data.NextBillingDate); err == nil {
+			periodEnd = t
+		}
+	}
+
 	switch payload.Type {
 	case "subscription.active", "subscription.created":
-		periodStart := time.Now()
-		periodEnd := time.Now().AddDate(0, 1, 0) // Default 1 month
-
-		if payload.Data.NextBillingDate != "" {
-			if t, err := time.Parse(time.RFC3339, payload.Data.NextBillingDate); err == nil {
-				periodEnd = t
+		// A subscription we already know is coming back from a pause, or confirming a
+		// resume applied here first; it is never bought again
+		existing, err := subscriptionByProviderID(ProviderDodo, payload.Data.SubscriptionId)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			switch existing.Status {
+			case "paused":
+				_, err := resumeSubscription(userID, ev.EventId)
+				return outcome(err)
+			case "active":
+				return skip("subscription %s is already active", payload.Data.SubscriptionId)
 			}
 		}
-
-		_, err := subscriptions.CreateSubscription(
+		sub, err := createSubscription(
 			userID,
 			planID,
-			"dodo",
+			ProviderDodo,
 			payload.Data.SubscriptionId,
 			payload.Data.CustomerId,
-			periodStart,
+			time.Now(),
 			periodEnd,
 		)
 		if err != nil {
-			log.Printf("[Webhook] Failed to create subscription: %v", err)
+			return err
 		}
+		if code := payload.Data.Metadata["promo_code"]; code != "" {
+			if err := promotions.SpendDiscount(userID, code, sub.Id); err != nil {
+				log.Printf("[Webhook] Failed to spend discount %s for user %s: %v", code, userID, err)
+			}
+		}
+		return nil
 
 	case "subscription.renewed":
-		// Update period
-		sub, _ := subscriptions.GetUserSubscription(userID)
-		if sub != nil {
-			periodEnd := time.Now().AddDate(0, 1, 0)
-			if payload.Data.NextBillingDate != "" {
-				if t, err := time.Parse(time.RFC3339, payload.Data.NextBillingDate); err == nil {
-					periodEnd = t
-				}
-			}
-			subscriptions.CreateSubscription(
-				userID,
-				planID,
-				"dodo",
-				payload.Data.SubscriptionId,
-				payload.Data.CustomerId,
-				time.Now(),
-				periodEnd,
-			)
+		sub, err := subscriptions.GetUserSubscription(userID)
+		if err != nil {
+			return err
 		}
+		if sub == nil {
+			return skip("no active subscription to renew")
+		}
+		_, err = subscriptions.CreateSubscription(
+			userID,
+			planID,
+			ProviderDodo,
+			payload.Data.SubscriptionId,
+			payload.Data.CustomerId,
+			time.Now(),
+			periodEnd,
+		)
+		return err
 
 	case "subscription.cancelled", "subscription.expired":
-		sub, _ := subscriptions.GetUserSubscription(userID)
-		if sub != nil {
-			subscriptions.ExpireSubscription(sub.Id)
+		sub, err := subscriptions.GetUserSubscription(userID)
+		if err != nil {
+			return err
+		}
+		if sub == nil {
+			return skip("no active subscription to end")
 		}
+		return subscriptions.ExpireSubscription(sub.Id)
+
+	case "subscription.on_hold", "subscription.failed":
+		// A renewal payment failed; access continues for the grace period
+		_, err := subscriptions.MarkBillingIssue(userID, ev.EventId)
+		return outcome(err)
 
 	case "subscription.paused":
-		sub, _ := subscriptions.GetUserSubscription(userID)
-		if sub != nil {
-			subscriptions.CancelSubscription(userID)
+		// Pauses asked for here are applied before the provider confirms them
+		existing, err := subscriptionByProviderID(ProviderDodo, payload.Data.SubscriptionId)
+		if err != nil {
+			return err
 		}
+		if existing != nil && existing.Status == "paused" {
+			return skip("subscription %s is already paused", payload.Data.SubscriptionId)
+		}
+		_, err = pauseSubscription(userID, nil, ev.EventId)
+		return outcome(err)
+
+	case "subscription.plan_changed":
+		_, _, err := subscriptions.ChangePlan(userID, planID, ev.EventId)
+		return outcome(err)
+
+	case "refund.succeeded":
+		sub := refundedSubscription(userID, ProviderDodo, payload.Data.SubscriptionId)
+		if sub == nil {
+			return skip("no subscription to refund")
+		}
+		refundID := payload.Data.RefundId
+		if refundID == "" {
+			refundID = ev.EventId
+		}
+		// Refunds staff made through the provider were recorded under the same id
+		_, err := subscriptions.Refund(sub.Id, payload.Data.Amount, payload.Data.Reason, "", refundID, false)
+		if errors.Is(err, subscriptions.ErrAlreadyRecorded) {
+			return skip("refund %s is already recorded", refundID)
+		}
+		return outcome(err)
 	}
 
-	return c.SendStatus(fiber.StatusOK)
+	return skip("unhandled event type %s", payload.Type)
 }
 
-// HandleRevenueCatWebhook handles RevenueCat webhooks
-func HandleRevenueCatWebhook(c *fiber.Ctx) error {
-	// Verify webhook signature
-	authHeader := c.Get("Authorization")
-	expectedAuth := "Bearer " + config.GetEnvRaw("REVENUECAT_WEBHOOK_SECRET")
-
-	if expectedAuth != "Bearer " && authHeader != expectedAuth {
-		log.Printf("[Webhook] Invalid RevenueCat authorization")
-		return c.SendStatus(fiber.StatusUnauthorized)
+// refundedSubscription finds the subscription a refund applies to: the one the provider
+// names, or else the user's most recent one with that provider.
+func refundedSubscription(userID, provider, providerSubID string) *models.UserSubscription {
+	if providerSubID != "" {
+		if sub, err := subscriptions.GetSubscriptionByProviderID(provider, providerSubID); err == nil && sub != nil {
+			return sub
+		}
 	}
+	for _, get := range []func(string) (*models.UserSubscription, error){subscriptions.GetUserSubscription, subscriptions.GetPausedSubscription} {
+		if sub, err := get(userID); err == nil && sub != nil && sub.Provider == provider {
+			return sub
+		}
+	}
+	return nil
+}
 
+// processRevenueCat applies a stored RevenueCat event.
+func processRevenueCat(ev *models.WebhookEvent) error {
 	var payload RevCatWebhookPayload
-	if err := json.Unmarshal(c.Body(), &payload); err != nil {
-		log.Printf("[Webhook] Failed to parse RevenueCat payload: %v", err)
-		return c.SendStatus(fiber.StatusBadRequest)
+	if err := json.Unmarshal([]byte(ev.Payload), &payload); err != nil {
+		return fmt.Errorf("failed to parse payload: %w", err)
 	}
 
-	log.Printf("[Webhook] RevenueCat event: %s for user %s", payload.Event.Type, payload.Event.AppUserID)
-
 	userID := payload.Event.AppUserID
 	if userID == "" {
 		userID = payload.Event.OriginalAppUserID
 	}
-
 	if userID == "" {
-		log.Printf("[Webhook] No user ID in RevenueCat webhook")
-		return c.SendStatus(fiber.StatusOK)
+		return skip("no user ID in the event")
 	}
 
 	// Get plan from product
 	planID := subscriptions.PlanPlus
-	if p, ok := revcatProductToPlan[payload.Event.ProductID]; ok {
+	if p, _, ok := payments.PlanForProduct(ProviderRevenueCat, payload.Event.ProductID); ok {
 		planID = p
 	}
 
 	switch payload.Event.Type {
-	case "INITIAL_PURCHASE", "RENEWAL", "PRODUCT_CHANGE":
-		periodStart := time.UnixMilli(payload.Event.PurchasedAtMs)
-		periodEnd := time.UnixMilli(payload.Event.ExpirationAtMs)
+	case "PRODUCT_CHANGE":
+		newPlanID, _, ok := payments.PlanForProduct(ProviderRevenueCat, payload.Event.NewProductID)
+		if !ok {
+			return skip("unknown product %s", payload.Event.NewProductID)
+		}
+		_, _, err := subscriptions.ChangePlan(userID, newPlanID, ev.EventId)
+		return outcome(err)
 
+	case "INITIAL_PURCHASE", "RENEWAL":
 		_, err := subscriptions.CreateSubscription(
 			userID,
 			planID,
-			"revcat",
+			ProviderRevenueCat,
 			payload.Event.ID,
 			"",
-			periodStart,
-			periodEnd,
+			time.UnixMilli(payload.Event.PurchasedAtMs),
+			time.UnixMilli(payload.Event.ExpirationAtMs),
 		)
+		return err
+
+	case "CANCELLATION":
+		if isRevenueCatRefund(payload.Event.Type, payload.Event.CancelReason) {
+			// Refunded by Apple or Google support
+			sub := refundedSubscription(userID, ProviderRevenueCat, "")
+			if sub == nil {
+				return skip("no subscription to refund")
+			}
+			amount := int(math.Round(math.Abs(payload.Event.Price) * 100))
+			_, err := subscriptions.Refund(sub.Id, amount, "customer support", "", ev.EventId, true)
+			return outcome(err)
+		}
+		// Auto-renew was turned off; access lasts until the period ends
+		return outcome(subscriptions.CancelSubscription(userID))
+
+	case "UNCANCELLATION":
+		return outcome(subscriptions.ReactivateSubscription(userID))
+
+	case "EXPIRATION":
+		sub, err := subscriptions.GetUserSubscription(userID)
 		if err != nil {
-			log.Printf("[Webhook] Failed to create subscription: %v", err)
+			return err
+		}
+		if sub == nil {
+			return skip("no active subscription to end")
 		}
+		return subscriptions.ExpireSubscription(sub.Id)
 
-	case "CANCELLATION", "EXPIRATION":
-		sub, _ := subscriptions.GetUserSubscription(userID)
-		if sub != nil {
-			subscriptions.ExpireSubscription(sub.Id)
+	case "SUBSCRIPTION_PAUSED":
+		var resumeAt *time.Time
+		if payload.Event.AutoResumeAtMs > 0 {
+			t := time.UnixMilli(payload.Event.AutoResumeAtMs)
+			resumeAt = &t
 		}
+		_, err := subscriptions.Pause(userID, resumeAt, ev.EventId)
+		return outcome(err)
 
 	case "BILLING_ISSUE":
-		// Could send notification to user
-		log.Printf("[Webhook] Billing issue for user %s", userID)
+		// The store keeps retrying the payment; access continues for the grace period
+		_, err := subscriptions.MarkBillingIssue(userID, ev.EventId)
+		return outcome(err)
 	}
 
-	return c.SendStatus(fiber.StatusOK)
+	return skip("unhandled event type %s", payload.Event.Type)
+}
+
+// HandleFakeCheckout completes a checkout started with the fake payment provider, as
+// if the customer had paid, and sends them back to the app.
+func HandleFakeCheckout(c *fiber.Ctx) error {
+	fake, ok := payments.WebProvider().(*payments.FakeProvider)
+	if !ok {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	_, returnURL, err := fake.Complete(c.UserContext(), c.Params("id"))
+	if errors.Is(err, payments.ErrNotFound) {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	if err != nil {
+		log.Printf("[Webhook] Failed to complete fake checkout: %v", err)
+		return c.Status(fiber.StatusBadGateway).SendString(err.Error())
+	}
+	if returnURL == "" {
+		return c.SendString("Payment complete")
+	}
+	return c.Redirect(returnURL)
 }
 
 // RegisterWebhookRoutes registers webhook routes
@@ -258,4 +513,10 @@ func RegisterWebhookRoutes(app *fiber.App) {
 	webhooks := app.Group("/webhooks")
 	webhooks.Post("/dodo", HandleDodoWebhook)
 	webhooks.Post("/revenuecat", HandleRevenueCatWebhook)
+	webhooks.Post("/ses", HandleSESWebhook)
+
+	if _, ok := payments.WebProvider().(*payments.FakeProvider); ok {
+		log.Printf("[Webhook] Using the fake payment provider")
+		app.Get(payments.FakeCheckoutPath+"/:id", HandleFakeCheckout)
+	}
 }
@@ -0,0 +1,804 @@
+package webhooks
+
+import (
+	"spark/internal/helpers/payments"
+	"spark/internal/helpers/subscriptions"
+	"spark/internal/models"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testDodoSecret is "spark-test-secret" in the whsec_ form Dodo hands out
+var testDodoSecret = "whsec_" + base64.StdEncoding.EncodeToString([]byte("spark-test-secret"))
+
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture %s: %v", name, err)
+	}
+	return body
+}
+
+func signDodo(id, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte("spark-test-secret"))
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyDodoSignature(t *testing.T) {
+	body := fixture(t, "dodo_subscription_active.json")
+	now := time.Unix(1762078530, 0)
+	id := "msg_2k9XcQ1p"
+	ts := strconv.FormatInt(now.Unix(), 10)
+	sig := signDodo(id, ts, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		id        string
+		timestamp string
+		signature string
+		body      []byte
+		want      error
+	}{
+		{"valid", testDodoSecret, id, ts, sig, body, nil},
+		{"valid among rotated signatures", testDodoSecret, id, ts, "v1,b2xkLXNpZ25hdHVyZQ== " + sig, body, nil},
+		{"not configured", "", id, ts, sig, body, ErrNotConfigured},
+		{"missing signature", testDodoSecret, id, ts, "", body, ErrMissingSignature},
+		{"missing id", testDodoSecret, "", ts, sig, body, ErrMissingSignature},
+		{"tampered body", testDodoSecret, id, ts, sig, []byte(strings.Replace(string(body), "SPARK_pro_monthly", "SPARK_elite_yearly", 1)), ErrInvalidSignature},
+		{"different id", testDodoSecret, "msg_other", ts, sig, body, ErrInvalidSignature},
+		{"wrong version", testDodoSecret, id, ts, strings.Replace(sig, "v1,", "v2,", 1), body, ErrInvalidSignature},
+		{"wrong secret", "whsec_" + base64.StdEncoding.EncodeToString([]byte("other")), id, ts, sig, body, ErrInvalidSignature},
+		{"bad timestamp", testDodoSecret, id, "yesterday", sig, body, ErrInvalidSignature},
+		{"too old", testDodoSecret, id, strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10), signDodo(id, strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10), body), body, ErrStaleTimestamp},
+		{"too far ahead", testDodoSecret, id, strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10), signDodo(id, strconv.FormatInt(now.Add(10*time.Minute).Unix(), 10), body), body, ErrStaleTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyDodoSignature(tt.secret, tt.id, tt.timestamp, tt.signature, tt.body, now)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRevenueCatAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		want   error
+	}{
+		{"valid", "rc-secret", "Bearer rc-secret", nil},
+		{"not configured", "", "Bearer ", ErrNotConfigured},
+		{"missing header", "rc-secret", "", ErrMissingSignature},
+		{"wrong secret", "rc-secret", "Bearer rc-secreT", ErrInvalidSignature},
+		{"no scheme", "rc-secret", "rc-secret", ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyRevenueCatAuth(tt.secret, tt.header); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDodoInbound(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    inbound
+	}{
+		{"dodo_subscription_active.json", inbound{
+			Provider:   ProviderDodo,
+			EventId:    "msg_1",
+			EventType:  "subscription.active",
+			Subject:    "subscription:sub_0NVxY7hZq1",
+			Ordered:    true,
+			OccurredAt: time.Date(2025, 11, 2, 10, 15, 30, 0, time.UTC),
+		}},
+		{"dodo_refund_succeeded.json", inbound{
+			Provider:   ProviderDodo,
+			EventId:    "msg_1",
+			EventType:  "refund.succeeded",
+			OccurredAt: time.Date(2025, 11, 5, 8, 2, 11, 0, time.UTC),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := dodoInbound("msg_1", fixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.OccurredAt.Equal(tt.want.OccurredAt) {
+				t.Errorf("OccurredAt = %v, want %v", got.OccurredAt, tt.want.OccurredAt)
+			}
+			got.OccurredAt = tt.want.OccurredAt
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := dodoInbound("msg_1", []byte(`{"data":{}}`)); err == nil {
+		t.Error("expected an error for a payload without a type")
+	}
+}
+
+func TestRevenueCatInbound(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    inbound
+	}{
+		{"revenuecat_renewal.json", inbound{
+			Provider:   ProviderRevenueCat,
+			EventId:    "A8C4E5F1-2B7D-4E9A-9C3F-6D1E8B2A4C70",
+			EventType:  "RENEWAL",
+			Subject:    "usr_3f9a1c",
+			Ordered:    true,
+			OccurredAt: time.UnixMilli(1762078530000),
+		}},
+		{"revenuecat_cancellation.json", inbound{
+			Provider:   ProviderRevenueCat,
+			EventId:    "0D6E1C84-95A2-4F3B-8E7D-2C4B6A9F1E03",
+			EventType:  "CANCELLATION",
+			Subject:    "usr_3f9a1c",
+			Ordered:    true,
+			OccurredAt: time.UnixMilli(1762251330000),
+		}},
+		// Refunds apply whatever order they arrive in
+		{"revenuecat_cancellation_refund.json", inbound{
+			Provider:   ProviderRevenueCat,
+			EventId:    "F3B9D2A6-7C1E-4A58-B0D4-93E2C6A1F845",
+			EventType:  "CANCELLATION",
+			Subject:    "usr_3f9a1c",
+			Ordered:    false,
+			OccurredAt: time.UnixMilli(1762337730000),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			got, err := revenueCatInbound(fixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !got.OccurredAt.Equal(tt.want.OccurredAt) {
+				t.Errorf("OccurredAt = %v, want %v", got.OccurredAt, tt.want.OccurredAt)
+			}
+			got.OccurredAt = tt.want.OccurredAt
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := revenueCatInbound([]byte(`{"event":{"type":"RENEWAL"}}`)); err == nil {
+		t.Error("expected an error for an event without an id")
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	var skipped skipError
+	for _, err := range []error{nil, subscriptions.ErrAlreadyRecorded} {
+		if got := outcome(err); got != nil {
+			t.Errorf("outcome(%v) = %v, want nil", err, got)
+		}
+	}
+	for _, err := range []error{subscriptions.ErrNoSubscription, subscriptions.ErrNotPaused, subscriptions.ErrSamePlan} {
+		if got := outcome(err); !errors.As(got, &skipped) {
+			t.Errorf("outcome(%v) = %v, want a skip", err, got)
+		}
+	}
+	if got := outcome(errors.New("boom")); got == nil || errors.As(got, &skipped) {
+		t.Errorf("other errors should fail the event, got %v", got)
+	}
+}
+
+// Deliveries that fail verification are refused before anything is stored.
+func TestHandlersRejectUnverified(t *testing.T) {
+	app := fiber.New()
+	RegisterWebhookRoutes(app)
+
+	dodo := fixture(t, "dodo_subscription_active.json")
+	revcat := fixture(t, "revenuecat_renewal.json")
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		path    string
+		body    []byte
+		headers map[string]string
+		want    int
+	}{
+		{
+			name: "dodo without secret",
+			env:  map[string]string{"DODO_WEBHOOK_SECRET": ""},
+			path: "/webhooks/dodo",
+			body: dodo,
+			headers: map[string]string{
+				"webhook-id":        "msg_1",
+				"webhook-timestamp": now,
+				"webhook-signature": signDodo("msg_1", now, dodo),
+			},
+			want: fiber.StatusServiceUnavailable,
+		},
+		{
+			name: "dodo unsigned",
+			env:  map[string]string{"DODO_WEBHOOK_SECRET": testDodoSecret},
+			path: "/webhooks/dodo",
+			body: dodo,
+			want: fiber.StatusUnauthorized,
+		},
+		{
+			name: "dodo bad signature",
+			env:  map[string]string{"DODO_WEBHOOK_SECRET": testDodoSecret},
+			path: "/webhooks/dodo",
+			body: dodo,
+			headers: map[string]string{
+				"webhook-id":        "msg_1",
+				"webhook-timestamp": now,
+				"webhook-signature": signDodo("msg_1", now, revcat),
+			},
+			want: fiber.StatusUnauthorized,
+		},
+		{
+			name: "revenuecat without secret",
+			env:  map[string]string{"REVENUECAT_WEBHOOK_SECRET": ""},
+			path: "/webhooks/revenuecat",
+			body: revcat,
+			// Used to be accepted: an empty secret skipped the check
+			headers: map[string]string{"Authorization": "Bearer "},
+			want:    fiber.StatusServiceUnavailable,
+		},
+		{
+			name:    "revenuecat wrong secret",
+			env:     map[string]string{"REVENUECAT_WEBHOOK_SECRET": "rc-secret"},
+			path:    "/webhooks/revenuecat",
+			body:    revcat,
+			headers: map[string]string{"Authorization": "Bearer guess"},
+			want:    fiber.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(string(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+// The fake provider's deliveries must pass the same checks as Dodo's, carrying the
+// user the checkout was started for.
+func TestFakeCheckoutDeliversSignedWebhook(t *testing.T) {
+	type delivery struct {
+		in      inbound
+		payload DodoWebhookPayload
+	}
+	deliveries := make(chan delivery, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		id := r.Header.Get("webhook-id")
+		if err := verifyDodoSignature(testDodoSecret, id, r.Header.Get("webhook-timestamp"), r.Header.Get("webhook-signature"), body, time.Now()); err != nil {
+			t.Errorf("fake delivery failed verification: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		in, err := dodoInbound(id, body)
+		if err != nil {
+			t.Errorf("fake delivery didn't parse: %v", err)
+		}
+		var payload DodoWebhookPayload
+		json.Unmarshal(body, &payload)
+		deliveries <- delivery{in, payload}
+	}))
+	defer server.Close()
+
+	fake := payments.NewFakeProvider("http://spark.test"+payments.FakeCheckoutPath, server.URL, testDodoSecret)
+	checkout, err := fake.CreateCheckout(context.Background(), payments.CheckoutRequest{
+		UserId:        "usr_3f9a1c",
+		Email:         "maya@example.com",
+		PlanId:        subscriptions.PlanPro,
+		BillingPeriod: subscriptions.PeriodYearly,
+		ProductId:     "SPARK_pro_yearly",
+		ReturnURL:     "https://spark.test/paid",
+	})
+	if err != nil {
+		t.Fatalf("CreateCheckout: %v", err)
+	}
+	if !strings.HasPrefix(checkout.URL, "http://spark.test"+payments.FakeCheckoutPath+"/") {
+		t.Errorf("unexpected checkout URL %s", checkout.URL)
+	}
+
+	sub, returnURL, err := fake.Complete(context.Background(), checkout.SessionId)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if returnURL != "https://spark.test/paid" {
+		t.Errorf("return URL = %s", returnURL)
+	}
+
+	d := <-deliveries
+	if d.in.EventType != "subscription.active" || d.in.Subject != "subscription:"+sub.Id || !d.in.Ordered {
+		t.Errorf("unexpected event %+v", d.in)
+	}
+	if d.payload.Data.Metadata["user_id"] != "usr_3f9a1c" {
+		t.Errorf("user_id metadata = %q", d.payload.Data.Metadata["user_id"])
+	}
+	if plan, period, ok := payments.PlanForProduct(ProviderDodo, d.payload.Data.ProductId); !ok || plan != subscriptions.PlanPro || period != subscriptions.PeriodYearly {
+		t.Errorf("product %s maps to %s %s", d.payload.Data.ProductId, plan, period)
+	}
+	if end, err := time.Parse(time.RFC3339, d.payload.Data.NextBillingDate); err != nil || end.Sub(sub.CurrentPeriodStart) < 360*24*time.Hour {
+		t.Errorf("yearly subscription ends %s", d.payload.Data.NextBillingDate)
+	}
+
+	if _, _, err := fake.Complete(context.Background(), checkout.SessionId); !errors.Is(err, payments.ErrNotFound) {
+		t.Errorf("completing twice: got %v, want ErrNotFound", err)
+	}
+}
+
+// fakeSubscriptions stands in for the subscriptions processDodo changes.
+type fakeSubscriptions struct {
+	mu      sync.Mutex
+	subs    map[string]*models.UserSubscription // by provider subscription id
+	created int
+}
+
+func useFakeSubscriptions(t *testing.T) *fakeSubscriptions {
+	store := &fakeSubscriptions{subs: map[string]*models.UserSubscription{}}
+	prevFind, prevCreate, prevPause, prevResume := subscriptionByProviderID, createSubscription, pauseSubscription, resumeSubscription
+	subscriptionByProviderID = func(provider, providerSubID string) (*models.UserSubscription, error) {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		if sub, ok := store.subs[providerSubID]; ok {
+			found := *sub
+			return &found, nil
+		}
+		return nil, nil
+	}
+	createSubscription = func(userID, planID, provider, providerSubID, providerCustID string, periodStart, periodEnd time.Time) (*models.UserSubscription, error) {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.created++
+		sub := &models.UserSubscription{Id: providerSubID, UserId: userID, PlanId: planID, Status: "active", Provider: provider, ProviderSubscriptionId: providerSubID}
+		store.subs[providerSubID] = sub
+		return sub, nil
+	}
+	pauseSubscription = func(userID string, resumeAt *time.Time, providerEventID string) (*models.UserSubscription, error) {
+		return store.setStatus(userID, "active", "paused", subscriptions.ErrNoSubscription)
+	}
+	resumeSubscription = func(userID, providerEventID string) (*models.UserSubscription, error) {
+		return store.setStatus(userID, "paused", "active", subscriptions.ErrNotPaused)
+	}
+	t.Cleanup(func() {
+		subscriptionByProviderID, createSubscription, pauseSubscription, resumeSubscription = prevFind, prevCreate, prevPause, prevResume
+	})
+	return store
+}
+
+// setStatus moves the user's subscription from one status to another, like the
+// subscriptions package does, or fails with missing.
+func (s *fakeSubscriptions) setStatus(userID, from, to string, missing error) (*models.UserSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subs {
+		if sub.UserId == userID && sub.Status == from {
+			sub.Status = to
+			return sub, nil
+		}
+	}
+	return nil, missing
+}
+
+// Pauses and resumes made here are confirmed by the provider's webhooks afterwards,
+// and those must neither fail nor buy the subscription again.
+func TestPauseResumeWebhooks(t *testing.T) {
+	store := useFakeSubscriptions(t)
+	var skips []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := processDodo(&models.WebhookEvent{EventId: r.Header.Get("webhook-id"), Payload: string(body)})
+		var skipped skipError
+		if errors.As(err, &skipped) {
+			skips = append(skips, skipped.Error())
+		} else if err != nil {
+			t.Errorf("processDodo: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	fake := payments.NewFakeProvider("http://spark.test"+payments.FakeCheckoutPath, server.URL, testDodoSecret)
+	checkout, err := fake.CreateCheckout(ctx, payments.CheckoutRequest{
+		UserId:        "usr_3f9a1c",
+		Email:         "maya@example.com",
+		PlanId:        subscriptions.PlanPro,
+		BillingPeriod: subscriptions.PeriodMonthly,
+		ProductId:     "SPARK_pro_monthly",
+	})
+	if err != nil {
+		t.Fatalf("CreateCheckout: %v", err)
+	}
+	sub, _, err := fake.Complete(ctx, checkout.SessionId)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	status := func() string {
+		got, _ := subscriptionByProviderID(ProviderDodo, sub.Id)
+		if got == nil {
+			return ""
+		}
+		return got.Status
+	}
+
+	// Applied here first, then confirmed by the webhook
+	for _, step := range []struct {
+		want   string
+		local  func(string) (*models.UserSubscription, error)
+		remote func(context.Context, string) error
+	}{
+		{"paused", func(u string) (*models.UserSubscription, error) { return pauseSubscription(u, nil, "") }, fake.PauseSubscription},
+		{"active", func(u string) (*models.UserSubscription, error) { return resumeSubscription(u, "") }, fake.ResumeSubscription},
+	} {
+		if _, err := step.local("usr_3f9a1c"); err != nil {
+			t.Fatalf("applying %s: %v", step.want, err)
+		}
+		skips = nil
+		if err := step.remote(ctx, sub.Id); err != nil {
+			t.Fatalf("provider %s: %v", step.want, err)
+		}
+		if status() != step.want || len(skips) != 1 {
+			t.Errorf("after the %s webhook: status %q, skips %v", step.want, status(), skips)
+		}
+	}
+
+	// Resumed at the provider, with the webhook arriving before the local resume
+	if _, err := pauseSubscription("usr_3f9a1c", nil, ""); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	if err := fake.ResumeSubscription(ctx, sub.Id); err != nil {
+		t.Fatalf("provider resume: %v", err)
+	}
+	if status() != "active" {
+		t.Errorf("the webhook left the subscription %q", status())
+	}
+
+	if store.created != 1 {
+		t.Errorf("created %d subscriptions, want 1", store.created)
+	}
+}
+
+// Refunds staff make through the provider are recorded under the refund id its
+// webhook carries, so the webhook doesn't count them again.
+func TestFakeRefundWebhookCarriesRefundID(t *testing.T) {
+	refunds := make(chan DodoWebhookPayload, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload DodoWebhookPayload
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &payload)
+		if payload.Type == "refund.succeeded" {
+			refunds <- payload
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	fake := payments.NewFakeProvider("http://spark.test"+payments.FakeCheckoutPath, server.URL, testDodoSecret)
+	checkout, _ := fake.CreateCheckout(ctx, payments.CheckoutRequest{UserId: "usr_3f9a1c", ProductId: "SPARK_pro_monthly"})
+	sub, _, err := fake.Complete(ctx, checkout.SessionId)
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	refundID, err := fake.Refund(ctx, sub.Id, 499, "duplicate charge")
+	if err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	payload := <-refunds
+	if payload.Data.RefundId != refundID || payload.Data.SubscriptionId != sub.Id || payload.Data.Amount != 499 {
+		t.Errorf("refund webhook %+v doesn't match refund %s of %s", payload.Data, refundID, sub.Id)
+	}
+	if payload.Data.Metadata["user_id"] != "usr_3f9a1c" {
+		t.Errorf("user_id metadata = %q", payload.Data.Metadata["user_id"])
+	}
+
+	if _, err := fake.Refund(ctx, "sub_missing", 100, ""); !errors.Is(err, payments.ErrNotFound) {
+		t.Errorf("refunding an unknown subscription: got %v, want ErrNotFound", err)
+	}
+}
+
+const testTopicArn = "arn:aws:sns:us-east-1:123456789012:spark-ses"
+
+// snsSigner signs SNS messages with a self-signed certificate served from certURL.
+type snsSigner struct {
+	key     *rsa.PrivateKey
+	certURL string
+}
+
+func newSNSSigner(t *testing.T) *snsSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	// Every test gets its own URL so the certificate cache doesn't mix them up
+	certURL := "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-" + t.Name() + ".pem"
+	prev := fetchSNSCert
+	fetchSNSCert = func(url string) ([]byte, error) {
+		if url != certURL {
+			return nil, errors.New("unexpected certificate URL " + url)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+	}
+	t.Cleanup(func() {
+		fetchSNSCert = prev
+		snsCerts.Delete(certURL)
+	})
+	return &snsSigner{key: key, certURL: certURL}
+}
+
+func (s *snsSigner) sign(t *testing.T, msg snsMessage, version string) snsMessage {
+	t.Helper()
+	msg.SignatureVersion = version
+	msg.SigningCertURL = s.certURL
+	hash := crypto.SHA256
+	var digest []byte
+	if version == "1" {
+		sum := sha1.Sum([]byte(msg.stringToSign()))
+		hash, digest = crypto.SHA1, sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(msg.stringToSign()))
+		digest = sum[:]
+	}
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, hash, digest)
+	if err != nil {
+		t.Fatalf("SignPKCS1v15: %v", err)
+	}
+	msg.Signature = base64.StdEncoding.EncodeToString(sig)
+	return msg
+}
+
+func sesNotification(t *testing.T, name string, now time.Time) snsMessage {
+	return snsMessage{
+		Type:      snsNotification,
+		MessageId: "b6f1c2d3-" + strings.TrimSuffix(name, ".json"),
+		TopicArn:  testTopicArn,
+		Message:   string(fixture(t, name)),
+		Timestamp: now.UTC().Format(time.RFC3339),
+	}
+}
+
+func TestVerifySNSSignature(t *testing.T) {
+	signer := newSNSSigner(t)
+	now := time.Now()
+	msg := sesNotification(t, "ses_bounce.json", now)
+	v1 := signer.sign(t, msg, "1")
+	v2 := signer.sign(t, msg, "2")
+	confirmation := signer.sign(t, snsMessage{
+		Type:         snsSubscriptionConfirmation,
+		MessageId:    "c1",
+		Token:        "token",
+		TopicArn:     testTopicArn,
+		Message:      "You have chosen to subscribe to the topic",
+		SubscribeURL: "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=token",
+		Timestamp:    now.UTC().Format(time.RFC3339),
+	}, "1")
+
+	tampered := v2
+	tampered.Message = strings.Replace(tampered.Message, "gone@example.com", "someone@example.com", 1)
+	otherTopic := v2
+	otherTopic.TopicArn = "arn:aws:sns:us-east-1:999999999999:other"
+	foreignCert := v2
+	foreignCert.SigningCertURL = "https://sns.evil.example.com/cert.pem"
+	oldMsg := msg
+	oldMsg.Timestamp = now.Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	old := signer.sign(t, oldMsg, "2")
+	unsigned := msg
+	badVersion := v2
+	badVersion.SignatureVersion = "3"
+
+	tests := []struct {
+		name   string
+		topics string
+		msg    snsMessage
+		want   error
+	}{
+		{"valid v1", testTopicArn, v1, nil},
+		{"valid v2", testTopicArn, v2, nil},
+		{"valid among topics", "arn:aws:sns:eu-west-1:123456789012:other," + testTopicArn, v2, nil},
+		{"subscription confirmation", testTopicArn, confirmation, nil},
+		{"not configured", "", v2, ErrNotConfigured},
+		{"unsigned", testTopicArn, unsigned, ErrMissingSignature},
+		{"other topic", testTopicArn, otherTopic, ErrUnknownTopic},
+		{"tampered message", testTopicArn, tampered, ErrInvalidSignature},
+		{"certificate off SNS", testTopicArn, foreignCert, ErrInvalidSignature},
+		{"unknown version", testTopicArn, badVersion, ErrInvalidSignature},
+		{"too old", testTopicArn, old, ErrStaleTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifySNSSignature(tt.topics, tt.msg, now); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSESInbound(t *testing.T) {
+	now := time.Date(2025, 11, 2, 10, 15, 32, 0, time.UTC)
+	got, err := sesInbound(sesNotification(t, "ses_bounce.json", now))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := inbound{
+		Provider:   ProviderSES,
+		EventId:    "b6f1c2d3-ses_bounce",
+		EventType:  "Bounce",
+		Subject:    "gone@example.com",
+		OccurredAt: now,
+	}
+	if !got.OccurredAt.Equal(want.OccurredAt) {
+		t.Errorf("OccurredAt = %v, want %v", got.OccurredAt, want.OccurredAt)
+	}
+	got.OccurredAt = want.OccurredAt
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := sesInbound(snsMessage{MessageId: "m1", Message: `{"mail":{}}`}); err == nil {
+		t.Error("expected an error for a notification without a type")
+	}
+}
+
+func TestProcessSES(t *testing.T) {
+	type suppression struct{ email, reason string }
+	var suppressed []suppression
+	prev := suppressEmail
+	suppressEmail = func(email, reason, details string) error {
+		suppressed = append(suppressed, suppression{email, reason})
+		return nil
+	}
+	t.Cleanup(func() { suppressEmail = prev })
+
+	event := func(message string) *models.WebhookEvent {
+		payload, _ := json.Marshal(snsMessage{Type: snsNotification, MessageId: "m1", Message: message})
+		return &models.WebhookEvent{Provider: ProviderSES, Payload: string(payload)}
+	}
+	transient := strings.Replace(string(fixture(t, "ses_bounce.json")), `"Permanent"`, `"Transient"`, 1)
+	delivery := `{"eventType":"Delivery","mail":{"destination":["ok@example.com"]}}`
+
+	tests := []struct {
+		name    string
+		message string
+		want    []suppression
+		skipped bool
+	}{
+		{"permanent bounce", string(fixture(t, "ses_bounce.json")), []suppression{{"gone@example.com", "bounce"}}, false},
+		{"complaint", string(fixture(t, "ses_complaint.json")), []suppression{{"annoyed@example.com", "complaint"}}, false},
+		{"transient bounce", transient, nil, true},
+		{"delivery", delivery, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suppressed = nil
+			err := processSES(event(tt.message))
+			var skipped skipError
+			if got := errors.As(err, &skipped); got != tt.skipped {
+				t.Fatalf("err = %v, want skipped = %v", err, tt.skipped)
+			}
+			if !tt.skipped && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(suppressed) != len(tt.want) {
+				t.Fatalf("suppressed %v, want %v", suppressed, tt.want)
+			}
+			for i := range tt.want {
+				if suppressed[i] != tt.want[i] {
+					t.Errorf("suppressed %v, want %v", suppressed[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// The SNS subscription is confirmed once its signature checks out, and never for a
+// URL off SNS.
+func TestSESWebhookConfirmsSubscription(t *testing.T) {
+	signer := newSNSSigner(t)
+	t.Setenv("SES_SNS_TOPIC_ARN", testTopicArn)
+	var confirmed []string
+	prev := confirmSubscription
+	confirmSubscription = func(url string) error {
+		confirmed = append(confirmed, url)
+		return nil
+	}
+	t.Cleanup(func() { confirmSubscription = prev })
+
+	app := fiber.New()
+	RegisterWebhookRoutes(app)
+	post := func(msg snsMessage) int {
+		body, _ := json.Marshal(msg)
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/ses", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		return resp.StatusCode
+	}
+
+	msg := snsMessage{
+		Type:         snsSubscriptionConfirmation,
+		MessageId:    "c1",
+		Token:        "token",
+		TopicArn:     testTopicArn,
+		Message:      "You have chosen to subscribe to the topic",
+		SubscribeURL: "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&Token=token",
+		Timestamp:    time.Now().UTC().Format(time.RFC3339),
+	}
+	if status := post(signer.sign(t, msg, "1")); status != fiber.StatusOK {
+		t.Errorf("status = %d, want 200", status)
+	}
+	elsewhere := msg
+	elsewhere.SubscribeURL = "https://attacker.example.com/confirm"
+	if status := post(signer.sign(t, elsewhere, "1")); status != fiber.StatusBadRequest {
+		t.Errorf("status = %d, want 400", status)
+	}
+	if status := post(msg); status != fiber.StatusUnauthorized {
+		t.Errorf("unsigned: status = %d, want 401", status)
+	}
+	if len(confirmed) != 1 || confirmed[0] != msg.SubscribeURL {
+		t.Errorf("confirmed %v", confirmed)
+	}
+}
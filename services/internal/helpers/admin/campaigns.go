@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"spark/internal/models"
+
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+var campaignsList = listSpec[models.NotificationCampaign]{
+	selectExpr: "c.*",
+	from:       "notification_campaigns c",
+	idExpr:     "c.id",
+	sortColumns: map[string]sortColumn[models.NotificationCampaign]{
+		"created_at": {expr: "c.created_at", isTime: true, value: func(c models.NotificationCampaign) any { return c.CreatedAt }},
+	},
+	defaultSort: "created_at",
+	id:          func(c models.NotificationCampaign) string { return c.Id },
+}
+
+// ListCampaigns returns a page of notification campaigns, newest first.
+func ListCampaigns(status string, page Page) (*List[models.NotificationCampaign], error) {
+	var q query
+	if status != "" {
+		q.where("c.status = %s", status)
+	}
+
+	campaignORM := orm.Load(&models.NotificationCampaign{})
+	defer campaignORM.Close()
+
+	return campaignsList.run(campaignORM, q, nil, page)
+}
@@ -0,0 +1,213 @@
+// Package admin runs the filtered, sorted and paginated queries behind the admin dashboard.
+// Everything is done in SQL so that list pages never load whole tables into memory.
+package admin
+
+import (
+	"spark/internal/graph/model"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+const (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page selects which slice of a list to return. When Cursor is set the list continues
+// right after the row it points at (keyset pagination) and Page is ignored; otherwise
+// Page is a 1-based page number.
+type Page struct {
+	Cursor  string
+	Page    int
+	PerPage int
+}
+
+// List is one page of results. Total counts every row matching the filters, not just
+// this page. NextCursor is empty on the last page.
+type List[T any] struct {
+	Items      []T
+	Total      int
+	Page       int
+	PerPage    int
+	NextCursor string
+}
+
+// sortColumn is a column a list can be ordered by. value extracts the column's value
+// from a row so the next page's cursor can be built from the last row.
+type sortColumn[T any] struct {
+	expr   string
+	isTime bool
+	value  func(T) any
+}
+
+type cursor struct {
+	Field string `json:"f"`
+	Value string `json:"v"`
+	Id    string `json:"id"`
+}
+
+func encodeCursor(field string, value any, id string) string {
+	c := cursor{Field: field, Id: id}
+	switch v := value.(type) {
+	case time.Time:
+		c.Value = v.UTC().Format(time.RFC3339Nano)
+	default:
+		c.Value = fmt.Sprint(v)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Id == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// query collects WHERE conditions along with their positional arguments.
+type query struct {
+	conds []string
+	args  []any
+}
+
+// arg registers v and returns its placeholder.
+func (q *query) arg(v any) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// where adds a condition; every %s in format is replaced with a placeholder for the
+// matching value.
+func (q *query) where(format string, values ...any) {
+	placeholders := make([]any, len(values))
+	for i, v := range values {
+		placeholders[i] = q.arg(v)
+	}
+	q.conds = append(q.conds, fmt.Sprintf(format, placeholders...))
+}
+
+func (q *query) clause() string {
+	if len(q.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conds, " AND ")
+}
+
+// likePattern turns user input into a case-insensitive substring pattern for LIKE.
+func likePattern(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+// listSpec describes a paginated admin list.
+type listSpec[T any] struct {
+	selectExpr  string
+	from        string
+	idExpr      string
+	sortColumns map[string]sortColumn[T]
+	defaultSort string
+	id          func(T) string
+}
+
+// run counts the rows matching q, then fetches the requested page in the requested order.
+// Rows are always ordered by id after the sort column so that keyset pagination is stable.
+func (s listSpec[T]) run(o *orm.ORM, q query, sort *model.SortInput, page Page) (*List[T], error) {
+	field := s.defaultSort
+	desc := true
+	if sort != nil {
+		if _, ok := s.sortColumns[strings.ToLower(sort.Field)]; !ok {
+			return nil, fmt.Errorf("unsupported sort field: %s", sort.Field)
+		}
+		field = strings.ToLower(sort.Field)
+		desc = sort.Order != model.SortOrderAsc
+	}
+	col := s.sortColumns[field]
+
+	perPage := page.PerPage
+	if perPage <= 0 {
+		perPage = DefaultPerPage
+	}
+	if perPage > MaxPerPage {
+		perPage = MaxPerPage
+	}
+	pageNum := max(page.Page, 1)
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	total := 0
+	if err := db.QueryRow("SELECT COUNT(*) FROM "+s.from+q.clause(), q.args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count rows: %w", err)
+	}
+
+	offset := 0
+	if page.Cursor != "" {
+		c, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if c.Field != field {
+			return nil, fmt.Errorf("%w: cursor was issued for a different sort", ErrInvalidCursor)
+		}
+		var value any = c.Value
+		if col.isTime {
+			t, err := time.Parse(time.RFC3339Nano, c.Value)
+			if err != nil {
+				return nil, ErrInvalidCursor
+			}
+			value = t
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		q.where(fmt.Sprintf("(%s, %s) %s (%%s, %%s)", col.expr, s.idExpr, op), value, c.Id)
+		pageNum = 0
+	} else {
+		offset = (pageNum - 1) * perPage
+	}
+
+	dir := "ASC"
+	if desc {
+		dir = "DESC"
+	}
+	sql := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s %s, %s %s LIMIT %s OFFSET %s",
+		s.selectExpr, s.from, q.clause(), col.expr, dir, s.idExpr, dir, q.arg(perPage+1), q.arg(offset))
+
+	var rows []T
+	if err := o.QueryRaw(sql, q.args...).Scan(&rows); err != nil {
+		return nil, fmt.Errorf("failed to list rows: %w", err)
+	}
+
+	list := &List[T]{Total: total, Page: pageNum, PerPage: perPage}
+	if len(rows) > perPage {
+		rows = rows[:perPage]
+		last := rows[len(rows)-1]
+		list.NextCursor = encodeCursor(field, col.value(last), s.id(last))
+	}
+	list.Items = rows
+	if list.Items == nil {
+		list.Items = []T{}
+	}
+
+	return list, nil
+}
@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"spark/internal/graph/model"
+	"spark/internal/models"
+	"strings"
+
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+var reportsList = listSpec[models.Report]{
+	selectExpr: "r.*",
+	from:       "reports r",
+	idExpr:     "r.id",
+	sortColumns: map[string]sortColumn[models.Report]{
+		"created_at": {expr: "r.created_at", isTime: true, value: func(r models.Report) any { return r.CreatedAt }},
+		"updated_at": {expr: "r.updated_at", isTime: true, value: func(r models.Report) any { return r.UpdatedAt }},
+	},
+	defaultSort: "created_at",
+	id:          func(r models.Report) string { return r.Id },
+}
+
+var reportGroupsList = listSpec[models.ReportGroup]{
+	selectExpr: "g.*",
+	from:       "report_groups g",
+	idExpr:     "g.id",
+	sortColumns: map[string]sortColumn[models.ReportGroup]{
+		"priority":         {expr: "g.priority", value: func(g models.ReportGroup) any { return g.Priority }},
+		"last_reported_at": {expr: "g.last_reported_at", isTime: true, value: func(g models.ReportGroup) any { return g.LastReportedAt }},
+		"created_at":       {expr: "g.created_at", isTime: true, value: func(g models.ReportGroup) any { return g.CreatedAt }},
+	},
+	defaultSort: "priority",
+	id:          func(g models.ReportGroup) string { return g.Id },
+}
+
+// ListReports returns a page of reports. Search matches the reason and additional info.
+func ListReports(filters *model.AdminReportFilters, sort *model.SortInput, page Page) (*List[models.Report], error) {
+	var q query
+	if filters != nil {
+		if filters.Status != nil {
+			q.where("r.status = %s", *filters.Status)
+		}
+		if filters.ReporterID != nil {
+			q.where("r.user_id = %s", *filters.ReporterID)
+		}
+		if filters.TargetID != nil {
+			q.where("r.target_id = %s", *filters.TargetID)
+		}
+		if filters.Category != nil {
+			q.where("r.category = %s", *filters.Category)
+		}
+		if filters.GroupID != nil {
+			q.where("r.group_id = %s", *filters.GroupID)
+		}
+		if filters.Reason != nil {
+			q.where("r.reason = %s", *filters.Reason)
+		}
+		if filters.Search != nil && strings.TrimSpace(*filters.Search) != "" {
+			q.where(`lower(r.reason || ' ' || r.additional_info) LIKE %s ESCAPE '\'`, likePattern(*filters.Search))
+		}
+		if filters.CreatedAfter != nil {
+			q.where("r.created_at >= %s", *filters.CreatedAfter)
+		}
+		if filters.CreatedBefore != nil {
+			q.where("r.created_at <= %s", *filters.CreatedBefore)
+		}
+	}
+
+	reportORM := orm.Load(&models.Report{})
+	defer reportORM.Close()
+
+	return reportsList.run(reportORM, q, sort, page)
+}
+
+// ListReportGroups returns a page of the triage queue. Without a status filter only
+// unresolved groups are listed.
+func ListReportGroups(filters *model.AdminReportGroupFilters, sort *model.SortInput, page Page) (*List[models.ReportGroup], error) {
+	var q query
+	if filters == nil || filters.Status == nil {
+		q.where("g.status <> %s", "resolved")
+	}
+	if filters != nil {
+		if filters.Status != nil {
+			q.where("g.status = %s", *filters.Status)
+		}
+		if filters.Category != nil {
+			q.where("g.category = %s", *filters.Category)
+		}
+		if filters.SubjectID != nil {
+			q.where("g.subject_id = %s", *filters.SubjectID)
+		}
+		if filters.AssigneeID != nil {
+			q.where("g.assignee_id = %s", *filters.AssigneeID)
+		}
+		if filters.Escalated != nil {
+			if *filters.Escalated {
+				q.where("g.escalated_at IS NOT NULL")
+			} else {
+				q.where("g.escalated_at IS NULL")
+			}
+		}
+		if filters.MinPriority != nil {
+			q.where("g.priority >= %s", *filters.MinPriority)
+		}
+	}
+
+	groupORM := orm.Load(&models.ReportGroup{})
+	defer groupORM.Close()
+
+	return reportGroupsList.run(groupORM, q, sort, page)
+}
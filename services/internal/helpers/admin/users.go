@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"spark/internal/graph/model"
+	"spark/internal/models"
+	"fmt"
+	"strings"
+
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// userSearchExpr must match the expression of idx_users_search_trgm for the index to be used.
+const userSearchExpr = `lower(u.first_name || ' ' || u.last_name || ' ' || u.email)`
+
+var usersList = listSpec[models.User]{
+	selectExpr: "u.*",
+	from:       "users u",
+	idExpr:     "u.id",
+	sortColumns: map[string]sortColumn[models.User]{
+		"created_at": {expr: "u.created_at", isTime: true, value: func(u models.User) any { return u.CreatedAt }},
+		"first_name": {expr: "lower(u.first_name)", value: func(u models.User) any { return strings.ToLower(u.FirstName) }},
+		"last_name":  {expr: "lower(u.last_name)", value: func(u models.User) any { return strings.ToLower(u.LastName) }},
+		"email":      {expr: "lower(u.email)", value: func(u models.User) any { return strings.ToLower(u.Email) }},
+	},
+	defaultSort: "created_at",
+	id:          func(u models.User) string { return u.Id },
+}
+
+// ListUsers returns a page of users matching filters. Search matches a substring of the
+// name or email, or an exact user id.
+func ListUsers(filters *model.AdminUserFilters, sort *model.SortInput, page Page) (*List[models.User], error) {
+	var q query
+	if filters != nil {
+		if filters.Search != nil && strings.TrimSpace(*filters.Search) != "" {
+			q.where("("+userSearchExpr+` LIKE %s ESCAPE '\' OR u.id = %s)`, likePattern(*filters.Search), strings.TrimSpace(*filters.Search))
+		}
+		if filters.IsVerified != nil {
+			q.where("COALESCE(u.is_verified, false) = %s", *filters.IsVerified)
+		}
+		if filters.IsBanned != nil {
+			q.where("COALESCE(u.is_banned, false) = %s", *filters.IsBanned)
+		}
+		if filters.Role != nil {
+			q.where("COALESCE(u.role, 'user') = %s", *filters.Role)
+		}
+		if filters.SubscriptionPlanID != nil {
+			q.where("u.subscription_plan_id = %s", *filters.SubscriptionPlanID)
+		}
+		if filters.CreatedAfter != nil {
+			q.where("u.created_at >= %s", *filters.CreatedAfter)
+		}
+		if filters.CreatedBefore != nil {
+			q.where("u.created_at <= %s", *filters.CreatedBefore)
+		}
+	}
+
+	userORM := orm.Load(&models.User{})
+	defer userORM.Close()
+
+	return usersList.run(userORM, q, sort, page)
+}
+
+// UsersByIds loads several users in one query, keyed by id. Unknown ids are left out.
+func UsersByIds(ids []string) (map[string]*models.User, error) {
+	result := make(map[string]*models.User, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	var q query
+	placeholders := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		placeholders = append(placeholders, q.arg(id))
+	}
+	if len(placeholders) == 0 {
+		return result, nil
+	}
+
+	userORM := orm.Load(&models.User{})
+	defer userORM.Close()
+
+	var found []models.User
+	sql := fmt.Sprintf("SELECT * FROM users WHERE id IN (%s)", strings.Join(placeholders, ", "))
+	if err := userORM.QueryRaw(sql, q.args...).Scan(&found); err != nil {
+		return nil, fmt.Errorf("failed to load users: %w", err)
+	}
+	for i := range found {
+		result[found[i].Id] = &found[i]
+	}
+
+	return result, nil
+}
@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"spark/internal/graph/model"
+	"spark/internal/models"
+	"strings"
+
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+var verificationsList = listSpec[models.UserVerification]{
+	selectExpr: "v.*",
+	from:       "user_verifications v LEFT JOIN users u ON u.id = v.user_id",
+	idExpr:     "v.id",
+	sortColumns: map[string]sortColumn[models.UserVerification]{
+		"created_at": {expr: "v.created_at", isTime: true, value: func(v models.UserVerification) any { return v.CreatedAt }},
+		"updated_at": {expr: "v.updated_at", isTime: true, value: func(v models.UserVerification) any { return v.UpdatedAt }},
+	},
+	defaultSort: "created_at",
+	id:          func(v models.UserVerification) string { return v.Id },
+}
+
+// ListVerifications returns a page of verification requests. Search matches the
+// requesting user's name or email.
+func ListVerifications(filters *model.AdminVerificationFilters, sort *model.SortInput, page Page) (*List[models.UserVerification], error) {
+	var q query
+	if filters != nil {
+		if filters.Status != nil {
+			q.where("v.status = %s", *filters.Status)
+		}
+		if filters.UserID != nil {
+			q.where("v.user_id = %s", *filters.UserID)
+		}
+		if filters.Search != nil && strings.TrimSpace(*filters.Search) != "" {
+			q.where(userSearchExpr+` LIKE %s ESCAPE '\'`, likePattern(*filters.Search))
+		}
+		if filters.CreatedAfter != nil {
+			q.where("v.created_at >= %s", *filters.CreatedAfter)
+		}
+		if filters.CreatedBefore != nil {
+			q.where("v.created_at <= %s", *filters.CreatedBefore)
+		}
+	}
+
+	verORM := orm.Load(&models.UserVerification{})
+	defer verORM.Close()
+
+	return verificationsList.run(verORM, q, sort, page)
+}
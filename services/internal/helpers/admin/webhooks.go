@@ -0,0 +1,38 @@
+package admin
+
+import (
+	"spark/internal/models"
+
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+var webhookEventsList = listSpec[models.WebhookEvent]{
+	selectExpr: "w.*",
+	from:       "webhook_events w",
+	idExpr:     "w.id",
+	sortColumns: map[string]sortColumn[models.WebhookEvent]{
+		"received_at": {expr: "w.received_at", isTime: true, value: func(w models.WebhookEvent) any { return w.ReceivedAt }},
+		"occurred_at": {expr: "w.occurred_at", isTime: true, value: func(w models.WebhookEvent) any { return w.OccurredAt }},
+	},
+	defaultSort: "received_at",
+	id:          func(w models.WebhookEvent) string { return w.Id },
+}
+
+// ListWebhookEvents returns a page of payment webhook events, newest first.
+func ListWebhookEvents(provider, status, eventType string, page Page) (*List[models.WebhookEvent], error) {
+	var q query
+	if provider != "" {
+		q.where("w.provider = %s", provider)
+	}
+	if status != "" {
+		q.where("w.status = %s", status)
+	}
+	if eventType != "" {
+		q.where("w.event_type = %s", eventType)
+	}
+
+	eventORM := orm.Load(&models.WebhookEvent{})
+	defer eventORM.Close()
+
+	return webhookEventsList.run(eventORM, q, nil, page)
+}
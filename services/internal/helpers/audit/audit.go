@@ -0,0 +1,229 @@
+package audit
+
+import (
+	"spark/internal/models"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// Actions recorded in the admin audit log
+const (
+	ActionUserBan               = "user.ban"
+	ActionUserUnban             = "user.unban"
+	ActionUserWarn              = "user.warn"
+	ActionUserSuspend           = "user.suspend"
+	ActionUserShadowBan         = "user.shadow_ban"
+	ActionEnforcementLift       = "enforcement.lift"
+	ActionAppealReview          = "appeal.review"
+	ActionUserRoleChange        = "user.role_change"
+	ActionUserImpersonate       = "user.impersonate"
+	ActionImpersonatedRequest   = "impersonation.request"
+	ActionVerificationClaim     = "verification.claim"
+	ActionVerificationResolve   = "verification.resolve"
+	ActionReportResolve         = "report.resolve"
+	ActionReportAssign          = "report.assign"
+	ActionReportEscalate        = "report.escalate"
+	ActionNotificationBroadcast = "notification.broadcast"
+	ActionNotificationCancel    = "notification.cancel"
+	ActionSubscriptionGrant     = "subscription.grant"
+	ActionSubscriptionRefund    = "subscription.refund"
+	ActionWebhookReplay         = "webhook.replay"
+	ActionPlanCreate            = "plan.create"
+	ActionPlanUpdate            = "plan.update"
+	ActionPlanRetire            = "plan.retire"
+	ActionPromoCodeCreate       = "promo_code.create"
+	ActionPromoCodeDeactivate   = "promo_code.deactivate"
+)
+
+// Target types
+const (
+	TargetUser         = "user"
+	TargetVerification = "verification"
+	TargetReport       = "report"
+	TargetReportGroup  = "report_group"
+	TargetNotification = "notification"
+	TargetEnforcement  = "enforcement"
+	TargetAppeal       = "appeal"
+	TargetSubscription = "subscription"
+	TargetWebhookEvent = "webhook_event"
+	TargetPlan         = "plan"
+	TargetPromoCode    = "promo_code"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// Entry describes an admin action about to be recorded.
+type Entry struct {
+	ActorId    string
+	Action     string
+	TargetType string
+	TargetId   string
+	Before     any
+	After      any
+	Reason     string
+}
+
+// toMap converts a snapshot to the JSON object stored in the log.
+func toMap(v any) map[string]any {
+	if v == nil {
+		return map[string]any{}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return map[string]any{"error": err.Error()}
+	}
+	m := map[string]any{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		// Not an object, keep the raw value
+		var raw any
+		json.Unmarshal(data, &raw)
+		return map[string]any{"value": raw}
+	}
+	return m
+}
+
+// Record appends an entry to the audit log. Entries are never updated or deleted;
+// the table rejects both at the database level.
+func Record(e Entry) error {
+	entry := &models.AdminAuditEntry{
+		Id:         utils.GenerateID(),
+		ActorId:    e.ActorId,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetId:   e.TargetId,
+		Before:     toMap(e.Before),
+		After:      toMap(e.After),
+		Reason:     e.Reason,
+		CreatedAt:  time.Now(),
+	}
+
+	auditORM := orm.Load(&models.AdminAuditEntry{})
+	defer auditORM.Close()
+
+	if err := auditORM.Insert(entry); err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Filter narrows down List results. Empty fields match everything.
+type Filter struct {
+	ActorId  string
+	TargetId string
+	Action   string
+	Cursor   string
+	Limit    int
+}
+
+func encodeCursor(e *models.AdminAuditEntry) string {
+	raw := e.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + e.Id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	return t, id, nil
+}
+
+// List returns audit entries newest first, along with the cursor of the next page
+// (empty when there are no more entries).
+func List(f Filter) ([]*models.AdminAuditEntry, string, error) {
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	conds := []string{}
+	args := []any{}
+	add := func(cond string, v any) {
+		args = append(args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.ActorId != "" {
+		add("actor_id = $%d", f.ActorId)
+	}
+	if f.TargetId != "" {
+		add("target_id = $%d", f.TargetId)
+	}
+	if f.Action != "" {
+		add("action = $%d", f.Action)
+	}
+	if f.Cursor != "" {
+		ts, id, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, ts, id)
+		conds = append(conds, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `SELECT id, actor_id, action, target_type, target_id, before, after, reason, created_at FROM admin_audit_log`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]*models.AdminAuditEntry, 0, limit)
+	for rows.Next() {
+		var e models.AdminAuditEntry
+		var before, after []byte
+		var reason sql.NullString
+		if err := rows.Scan(&e.Id, &e.ActorId, &e.Action, &e.TargetType, &e.TargetId, &before, &after, &reason, &e.CreatedAt); err != nil {
+			return nil, "", fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		json.Unmarshal(before, &e.Before)
+		json.Unmarshal(after, &e.After)
+		e.Reason = reason.String
+		entries = append(entries, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("audit rows iteration error: %w", err)
+	}
+
+	next := ""
+	if len(entries) > limit {
+		entries = entries[:limit]
+		next = encodeCursor(entries[len(entries)-1])
+	}
+
+	return entries, next, nil
+}
@@ -0,0 +1,138 @@
+// Package campaigns stores push notification campaigns and delivers them. A campaign
+// targets an audience segment, can be scheduled for later and is sent in throttled
+// batches by the worker, which keeps per-campaign delivery stats as it goes.
+package campaigns
+
+import (
+	"spark/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// Campaign statuses
+const (
+	StatusScheduled = "scheduled"
+	StatusSending   = "sending"
+	StatusSent      = "sent"
+	StatusCancelled = "cancelled"
+	StatusFailed    = "failed"
+)
+
+const (
+	// DefaultThrottlePerMinute keeps a broadcast well under Expo's request limits
+	DefaultThrottlePerMinute = 6000
+	MinThrottlePerMinute     = 100
+	MaxThrottlePerMinute     = 60000
+	maxTitleLength           = 100
+	maxBodyLength            = 500
+	maxScheduleAhead         = 90 * 24 * time.Hour
+)
+
+var (
+	ErrNotFound         = errors.New("campaign not found")
+	ErrTitleRequired    = errors.New("title and body are required")
+	ErrTooLong          = fmt.Errorf("title must be at most %d and body at most %d characters", maxTitleLength, maxBodyLength)
+	ErrInvalidThrottle  = fmt.Errorf("throttle must be between %d and %d per minute", MinThrottlePerMinute, MaxThrottlePerMinute)
+	ErrInvalidSchedule  = errors.New("send time must be within the next 90 days")
+	ErrNotCancellable   = errors.New("only scheduled or sending campaigns can be cancelled")
+	ErrInvalidSignupSet = errors.New("signed_up_after must be before signed_up_before")
+)
+
+// Create schedules a campaign. A zero sendAt sends it as soon as the worker picks it up.
+func Create(title, body string, seg models.AudienceSegment, sendAt time.Time, throttlePerMinute int, createdBy string) (*models.NotificationCampaign, error) {
+	title, body = strings.TrimSpace(title), strings.TrimSpace(body)
+	if title == "" || body == "" {
+		return nil, ErrTitleRequired
+	}
+	if len(title) > maxTitleLength || len(body) > maxBodyLength {
+		return nil, ErrTooLong
+	}
+	if throttlePerMinute == 0 {
+		throttlePerMinute = DefaultThrottlePerMinute
+	}
+	if throttlePerMinute < MinThrottlePerMinute || throttlePerMinute > MaxThrottlePerMinute {
+		return nil, ErrInvalidThrottle
+	}
+	if seg.SignedUpAfter != nil && seg.SignedUpBefore != nil && !seg.SignedUpAfter.Before(*seg.SignedUpBefore) {
+		return nil, ErrInvalidSignupSet
+	}
+
+	now := time.Now()
+	if sendAt.IsZero() || sendAt.Before(now) {
+		sendAt = now
+	}
+	if sendAt.After(now.Add(maxScheduleAhead)) {
+		return nil, ErrInvalidSchedule
+	}
+	// Validates the segment before anything is stored
+	if _, err := newAudienceFilter(seg, now); err != nil {
+		return nil, err
+	}
+
+	c := &models.NotificationCampaign{
+		Id:                utils.GenerateID(),
+		Title:             title,
+		Body:              body,
+		Segment:           seg,
+		Status:            StatusScheduled,
+		SendAt:            sendAt,
+		ThrottlePerMinute: throttlePerMinute,
+		CreatedBy:         createdBy,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+
+	campaignORM := orm.Load(&models.NotificationCampaign{})
+	defer campaignORM.Close()
+	if err := campaignORM.Insert(c); err != nil {
+		return nil, fmt.Errorf("failed to create campaign: %w", err)
+	}
+	return c, nil
+}
+
+func Get(id string) (*models.NotificationCampaign, error) {
+	campaignORM := orm.Load(&models.NotificationCampaign{})
+	defer campaignORM.Close()
+
+	var cs []models.NotificationCampaign
+	if err := campaignORM.GetByFieldEquals("Id", id).Scan(&cs); err != nil {
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
+	if len(cs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &cs[0], nil
+}
+
+// Cancel stops a campaign. Batches already handed to Expo can't be recalled, but the
+// worker stops before the next one.
+func Cancel(id, reason string) (*models.NotificationCampaign, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	res, err := db.Exec(`
+		UPDATE notification_campaigns
+		SET status = $2, last_error = $3, completed_at = $4, locked_by = '', locked_until = NULL, updated_at = $4
+		WHERE id = $1 AND status IN ($5, $6)
+	`, id, StatusCancelled, strings.TrimSpace(reason), now, StatusScheduled, StatusSending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel campaign: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := Get(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotCancellable
+	}
+	return Get(id)
+}
@@ -0,0 +1,213 @@
+package campaigns
+
+import (
+	"spark/internal/helpers/notifications"
+	"spark/internal/helpers/subscriptions"
+	"spark/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+)
+
+// Segment presets
+const (
+	PresetAll         = "all"
+	PresetSubscribers = "subscribers"
+	PresetFree        = "free"
+	PresetInactive    = "inactive"
+)
+
+// InactiveAfter is how long without activity puts a user in the inactive preset.
+const InactiveAfter = 14 * 24 * time.Hour
+
+var ErrInvalidPreset = errors.New("invalid segment: preset must be all, subscribers, free or inactive")
+
+// Audience is the size of a segment.
+type Audience struct {
+	// Users matches the segment, whether or not they can receive pushes
+	Users int
+	// ReachableUsers have at least one active push token
+	ReachableUsers int
+	Devices        int
+}
+
+// audienceFilter turns a segment into SQL conditions on users u.
+type audienceFilter struct {
+	conds []string
+	args  []any
+}
+
+func (f *audienceFilter) arg(v any) string {
+	f.args = append(f.args, v)
+	return fmt.Sprintf("$%d", len(f.args))
+}
+
+func (f *audienceFilter) in(expr string, values []string) {
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = f.arg(v)
+	}
+	f.conds = append(f.conds, fmt.Sprintf("%s IN (%s)", expr, strings.Join(placeholders, ", ")))
+}
+
+func (f *audienceFilter) where() string {
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
+
+// wantsAnnouncements leaves out users who turned off announcements on channel.
+func wantsAnnouncements(channel string) string {
+	return `NOT EXISTS (SELECT 1 FROM notification_preferences np
+		WHERE np.user_id = u.id AND np.events->'` + notifications.EventAnnouncements + `'->>'` + channel + `' = 'false')`
+}
+
+// paidPlanExpr is the user's plan with missing plans counted as free.
+const paidPlanExpr = "COALESCE(NULLIF(u.subscription_plan_id, ''), '" + subscriptions.PlanFree + "')"
+
+func newAudienceFilter(seg models.AudienceSegment, now time.Time) (*audienceFilter, error) {
+	f := &audienceFilter{}
+	// Banned and suspended users never get campaigns
+	f.conds = append(f.conds,
+		"COALESCE(u.is_banned, false) = false",
+		"(u.suspended_until IS NULL OR u.suspended_until < "+f.arg(now)+")",
+	)
+
+	switch seg.Preset {
+	case "", PresetAll:
+	case PresetSubscribers:
+		f.conds = append(f.conds, paidPlanExpr+" <> "+f.arg(subscriptions.PlanFree))
+	case PresetFree:
+		f.conds = append(f.conds, paidPlanExpr+" = "+f.arg(subscriptions.PlanFree))
+	case PresetInactive:
+		f.conds = append(f.conds, "(u.last_active_at IS NULL OR u.last_active_at < "+f.arg(now.Add(-InactiveAfter))+")")
+	default:
+		return nil, ErrInvalidPreset
+	}
+
+	if len(seg.PlanIds) > 0 {
+		f.in(paidPlanExpr, seg.PlanIds)
+	}
+	if seg.ActiveWithinDays != nil {
+		f.conds = append(f.conds, "u.last_active_at >= "+f.arg(now.AddDate(0, 0, -*seg.ActiveWithinDays)))
+	}
+	if seg.InactiveForDays != nil {
+		f.conds = append(f.conds, "(u.last_active_at IS NULL OR u.last_active_at < "+f.arg(now.AddDate(0, 0, -*seg.InactiveForDays))+")")
+	}
+	if seg.Verified != nil {
+		f.conds = append(f.conds, "COALESCE(u.is_verified, false) = "+f.arg(*seg.Verified))
+	}
+	if len(seg.Genders) > 0 {
+		f.in("lower(u.gender)", lowered(seg.Genders))
+	}
+	if len(seg.Countries) > 0 {
+		f.in("lower(u.address->>'country')", lowered(seg.Countries))
+	}
+	if seg.SignedUpAfter != nil {
+		f.conds = append(f.conds, "u.created_at >= "+f.arg(*seg.SignedUpAfter))
+	}
+	if seg.SignedUpBefore != nil {
+		f.conds = append(f.conds, "u.created_at < "+f.arg(*seg.SignedUpBefore))
+	}
+	if len(seg.UserIds) > 0 {
+		f.in("u.id", seg.UserIds)
+	}
+	return f, nil
+}
+
+func lowered(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToLower(strings.TrimSpace(v))
+	}
+	return out
+}
+
+// Preview counts who a segment would reach right now.
+func Preview(seg models.AudienceSegment) (*Audience, error) {
+	f, err := newAudienceFilter(seg, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	f.conds = append(f.conds, wantsAnnouncements(notifications.ChannelPush))
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var a Audience
+	err = db.QueryRow(`
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE d.devices > 0), COALESCE(SUM(d.devices), 0)
+		FROM users u
+		LEFT JOIN LATERAL (
+			SELECT COUNT(*) AS devices FROM user_push_tokens t WHERE t.user_id = u.id AND t.is_active = true
+		) d ON true`+f.where(), f.args...).Scan(&a.Users, &a.ReachableUsers, &a.Devices)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count audience: %w", err)
+	}
+	return &a, nil
+}
+
+type pushTarget struct {
+	Id     string `db:"id"`
+	UserId string `db:"user_id"`
+	Token  string `db:"token"`
+}
+
+// nextTokens returns the next page of active push tokens in the segment after the
+// token id afterId. Paging by token id keeps delivery resumable.
+func nextTokens(seg models.AudienceSegment, now time.Time, afterId string, limit int) ([]pushTarget, error) {
+	f, err := newAudienceFilter(seg, now)
+	if err != nil {
+		return nil, err
+	}
+	f.conds = append(f.conds, wantsAnnouncements(notifications.ChannelPush), "t.is_active = true", "t.id > "+f.arg(afterId))
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var targets []pushTarget
+	err = db.Select(&targets, `
+		SELECT t.id, t.user_id, t.token FROM user_push_tokens t JOIN users u ON u.id = t.user_id`+f.where()+`
+		ORDER BY t.id LIMIT `+f.arg(limit), f.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load push tokens: %w", err)
+	}
+	return targets, nil
+}
+
+// addToInboxes puts c in the notification center of everyone in its segment who wants
+// announcements in the app. Entries are keyed by campaign, so a send resumed by another
+// worker doesn't add them twice.
+func addToInboxes(c *models.NotificationCampaign, now time.Time) (int, error) {
+	f, err := newAudienceFilter(c.Segment, now)
+	if err != nil {
+		return 0, err
+	}
+	f.conds = append(f.conds, wantsAnnouncements(notifications.ChannelInApp))
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	key := "campaign:" + c.Id
+	res, err := db.Exec(`
+		INSERT INTO notifications (id, user_id, event, title, body, link, dedupe_key, created_at)
+		SELECT `+f.arg(key+":")+` || u.id, u.id, `+f.arg(notifications.EventAnnouncements)+`, `+f.arg(c.Title)+`, `+
+		f.arg(c.Body)+`, `+f.arg(notifications.InboxLink)+`, `+f.arg(key)+`, `+f.arg(now)+`
+		FROM users u`+f.where()+`
+		ON CONFLICT DO NOTHING`, f.args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add campaign to notification centers: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
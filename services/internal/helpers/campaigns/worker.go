@@ -0,0 +1,291 @@
+package campaigns
+
+import (
+	"spark/internal/helpers/notifications"
+	"spark/internal/helpers/pushnotify"
+	"spark/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+)
+
+const (
+	pollInterval = 30 * time.Second
+	// lease is how long a worker owns a campaign without reporting progress. Another
+	// replica takes over an interrupted send once it expires.
+	lease = 2 * time.Minute
+	// batchSize is the most tokens Expo accepts in one request
+	batchSize = 100
+	// maxFailedBatches in a row marks the campaign failed rather than retrying forever
+	maxFailedBatches = 5
+)
+
+var kick = make(chan struct{}, 1)
+
+// Kick wakes the worker so a campaign that is due now doesn't wait for the next poll.
+func Kick() {
+	select {
+	case kick <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due campaigns until ctx is cancelled. It is safe to run on every
+// replica: each campaign is leased to one worker at a time.
+func Run(ctx context.Context) {
+	workerId := workerName()
+	log.Printf("[Campaigns] Worker %s started", workerId)
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			c, err := claim(workerId)
+			if err != nil {
+				log.Printf("[Campaigns] Failed to claim campaign: %v", err)
+				break
+			}
+			if c == nil {
+				break
+			}
+			deliver(ctx, workerId, c)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-kick:
+		}
+	}
+}
+
+func workerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%s", host, utils.GenerateID(6))
+}
+
+// claim leases the next due campaign to workerId: a scheduled one whose send time has
+// come, or one being sent by a worker whose lease ran out.
+func claim(workerId string) (*models.NotificationCampaign, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	var id string
+	err = db.QueryRow(`
+		UPDATE notification_campaigns
+		SET status = $1, locked_by = $2, locked_until = $3, started_at = COALESCE(started_at, $4), updated_at = $4
+		WHERE id = (
+			SELECT id FROM notification_campaigns
+			WHERE (status = $5 AND send_at <= $4)
+				OR (status = $1 AND (locked_until IS NULL OR locked_until < $4))
+			ORDER BY send_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`, StatusSending, workerId, now.Add(lease), now, StatusScheduled).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Get(id)
+}
+
+// deliver sends c in batches, spacing them to honour its throttle. Progress is saved
+// after every batch so a takeover resumes after the last delivered token.
+func deliver(ctx context.Context, workerId string, c *models.NotificationCampaign) {
+	if c.Cursor == "" && c.SentCount == 0 && c.FailedCount == 0 {
+		snapshotAudience(workerId, c)
+		if n, err := addToInboxes(c, time.Now()); err != nil {
+			log.Printf("[Campaigns] Failed to add %s to notification centers: %v", c.Id, err)
+		} else {
+			log.Printf("[Campaigns] Added %s to %d notification centers", c.Id, n)
+		}
+	}
+
+	notification := pushnotify.PushNotification{
+		Title: c.Title,
+		Body:  c.Body,
+		Data: map[string]interface{}{
+			"type":        "campaign",
+			"campaign_id": c.Id,
+		},
+	}
+	// A full batch every interval works out to ThrottlePerMinute tokens a minute
+	interval := time.Minute * batchSize / time.Duration(max(c.ThrottlePerMinute, MinThrottlePerMinute))
+
+	cursor := c.Cursor
+	failedBatches := 0
+	for {
+		targets, err := nextTokens(c.Segment, time.Now(), cursor, batchSize)
+		if err != nil {
+			// Leave the lease to expire so the send is retried
+			log.Printf("[Campaigns] Failed to load audience for %s: %v", c.Id, err)
+			return
+		}
+		if len(targets) == 0 {
+			finish(workerId, c.Id, StatusSent, "")
+			return
+		}
+
+		tokens, held := holdQuiet(targets, time.Now())
+		sent, failed, err := pushnotify.DefaultClient.Deliver(tokens, notification)
+		for userID, h := range held {
+			// The queue worker sends these once the user's quiet hours are over
+			if err := pushnotify.ScheduleTokens(userID, h.tokens, notification, h.at); err != nil {
+				log.Printf("[Campaigns] Failed to hold %s for user %s: %v", c.Id, userID, err)
+				failed += len(h.tokens)
+			} else {
+				sent += len(h.tokens)
+			}
+		}
+		lastError := ""
+		if err != nil {
+			lastError = err.Error()
+			failedBatches++
+		} else {
+			failedBatches = 0
+		}
+		cursor = targets[len(targets)-1].Id
+
+		ok, err := saveProgress(workerId, c.Id, sent, failed, cursor, lastError)
+		if err != nil {
+			log.Printf("[Campaigns] Failed to save progress for %s: %v", c.Id, err)
+			return
+		}
+		if !ok {
+			// Cancelled, or the lease went to another worker
+			log.Printf("[Campaigns] Stopped delivering %s", c.Id)
+			return
+		}
+		if failedBatches >= maxFailedBatches {
+			finish(workerId, c.Id, StatusFailed, lastError)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// heldTokens are a user's tokens in a batch that wait for their quiet hours to end
+type heldTokens struct {
+	tokens []string
+	at     time.Time
+}
+
+// holdQuiet splits a batch into the tokens to push now and, by user, the ones held
+// back because it's their quiet hours.
+func holdQuiet(targets []pushTarget, now time.Time) ([]string, map[string]*heldTokens) {
+	quiet := make(map[string]*heldTokens)
+	checked := make(map[string]bool)
+	tokens := make([]string, 0, len(targets))
+	for _, t := range targets {
+		if !checked[t.UserId] {
+			checked[t.UserId] = true
+			settings, err := notifications.GetSettings(t.UserId)
+			if err != nil {
+				log.Printf("[Campaigns] Failed to load settings for user %s, using defaults: %v", t.UserId, err)
+				settings = notifications.DefaultSettings(t.UserId)
+			}
+			if notifications.InQuietHours(settings, now) {
+				quiet[t.UserId] = &heldTokens{at: notifications.HeldUntil(settings, now)}
+			}
+		}
+		if h, ok := quiet[t.UserId]; ok {
+			h.tokens = append(h.tokens, t.Token)
+			continue
+		}
+		tokens = append(tokens, t.Token)
+	}
+	return tokens, quiet
+}
+
+// snapshotAudience records how many users and devices the campaign targets when it
+// starts, so delivery stats can be read against it.
+func snapshotAudience(workerId string, c *models.NotificationCampaign) {
+	a, err := Preview(c.Segment)
+	if err != nil {
+		log.Printf("[Campaigns] Failed to size audience for %s: %v", c.Id, err)
+		return
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		log.Printf("[Campaigns] Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`
+		UPDATE notification_campaigns SET target_users = $2, target_devices = $3, updated_at = $4
+		WHERE id = $1 AND locked_by = $5
+	`, c.Id, a.ReachableUsers, a.Devices, time.Now(), workerId); err != nil {
+		log.Printf("[Campaigns] Failed to store audience for %s: %v", c.Id, err)
+	}
+}
+
+// saveProgress adds a batch's results and extends the lease. It reports false once the
+// campaign is no longer being sent by workerId.
+func saveProgress(workerId, id string, sent, failed int, cursor, lastError string) (bool, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	res, err := db.Exec(`
+		UPDATE notification_campaigns
+		SET sent_count = sent_count + $2, failed_count = failed_count + $3, cursor = $4,
+			last_error = CASE WHEN $5 = '' THEN last_error ELSE $5 END,
+			locked_until = $6, updated_at = $7
+		WHERE id = $1 AND status = $8 AND locked_by = $9
+	`, id, sent, failed, cursor, lastError, now.Add(lease), now, StatusSending, workerId)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func finish(workerId, id, status, lastError string) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		log.Printf("[Campaigns] Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	now := time.Now()
+	if _, err := db.Exec(`
+		UPDATE notification_campaigns
+		SET status = $2, completed_at = $3, locked_by = '', locked_until = NULL,
+			last_error = CASE WHEN $4 = '' THEN last_error ELSE $4 END, updated_at = $3
+		WHERE id = $1 AND status = $5 AND locked_by = $6
+	`, id, status, now, lastError, StatusSending, workerId); err != nil {
+		log.Printf("[Campaigns] Failed to finish %s: %v", id, err)
+		return
+	}
+	log.Printf("[Campaigns] Campaign %s finished: %s", id, status)
+}
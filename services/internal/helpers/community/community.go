@@ -2,6 +2,7 @@ package community
 
 import (
 	"spark/internal/graph/model"
+	"spark/internal/helpers/moderation"
 	"spark/internal/models"
 	"context"
 	"fmt"
@@ -95,110 +96,69 @@ func GetPostById(postID string) (*models.Post, error) {
 	return &post, nil
 }
 
-func GetPosts(filter *model.PostFilterInput, sort *model.SortInput, limit int, offset int) ([]*models.Post, int, error) {
-	postORM := orm.Load(&models.Post{},
-		orm.WithCacheKey("spark:posts:list"),
-		orm.WithCacheOn(true),
-		orm.WithCacheTTL(2*time.Minute),
-		orm.WithCacheMethod(config.GetEnvRaw("CACHE_METHOD")),
-	)
-	defer postORM.Close()
-
-	query := "SELECT * FROM posts WHERE 1=1"
-	args := []any{}
-	argIndex := 1
+// postsFilter returns the WHERE clause and its arguments for the posts viewerID may
+// see that match filter. Authors always see their own posts, so a shadow ban stays
+// invisible to them.
+func postsFilter(viewerID string, filter *model.PostFilterInput) (string, []any) {
+	where := moderation.VisibleToSQL("posts.user_id", "$1")
+	args := []any{viewerID}
 
 	if filter != nil {
 		if filter.UserID != nil {
-			query += fmt.Sprintf(" AND user_id = $%d", argIndex)
+			where += fmt.Sprintf(" AND user_id = $%d", len(args)+1)
 			args = append(args, *filter.UserID)
-			argIndex++
 		}
 		if filter.SearchContent != nil {
-			query += fmt.Sprintf(" AND content ILIKE $%d", argIndex)
+			where += fmt.Sprintf(" AND content ILIKE $%d", len(args)+1)
 			args = append(args, "%"+*filter.SearchContent+"%")
-			argIndex++
 		}
 		if filter.CreatedAfter != nil {
-			query += fmt.Sprintf(" AND created_at >= $%d", argIndex)
+			where += fmt.Sprintf(" AND created_at >= $%d", len(args)+1)
 			args = append(args, *filter.CreatedAfter)
-			argIndex++
 		}
 		if filter.CreatedBefore != nil {
-			query += fmt.Sprintf(" AND created_at <= $%d", argIndex)
+			where += fmt.Sprintf(" AND created_at <= $%d", len(args)+1)
 			args = append(args, *filter.CreatedBefore)
-			argIndex++
 		}
 		if filter.MinLikes != nil {
-			query += fmt.Sprintf(" AND likes >= $%d", argIndex)
+			where += fmt.Sprintf(" AND likes >= $%d", len(args)+1)
 			args = append(args, *filter.MinLikes)
-			argIndex++
 		}
 		if filter.MinComments != nil {
-			query += fmt.Sprintf(" AND comments >= $%d", argIndex)
+			where += fmt.Sprintf(" AND comments >= $%d", len(args)+1)
 			args = append(args, *filter.MinComments)
-			argIndex++
 		}
 		if filter.MinViews != nil {
-			query += fmt.Sprintf(" AND views >= $%d", argIndex)
+			where += fmt.Sprintf(" AND views >= $%d", len(args)+1)
 			args = append(args, *filter.MinViews)
-			argIndex++
 		}
 		if filter.HasMedia != nil && *filter.HasMedia {
-			query += " AND media IS NOT NULL AND jsonb_array_length(media::jsonb) > 0"
+			where += " AND media IS NOT NULL AND jsonb_array_length(media::jsonb) > 0"
 		}
 	}
 
-	countQuery := "SELECT COUNT(*) FROM posts WHERE 1=1"
-	countArgs := []any{}
-	countArgIndex := 1
+	return where, args
+}
 
-	if filter != nil {
-		if filter.UserID != nil {
-			countQuery += fmt.Sprintf(" AND user_id = $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.UserID)
-			countArgIndex++
-		}
-		if filter.SearchContent != nil {
-			countQuery += fmt.Sprintf(" AND content ILIKE $%d", countArgIndex)
-			countArgs = append(countArgs, "%"+*filter.SearchContent+"%")
-			countArgIndex++
-		}
-		if filter.CreatedAfter != nil {
-			countQuery += fmt.Sprintf(" AND created_at >= $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.CreatedAfter)
-			countArgIndex++
-		}
-		if filter.CreatedBefore != nil {
-			countQuery += fmt.Sprintf(" AND created_at <= $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.CreatedBefore)
-			countArgIndex++
-		}
-		if filter.MinLikes != nil {
-			countQuery += fmt.Sprintf(" AND likes >= $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.MinLikes)
-			countArgIndex++
-		}
-		if filter.MinComments != nil {
-			countQuery += fmt.Sprintf(" AND comments >= $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.MinComments)
-			countArgIndex++
-		}
-		if filter.MinViews != nil {
-			countQuery += fmt.Sprintf(" AND views >= $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.MinViews)
-			countArgIndex++
-		}
-		if filter.HasMedia != nil && *filter.HasMedia {
-			countQuery += " AND media IS NOT NULL AND jsonb_array_length(media::jsonb) > 0"
-		}
-	}
+func GetPosts(viewerID string, filter *model.PostFilterInput, sort *model.SortInput, limit int, offset int) ([]*models.Post, int, error) {
+	postORM := orm.Load(&models.Post{},
+		orm.WithCacheKey("spark:posts:list"),
+		orm.WithCacheOn(true),
+		orm.WithCacheTTL(2*time.Minute),
+		orm.WithCacheMethod(config.GetEnvRaw("CACHE_METHOD")),
+	)
+	defer postORM.Close()
+
+	where, args := postsFilter(viewerID, filter)
+	query := "SELECT * FROM posts WHERE " + where
+	countQuery := "SELECT COUNT(*) FROM posts WHERE " + where
+	argIndex := len(args) + 1
 
 	total := 0
 	db, dbErr := database.PostgresConn()
 	if dbErr == nil {
 		defer db.Close()
-		_ = db.QueryRow(countQuery, countArgs...).Scan(&total)
+		_ = db.QueryRow(countQuery, args...).Scan(&total)
 	}
 
 	if sort != nil {
@@ -255,6 +215,7 @@ func GetFeedPosts(userID string, limit int, offset int) ([]*models.Post, int, er
 			(m.she_id = $1 AND p.user_id = m.he_id AND m.is_unlocked = true) OR
 			(m.he_id = $1 AND p.user_id = m.she_id AND m.is_unlocked = true)
 		)
+		WHERE p.user_id = $1 OR NOT ` + moderation.HiddenUserSQL("p.user_id") + `
 		ORDER BY
 			CASE
 				WHEN p.user_id = $1 THEN 3
@@ -265,13 +226,13 @@ func GetFeedPosts(userID string, limit int, offset int) ([]*models.Post, int, er
 		LIMIT $2 OFFSET $3
 	`
 
-	countQuery := `SELECT COUNT(*) FROM posts`
+	countQuery := `SELECT COUNT(*) FROM posts WHERE user_id = $1 OR NOT ` + moderation.HiddenUserSQL("posts.user_id")
 
 	total := 0
 	db, dbErr := database.PostgresConn()
 	if dbErr == nil {
 		defer db.Close()
-		_ = db.QueryRow(countQuery).Scan(&total)
+		_ = db.QueryRow(countQuery, userID).Scan(&total)
 	}
 	defer db.Close()
 
@@ -302,15 +263,14 @@ func GetTrendingPosts(timeWindow int, limit int, offset int) ([]*models.Post, in
 
 	query := `
 		SELECT * FROM posts
-		WHERE created_at >= $1
+		WHERE created_at >= $1 AND NOT ` + moderation.HiddenUserSQL("posts.user_id") + `
 		ORDER BY (likes * 2 + comments * 3 + views) DESC
 		LIMIT $2 OFFSET $3
 	`
 
 	countQuery := `
 		SELECT COUNT(*) FROM posts
-		WHERE created_at >= $1
-	`
+		WHERE created_at >= $1 AND NOT ` + moderation.HiddenUserSQL("posts.user_id")
 
 	total := 0
 	db, dbErr := database.PostgresConn()
@@ -398,110 +358,68 @@ func GetCommentById(commentID string) (*models.Comment, error) {
 	return &comment, nil
 }
 
-func GetComments(filter *model.CommentFilterInput, sort *model.SortInput, limit int, offset int) ([]*models.Comment, int, error) {
-	commentORM := orm.Load(&models.Comment{},
-		orm.WithCacheKey("spark:comments:list"),
-		orm.WithCacheOn(true),
-		orm.WithCacheTTL(2*time.Minute),
-		orm.WithCacheMethod(config.GetEnvRaw("CACHE_METHOD")),
-	)
-	defer commentORM.Close()
-
-	query := "SELECT * FROM comments WHERE 1=1"
-	args := []any{}
-	argIndex := 1
+// commentsFilter returns the WHERE clause and its arguments for the comments viewerID
+// may see that match filter. Authors always see their own comments.
+func commentsFilter(viewerID string, filter *model.CommentFilterInput) (string, []any) {
+	where := moderation.VisibleToSQL("comments.user_id", "$1")
+	args := []any{viewerID}
 
 	if filter != nil {
 		if filter.PostID != nil {
-			query += fmt.Sprintf(" AND post_id = $%d", argIndex)
+			where += fmt.Sprintf(" AND post_id = $%d", len(args)+1)
 			args = append(args, *filter.PostID)
-			argIndex++
 		}
 		if filter.UserID != nil {
-			query += fmt.Sprintf(" AND user_id = $%d", argIndex)
+			where += fmt.Sprintf(" AND user_id = $%d", len(args)+1)
 			args = append(args, *filter.UserID)
-			argIndex++
 		}
 		if filter.ReplyToID != nil {
-			query += fmt.Sprintf(" AND reply_to_id = $%d", argIndex)
+			where += fmt.Sprintf(" AND reply_to_id = $%d", len(args)+1)
 			args = append(args, *filter.ReplyToID)
-			argIndex++
 		}
 		if filter.ParentOnly != nil && *filter.ParentOnly {
-			query += " AND (reply_to_id = '' OR reply_to_id IS NULL)"
+			where += " AND (reply_to_id = '' OR reply_to_id IS NULL)"
 		}
 		if filter.SearchContent != nil {
-			query += fmt.Sprintf(" AND content ILIKE $%d", argIndex)
+			where += fmt.Sprintf(" AND content ILIKE $%d", len(args)+1)
 			args = append(args, "%"+*filter.SearchContent+"%")
-			argIndex++
 		}
 		if filter.CreatedAfter != nil {
-			query += fmt.Sprintf(" AND created_at >= $%d", argIndex)
+			where += fmt.Sprintf(" AND created_at >= $%d", len(args)+1)
 			args = append(args, *filter.CreatedAfter)
-			argIndex++
 		}
 		if filter.CreatedBefore != nil {
-			query += fmt.Sprintf(" AND created_at <= $%d", argIndex)
+			where += fmt.Sprintf(" AND created_at <= $%d", len(args)+1)
 			args = append(args, *filter.CreatedBefore)
-			argIndex++
 		}
 		if filter.MinLikes != nil {
-			query += fmt.Sprintf(" AND likes >= $%d", argIndex)
+			where += fmt.Sprintf(" AND likes >= $%d", len(args)+1)
 			args = append(args, *filter.MinLikes)
-			argIndex++
 		}
 	}
 
-	countQuery := "SELECT COUNT(*) FROM comments WHERE 1=1"
-	countArgs := []any{}
-	countArgIndex := 1
+	return where, args
+}
 
-	if filter != nil {
-		if filter.PostID != nil {
-			countQuery += fmt.Sprintf(" AND post_id = $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.PostID)
-			countArgIndex++
-		}
-		if filter.UserID != nil {
-			countQuery += fmt.Sprintf(" AND user_id = $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.UserID)
-			countArgIndex++
-		}
-		if filter.ReplyToID != nil {
-			countQuery += fmt.Sprintf(" AND reply_to_id = $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.ReplyToID)
-			countArgIndex++
-		}
-		if filter.ParentOnly != nil && *filter.ParentOnly {
-			countQuery += " AND (reply_to_id = '' OR reply_to_id IS NULL)"
-		}
-		if filter.SearchContent != nil {
-			countQuery += fmt.Sprintf(" AND content ILIKE $%d", countArgIndex)
-			countArgs = append(countArgs, "%"+*filter.SearchContent+"%")
-			countArgIndex++
-		}
-		if filter.CreatedAfter != nil {
-			countQuery += fmt.Sprintf(" AND created_at >= $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.CreatedAfter)
-			countArgIndex++
-		}
-		if filter.CreatedBefore != nil {
-			countQuery += fmt.Sprintf(" AND created_at <= $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.CreatedBefore)
-			countArgIndex++
-		}
-		if filter.MinLikes != nil {
-			countQuery += fmt.Sprintf(" AND likes >= $%d", countArgIndex)
-			countArgs = append(countArgs, *filter.MinLikes)
-			countArgIndex++
-		}
-	}
+func GetComments(viewerID string, filter *model.CommentFilterInput, sort *model.SortInput, limit int, offset int) ([]*models.Comment, int, error) {
+	commentORM := orm.Load(&models.Comment{},
+		orm.WithCacheKey("spark:comments:list"),
+		orm.WithCacheOn(true),
+		orm.WithCacheTTL(2*time.Minute),
+		orm.WithCacheMethod(config.GetEnvRaw("CACHE_METHOD")),
+	)
+	defer commentORM.Close()
+
+	where, args := commentsFilter(viewerID, filter)
+	query := "SELECT * FROM comments WHERE " + where
+	countQuery := "SELECT COUNT(*) FROM comments WHERE " + where
+	argIndex := len(args) + 1
 
 	total := 0
 	db, dbErr := database.PostgresConn()
 	if dbErr == nil {
 		defer db.Close()
-		_ = db.QueryRow(countQuery, countArgs...).Scan(&total)
+		_ = db.QueryRow(countQuery, args...).Scan(&total)
 	}
 
 	if sort != nil {
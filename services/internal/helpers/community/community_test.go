@@ -0,0 +1,46 @@
+package community
+
+import (
+	"spark/internal/graph/model"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// A shadow banned author must still see their own posts and comments, or the ban
+// gives itself away. The hidden-user check is skipped when the author is the viewer.
+func TestFiltersShowAuthorsTheirOwnContent(t *testing.T) {
+	author := "usr_shadow"
+	likes := int32(3)
+
+	tests := []struct {
+		name  string
+		col   string
+		build func() (string, []any)
+	}{
+		{"posts", "posts.user_id", func() (string, []any) {
+			return postsFilter(author, &model.PostFilterInput{UserID: &author, MinLikes: &likes})
+		}},
+		{"comments", "comments.user_id", func() (string, []any) {
+			return commentsFilter(author, &model.CommentFilterInput{UserID: &author, MinLikes: &likes})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args := tt.build()
+			if !strings.HasPrefix(where, fmt.Sprintf("(%s = $1 OR NOT EXISTS", tt.col)) {
+				t.Errorf("the viewer's own rows aren't exempt from hiding: %s", where)
+			}
+			if len(args) != 3 || args[0] != author {
+				t.Fatalf("args = %v, want the viewer first", args)
+			}
+			if !strings.Contains(where, "user_id = $2") || !strings.Contains(where, "likes >= $3") {
+				t.Errorf("filters aren't numbered after the viewer: %s", where)
+			}
+		})
+	}
+
+	if where, args := postsFilter(author, nil); len(args) != 1 || strings.Contains(where, "$2") {
+		t.Errorf("no filter: %s %v", where, args)
+	}
+}
@@ -0,0 +1,121 @@
+// Package impersonation lets support staff view the app as a user to reproduce their
+// problems. Sessions are read-only, expire after SessionTTL, stop working as soon as
+// the staff member loses the permission, and every request made with one is audited.
+package impersonation
+
+import (
+	"spark/internal/auth"
+	"spark/internal/helpers/audit"
+	"spark/internal/helpers/rbac"
+	"spark/internal/helpers/reporting"
+	"spark/internal/helpers/users"
+	"spark/internal/models"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/utils"
+)
+
+// SessionTTL is how long an impersonation token stays valid.
+const SessionTTL = 15 * time.Minute
+
+// HiddenContent replaces message content the impersonator isn't allowed to read.
+const HiddenContent = "[hidden while impersonating]"
+
+var (
+	ErrReasonRequired = errors.New("a reason is required to impersonate a user")
+	ErrSelf           = errors.New("you can't impersonate yourself")
+	ErrStaff          = errors.New("staff accounts can't be impersonated")
+	ErrReadOnly       = errors.New("impersonation sessions are read-only")
+	ErrNotAllowed     = errors.New("not available while impersonating")
+)
+
+// Session is an issued impersonation token.
+type Session struct {
+	Id        string
+	ActorId   string
+	User      *models.User
+	Token     string
+	ExpiresAt time.Time
+}
+
+// Start issues a read-only token for actorId to act as userId.
+func Start(actorId, userId, reason string) (*Session, error) {
+	if strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+	if actorId == userId {
+		return nil, ErrSelf
+	}
+
+	user, err := users.GetUserByID(userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	// Borrowing a staff account's view would expose the admin tools behind it
+	if role, err := rbac.GetRole(userId); err != nil {
+		return nil, err
+	} else if role != rbac.RoleUser {
+		return nil, ErrStaff
+	}
+
+	s := &Session{
+		Id:        utils.GenerateID(12),
+		ActorId:   actorId,
+		User:      user,
+		ExpiresAt: time.Now().Add(SessionTTL),
+	}
+	if s.Token, err = auth.CreateImpersonationJWT(*user, actorId, s.Id, s.ExpiresAt); err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+	return s, nil
+}
+
+// Authorize checks a request made with an impersonation token and records it in the
+// audit log. Only queries are allowed, and only while the staff member still holds
+// the impersonate permission.
+func Authorize(claims *models.Claims, operation, operationName, field string) error {
+	if operation != "query" {
+		return ErrReadOnly
+	}
+	if err := rbac.Check(claims.ImpersonatedBy, rbac.UsersImpersonate); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := audit.Record(audit.Entry{
+			ActorId:    claims.ImpersonatedBy,
+			Action:     audit.ActionImpersonatedRequest,
+			TargetType: audit.TargetUser,
+			TargetId:   claims.UserID,
+			After: map[string]any{
+				"session_id": claims.ImpersonationId,
+				"operation":  operationName,
+				"field":      field,
+			},
+		}); err != nil {
+			log.Printf("[Impersonation] Failed to audit request by %s as %s: %v", claims.ImpersonatedBy, claims.UserID, err)
+		}
+	}()
+	return nil
+}
+
+// CanReadChat reports whether the caller may see message content in chatId. Users
+// always can; impersonators only while a pending report was filed from the chat.
+func CanReadChat(claims *models.Claims, chatId string) bool {
+	if !claims.IsImpersonation() {
+		return true
+	}
+	if chatId == "" {
+		return false
+	}
+	open, err := reporting.ChatHasOpenReport(chatId)
+	if err != nil {
+		log.Printf("[Impersonation] Failed to check reports for chat %s: %v", chatId, err)
+		return false
+	}
+	return open
+}
@@ -0,0 +1,87 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os/exec"
+)
+
+const (
+	// Audio is decoded to mono 16-bit PCM at this rate for analysis
+	analysisSampleRate = 8000
+	// WaveformBars is the number of amplitude samples returned for a voice note
+	WaveformBars = 64
+)
+
+// AudioMetadata describes an uploaded audio file.
+type AudioMetadata struct {
+	DurationMs int
+	Waveform   []float64
+}
+
+// ExtractAudioMetadata decodes the audio file at path with ffmpeg and returns its
+// duration and a normalised peak waveform.
+func ExtractAudioMetadata(path string) (*AudioMetadata, error) {
+	cmd := exec.Command("ffmpeg",
+		"-v", "error",
+		"-i", path,
+		"-vn",
+		"-ac", "1",
+		"-ar", fmt.Sprint(analysisSampleRate),
+		"-f", "s16le",
+		"-",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %w, output: %s", err, stderr.String())
+	}
+
+	samples := make([]int16, stdout.Len()/2)
+	if err := binary.Read(bytes.NewReader(stdout.Bytes()[:len(samples)*2]), binary.LittleEndian, samples); err != nil {
+		return nil, fmt.Errorf("failed to read samples: %w", err)
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no audio samples decoded")
+	}
+
+	return &AudioMetadata{
+		DurationMs: len(samples) * 1000 / analysisSampleRate,
+		Waveform:   buildWaveform(samples, WaveformBars),
+	}, nil
+}
+
+// buildWaveform splits samples into bars buckets and returns each bucket's peak,
+// scaled so the loudest bucket is 1.
+func buildWaveform(samples []int16, bars int) []float64 {
+	if len(samples) < bars {
+		bars = len(samples)
+	}
+	waveform := make([]float64, bars)
+	if bars == 0 {
+		return waveform
+	}
+
+	loudest := 0.0
+	for i := range waveform {
+		start := i * len(samples) / bars
+		end := (i + 1) * len(samples) / bars
+		peak := 0.0
+		for _, s := range samples[start:end] {
+			peak = math.Max(peak, math.Abs(float64(s)))
+		}
+		waveform[i] = peak
+		loudest = math.Max(loudest, peak)
+	}
+
+	for i := range waveform {
+		if loudest > 0 {
+			waveform[i] = math.Round(waveform[i]/loudest*100) / 100
+		}
+	}
+
+	return waveform
+}
@@ -0,0 +1,219 @@
+package media
+
+import (
+	"spark/internal/models"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+var (
+	ErrFileNotFound        = errors.New("file not found")
+	ErrFileNotOwned        = errors.New("file was not uploaded by this user")
+	ErrUnsupportedMimeType = errors.New("unsupported file type")
+	ErrFileTooLarge        = errors.New("file is too large")
+	ErrAudioTooLong        = errors.New("voice note is too long")
+)
+
+// MaxVoiceNoteDurationMs caps the length of audio messages.
+const MaxVoiceNoteDurationMs = 5 * 60 * 1000
+
+type rule struct {
+	mimePrefixes []string
+	maxSize      int64
+}
+
+// rules lists what each media message type accepts. An empty prefix list allows any type.
+var rules = map[models.MessageType]rule{
+	models.IMAGE: {
+		mimePrefixes: []string{"image/jpeg", "image/png", "image/webp", "image/gif", "image/heic", "image/heif"},
+		maxSize:      20 * 1024 * 1024,
+	},
+	models.VIDEO: {
+		mimePrefixes: []string{"video/mp4", "video/quicktime", "video/webm"},
+		maxSize:      200 * 1024 * 1024,
+	},
+	models.AUDIO: {
+		mimePrefixes: []string{"audio/"},
+		maxSize:      25 * 1024 * 1024,
+	},
+	models.FILE: {
+		maxSize: 50 * 1024 * 1024,
+	},
+}
+
+// IsMediaType reports whether messages of type t carry media.
+func IsMediaType(t models.MessageType) bool {
+	_, ok := rules[t]
+	return ok
+}
+
+// DetectMimeType sniffs the MIME type of an uploaded file. Containers that
+// http.DetectContentType can't tell apart from video (m4a, aac) fall back to the
+// extension when it maps to an audio type.
+func DetectMimeType(filename string, head []byte) string {
+	if t := heifType(head); t != "" {
+		return t
+	}
+	sniffed := http.DetectContentType(head)
+	if i := strings.Index(sniffed, ";"); i != -1 {
+		sniffed = sniffed[:i]
+	}
+
+	byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
+	if i := strings.Index(byExt, ";"); i != -1 {
+		byExt = byExt[:i]
+	}
+
+	if strings.HasPrefix(byExt, "audio/") && (sniffed == "video/mp4" || sniffed == "application/octet-stream") {
+		return byExt
+	}
+
+	return sniffed
+}
+
+// heifType recognizes HEIC and HEIF images, such as iPhone photos, by the brands in
+// their ftyp box, which http.DetectContentType doesn't know.
+func heifType(head []byte) string {
+	if len(head) < 12 || string(head[4:8]) != "ftyp" {
+		return ""
+	}
+	size := int(binary.BigEndian.Uint32(head[:4]))
+	if size > len(head) {
+		size = len(head)
+	}
+	major := string(head[8:12])
+	compatible := make(map[string]bool)
+	for i := 16; i+4 <= size; i += 4 {
+		compatible[string(head[i:i+4])] = true
+	}
+
+	switch major {
+	case "heic", "heix", "heim", "heis", "hevc", "hevx":
+		return "image/heic"
+	case "mif1", "msf1", "heif":
+		// Other image formats, like AVIF, share the generic HEIF brands
+		for _, brand := range []string{"heic", "heix", "heim", "heis"} {
+			if compatible[brand] {
+				return "image/heic"
+			}
+		}
+		if compatible["avif"] || compatible["avis"] {
+			return ""
+		}
+		return "image/heif"
+	}
+	return ""
+}
+
+// Validate checks that file can be attached to a message of type t by uid.
+func Validate(file *models.UserFiles, uid string, t models.MessageType) error {
+	r, ok := rules[t]
+	if !ok {
+		return fmt.Errorf("%w: %s messages can't carry media", ErrUnsupportedMimeType, t)
+	}
+
+	if file.Uid != uid {
+		return ErrFileNotOwned
+	}
+
+	if len(r.mimePrefixes) > 0 {
+		allowed := false
+		for _, prefix := range r.mimePrefixes {
+			if strings.HasPrefix(file.MimeType, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: %q for %s message", ErrUnsupportedMimeType, file.MimeType, t)
+		}
+	}
+
+	if file.Size <= 0 || file.Size > r.maxSize {
+		return fmt.Errorf("%w: %d bytes (max %d)", ErrFileTooLarge, file.Size, r.maxSize)
+	}
+
+	if t == models.AUDIO && file.DurationMs > MaxVoiceNoteDurationMs {
+		return ErrAudioTooLong
+	}
+
+	return nil
+}
+
+// GetUserFile loads an uploaded file record by id.
+func GetUserFile(fileId string) (*models.UserFiles, error) {
+	fileORM := orm.Load(&models.UserFiles{})
+	defer fileORM.Close()
+
+	var files []models.UserFiles
+	if err := fileORM.GetByFieldEquals("Id", fileId).Scan(&files); err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, ErrFileNotFound
+	}
+
+	return &files[0], nil
+}
+
+// OwnedFilesByPath returns the files uid uploaded at the given storage paths, keyed by
+// path. Paths uid didn't upload are left out.
+func OwnedFilesByPath(uid string, paths []string) (map[string]*models.UserFiles, error) {
+	result := make(map[string]*models.UserFiles, len(paths))
+	if len(paths) == 0 {
+		return result, nil
+	}
+
+	args := []any{uid}
+	placeholders := make([]string, 0, len(paths))
+	for _, p := range paths {
+		args = append(args, p)
+		placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+	}
+
+	fileORM := orm.Load(&models.UserFiles{})
+	defer fileORM.Close()
+
+	var files []models.UserFiles
+	query := fmt.Sprintf("SELECT * FROM user_files WHERE uid = $1 AND s3_path IN (%s)", strings.Join(placeholders, ", "))
+	if err := fileORM.QueryRaw(query, args...).Scan(&files); err != nil {
+		return nil, fmt.Errorf("failed to get files: %w", err)
+	}
+	for i := range files {
+		result[files[i].S3Path] = &files[i]
+	}
+
+	return result, nil
+}
+
+// ResolveMessageMedia turns an uploaded file id into message media, after checking
+// that uid owns it and that it fits a message of type t.
+func ResolveMessageMedia(fileId string, uid string, t models.MessageType) (*models.Media, error) {
+	file, err := GetUserFile(fileId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Validate(file, uid, t); err != nil {
+		return nil, err
+	}
+
+	return &models.Media{
+		Id:         file.Id,
+		FileId:     file.Id,
+		Type:       string(t),
+		Url:        file.S3Path,
+		MimeType:   file.MimeType,
+		Size:       file.Size,
+		DurationMs: file.DurationMs,
+		Waveform:   file.Waveform,
+		CreatedAt:  file.CreatedAt,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package media
+
+import (
+	"spark/internal/models"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ftyp builds the start of an ISO media file with the given brands.
+func ftyp(major string, compatible ...string) []byte {
+	box := make([]byte, 16, 16+4*len(compatible))
+	binary.BigEndian.PutUint32(box, uint32(16+4*len(compatible)))
+	copy(box[4:], "ftyp")
+	copy(box[8:], major)
+	for _, brand := range compatible {
+		box = append(box, brand...)
+	}
+	return append(box, 0, 0, 0, 8, 'f', 'r', 'e', 'e')
+}
+
+func TestDetectMimeType(t *testing.T) {
+	iphone, err := os.ReadFile(filepath.Join("testdata", "iphone.heic"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		head     []byte
+		want     string
+	}{
+		{"iPhone photo", "IMG_0001.HEIC", iphone, "image/heic"},
+		{"HEIC sequence", "burst.heic", ftyp("hevc", "mif1", "msf1"), "image/heic"},
+		{"generic HEIF holding HEIC", "photo.heif", ftyp("mif1", "mif1", "heic"), "image/heic"},
+		{"generic HEIF", "photo.heif", ftyp("mif1", "mif1"), "image/heif"},
+		{"AVIF", "photo.avif", ftyp("mif1", "mif1", "avif"), "application/octet-stream"},
+		{"MP4 video", "clip.mp4", ftyp("isom", "isom", "mp41"), "video/mp4"},
+		{"JPEG", "photo.heic", []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00"), "image/jpeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectMimeType(tt.filename, tt.head); got != tt.want {
+				t.Errorf("DetectMimeType(%s) = %s, want %s", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateAcceptsHEIC(t *testing.T) {
+	iphone, err := os.ReadFile(filepath.Join("testdata", "iphone.heic"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	file := &models.UserFiles{Uid: "user-a", MimeType: DetectMimeType("IMG_0001.HEIC", iphone), Size: 2 << 20}
+	if err := Validate(file, "user-a", models.IMAGE); err != nil {
+		t.Errorf("iPhone photo rejected: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package media
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UploadInfo is what the server learns about an uploaded file before storing it.
+type UploadInfo struct {
+	MimeType   string
+	Size       int64
+	DurationMs int
+	Waveform   []float64
+}
+
+// InspectUpload sniffs the type and size of an uploaded file and, for audio,
+// decodes it to extract its duration and waveform.
+func InspectUpload(fh *multipart.FileHeader) (*UploadInfo, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	info := &UploadInfo{
+		MimeType: DetectMimeType(fh.Filename, head[:n]),
+		Size:     fh.Size,
+	}
+	if !strings.HasPrefix(info.MimeType, "audio/") {
+		return info, nil
+	}
+
+	// ffmpeg needs a seekable file for most audio containers
+	tmp, err := os.CreateTemp("", "upload-*"+filepath.Ext(fh.Filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(head[:n]); err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if _, err := io.Copy(tmp, f); err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	meta, err := ExtractAudioMetadata(tmp.Name())
+	if err != nil {
+		return nil, fmt.Errorf("invalid audio file: %w", err)
+	}
+	info.DurationMs = meta.DurationMs
+	info.Waveform = meta.Waveform
+
+	return info, nil
+}
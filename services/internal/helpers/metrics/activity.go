@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+)
+
+// RecordActive marks userId as active today. Redis remembers who was already recorded
+// so reconnects don't hit the database.
+func RecordActive(userId string) {
+	day := truncateDay(time.Now())
+
+	rc := utils.RedisConnect()
+	defer rc.Close()
+	fresh, err := rc.SetNX(context.Background(), fmt.Sprintf("spark:user:%s:active_day:%s", userId, day.Format(time.DateOnly)), 1, 25*time.Hour).Result()
+	if err != nil || !fresh {
+		return
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		log.Printf("[Metrics] Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+	if _, err := db.Exec(
+		`INSERT INTO user_activity_days (user_id, day) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		userId, day,
+	); err != nil {
+		log.Printf("[Metrics] Failed to record activity for %s: %v", userId, err)
+	}
+}
@@ -0,0 +1,215 @@
+// Package metrics keeps daily rollups of product metrics for the admin dashboard. The
+// aggregation job recomputes recent days from the source tables and stores one row per
+// metric and day; queries then only read the rollups.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+)
+
+// Metrics
+const (
+	Signups          = "signups"
+	DailyActiveUsers = "daily_active_users"
+	Swipes           = "swipes"
+	MatchRate        = "match_rate"
+	MessagesPerMatch = "messages_per_match"
+	UnlockConversion = "unlock_conversion"
+	DateRate         = "date_rate"
+	RetentionD1      = "retention_d1"
+	RetentionD7      = "retention_d7"
+	RetentionD30     = "retention_d30"
+)
+
+// Granularities
+const (
+	Day   = "day"
+	Week  = "week"
+	Month = "month"
+)
+
+// How a metric's days combine into a longer bucket
+const (
+	kindCount = iota // numerators are summed
+	kindGauge        // numerators are averaged over the days in the bucket
+	kindRatio        // summed numerator over summed denominator
+)
+
+var kinds = map[string]int{
+	Signups:          kindCount,
+	DailyActiveUsers: kindGauge,
+	Swipes:           kindCount,
+	MatchRate:        kindRatio,
+	MessagesPerMatch: kindRatio,
+	UnlockConversion: kindRatio,
+	DateRate:         kindRatio,
+	RetentionD1:      kindRatio,
+	RetentionD7:      kindRatio,
+	RetentionD30:     kindRatio,
+}
+
+// MaxRange is the longest span a single query may cover.
+const MaxRange = 2 * 366 * 24 * time.Hour
+
+var (
+	ErrUnknownMetric      = errors.New("unknown metric")
+	ErrInvalidGranularity = errors.New("invalid granularity: must be day, week or month")
+	ErrInvalidRange       = errors.New("from must be before to")
+	ErrRangeTooLong       = errors.New("range can span at most two years")
+)
+
+// Point is one bucket of a series. Value is nil for ratios with nothing to divide by.
+type Point struct {
+	Bucket      time.Time
+	Value       *float64
+	Numerator   int64
+	Denominator int64
+}
+
+// Series is a metric over a date range.
+type Series struct {
+	Metric      string
+	Granularity string
+	Points      []Point
+	// ComputedAt is when the most recent day in the range was last rolled up
+	ComputedAt *time.Time
+}
+
+// Metrics returns every metric name.
+func Metrics() []string {
+	names := make([]string, 0, len(kinds))
+	for name := range kinds {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Query returns metric between the days of from and to, both included, in buckets of
+// granularity. Days that were never rolled up count as zero.
+func Query(metric string, from, to time.Time, granularity string) (*Series, error) {
+	kind, ok := kinds[metric]
+	if !ok {
+		return nil, ErrUnknownMetric
+	}
+	if granularity == "" {
+		granularity = Day
+	}
+	if granularity != Day && granularity != Week && granularity != Month {
+		return nil, ErrInvalidGranularity
+	}
+	from, to = truncateDay(from), truncateDay(to)
+	if to.Before(from) {
+		return nil, ErrInvalidRange
+	}
+	if to.Sub(from) > MaxRange {
+		return nil, ErrRangeTooLong
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT day, numerator, denominator, computed_at FROM metric_rollups
+		WHERE metric = $1 AND day >= $2 AND day <= $3
+		ORDER BY day
+	`, metric, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load metric: %w", err)
+	}
+	defer rows.Close()
+
+	series := &Series{Metric: metric, Granularity: granularity}
+	// Buckets are built up front so gaps in the rollups still show as points
+	buckets := map[time.Time]*Point{}
+	days := map[time.Time]int{}
+	today := truncateDay(time.Now())
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		b := bucketStart(d, granularity)
+		if _, ok := buckets[b]; !ok {
+			series.Points = append(series.Points, Point{Bucket: b})
+			buckets[b] = nil
+		}
+		if !d.After(today) {
+			days[b]++
+		}
+	}
+	for i := range series.Points {
+		buckets[series.Points[i].Bucket] = &series.Points[i]
+	}
+
+	for rows.Next() {
+		var day, computedAt time.Time
+		var num, den int64
+		if err := rows.Scan(&day, &num, &den, &computedAt); err != nil {
+			return nil, fmt.Errorf("failed to read metric: %w", err)
+		}
+		p := buckets[bucketStart(truncateDay(day), granularity)]
+		p.Numerator += num
+		p.Denominator += den
+		if series.ComputedAt == nil || computedAt.After(*series.ComputedAt) {
+			series.ComputedAt = &computedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read metric: %w", err)
+	}
+
+	for i := range series.Points {
+		p := &series.Points[i]
+		var v float64
+		switch kind {
+		case kindCount:
+			v = float64(p.Numerator)
+		case kindGauge:
+			if days[p.Bucket] == 0 {
+				continue
+			}
+			v = float64(p.Numerator) / float64(days[p.Bucket])
+		case kindRatio:
+			if p.Denominator == 0 {
+				continue
+			}
+			v = float64(p.Numerator) / float64(p.Denominator)
+		}
+		p.Value = &v
+	}
+	return series, nil
+}
+
+// ActiveUsers counts distinct users seen online since the day of since.
+func ActiveUsers(since time.Time) (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var n int
+	err = db.QueryRow(`SELECT COUNT(DISTINCT user_id) FROM user_activity_days WHERE day >= $1`, truncateDay(since)).Scan(&n)
+	return n, err
+}
+
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// bucketStart returns the first day of the bucket day falls in. Weeks start on Monday.
+func bucketStart(day time.Time, granularity string) time.Time {
+	switch granularity {
+	case Week:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case Month:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
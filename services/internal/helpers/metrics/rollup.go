@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	rollupInterval = time.Hour
+	// rollupWindow is how many past days each run recomputes. Cohort metrics keep
+	// changing after the day itself (messages in a match, 30-day retention), so the
+	// window covers the longest of them.
+	rollupWindow = 32
+	// backfillDays bounds the first run on an empty rollup table
+	backfillDays  = 2 * 366
+	rollupLockKey = "spark:metrics:rollup"
+	rollupLockTTL = 30 * time.Minute
+)
+
+// rollups computes (day, numerator, denominator) for every day in [$1, $2). Cohort
+// queries also get the current day as $3, to leave out cohorts that aren't complete yet.
+var rollups = map[string]string{
+	Signups: `
+		SELECT created_at::date, COUNT(*), 0 FROM users
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY 1`,
+	DailyActiveUsers: `
+		SELECT day, COUNT(*), 0 FROM user_activity_days
+		WHERE day >= $1 AND day < $2
+		GROUP BY 1`,
+	Swipes: `
+		SELECT created_at::date, COUNT(*), 0 FROM swipes
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY 1`,
+	// Matches made per like or superlike sent that day
+	MatchRate: `
+		WITH likes AS (
+			SELECT created_at::date AS day, COUNT(*) AS n FROM swipes
+			WHERE created_at >= $1 AND created_at < $2 AND upper(action_type) IN ('LIKE', 'SUPERLIKE')
+			GROUP BY 1
+		), made AS (
+			SELECT matched_at::date AS day, COUNT(*) AS n FROM matches
+			WHERE matched_at >= $1 AND matched_at < $2
+			GROUP BY 1
+		)
+		SELECT COALESCE(l.day, m.day), COALESCE(m.n, 0), COALESCE(l.n, 0)
+		FROM likes l FULL JOIN made m ON m.day = l.day`,
+	// Messages exchanged so far in the matches made that day
+	MessagesPerMatch: `
+		SELECT matched_at::date, SUM(COALESCE(she_messages, 0) + COALESCE(he_messages, 0)), COUNT(*) FROM matches
+		WHERE matched_at >= $1 AND matched_at < $2
+		GROUP BY 1`,
+	// Share of the matches made that day that have been unlocked
+	UnlockConversion: `
+		SELECT matched_at::date, COUNT(*) FILTER (WHERE is_unlocked), COUNT(*) FROM matches
+		WHERE matched_at >= $1 AND matched_at < $2
+		GROUP BY 1`,
+	// Share of matches unlocked that day where both rated the date and it counted as one
+	DateRate: `
+		SELECT unlock_accepted_at::date, COUNT(*) FILTER (WHERE is_date), COUNT(*) FROM matches
+		WHERE unlock_accepted_at >= $1 AND unlock_accepted_at < $2
+			AND COALESCE((post_unlock_rating->>'she_rating')::int, 0) > 0
+			AND COALESCE((post_unlock_rating->>'he_rating')::int, 0) > 0
+		GROUP BY 1`,
+	RetentionD1:  retentionQuery(1),
+	RetentionD7:  retentionQuery(7),
+	RetentionD30: retentionQuery(30),
+}
+
+// retentionQuery is the share of users who signed up on a day and were active exactly
+// n days later. Cohorts whose day n hasn't finished yet are left out.
+func retentionQuery(n int) string {
+	return fmt.Sprintf(`
+		SELECT u.created_at::date, COUNT(a.user_id), COUNT(*) FROM users u
+		LEFT JOIN user_activity_days a ON a.user_id = u.id AND a.day = u.created_at::date + %[1]d
+		WHERE u.created_at >= $1 AND u.created_at < $2 AND u.created_at::date + %[1]d < $3::date
+		GROUP BY 1`, n)
+}
+
+// Rollup recomputes every metric for the days from from to to, both included.
+func Rollup(from, to time.Time) error {
+	from, to = truncateDay(from), truncateDay(to).AddDate(0, 0, 1)
+	today := truncateDay(time.Now())
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	for _, metric := range Metrics() {
+		query := rollups[metric]
+		args := []any{from, to}
+		if strings.Contains(query, "$3") {
+			args = append(args, today)
+		}
+		args = append(args, metric)
+		if _, err := db.Exec(fmt.Sprintf(`
+			INSERT INTO metric_rollups (metric, day, numerator, denominator, computed_at)
+			SELECT $%d, r.day, r.numerator, r.denominator, now()
+			FROM (%s) AS r(day, numerator, denominator)
+			ON CONFLICT (metric, day) DO UPDATE
+			SET numerator = EXCLUDED.numerator, denominator = EXCLUDED.denominator, computed_at = EXCLUDED.computed_at
+		`, len(args), query), args...); err != nil {
+			return fmt.Errorf("failed to roll up %s: %w", metric, err)
+		}
+	}
+	return nil
+}
+
+// Run rolls up metrics every hour until ctx is cancelled. Replicas take turns through a
+// Redis lock so only one of them aggregates at a time.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+	for {
+		runOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// unlockScript deletes KEYS[1] only while it still holds ARGV[1]
+var unlockScript = redis.NewScript(`
+	if redis.call('GET', KEYS[1]) == ARGV[1] then
+		return redis.call('DEL', KEYS[1])
+	end
+	return 0
+`)
+
+func runOnce(ctx context.Context) {
+	rc := utils.RedisConnect()
+	defer rc.Close()
+
+	// A run that outlives the TTL must not release the lock another instance took since
+	token := utils.GenerateID()
+	locked, err := rc.SetNX(ctx, rollupLockKey, token, rollupLockTTL).Result()
+	if err != nil {
+		log.Printf("[Metrics] Failed to take rollup lock: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+	defer func() {
+		if err := unlockScript.Run(context.Background(), rc, []string{rollupLockKey}, token).Err(); err != nil {
+			log.Printf("[Metrics] Failed to release rollup lock: %v", err)
+		}
+	}()
+
+	now := time.Now()
+	from := now.AddDate(0, 0, -rollupWindow)
+	if empty, err := isEmpty(); err != nil {
+		log.Printf("[Metrics] Failed to check rollups: %v", err)
+		return
+	} else if empty {
+		from = now.AddDate(0, 0, -backfillDays)
+	}
+
+	start := time.Now()
+	if err := Rollup(from, now); err != nil {
+		log.Printf("[Metrics] Rollup failed: %v", err)
+		return
+	}
+	log.Printf("[Metrics] Rolled up %s to %s in %s", from.Format(time.DateOnly), now.Format(time.DateOnly), time.Since(start).Round(time.Millisecond))
+}
+
+func isEmpty() (bool, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var exists bool
+	err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM metric_rollups)`).Scan(&exists)
+	return !exists, err
+}
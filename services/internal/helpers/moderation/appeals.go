@@ -0,0 +1,216 @@
+package moderation
+
+import (
+	"spark/internal/mailer"
+	"spark/internal/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// Appeal statuses
+const (
+	AppealPending  = "pending"
+	AppealApproved = "approved"
+	AppealRejected = "rejected"
+)
+
+const MaxAppealLength = 2000
+
+var (
+	ErrNothingToAppeal = errors.New("there is no active ban or suspension to appeal")
+	ErrAlreadyAppealed = errors.New("this decision has already been appealed")
+	ErrEmptyAppeal     = errors.New("appeal message is required")
+	ErrAppealTooLong   = fmt.Errorf("appeal message must be at most %d characters", MaxAppealLength)
+	ErrAppealNotFound  = errors.New("appeal not found")
+	ErrAppealReviewed  = errors.New("appeal was already reviewed")
+)
+
+// ActiveRestriction returns the ban or suspension currently locking the user out, or nil.
+// Bans take precedence over suspensions; among suspensions the one ending last wins.
+func ActiveRestriction(userId string) (*models.UserEnforcement, error) {
+	enforcements, err := ListEnforcements(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var active *models.UserEnforcement
+	now := time.Now()
+	for i := range enforcements {
+		e := &enforcements[i]
+		if e.LiftedAt != nil {
+			continue
+		}
+		switch e.Type {
+		case TypeBan:
+			return e, nil
+		case TypeSuspension:
+			if e.ExpiresAt != nil && e.ExpiresAt.After(now) && (active == nil || e.ExpiresAt.After(*active.ExpiresAt)) {
+				active = e
+			}
+		}
+	}
+	return active, nil
+}
+
+// Appeal files an appeal against the user's active ban or suspension. Each enforcement
+// can be appealed once.
+func Appeal(userId, message string) (*models.BanAppeal, error) {
+	message = strings.TrimSpace(message)
+	if message == "" {
+		return nil, ErrEmptyAppeal
+	}
+	if len(message) > MaxAppealLength {
+		return nil, ErrAppealTooLong
+	}
+
+	enforcement, err := ActiveRestriction(userId)
+	if err != nil {
+		return nil, err
+	}
+	if enforcement == nil {
+		return nil, ErrNothingToAppeal
+	}
+
+	existing, err := GetAppealForEnforcement(enforcement.Id)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrAlreadyAppealed
+	}
+
+	appeal := &models.BanAppeal{
+		Id:            utils.GenerateID(12),
+		UserId:        userId,
+		EnforcementId: enforcement.Id,
+		Message:       message,
+		Status:        AppealPending,
+		CreatedAt:     time.Now(),
+	}
+
+	appealORM := orm.Load(&models.BanAppeal{})
+	defer appealORM.Close()
+	if err := appealORM.Insert(appeal); err != nil {
+		return nil, fmt.Errorf("failed to file appeal: %w", err)
+	}
+
+	return appeal, nil
+}
+
+// ReviewAppeal approves or rejects a pending appeal. Approving lifts the appealed
+// enforcement; rejecting emails the user the reviewer's note.
+func ReviewAppeal(appealId, reviewerId string, approve bool, note string) (*models.BanAppeal, error) {
+	appeal, err := GetAppeal(appealId)
+	if err != nil {
+		return nil, err
+	}
+	if appeal.Status != AppealPending {
+		return nil, ErrAppealReviewed
+	}
+
+	status := AppealRejected
+	if approve {
+		status = AppealApproved
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	res, err := db.Exec(`
+		UPDATE ban_appeals SET status = $2, reviewer_id = $3, review_note = $4, reviewed_at = $5
+		WHERE id = $1 AND status = 'pending'
+	`, appealId, status, reviewerId, note, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to review appeal: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrAppealReviewed
+	}
+	appeal.Status = status
+	appeal.ReviewerId = reviewerId
+	appeal.ReviewNote = note
+	appeal.ReviewedAt = &now
+
+	if approve {
+		if _, err := Lift(appeal.EnforcementId, reviewerId); err != nil && !errors.Is(err, ErrAlreadyLifted) {
+			return nil, err
+		}
+	} else {
+		var email, locale string
+		if err := db.QueryRow(`SELECT email, preferred_locale FROM users WHERE id = $1`, appeal.UserId).Scan(&email, &locale); err == nil {
+			notify(mailer.AppealRejected(email, locale, note))
+		}
+	}
+
+	return appeal, nil
+}
+
+func GetAppeal(id string) (*models.BanAppeal, error) {
+	appealORM := orm.Load(&models.BanAppeal{})
+	defer appealORM.Close()
+
+	var found []models.BanAppeal
+	if err := appealORM.GetByFieldEquals("Id", id).Scan(&found); err != nil {
+		return nil, fmt.Errorf("failed to load appeal: %w", err)
+	}
+	if len(found) == 0 {
+		return nil, ErrAppealNotFound
+	}
+	return &found[0], nil
+}
+
+// GetAppealForEnforcement returns the appeal filed against an enforcement, or nil.
+func GetAppealForEnforcement(enforcementId string) (*models.BanAppeal, error) {
+	appealORM := orm.Load(&models.BanAppeal{})
+	defer appealORM.Close()
+
+	var found []models.BanAppeal
+	if err := appealORM.GetByFieldEquals("EnforcementId", enforcementId).Scan(&found); err != nil {
+		return nil, fmt.Errorf("failed to load appeal: %w", err)
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return &found[0], nil
+}
+
+// ListAppeals returns appeals with the given status (all when empty), oldest first so
+// the review queue is worked in order.
+func ListAppeals(status string, limit, offset int) ([]models.BanAppeal, int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	total := 0
+	if err := db.QueryRow(`SELECT COUNT(*) FROM ban_appeals WHERE $1 = '' OR status = $1`, status).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count appeals: %w", err)
+	}
+
+	appealORM := orm.Load(&models.BanAppeal{})
+	defer appealORM.Close()
+
+	var appeals []models.BanAppeal
+	err = appealORM.QueryRaw(`
+		SELECT * FROM ban_appeals
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at ASC, id ASC
+		LIMIT $2 OFFSET $3
+	`, status, limit, offset).Scan(&appeals)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list appeals: %w", err)
+	}
+
+	return appeals, total, nil
+}
@@ -0,0 +1,344 @@
+// Package moderation implements graduated enforcement against accounts: warnings that
+// add up to strikes, timed suspensions, shadow bans and permanent bans, plus appeals.
+package moderation
+
+import (
+	"spark/internal/i18n"
+	"spark/internal/mailer"
+	"spark/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// Enforcement types
+const (
+	TypeWarning    = "warning"
+	TypeSuspension = "suspension"
+	TypeShadowBan  = "shadow_ban"
+	TypeBan        = "ban"
+)
+
+// Reason codes attached to every enforcement
+const (
+	ReasonSpam        = "spam"
+	ReasonHarassment  = "harassment"
+	ReasonHateSpeech  = "hate_speech"
+	ReasonNudity      = "nudity"
+	ReasonScam        = "scam"
+	ReasonFakeProfile = "fake_profile"
+	ReasonUnderage    = "underage"
+	ReasonViolence    = "violence"
+	ReasonOther       = "other"
+)
+
+const (
+	// StrikeLimit warnings within StrikeWindow trigger an automatic suspension
+	StrikeLimit           = 3
+	StrikeWindow          = 90 * 24 * time.Hour
+	StrikeSuspension      = 7 * 24 * time.Hour
+	MaxSuspensionLength   = 365 * 24 * time.Hour
+	SystemActorId         = "system"
+	maxEnforcementNoteLen = 2000
+)
+
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidType         = errors.New("invalid enforcement type: must be warning, suspension, shadow_ban or ban")
+	ErrInvalidReasonCode   = errors.New("invalid reason code")
+	ErrInvalidDuration     = errors.New("suspensions need a duration between 1 hour and 365 days")
+	ErrEnforcementNotFound = errors.New("enforcement not found")
+	ErrAlreadyLifted       = errors.New("enforcement was already lifted")
+)
+
+// ReasonCodes lists every valid reason code.
+func ReasonCodes() []string {
+	return []string{
+		ReasonSpam, ReasonHarassment, ReasonHateSpeech, ReasonNudity, ReasonScam,
+		ReasonFakeProfile, ReasonUnderage, ReasonViolence, ReasonOther,
+	}
+}
+
+func IsValidReasonCode(code string) bool {
+	return slices.Contains(ReasonCodes(), code)
+}
+
+func IsValidType(t string) bool {
+	return t == TypeWarning || t == TypeSuspension || t == TypeShadowBan || t == TypeBan
+}
+
+// ReasonLabel returns the text shown to users for a reason code, in locale.
+func ReasonLabel(locale, code string) string {
+	if !IsValidReasonCode(code) {
+		code = ReasonOther
+	}
+	return i18n.T(locale, "moderation.reason."+code)
+}
+
+// Action describes an enforcement to apply.
+type Action struct {
+	UserId     string
+	ActorId    string
+	Type       string
+	ReasonCode string
+	Note       string
+	// Duration is required for suspensions and ignored otherwise
+	Duration time.Duration
+}
+
+// Enforce records a and applies it to the account. Warnings count as strikes; reaching
+// StrikeLimit suspends the account automatically. The user is emailed about every
+// enforcement except shadow bans, which only work if the user doesn't know about them.
+func Enforce(a Action) (*models.UserEnforcement, error) {
+	if !IsValidType(a.Type) {
+		return nil, ErrInvalidType
+	}
+	if !IsValidReasonCode(a.ReasonCode) {
+		return nil, ErrInvalidReasonCode
+	}
+	if a.Type == TypeSuspension && (a.Duration < time.Hour || a.Duration > MaxSuspensionLength) {
+		return nil, ErrInvalidDuration
+	}
+	if len(a.Note) > maxEnforcementNoteLen {
+		a.Note = a.Note[:maxEnforcementNoteLen]
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var email, locale string
+	err = db.QueryRow(`SELECT email, preferred_locale FROM users WHERE id = $1`, a.UserId).Scan(&email, &locale)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	now := time.Now()
+	enforcement := &models.UserEnforcement{
+		Id:         utils.GenerateID(12),
+		UserId:     a.UserId,
+		ActorId:    a.ActorId,
+		Type:       a.Type,
+		ReasonCode: a.ReasonCode,
+		Note:       a.Note,
+		CreatedAt:  now,
+	}
+	if a.Type == TypeSuspension {
+		expires := now.Add(a.Duration)
+		enforcement.ExpiresAt = &expires
+	}
+
+	enfORM := orm.Load(&models.UserEnforcement{})
+	defer enfORM.Close()
+	if err := enfORM.Insert(enforcement); err != nil {
+		return nil, fmt.Errorf("failed to record enforcement: %w", err)
+	}
+
+	switch a.Type {
+	case TypeBan:
+		_, err = db.Exec(`UPDATE users SET is_banned = true, updated_at = NOW() WHERE id = $1`, a.UserId)
+	case TypeShadowBan:
+		_, err = db.Exec(`UPDATE users SET is_shadow_banned = true, updated_at = NOW() WHERE id = $1`, a.UserId)
+	case TypeSuspension:
+		// A shorter suspension never cuts an existing longer one short
+		_, err = db.Exec(`
+			UPDATE users
+			SET suspended_until = GREATEST(COALESCE(suspended_until, $2), $2), updated_at = NOW()
+			WHERE id = $1
+		`, a.UserId, *enforcement.ExpiresAt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply enforcement: %w", err)
+	}
+	invalidate(a.UserId)
+
+	switch a.Type {
+	case TypeWarning:
+		strikes, err := CountStrikes(a.UserId)
+		if err != nil {
+			log.Printf("[Moderation] Failed to count strikes for %s: %v", a.UserId, err)
+			break
+		}
+		notify(mailer.AccountWarning(email, locale, ReasonLabel(locale, a.ReasonCode), strikes, StrikeLimit))
+		if strikes >= StrikeLimit {
+			_, err := Enforce(Action{
+				UserId:     a.UserId,
+				ActorId:    SystemActorId,
+				Type:       TypeSuspension,
+				ReasonCode: a.ReasonCode,
+				Note:       fmt.Sprintf("Automatic suspension after %d strikes", strikes),
+				Duration:   StrikeSuspension,
+			})
+			if err != nil {
+				log.Printf("[Moderation] Failed to auto-suspend %s after %d strikes: %v", a.UserId, strikes, err)
+			}
+		}
+	case TypeSuspension:
+		notify(mailer.AccountSuspended(email, locale, ReasonLabel(locale, a.ReasonCode), *enforcement.ExpiresAt))
+	case TypeBan:
+		notify(mailer.AccountBanned(email, locale, ReasonLabel(locale, a.ReasonCode)))
+	}
+
+	return enforcement, nil
+}
+
+// Lift ends an enforcement early. A lifted warning no longer counts as a strike.
+func Lift(enforcementId, actorId string) (*models.UserEnforcement, error) {
+	enforcement, err := GetEnforcement(enforcementId)
+	if err != nil {
+		return nil, err
+	}
+	if enforcement.LiftedAt != nil {
+		return nil, ErrAlreadyLifted
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	res, err := db.Exec(`
+		UPDATE user_enforcements SET lifted_at = $2, lifted_by = $3
+		WHERE id = $1 AND lifted_at IS NULL
+	`, enforcementId, now, actorId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lift enforcement: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrAlreadyLifted
+	}
+	enforcement.LiftedAt = &now
+	enforcement.LiftedBy = actorId
+
+	// Recompute the account flag from whatever is still active
+	switch enforcement.Type {
+	case TypeBan:
+		_, err = db.Exec(`
+			UPDATE users SET is_banned = EXISTS (
+				SELECT 1 FROM user_enforcements
+				WHERE user_id = $1 AND type = 'ban' AND lifted_at IS NULL
+			), updated_at = NOW()
+			WHERE id = $1
+		`, enforcement.UserId)
+	case TypeShadowBan:
+		_, err = db.Exec(`
+			UPDATE users SET is_shadow_banned = EXISTS (
+				SELECT 1 FROM user_enforcements
+				WHERE user_id = $1 AND type = 'shadow_ban' AND lifted_at IS NULL
+			), updated_at = NOW()
+			WHERE id = $1
+		`, enforcement.UserId)
+	case TypeSuspension:
+		_, err = db.Exec(`
+			UPDATE users SET suspended_until = (
+				SELECT MAX(expires_at) FROM user_enforcements
+				WHERE user_id = $1 AND type = 'suspension' AND lifted_at IS NULL AND expires_at > NOW()
+			), updated_at = NOW()
+			WHERE id = $1
+		`, enforcement.UserId)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update account: %w", err)
+	}
+	invalidate(enforcement.UserId)
+
+	if enforcement.Type == TypeBan || enforcement.Type == TypeSuspension {
+		status, err := GetStatus(enforcement.UserId)
+		if err == nil && !status.Restricted() {
+			var email, locale string
+			if err := db.QueryRow(`SELECT email, preferred_locale FROM users WHERE id = $1`, enforcement.UserId).Scan(&email, &locale); err == nil {
+				notify(mailer.AccountRestored(email, locale))
+			}
+		}
+	}
+
+	return enforcement, nil
+}
+
+// LiftAll lifts every active enforcement of type t on a user, e.g. to unban them.
+func LiftAll(userId, t, actorId string) error {
+	enforcements, err := ListEnforcements(userId)
+	if err != nil {
+		return err
+	}
+	for _, e := range enforcements {
+		if e.Type != t || e.LiftedAt != nil {
+			continue
+		}
+		if _, err := Lift(e.Id, actorId); err != nil && !errors.Is(err, ErrAlreadyLifted) {
+			return err
+		}
+	}
+
+	// Bans set before enforcements were recorded have no row to lift
+	if t == TypeBan {
+		db, err := database.PostgresConn()
+		if err != nil {
+			return fmt.Errorf("failed to connect to database: %w", err)
+		}
+		defer db.Close()
+		if _, err := db.Exec(`UPDATE users SET is_banned = false, updated_at = NOW() WHERE id = $1`, userId); err != nil {
+			return fmt.Errorf("failed to unban user: %w", err)
+		}
+		invalidate(userId)
+	}
+
+	return nil
+}
+
+func GetEnforcement(id string) (*models.UserEnforcement, error) {
+	enfORM := orm.Load(&models.UserEnforcement{})
+	defer enfORM.Close()
+
+	var found []models.UserEnforcement
+	if err := enfORM.GetByFieldEquals("Id", id).Scan(&found); err != nil {
+		return nil, fmt.Errorf("failed to load enforcement: %w", err)
+	}
+	if len(found) == 0 {
+		return nil, ErrEnforcementNotFound
+	}
+	return &found[0], nil
+}
+
+// ListEnforcements returns a user's enforcement history, newest first.
+func ListEnforcements(userId string) ([]models.UserEnforcement, error) {
+	enfORM := orm.Load(&models.UserEnforcement{})
+	defer enfORM.Close()
+
+	var found []models.UserEnforcement
+	err := enfORM.QueryRaw(`SELECT * FROM user_enforcements WHERE user_id = $1 ORDER BY created_at DESC`, userId).Scan(&found)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enforcements: %w", err)
+	}
+	return found, nil
+}
+
+// CountStrikes returns the number of active warnings a user received within StrikeWindow.
+func CountStrikes(userId string) (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var strikes int
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM user_enforcements
+		WHERE user_id = $1 AND type = 'warning' AND lifted_at IS NULL AND created_at > $2
+	`, userId, time.Now().Add(-StrikeWindow)).Scan(&strikes)
+	return strikes, err
+}
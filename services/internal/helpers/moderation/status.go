@@ -0,0 +1,162 @@
+package moderation
+
+import (
+	"spark/internal/mailer"
+	"spark/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// statusTTL bounds how long a stale status can be served if an invalidation is missed.
+const statusTTL = time.Minute
+
+var ErrAccountBanned = errors.New("account banned")
+
+// SuspendedError is returned by CheckAccess while an account is suspended.
+type SuspendedError struct {
+	Until time.Time
+}
+
+func (e *SuspendedError) Error() string {
+	return fmt.Sprintf("account suspended until %s", e.Until.UTC().Format(time.RFC3339))
+}
+
+// Status is the current enforcement state of an account.
+type Status struct {
+	Banned         bool       `json:"banned"`
+	SuspendedUntil *time.Time `json:"suspended_until"`
+	ShadowBanned   bool       `json:"shadow_banned"`
+	Strikes        int        `json:"strikes"`
+}
+
+// Suspended reports whether a suspension is still running. Suspensions end on their
+// own once SuspendedUntil passes, without any job having to clear them.
+func (s *Status) Suspended() bool {
+	return s.SuspendedUntil != nil && s.SuspendedUntil.After(time.Now())
+}
+
+// Restricted reports whether the user is currently locked out of the app.
+func (s *Status) Restricted() bool {
+	return s.Banned || s.Suspended()
+}
+
+func statusKey(userId string) string {
+	return fmt.Sprintf("spark:moderation:status:%s", userId)
+}
+
+// GetStatus returns a user's enforcement state. It is cached briefly since it's checked
+// on every authenticated request.
+func GetStatus(userId string) (*Status, error) {
+	rc := utils.RedisConnect()
+	defer rc.Close()
+	ctx := context.Background()
+
+	if cached, err := rc.Get(ctx, statusKey(userId)).Bytes(); err == nil {
+		var status Status
+		if err := json.Unmarshal(cached, &status); err == nil {
+			return &status, nil
+		}
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var banned, shadowBanned sql.NullBool
+	var suspendedUntil sql.NullTime
+	err = db.QueryRow(`SELECT is_banned, is_shadow_banned, suspended_until FROM users WHERE id = $1`, userId).
+		Scan(&banned, &shadowBanned, &suspendedUntil)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load moderation status: %w", err)
+	}
+
+	status := &Status{
+		Banned:       banned.Bool,
+		ShadowBanned: shadowBanned.Bool,
+	}
+	if suspendedUntil.Valid {
+		status.SuspendedUntil = &suspendedUntil.Time
+	}
+	if status.Strikes, err = CountStrikes(userId); err != nil {
+		return nil, err
+	}
+
+	if data, err := json.Marshal(status); err == nil {
+		rc.Set(ctx, statusKey(userId), data, statusTTL)
+	}
+
+	return status, nil
+}
+
+// CheckAccess returns ErrAccountBanned or a *SuspendedError when the user may not use
+// the app right now. Lookup failures let the request through rather than locking
+// everyone out.
+func CheckAccess(userId string) error {
+	status, err := GetStatus(userId)
+	if err != nil {
+		if !errors.Is(err, ErrUserNotFound) {
+			log.Printf("[Moderation] Failed to check access for %s: %v", userId, err)
+		}
+		return nil
+	}
+	if status.Banned {
+		return ErrAccountBanned
+	}
+	if status.Suspended() {
+		return &SuspendedError{Until: *status.SuspendedUntil}
+	}
+	return nil
+}
+
+// HiddenUserSQL returns a SQL condition that is true when the user whose id is in
+// column col must not be shown to other users.
+func HiddenUserSQL(col string) string {
+	return fmt.Sprintf(`EXISTS (
+		SELECT 1 FROM users hidden_u
+		WHERE hidden_u.id = %s AND (
+			COALESCE(hidden_u.is_banned, false)
+			OR COALESCE(hidden_u.is_shadow_banned, false)
+			OR hidden_u.suspended_until > NOW()
+		)
+	)`, col)
+}
+
+// VisibleToSQL returns a SQL condition that is true when content by the user whose id
+// is in column col may be shown to the viewer whose id is in param. Users always see
+// their own content, so they can't tell they are shadow banned.
+func VisibleToSQL(col, param string) string {
+	return fmt.Sprintf("(%s = %s OR NOT %s)", col, param, HiddenUserSQL(col))
+}
+
+// invalidate drops cached state that depends on a user's enforcements.
+func invalidate(userId string) {
+	rc := utils.RedisConnect()
+	defer rc.Close()
+	rc.Del(context.Background(), statusKey(userId))
+
+	usersORM := orm.Load(&models.User{})
+	defer usersORM.Close()
+	usersORM.InvalidateCacheByPrefix(fmt.Sprintf("user-%s", userId))
+}
+
+func notify(t *mailer.Template) {
+	go func() {
+		if err := t.Send(); err != nil {
+			log.Printf("[Moderation] Failed to email %s: %v", t.ToEmail, err)
+		}
+	}()
+}
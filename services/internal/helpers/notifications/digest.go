@@ -0,0 +1,242 @@
+package notifications
+
+import (
+	"spark/internal/helpers/users"
+	"spark/internal/i18n"
+	"spark/internal/mailer"
+	"spark/internal/models"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+)
+
+const (
+	// DigestHour is the local hour digests start going out at. A digest that isn't
+	// sent within digestWindow waits for the next day.
+	DigestHour   = 9
+	digestWindow = 3 * time.Hour
+
+	digestInterval = 15 * time.Minute
+	// digestLines is how many events each digest section lists by name
+	digestLines = 3
+)
+
+// digestUnsubscribe is the unsubscribe link event that turns off every digested email
+const digestUnsubscribe = "digest"
+
+// queueDigest saves e for its recipient's next digest. Tests replace it.
+var queueDigest = func(e Event) error {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`
+		INSERT INTO notification_digest_items (id, user_id, event, actor_id, summary, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, utils.GenerateID(), e.UserId, e.Type, e.ActorId, e.Summary, time.Now()); err != nil {
+		return fmt.Errorf("failed to queue digest item: %w", err)
+	}
+	return nil
+}
+
+// digestDue reports whether a user's digest should go out at now: in the morning in
+// their timezone, a day or a week after the last one.
+func digestDue(s *models.NotificationSettings, now time.Time) bool {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	start := time.Date(local.Year(), local.Month(), local.Day(), DigestHour, 0, 0, 0, loc)
+	if local.Before(start) || !local.Before(start.Add(digestWindow)) {
+		return false
+	}
+	if s.LastDigestAt == nil {
+		return true
+	}
+	period := 24 * time.Hour
+	if s.DigestFrequency == DigestWeekly {
+		period = 7 * 24 * time.Hour
+	}
+	// Slack for the worker's interval, so the send time doesn't creep later
+	return now.Sub(*s.LastDigestAt) >= period-digestWindow
+}
+
+// Run sends digest emails as they come due until ctx is cancelled.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(digestInterval)
+	defer ticker.Stop()
+	for {
+		if n, err := SendDueDigests(time.Now()); err != nil {
+			log.Printf("[Notifications] Digest run failed: %v", err)
+		} else if n > 0 {
+			log.Printf("[Notifications] Sent %d digests", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDueDigests emails every user with queued events whose digest is due at now and
+// returns how many digests were sent.
+func SendDueDigests(now time.Time) (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	var userIDs []string
+	err = db.Select(&userIDs, `SELECT DISTINCT user_id FROM notification_digest_items`)
+	db.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pending digests: %w", err)
+	}
+
+	sent := 0
+	for _, userID := range userIDs {
+		settings, err := GetSettings(userID)
+		if err != nil {
+			log.Printf("[Notifications] Failed to load settings for user %s: %v", userID, err)
+			continue
+		}
+		if !digestDue(settings, now) {
+			continue
+		}
+		ok, err := sendDigest(settings, now)
+		if err != nil {
+			log.Printf("[Notifications] Failed to send digest to user %s: %v", userID, err)
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendDigest emails a user the events queued up to now. The events are only removed
+// once the email is sent, and replicas racing on the same user send it once.
+func sendDigest(settings *models.NotificationSettings, now time.Time) (bool, error) {
+	to, err := lookupEmail(settings.UserId)
+	if err != nil {
+		return false, err
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		DELETE FROM notification_digest_items WHERE user_id = $1 AND created_at <= $2
+		RETURNING id, event, actor_id, summary, created_at
+	`, settings.UserId, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim digest items: %w", err)
+	}
+	var items []models.NotificationDigestItem
+	for rows.Next() {
+		item := models.NotificationDigestItem{UserId: settings.UserId}
+		if err := rows.Scan(&item.Id, &item.Event, &item.ActorId, &item.Summary, &item.CreatedAt); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan digest item: %w", err)
+		}
+		// Drop events the user stopped wanting emails about since they were queued
+		if settings.Events[item.Event].Email {
+			items = append(items, item)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("digest items iteration error: %w", err)
+	}
+
+	if len(items) == 0 || to == "" {
+		return false, tx.Commit()
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO notification_preferences (user_id, last_digest_at, updated_at) VALUES ($1, $2, $2)
+		ON CONFLICT (user_id) DO UPDATE SET last_digest_at = EXCLUDED.last_digest_at
+	`, settings.UserId, now); err != nil {
+		return false, fmt.Errorf("failed to record digest: %w", err)
+	}
+	if err := digestEmail(settings.UserId, to, users.Locale(settings.UserId), settings.DigestFrequency, items).Send(); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit digest: %w", err)
+	}
+	return true, nil
+}
+
+// digestEmail builds the digest of items for a user in locale, newest events first.
+func digestEmail(userID, to, locale, frequency string, items []models.NotificationDigestItem) *mailer.Template {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].CreatedAt.After(items[j].CreatedAt)
+	})
+	type group struct {
+		people map[string]bool
+		lines  []string
+	}
+	groups := make(map[string]*group)
+	for _, item := range items {
+		g := groups[item.Event]
+		if g == nil {
+			g = &group{people: make(map[string]bool)}
+			groups[item.Event] = g
+		}
+		// Someone viewing a profile five times counts once
+		who := item.ActorId
+		if who == "" {
+			who = item.Summary
+		}
+		g.people[who] = true
+		if !slices.Contains(g.lines, item.Summary) {
+			g.lines = append(g.lines, item.Summary)
+		}
+	}
+
+	var sections []mailer.DigestSection
+	for _, event := range EventTypes {
+		g := groups[event]
+		if g == nil {
+			continue
+		}
+		lines := g.lines
+		if len(lines) > digestLines {
+			lines = lines[:digestLines]
+		}
+		sections = append(sections, mailer.DigestSection{
+			Title: digestTitle(locale, event, len(g.people)),
+			Lines: lines,
+			More:  max(len(g.people)-len(lines), 0),
+		})
+	}
+	return mailer.Digest(to, locale, frequency, sections).WithUnsubscribe(UnsubscribeURL(userID, digestUnsubscribe))
+}
+
+func digestTitle(locale, event string, people int) string {
+	switch event {
+	case EventProfileView, EventLike, EventComment, EventPostLike, EventPoke, EventMessage:
+		return i18n.N(locale, "digest."+event, people)
+	default:
+		return i18n.N(locale, "digest.other", people)
+	}
+}
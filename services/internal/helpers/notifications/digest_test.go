@@ -0,0 +1,213 @@
+package notifications
+
+import (
+	"spark/internal/i18n"
+	"spark/internal/mailer"
+	"spark/internal/models"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useMemoryMailer(t *testing.T) *mailer.MemoryMailer {
+	t.Helper()
+	fake := mailer.NewMemoryMailer()
+	prev := mailer.UseMailer(fake)
+	t.Cleanup(func() { mailer.UseMailer(prev) })
+	return fake
+}
+
+// stubDelivery replaces the database lookups email makes and returns the events queued
+// for digests
+func stubDelivery(t *testing.T) *[]Event {
+	t.Helper()
+	var queued []Event
+	prevLookup, prevQueue := lookupEmail, queueDigest
+	lookupEmail = func(userID string) (string, error) { return userID + "@example.com", nil }
+	queueDigest = func(e Event) error {
+		queued = append(queued, e)
+		return nil
+	}
+	t.Cleanup(func() { lookupEmail, queueDigest = prevLookup, prevQueue })
+	return &queued
+}
+
+func TestEmailRouting(t *testing.T) {
+	t.Setenv("UNSUBSCRIBE_SECRET", "test-secret")
+	t.Setenv("BACKEND_URL", "https://api.spark.test/")
+
+	tests := []struct {
+		name       string
+		event      Event
+		wantSent   bool
+		wantQueued bool
+	}{
+		{"match goes out now", Event{
+			Type:   EventMatch,
+			UserId: "u1",
+			Email:  func(to string) *mailer.Template { return mailer.NewMatch(to, i18n.DefaultLocale, "Asha") },
+		}, true, false},
+		{"unlock request goes out now", Event{
+			Type:   EventUnlockRequest,
+			UserId: "u1",
+			Email:  func(to string) *mailer.Template { return mailer.UnlockRequest(to, i18n.DefaultLocale, "Asha") },
+		}, true, false},
+		{"profile view waits for the digest", Event{
+			Type:    EventProfileView,
+			UserId:  "u1",
+			Summary: "Asha viewed your profile",
+			ActorId: "u2",
+		}, false, true},
+		{"like waits for the digest", Event{
+			Type:    EventLike,
+			UserId:  "u1",
+			Summary: "Someone liked you",
+			ActorId: "u2",
+		}, false, true},
+		{"digested event without a summary is dropped", Event{
+			Type:   EventComment,
+			UserId: "u1",
+		}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useMemoryMailer(t)
+			queued := stubDelivery(t)
+
+			if err := email(tt.event); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := len(fake.Sent()) == 1; got != tt.wantSent {
+				t.Fatalf("sent %d emails, want sent = %v", len(fake.Sent()), tt.wantSent)
+			}
+			if got := len(*queued) == 1; got != tt.wantQueued {
+				t.Fatalf("queued %d events, want queued = %v", len(*queued), tt.wantQueued)
+			}
+			if tt.wantSent {
+				sent := fake.Sent()[0]
+				if sent.ToEmail != "u1@example.com" {
+					t.Errorf("ToEmail = %q", sent.ToEmail)
+				}
+				if !strings.HasPrefix(sent.UnsubscribeURL, "https://api.spark.test/v1/notifications/unsubscribe?token=") {
+					t.Errorf("UnsubscribeURL = %q", sent.UnsubscribeURL)
+				}
+				if !strings.Contains(sent.HTML, sent.UnsubscribeURL) || !strings.Contains(sent.Text, sent.UnsubscribeURL) {
+					t.Error("unsubscribe link missing from the email body")
+				}
+			}
+		})
+	}
+}
+
+func TestDigestEmail(t *testing.T) {
+	t.Setenv("UNSUBSCRIBE_SECRET", "")
+	fake := useMemoryMailer(t)
+	base := time.Date(2025, 11, 3, 8, 0, 0, 0, time.UTC)
+	item := func(event, actor, summary string, minutes int) models.NotificationDigestItem {
+		return models.NotificationDigestItem{Event: event, ActorId: actor, Summary: summary, CreatedAt: base.Add(time.Duration(minutes) * time.Minute)}
+	}
+	items := []models.NotificationDigestItem{
+		item(EventProfileView, "a", "Asha viewed your profile", 1),
+		item(EventProfileView, "a", "Asha viewed your profile", 5),
+		item(EventProfileView, "b", "Ben viewed your profile", 2),
+		item(EventLike, "c", "Someone liked you", 3),
+		item(EventLike, "d", "Someone liked you", 4),
+		item(EventComment, "e", "Esha: love this", 6),
+		item(EventComment, "f", "Farid: same here", 7),
+		item(EventComment, "g", "Gia: where is this?", 8),
+		item(EventComment, "h", "Hari: nice", 9),
+	}
+
+	if err := digestEmail("u1", "u1@example.com", i18n.DefaultLocale, DigestWeekly, items).Send(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fake.Sent()) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(fake.Sent()))
+	}
+	sent := fake.Sent()[0]
+	if sent.Subject != "Your Spark weekly digest" {
+		t.Errorf("Subject = %q", sent.Subject)
+	}
+	for _, want := range []string{
+		"2 people viewed your profile",
+		"2 people liked you\n  - Someone liked you\n  and 1 more",
+		"4 people commented on your posts\n  - Hari: nice\n  - Gia: where is this?\n  - Farid: same here\n  and 1 more",
+	} {
+		if !strings.Contains(sent.Text, want) {
+			t.Errorf("digest text missing %q:\n%s", want, sent.Text)
+		}
+	}
+	if strings.Count(sent.Text, "Asha viewed your profile") != 1 {
+		t.Errorf("repeat views should be listed once:\n%s", sent.Text)
+	}
+	// Sections follow the settings order: profile views before likes before comments
+	if strings.Index(sent.Text, "liked you") > strings.Index(sent.Text, "commented") {
+		t.Errorf("sections out of order:\n%s", sent.Text)
+	}
+	if sent.UnsubscribeURL != "" {
+		t.Errorf("no unsubscribe link without a secret, got %q", sent.UnsubscribeURL)
+	}
+}
+
+func TestDigestDue(t *testing.T) {
+	kolkata, _ := time.LoadLocation("Asia/Kolkata")
+	morning := time.Date(2025, 11, 3, 9, 30, 0, 0, kolkata)
+	ago := func(d time.Duration) *time.Time {
+		t := morning.Add(-d)
+		return &t
+	}
+
+	tests := []struct {
+		name string
+		s    models.NotificationSettings
+		now  time.Time
+		want bool
+	}{
+		{"first digest in the morning", models.NotificationSettings{Timezone: "Asia/Kolkata", DigestFrequency: DigestDaily}, morning, true},
+		{"too early", models.NotificationSettings{Timezone: "Asia/Kolkata", DigestFrequency: DigestDaily}, morning.Add(-time.Hour), false},
+		{"window passed", models.NotificationSettings{Timezone: "Asia/Kolkata", DigestFrequency: DigestDaily}, morning.Add(3 * time.Hour), false},
+		{"morning in UTC is not morning in Kolkata", models.NotificationSettings{Timezone: "UTC", DigestFrequency: DigestDaily}, morning, false},
+		{"daily after yesterday's", models.NotificationSettings{Timezone: "Asia/Kolkata", DigestFrequency: DigestDaily, LastDigestAt: ago(24 * time.Hour)}, morning, true},
+		{"daily already sent today", models.NotificationSettings{Timezone: "Asia/Kolkata", DigestFrequency: DigestDaily, LastDigestAt: ago(20 * time.Minute)}, morning, false},
+		{"weekly a day later", models.NotificationSettings{Timezone: "Asia/Kolkata", DigestFrequency: DigestWeekly, LastDigestAt: ago(24 * time.Hour)}, morning, false},
+		{"weekly a week later", models.NotificationSettings{Timezone: "Asia/Kolkata", DigestFrequency: DigestWeekly, LastDigestAt: ago(7*24*time.Hour - 15*time.Minute)}, morning, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := digestDue(&tt.s, tt.now); got != tt.want {
+				t.Errorf("digestDue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Pushes held back by quiet hours are spread over the half hour after they end rather
+// than all going out when the clock hits it
+func TestHeldUntil(t *testing.T) {
+	night := time.Date(2025, 11, 3, 23, 0, 0, 0, time.UTC)
+	end := time.Date(2025, 11, 4, 7, 0, 0, 0, time.UTC)
+	settings := func(userID string) *models.NotificationSettings {
+		return &models.NotificationSettings{UserId: userID, QuietHoursStart: "22:00", QuietHoursEnd: "07:00", Timezone: "UTC"}
+	}
+
+	offsets := make(map[time.Duration]bool)
+	for i := range 20 {
+		s := settings(fmt.Sprintf("user-%d", i))
+		at := HeldUntil(s, night)
+		if at.Before(end) || !at.Before(end.Add(heldSpread)) {
+			t.Fatalf("HeldUntil = %v, want within %v of %v", at, heldSpread, end)
+		}
+		if again := HeldUntil(s, night.Add(time.Hour)); !again.Equal(at) {
+			t.Errorf("%s's held pushes go out at %v and %v", s.UserId, at, again)
+		}
+		offsets[at.Sub(end)] = true
+	}
+	if len(offsets) < 10 {
+		t.Errorf("20 users share %d send times", len(offsets))
+	}
+
+	if at := HeldUntil(settings("user-a"), end.Add(time.Hour)); !at.Equal(end.Add(time.Hour)) {
+		t.Errorf("outside quiet hours HeldUntil = %v, want now", at)
+	}
+}
@@ -0,0 +1,111 @@
+package notifications
+
+import (
+	"spark/internal/helpers/pushnotify"
+	"spark/internal/helpers/users"
+	"spark/internal/mailer"
+	"log"
+	"time"
+)
+
+// Event is one notification for one user. Channels an event doesn't fill in are
+// never used for it, whatever the user's settings say.
+type Event struct {
+	Type   string
+	UserId string
+	Push   *pushnotify.PushNotification
+	// Email is sent right away for urgent event types
+	Email func(to string) *mailer.Template
+	// Summary is the event's line in digest emails, which carry every other type
+	Summary string
+	// ActorId is the user who caused the event, so digests can count people
+	ActorId string
+	// Link is the deep link the app opens for the event, see links.go
+	Link string
+}
+
+// Dispatch delivers e on the channels its recipient wants. In-app entries are kept in
+// the notification center and pushes are held back during quiet hours. Urgent emails
+// go out now with a link that turns them off; the rest wait for the digest. Dispatch
+// blocks, so callers on a request path run it in a goroutine.
+func Dispatch(e Event) {
+	settings, err := GetSettings(e.UserId)
+	if err != nil {
+		log.Printf("[Notifications] Failed to load settings for user %s, using defaults: %v", e.UserId, err)
+		settings = DefaultSettings(e.UserId)
+	}
+	channels, ok := settings.Events[e.Type]
+	if !ok {
+		log.Printf("[Notifications] Unknown event type %q for user %s", e.Type, e.UserId)
+		return
+	}
+
+	if channels.InApp {
+		if err := saveInApp(e); err != nil {
+			log.Printf("[Notifications] Failed to save %s for user %s: %v", e.Type, e.UserId, err)
+		}
+	}
+
+	if e.Push != nil && channels.Push {
+		if e.Link != "" {
+			e.Push.Data = withLink(e.Push.Data, e.Link)
+		}
+		now := time.Now()
+		if InQuietHours(settings, now) {
+			// The queue worker sends it shortly after the quiet hours are over
+			if err := pushnotify.ScheduleToUser(e.UserId, *e.Push, HeldUntil(settings, now)); err != nil {
+				log.Printf("[Notifications] Failed to hold %s push for user %s: %v", e.Type, e.UserId, err)
+			}
+		} else if err := pushnotify.SendToUser(e.UserId, *e.Push); err != nil {
+			log.Printf("[Notifications] Failed to push %s to user %s: %v", e.Type, e.UserId, err)
+		}
+	}
+
+	if channels.Email {
+		if err := email(e); err != nil {
+			log.Printf("[Notifications] Failed to email %s to user %s: %v", e.Type, e.UserId, err)
+		}
+	}
+}
+
+// email sends e's email now when it is urgent and queues it for the next digest
+// otherwise.
+func email(e Event) error {
+	if !IsUrgent(e.Type) {
+		if e.Summary == "" {
+			return nil
+		}
+		return queueDigest(e)
+	}
+	if e.Email == nil {
+		return nil
+	}
+	to, err := lookupEmail(e.UserId)
+	if err != nil || to == "" {
+		return err
+	}
+	if err := e.Email(to).WithUnsubscribe(UnsubscribeURL(e.UserId, e.Type)).Send(); err != nil {
+		return err
+	}
+	log.Printf("[Notifications] Sent %s email to %s", e.Type, to)
+	return nil
+}
+
+// lookupEmail finds where to email a user. Tests replace it.
+var lookupEmail = func(userID string) (string, error) {
+	user, err := users.GetUserById(userID)
+	if err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
+// withLink adds the deep link to a push's data without changing the caller's map
+func withLink(data map[string]interface{}, link string) map[string]interface{} {
+	out := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		out[k] = v
+	}
+	out["link"] = link
+	return out
+}
@@ -0,0 +1,191 @@
+package notifications
+
+import (
+	"spark/internal/models"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+)
+
+const (
+	DefaultInboxLimit = 30
+	MaxInboxLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// saveInApp adds e to its recipient's notification center. Chat messages are left
+// out even when a user's saved settings ask for them. Tests replace it.
+var saveInApp = func(e Event) error {
+	if e.Type == EventMessage {
+		return nil
+	}
+	title, body := e.Summary, ""
+	if e.Push != nil {
+		title, body = e.Push.Title, e.Push.Body
+	}
+	if title == "" {
+		return nil
+	}
+	_, err := AddToInbox(&models.Notification{
+		UserId:  e.UserId,
+		Event:   e.Type,
+		Title:   title,
+		Body:    body,
+		Link:    e.Link,
+		ActorId: e.ActorId,
+	})
+	return err
+}
+
+// AddToInbox stores n in its user's notification center. A notification with the same
+// DedupeKey as an earlier one is skipped and reports false.
+func AddToInbox(n *models.Notification) (bool, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if n.Id == "" {
+		n.Id = utils.GenerateID()
+	}
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now()
+	}
+	res, err := db.Exec(`
+		INSERT INTO notifications (id, user_id, event, title, body, link, actor_id, dedupe_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT DO NOTHING
+	`, n.Id, n.UserId, n.Event, n.Title, n.Body, n.Link, n.ActorId, n.DedupeKey, n.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to save notification: %w", err)
+	}
+	added, _ := res.RowsAffected()
+	return added > 0, nil
+}
+
+func encodeCursor(n *models.Notification) string {
+	raw := n.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + n.Id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+	return t, id, nil
+}
+
+// ListInbox returns a user's notifications newest first, along with the cursor of the
+// next page (empty when there are no more).
+func ListInbox(userID, cursor string, limit int) ([]*models.Notification, string, error) {
+	if limit <= 0 {
+		limit = DefaultInboxLimit
+	}
+	if limit > MaxInboxLimit {
+		limit = MaxInboxLimit
+	}
+
+	query := `
+		SELECT id, user_id, event, title, body, link, actor_id, dedupe_key, read_at, created_at
+		FROM notifications WHERE user_id = $1`
+	args := []any{userID}
+	if cursor != "" {
+		ts, id, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, ts, id)
+		query += " AND (created_at, id) < ($2, $3)"
+	}
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query notifications: %w", err)
+	}
+	defer rows.Close()
+
+	list := make([]*models.Notification, 0, limit)
+	for rows.Next() {
+		var n models.Notification
+		if err := rows.Scan(&n.Id, &n.UserId, &n.Event, &n.Title, &n.Body, &n.Link, &n.ActorId, &n.DedupeKey, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, "", fmt.Errorf("failed to scan notification: %w", err)
+		}
+		list = append(list, &n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("notifications iteration error: %w", err)
+	}
+
+	next := ""
+	if len(list) > limit {
+		list = list[:limit]
+		next = encodeCursor(list[limit-1])
+	}
+	return list, next, nil
+}
+
+// MarkRead marks a user's notifications as read, or all of them when ids is empty.
+// It returns how many were newly marked.
+func MarkRead(userID string, ids []string) (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	query := `UPDATE notifications SET read_at = $2 WHERE user_id = $1 AND read_at IS NULL`
+	args := []any{userID, time.Now()}
+	if len(ids) > 0 {
+		placeholders := make([]string, len(ids))
+		for i, id := range ids {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		query += " AND id IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// UnreadCount returns how many of a user's notifications they haven't read.
+func UnreadCount(userID string) (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,41 @@
+package notifications
+
+import "strings"
+
+// Deep links the Expo app routes on. They follow the app's file routes under the
+// "spark" scheme.
+const (
+	linkScheme = "spark://"
+
+	// InboxLink opens the notification center itself
+	InboxLink = linkScheme + "notifications"
+)
+
+// ChatLink opens a chat.
+func ChatLink(chatID string) string {
+	return linkScheme + "chat/" + chatID
+}
+
+// ChatIDFromLink returns the chat a ChatLink opens, or "" for any other link.
+func ChatIDFromLink(link string) string {
+	id, ok := strings.CutPrefix(link, linkScheme+"chat/")
+	if !ok {
+		return ""
+	}
+	return id
+}
+
+// ProfileLink opens a user's profile.
+func ProfileLink(userID string) string {
+	return linkScheme + "user/" + userID
+}
+
+// PostLink opens a community post.
+func PostLink(postID string) string {
+	return linkScheme + "community/" + postID
+}
+
+// UnlockLink opens the photo unlock request for a match.
+func UnlockLink(matchID string) string {
+	return linkScheme + "modal/unlock?matchId=" + matchID
+}
@@ -1,170 +1,268 @@
 package notifications
 
 import (
+	"spark/internal/helpers/pushnotify"
+	"spark/internal/helpers/subscriptions"
 	"spark/internal/helpers/users"
+	"spark/internal/i18n"
 	"spark/internal/mailer"
 	"log"
+	"unicode/utf8"
 )
 
-// SendNewMessageNotification sends an email when a user receives a new message
-func SendNewMessageNotification(recipientUserID, senderUserID, messagePreview string) {
-	go func() {
-		recipient, err := users.GetUserById(recipientUserID)
-		if err != nil {
-			log.Printf("[Notifications] Failed to get recipient user %s: %v", recipientUserID, err)
-			return
-		}
-
-		sender, err := users.GetUserById(senderUserID)
-		if err != nil {
-			log.Printf("[Notifications] Failed to get sender user %s: %v", senderUserID, err)
-			return
-		}
-
-		senderName := sender.FirstName
-		if senderName == "" {
-			senderName = "Someone"
-		}
+// displayName returns a user's first name, or "Someone" in locale when it can't be shown
+func displayName(userID, locale string) string {
+	user, err := users.GetUserById(userID)
+	if err != nil {
+		log.Printf("[Notifications] Failed to get user %s: %v", userID, err)
+		return i18n.T(locale, "notification.someone")
+	}
+	if user.FirstName == "" {
+		return i18n.T(locale, "notification.someone")
+	}
+	return user.FirstName
+}
 
-		template := mailer.NewMessage(recipient.Email, senderName, messagePreview)
-		if err := template.Send(); err != nil {
-			log.Printf("[Notifications] Failed to send new message email to %s: %v", recipient.Email, err)
-			return
-		}
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-3]) + "..."
+}
 
-		log.Printf("[Notifications] Sent new message notification to %s from %s", recipient.Email, senderName)
+// SendNewMessageNotification notifies a user when they receive a new message
+func SendNewMessageNotification(recipientUserID, senderUserID, chatID, messagePreview string) {
+	go func() {
+		senderName := displayName(senderUserID, users.Locale(recipientUserID))
+		push := pushnotify.MessagePush(senderName, chatID, messagePreview)
+		Dispatch(Event{
+			Type:    EventMessage,
+			UserId:  recipientUserID,
+			Push:    &push,
+			Summary: senderName + ": " + truncate(messagePreview, 80),
+			ActorId: senderUserID,
+			Link:    ChatLink(chatID),
+		})
 	}()
 }
 
-// SendProfileViewedNotification sends an email when someone views a user's profile
+// SendProfileViewedNotification notifies a user when someone views their profile
 func SendProfileViewedNotification(targetUserID, viewerUserID string) {
 	go func() {
-		target, err := users.GetUserById(targetUserID)
-		if err != nil {
-			log.Printf("[Notifications] Failed to get target user %s: %v", targetUserID, err)
-			return
-		}
-
-		viewer, err := users.GetUserById(viewerUserID)
-		if err != nil {
-			log.Printf("[Notifications] Failed to get viewer user %s: %v", viewerUserID, err)
-			return
-		}
-
-		viewerName := viewer.FirstName
-		if viewerName == "" {
-			viewerName = "Someone"
-		}
-
-		template := mailer.ProfileViewed(target.Email, viewerName)
-		if err := template.Send(); err != nil {
-			log.Printf("[Notifications] Failed to send profile viewed email to %s: %v", target.Email, err)
-			return
-		}
-
-		log.Printf("[Notifications] Sent profile viewed notification to %s from %s", target.Email, viewerName)
+		locale := users.Locale(targetUserID)
+		viewerName := displayName(viewerUserID, locale)
+		Dispatch(Event{
+			Type:   EventProfileView,
+			UserId: targetUserID,
+			Push: &pushnotify.PushNotification{
+				Title: i18n.T(locale, "push.profile_view.title"),
+				Body:  i18n.T(locale, "push.profile_view.body", "name", viewerName),
+				Data: map[string]interface{}{
+					"type":    "profile_view",
+					"user_id": viewerUserID,
+				},
+			},
+			Summary: i18n.T(locale, "notification.profile_view", "name", viewerName),
+			ActorId: viewerUserID,
+			Link:    ProfileLink(viewerUserID),
+		})
 	}()
 }
 
-// SendSuperlikeNotification sends an email when someone superlikes a user
+// SendSuperlikeNotification notifies a user when someone superlikes them
 func SendSuperlikeNotification(targetUserID, senderUserID string) {
 	go func() {
-		target, err := users.GetUserById(targetUserID)
-		if err != nil {
-			log.Printf("[Notifications] Failed to get target user %s: %v", targetUserID, err)
-			return
-		}
-
-		sender, err := users.GetUserById(senderUserID)
-		if err != nil {
-			log.Printf("[Notifications] Failed to get sender user %s: %v", senderUserID, err)
-			return
-		}
-
-		senderName := sender.FirstName
-		if senderName == "" {
-			senderName = "Someone"
-		}
+		locale := users.Locale(targetUserID)
+		senderName := displayName(senderUserID, locale)
+		Dispatch(Event{
+			Type:   EventSuperlike,
+			UserId: targetUserID,
+			Push: &pushnotify.PushNotification{
+				Title: i18n.T(locale, "push.superlike.title"),
+				Body:  i18n.T(locale, "push.superlike.body", "name", senderName),
+				Data: map[string]interface{}{
+					"type":    "superlike",
+					"user_id": senderUserID,
+				},
+				ChannelId: "matches",
+			},
+			Email: func(to string) *mailer.Template {
+				return mailer.SuperlikeReceived(to, locale, senderName)
+			},
+			ActorId: senderUserID,
+			Link:    ProfileLink(senderUserID),
+		})
+	}()
+}
 
-		template := mailer.SuperlikeReceived(target.Email, senderName)
-		if err := template.Send(); err != nil {
-			log.Printf("[Notifications] Failed to send superlike email to %s: %v", target.Email, err)
-			return
+// SendLikeNotification notifies a user when someone likes them. Only users who can
+// see who liked them are told who it was.
+func SendLikeNotification(targetUserID, senderUserID string) {
+	go func() {
+		locale := users.Locale(targetUserID)
+		summary, link := i18n.T(locale, "notification.like_anonymous"), linkScheme+"(tabs)/swipe"
+		if subscriptions.HasFeature(targetUserID, "see_who_liked") {
+			summary = i18n.T(locale, "notification.like", "name", displayName(senderUserID, locale))
+			link = ProfileLink(senderUserID)
 		}
-
-		log.Printf("[Notifications] Sent superlike notification to %s from %s", target.Email, senderName)
+		Dispatch(Event{
+			Type:    EventLike,
+			UserId:  targetUserID,
+			Summary: summary,
+			ActorId: senderUserID,
+			Link:    link,
+		})
 	}()
 }
 
-// SendMatchNotification sends an email when a match is created (to both users)
+// SendMatchNotification notifies both users when a match is created
 func SendMatchNotification(userID1, userID2 string) {
 	go func() {
-		user1, err := users.GetUserById(userID1)
-		if err != nil {
-			log.Printf("[Notifications] Failed to get user1 %s: %v", userID1, err)
-			return
-		}
+		sendMatch(userID1, userID2)
+		sendMatch(userID2, userID1)
+	}()
+}
 
-		user2, err := users.GetUserById(userID2)
-		if err != nil {
-			log.Printf("[Notifications] Failed to get user2 %s: %v", userID2, err)
-			return
-		}
+func sendMatch(userID, matchedUserID string) {
+	locale := users.Locale(userID)
+	matchedName := displayName(matchedUserID, locale)
+	push := pushnotify.MatchPush(locale, matchedUserID, matchedName)
+	Dispatch(Event{
+		Type:   EventMatch,
+		UserId: userID,
+		Push:   &push,
+		Email: func(to string) *mailer.Template {
+			return mailer.NewMatch(to, locale, matchedName)
+		},
+		ActorId: matchedUserID,
+		Link:    ProfileLink(matchedUserID),
+	})
+}
 
-		user1Name := user1.FirstName
-		if user1Name == "" {
-			user1Name = "Someone"
-		}
+// SendPokeNotification notifies a user when someone pokes them
+func SendPokeNotification(targetUserID, senderUserID string) {
+	go func() {
+		locale := users.Locale(targetUserID)
+		senderName := displayName(senderUserID, locale)
+		Dispatch(Event{
+			Type:   EventPoke,
+			UserId: targetUserID,
+			Push: &pushnotify.PushNotification{
+				Title: i18n.T(locale, "push.poke.title"),
+				Body:  i18n.T(locale, "push.poke.body", "name", senderName),
+				Data: map[string]interface{}{
+					"type":    "poke",
+					"user_id": senderUserID,
+				},
+			},
+			Summary: i18n.T(locale, "notification.poke", "name", senderName),
+			ActorId: senderUserID,
+			Link:    ProfileLink(senderUserID),
+		})
+	}()
+}
 
-		user2Name := user2.FirstName
-		if user2Name == "" {
-			user2Name = "Someone"
-		}
+// SendCommentNotification notifies the author of a post when someone else comments on it
+func SendCommentNotification(postAuthorID, commenterID, postID, content string) {
+	sendComment(postAuthorID, commenterID, postID, content, "push.comment.title")
+}
 
-		// Send to user1
-		template1 := mailer.NewMatch(user1.Email, user2Name)
-		if err := template1.Send(); err != nil {
-			log.Printf("[Notifications] Failed to send match email to %s: %v", user1.Email, err)
-		} else {
-			log.Printf("[Notifications] Sent match notification to %s about %s", user1.Email, user2Name)
-		}
+// SendCommentReplyNotification notifies the author of a comment when someone else
+// replies to it
+func SendCommentReplyNotification(commentAuthorID, replierID, postID, content string) {
+	sendComment(commentAuthorID, replierID, postID, content, "push.comment_reply.title")
+}
 
-		// Send to user2
-		template2 := mailer.NewMatch(user2.Email, user1Name)
-		if err := template2.Send(); err != nil {
-			log.Printf("[Notifications] Failed to send match email to %s: %v", user2.Email, err)
-		} else {
-			log.Printf("[Notifications] Sent match notification to %s about %s", user2.Email, user1Name)
-		}
+// sendComment pushes titleKey, the catalog key of the push title, to recipientID
+func sendComment(recipientID, commenterID, postID, content, titleKey string) {
+	if recipientID == commenterID {
+		return
+	}
+	go func() {
+		locale := users.Locale(recipientID)
+		commenterName := displayName(commenterID, locale)
+		Dispatch(Event{
+			Type:   EventComment,
+			UserId: recipientID,
+			Push: &pushnotify.PushNotification{
+				Title: i18n.T(locale, titleKey, "name", commenterName),
+				Body:  truncate(content, 100),
+				Data: map[string]interface{}{
+					"type":    "comment",
+					"post_id": postID,
+				},
+			},
+			Summary: commenterName + ": " + truncate(content, 80),
+			ActorId: commenterID,
+			Link:    PostLink(postID),
+		})
 	}()
 }
 
-// SendPokeNotification sends an email when someone pokes a user
-func SendPokeNotification(targetUserID, senderUserID string) {
+// SendPostLikeNotification notifies the author of a post when someone else likes it
+func SendPostLikeNotification(postAuthorID, likerID, postID string) {
+	if postAuthorID == likerID {
+		return
+	}
 	go func() {
-		target, err := users.GetUserById(targetUserID)
-		if err != nil {
-			log.Printf("[Notifications] Failed to get target user %s: %v", targetUserID, err)
-			return
-		}
-
-		sender, err := users.GetUserById(senderUserID)
-		if err != nil {
-			log.Printf("[Notifications] Failed to get sender user %s: %v", senderUserID, err)
-			return
-		}
+		locale := users.Locale(postAuthorID)
+		Dispatch(Event{
+			Type:    EventPostLike,
+			UserId:  postAuthorID,
+			Summary: i18n.T(locale, "notification.post_like", "name", displayName(likerID, locale)),
+			ActorId: likerID,
+			Link:    PostLink(postID),
+		})
+	}()
+}
 
-		senderName := sender.FirstName
-		if senderName == "" {
-			senderName = "Someone"
-		}
+// SendUnlockRequestNotification notifies a user when their match asks to reveal photos
+func SendUnlockRequestNotification(recipientID, requesterID, matchID string) {
+	go func() {
+		locale := users.Locale(recipientID)
+		requesterName := displayName(requesterID, locale)
+		push := pushnotify.UnlockRequestPush(locale, requesterName, matchID)
+		Dispatch(Event{
+			Type:   EventUnlockRequest,
+			UserId: recipientID,
+			Push:   &push,
+			Email: func(to string) *mailer.Template {
+				return mailer.UnlockRequest(to, locale, requesterName)
+			},
+			ActorId: requesterID,
+			Link:    UnlockLink(matchID),
+		})
+	}()
+}
 
-		template := mailer.PokeReceived(target.Email, senderName)
-		if err := template.Send(); err != nil {
-			log.Printf("[Notifications] Failed to send poke email to %s: %v", target.Email, err)
-			return
-		}
+// SendStreakMilestoneNotification notifies a user when their chat with partnerName
+// reaches a streak milestone
+func SendStreakMilestoneNotification(recipientID, partnerName string, streak int, matchID, chatID string) {
+	go func() {
+		push := pushnotify.StreakMilestonePush(users.Locale(recipientID), partnerName, streak, matchID)
+		Dispatch(Event{
+			Type:   EventStreak,
+			UserId: recipientID,
+			Push:   &push,
+			Link:   ChatLink(chatID),
+		})
+	}()
+}
 
-		log.Printf("[Notifications] Sent poke notification to %s from %s", target.Email, senderName)
+// SendReferralRewardNotification tells a referrer they earned credits for a friend
+// who joined with their code
+func SendReferralRewardNotification(referrerID string) {
+	go func() {
+		locale := users.Locale(referrerID)
+		Dispatch(Event{
+			Type:   EventRewards,
+			UserId: referrerID,
+			Push: &pushnotify.PushNotification{
+				Title: i18n.T(locale, "push.referral_rewarded.title"),
+				Body:  i18n.T(locale, "push.referral_rewarded.body"),
+				Data:  map[string]any{"type": "referral_rewarded"},
+			},
+			Link: InboxLink,
+		})
 	}()
 }
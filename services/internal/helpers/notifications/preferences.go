@@ -0,0 +1,298 @@
+package notifications
+
+import (
+	"spark/internal/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+)
+
+// Event types a user can choose channels for
+const (
+	EventMessage       = "message"
+	EventMatch         = "match"
+	EventSuperlike     = "superlike"
+	EventLike          = "like"
+	EventPoke          = "poke"
+	EventProfileView   = "profile_view"
+	EventComment       = "comment" // Comments on the user's posts and replies to their comments
+	EventPostLike      = "post_like"
+	EventUnlockRequest = "unlock_request"
+	EventStreak        = "streak"
+	EventAnnouncements = "announcements" // Campaigns sent by the team
+	EventRewards       = "rewards"       // Credits earned through referrals
+)
+
+// Channels a notification can be delivered on
+const (
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+	ChannelInApp = "in_app"
+)
+
+// defaultChannels are used for event types a user hasn't changed. Chat messages never
+// go into the inbox, since the chat list already shows them; low-priority email goes
+// into the digest.
+var defaultChannels = map[string]models.NotificationChannels{
+	EventMessage:       {Push: true},
+	EventMatch:         {Push: true, Email: true, InApp: true},
+	EventSuperlike:     {Push: true, Email: true, InApp: true},
+	EventLike:          {Email: true, InApp: true},
+	EventPoke:          {Push: true, InApp: true},
+	EventProfileView:   {Email: true, InApp: true},
+	EventComment:       {Push: true, Email: true, InApp: true},
+	EventPostLike:      {InApp: true},
+	EventUnlockRequest: {Push: true, Email: true, InApp: true},
+	EventStreak:        {Push: true, InApp: true},
+	EventAnnouncements: {Push: true, InApp: true},
+	EventRewards:       {Push: true, InApp: true},
+}
+
+// urgentEvents are emailed as they happen. Email for every other event type waits
+// for the user's digest.
+var urgentEvents = map[string]bool{
+	EventMatch:         true,
+	EventSuperlike:     true,
+	EventUnlockRequest: true,
+}
+
+// IsUrgent reports whether event's email goes out right away rather than in a digest.
+func IsUrgent(event string) bool {
+	return urgentEvents[event]
+}
+
+// EventTypes lists every event type in the order settings are shown.
+var EventTypes = []string{
+	EventMessage,
+	EventMatch,
+	EventSuperlike,
+	EventLike,
+	EventPoke,
+	EventProfileView,
+	EventComment,
+	EventPostLike,
+	EventUnlockRequest,
+	EventStreak,
+	EventAnnouncements,
+	EventRewards,
+}
+
+// How often digest emails go out
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+const defaultTimezone = "UTC"
+
+var clockPattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+var (
+	ErrUnknownEvent    = errors.New("unknown notification event type")
+	ErrInvalidTime     = errors.New("quiet hours must be HH:MM in 24-hour time")
+	ErrQuietHalfSet    = errors.New("quiet hours need both a start and an end")
+	ErrInvalidTimezone = errors.New("unknown timezone")
+	ErrInvalidDigest   = errors.New("digest frequency must be daily or weekly")
+)
+
+// DefaultSettings are the settings of a user who never changed them.
+func DefaultSettings(userID string) *models.NotificationSettings {
+	events := make(map[string]models.NotificationChannels, len(defaultChannels))
+	for event, channels := range defaultChannels {
+		events[event] = channels
+	}
+	return &models.NotificationSettings{
+		UserId:          userID,
+		Events:          events,
+		Timezone:        defaultTimezone,
+		DigestFrequency: DigestDaily,
+	}
+}
+
+// GetSettings returns userID's notification settings with defaults filled in.
+func GetSettings(userID string) (*models.NotificationSettings, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var raw []byte
+	settings := DefaultSettings(userID)
+	err = db.QueryRow(`
+		SELECT events, quiet_hours_start, quiet_hours_end, timezone, digest_frequency, last_digest_at, updated_at
+		FROM notification_preferences WHERE user_id = $1
+	`, userID).Scan(&raw, &settings.QuietHoursStart, &settings.QuietHoursEnd, &settings.Timezone,
+		&settings.DigestFrequency, &settings.LastDigestAt, &settings.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notification settings: %w", err)
+	}
+
+	var saved map[string]models.NotificationChannels
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		return nil, fmt.Errorf("failed to decode notification settings: %w", err)
+	}
+	for event, channels := range saved {
+		// Types we no longer send are dropped rather than shown
+		if _, ok := defaultChannels[event]; ok {
+			settings.Events[event] = channels
+		}
+	}
+	return settings, nil
+}
+
+// SettingsUpdate changes some of a user's settings. Nil fields are left alone, and
+// Events only needs the event types being changed.
+type SettingsUpdate struct {
+	Events          map[string]models.NotificationChannels
+	QuietHoursStart *string
+	QuietHoursEnd   *string
+	Timezone        *string
+	DigestFrequency *string
+}
+
+// UpdateSettings applies update to userID's settings and returns the result.
+func UpdateSettings(userID string, update SettingsUpdate) (*models.NotificationSettings, error) {
+	settings, err := GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	for event, channels := range update.Events {
+		if _, ok := defaultChannels[event]; !ok {
+			return nil, ErrUnknownEvent
+		}
+		settings.Events[event] = channels
+	}
+	if update.QuietHoursStart != nil {
+		settings.QuietHoursStart = *update.QuietHoursStart
+	}
+	if update.QuietHoursEnd != nil {
+		settings.QuietHoursEnd = *update.QuietHoursEnd
+	}
+	if update.Timezone != nil {
+		settings.Timezone = *update.Timezone
+	}
+	if update.DigestFrequency != nil {
+		settings.DigestFrequency = *update.DigestFrequency
+	}
+	if err := validate(settings); err != nil {
+		return nil, err
+	}
+	return settings, save(settings)
+}
+
+func validate(s *models.NotificationSettings) error {
+	if (s.QuietHoursStart == "") != (s.QuietHoursEnd == "") {
+		return ErrQuietHalfSet
+	}
+	for _, t := range []string{s.QuietHoursStart, s.QuietHoursEnd} {
+		if t != "" && !clockPattern.MatchString(t) {
+			return ErrInvalidTime
+		}
+	}
+	if s.Timezone == "" {
+		s.Timezone = defaultTimezone
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return ErrInvalidTimezone
+	}
+	if s.DigestFrequency != DigestDaily && s.DigestFrequency != DigestWeekly {
+		return ErrInvalidDigest
+	}
+	return nil
+}
+
+func save(s *models.NotificationSettings) error {
+	events, err := json.Marshal(s.Events)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification settings: %w", err)
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	s.UpdatedAt = time.Now()
+	if _, err := db.Exec(`
+		INSERT INTO notification_preferences
+			(user_id, events, quiet_hours_start, quiet_hours_end, timezone, digest_frequency, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (user_id) DO UPDATE SET
+			events = EXCLUDED.events,
+			quiet_hours_start = EXCLUDED.quiet_hours_start,
+			quiet_hours_end = EXCLUDED.quiet_hours_end,
+			timezone = EXCLUDED.timezone,
+			digest_frequency = EXCLUDED.digest_frequency,
+			updated_at = EXCLUDED.updated_at
+	`, s.UserId, string(events), s.QuietHoursStart, s.QuietHoursEnd, s.Timezone, s.DigestFrequency, s.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to save notification settings: %w", err)
+	}
+	return nil
+}
+
+// InQuietHours reports whether t falls inside the user's quiet hours. Ranges that
+// cross midnight, like 22:00-07:00, are supported.
+func InQuietHours(s *models.NotificationSettings, t time.Time) bool {
+	if s.QuietHoursStart == "" || s.QuietHoursEnd == "" || s.QuietHoursStart == s.QuietHoursEnd {
+		return false
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	now := t.In(loc).Format("15:04")
+	if s.QuietHoursStart < s.QuietHoursEnd {
+		return now >= s.QuietHoursStart && now < s.QuietHoursEnd
+	}
+	return now >= s.QuietHoursStart || now < s.QuietHoursEnd
+}
+
+// QuietHoursEnd returns when the quiet hours t falls in end, or t when it isn't in
+// quiet hours.
+func QuietHoursEnd(s *models.NotificationSettings, t time.Time) time.Time {
+	if !InQuietHours(s, t) {
+		return t
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	end, err := time.ParseInLocation("15:04", s.QuietHoursEnd, loc)
+	if err != nil {
+		return t
+	}
+	local := t.In(loc)
+	at := time.Date(local.Year(), local.Month(), local.Day(), end.Hour(), end.Minute(), 0, 0, loc)
+	if !at.After(t) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at
+}
+
+// heldSpread is the window after quiet hours end that held pushes are sent over, so
+// everyone whose quiet hours end at 07:00 isn't pushed in the same second.
+const heldSpread = 30 * time.Minute
+
+// HeldUntil returns when a push held back by quiet hours at t goes out: QuietHoursEnd
+// plus an offset within heldSpread. The offset comes from the user id, so one user's
+// held pushes keep their order.
+func HeldUntil(s *models.NotificationSettings, t time.Time) time.Time {
+	end := QuietHoursEnd(s, t)
+	if end.Equal(t) {
+		return t
+	}
+	h := fnv.New32a()
+	h.Write([]byte(s.UserId))
+	return end.Add(time.Duration(h.Sum32()%uint32(heldSpread/time.Second)) * time.Second)
+}
@@ -0,0 +1,95 @@
+package notifications
+
+import (
+	"spark/internal/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/MelloB1989/karma/config"
+)
+
+var ErrInvalidUnsubscribe = errors.New("invalid unsubscribe link")
+
+// unsubscribeSecret signs unsubscribe links. Without it emails go out without one.
+func unsubscribeSecret() []byte {
+	return []byte(config.GetEnvRaw("UNSUBSCRIBE_SECRET"))
+}
+
+// UnsubscribeToken is the signed token that turns off email for event for userID. It
+// doesn't expire, since old emails should keep working.
+func UnsubscribeToken(userID, event string) string {
+	secret := unsubscribeSecret()
+	if len(secret) == 0 {
+		return ""
+	}
+	payload := userID + ":" + event
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + sign(secret, payload)
+}
+
+// UnsubscribeURL is the one-click link put in emails about event.
+func UnsubscribeURL(userID, event string) string {
+	token := UnsubscribeToken(userID, event)
+	if token == "" {
+		return ""
+	}
+	base := strings.TrimSuffix(config.GetEnvRaw("BACKEND_URL"), "/")
+	return base + "/v1/notifications/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+// ParseUnsubscribeToken checks token and returns the user and event type it was
+// issued for, without changing anything.
+func ParseUnsubscribeToken(token string) (userID, event string, err error) {
+	secret := unsubscribeSecret()
+	encoded, sig, ok := strings.Cut(token, ".")
+	if len(secret) == 0 || !ok {
+		return "", "", ErrInvalidUnsubscribe
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || !hmac.Equal([]byte(sig), []byte(sign(secret, string(raw)))) {
+		return "", "", ErrInvalidUnsubscribe
+	}
+	userID, event, ok = strings.Cut(string(raw), ":")
+	if !ok || userID == "" {
+		return "", "", ErrInvalidUnsubscribe
+	}
+	return userID, event, nil
+}
+
+// Unsubscribe checks token and turns off the email it was issued for. It returns the
+// event type that was turned off, or "digest" for digest emails.
+func Unsubscribe(token string) (string, error) {
+	userID, event, err := ParseUnsubscribeToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	settings, err := GetSettings(userID)
+	if err != nil {
+		return "", err
+	}
+	off := make(map[string]models.NotificationChannels)
+	for e, channels := range settings.Events {
+		// The digest link turns off every email that goes into digests
+		if e == event || (event == digestUnsubscribe && !IsUrgent(e)) {
+			channels.Email = false
+			off[e] = channels
+		}
+	}
+	if len(off) == 0 {
+		return "", ErrInvalidUnsubscribe
+	}
+	if _, err := UpdateSettings(userID, SettingsUpdate{Events: off}); err != nil {
+		return "", err
+	}
+	return event, nil
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
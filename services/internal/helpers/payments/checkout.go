@@ -0,0 +1,293 @@
+package payments
+
+import (
+	"spark/internal/helpers/promotions"
+	"spark/internal/helpers/subscriptions"
+	"spark/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/config"
+)
+
+var (
+	ErrInvalidPeriod     = errors.New("billing period must be monthly or yearly")
+	ErrAlreadySubscribed = errors.New("already subscribed; change plans instead")
+	ErrNoPortal          = errors.New("no billing portal for this subscription")
+	ErrNotBilled         = errors.New("this subscription isn't billed online and can't change plans")
+	ErrStoreRefund       = errors.New("app store subscriptions are refunded by the store")
+)
+
+// StartCheckout starts a web checkout for user to buy planID, billed every period. The
+// subscription is created by the provider's webhook once payment goes through.
+func StartCheckout(ctx context.Context, user *models.User, planID, period, returnURL string) (*Checkout, error) {
+	if period != subscriptions.PeriodMonthly && period != subscriptions.PeriodYearly {
+		return nil, ErrInvalidPeriod
+	}
+	// Users in an A/B price test buy the variant they are offered
+	plan, err := subscriptions.PlanForUser(user.Id, planID)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.IsActive || plan.Id == subscriptions.PlanFree {
+		return nil, subscriptions.ErrUnknownPlan
+	}
+	planID = plan.Id
+	if sub, err := subscriptions.GetUserSubscription(user.Id); err != nil {
+		return nil, err
+	} else if sub != nil {
+		return nil, ErrAlreadySubscribed
+	}
+
+	p := WebProvider()
+	productID, err := ProductFor(p.Name(), planID, period)
+	if err != nil {
+		return nil, err
+	}
+	if returnURL == "" {
+		returnURL = config.GetEnvRaw("CHECKOUT_RETURN_URL")
+	}
+
+	req := CheckoutRequest{
+		UserId:        user.Id,
+		Email:         user.Email,
+		Name:          strings.TrimSpace(user.FirstName + " " + user.LastName),
+		PlanId:        planID,
+		BillingPeriod: period,
+		ProductId:     productID,
+		ReturnURL:     returnURL,
+	}
+	// A percent-off code the user redeemed is spent on their next web checkout
+	if discount, err := promotions.PendingDiscount(user.Id); err != nil {
+		log.Printf("[Payments] Failed to look up discount for user %s: %v", user.Id, err)
+	} else if discount != nil {
+		req.DiscountCode = discount.Code
+	}
+
+	checkout, err := p.CreateCheckout(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[Payments] Started %s checkout %s for user %s (%s %s)", checkout.Provider, checkout.SessionId, user.Id, planID, period)
+	return checkout, nil
+}
+
+// Cancel turns off renewal of a user's subscription, at the provider first when we
+// manage it there.
+func Cancel(ctx context.Context, userID string) error {
+	sub, err := subscriptions.GetUserSubscription(userID)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		return subscriptions.ErrNoSubscription
+	}
+	if p, ok := For(sub.Provider); ok && sub.ProviderSubscriptionId != "" {
+		if err := p.CancelSubscription(ctx, sub.ProviderSubscriptionId, true); err != nil {
+			return err
+		}
+	}
+	return subscriptions.CancelSubscription(userID)
+}
+
+// Reactivate turns renewal of a user's subscription back on, at the provider first
+// when we manage it there, so the provider doesn't end it at the period end.
+func Reactivate(ctx context.Context, userID string) error {
+	sub, err := subscriptions.GetUserSubscription(userID)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		return subscriptions.ErrNoSubscription
+	}
+	if p, ok := For(sub.Provider); ok && sub.ProviderSubscriptionId != "" {
+		if err := p.ReactivateSubscription(ctx, sub.ProviderSubscriptionId); err != nil {
+			return err
+		}
+	}
+	return subscriptions.ReactivateSubscription(userID)
+}
+
+// ChangePlan asks the provider to move a user's web subscription to planID, which
+// charges or credits the prorated difference. The subscription switches plans when
+// the provider's webhook confirms the change.
+func ChangePlan(ctx context.Context, userID, planID string) (*models.UserSubscription, *subscriptions.Proration, error) {
+	sub, proration, err := subscriptions.CheckPlanChange(userID, planID)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, ok := For(sub.Provider)
+	if !ok || sub.ProviderSubscriptionId == "" {
+		return nil, nil, ErrNotBilled
+	}
+	productID, err := ProductFor(p.Name(), proration.PlanId, sub.BillingPeriod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := p.ChangePlan(ctx, sub.ProviderSubscriptionId, productID); err != nil {
+		return nil, nil, err
+	}
+
+	log.Printf("[Payments] Requested plan change %s -> %s for user %s (%d cents due)", sub.PlanId, proration.PlanId, userID, proration.AmountDue)
+	return sub, proration, nil
+}
+
+// Pause suspends a user's subscription until resumeAt, then at the provider when we
+// manage it there. The provider's webhook finds it already paused; if the provider
+// refuses, the subscription is resumed again.
+func Pause(ctx context.Context, userID string, resumeAt *time.Time) (*models.UserSubscription, error) {
+	sub, err := subscriptions.GetUserSubscription(userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, subscriptions.ErrNoSubscription
+	}
+	if sub.Provider == ProviderRevenueCat {
+		return nil, subscriptions.ErrStoreManaged
+	}
+	paused, err := subscriptions.Pause(userID, resumeAt, "")
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := For(sub.Provider); ok && sub.ProviderSubscriptionId != "" {
+		if err := p.PauseSubscription(ctx, sub.ProviderSubscriptionId); err != nil {
+			if _, rerr := subscriptions.Resume(userID, ""); rerr != nil {
+				log.Printf("[Payments] Failed to undo pause for user %s: %v", userID, rerr)
+			}
+			return nil, err
+		}
+	}
+	return paused, nil
+}
+
+// Resume reactivates a user's paused subscription, at the provider first when we
+// manage it there. The provider's webhook may resume it before we do.
+func Resume(ctx context.Context, userID string) (*models.UserSubscription, error) {
+	sub, err := subscriptions.GetPausedSubscription(userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, subscriptions.ErrNotPaused
+	}
+	if err := ResumeAtProvider(ctx, sub); err != nil {
+		return nil, err
+	}
+	resumed, err := subscriptions.Resume(userID, "")
+	if errors.Is(err, subscriptions.ErrNotPaused) {
+		if current, cerr := subscriptions.GetSubscription(sub.Id); cerr == nil && current.Status == "active" {
+			return current, nil
+		}
+	}
+	return resumed, err
+}
+
+// ResumeAtProvider restarts billing of a paused subscription at its provider. App
+// store and manual subscriptions have nothing to restart.
+func ResumeAtProvider(ctx context.Context, sub *models.UserSubscription) error {
+	p, ok := For(sub.Provider)
+	if !ok || sub.ProviderSubscriptionId == "" {
+		return nil
+	}
+	return p.ResumeSubscription(ctx, sub.ProviderSubscriptionId)
+}
+
+// Refund returns amount cents of a subscription's payment through its provider, zero
+// being what is left of the amount paid, and records it under the provider's refund
+// id. The provider's refund webhook is recorded under the same id, so the refund is
+// counted once whichever arrives first. Subscriptions nothing was paid to a provider
+// for are only recorded.
+func Refund(ctx context.Context, subscriptionID string, amount int, reason, actorID string, revoke bool) (*models.BillingEvent, error) {
+	sub, amount, err := subscriptions.RefundAmount(subscriptionID, amount)
+	if err != nil {
+		return nil, err
+	}
+	if sub.Provider == ProviderRevenueCat {
+		return nil, ErrStoreRefund
+	}
+	p, ok := For(sub.Provider)
+	if !ok || sub.ProviderSubscriptionId == "" {
+		return subscriptions.Refund(sub.Id, amount, reason, actorID, "", revoke)
+	}
+
+	refundID, err := p.Refund(ctx, sub.ProviderSubscriptionId, amount, reason)
+	if err != nil {
+		return nil, err
+	}
+	event, err := subscriptions.Refund(sub.Id, amount, reason, actorID, refundID, revoke)
+	if !errors.Is(err, subscriptions.ErrAlreadyRecorded) {
+		return event, err
+	}
+	// The provider's webhook recorded it first, without knowing to revoke access
+	if revoke {
+		if err := subscriptions.RevokeRefunded(sub.Id); err != nil {
+			return nil, err
+		}
+	}
+	event, err = subscriptions.GetRefund(sub.Provider, refundID)
+	if err == nil && event == nil {
+		err = fmt.Errorf("refund %s was recorded but can't be found", refundID)
+	}
+	return event, err
+}
+
+// PortalURL returns where a user manages the billing of their web subscription.
+func PortalURL(ctx context.Context, userID string) (string, error) {
+	sub, err := subscriptions.GetUserSubscription(userID)
+	if err != nil {
+		return "", err
+	}
+	if sub == nil {
+		if sub, err = subscriptions.GetPausedSubscription(userID); err != nil {
+			return "", err
+		}
+	}
+	if sub == nil {
+		return "", subscriptions.ErrNoSubscription
+	}
+	p, ok := For(sub.Provider)
+	if !ok || sub.ProviderCustomerId == "" {
+		return "", ErrNoPortal
+	}
+	return p.CustomerPortalURL(ctx, sub.ProviderCustomerId)
+}
+
+// Sync refreshes a user's web subscription from its provider, in case a webhook was
+// missed. App store subscriptions are left to RevenueCat's webhooks.
+func Sync(ctx context.Context, userID string) error {
+	sub, err := subscriptions.GetUserSubscription(userID)
+	if err != nil || sub == nil {
+		return err
+	}
+	p, ok := For(sub.Provider)
+	if !ok || sub.ProviderSubscriptionId == "" {
+		return nil
+	}
+
+	remote, err := p.GetSubscription(ctx, sub.ProviderSubscriptionId)
+	if err != nil {
+		return fmt.Errorf("failed to sync subscription: %w", err)
+	}
+	switch remote.Status {
+	case "cancelled", "expired", "failed":
+		return subscriptions.ExpireSubscription(sub.Id)
+	case "active":
+		if remote.CurrentPeriodEnd.After(sub.CurrentPeriodEnd) {
+			if err := subscriptions.RenewPeriod(sub.Id, remote.CurrentPeriodEnd); err != nil {
+				return err
+			}
+		}
+		if remote.CancelAtPeriodEnd && !sub.CancelAtPeriodEnd {
+			return subscriptions.CancelSubscription(userID)
+		}
+		if !remote.CancelAtPeriodEnd && sub.CancelAtPeriodEnd {
+			return subscriptions.ReactivateSubscription(userID)
+		}
+	}
+	return nil
+}
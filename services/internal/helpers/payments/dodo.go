@@ -0,0 +1,237 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/config"
+)
+
+// Dodo API hosts
+const (
+	DodoLiveURL = "https://live.dodopayments.com"
+	DodoTestURL = "https://test.dodopayments.com"
+)
+
+// DodoProvider sells subscriptions through Dodo Payments hosted checkouts.
+type DodoProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewDodoProvider configures Dodo from DODO_API_KEY and DODO_ENVIRONMENT ("live" or
+// "test", the default). DODO_API_URL overrides the host.
+func NewDodoProvider() *DodoProvider {
+	baseURL := DodoTestURL
+	if strings.EqualFold(config.GetEnvRaw("DODO_ENVIRONMENT"), "live") {
+		baseURL = DodoLiveURL
+	}
+	if u := config.GetEnvRaw("DODO_API_URL"); u != "" {
+		baseURL = u
+	}
+	return &DodoProvider{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  config.GetEnvRaw("DODO_API_KEY"),
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (d *DodoProvider) Name() string {
+	return ProviderDodo
+}
+
+func (d *DodoProvider) CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error) {
+	body := map[string]any{
+		"product_cart": []map[string]any{{"product_id": req.ProductId, "quantity": 1}},
+		"customer":     map[string]string{"email": req.Email, "name": req.Name},
+		"metadata":     req.metadata(),
+	}
+	if req.ReturnURL != "" {
+		body["return_url"] = req.ReturnURL
+	}
+	if req.DiscountCode != "" {
+		body["discount_code"] = req.DiscountCode
+	}
+
+	var resp struct {
+		SessionId   string `json:"session_id"`
+		CheckoutURL string `json:"checkout_url"`
+	}
+	if err := d.do(ctx, http.MethodPost, "/checkouts", body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to create checkout: %w", err)
+	}
+	return &Checkout{SessionId: resp.SessionId, URL: resp.CheckoutURL, Provider: ProviderDodo}, nil
+}
+
+// dodoSubscription is a subscription in Dodo's API
+type dodoSubscription struct {
+	SubscriptionId string `json:"subscription_id"`
+	Status         string `json:"status"`
+	ProductId      string `json:"product_id"`
+	Customer       struct {
+		CustomerId string `json:"customer_id"`
+	} `json:"customer"`
+	PreviousBillingDate     time.Time         `json:"previous_billing_date"`
+	NextBillingDate         time.Time         `json:"next_billing_date"`
+	CancelAtNextBillingDate bool              `json:"cancel_at_next_billing_date"`
+	Metadata                map[string]string `json:"metadata"`
+}
+
+func (d *DodoProvider) GetSubscription(ctx context.Context, subscriptionID string) (*Subscription, error) {
+	var s dodoSubscription
+	if err := d.do(ctx, http.MethodGet, "/subscriptions/"+url.PathEscape(subscriptionID), nil, &s); err != nil {
+		return nil, fmt.Errorf("failed to fetch subscription: %w", err)
+	}
+	return &Subscription{
+		Id:                 s.SubscriptionId,
+		CustomerId:         s.Customer.CustomerId,
+		ProductId:          s.ProductId,
+		Status:             s.Status,
+		CurrentPeriodStart: s.PreviousBillingDate,
+		CurrentPeriodEnd:   s.NextBillingDate,
+		CancelAtPeriodEnd:  s.CancelAtNextBillingDate,
+		Metadata:           s.Metadata,
+	}, nil
+}
+
+func (d *DodoProvider) CancelSubscription(ctx context.Context, subscriptionID string, atPeriodEnd bool) error {
+	body := map[string]any{"status": "cancelled"}
+	if atPeriodEnd {
+		body = map[string]any{"cancel_at_next_billing_date": true}
+	}
+	if err := d.do(ctx, http.MethodPatch, "/subscriptions/"+url.PathEscape(subscriptionID), body, nil); err != nil {
+		return fmt.Errorf("failed to cancel subscription: %w", err)
+	}
+	return nil
+}
+
+func (d *DodoProvider) ReactivateSubscription(ctx context.Context, subscriptionID string) error {
+	if err := d.do(ctx, http.MethodPatch, "/subscriptions/"+url.PathEscape(subscriptionID), map[string]any{"cancel_at_next_billing_date": false}, nil); err != nil {
+		return fmt.Errorf("failed to reactivate subscription: %w", err)
+	}
+	return nil
+}
+
+func (d *DodoProvider) ChangePlan(ctx context.Context, subscriptionID, productID string) error {
+	body := map[string]any{
+		"product_id":             productID,
+		"quantity":               1,
+		"proration_billing_mode": "prorated_immediately",
+	}
+	if err := d.do(ctx, http.MethodPost, "/subscriptions/"+url.PathEscape(subscriptionID)+"/change-plan", body, nil); err != nil {
+		return fmt.Errorf("failed to change plan: %w", err)
+	}
+	return nil
+}
+
+func (d *DodoProvider) PauseSubscription(ctx context.Context, subscriptionID string) error {
+	if err := d.do(ctx, http.MethodPatch, "/subscriptions/"+url.PathEscape(subscriptionID), map[string]any{"status": "paused"}, nil); err != nil {
+		return fmt.Errorf("failed to pause subscription: %w", err)
+	}
+	return nil
+}
+
+func (d *DodoProvider) ResumeSubscription(ctx context.Context, subscriptionID string) error {
+	if err := d.do(ctx, http.MethodPatch, "/subscriptions/"+url.PathEscape(subscriptionID), map[string]any{"status": "active"}, nil); err != nil {
+		return fmt.Errorf("failed to resume subscription: %w", err)
+	}
+	return nil
+}
+
+func (d *DodoProvider) Refund(ctx context.Context, subscriptionID string, amount int, reason string) (string, error) {
+	var list struct {
+		Items []struct {
+			PaymentId   string `json:"payment_id"`
+			Status      string `json:"status"`
+			TotalAmount int    `json:"total_amount"`
+		} `json:"items"`
+	}
+	query := url.Values{"subscription_id": {subscriptionID}, "status": {"succeeded"}}
+	if err := d.do(ctx, http.MethodGet, "/payments?"+query.Encode(), nil, &list); err != nil {
+		return "", fmt.Errorf("failed to list payments: %w", err)
+	}
+	// Payments are listed newest first
+	if len(list.Items) == 0 {
+		return "", ErrNotFound
+	}
+	payment := list.Items[0]
+
+	body := map[string]any{"payment_id": payment.PaymentId, "reason": reason}
+	if amount < payment.TotalAmount {
+		sub, err := d.GetSubscription(ctx, subscriptionID)
+		if err != nil {
+			return "", err
+		}
+		body["items"] = []map[string]any{{"item_id": sub.ProductId, "amount": amount, "tax_inclusive": true}}
+	}
+	var resp struct {
+		RefundId string `json:"refund_id"`
+	}
+	if err := d.do(ctx, http.MethodPost, "/refunds", body, &resp); err != nil {
+		return "", fmt.Errorf("failed to refund payment: %w", err)
+	}
+	return resp.RefundId, nil
+}
+
+func (d *DodoProvider) CustomerPortalURL(ctx context.Context, customerID string) (string, error) {
+	var resp struct {
+		Link string `json:"link"`
+	}
+	if err := d.do(ctx, http.MethodPost, "/customers/"+url.PathEscape(customerID)+"/customer-portal/session", nil, &resp); err != nil {
+		return "", fmt.Errorf("failed to create customer portal session: %w", err)
+	}
+	return resp.Link, nil
+}
+
+// do sends an API request and decodes the JSON response into out, when given.
+func (d *DodoProvider) do(ctx context.Context, method, path string, body, out any) error {
+	if d.apiKey == "" {
+		return ErrNotConfigured
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, d.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("dodo returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,278 @@
+package payments
+
+import (
+	"spark/internal/helpers/subscriptions"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MelloB1989/karma/utils"
+)
+
+// FakeCheckoutPath is where the fake provider's checkout pages are served.
+const FakeCheckoutPath = "/payments/fake/checkout"
+
+// FakeProvider stands in for Dodo without leaving the process. Checkouts complete when
+// their URL is opened (or Complete is called), and every change is delivered to
+// WebhookURL as a Dodo webhook signed with Secret, so the real webhook handling runs.
+type FakeProvider struct {
+	CheckoutBaseURL string
+	WebhookURL      string
+	Secret          string
+	Client          *http.Client
+
+	mu            sync.Mutex
+	checkouts     map[string]CheckoutRequest
+	subscriptions map[string]*fakeSubscription
+}
+
+type fakeSubscription struct {
+	Subscription
+	email string
+	name  string
+}
+
+func NewFakeProvider(checkoutBaseURL, webhookURL, secret string) *FakeProvider {
+	return &FakeProvider{
+		CheckoutBaseURL: strings.TrimSuffix(checkoutBaseURL, "/"),
+		WebhookURL:      webhookURL,
+		Secret:          secret,
+		Client:          &http.Client{Timeout: 10 * time.Second},
+		checkouts:       map[string]CheckoutRequest{},
+		subscriptions:   map[string]*fakeSubscription{},
+	}
+}
+
+// Name is Dodo's: the fake delivers Dodo webhooks, so subscriptions it sells look
+// like Dodo ones.
+func (f *FakeProvider) Name() string {
+	return ProviderDodo
+}
+
+func (f *FakeProvider) CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error) {
+	id := "cks_fake_" + utils.GenerateID(12)
+	f.mu.Lock()
+	f.checkouts[id] = req
+	f.mu.Unlock()
+	return &Checkout{SessionId: id, URL: f.CheckoutBaseURL + "/" + id, Provider: ProviderDodo}, nil
+}
+
+// Complete pays for a checkout: the subscription starts and its webhook is delivered.
+// It returns the URL to send the customer back to.
+func (f *FakeProvider) Complete(ctx context.Context, sessionID string) (*Subscription, string, error) {
+	f.mu.Lock()
+	req, ok := f.checkouts[sessionID]
+	delete(f.checkouts, sessionID)
+	f.mu.Unlock()
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	end := now.AddDate(0, 1, 0)
+	if req.BillingPeriod == subscriptions.PeriodYearly {
+		end = now.AddDate(1, 0, 0)
+	}
+	sub := &fakeSubscription{
+		Subscription: Subscription{
+			Id:                 "sub_fake_" + utils.GenerateID(12),
+			CustomerId:         "cus_fake_" + req.UserId,
+			ProductId:          req.ProductId,
+			Status:             "active",
+			CurrentPeriodStart: now,
+			CurrentPeriodEnd:   end,
+			Metadata:           req.metadata(),
+		},
+		email: req.Email,
+		name:  req.Name,
+	}
+	f.mu.Lock()
+	f.subscriptions[sub.Id] = sub
+	f.mu.Unlock()
+
+	if err := f.deliver(ctx, "subscription.active", sub, nil); err != nil {
+		return nil, "", err
+	}
+	result := sub.Subscription
+	return &result, req.ReturnURL, nil
+}
+
+func (f *FakeProvider) GetSubscription(ctx context.Context, subscriptionID string) (*Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sub, ok := f.subscriptions[subscriptionID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	result := sub.Subscription
+	return &result, nil
+}
+
+func (f *FakeProvider) CancelSubscription(ctx context.Context, subscriptionID string, atPeriodEnd bool) error {
+	f.mu.Lock()
+	sub, ok := f.subscriptions[subscriptionID]
+	if ok {
+		if atPeriodEnd {
+			sub.CancelAtPeriodEnd = true
+		} else {
+			sub.Status = "cancelled"
+		}
+	}
+	f.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	if atPeriodEnd {
+		return nil
+	}
+	return f.deliver(ctx, "subscription.cancelled", sub, nil)
+}
+
+// ReactivateSubscription sends no webhook, like a cancellation at the period end.
+func (f *FakeProvider) ReactivateSubscription(ctx context.Context, subscriptionID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sub, ok := f.subscriptions[subscriptionID]
+	if !ok {
+		return ErrNotFound
+	}
+	sub.CancelAtPeriodEnd = false
+	return nil
+}
+
+func (f *FakeProvider) ChangePlan(ctx context.Context, subscriptionID, productID string) error {
+	f.mu.Lock()
+	sub, ok := f.subscriptions[subscriptionID]
+	if ok {
+		sub.ProductId = productID
+	}
+	f.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return f.deliver(ctx, "subscription.plan_changed", sub, nil)
+}
+
+func (f *FakeProvider) PauseSubscription(ctx context.Context, subscriptionID string) error {
+	return f.setStatus(ctx, subscriptionID, "paused", "subscription.paused")
+}
+
+func (f *FakeProvider) ResumeSubscription(ctx context.Context, subscriptionID string) error {
+	return f.setStatus(ctx, subscriptionID, "active", "subscription.active")
+}
+
+// setStatus moves a subscription to status and delivers eventType about it.
+func (f *FakeProvider) setStatus(ctx context.Context, subscriptionID, status, eventType string) error {
+	f.mu.Lock()
+	sub, ok := f.subscriptions[subscriptionID]
+	if ok {
+		sub.Status = status
+	}
+	f.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	return f.deliver(ctx, eventType, sub, nil)
+}
+
+// Refund delivers the refund's webhook before returning, as Dodo may.
+func (f *FakeProvider) Refund(ctx context.Context, subscriptionID string, amount int, reason string) (string, error) {
+	f.mu.Lock()
+	sub, ok := f.subscriptions[subscriptionID]
+	f.mu.Unlock()
+	if !ok {
+		return "", ErrNotFound
+	}
+	refundID := "ref_fake_" + utils.GenerateID(12)
+	err := f.deliver(ctx, "refund.succeeded", sub, map[string]any{
+		"payload_type": "Refund",
+		"refund_id":    refundID,
+		"payment_id":   "pay_fake_" + utils.GenerateID(12),
+		"amount":       amount,
+		"currency":     "USD",
+		"reason":       reason,
+	})
+	if err != nil {
+		return "", err
+	}
+	return refundID, nil
+}
+
+func (f *FakeProvider) CustomerPortalURL(ctx context.Context, customerID string) (string, error) {
+	return f.CheckoutBaseURL + "/portal/" + customerID, nil
+}
+
+// deliver posts a Dodo webhook about sub, signed the way Dodo signs them. extra is
+// added to the event's data.
+func (f *FakeProvider) deliver(ctx context.Context, eventType string, sub *fakeSubscription, extra map[string]any) error {
+	f.mu.Lock()
+	data := map[string]any{
+		"payload_type":          "Subscription",
+		"subscription_id":       sub.Id,
+		"customer_id":           sub.CustomerId,
+		"product_id":            sub.ProductId,
+		"status":                sub.Status,
+		"customer":              map[string]string{"customer_id": sub.CustomerId, "email": sub.email, "name": sub.name},
+		"previous_billing_date": sub.CurrentPeriodStart.Format(time.RFC3339),
+		"next_billing_date":     sub.CurrentPeriodEnd.Format(time.RFC3339),
+		"metadata":              sub.Metadata,
+	}
+	f.mu.Unlock()
+	for k, v := range extra {
+		data[k] = v
+	}
+
+	now := time.Now()
+	body, err := json.Marshal(map[string]any{
+		"business_id": "bus_fake",
+		"type":        eventType,
+		"timestamp":   now.UTC().Format(time.RFC3339Nano),
+		"data":        data,
+	})
+	if err != nil {
+		return err
+	}
+
+	id := "msg_fake_" + utils.GenerateID(12)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("webhook-id", id)
+	req.Header.Set("webhook-timestamp", ts)
+	req.Header.Set("webhook-signature", f.sign(id, ts, body))
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (f *FakeProvider) sign(id, timestamp string, body []byte) string {
+	key := []byte(f.Secret)
+	if raw, ok := strings.CutPrefix(f.Secret, "whsec_"); ok {
+		if decoded, err := base64.StdEncoding.DecodeString(raw); err == nil {
+			key = decoded
+		}
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "." + timestamp + "."))
+	mac.Write(body)
+	return "v1," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
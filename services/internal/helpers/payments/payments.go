@@ -0,0 +1,141 @@
+// Package payments talks to the payment providers that sell subscriptions on the web.
+// Mobile purchases go through RevenueCat in the apps and only reach us as webhooks.
+package payments
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MelloB1989/karma/config"
+)
+
+// Provider names, as stored on subscriptions
+const (
+	ProviderDodo       = "dodo"
+	ProviderRevenueCat = "revcat"
+)
+
+var (
+	ErrNotConfigured = errors.New("payment provider is not configured")
+	ErrNoProduct     = errors.New("no product is set up for this plan and billing period")
+	ErrNotFound      = errors.New("not found at the payment provider")
+)
+
+// Provider is a payment provider that sells subscriptions through hosted checkouts.
+// State changes it makes are reported back through its webhooks.
+type Provider interface {
+	// Name is the provider stored on the subscriptions it manages
+	Name() string
+	// CreateCheckout starts a hosted checkout for a subscription
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error)
+	// GetSubscription fetches a subscription's current state
+	GetSubscription(ctx context.Context, subscriptionID string) (*Subscription, error)
+	// CancelSubscription stops a subscription now, or when the period ends
+	CancelSubscription(ctx context.Context, subscriptionID string, atPeriodEnd bool) error
+	// ReactivateSubscription undoes a cancellation at the period end
+	ReactivateSubscription(ctx context.Context, subscriptionID string) error
+	// ChangePlan moves a subscription to another product, charging or crediting the
+	// difference for the rest of the period. The change is confirmed by webhook.
+	ChangePlan(ctx context.Context, subscriptionID, productID string) error
+	// PauseSubscription stops billing a subscription until it is resumed
+	PauseSubscription(ctx context.Context, subscriptionID string) error
+	// ResumeSubscription restarts billing a paused subscription
+	ResumeSubscription(ctx context.Context, subscriptionID string) error
+	// Refund returns amount cents of a subscription's latest payment to the customer
+	// and returns the provider's refund id, which its refund webhook carries too
+	Refund(ctx context.Context, subscriptionID string, amount int, reason string) (string, error)
+	// CustomerPortalURL returns a link where the customer manages their billing
+	CustomerPortalURL(ctx context.Context, customerID string) (string, error)
+}
+
+// CheckoutRequest describes the subscription being bought.
+type CheckoutRequest struct {
+	UserId        string
+	Email         string
+	Name          string
+	PlanId        string
+	BillingPeriod string
+	ProductId     string
+	ReturnURL     string
+	DiscountCode  string // Promo code the user redeemed; the provider must have a matching discount
+}
+
+// metadata is attached to the provider's subscription. Webhooks find the user by it.
+func (r CheckoutRequest) metadata() map[string]string {
+	m := map[string]string{
+		"user_id":        r.UserId,
+		"plan_id":        r.PlanId,
+		"billing_period": r.BillingPeriod,
+	}
+	if r.DiscountCode != "" {
+		m["promo_code"] = r.DiscountCode
+	}
+	return m
+}
+
+// Checkout is a started hosted checkout.
+type Checkout struct {
+	SessionId string
+	URL       string
+	Provider  string
+}
+
+// Subscription is a subscription as the provider sees it.
+type Subscription struct {
+	Id                 string
+	CustomerId         string
+	ProductId          string
+	Status             string // "active", "pending", "on_hold", "cancelled", "expired", "failed"
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+	CancelAtPeriodEnd  bool
+	Metadata           map[string]string
+}
+
+var (
+	providerMu sync.RWMutex
+	provider   Provider
+)
+
+// SetProvider replaces the web payment provider.
+func SetProvider(p Provider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
+}
+
+// WebProvider returns the provider web checkouts go through. PAYMENT_PROVIDER=fake
+// selects the in-process fake, for working without Dodo credentials.
+func WebProvider() Provider {
+	providerMu.RLock()
+	p := provider
+	providerMu.RUnlock()
+	if p != nil {
+		return p
+	}
+
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	if provider == nil {
+		if strings.EqualFold(config.GetEnvRaw("PAYMENT_PROVIDER"), "fake") {
+			backend := strings.TrimSuffix(config.GetEnvRaw("BACKEND_URL"), "/")
+			provider = NewFakeProvider(backend+FakeCheckoutPath, backend+"/webhooks/dodo", config.GetEnvRaw("DODO_WEBHOOK_SECRET"))
+		} else {
+			provider = NewDodoProvider()
+		}
+	}
+	return provider
+}
+
+// For returns the provider that manages subscriptions recorded under name, if we can
+// act on them from the server. App store subscriptions can't be.
+func For(name string) (Provider, bool) {
+	p := WebProvider()
+	if p.Name() != name {
+		return nil, false
+	}
+	return p, true
+}
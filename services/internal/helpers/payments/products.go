@@ -0,0 +1,49 @@
+package payments
+
+import (
+	"spark/internal/helpers/subscriptions"
+	"spark/internal/models"
+)
+
+// planProduct is the id provider sells a plan under for a billing period.
+func planProduct(products models.PlanProducts, provider, period string) string {
+	switch {
+	case provider == ProviderDodo && period == subscriptions.PeriodMonthly:
+		return products.DodoMonthly
+	case provider == ProviderDodo && period == subscriptions.PeriodYearly:
+		return products.DodoYearly
+	case provider == ProviderRevenueCat && period == subscriptions.PeriodMonthly:
+		return products.RevcatMonthly
+	case provider == ProviderRevenueCat && period == subscriptions.PeriodYearly:
+		return products.RevcatYearly
+	}
+	return ""
+}
+
+// PlanForProduct returns the plan and billing period a provider's product sells.
+// Retired plans still match, so their subscribers keep renewing.
+func PlanForProduct(provider, id string) (planID, period string, ok bool) {
+	if id == "" {
+		return "", "", false
+	}
+	for _, plan := range subscriptions.AllPlans() {
+		for _, period := range []string{subscriptions.PeriodMonthly, subscriptions.PeriodYearly} {
+			if planProduct(plan.ProductIds, provider, period) == id {
+				return plan.Id, period, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// ProductFor returns the product a provider sells a plan under for a billing period.
+func ProductFor(provider, planID, period string) (string, error) {
+	plan, err := subscriptions.GetPlan(planID)
+	if err != nil {
+		return "", err
+	}
+	if id := planProduct(plan.ProductIds, provider, period); id != "" {
+		return id, nil
+	}
+	return "", ErrNoProduct
+}
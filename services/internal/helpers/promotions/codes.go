@@ -0,0 +1,460 @@
+// Package promotions runs promo codes, free trials and referral rewards. Days of a plan
+// are granted as manual subscriptions and bonuses as credits on the user's limits, so
+// both show up wherever plans and limits are already checked.
+package promotions
+
+import (
+	"spark/internal/anal"
+	"spark/internal/helpers/subscriptions"
+	"spark/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// Promo code kinds
+const (
+	KindPercentOff = "percent_off" // Discounts the next web checkout
+	KindPlanDays   = "plan_days"   // Days of a plan for free
+	KindTrial      = "trial"       // Days of a plan, counted as the user's one free trial
+)
+
+const (
+	MaxPlanDays = 365
+	// Failed redemptions allowed per user in attemptWindow, to stop codes being guessed
+	maxFailedAttempts = 10
+	attemptWindow     = time.Hour
+)
+
+var (
+	ErrCodeNotFound      = errors.New("promo code not found")
+	ErrCodeExpired       = errors.New("promo code has expired")
+	ErrCodeExhausted     = errors.New("promo code has been fully redeemed")
+	ErrAlreadyRedeemed   = errors.New("you have already redeemed this code")
+	ErrCodeExists        = errors.New("a promo code with this code already exists")
+	ErrInvalidCode       = errors.New("codes are 4 to 32 letters, digits, dashes or underscores")
+	ErrInvalidKind       = errors.New("kind must be percent_off, plan_days or trial")
+	ErrInvalidPercent    = errors.New("percent off must be between 1 and 100")
+	ErrInvalidDays       = fmt.Errorf("days must be between 1 and %d", MaxPlanDays)
+	ErrInvalidLimit      = errors.New("max redemptions can't be negative")
+	ErrTooManyAttempts   = errors.New("too many attempts; try again later")
+	ErrAlreadySubscribed = errors.New("plan days can't be added to a current subscription")
+)
+
+var codePattern = regexp.MustCompile(`^[A-Z0-9_-]{4,32}$`)
+
+// NormalizeCode returns code the way it is stored. Codes are case-insensitive.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// CodeInput describes a new promo code. PlanId and Days are used by plan_days and
+// trial codes, PercentOff by percent_off codes.
+type CodeInput struct {
+	Code           string
+	Kind           string
+	PlanId         string
+	PercentOff     int
+	Days           int
+	MaxRedemptions int // 0 for no limit
+	ExpiresAt      *time.Time
+}
+
+func (in CodeInput) validate() error {
+	if !codePattern.MatchString(in.Code) {
+		return ErrInvalidCode
+	}
+	if in.MaxRedemptions < 0 {
+		return ErrInvalidLimit
+	}
+	switch in.Kind {
+	case KindPercentOff:
+		if in.PercentOff < 1 || in.PercentOff > 100 {
+			return ErrInvalidPercent
+		}
+	case KindPlanDays, KindTrial:
+		if in.Days < 1 || in.Days > MaxPlanDays {
+			return ErrInvalidDays
+		}
+		plan, err := subscriptions.GetPlan(in.PlanId)
+		if err != nil {
+			return err
+		}
+		if plan.Id == subscriptions.PlanFree {
+			return subscriptions.ErrUnknownPlan
+		}
+	default:
+		return ErrInvalidKind
+	}
+	return nil
+}
+
+// CreateCode adds a promo code created by actorID.
+func CreateCode(in CodeInput, actorID string) (*models.PromoCode, error) {
+	in.Code = NormalizeCode(in.Code)
+	if err := in.validate(); err != nil {
+		return nil, err
+	}
+	if in.Kind == KindPercentOff {
+		in.PlanId, in.Days = "", 0
+	} else {
+		in.PercentOff = 0
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	c := &models.PromoCode{
+		Id:             utils.GenerateID(),
+		Code:           in.Code,
+		Kind:           in.Kind,
+		PlanId:         in.PlanId,
+		PercentOff:     in.PercentOff,
+		Days:           in.Days,
+		MaxRedemptions: in.MaxRedemptions,
+		ExpiresAt:      in.ExpiresAt,
+		IsActive:       true,
+		CreatedBy:      actorID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	res, err := db.Exec(`
+		INSERT INTO promo_codes (id, code, kind, plan_id, percent_off, days, max_redemptions, expires_at, is_active,
+			created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, true, $9, $10, $10)
+		ON CONFLICT (code) DO NOTHING
+	`, c.Id, c.Code, c.Kind, c.PlanId, c.PercentOff, c.Days, c.MaxRedemptions, c.ExpiresAt, actorID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create promo code: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrCodeExists
+	}
+	return c, nil
+}
+
+// GetCode looks up a promo code by its code.
+func GetCode(code string) (*models.PromoCode, error) {
+	o := orm.Load(&models.PromoCode{})
+	defer o.Close()
+
+	var codes []models.PromoCode
+	if err := o.GetByFieldEquals("Code", NormalizeCode(code)).Scan(&codes); err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		return nil, ErrCodeNotFound
+	}
+	return &codes[0], nil
+}
+
+// ListCodes returns promo codes, newest first.
+func ListCodes(activeOnly bool) ([]*models.PromoCode, error) {
+	o := orm.Load(&models.PromoCode{})
+	defer o.Close()
+
+	var rows []models.PromoCode
+	if err := o.GetAll().Scan(&rows); err != nil {
+		return nil, err
+	}
+	codes := make([]*models.PromoCode, 0, len(rows))
+	for i := range rows {
+		if activeOnly && !rows[i].IsActive {
+			continue
+		}
+		codes = append(codes, &rows[i])
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].CreatedAt.After(codes[j].CreatedAt) })
+	return codes, nil
+}
+
+// DeactivateCode stops a promo code from being redeemed. Plan days and discounts
+// already redeemed are kept.
+func DeactivateCode(id string) (*models.PromoCode, error) {
+	o := orm.Load(&models.PromoCode{})
+	defer o.Close()
+
+	var codes []models.PromoCode
+	if err := o.GetByFieldEquals("Id", id).Scan(&codes); err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		return nil, ErrCodeNotFound
+	}
+	c := codes[0]
+	c.IsActive = false
+	c.UpdatedAt = time.Now()
+	if err := o.Update(&c, c.Id); err != nil {
+		return nil, fmt.Errorf("failed to deactivate promo code: %w", err)
+	}
+	return &c, nil
+}
+
+// Redemption is the result of redeeming a code. Subscription is set for plan days and
+// trials.
+type Redemption struct {
+	Code         *models.PromoCode
+	Subscription *models.UserSubscription
+}
+
+// RedeemCode redeems code for userID. Percent-off codes are applied to the user's next
+// web checkout; plan days and trials start right away. deviceID is the device the code
+// is redeemed from, used to keep trials to one per device.
+func RedeemCode(userID, code, deviceID string) (*Redemption, error) {
+	if err := checkAttempts(userID); err != nil {
+		return nil, err
+	}
+	r, err := redeem(userID, code, deviceID)
+	switch {
+	case errors.Is(err, ErrCodeNotFound), errors.Is(err, ErrCodeExpired), errors.Is(err, ErrCodeExhausted):
+		failedAttempt(userID)
+	case err == nil:
+		track(userID, anal.PROMO_CODE_REDEEMED, map[anal.Properties]any{
+			anal.PROMO_CODE: r.Code.Code,
+			anal.PROMO_KIND: r.Code.Kind,
+			anal.PLAN_ID:    r.Code.PlanId,
+		})
+	}
+	return r, err
+}
+
+func redeem(userID, code, deviceID string) (*Redemption, error) {
+	c, err := GetCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if !c.IsActive {
+		return nil, ErrCodeNotFound
+	}
+	if c.ExpiresAt != nil && !c.ExpiresAt.After(time.Now()) {
+		return nil, ErrCodeExpired
+	}
+	if c.MaxRedemptions > 0 && c.Redemptions >= c.MaxRedemptions {
+		return nil, ErrCodeExhausted
+	}
+
+	switch c.Kind {
+	case KindTrial:
+		sub, err := startTrial(userID, c.PlanId, c.Days, deviceID, c)
+		if err != nil {
+			return nil, err
+		}
+		return &Redemption{Code: c, Subscription: sub}, nil
+	case KindPlanDays:
+		if err := checkNotSubscribed(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	redemptionID, err := claimCode(c, userID)
+	if err != nil {
+		return nil, err
+	}
+	if c.Kind == KindPercentOff {
+		return &Redemption{Code: c}, nil
+	}
+
+	sub, err := grantDays(userID, c.PlanId, c.Days, "promo_"+c.Code)
+	if err != nil {
+		releaseCode(c.Id, redemptionID)
+		return nil, err
+	}
+	setRedemptionSubscription(redemptionID, sub.Id)
+	return &Redemption{Code: c, Subscription: sub}, nil
+}
+
+// claimCode counts a redemption of c by userID, as long as the code still has
+// redemptions left and the user hasn't redeemed it before.
+func claimCode(c *models.PromoCode, userID string) (string, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var id string
+	err = tx.QueryRow(`
+		UPDATE promo_codes SET redemptions = redemptions + 1, updated_at = $2
+		WHERE id = $1 AND is_active AND (max_redemptions = 0 OR redemptions < max_redemptions)
+			AND (expires_at IS NULL OR expires_at > $2)
+		RETURNING id
+	`, c.Id, now).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", ErrCodeExhausted
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to redeem promo code: %w", err)
+	}
+
+	redemptionID := utils.GenerateID()
+	res, err := tx.Exec(`
+		INSERT INTO promo_redemptions (id, code_id, code, user_id, kind, plan_id, percent_off, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (code_id, user_id) DO NOTHING
+	`, redemptionID, c.Id, c.Code, userID, c.Kind, c.PlanId, c.PercentOff, now)
+	if err != nil {
+		return "", fmt.Errorf("failed to record redemption: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", ErrAlreadyRedeemed
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to redeem promo code: %w", err)
+	}
+	return redemptionID, nil
+}
+
+// releaseCode gives back a redemption whose plan days couldn't be granted.
+func releaseCode(codeID, redemptionID string) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		log.Printf("[Promotions] Failed to release redemption %s: %v", redemptionID, err)
+		return
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`DELETE FROM promo_redemptions WHERE id = $1`, redemptionID); err != nil {
+		log.Printf("[Promotions] Failed to release redemption %s: %v", redemptionID, err)
+		return
+	}
+	db.Exec(`UPDATE promo_codes SET redemptions = redemptions - 1 WHERE id = $1 AND redemptions > 0`, codeID)
+}
+
+func setRedemptionSubscription(redemptionID, subscriptionID string) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		log.Printf("[Promotions] Failed to link redemption %s: %v", redemptionID, err)
+		return
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`UPDATE promo_redemptions SET subscription_id = $2, used_at = $3 WHERE id = $1`,
+		redemptionID, subscriptionID, time.Now()); err != nil {
+		log.Printf("[Promotions] Failed to link redemption %s: %v", redemptionID, err)
+	}
+}
+
+// grantDays puts userID on planID for the next days. Nothing is charged and the
+// subscription expires by itself, like a staff grant.
+func grantDays(userID, planID string, days int, grantID string) (*models.UserSubscription, error) {
+	now := time.Now()
+	return subscriptions.CreateSubscription(userID, planID, "manual", grantID, "", now, now.AddDate(0, 0, days))
+}
+
+func checkNotSubscribed(userID string) error {
+	sub, err := subscriptions.GetUserSubscription(userID)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		if sub, err = subscriptions.GetPausedSubscription(userID); err != nil {
+			return err
+		}
+	}
+	if sub != nil {
+		return ErrAlreadySubscribed
+	}
+	return nil
+}
+
+// PendingDiscount returns the percent-off code a user redeemed and hasn't spent yet,
+// or nil. The newest one wins when there are several.
+func PendingDiscount(userID string) (*models.PromoRedemption, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var r models.PromoRedemption
+	err = db.QueryRow(`
+		SELECT r.id, r.code_id, r.code, r.user_id, r.kind, r.percent_off, r.created_at
+		FROM promo_redemptions r JOIN promo_codes c ON c.id = r.code_id
+		WHERE r.user_id = $1 AND r.kind = $2 AND r.used_at IS NULL
+			AND c.is_active AND (c.expires_at IS NULL OR c.expires_at > $3)
+		ORDER BY r.created_at DESC
+		LIMIT 1
+	`, userID, KindPercentOff, time.Now()).Scan(&r.Id, &r.CodeId, &r.Code, &r.UserId, &r.Kind, &r.PercentOff, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up discount: %w", err)
+	}
+	return &r, nil
+}
+
+// SpendDiscount marks the discount a user redeemed with code as spent on subscriptionID.
+func SpendDiscount(userID, code, subscriptionID string) error {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		UPDATE promo_redemptions SET subscription_id = $3, used_at = $4
+		WHERE user_id = $1 AND code = $2 AND kind = $5 AND used_at IS NULL
+	`, userID, NormalizeCode(code), subscriptionID, time.Now(), KindPercentOff)
+	return err
+}
+
+// checkAttempts refuses redemptions from users who got too many codes wrong lately.
+func checkAttempts(userID string) error {
+	rdb := utils.RedisConnect()
+	defer rdb.Close()
+
+	n, err := rdb.Get(context.Background(), attemptsKey(userID)).Int()
+	if err == nil && n >= maxFailedAttempts {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+func failedAttempt(userID string) {
+	rdb := utils.RedisConnect()
+	defer rdb.Close()
+
+	ctx := context.Background()
+	key := attemptsKey(userID)
+	if n, err := rdb.Incr(ctx, key).Result(); err == nil && n == 1 {
+		rdb.Expire(ctx, key, attemptWindow)
+	}
+}
+
+func attemptsKey(userID string) string {
+	return fmt.Sprintf("promo_attempts:%s", userID)
+}
+
+// track sends a promotion event to analytics.
+func track(userID string, event anal.Events, props map[anal.Properties]any) {
+	go func() {
+		ae := anal.CreateAnalytics(userID)
+		ae.SetProperty(anal.USER_ID, userID)
+		for k, v := range props {
+			ae.SetProperty(k, v)
+		}
+		ae.SendEvent(event)
+	}()
+}
@@ -0,0 +1,292 @@
+package promotions
+
+import (
+	"spark/internal/anal"
+	"spark/internal/helpers/notifications"
+	"spark/internal/helpers/subscriptions"
+	"spark/internal/helpers/users"
+	"spark/internal/models"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/config"
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+)
+
+// Referral states
+const (
+	ReferralPending  = "pending" // Waiting for the new user to get verified
+	ReferralRewarded = "rewarded"
+	ReferralRejected = "rejected"
+)
+
+const (
+	// MaxReferralRewards is how many referrals a user is rewarded for in
+	// referralRewardWindow. Signups past that still reward the new user.
+	MaxReferralRewards   = 20
+	referralRewardWindow = 30 * 24 * time.Hour
+	referralCodeLength   = 8
+	defaultAppURL        = "https://spark-frontend-tlcj.onrender.com"
+)
+
+// Reasons a referral is rejected
+const (
+	RejectSelfReferral = "self_referral"
+	RejectDeviceReused = "device_reused"
+)
+
+var ErrUnknownReferral = errors.New("referral code not found")
+
+// referralCredit is a bonus on one limit given for a referral.
+type referralCredit struct {
+	limit  string
+	amount int
+	days   int
+}
+
+// Both sides of a referral get bonus swipes and a boost
+var referralCredits = []referralCredit{
+	{subscriptions.LimitSwipes, 20, 7},
+	{subscriptions.LimitBoosts, 1, 30},
+}
+
+// Letters and digits that can't be confused with each other when typed
+const referralAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// ReferralCode returns userID's referral code, creating it the first time.
+func ReferralCode(userID string) (string, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	for range 3 {
+		var code string
+		err := db.QueryRow(`SELECT code FROM referral_codes WHERE user_id = $1`, userID).Scan(&code)
+		if err == nil {
+			return code, nil
+		}
+		if err != sql.ErrNoRows {
+			return "", fmt.Errorf("failed to load referral code: %w", err)
+		}
+		// A clash with another user's code leaves no row, so try again with a new one
+		if _, err := db.Exec(`
+			INSERT INTO referral_codes (user_id, code, created_at) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING
+		`, userID, newReferralCode(), time.Now()); err != nil {
+			return "", fmt.Errorf("failed to create referral code: %w", err)
+		}
+	}
+	return "", errors.New("failed to create referral code")
+}
+
+func newReferralCode() string {
+	b := make([]byte, referralCodeLength)
+	rand.Read(b)
+	for i := range b {
+		b[i] = referralAlphabet[int(b[i])%len(referralAlphabet)]
+	}
+	return string(b)
+}
+
+// ReferralLink is the link a user shares to invite people with code.
+func ReferralLink(code string) string {
+	base := strings.TrimSuffix(config.GetEnvRaw("APP_URL"), "/")
+	if base == "" {
+		base = defaultAppURL
+	}
+	return base + "/invite/" + code
+}
+
+// TrackReferral records that refereeID signed up with a referral code. Self-referrals
+// and devices already used for another referral are recorded as rejected. Rewards are
+// handed out by RewardReferral once the new user is verified.
+func TrackReferral(refereeID, code, deviceID string) (*models.Referral, error) {
+	code = NormalizeCode(code)
+	deviceID = strings.TrimSpace(deviceID)
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var referrerID string
+	err = db.QueryRow(`SELECT user_id FROM referral_codes WHERE code = $1`, code).Scan(&referrerID)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownReferral
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up referral code: %w", err)
+	}
+
+	r := &models.Referral{
+		Id:         utils.GenerateID(),
+		ReferrerId: referrerID,
+		RefereeId:  refereeID,
+		Code:       code,
+		DeviceId:   deviceID,
+		Status:     ReferralPending,
+		CreatedAt:  time.Now(),
+	}
+	if reason, err := rejectReason(db, r); err != nil {
+		return nil, err
+	} else if reason != "" {
+		r.Status, r.Reason = ReferralRejected, reason
+	}
+
+	res, err := db.Exec(`
+		INSERT INTO referrals (id, referrer_id, referee_id, code, device_id, status, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (referee_id) DO NOTHING
+	`, r.Id, r.ReferrerId, r.RefereeId, r.Code, r.DeviceId, r.Status, r.Reason, r.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record referral: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, errors.New("user was already referred")
+	}
+
+	if r.Status == ReferralPending {
+		track(refereeID, anal.REFERRAL_SIGNUP, map[anal.Properties]any{anal.REFERRER_ID: referrerID})
+	} else {
+		log.Printf("[Promotions] Rejected referral of %s by %s: %s", refereeID, referrerID, r.Reason)
+	}
+	return r, nil
+}
+
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// rejectReason says why a referral shouldn't earn rewards, or "" when it should.
+func rejectReason(db querier, r *models.Referral) (string, error) {
+	if r.ReferrerId == r.RefereeId {
+		return RejectSelfReferral, nil
+	}
+	referrer, err := users.GetUserByID(r.ReferrerId)
+	if err != nil {
+		return "", err
+	}
+	referee, err := users.GetUserByID(r.RefereeId)
+	if err != nil {
+		return "", err
+	}
+	if CanonicalEmail(referrer.Email) == CanonicalEmail(referee.Email) {
+		return RejectSelfReferral, nil
+	}
+	if r.DeviceId == "" {
+		return "", nil
+	}
+
+	var used bool
+	err = db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM referrals WHERE device_id = $1)
+			OR EXISTS (SELECT 1 FROM user_push_tokens WHERE user_id = $2 AND device_id = $1)
+	`, r.DeviceId, r.ReferrerId).Scan(&used)
+	if err != nil {
+		return "", fmt.Errorf("failed to check referral device: %w", err)
+	}
+	if used {
+		return RejectDeviceReused, nil
+	}
+	return "", nil
+}
+
+// RewardReferral rewards both sides of the pending referral that brought userID in.
+// It is called once the user is verified and does nothing for users who weren't
+// referred or were already rewarded.
+func RewardReferral(userID string) error {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	var id, referrerID string
+	err = db.QueryRow(`
+		UPDATE referrals SET status = $2, rewarded_at = $3
+		WHERE referee_id = $1 AND status = $4
+		RETURNING id, referrer_id
+	`, userID, ReferralRewarded, now, ReferralPending).Scan(&id, &referrerID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to claim referral: %w", err)
+	}
+
+	grantReferralCredits(userID, id)
+
+	var rewarded int
+	if err := db.QueryRow(`
+		SELECT COUNT(*) FROM referrals
+		WHERE referrer_id = $1 AND status = $2 AND rewarded_at > $3 AND id <> $4
+	`, referrerID, ReferralRewarded, now.Add(-referralRewardWindow), id).Scan(&rewarded); err != nil {
+		return fmt.Errorf("failed to count referrals: %w", err)
+	}
+	if rewarded >= MaxReferralRewards {
+		log.Printf("[Promotions] Referrer %s is over the reward limit; not rewarding referral %s", referrerID, id)
+	} else {
+		grantReferralCredits(referrerID, id)
+		notifications.SendReferralRewardNotification(referrerID)
+	}
+	track(userID, anal.REFERRAL_REWARDED, map[anal.Properties]any{anal.REFERRER_ID: referrerID})
+	return nil
+}
+
+func grantReferralCredits(userID, referralID string) {
+	for _, c := range referralCredits {
+		if _, err := subscriptions.GrantCredit(userID, c.limit, c.amount, c.days, subscriptions.CreditReferral, referralID); err != nil {
+			log.Printf("[Promotions] Failed to grant %s credit to user %s: %v", c.limit, userID, err)
+		}
+	}
+}
+
+// ReferralStats counts the referrals a user has made by state.
+type ReferralStats struct {
+	Pending  int
+	Rewarded int
+	Rejected int
+}
+
+// GetReferralStats returns how a user's referrals are doing.
+func GetReferralStats(userID string) (*ReferralStats, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT status, COUNT(*) FROM referrals WHERE referrer_id = $1 GROUP BY status`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count referrals: %w", err)
+	}
+	defer rows.Close()
+
+	stats := &ReferralStats{}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan referral count: %w", err)
+		}
+		switch status {
+		case ReferralPending:
+			stats.Pending = n
+		case ReferralRewarded:
+			stats.Rewarded = n
+		case ReferralRejected:
+			stats.Rejected = n
+		}
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,173 @@
+package promotions
+
+import (
+	"spark/internal/anal"
+	"spark/internal/helpers/subscriptions"
+	"spark/internal/helpers/users"
+	"spark/internal/models"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+)
+
+// TrialDays is how long a free trial started from the app lasts.
+const TrialDays = 7
+
+var (
+	ErrTrialUsed        = errors.New("a free trial has already been used on this account, email or device")
+	ErrEmailNotVerified = errors.New("verify your email address to start a free trial")
+)
+
+// StartTrial starts userID's free trial of planID from the device deviceID.
+func StartTrial(userID, planID, deviceID string) (*models.UserSubscription, error) {
+	plan, err := subscriptions.PlanForUser(userID, planID)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.IsActive || plan.Id == subscriptions.PlanFree {
+		return nil, subscriptions.ErrUnknownPlan
+	}
+	return startTrial(userID, plan.Id, TrialDays, deviceID, nil)
+}
+
+// startTrial gives userID days of planID as their one free trial. Each user, email
+// address and device gets a single trial, so deleting an account or signing up with
+// an email alias doesn't earn another. code is the trial code redeemed, if any.
+func startTrial(userID, planID string, days int, deviceID string, code *models.PromoCode) (*models.UserSubscription, error) {
+	if err := checkNotSubscribed(userID); err != nil {
+		return nil, err
+	}
+	user, err := users.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	// The email claim only stops repeat trials if the address is really the user's
+	if user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	devices, err := userDevices(userID)
+	if err != nil {
+		return nil, err
+	}
+	if deviceID = strings.TrimSpace(deviceID); deviceID != "" && !slices.Contains(devices, deviceID) {
+		devices = append(devices, deviceID)
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	claims := [][2]string{{"user", userID}, {"email", CanonicalEmail(user.Email)}}
+	for _, d := range devices {
+		claims = append(claims, [2]string{"device", d})
+	}
+	now := time.Now()
+	for _, c := range claims {
+		res, err := tx.Exec(`
+			INSERT INTO trial_claims (kind, key, user_id, plan_id, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT DO NOTHING
+		`, c[0], c[1], userID, planID, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim trial: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil, ErrTrialUsed
+		}
+	}
+
+	var redemptionID string
+	if code != nil {
+		if redemptionID, err = claimCode(code, userID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		if code != nil {
+			releaseCode(code.Id, redemptionID)
+		}
+		return nil, fmt.Errorf("failed to claim trial: %w", err)
+	}
+
+	sub, err := grantDays(userID, planID, days, "trial_"+userID)
+	if err != nil {
+		// Give the claims back so a failed grant doesn't use up the trial
+		releaseTrialClaims(userID, claims)
+		if code != nil {
+			releaseCode(code.Id, redemptionID)
+		}
+		return nil, err
+	}
+	if code != nil {
+		setRedemptionSubscription(redemptionID, sub.Id)
+	}
+	track(userID, anal.TRIAL_STARTED, map[anal.Properties]any{anal.PLAN_ID: planID})
+	return sub, nil
+}
+
+// releaseTrialClaims deletes the claims userID just took.
+func releaseTrialClaims(userID string, claims [][2]string) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		log.Printf("[Promotions] Failed to release trial claims of %s: %v", userID, err)
+		return
+	}
+	defer db.Close()
+
+	for _, c := range claims {
+		if _, err := db.Exec(
+			`DELETE FROM trial_claims WHERE kind = $1 AND key = $2 AND user_id = $3`,
+			c[0], c[1], userID,
+		); err != nil {
+			log.Printf("[Promotions] Failed to release %s trial claim of %s: %v", c[0], userID, err)
+		}
+	}
+}
+
+// userDevices returns the devices a user has registered for push notifications.
+func userDevices(userID string) ([]string, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var devices []string
+	if err := db.Select(&devices, `
+		SELECT DISTINCT device_id FROM user_push_tokens WHERE user_id = $1 AND device_id <> ''
+	`, userID); err != nil {
+		return nil, fmt.Errorf("failed to load devices: %w", err)
+	}
+	return devices, nil
+}
+
+// CanonicalEmail folds the ways one mailbox can be written into one address: case,
+// "+tag" suffixes and, for Gmail, dots in the local part.
+func CanonicalEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return email
+	}
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
@@ -1,6 +1,9 @@
 package pushnotify
 
 import (
+	chatservice "spark/internal/chat_service"
+	"spark/internal/helpers/users"
+	"spark/internal/i18n"
 	"spark/internal/models"
 	"bytes"
 	"context"
@@ -9,15 +12,33 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/MelloB1989/karma/config"
 	"github.com/MelloB1989/karma/orm"
 	"github.com/MelloB1989/karma/utils"
 	"spark/internal/helpers/ormcompat"
 )
 
 const (
-	ExpoPushURL = "https://exp.host/--/api/v2/push/send"
+	// DefaultExpoURL is Expo's push API. EXPO_PUSH_URL overrides it, e.g. to point tests
+	// at a local server.
+	DefaultExpoURL = "https://exp.host/--/api/v2/push"
+
+	// MaxBatchSize is the most messages Expo accepts in one request
+	MaxBatchSize = 100
+	// maxReceiptIds is the most receipts Expo returns for one request
+	maxReceiptIds = 1000
+)
+
+// Ticket and receipt errors Expo reports, plus errRequestFailed, which is given to
+// messages whose request never got a ticket.
+const (
+	errDeviceNotRegistered = "DeviceNotRegistered"
+	errMessageRateExceeded = "MessageRateExceeded"
+	errRequestFailed       = "RequestFailed"
 )
 
 // ExpoPushMessage represents a single push notification message
@@ -34,19 +55,33 @@ type ExpoPushMessage struct {
 	ChannelId string                 `json:"channelId,omitempty"`
 }
 
+// ExpoErrorDetails says why Expo couldn't deliver a message
+type ExpoErrorDetails struct {
+	Error string `json:"error,omitempty"`
+}
+
 // ExpoPushTicket represents the response from Expo's push API
 type ExpoPushTicket struct {
-	Status  string `json:"status"`
-	Id      string `json:"id,omitempty"`
-	Message string `json:"message,omitempty"`
-	Details struct {
-		Error string `json:"error,omitempty"`
-	} `json:"details,omitempty"`
+	Status  string           `json:"status"`
+	Id      string           `json:"id,omitempty"`
+	Message string           `json:"message,omitempty"`
+	Details ExpoErrorDetails `json:"details,omitempty"`
 }
 
 // ExpoPushResponse is the response from Expo's push API
 type ExpoPushResponse struct {
-	Data []ExpoPushTicket `json:"data"`
+	Data   []ExpoPushTicket `json:"data"`
+	Errors []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors,omitempty"`
+}
+
+// ExpoPushReceipt is Expo's final word on a message it gave a ticket for
+type ExpoPushReceipt struct {
+	Status  string           `json:"status"`
+	Message string           `json:"message,omitempty"`
+	Details ExpoErrorDetails `json:"details,omitempty"`
 }
 
 // PushNotification represents a notification to be sent
@@ -140,7 +175,8 @@ func GetUserTokens(userID string) ([]string, error) {
 	return activeTokens, nil
 }
 
-// SendToUser sends a push notification to all of a user's devices
+// SendToUser queues a push notification for all of a user's devices and tries to send
+// it right away. Whatever fails is retried by the queue worker.
 func SendToUser(userID string, notification PushNotification) error {
 	tokens, err := GetUserTokens(userID)
 	if err != nil {
@@ -152,34 +188,85 @@ func SendToUser(userID string, notification PushNotification) error {
 		return nil
 	}
 
-	return DefaultClient.SendBatch(tokens, notification)
+	if notification.Badge == nil {
+		notification.Badge = unreadBadge(userID)
+	}
+
+	return enqueue(userID, tokens, notification, true, time.Time{})
 }
 
-// SendToUsers sends a push notification to multiple users
+// ScheduleToUser queues a push notification for all of a user's devices, for the queue
+// worker to send at at.
+func ScheduleToUser(userID string, notification PushNotification, at time.Time) error {
+	tokens, err := GetUserTokens(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user tokens: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	return enqueue(userID, tokens, notification, false, at)
+}
+
+// ScheduleTokens queues a push notification for some of a user's devices, for the
+// queue worker to send at at. Campaigns use it for the tokens in a batch.
+func ScheduleTokens(userID string, tokens []string, notification PushNotification, at time.Time) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	return enqueue(userID, tokens, notification, false, at)
+}
+
+// unreadBadge returns the user's total unread message count for the app icon badge.
+func unreadBadge(userID string) *int {
+	total, err := chatservice.GetTotalUnread(userID)
+	if err != nil {
+		log.Printf("[Push] Failed to get unread count for user %s: %v", userID, err)
+		return nil
+	}
+	return &total
+}
+
+// SendToUsers queues a push notification for multiple users. The queue worker sends
+// it in chunks, so a large list doesn't turn into a burst of requests to Expo.
 func SendToUsers(userIDs []string, notification PushNotification) error {
-	var allTokens []string
 	for _, userID := range userIDs {
 		tokens, err := GetUserTokens(userID)
 		if err != nil {
 			log.Printf("[Push] Failed to get tokens for user %s: %v", userID, err)
 			continue
 		}
-		allTokens = append(allTokens, tokens...)
-	}
-
-	if len(allTokens) == 0 {
-		return nil
+		if len(tokens) == 0 {
+			continue
+		}
+		if err := enqueue(userID, tokens, notification, false, time.Time{}); err != nil {
+			log.Printf("[Push] Failed to queue notification for user %s: %v", userID, err)
+		}
 	}
-
-	return DefaultClient.SendBatch(allTokens, notification)
+	return nil
 }
 
-// SendBatch sends notifications to multiple tokens
-func (c *Client) SendBatch(tokens []string, notification PushNotification) error {
+// Deliver sends notification to tokens right away, bypassing the queue, and reports
+// how many Expo accepted. Accepted messages are still checked against their receipts.
+func (c *Client) Deliver(tokens []string, notification PushNotification) (sent int, failed int, err error) {
 	if len(tokens) == 0 {
-		return nil
+		return 0, 0, nil
 	}
 
+	messages := buildMessages(tokens, notification)
+	tickets, err := c.Send(context.Background(), messages)
+	if err := recordDelivered(messages, tickets); err != nil {
+		log.Printf("[Push] Failed to record tickets: %v", err)
+	}
+	for _, ticket := range tickets {
+		if ticket.Status == "ok" {
+			sent++
+		}
+	}
+	return sent, len(tokens) - sent, err
+}
+
+func buildMessages(tokens []string, notification PushNotification) []ExpoPushMessage {
 	messages := make([]ExpoPushMessage, len(tokens))
 	for i, token := range tokens {
 		messages[i] = ExpoPushMessage{
@@ -195,24 +282,78 @@ func (c *Client) SendBatch(tokens []string, notification PushNotification) error
 			messages[i].Sound = "default"
 		}
 	}
+	return messages
+}
+
+// Send posts messages to Expo in chunks of MaxBatchSize and returns their tickets in
+// order. Messages in a chunk whose request failed get an errRequestFailed ticket, and
+// the first such error is returned.
+func (c *Client) Send(ctx context.Context, messages []ExpoPushMessage) ([]ExpoPushTicket, error) {
+	tickets := make([]ExpoPushTicket, 0, len(messages))
+	var firstErr error
+	for chunk := range slices.Chunk(messages, MaxBatchSize) {
+		var resp ExpoPushResponse
+		err := c.post(ctx, "/send", chunk, &resp)
+		if err == nil && len(resp.Errors) > 0 {
+			err = fmt.Errorf("push API error %s: %s", resp.Errors[0].Code, resp.Errors[0].Message)
+		}
+		if err == nil && len(resp.Data) != len(chunk) {
+			err = fmt.Errorf("push API returned %d tickets for %d messages", len(resp.Data), len(chunk))
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			resp.Data = make([]ExpoPushTicket, len(chunk))
+			for i := range resp.Data {
+				resp.Data[i] = ExpoPushTicket{Status: "error", Message: err.Error(), Details: ExpoErrorDetails{Error: errRequestFailed}}
+			}
+		}
+		tickets = append(tickets, resp.Data...)
+	}
+	return tickets, firstErr
+}
 
-	return c.sendMessages(messages)
+// Receipts fetches the receipts for ticket ids. Receipts Expo doesn't have yet are
+// missing from the result.
+func (c *Client) Receipts(ctx context.Context, ids []string) (map[string]ExpoPushReceipt, error) {
+	receipts := make(map[string]ExpoPushReceipt, len(ids))
+	for chunk := range slices.Chunk(ids, maxReceiptIds) {
+		var resp struct {
+			Data map[string]ExpoPushReceipt `json:"data"`
+		}
+		if err := c.post(ctx, "/getReceipts", map[string][]string{"ids": chunk}, &resp); err != nil {
+			return receipts, err
+		}
+		for id, receipt := range resp.Data {
+			receipts[id] = receipt
+		}
+	}
+	return receipts, nil
 }
 
-func (c *Client) sendMessages(messages []ExpoPushMessage) error {
-	body, err := json.Marshal(messages)
+// post sends payload to an Expo push API path and decodes the response into out
+func (c *Client) post(ctx context.Context, path string, payload any, out any) error {
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal messages: %w", err)
+		return fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(context.Background(), "POST", ExpoPushURL, bytes.NewBuffer(body))
+	base := config.GetEnvRaw("EXPO_PUSH_URL")
+	if base == "" {
+		base = DefaultExpoURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(base, "/")+path, bytes.NewBuffer(body))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	// Only needed when the Expo project has enhanced push security turned on
+	if token := config.GetEnvRaw("EXPO_ACCESS_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -229,92 +370,64 @@ func (c *Client) sendMessages(messages []ExpoPushMessage) error {
 		return fmt.Errorf("push API returned status %d: %s", resp.StatusCode, string(respBody))
 	}
 
-	var pushResp ExpoPushResponse
-	if err := json.Unmarshal(respBody, &pushResp); err != nil {
+	if err := json.Unmarshal(respBody, out); err != nil {
 		return fmt.Errorf("failed to parse response: %w", err)
 	}
-
-	// Log any errors
-	for i, ticket := range pushResp.Data {
-		if ticket.Status == "error" {
-			log.Printf("[Push] Failed to send to token %d: %s - %s", i, ticket.Details.Error, ticket.Message)
-			// Mark token as inactive if it's invalid
-			if ticket.Details.Error == "DeviceNotRegistered" && i < len(messages) {
-				go RemoveToken(messages[i].To)
-			}
-		}
-	}
-
-	log.Printf("[Push] Sent %d notifications successfully", len(messages))
 	return nil
 }
 
 // ==================== Notification Helpers ====================
 
-// SendMatchNotification sends push notification for a new match
-func SendMatchNotification(userID1, userID2, matcherName string) {
-	go func() {
-		notification := PushNotification{
-			Title: "It's a Match! 💜",
-			Body:  fmt.Sprintf("You and %s liked each other! Start chatting now.", matcherName),
-			Data: map[string]interface{}{
-				"type":    "match",
-				"user_id": userID2,
-			},
-			ChannelId: "matches",
-		}
-		if err := SendToUser(userID1, notification); err != nil {
-			log.Printf("[Push] Failed to send match notification to %s: %v", userID1, err)
-		}
-	}()
+// MatchPush is the push sent when the recipient matches with matcherName
+func MatchPush(locale, matchedUserID, matcherName string) PushNotification {
+	return PushNotification{
+		Title: i18n.T(locale, "push.match.title"),
+		Body:  i18n.T(locale, "push.match.body", "name", matcherName),
+		Data: map[string]interface{}{
+			"type":    "match",
+			"user_id": matchedUserID,
+		},
+		ChannelId: "matches",
+	}
 }
 
-// SendMessageNotification sends push notification for a new message
-func SendMessageNotification(recipientID, senderName, chatID, preview string) {
-	go func() {
-		body := preview
-		if len(body) > 100 {
-			body = body[:100] + "..."
-		}
-		notification := PushNotification{
-			Title: senderName,
-			Body:  body,
-			Data: map[string]interface{}{
-				"type":    "message",
-				"chat_id": chatID,
-			},
-			ChannelId: "messages",
-		}
-		if err := SendToUser(recipientID, notification); err != nil {
-			log.Printf("[Push] Failed to send message notification to %s: %v", recipientID, err)
-		}
-	}()
+// MessagePush is the push sent for a new chat message
+func MessagePush(senderName, chatID, preview string) PushNotification {
+	body := preview
+	if len(body) > 100 {
+		body = body[:100] + "..."
+	}
+	return PushNotification{
+		Title: senderName,
+		Body:  body,
+		Data: map[string]interface{}{
+			"type":    "message",
+			"chat_id": chatID,
+		},
+		ChannelId: "messages",
+	}
 }
 
-// SendUnlockRequestNotification sends push notification when someone requests to unlock photos
-func SendUnlockRequestNotification(recipientID, requesterName, matchID string) {
-	go func() {
-		notification := PushNotification{
-			Title: "Photo Unlock Request 🔓",
-			Body:  fmt.Sprintf("%s wants to reveal photos! Ready to see each other?", requesterName),
-			Data: map[string]interface{}{
-				"type":     "unlock_request",
-				"match_id": matchID,
-			},
-			ChannelId: "matches",
-		}
-		if err := SendToUser(recipientID, notification); err != nil {
-			log.Printf("[Push] Failed to send unlock request notification to %s: %v", recipientID, err)
-		}
-	}()
+// UnlockRequestPush is the push sent when a match asks to reveal photos
+func UnlockRequestPush(locale, requesterName, matchID string) PushNotification {
+	return PushNotification{
+		Title: i18n.T(locale, "push.unlock_request.title"),
+		Body:  i18n.T(locale, "push.unlock_request.body", "name", requesterName),
+		Data: map[string]interface{}{
+			"type":     "unlock_request",
+			"match_id": matchID,
+		},
+		ChannelId: "matches",
+	}
 }
 
 // SendUnlockAcceptedNotification sends push notification when unlock is accepted
 func SendUnlockAcceptedNotification(recipientID, accepterName, matchID string) {
 	go func() {
+		locale := users.Locale(recipientID)
 		notification := PushNotification{
-			Title: "Photos Revealed! 📸",
-			Body:  fmt.Sprintf("%s accepted! You can now see each other's photos.", accepterName),
+			Title: i18n.T(locale, "push.unlock_accepted.title"),
+			Body:  i18n.T(locale, "push.unlock_accepted.body", "name", accepterName),
 			Data: map[string]interface{}{
 				"type":     "unlock_accepted",
 				"match_id": matchID,
@@ -330,9 +443,10 @@ func SendUnlockAcceptedNotification(recipientID, accepterName, matchID string) {
 // SendRatingRequestNotification prompts user to rate after unlock
 func SendRatingRequestNotification(recipientID, partnerName, matchID string) {
 	go func() {
+		locale := users.Locale(recipientID)
 		notification := PushNotification{
-			Title: "Time to Rate! ⭐",
-			Body:  fmt.Sprintf("What do you think of %s? Rate to see if it's a date!", partnerName),
+			Title: i18n.T(locale, "push.rating_request.title"),
+			Body:  i18n.T(locale, "push.rating_request.body", "name", partnerName),
 			Data: map[string]interface{}{
 				"type":     "rating_request",
 				"match_id": matchID,
@@ -348,9 +462,10 @@ func SendRatingRequestNotification(recipientID, partnerName, matchID string) {
 // SendDateConfirmationNotification sends when both users rate 8+
 func SendDateConfirmationNotification(recipientID, partnerName, matchID string) {
 	go func() {
+		locale := users.Locale(recipientID)
 		notification := PushNotification{
-			Title: "It's a Date! 🎉",
-			Body:  fmt.Sprintf("You and %s both gave 8+ ratings! Plan your date!", partnerName),
+			Title: i18n.T(locale, "push.date_confirmed.title"),
+			Body:  i18n.T(locale, "push.date_confirmed.body", "name", partnerName),
 			Data: map[string]interface{}{
 				"type":     "date_confirmed",
 				"match_id": matchID,
@@ -363,70 +478,27 @@ func SendDateConfirmationNotification(recipientID, partnerName, matchID string)
 	}()
 }
 
-// SendStreakMilestoneNotification sends notification for streak milestones
-func SendStreakMilestoneNotification(recipientID, partnerName string, streak int, matchID string) {
-	go func() {
-		var emoji string
-		switch {
-		case streak >= 100:
-			emoji = "💯🔥"
-		case streak >= 30:
-			emoji = "🔥🔥🔥"
-		case streak >= 14:
-			emoji = "🔥🔥"
-		default:
-			emoji = "🔥"
-		}
-		notification := PushNotification{
-			Title: fmt.Sprintf("%d Day Streak! %s", streak, emoji),
-			Body:  fmt.Sprintf("Keep the conversation going with %s!", partnerName),
-			Data: map[string]interface{}{
-				"type":     "streak_milestone",
-				"match_id": matchID,
-				"streak":   streak,
-			},
-			ChannelId: "streaks",
-		}
-		if err := SendToUser(recipientID, notification); err != nil {
-			log.Printf("[Push] Failed to send streak milestone notification to %s: %v", recipientID, err)
-		}
-	}()
-}
-
-// SendMassNotification sends a notification to all users or a segment
-func SendMassNotification(title, body string, segment string) error {
-	// Get all users based on segment
-	// For now, we'll implement "all" segment
-	tokenORM := orm.Load(&models.UserPushToken{})
-	tokens, err := ormcompat.GetByFieldEqualsSlice[models.UserPushToken](tokenORM, "IsActive", true)
-	if err != nil {
-		return err
-	}
-
-	tokenStrings := make([]string, len(tokens))
-	for i, t := range tokens {
-		tokenStrings[i] = t.Token
+// StreakMilestonePush is the push sent when a chat with partnerName reaches a streak milestone
+func StreakMilestonePush(locale, partnerName string, streak int, matchID string) PushNotification {
+	var emoji string
+	switch {
+	case streak >= 100:
+		emoji = "💯🔥"
+	case streak >= 30:
+		emoji = "🔥🔥🔥"
+	case streak >= 14:
+		emoji = "🔥🔥"
+	default:
+		emoji = "🔥"
 	}
-
-	notification := PushNotification{
-		Title:     title,
-		Body:      body,
-		ChannelId: "announcements",
-	}
-
-	// Send in batches of 100
-	batchSize := 100
-	for i := 0; i < len(tokenStrings); i += batchSize {
-		end := i + batchSize
-		if end > len(tokenStrings) {
-			end = len(tokenStrings)
-		}
-		batch := tokenStrings[i:end]
-		if err := DefaultClient.SendBatch(batch, notification); err != nil {
-			log.Printf("[Push] Failed to send batch %d-%d: %v", i, end, err)
-		}
+	return PushNotification{
+		Title: i18n.N(locale, "push.streak_milestone.title", streak, "emoji", emoji),
+		Body:  i18n.T(locale, "push.streak_milestone.body", "name", partnerName),
+		Data: map[string]interface{}{
+			"type":     "streak_milestone",
+			"match_id": matchID,
+			"streak":   streak,
+		},
+		ChannelId: "streaks",
 	}
-
-	log.Printf("[Push] Mass notification sent to %d tokens", len(tokenStrings))
-	return nil
 }
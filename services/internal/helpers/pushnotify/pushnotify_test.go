@@ -0,0 +1,288 @@
+package pushnotify
+
+import (
+	"spark/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeExpo is a local stand-in for Expo's push API. Tokens containing "unregistered"
+// get DeviceNotRegistered tickets, and failNext makes the next send requests fail.
+type fakeExpo struct {
+	mu         sync.Mutex
+	batches    []int
+	receiptReq [][]string
+	auth       string
+	failNext   int
+	receipts   map[string]ExpoPushReceipt
+}
+
+func newFakeExpo(t *testing.T) *fakeExpo {
+	t.Helper()
+	f := &fakeExpo{receipts: make(map[string]ExpoPushReceipt)}
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	t.Setenv("EXPO_PUSH_URL", srv.URL+"/")
+	t.Setenv("EXPO_ACCESS_TOKEN", "")
+	return f
+}
+
+func (f *fakeExpo) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = r.Header.Get("Authorization")
+
+	switch r.URL.Path {
+	case "/send":
+		var messages []ExpoPushMessage
+		if err := json.NewDecoder(r.Body).Decode(&messages); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.batches = append(f.batches, len(messages))
+		if f.failNext > 0 {
+			f.failNext--
+			http.Error(w, "upstream unavailable", http.StatusBadGateway)
+			return
+		}
+		var resp ExpoPushResponse
+		for _, m := range messages {
+			if strings.Contains(m.To, "unregistered") {
+				resp.Data = append(resp.Data, ExpoPushTicket{Status: "error", Message: "not registered", Details: ExpoErrorDetails{Error: errDeviceNotRegistered}})
+				continue
+			}
+			resp.Data = append(resp.Data, ExpoPushTicket{Status: "ok", Id: "ticket-" + m.To})
+		}
+		json.NewEncoder(w).Encode(resp)
+	case "/getReceipts":
+		var req struct {
+			Ids []string `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.receiptReq = append(f.receiptReq, req.Ids)
+		data := make(map[string]ExpoPushReceipt)
+		for _, id := range req.Ids {
+			if receipt, ok := f.receipts[id]; ok {
+				data[id] = receipt
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": data})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// fakeDB records the statements the queue runs instead of touching a database
+type fakeDB struct {
+	execs []fakeExec
+}
+
+type fakeExec struct {
+	query string
+	args  []any
+}
+
+func (f *fakeDB) Exec(query string, args ...any) (sql.Result, error) {
+	f.execs = append(f.execs, fakeExec{query, args})
+	return driverResult(0), nil
+}
+
+type driverResult int64
+
+func (r driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (r driverResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+// statusOf returns the status the queue last gave message id
+func (f *fakeDB) statusOf(id string) string {
+	status := ""
+	for _, e := range f.execs {
+		if strings.Contains(e.query, "UPDATE push_messages") && len(e.args) > 1 && e.args[0] == id {
+			status = e.args[1].(string)
+		}
+	}
+	return status
+}
+
+func tokens(n int, prefix string) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("ExponentPushToken[%s-%d]", prefix, i)
+	}
+	return out
+}
+
+func TestSendChunksMessages(t *testing.T) {
+	expo := newFakeExpo(t)
+	t.Setenv("EXPO_ACCESS_TOKEN", "secret")
+
+	messages := buildMessages(tokens(250, "a"), PushNotification{Title: "Hi", Body: "there"})
+	tickets, err := NewClient().Send(context.Background(), messages)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := fmt.Sprint(expo.batches); got != "[100 100 50]" {
+		t.Errorf("batches = %s, want [100 100 50]", got)
+	}
+	if len(tickets) != len(messages) {
+		t.Fatalf("got %d tickets for %d messages", len(tickets), len(messages))
+	}
+	for i, ticket := range tickets {
+		if ticket.Id != "ticket-"+messages[i].To {
+			t.Fatalf("ticket %d = %q, out of order", i, ticket.Id)
+		}
+	}
+	if expo.auth != "Bearer secret" {
+		t.Errorf("Authorization = %q", expo.auth)
+	}
+}
+
+func TestSendFailedChunk(t *testing.T) {
+	expo := newFakeExpo(t)
+	expo.failNext = 1
+
+	messages := buildMessages(tokens(150, "a"), PushNotification{Body: "hello"})
+	tickets, err := NewClient().Send(context.Background(), messages)
+	if err == nil || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("err = %v, want the 502", err)
+	}
+	if len(tickets) != 150 {
+		t.Fatalf("got %d tickets, want 150", len(tickets))
+	}
+	// The first chunk failed as a whole; the second went through
+	if tickets[0].Details.Error != errRequestFailed || tickets[99].Details.Error != errRequestFailed {
+		t.Errorf("failed chunk tickets = %+v", tickets[0])
+	}
+	if tickets[100].Status != "ok" {
+		t.Errorf("second chunk ticket = %+v", tickets[100])
+	}
+}
+
+func TestReceiptsChunksIds(t *testing.T) {
+	expo := newFakeExpo(t)
+	ids := make([]string, 1500)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("ticket-%d", i)
+	}
+	expo.receipts["ticket-3"] = ExpoPushReceipt{Status: "ok"}
+	expo.receipts["ticket-1200"] = ExpoPushReceipt{Status: "error", Details: ExpoErrorDetails{Error: errDeviceNotRegistered}}
+
+	receipts, err := NewClient().Receipts(context.Background(), ids)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(expo.receiptReq) != 2 || len(expo.receiptReq[0]) != maxReceiptIds || len(expo.receiptReq[1]) != 500 {
+		t.Errorf("receipt requests had %d ids each, want 1000 then 500", len(expo.receiptReq))
+	}
+	if len(receipts) != 2 {
+		t.Fatalf("got %d receipts, want 2", len(receipts))
+	}
+	if receipts["ticket-1200"].Details.Error != errDeviceNotRegistered {
+		t.Errorf("receipt = %+v", receipts["ticket-1200"])
+	}
+}
+
+func TestSendMessagesSettlesEachRow(t *testing.T) {
+	expo := newFakeExpo(t)
+	now := time.Date(2025, 11, 3, 9, 0, 0, 0, time.UTC)
+	row := func(id, token string, attempts int) models.PushMessage {
+		payload, _ := json.Marshal(ExpoPushMessage{To: token, Body: "hi"})
+		return models.PushMessage{Id: id, Token: token, Message: payload, Attempts: attempts}
+	}
+	rows := []models.PushMessage{
+		row("ok", "ExponentPushToken[ok]", 0),
+		row("gone", "ExponentPushToken[unregistered]", 0),
+		row("broken", "ExponentPushToken[broken]", 0),
+	}
+	rows[2].Message = []byte("{")
+
+	db := &fakeDB{}
+	if err := sendMessages(context.Background(), db, rows, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for id, want := range map[string]string{"ok": statusSent, "gone": statusFailed, "broken": statusFailed} {
+		if got := db.statusOf(id); got != want {
+			t.Errorf("%s: status = %q, want %q", id, got, want)
+		}
+	}
+	deactivated := false
+	for _, e := range db.execs {
+		if strings.Contains(e.query, "UPDATE user_push_tokens") && e.args[1] == "ExponentPushToken[unregistered]" {
+			deactivated = true
+		}
+	}
+	if !deactivated {
+		t.Error("unregistered token was not deactivated")
+	}
+	if fmt.Sprint(expo.batches) != "[2]" {
+		t.Errorf("batches = %v, the invalid row should not be sent", expo.batches)
+	}
+
+	// A failed request puts the rows back in the queue with backoff, until they run out of attempts
+	expo.failNext = 1
+	db = &fakeDB{}
+	rows = []models.PushMessage{row("retry", "ExponentPushToken[a]", 1), row("last", "ExponentPushToken[b]", maxAttempts-1)}
+	if err := sendMessages(context.Background(), db, rows, now); err == nil {
+		t.Fatal("expected the failed request's error")
+	}
+	if got := db.statusOf("retry"); got != statusPending {
+		t.Errorf("retry: status = %q, want pending", got)
+	}
+	if got := db.statusOf("last"); got != statusFailed {
+		t.Errorf("last: status = %q, want failed", got)
+	}
+	for _, e := range db.execs {
+		if e.args[0] == "retry" {
+			if next := e.args[3].(time.Time); !next.Equal(now.Add(retryDelay(2))) {
+				t.Errorf("retry: next attempt at %v, want %v", next, now.Add(retryDelay(2)))
+			}
+		}
+	}
+}
+
+func TestJudge(t *testing.T) {
+	tests := []struct {
+		status, code string
+		receipt      bool
+		want         outcome
+	}{
+		{"ok", "", false, outcomeSent},
+		{"ok", "", true, outcomeDelivered},
+		{"error", errDeviceNotRegistered, false, outcomeBadToken},
+		{"error", errDeviceNotRegistered, true, outcomeBadToken},
+		{"error", errMessageRateExceeded, true, outcomeRetry},
+		{"error", errRequestFailed, false, outcomeRetry},
+		{"error", "MessageTooBig", false, outcomeFailed},
+		{"error", "InvalidCredentials", true, outcomeFailed},
+	}
+	for _, tt := range tests {
+		if got := judge(tt.status, tt.code, tt.receipt); got != tt.want {
+			t.Errorf("judge(%q, %q, %v) = %v, want %v", tt.status, tt.code, tt.receipt, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		0:  retryBase,
+		1:  retryBase,
+		2:  2 * retryBase,
+		3:  4 * retryBase,
+		7:  retryMax,
+		50: retryMax,
+	} {
+		if got := retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
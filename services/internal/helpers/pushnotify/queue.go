@@ -0,0 +1,489 @@
+package pushnotify
+
+import (
+	"spark/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+)
+
+const (
+	// UserRateLimit is how many notifications a user can be pushed per UserRateWindow.
+	// Later ones are dropped, so a burst of activity doesn't buzz a phone nonstop.
+	UserRateLimit  = 10
+	UserRateWindow = time.Minute
+
+	// maxAttempts is how many times a message is tried before it's given up on.
+	// Retries wait retryBase, doubling up to retryMax.
+	maxAttempts = 6
+	retryBase   = 30 * time.Second
+	retryMax    = 30 * time.Minute
+
+	queueInterval = 5 * time.Second
+	queueBatch    = 500
+	// sendLease is how long a claimed message is left alone before another worker
+	// assumes the send died
+	sendLease = 2 * time.Minute
+
+	// Expo has receipts ready within about 15 minutes and keeps them for a day
+	receiptDelay    = 15 * time.Minute
+	receiptExpiry   = 24 * time.Hour
+	receiptInterval = time.Minute
+	receiptBatch    = 5 * maxReceiptIds
+
+	// retention is how long queue rows are kept once they're created
+	retention       = 3 * 24 * time.Hour
+	cleanupInterval = time.Hour
+)
+
+// Queue statuses. A message is pending until a worker claims it (sending), sent once
+// Expo gives it a ticket, and delivered once the receipt says so.
+const (
+	statusPending   = "pending"
+	statusSending   = "sending"
+	statusSent      = "sent"
+	statusDelivered = "delivered"
+	statusFailed    = "failed"
+)
+
+var ErrRateLimited = errors.New("push rate limit reached")
+
+// outcome is what happens to a queued message after a ticket or receipt
+type outcome int
+
+const (
+	outcomeSent outcome = iota
+	outcomeDelivered
+	outcomeRetry
+	outcomeBadToken
+	outcomeFailed
+)
+
+// judge decides a message's outcome from its ticket, or from its receipt when
+// receipt is set.
+func judge(status, errorCode string, receipt bool) outcome {
+	if status == "ok" {
+		if receipt {
+			return outcomeDelivered
+		}
+		return outcomeSent
+	}
+	switch errorCode {
+	case errDeviceNotRegistered:
+		return outcomeBadToken
+	case errMessageRateExceeded, errRequestFailed:
+		return outcomeRetry
+	default:
+		return outcomeFailed
+	}
+}
+
+// retryDelay is how long to wait after a message's attempts-th failed try
+func retryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	d := retryBase
+	for i := 1; i < attempts && d < retryMax; i++ {
+		d *= 2
+	}
+	return min(d, retryMax)
+}
+
+// execer is the part of a database handle the queue writes through
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// enqueue queues notification for each of a user's tokens, due at due or now when it
+// is zero. With sendNow the rows are claimed as they're inserted and sent straight
+// away; the worker only picks them up again if that send dies. The rate limit is
+// checked before inserting, so concurrent sends to one user can slightly exceed it.
+func enqueue(userID string, tokens []string, notification PushNotification, sendNow bool, due time.Time) error {
+	now := time.Now()
+	if due.Before(now) {
+		due = now
+	}
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var recent int
+	if err := db.QueryRow(`
+		SELECT COUNT(DISTINCT notification_id) FROM push_messages WHERE user_id = $1 AND created_at > $2
+	`, userID, now.Add(-UserRateWindow)).Scan(&recent); err != nil {
+		return fmt.Errorf("failed to check push rate limit: %w", err)
+	}
+	if recent >= UserRateLimit {
+		log.Printf("[Push] Rate limit reached for user %s, dropping %q", userID, notification.Title)
+		return ErrRateLimited
+	}
+
+	notificationID := utils.GenerateID()
+	messages := buildMessages(tokens, notification)
+	rows := make([]models.PushMessage, len(messages))
+	for i, m := range messages {
+		payload, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+		rows[i] = models.PushMessage{
+			Id:             utils.GenerateID(),
+			NotificationId: notificationID,
+			UserId:         userID,
+			Token:          m.To,
+			Message:        payload,
+			Status:         statusPending,
+			NextAttemptAt:  due,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if sendNow {
+			lease := now.Add(sendLease)
+			rows[i].Status = statusSending
+			rows[i].LockedUntil = &lease
+		}
+	}
+	if err := insertMessages(db, rows); err != nil {
+		return err
+	}
+
+	if sendNow {
+		if err := sendMessages(context.Background(), db, rows, now); err != nil {
+			log.Printf("[Push] Send to user %s failed, will retry: %v", userID, err)
+		}
+	}
+	return nil
+}
+
+func insertMessages(db execer, rows []models.PushMessage) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	const columns = 12
+	values := make([]string, len(rows))
+	args := make([]any, 0, len(rows)*columns)
+	for i, r := range rows {
+		placeholders := make([]string, columns)
+		for j := range placeholders {
+			placeholders[j] = fmt.Sprintf("$%d", i*columns+j+1)
+		}
+		values[i] = "(" + strings.Join(placeholders, ", ") + ")"
+		args = append(args, r.Id, r.NotificationId, r.UserId, r.Token, string(r.Message), r.Status,
+			r.Attempts, r.NextAttemptAt, r.LockedUntil, r.TicketId, r.CreatedAt, r.UpdatedAt)
+	}
+	if _, err := db.Exec(`
+		INSERT INTO push_messages (id, notification_id, user_id, token, message, status,
+			attempts, next_attempt_at, locked_until, ticket_id, created_at, updated_at)
+		VALUES `+strings.Join(values, ", "), args...); err != nil {
+		return fmt.Errorf("failed to queue push messages: %w", err)
+	}
+	return nil
+}
+
+// recordDelivered saves the messages Deliver sent outside the queue that Expo accepted,
+// so their receipts are checked like everyone else's.
+func recordDelivered(messages []ExpoPushMessage, tickets []ExpoPushTicket) error {
+	now := time.Now()
+	var rows []models.PushMessage
+	var badTokens []string
+	for i, ticket := range tickets {
+		switch judge(ticket.Status, ticket.Details.Error, false) {
+		case outcomeSent:
+			payload, err := json.Marshal(messages[i])
+			if err != nil {
+				return fmt.Errorf("failed to marshal message: %w", err)
+			}
+			rows = append(rows, models.PushMessage{
+				Id:            utils.GenerateID(),
+				Token:         messages[i].To,
+				Message:       payload,
+				Status:        statusSent,
+				Attempts:      1,
+				NextAttemptAt: now,
+				TicketId:      ticket.Id,
+				CreatedAt:     now,
+				UpdatedAt:     now,
+			})
+		case outcomeBadToken:
+			badTokens = append(badTokens, messages[i].To)
+		}
+	}
+	if len(rows) == 0 && len(badTokens) == 0 {
+		return nil
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if err := deactivateTokens(db, badTokens); err != nil {
+		return err
+	}
+	return insertMessages(db, rows)
+}
+
+// Run sends queued pushes, checks receipts and prunes old rows until ctx is cancelled.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(queueInterval)
+	defer ticker.Stop()
+	var lastReceipts, lastCleanup time.Time
+	for {
+		now := time.Now()
+		if n, err := ProcessQueue(ctx, now); err != nil {
+			log.Printf("[Push] Queue run failed: %v", err)
+		} else if n > 0 {
+			log.Printf("[Push] Sent %d queued messages", n)
+		}
+		if now.Sub(lastReceipts) >= receiptInterval {
+			lastReceipts = now
+			if n, err := CheckReceipts(ctx, now); err != nil {
+				log.Printf("[Push] Receipt check failed: %v", err)
+			} else if n > 0 {
+				log.Printf("[Push] Checked %d receipts", n)
+			}
+		}
+		if now.Sub(lastCleanup) >= cleanupInterval {
+			lastCleanup = now
+			cleanup(now)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessQueue claims the messages due at now, sends them and returns how many were
+// tried. Replicas skip each other's rows.
+func ProcessQueue(ctx context.Context, now time.Time) (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		UPDATE push_messages SET status = $1, locked_until = $2, updated_at = $3
+		WHERE id IN (
+			SELECT id FROM push_messages
+			WHERE (status = $4 AND next_attempt_at <= $3) OR (status = $1 AND locked_until < $3)
+			ORDER BY next_attempt_at
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, user_id, token, message, attempts
+	`, statusSending, now.Add(sendLease), now, statusPending, queueBatch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim push messages: %w", err)
+	}
+	var claimed []models.PushMessage
+	for rows.Next() {
+		var m models.PushMessage
+		if err := rows.Scan(&m.Id, &m.UserId, &m.Token, &m.Message, &m.Attempts); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan push message: %w", err)
+		}
+		claimed = append(claimed, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("push messages iteration error: %w", err)
+	}
+	if len(claimed) == 0 {
+		return 0, nil
+	}
+
+	if err := sendMessages(ctx, db, claimed, now); err != nil {
+		log.Printf("[Push] Some queued messages failed, will retry: %v", err)
+	}
+	return len(claimed), nil
+}
+
+// sendMessages sends claimed rows and records each one's outcome.
+func sendMessages(ctx context.Context, db execer, rows []models.PushMessage, now time.Time) error {
+	messages := make([]ExpoPushMessage, 0, len(rows))
+	sendable := make([]models.PushMessage, 0, len(rows))
+	for _, r := range rows {
+		var m ExpoPushMessage
+		if err := json.Unmarshal(r.Message, &m); err != nil {
+			settle(db, r, outcomeFailed, "", "invalid message: "+err.Error(), now)
+			continue
+		}
+		messages = append(messages, m)
+		sendable = append(sendable, r)
+	}
+
+	tickets, err := DefaultClient.Send(ctx, messages)
+	var badTokens []string
+	for i, ticket := range tickets {
+		result := judge(ticket.Status, ticket.Details.Error, false)
+		if result == outcomeBadToken {
+			badTokens = append(badTokens, sendable[i].Token)
+		}
+		settle(db, sendable[i], result, ticket.Id, ticketError(ticket.Details.Error, ticket.Message), now)
+	}
+	if err := deactivateTokens(db, badTokens); err != nil {
+		log.Printf("[Push] %v", err)
+	}
+	return err
+}
+
+func ticketError(code, message string) string {
+	if code == "" {
+		return message
+	}
+	return code + ": " + message
+}
+
+// settle records the outcome of a message's latest try. Retries past maxAttempts fail.
+func settle(db execer, m models.PushMessage, result outcome, ticketID, lastError string, now time.Time) {
+	var err error
+	switch result {
+	case outcomeSent:
+		_, err = db.Exec(`
+			UPDATE push_messages SET status = $2, ticket_id = $3, attempts = attempts + 1,
+				locked_until = NULL, last_error = '', updated_at = $4
+			WHERE id = $1
+		`, m.Id, statusSent, ticketID, now)
+	case outcomeDelivered:
+		_, err = db.Exec(`UPDATE push_messages SET status = $2, updated_at = $3 WHERE id = $1`, m.Id, statusDelivered, now)
+	case outcomeRetry:
+		attempts := m.Attempts + 1
+		if attempts >= maxAttempts {
+			result = outcomeFailed
+			break
+		}
+		_, err = db.Exec(`
+			UPDATE push_messages SET status = $2, attempts = $3, next_attempt_at = $4,
+				locked_until = NULL, last_error = $5, updated_at = $6
+			WHERE id = $1
+		`, m.Id, statusPending, attempts, now.Add(retryDelay(attempts)), lastError, now)
+	}
+	if result == outcomeFailed || result == outcomeBadToken {
+		_, err = db.Exec(`
+			UPDATE push_messages SET status = $2, attempts = attempts + 1,
+				locked_until = NULL, last_error = $3, updated_at = $4
+			WHERE id = $1
+		`, m.Id, statusFailed, lastError, now)
+	}
+	if err != nil {
+		log.Printf("[Push] Failed to update push message %s: %v", m.Id, err)
+	}
+}
+
+// deactivateTokens turns off tokens Expo says no longer reach a device
+func deactivateTokens(db execer, tokens []string) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+	args := []any{time.Now()}
+	placeholders := make([]string, len(tokens))
+	for i, token := range tokens {
+		args = append(args, token)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	if _, err := db.Exec(`
+		UPDATE user_push_tokens SET is_active = false, updated_at = $1
+		WHERE is_active = true AND token IN (`+strings.Join(placeholders, ", ")+`)
+	`, args...); err != nil {
+		return fmt.Errorf("failed to deactivate push tokens: %w", err)
+	}
+	log.Printf("[Push] Deactivated %d unregistered tokens", len(tokens))
+	return nil
+}
+
+// CheckReceipts fetches the receipts for messages Expo accepted at least receiptDelay
+// ago and returns how many it got. Messages whose receipt isn't ready are checked again
+// next time, until Expo drops it.
+func CheckReceipts(ctx context.Context, now time.Time) (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var sent []models.PushMessage
+	rows, err := db.Query(`
+		SELECT id, token, ticket_id, attempts FROM push_messages
+		WHERE status = $1 AND updated_at <= $2 AND updated_at > $3 AND ticket_id <> ''
+		ORDER BY updated_at
+		LIMIT $4
+	`, statusSent, now.Add(-receiptDelay), now.Add(-receiptExpiry), receiptBatch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list sent push messages: %w", err)
+	}
+	for rows.Next() {
+		var m models.PushMessage
+		if err := rows.Scan(&m.Id, &m.Token, &m.TicketId, &m.Attempts); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan push message: %w", err)
+		}
+		sent = append(sent, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("push messages iteration error: %w", err)
+	}
+	if len(sent) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, len(sent))
+	for i, m := range sent {
+		ids[i] = m.TicketId
+	}
+	receipts, err := DefaultClient.Receipts(ctx, ids)
+	if err != nil && len(receipts) == 0 {
+		return 0, err
+	}
+
+	var badTokens []string
+	for _, m := range sent {
+		receipt, ok := receipts[m.TicketId]
+		if !ok {
+			continue
+		}
+		result := judge(receipt.Status, receipt.Details.Error, true)
+		if result == outcomeBadToken {
+			badTokens = append(badTokens, m.Token)
+		}
+		settle(db, m, result, m.TicketId, ticketError(receipt.Details.Error, receipt.Message), now)
+	}
+	if err := deactivateTokens(db, badTokens); err != nil {
+		log.Printf("[Push] %v", err)
+	}
+	return len(receipts), err
+}
+
+// cleanup deletes queue rows older than retention
+func cleanup(now time.Time) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		log.Printf("[Push] Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	res, err := db.Exec(`DELETE FROM push_messages WHERE created_at < $1`, now.Add(-retention))
+	if err != nil {
+		log.Printf("[Push] Failed to prune push queue: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("[Push] Pruned %d old push messages", n)
+	}
+}
@@ -0,0 +1,163 @@
+package rbac
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/MelloB1989/karma/database"
+)
+
+type Permission string
+
+const (
+	UsersView              Permission = "users.view"
+	UsersBan               Permission = "users.ban"
+	UsersRole              Permission = "users.role"
+	VerificationsResolve   Permission = "verifications.resolve"
+	ReportsResolve         Permission = "reports.resolve"
+	BillingGrant           Permission = "billing.grant"
+	BillingRefund          Permission = "billing.refund"
+	BillingWebhooks        Permission = "billing.webhooks"
+	BillingPlans           Permission = "billing.plans"
+	BillingPromotions      Permission = "billing.promotions"
+	NotificationsBroadcast Permission = "notifications.broadcast"
+	StatsView              Permission = "stats.view"
+	AuditView              Permission = "audit.view"
+	UsersImpersonate       Permission = "users.impersonate"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var (
+	ErrForbidden = errors.New("insufficient permissions")
+	ErrNotFound  = errors.New("user not found")
+)
+
+// rolePermissions maps each role to what it may do. Admins can do everything;
+// moderators handle day to day trust & safety but can't touch roles, billing or broadcasts.
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		UsersView, UsersBan, UsersRole, VerificationsResolve, ReportsResolve,
+		BillingGrant, BillingRefund, BillingWebhooks, BillingPlans, BillingPromotions, NotificationsBroadcast, StatsView, AuditView, UsersImpersonate,
+	},
+	RoleModerator: {
+		UsersView, UsersBan, VerificationsResolve, ReportsResolve, StatsView, UsersImpersonate,
+	},
+}
+
+// IsValidRole reports whether role can be assigned to a user.
+func IsValidRole(role string) bool {
+	return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
+
+// PermissionsFor returns the permissions granted to role.
+func PermissionsFor(role string) []Permission {
+	return slices.Clone(rolePermissions[role])
+}
+
+// RoleHas reports whether role grants p.
+func RoleHas(role string, p Permission) bool {
+	return slices.Contains(rolePermissions[role], p)
+}
+
+// roleRank orders roles from least to most trusted
+var roleRank = map[string]int{
+	RoleUser:      0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+// Outranks reports whether role is above other.
+func Outranks(role, other string) bool {
+	return roleRank[role] > roleRank[other]
+}
+
+// GetRole looks up a user's current role, bypassing the user cache so that
+// demotions and bans take effect immediately.
+func GetRole(userId string) (string, error) {
+	role, banned, err := lookupRole(userId)
+	if err != nil {
+		return "", err
+	}
+	// Banned staff lose every permission
+	if banned {
+		return RoleUser, nil
+	}
+	return role, nil
+}
+
+func lookupRole(userId string) (role string, banned bool, err error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var r sql.NullString
+	var b sql.NullBool
+	err = db.QueryRow(`SELECT role, is_banned FROM users WHERE id = $1`, userId).Scan(&r, &b)
+	if err == sql.ErrNoRows {
+		return "", false, ErrNotFound
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	role = r.String
+	if role == "" {
+		role = RoleUser
+	}
+	return role, b.Valid && b.Bool, nil
+}
+
+// CheckOutranks returns ErrForbidden unless actorId's role is above targetId's, so staff
+// can't ban, restrict or re-role their peers and superiors. Banned staff keep the rank
+// of their role as targets, so a moderator can't lift an admin's ban either.
+func CheckOutranks(actorId, targetId string) error {
+	actorRole, err := GetRole(actorId)
+	if err != nil {
+		return err
+	}
+	targetRole, _, err := lookupRole(targetId)
+	if err != nil {
+		return err
+	}
+	if !Outranks(actorRole, targetRole) {
+		return fmt.Errorf("%w: can't act on a %s as a %s", ErrForbidden, targetRole, actorRole)
+	}
+	return nil
+}
+
+// CheckRoleChange returns ErrForbidden unless actorId outranks targetId and may hand
+// out role, which can't be above their own.
+func CheckRoleChange(actorId, targetId, role string) error {
+	if err := CheckOutranks(actorId, targetId); err != nil {
+		return err
+	}
+	actorRole, err := GetRole(actorId)
+	if err != nil {
+		return err
+	}
+	if Outranks(role, actorRole) {
+		return fmt.Errorf("%w: can't grant %s as a %s", ErrForbidden, role, actorRole)
+	}
+	return nil
+}
+
+// Check returns ErrForbidden unless userId currently holds p.
+func Check(userId string, p Permission) error {
+	role, err := GetRole(userId)
+	if err != nil {
+		return err
+	}
+	if !RoleHas(role, p) {
+		return fmt.Errorf("%w: %s required", ErrForbidden, p)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package rbac
+
+import "testing"
+
+func TestOutranks(t *testing.T) {
+	tests := []struct {
+		role, other string
+		want        bool
+	}{
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleUser, true},
+		{RoleModerator, RoleUser, true},
+		{RoleAdmin, RoleAdmin, false},
+		{RoleModerator, RoleModerator, false},
+		{RoleModerator, RoleAdmin, false},
+		{RoleUser, RoleUser, false},
+		// Unknown roles rank as plain users
+		{RoleModerator, "", true},
+		{"", RoleUser, false},
+	}
+	for _, tt := range tests {
+		if got := Outranks(tt.role, tt.other); got != tt.want {
+			t.Errorf("Outranks(%q, %q) = %v, want %v", tt.role, tt.other, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package reporting
+
+import (
+	chatservice "spark/internal/chat_service"
+	"spark/internal/helpers/community"
+	"spark/internal/helpers/users"
+	"spark/internal/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MelloB1989/karma/utils"
+)
+
+// Evidence kinds
+const (
+	EvidenceChatMessages = "chat_messages"
+	EvidencePost         = "post"
+	EvidenceComment      = "comment"
+	EvidenceProfile      = "profile"
+)
+
+// EvidenceMessages is how much of a chat's recent history is kept with a report.
+const EvidenceMessages = 50
+
+var ErrChatNotShared = errors.New("the reported user isn't part of this chat")
+
+// capture works out which user a report is about and snapshots the reported content.
+// For users that is their profile, plus the recent messages of the chat the report
+// was filed from.
+func capture(in Input) (string, []*models.ReportEvidence, error) {
+	switch in.TargetType {
+	case TargetPost:
+		post, err := community.GetPostById(in.TargetId)
+		if err != nil {
+			return "", nil, ErrTargetNotFound
+		}
+		e, err := newEvidence(EvidencePost, post.Id, map[string]any{
+			"user_id":    post.UserId,
+			"content":    post.Content,
+			"media":      mediaUrls(post.Media),
+			"created_at": post.CreatedAt,
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		return post.UserId, []*models.ReportEvidence{e}, nil
+
+	case TargetComment:
+		comment, err := community.GetCommentById(in.TargetId)
+		if err != nil {
+			return "", nil, ErrTargetNotFound
+		}
+		e, err := newEvidence(EvidenceComment, comment.Id, map[string]any{
+			"user_id":     comment.UserId,
+			"post_id":     comment.PostId,
+			"reply_to_id": comment.ReplyToId,
+			"content":     comment.Content,
+			"created_at":  comment.CreatedAt,
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		return comment.UserId, []*models.ReportEvidence{e}, nil
+	}
+
+	user, err := users.GetUserByID(in.TargetId)
+	if err != nil {
+		return "", nil, ErrTargetNotFound
+	}
+	profile, err := newEvidence(EvidenceProfile, user.Id, map[string]any{
+		"first_name":   user.FirstName,
+		"last_name":    user.LastName,
+		"bio":          user.Bio,
+		"pfp":          user.Pfp,
+		"photos":       user.Photos,
+		"user_prompts": user.UserPrompts,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	evidence := []*models.ReportEvidence{profile}
+
+	if in.ChatId != "" {
+		chat, err := chatEvidence(in.ChatId, in.ReporterId, user.Id)
+		if err != nil {
+			return "", nil, err
+		}
+		evidence = append(evidence, chat)
+	}
+	return user.Id, evidence, nil
+}
+
+func chatEvidence(chatId, reporterId, targetId string) (*models.ReportEvidence, error) {
+	store, err := chatservice.NewStore(chatId, reporterId)
+	if err != nil {
+		if errors.Is(err, chatservice.ErrUnauthorized) {
+			return nil, ErrChatNotShared
+		}
+		return nil, fmt.Errorf("failed to open chat: %w", err)
+	}
+	defer store.Close()
+	if !store.IsParticipant(targetId) {
+		return nil, ErrChatNotShared
+	}
+
+	page, err := store.QueryMessages(chatservice.MessageQuery{Limit: EvidenceMessages})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chat: %w", err)
+	}
+	messages := make([]map[string]any, len(page.Messages))
+	for i, m := range page.Messages {
+		messages[i] = map[string]any{
+			"id":         m.Id,
+			"sender_id":  m.SenderId,
+			"type":       string(m.Type),
+			"content":    m.Content,
+			"media":      mediaUrls(m.Media),
+			"created_at": m.CreatedAt,
+		}
+	}
+	return newEvidence(EvidenceChatMessages, chatId, map[string]any{
+		"participants": store.GetParticipants(),
+		"messages":     messages,
+	})
+}
+
+// newEvidence normalises snapshot through JSON so the stored row and its hash match
+// exactly what is read back later.
+func newEvidence(kind, sourceId string, snapshot map[string]any) (*models.ReportEvidence, error) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode evidence: %w", err)
+	}
+	var normalised map[string]any
+	if err := json.Unmarshal(data, &normalised); err != nil {
+		return nil, fmt.Errorf("failed to encode evidence: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return &models.ReportEvidence{
+		Id:          utils.GenerateID(12),
+		Kind:        kind,
+		SourceId:    sourceId,
+		Snapshot:    normalised,
+		ContentHash: hex.EncodeToString(sum[:]),
+		CapturedAt:  time.Now(),
+	}, nil
+}
+
+func mediaUrls(media []models.Media) []string {
+	urls := make([]string, 0, len(media))
+	for _, m := range media {
+		urls = append(urls, m.Url)
+	}
+	return urls
+}
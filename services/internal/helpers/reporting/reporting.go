@@ -0,0 +1,516 @@
+// Package reporting files user reports and keeps the moderation triage queue. Reports
+// against the same user are grouped while unresolved, and each group is prioritised by
+// how severe its reports are and how many people filed them.
+package reporting
+
+import (
+	"spark/internal/helpers/moderation"
+	"spark/internal/helpers/rbac"
+	"spark/internal/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// Report target types
+const (
+	TargetUser    = "user"
+	TargetPost    = "post"
+	TargetComment = "comment"
+)
+
+// Report statuses
+const (
+	StatusPending     = "pending"
+	StatusResolved    = "resolved"
+	StatusDismissed   = "dismissed"
+	StatusActionTaken = "action_taken"
+)
+
+// Group statuses
+const (
+	GroupOpen      = "open"
+	GroupAssigned  = "assigned"
+	GroupEscalated = "escalated"
+	GroupResolved  = "resolved"
+)
+
+// Priority is severity*severityWeight plus reporterWeight for every distinct reporter
+// up to maxCountedReporters, plus escalationBoost once a group has been escalated.
+const (
+	severityWeight      = 20
+	reporterWeight      = 5
+	maxCountedReporters = 10
+	escalationBoost     = 100
+	maxNoteLength       = 2000
+)
+
+// severities ranks report categories from 1 (least) to 5 (most urgent). Categories are
+// the moderation reason codes so a report's category carries over to any enforcement.
+var severities = map[string]int{
+	moderation.ReasonUnderage:    5,
+	moderation.ReasonViolence:    5,
+	moderation.ReasonHateSpeech:  4,
+	moderation.ReasonHarassment:  4,
+	moderation.ReasonScam:        4,
+	moderation.ReasonNudity:      3,
+	moderation.ReasonFakeProfile: 2,
+	moderation.ReasonSpam:        1,
+	moderation.ReasonOther:       1,
+}
+
+var (
+	ErrInvalidCategory   = errors.New("invalid report category")
+	ErrInvalidTargetType = errors.New("invalid target type: must be user, post or comment")
+	ErrInvalidStatus     = errors.New("invalid status: must be resolved, dismissed or action_taken")
+	ErrSelfReport        = errors.New("you can't report yourself")
+	ErrTargetNotFound    = errors.New("reported content not found")
+	ErrReportNotFound    = errors.New("report not found")
+	ErrGroupNotFound     = errors.New("report group not found")
+	ErrGroupResolved     = errors.New("report group is already resolved")
+	ErrAlreadyEscalated  = errors.New("report group is already escalated")
+	ErrNoteRequired      = errors.New("a note is required to escalate")
+	ErrInvalidAssignee   = errors.New("assignee can't resolve reports")
+)
+
+// Severity returns the severity of a category.
+func Severity(category string) int {
+	if s, ok := severities[category]; ok {
+		return s
+	}
+	return 1
+}
+
+func IsValidCategory(category string) bool {
+	return slices.Contains(moderation.ReasonCodes(), category)
+}
+
+// Input describes a report being filed.
+type Input struct {
+	ReporterId     string
+	TargetType     string
+	TargetId       string
+	ChatId         string // Optional, for reports of a user met in a chat
+	Category       string
+	Reason         string
+	AdditionalInfo string
+	Media          []models.Media
+}
+
+// File records a report, adds it to the open group for the reported user and stores
+// snapshots of the reported content. Filing the same report again while it's pending
+// returns the existing one.
+func File(in Input) (*models.Report, error) {
+	if in.TargetType == "" {
+		in.TargetType = TargetUser
+	}
+	if in.TargetType != TargetUser && in.TargetType != TargetPost && in.TargetType != TargetComment {
+		return nil, ErrInvalidTargetType
+	}
+	if !IsValidCategory(in.Category) {
+		return nil, ErrInvalidCategory
+	}
+	if len(in.AdditionalInfo) > maxNoteLength {
+		in.AdditionalInfo = in.AdditionalInfo[:maxNoteLength]
+	}
+
+	// Snapshot first: it resolves who is being reported and captures the content as
+	// close to the time of the report as possible.
+	subjectId, evidence, err := capture(in)
+	if err != nil {
+		return nil, err
+	}
+	if subjectId == in.ReporterId {
+		return nil, ErrSelfReport
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	report := &models.Report{
+		Id:             utils.GenerateID(10),
+		UserId:         in.ReporterId,
+		TargetId:       in.TargetId,
+		TargetType:     in.TargetType,
+		SubjectId:      subjectId,
+		ChatId:         in.ChatId,
+		Category:       in.Category,
+		Severity:       Severity(in.Category),
+		Reason:         in.Reason,
+		AdditionalInfo: in.AdditionalInfo,
+		Media:          in.Media,
+		Status:         StatusPending,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if report.Reason == "" {
+		report.Reason = in.Category
+	}
+	media, err := json.Marshal(report.Media)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode media: %w", err)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Joining the open group locks it until commit, so the group can't be resolved
+	// while this report is being added.
+	err = tx.QueryRow(`
+		INSERT INTO report_groups (id, subject_id, status, category, severity, last_reported_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6, $6)
+		ON CONFLICT (subject_id) WHERE status <> 'resolved'
+		DO UPDATE SET last_reported_at = EXCLUDED.last_reported_at, updated_at = EXCLUDED.updated_at
+		RETURNING id
+	`, utils.GenerateID(10), subjectId, GroupOpen, report.Category, report.Severity, now).Scan(&report.GroupId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to group report: %w", err)
+	}
+
+	var existingId string
+	err = tx.QueryRow(`
+		SELECT id FROM reports
+		WHERE group_id = $1 AND user_id = $2 AND target_type = $3 AND target_id = $4 AND status = $5
+		LIMIT 1
+	`, report.GroupId, in.ReporterId, in.TargetType, in.TargetId, StatusPending).Scan(&existingId)
+	if err == nil {
+		tx.Rollback()
+		return Get(existingId)
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to check for duplicate reports: %w", err)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT INTO reports (id, user_id, target_id, target_type, subject_id, chat_id, category, severity, group_id,
+			reason, additional_info, media, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $14)
+	`, report.Id, report.UserId, report.TargetId, report.TargetType, report.SubjectId, report.ChatId,
+		report.Category, report.Severity, report.GroupId, report.Reason, report.AdditionalInfo,
+		string(media), report.Status, now); err != nil {
+		return nil, fmt.Errorf("failed to create report: %w", err)
+	}
+	for _, e := range evidence {
+		e.ReportId = report.Id
+		snapshot, err := json.Marshal(e.Snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s evidence: %w", e.Kind, err)
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO report_evidence (id, report_id, kind, source_id, snapshot, content_hash, captured_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`, e.Id, e.ReportId, e.Kind, e.SourceId, string(snapshot), e.ContentHash, e.CapturedAt); err != nil {
+			return nil, fmt.Errorf("failed to store %s evidence: %w", e.Kind, err)
+		}
+	}
+	if err := refreshGroup(tx, report.GroupId); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create report: %w", err)
+	}
+
+	return report, nil
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// refreshGroup recomputes a group's counters, headline category and priority from its
+// pending reports.
+func refreshGroup(db execer, groupId string) error {
+	_, err := db.Exec(fmt.Sprintf(`
+		UPDATE report_groups g SET
+			report_count = s.reports,
+			reporter_count = s.reporters,
+			severity = s.severity,
+			category = s.category,
+			priority = s.severity * %d + LEAST(s.reporters, %d) * %d
+				+ CASE WHEN g.escalated_at IS NOT NULL THEN %d ELSE 0 END
+		FROM (
+			SELECT
+				COUNT(*) AS reports,
+				COUNT(DISTINCT user_id) AS reporters,
+				COALESCE(MAX(severity), 1) AS severity,
+				COALESCE((array_agg(category ORDER BY severity DESC, created_at DESC))[1], 'other') AS category
+			FROM reports WHERE group_id = $1 AND status = $2
+		) s
+		WHERE g.id = $1
+	`, severityWeight, maxCountedReporters, reporterWeight, escalationBoost), groupId, StatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to update report group: %w", err)
+	}
+	return nil
+}
+
+func Get(id string) (*models.Report, error) {
+	reportORM := orm.Load(&models.Report{})
+	defer reportORM.Close()
+
+	var reports []models.Report
+	if err := reportORM.GetByFieldEquals("Id", id).Scan(&reports); err != nil {
+		return nil, fmt.Errorf("failed to get report: %w", err)
+	}
+	if len(reports) == 0 {
+		return nil, ErrReportNotFound
+	}
+	return &reports[0], nil
+}
+
+func GetGroup(id string) (*models.ReportGroup, error) {
+	groupORM := orm.Load(&models.ReportGroup{})
+	defer groupORM.Close()
+
+	var groups []models.ReportGroup
+	if err := groupORM.GetByFieldEquals("Id", id).Scan(&groups); err != nil {
+		return nil, fmt.Errorf("failed to get report group: %w", err)
+	}
+	if len(groups) == 0 {
+		return nil, ErrGroupNotFound
+	}
+	return &groups[0], nil
+}
+
+// ChatHasOpenReport reports whether a pending report was filed from chatId.
+func ChatHasOpenReport(chatId string) (bool, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var open bool
+	err = db.QueryRow(
+		`SELECT EXISTS (SELECT 1 FROM reports WHERE chat_id = $1 AND status = $2)`,
+		chatId, StatusPending,
+	).Scan(&open)
+	return open, err
+}
+
+// GroupReports returns every report in a group, most severe first.
+func GroupReports(groupId string) ([]models.Report, error) {
+	reportORM := orm.Load(&models.Report{})
+	defer reportORM.Close()
+
+	var reports []models.Report
+	if err := reportORM.QueryRaw(
+		`SELECT * FROM reports WHERE group_id = $1 ORDER BY severity DESC, created_at DESC`, groupId,
+	).Scan(&reports); err != nil {
+		return nil, fmt.Errorf("failed to get reports: %w", err)
+	}
+	return reports, nil
+}
+
+// Evidence returns the snapshots captured for the given reports, oldest first.
+func Evidence(reportIds ...string) ([]models.ReportEvidence, error) {
+	if len(reportIds) == 0 {
+		return []models.ReportEvidence{}, nil
+	}
+	placeholders := make([]string, len(reportIds))
+	args := make([]any, len(reportIds))
+	for i, id := range reportIds {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+		args[i] = id
+	}
+
+	evidenceORM := orm.Load(&models.ReportEvidence{})
+	defer evidenceORM.Close()
+
+	var evidence []models.ReportEvidence
+	if err := evidenceORM.QueryRaw(
+		`SELECT * FROM report_evidence WHERE report_id IN (`+strings.Join(placeholders, ", ")+`) ORDER BY captured_at, id`,
+		args...,
+	).Scan(&evidence); err != nil {
+		return nil, fmt.Errorf("failed to get evidence: %w", err)
+	}
+	return evidence, nil
+}
+
+// Assign hands an unresolved group to assigneeId, who must be allowed to resolve reports.
+func Assign(groupId, assigneeId string) (*models.ReportGroup, error) {
+	if err := rbac.Check(assigneeId, rbac.ReportsResolve); err != nil {
+		if errors.Is(err, rbac.ErrForbidden) || errors.Is(err, rbac.ErrNotFound) {
+			return nil, ErrInvalidAssignee
+		}
+		return nil, err
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	res, err := db.Exec(`
+		UPDATE report_groups SET status = $2, assignee_id = $3, updated_at = $4
+		WHERE id = $1 AND status <> $5
+	`, groupId, GroupAssigned, assigneeId, time.Now(), GroupResolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign report group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, unresolvedGroupError(groupId)
+	}
+	return GetGroup(groupId)
+}
+
+// Escalate sends a group back to the queue for senior staff. It is unassigned and its
+// priority is raised for as long as it stays unresolved.
+func Escalate(groupId, actorId, note string) (*models.ReportGroup, error) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return nil, ErrNoteRequired
+	}
+	if len(note) > maxNoteLength {
+		note = note[:maxNoteLength]
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.Exec(`
+		UPDATE report_groups
+		SET status = $2, assignee_id = '', escalated_at = $3, escalated_by = $4, escalation_note = $5, updated_at = $3
+		WHERE id = $1 AND status NOT IN ($6, $2)
+	`, groupId, GroupEscalated, now, actorId, note, GroupResolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to escalate report group: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		group, err := GetGroup(groupId)
+		if err != nil {
+			return nil, err
+		}
+		if group.Status == GroupEscalated {
+			return nil, ErrAlreadyEscalated
+		}
+		return nil, ErrGroupResolved
+	}
+	if err := refreshGroup(tx, groupId); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to escalate report group: %w", err)
+	}
+	return GetGroup(groupId)
+}
+
+// CheckResolvable reports why report can't be resolved with status, if it can't.
+// Callers that act on the reported account check it first, so a refused resolution
+// doesn't follow an action already taken.
+func CheckResolvable(report *models.Report, status string) error {
+	if status != StatusResolved && status != StatusDismissed && status != StatusActionTaken {
+		return ErrInvalidStatus
+	}
+	if report.GroupId == "" {
+		return nil
+	}
+	group, err := GetGroup(report.GroupId)
+	if err != nil {
+		return err
+	}
+	if group.Status == GroupResolved {
+		return ErrGroupResolved
+	}
+	return nil
+}
+
+// Resolve closes the report's group, giving every pending report in it the same status.
+// Reports filed before grouping existed are resolved on their own. It returns the
+// report and the number of reports that were closed.
+func Resolve(reportId, status string) (*models.Report, int, error) {
+	if status != StatusResolved && status != StatusDismissed && status != StatusActionTaken {
+		return nil, 0, ErrInvalidStatus
+	}
+	report, err := Get(reportId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	if report.GroupId == "" {
+		if _, err := db.Exec(`UPDATE reports SET status = $2, updated_at = $3 WHERE id = $1`, reportId, status, now); err != nil {
+			return nil, 0, fmt.Errorf("failed to resolve report: %w", err)
+		}
+		report.Status = status
+		report.UpdatedAt = now
+		return report, 1, nil
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var groupStatus string
+	if err := tx.QueryRow(`SELECT status FROM report_groups WHERE id = $1 FOR UPDATE`, report.GroupId).Scan(&groupStatus); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, ErrGroupNotFound
+		}
+		return nil, 0, fmt.Errorf("failed to get report group: %w", err)
+	}
+	if groupStatus == GroupResolved {
+		return nil, 0, ErrGroupResolved
+	}
+
+	res, err := tx.Exec(`
+		UPDATE reports SET status = $2, updated_at = $3 WHERE group_id = $1 AND status = $4
+	`, report.GroupId, status, now, StatusPending)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to resolve reports: %w", err)
+	}
+	closed, _ := res.RowsAffected()
+
+	if _, err := tx.Exec(`
+		UPDATE report_groups SET status = $2, resolved_at = $3, updated_at = $3 WHERE id = $1
+	`, report.GroupId, GroupResolved, now); err != nil {
+		return nil, 0, fmt.Errorf("failed to resolve report group: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, 0, fmt.Errorf("failed to resolve reports: %w", err)
+	}
+
+	report.Status = status
+	report.UpdatedAt = now
+	return report, int(closed), nil
+}
+
+func unresolvedGroupError(groupId string) error {
+	if _, err := GetGroup(groupId); err != nil {
+		return err
+	}
+	return ErrGroupResolved
+}
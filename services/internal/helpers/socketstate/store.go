@@ -2,6 +2,7 @@ package socketstate
 
 import (
 	"spark/internal/anal"
+	"spark/internal/helpers/metrics"
 	"context"
 	"fmt"
 	"time"
@@ -44,6 +45,7 @@ func (s *PublicUserState) SetOnlineStatus(status bool) error {
 			analyticsClient := anal.CreateAnalytics(s.uid)
 			if status {
 				analyticsClient.SendEvent(anal.USER_ONLINE)
+				metrics.RecordActive(s.uid)
 			} else {
 				analyticsClient.SendEvent(anal.USER_OFFLINE)
 			}
@@ -2,9 +2,11 @@ package streaks
 
 import (
 	"spark/internal/helpers/ormcompat"
-	"spark/internal/helpers/pushnotify"
+	"spark/internal/helpers/notifications"
 	"spark/internal/helpers/users"
+	"spark/internal/i18n"
 	"spark/internal/models"
+	"fmt"
 	"log"
 	"time"
 
@@ -24,18 +26,19 @@ type MilestoneInfo struct {
 	AchievedAt *time.Time
 }
 
-// GetMilestoneInfo returns milestone information for a streak count
-func GetMilestoneInfo(streak int) []MilestoneInfo {
+// GetMilestoneInfo returns milestone information for a streak count, titled in locale
+func GetMilestoneInfo(locale string, streak int) []MilestoneInfo {
 	milestones := []MilestoneInfo{
-		{Days: 7, Emoji: "🔥", Title: "Week Warrior"},
-		{Days: 14, Emoji: "🔥🔥", Title: "Two Week Champion"},
-		{Days: 30, Emoji: "🔥🔥🔥", Title: "Monthly Master"},
-		{Days: 50, Emoji: "⭐", Title: "Fifty Day Star"},
-		{Days: 100, Emoji: "💯🔥", Title: "Century Streak"},
-		{Days: 365, Emoji: "👑", Title: "Year Long Legend"},
+		{Days: 7, Emoji: "🔥"},
+		{Days: 14, Emoji: "🔥🔥"},
+		{Days: 30, Emoji: "🔥🔥🔥"},
+		{Days: 50, Emoji: "⭐"},
+		{Days: 100, Emoji: "💯🔥"},
+		{Days: 365, Emoji: "👑"},
 	}
 
 	for i := range milestones {
+		milestones[i].Title = i18n.T(locale, fmt.Sprintf("streak.milestone.%d", milestones[i].Days))
 		milestones[i].Achieved = streak >= milestones[i].Days
 	}
 
@@ -214,9 +217,15 @@ func SendMilestoneNotifications(matchID string, streak int) {
 			heName = heUser.FirstName
 		}
 
+		chatID := ""
+		chats, _ := ormcompat.GetByFieldEqualsSlice[models.Chat](orm.Load(&models.Chat{}), "MatchId", matchID)
+		if len(chats) > 0 {
+			chatID = chats[0].Id
+		}
+
 		// Send to both users
-		pushnotify.SendStreakMilestoneNotification(match.SheId, heName, streak, matchID)
-		pushnotify.SendStreakMilestoneNotification(match.HeId, sheName, streak, matchID)
+		notifications.SendStreakMilestoneNotification(match.SheId, heName, streak, matchID, chatID)
+		notifications.SendStreakMilestoneNotification(match.HeId, sheName, streak, matchID, chatID)
 	}()
 }
 
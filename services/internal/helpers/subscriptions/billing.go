@@ -0,0 +1,167 @@
+package subscriptions
+
+import (
+	"spark/internal/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+)
+
+// Billing event types
+const (
+	EventCreated     = "subscription.created"
+	EventRenewed     = "subscription.renewed"
+	EventPlanChanged = "plan.changed"
+	EventPaused      = "subscription.paused"
+	EventResumed     = "subscription.resumed"
+	EventCancelled   = "subscription.cancelled"
+	EventReactivated = "subscription.reactivated"
+	EventExpired     = "subscription.expired"
+	EventRefund      = "refund"
+)
+
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 200
+)
+
+// recordEvent appends e to the user's billing history. Events carrying a provider
+// event id are recorded once; a redelivered webhook reports false.
+func recordEvent(e models.BillingEvent) (bool, error) {
+	if e.Id == "" {
+		e.Id = utils.GenerateID()
+	}
+	if e.Currency == "" {
+		e.Currency = "USD"
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	details, err := json.Marshal(e.Details)
+	if err != nil || e.Details == nil {
+		details = []byte("{}")
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	res, err := db.Exec(`
+		INSERT INTO billing_events (id, user_id, subscription_id, type, plan_id, previous_plan_id, amount, currency,
+			provider, provider_event_id, actor_id, reason, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT DO NOTHING
+	`, e.Id, e.UserId, e.SubscriptionId, e.Type, e.PlanId, e.PreviousPlanId, e.Amount, e.Currency,
+		e.Provider, e.ProviderEventId, e.ActorId, e.Reason, details, e.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to record billing event: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// eventFor starts a billing event about sub.
+func eventFor(sub *models.UserSubscription, eventType string) models.BillingEvent {
+	return models.BillingEvent{
+		UserId:         sub.UserId,
+		SubscriptionId: sub.Id,
+		Type:           eventType,
+		PlanId:         sub.PlanId,
+		Currency:       sub.Currency,
+		Provider:       sub.Provider,
+	}
+}
+
+// History returns a user's billing events, newest first.
+func History(userID string, limit int) ([]*models.BillingEvent, error) {
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT id, user_id, subscription_id, type, plan_id, previous_plan_id, amount, currency,
+			provider, provider_event_id, actor_id, reason, details, created_at
+		FROM billing_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query billing history: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]*models.BillingEvent, 0, limit)
+	for rows.Next() {
+		var e models.BillingEvent
+		var details []byte
+		if err := rows.Scan(&e.Id, &e.UserId, &e.SubscriptionId, &e.Type, &e.PlanId, &e.PreviousPlanId, &e.Amount, &e.Currency,
+			&e.Provider, &e.ProviderEventId, &e.ActorId, &e.Reason, &details, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan billing event: %w", err)
+		}
+		json.Unmarshal(details, &e.Details)
+		events = append(events, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("billing history iteration error: %w", err)
+	}
+	return events, nil
+}
+
+// GetRefund returns the refund recorded under a provider's refund id, if any.
+func GetRefund(provider, refundID string) (*models.BillingEvent, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var e models.BillingEvent
+	var details []byte
+	err = db.QueryRow(`
+		SELECT id, user_id, subscription_id, type, plan_id, previous_plan_id, amount, currency,
+			provider, provider_event_id, actor_id, reason, details, created_at
+		FROM billing_events
+		WHERE provider = $1 AND provider_event_id = $2 AND type = $3
+	`, provider, refundID, EventRefund).Scan(&e.Id, &e.UserId, &e.SubscriptionId, &e.Type, &e.PlanId, &e.PreviousPlanId, &e.Amount, &e.Currency,
+		&e.Provider, &e.ProviderEventId, &e.ActorId, &e.Reason, &details, &e.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load refund: %w", err)
+	}
+	json.Unmarshal(details, &e.Details)
+	return &e, nil
+}
+
+// refundedAmount is how much of a subscription has been refunded so far.
+func refundedAmount(subscriptionID string) (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var total int
+	err = db.QueryRow(`
+		SELECT COALESCE(SUM(-amount), 0) FROM billing_events WHERE subscription_id = $1 AND type = $2
+	`, subscriptionID, EventRefund).Scan(&total)
+	return total, err
+}
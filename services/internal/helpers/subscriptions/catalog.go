@@ -0,0 +1,491 @@
+package subscriptions
+
+import (
+	"spark/internal/models"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// catalogTTL is how long plans are served from memory. Changes made through this
+// package show up at once on the replica that made them, and within catalogTTL on the
+// others or after editing subscription_plans by hand.
+const catalogTTL = 30 * time.Second
+
+var (
+	ErrPlanExists      = errors.New("a plan with this id already exists")
+	ErrInvalidPlanId   = errors.New("plan id must be lowercase letters, digits, - or _")
+	ErrInvalidPrice    = errors.New("prices can't be negative")
+	ErrInvalidVariant  = errors.New("variants must belong to an active plan that isn't itself a variant")
+	ErrVariantWeight   = errors.New("variant weights must be between 1 and 100 and add up to at most 100 per plan")
+	ErrProductInUse    = errors.New("product id is already used by another plan")
+	ErrRetireFreePlan  = errors.New("the free plan can't be retired")
+	ErrVariantOnlyEdit = errors.New("variants share their plan's features and limits")
+)
+
+var planIdPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,39}$`)
+
+// defaultPlans is the catalog used until subscription_plans has rows, so a fresh
+// database still has plans to offer. The migration that created the catalog seeds the
+// same plans.
+var defaultPlans = []models.SubscriptionPlan{
+	{
+		Id:          PlanFree,
+		Name:        "Free",
+		Description: "Get started with basic features",
+		Limits:      models.SubscriptionLimits{SwipesPerDay: 10, SuperlikesPerDay: 1},
+		IsActive:    true,
+	},
+	{
+		Id:           PlanPlus,
+		Name:         "Plus",
+		Description:  "See who liked you and more",
+		PriceMonthly: 999,  // $9.99
+		PriceYearly:  7999, // $79.99
+		Features:     models.SubscriptionFeatures{SeeWhoLiked: true, UnlimitedRewinds: true, ReadReceipts: true},
+		Limits:       models.SubscriptionLimits{SwipesPerDay: -1, AiRepliesPerDay: 5, SuperlikesPerDay: 5, BoostsPerMonth: 1},
+		ProductIds: models.PlanProducts{
+			DodoMonthly: "SPARK_plus_monthly", DodoYearly: "SPARK_plus_yearly",
+			RevcatMonthly: "SPARK_plus_monthly", RevcatYearly: "SPARK_plus_annual",
+		},
+		IsActive:  true,
+		SortOrder: 1,
+	},
+	{
+		Id:           PlanPro,
+		Name:         "Pro",
+		Description:  "Priority matching and unlimited AI",
+		PriceMonthly: 1999,  // $19.99
+		PriceYearly:  15999, // $159.99
+		Features: models.SubscriptionFeatures{
+			SeeWhoLiked: true, PriorityMatching: true, AdvancedFilters: true,
+			UnlimitedRewinds: true, ReadReceipts: true, IncognitoMode: true,
+		},
+		Limits: models.SubscriptionLimits{SwipesPerDay: -1, AiRepliesPerDay: -1, SuperlikesPerDay: 10, BoostsPerMonth: 3},
+		ProductIds: models.PlanProducts{
+			DodoMonthly: "SPARK_pro_monthly", DodoYearly: "SPARK_pro_yearly",
+			RevcatMonthly: "SPARK_pro_monthly", RevcatYearly: "SPARK_pro_annual",
+		},
+		IsActive:  true,
+		SortOrder: 2,
+	},
+	{
+		Id:           PlanElite,
+		Name:         "Elite",
+		Description:  "All features unlocked",
+		PriceMonthly: 2999,  // $29.99
+		PriceYearly:  23999, // $239.99
+		Features: models.SubscriptionFeatures{
+			SeeWhoLiked: true, PriorityMatching: true, ProfileBoost: true, AdvancedFilters: true,
+			VerifiedPriority: true, UnlimitedRewinds: true, ReadReceipts: true, IncognitoMode: true,
+		},
+		Limits: models.SubscriptionLimits{SwipesPerDay: -1, AiRepliesPerDay: -1, SuperlikesPerDay: -1, BoostsPerMonth: 10},
+		ProductIds: models.PlanProducts{
+			DodoMonthly: "SPARK_elite_monthly", DodoYearly: "SPARK_elite_yearly",
+			RevcatMonthly: "SPARK_elite_monthly", RevcatYearly: "SPARK_elite_annual",
+		},
+		IsActive:  true,
+		SortOrder: 3,
+	},
+}
+
+var catalog struct {
+	sync.RWMutex
+	plans    map[string]models.SubscriptionPlan
+	loadedAt time.Time
+}
+
+// plans returns every plan row, retired ones and variants included, by id.
+func plans() map[string]models.SubscriptionPlan {
+	catalog.RLock()
+	if catalog.plans != nil && time.Since(catalog.loadedAt) < catalogTTL {
+		defer catalog.RUnlock()
+		return catalog.plans
+	}
+	catalog.RUnlock()
+
+	catalog.Lock()
+	defer catalog.Unlock()
+	if catalog.plans != nil && time.Since(catalog.loadedAt) < catalogTTL {
+		return catalog.plans
+	}
+
+	rows, err := fetchPlans()
+	switch {
+	case err != nil && catalog.plans != nil:
+		// Keep serving what we had and try again after the TTL
+		log.Printf("[Subscription] Failed to reload plans, keeping cached catalog: %v", err)
+	case err != nil || len(rows) == 0:
+		if err != nil {
+			log.Printf("[Subscription] Failed to load plans, using defaults: %v", err)
+		}
+		rows = defaultPlans
+		fallthrough
+	default:
+		catalog.plans = make(map[string]models.SubscriptionPlan, len(rows))
+		for _, p := range rows {
+			catalog.plans[p.Id] = p
+		}
+	}
+	catalog.loadedAt = time.Now()
+	return catalog.plans
+}
+
+func fetchPlans() ([]models.SubscriptionPlan, error) {
+	planORM := orm.Load(&models.SubscriptionPlan{})
+	defer planORM.Close()
+
+	var rows []models.SubscriptionPlan
+	if err := planORM.GetAll().Scan(&rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// InvalidateCatalog makes the next lookup reload plans from the database.
+func InvalidateCatalog() {
+	catalog.Lock()
+	defer catalog.Unlock()
+	catalog.plans = nil
+}
+
+// resolve fills in what a variant shares with its base plan: features, limits, and
+// name, description and position unless the variant sets its own.
+func resolve(all map[string]models.SubscriptionPlan, p models.SubscriptionPlan) *models.SubscriptionPlan {
+	if base, ok := all[p.BasePlanId]; ok {
+		p.Features = base.Features
+		p.Limits = base.Limits
+		p.SortOrder = base.SortOrder
+		if p.Name == "" {
+			p.Name = base.Name
+		}
+		if p.Description == "" {
+			p.Description = base.Description
+		}
+	}
+	return &p
+}
+
+// GetPlan returns a subscription plan by ID, retired ones included
+func GetPlan(planID string) (*models.SubscriptionPlan, error) {
+	all := plans()
+	p, ok := all[planID]
+	if !ok {
+		return nil, ErrUnknownPlan
+	}
+	return resolve(all, p), nil
+}
+
+// GetAllPlans returns the plans on sale, without variants, in display order
+func GetAllPlans() ([]models.SubscriptionPlan, error) {
+	all := plans()
+	var result []models.SubscriptionPlan
+	for _, p := range all {
+		if p.IsActive && p.BasePlanId == "" {
+			result = append(result, p)
+		}
+	}
+	sortPlans(result)
+	return result, nil
+}
+
+// AllPlans returns every plan, retired ones and variants included, in display order.
+func AllPlans() []models.SubscriptionPlan {
+	all := plans()
+	result := make([]models.SubscriptionPlan, 0, len(all))
+	for _, p := range all {
+		result = append(result, *resolve(all, p))
+	}
+	sortPlans(result)
+	return result
+}
+
+func sortPlans(ps []models.SubscriptionPlan) {
+	slices.SortFunc(ps, func(a, b models.SubscriptionPlan) int {
+		if a.SortOrder != b.SortOrder {
+			return a.SortOrder - b.SortOrder
+		}
+		// Base plans before their variants
+		if (a.BasePlanId == "") != (b.BasePlanId == "") {
+			if a.BasePlanId == "" {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Id, b.Id)
+	})
+}
+
+// PlanForUser returns the version of planID a user is offered: one of its active A/B
+// price variants, or the plan itself. Asking for a variant gives the user's own
+// assignment for its plan, so users can't pick a cheaper variant.
+func PlanForUser(userID, planID string) (*models.SubscriptionPlan, error) {
+	all := plans()
+	p, ok := all[planID]
+	if !ok {
+		return nil, ErrUnknownPlan
+	}
+	baseID := p.Id
+	if p.BasePlanId != "" {
+		baseID = p.BasePlanId
+	}
+	base, ok := all[baseID]
+	if !ok {
+		return resolve(all, p), nil
+	}
+
+	var variants []models.SubscriptionPlan
+	for _, v := range all {
+		if v.BasePlanId == baseID && v.IsActive && v.VariantWeight > 0 {
+			variants = append(variants, v)
+		}
+	}
+	slices.SortFunc(variants, func(a, b models.SubscriptionPlan) int { return strings.Compare(a.Id, b.Id) })
+
+	// The same user always lands in the same bucket for a plan
+	h := fnv.New32a()
+	h.Write([]byte(baseID + ":" + userID))
+	bucket := int(h.Sum32() % 100)
+	for _, v := range variants {
+		if bucket < v.VariantWeight {
+			return resolve(all, v), nil
+		}
+		bucket -= v.VariantWeight
+	}
+	return resolve(all, base), nil
+}
+
+// PlansForUser returns the plans on sale as offered to a user, with their A/B variants
+// applied.
+func PlansForUser(userID string) ([]models.SubscriptionPlan, error) {
+	bases, err := GetAllPlans()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.SubscriptionPlan, 0, len(bases))
+	for _, b := range bases {
+		p, err := PlanForUser(userID, b.Id)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *p)
+	}
+	return result, nil
+}
+
+// PlanInput is the editable part of a plan. Nil fields are left as they are.
+type PlanInput struct {
+	Name             *string
+	Description      *string
+	PriceMonthly     *int
+	PriceYearly      *int
+	Features         *models.SubscriptionFeatures
+	Limits           *models.SubscriptionLimits
+	ProductIds       *models.PlanProducts
+	RevcatOfferingId *string
+	SortOrder        *int
+	VariantWeight    *int
+	IsActive         *bool
+}
+
+func (in PlanInput) apply(p *models.SubscriptionPlan) {
+	if in.Name != nil {
+		p.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Description != nil {
+		p.Description = strings.TrimSpace(*in.Description)
+	}
+	if in.PriceMonthly != nil {
+		p.PriceMonthly = *in.PriceMonthly
+	}
+	if in.PriceYearly != nil {
+		p.PriceYearly = *in.PriceYearly
+	}
+	if in.Features != nil {
+		p.Features = *in.Features
+	}
+	if in.Limits != nil {
+		p.Limits = *in.Limits
+	}
+	if in.ProductIds != nil {
+		p.ProductIds = *in.ProductIds
+	}
+	if in.RevcatOfferingId != nil {
+		p.RevcatOfferingId = strings.TrimSpace(*in.RevcatOfferingId)
+	}
+	if in.SortOrder != nil {
+		p.SortOrder = *in.SortOrder
+	}
+	if in.VariantWeight != nil {
+		p.VariantWeight = *in.VariantWeight
+	}
+	if in.IsActive != nil {
+		p.IsActive = *in.IsActive
+	}
+}
+
+// CreatePlan adds a plan to the catalog. With a basePlanID it is an A/B price variant
+// of that plan, offered to VariantWeight percent of users in its place.
+func CreatePlan(planID, basePlanID string, in PlanInput) (*models.SubscriptionPlan, error) {
+	if !planIdPattern.MatchString(planID) {
+		return nil, ErrInvalidPlanId
+	}
+	if basePlanID != "" && (in.Features != nil || in.Limits != nil) {
+		return nil, ErrVariantOnlyEdit
+	}
+	if _, ok := rows()[planID]; ok {
+		return nil, ErrPlanExists
+	}
+
+	now := time.Now()
+	p := models.SubscriptionPlan{
+		Id:         planID,
+		BasePlanId: basePlanID,
+		IsActive:   true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	in.apply(&p)
+	if p.Name == "" && basePlanID == "" {
+		return nil, fmt.Errorf("a name is required")
+	}
+	if err := validatePlan(p); err != nil {
+		return nil, err
+	}
+
+	planORM := orm.Load(&models.SubscriptionPlan{})
+	defer planORM.Close()
+	if err := planORM.Insert(&p); err != nil {
+		return nil, fmt.Errorf("failed to create plan: %w", err)
+	}
+	InvalidateCatalog()
+	log.Printf("[Subscription] Created plan %s", planID)
+	return GetPlan(planID)
+}
+
+// UpdatePlan edits a plan. Existing subscribers keep what they paid; new prices apply
+// from their next renewal or purchase.
+func UpdatePlan(planID string, in PlanInput) (*models.SubscriptionPlan, error) {
+	p, ok := rows()[planID]
+	if !ok {
+		return nil, ErrUnknownPlan
+	}
+	if p.BasePlanId != "" && (in.Features != nil || in.Limits != nil) {
+		return nil, ErrVariantOnlyEdit
+	}
+	if planID == PlanFree && in.IsActive != nil && !*in.IsActive {
+		return nil, ErrRetireFreePlan
+	}
+	in.apply(&p)
+	if p.BasePlanId == "" && p.Name == "" {
+		return nil, fmt.Errorf("a name is required")
+	}
+	if err := validatePlan(p); err != nil {
+		return nil, err
+	}
+	return savePlan(p)
+}
+
+// RetirePlan takes a plan and its variants off sale. Subscribers keep it until their
+// subscription ends.
+func RetirePlan(planID string) (*models.SubscriptionPlan, error) {
+	if planID == PlanFree {
+		return nil, ErrRetireFreePlan
+	}
+	all := rows()
+	p, ok := all[planID]
+	if !ok {
+		return nil, ErrUnknownPlan
+	}
+	for _, v := range all {
+		if v.BasePlanId == planID && v.IsActive {
+			v.IsActive = false
+			if _, err := savePlan(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	p.IsActive = false
+	return savePlan(p)
+}
+
+// rows reads the catalog fresh from the database for edits, so they never start from a
+// stale copy. Until the first plan is stored, the defaults are the starting point.
+func rows() map[string]models.SubscriptionPlan {
+	InvalidateCatalog()
+	return plans()
+}
+
+func savePlan(p models.SubscriptionPlan) (*models.SubscriptionPlan, error) {
+	p.UpdatedAt = time.Now()
+	planORM := orm.Load(&models.SubscriptionPlan{})
+	defer planORM.Close()
+	if err := planORM.Update(&p, p.Id); err != nil {
+		return nil, fmt.Errorf("failed to update plan: %w", err)
+	}
+	InvalidateCatalog()
+	log.Printf("[Subscription] Updated plan %s", p.Id)
+	return GetPlan(p.Id)
+}
+
+// validatePlan checks p against the rest of the catalog.
+func validatePlan(p models.SubscriptionPlan) error {
+	if p.PriceMonthly < 0 || p.PriceYearly < 0 {
+		return ErrInvalidPrice
+	}
+	all := rows()
+
+	if p.BasePlanId != "" {
+		base, ok := all[p.BasePlanId]
+		if !ok || base.BasePlanId != "" || !base.IsActive || base.Id == PlanFree {
+			return ErrInvalidVariant
+		}
+		if p.VariantWeight < 1 || p.VariantWeight > 100 {
+			return ErrVariantWeight
+		}
+		total := 0
+		for _, v := range all {
+			if v.BasePlanId == p.BasePlanId && v.IsActive && v.Id != p.Id {
+				total += v.VariantWeight
+			}
+		}
+		if p.IsActive && total+p.VariantWeight > 100 {
+			return ErrVariantWeight
+		}
+	} else if p.VariantWeight != 0 {
+		return ErrVariantWeight
+	}
+
+	// A product id has to identify one plan so webhooks know what was bought
+	ids := productIds(p.ProductIds)
+	for _, other := range all {
+		if other.Id == p.Id {
+			continue
+		}
+		for _, id := range productIds(other.ProductIds) {
+			if slices.Contains(ids, id) {
+				return fmt.Errorf("%w: %s", ErrProductInUse, id)
+			}
+		}
+	}
+	return nil
+}
+
+// productIds lists a plan's product ids, prefixed with the provider that sells them.
+func productIds(p models.PlanProducts) []string {
+	var ids []string
+	for _, id := range []string{"dodo:" + p.DodoMonthly, "dodo:" + p.DodoYearly, "revcat:" + p.RevcatMonthly, "revcat:" + p.RevcatYearly} {
+		if !strings.HasSuffix(id, ":") {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,570 @@
+package subscriptions
+
+import (
+	"spark/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/orm"
+	"spark/internal/helpers/ormcompat"
+)
+
+// Billing periods
+const (
+	PeriodMonthly = "monthly"
+	PeriodYearly  = "yearly"
+)
+
+const (
+	// DefaultPause is how long a subscription stays paused when no resume date is given
+	DefaultPause = 30 * 24 * time.Hour
+	// MaxPause is the longest a subscription may be paused
+	MaxPause = 90 * 24 * time.Hour
+)
+
+var (
+	ErrNoSubscription  = errors.New("no active subscription found")
+	ErrNotPaused       = errors.New("subscription is not paused")
+	ErrUnknownPlan     = errors.New("unknown plan")
+	ErrSamePlan        = errors.New("already subscribed to this plan")
+	ErrStoreManaged    = errors.New("this subscription is managed by the app store; change it from your device")
+	ErrGranted         = errors.New("trials and granted subscriptions can't change plans; subscribe once they end")
+	ErrCancelling      = errors.New("subscription is set to cancel; reactivate it first")
+	ErrInvalidResume   = errors.New("resume date must be in the future and within 90 days")
+	ErrInvalidAmount   = errors.New("refund amount must be positive")
+	ErrNothingToRefund = errors.New("nothing left to refund on this subscription")
+	ErrRefundTooLarge  = errors.New("refund exceeds the amount paid for this subscription")
+	ErrAlreadyRecorded = errors.New("provider event already recorded")
+)
+
+// Proration is the cost of moving a subscription to another plan for the rest of its
+// current period. Amounts are in cents.
+type Proration struct {
+	PlanId         string
+	PreviousPlanId string
+	BillingPeriod  string
+	// Credit is the unused part of what was paid for the current plan
+	Credit int
+	// Charge is the price of the new plan for the rest of the period
+	Charge int
+	// AmountDue is Charge minus Credit; negative amounts are owed to the user
+	AmountDue int
+	PeriodEnd time.Time
+}
+
+// billingPeriod infers how a subscription is billed from the length of its period.
+func billingPeriod(start, end time.Time) string {
+	if end.Sub(start) > 60*24*time.Hour {
+		return PeriodYearly
+	}
+	return PeriodMonthly
+}
+
+// planPrice is a plan's price in cents for a billing period.
+func planPrice(planID, period string) int {
+	plan, err := GetPlan(planID)
+	if err != nil || plan == nil {
+		return 0
+	}
+	if period == PeriodYearly {
+		return plan.PriceYearly
+	}
+	return plan.PriceMonthly
+}
+
+func isPaidPlan(planID string) bool {
+	_, err := GetPlan(planID)
+	return err == nil && planID != PlanFree
+}
+
+// offeredPlan is the plan a user gets when they ask for planID: their A/B variant of
+// it, as long as it is on sale.
+func offeredPlan(userID, planID string) (string, error) {
+	plan, err := PlanForUser(userID, planID)
+	if err != nil {
+		return "", err
+	}
+	if !plan.IsActive || plan.Id == PlanFree {
+		return "", ErrUnknownPlan
+	}
+	return plan.Id, nil
+}
+
+// Prorate works out the cost of moving sub to planID at the given time.
+func Prorate(sub *models.UserSubscription, planID string, at time.Time) (*Proration, error) {
+	if !isPaidPlan(planID) {
+		return nil, ErrUnknownPlan
+	}
+	if sub.PlanId == planID {
+		return nil, ErrSamePlan
+	}
+
+	remaining := 0.0
+	if total := sub.CurrentPeriodEnd.Sub(sub.CurrentPeriodStart); total > 0 {
+		remaining = float64(sub.CurrentPeriodEnd.Sub(at)) / float64(total)
+		remaining = math.Max(0, math.Min(1, remaining))
+	}
+
+	p := &Proration{
+		PlanId:         planID,
+		PreviousPlanId: sub.PlanId,
+		BillingPeriod:  sub.BillingPeriod,
+		Credit:         int(math.Round(float64(sub.AmountPaid) * remaining)),
+		Charge:         int(math.Round(float64(planPrice(planID, sub.BillingPeriod)) * remaining)),
+		PeriodEnd:      sub.CurrentPeriodEnd,
+	}
+	p.AmountDue = p.Charge - p.Credit
+	return p, nil
+}
+
+// PreviewPlanChange prorates moving a user's active subscription to planID.
+func PreviewPlanChange(userID, planID string) (*Proration, error) {
+	_, p, err := CheckPlanChange(userID, planID)
+	return p, err
+}
+
+// CheckPlanChange checks that a user may move their active subscription to planID
+// and prorates the change. Subscriptions billed through the app stores are changed
+// from the device.
+func CheckPlanChange(userID, planID string) (*models.UserSubscription, *Proration, error) {
+	sub, err := GetUserSubscription(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sub == nil {
+		return nil, nil, ErrNoSubscription
+	}
+	if sub.Provider == "revcat" {
+		return nil, nil, ErrStoreManaged
+	}
+	// Trials and promo grants weren't paid for, so there is nothing to prorate against
+	if sub.Provider == "manual" {
+		return nil, nil, ErrGranted
+	}
+	if sub.CancelAtPeriodEnd {
+		return nil, nil, ErrCancelling
+	}
+	if planID, err = offeredPlan(userID, planID); err != nil {
+		return nil, nil, err
+	}
+	p, err := Prorate(sub, planID, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	return sub, p, nil
+}
+
+// ChangePlan moves a user's active subscription to planID for the rest of its period,
+// once the provider reports the change in the event providerEventID. Users ask for
+// changes through the payments package, which has the provider charge for them.
+func ChangePlan(userID, planID, providerEventID string) (*models.UserSubscription, *Proration, error) {
+	sub, err := GetUserSubscription(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sub == nil {
+		return nil, nil, ErrNoSubscription
+	}
+
+	now := time.Now()
+	p, err := Prorate(sub, planID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	direction := "upgrade"
+	if planPrice(planID, sub.BillingPeriod) < planPrice(sub.PlanId, sub.BillingPeriod) {
+		direction = "downgrade"
+	}
+	event := eventFor(sub, EventPlanChanged)
+	event.PlanId = planID
+	event.PreviousPlanId = sub.PlanId
+	event.Amount = p.AmountDue
+	event.ProviderEventId = providerEventID
+	event.Details = map[string]any{
+		"direction":  direction,
+		"credit":     p.Credit,
+		"charge":     p.Charge,
+		"period_end": p.PeriodEnd,
+	}
+	if recorded, err := recordEvent(event); err != nil {
+		return nil, nil, err
+	} else if !recorded {
+		return nil, nil, ErrAlreadyRecorded
+	}
+
+	sub.PlanId = planID
+	sub.AmountPaid = max(0, sub.AmountPaid+p.AmountDue)
+	sub.UpdatedAt = now
+	if err := orm.Load(&models.UserSubscription{}).Update(sub, sub.Id); err != nil {
+		return nil, nil, fmt.Errorf("failed to update subscription: %w", err)
+	}
+	setUserPlan(userID, planID)
+
+	log.Printf("[Subscription] User %s changed plan %s -> %s (%d cents due)", userID, p.PreviousPlanId, planID, p.AmountDue)
+	return sub, p, nil
+}
+
+// GetPausedSubscription returns a user's paused subscription, if any.
+func GetPausedSubscription(userID string) (*models.UserSubscription, error) {
+	subORM := orm.Load(&models.UserSubscription{})
+	subs, err := ormcompat.GetByFieldEqualsSlice[models.UserSubscription](subORM, "UserId", userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subs {
+		if sub.Status == "paused" {
+			return &sub, nil
+		}
+	}
+	return nil, nil
+}
+
+// Pause suspends a user's active subscription until resumeAt, or DefaultPause from now
+// when it is nil. The user drops to the free plan meanwhile, and the paused time is
+// added back to the period when it resumes.
+func Pause(userID string, resumeAt *time.Time, providerEventID string) (*models.UserSubscription, error) {
+	sub, err := GetUserSubscription(userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, ErrNoSubscription
+	}
+	if providerEventID == "" && sub.Provider == "revcat" {
+		return nil, ErrStoreManaged
+	}
+
+	now := time.Now()
+	until, err := PauseUntil(resumeAt)
+	if err != nil {
+		return nil, err
+	}
+
+	event := eventFor(sub, EventPaused)
+	event.ProviderEventId = providerEventID
+	event.Details = map[string]any{"resume_at": until}
+	if recorded, err := recordEvent(event); err != nil {
+		return nil, err
+	} else if !recorded {
+		return nil, ErrAlreadyRecorded
+	}
+
+	sub.Status = "paused"
+	sub.PausedAt = &now
+	sub.ResumeAt = &until
+	sub.UpdatedAt = now
+	if err := orm.Load(&models.UserSubscription{}).Update(sub, sub.Id); err != nil {
+		return nil, fmt.Errorf("failed to update subscription: %w", err)
+	}
+	setUserPlan(userID, PlanFree)
+
+	log.Printf("[Subscription] Paused %s subscription for user %s until %s", sub.PlanId, userID, until.Format(time.DateOnly))
+	return sub, nil
+}
+
+// PauseUntil returns when a pause asked to end at resumeAt ends: DefaultPause from now
+// when it is nil. Dates in the past or more than MaxPause away are refused.
+func PauseUntil(resumeAt *time.Time) (time.Time, error) {
+	now := time.Now()
+	until := now.Add(DefaultPause)
+	if resumeAt != nil {
+		until = *resumeAt
+	}
+	if !until.After(now) || until.Sub(now) > MaxPause {
+		return time.Time{}, ErrInvalidResume
+	}
+	return until, nil
+}
+
+// Resume reactivates a user's paused subscription now.
+func Resume(userID, providerEventID string) (*models.UserSubscription, error) {
+	sub, err := GetPausedSubscription(userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, ErrNotPaused
+	}
+	return resume(sub, providerEventID)
+}
+
+// resume reactivates sub, pushing its period end back by the time it spent paused.
+// The update only applies while sub is still paused, so concurrent resumes of the
+// same subscription resume it once.
+func resume(sub *models.UserSubscription, providerEventID string) (*models.UserSubscription, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	var periodEnd time.Time
+	err = db.QueryRow(`
+		UPDATE user_subscriptions
+		SET status = 'active', current_period_end = current_period_end + ($2 - COALESCE(paused_at, $2)),
+			paused_at = NULL, resume_at = NULL, updated_at = $2
+		WHERE id = $1 AND status = 'paused'
+		RETURNING current_period_end
+	`, sub.Id, now).Scan(&periodEnd)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotPaused
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to resume subscription: %w", err)
+	}
+
+	pausedFor := time.Duration(0)
+	if sub.PausedAt != nil {
+		pausedFor = now.Sub(*sub.PausedAt)
+	}
+	sub.Status = "active"
+	sub.CurrentPeriodEnd = periodEnd
+	sub.PausedAt = nil
+	sub.ResumeAt = nil
+	sub.UpdatedAt = now
+	setUserPlan(sub.UserId, sub.PlanId)
+
+	event := eventFor(sub, EventResumed)
+	event.ProviderEventId = providerEventID
+	event.Details = map[string]any{"paused_days": int(pausedFor.Hours() / 24), "period_end": periodEnd}
+	logEvent(event)
+
+	log.Printf("[Subscription] Resumed %s subscription for user %s", sub.PlanId, sub.UserId)
+	return sub, nil
+}
+
+var (
+	resumerMu sync.RWMutex
+	resumer   func(ctx context.Context, sub *models.UserSubscription) error
+)
+
+// SetProviderResumer sets how ResumeDue restarts billing at the payment provider before
+// a subscription is resumed. The payments package knows the providers.
+func SetProviderResumer(f func(ctx context.Context, sub *models.UserSubscription) error) {
+	resumerMu.Lock()
+	defer resumerMu.Unlock()
+	resumer = f
+}
+
+func resumeAtProvider(sub *models.UserSubscription) error {
+	resumerMu.RLock()
+	f := resumer
+	resumerMu.RUnlock()
+	if f == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return f(ctx, sub)
+}
+
+// ResumeDue resumes every paused subscription whose resume date has passed.
+func ResumeDue() (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	var ids []string
+	err = db.Select(&ids, `SELECT id FROM user_subscriptions WHERE status = 'paused' AND resume_at <= $1`, time.Now())
+	db.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to load paused subscriptions: %w", err)
+	}
+
+	subORM := orm.Load(&models.UserSubscription{})
+	resumed := 0
+	for _, id := range ids {
+		subs, err := ormcompat.GetByFieldEqualsSlice[models.UserSubscription](subORM, "Id", id)
+		if err != nil || len(subs) == 0 || subs[0].Status != "paused" {
+			continue
+		}
+		if err := resumeAtProvider(&subs[0]); err != nil {
+			log.Printf("[Subscription] Failed to resume %s at the provider: %v", id, err)
+			continue
+		}
+		if _, err := resume(&subs[0], ""); err != nil {
+			if !errors.Is(err, ErrNotPaused) {
+				log.Printf("[Subscription] Failed to resume %s: %v", id, err)
+			}
+			continue
+		}
+		resumed++
+	}
+	return resumed, nil
+}
+
+// RenewPeriod moves an active subscription's period end to periodEnd, for renewals
+// found when syncing with the provider.
+func RenewPeriod(subscriptionID string, periodEnd time.Time) error {
+	sub, err := GetSubscription(subscriptionID)
+	if err != nil {
+		return err
+	}
+	if sub.Status != "active" || !periodEnd.After(sub.CurrentPeriodEnd) {
+		return nil
+	}
+
+	now := time.Now()
+	sub.CurrentPeriodStart = sub.CurrentPeriodEnd
+	sub.CurrentPeriodEnd = periodEnd
+	sub.AmountPaid = planPrice(sub.PlanId, sub.BillingPeriod)
+	// A renewal settles any failed payment
+	sub.BillingIssueAt = nil
+	sub.GraceUntil = nil
+	sub.DunningReminders = 0
+	sub.LastDunningAt = nil
+	sub.UpdatedAt = now
+	if err := orm.Load(&models.UserSubscription{}).Update(sub, sub.Id); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	event := eventFor(sub, EventRenewed)
+	event.Amount = sub.AmountPaid
+	event.Details = map[string]any{"billing_period": sub.BillingPeriod, "period_end": periodEnd}
+	logEvent(event)
+	return nil
+}
+
+// GetSubscription returns a subscription by ID.
+func GetSubscription(subscriptionID string) (*models.UserSubscription, error) {
+	subORM := orm.Load(&models.UserSubscription{})
+	subs, err := ormcompat.GetByFieldEqualsSlice[models.UserSubscription](subORM, "Id", subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(subs) == 0 {
+		return nil, fmt.Errorf("subscription not found")
+	}
+	return &subs[0], nil
+}
+
+// GetSubscriptionByProviderID returns the subscription a provider knows by providerSubID.
+func GetSubscriptionByProviderID(provider, providerSubID string) (*models.UserSubscription, error) {
+	subORM := orm.Load(&models.UserSubscription{})
+	subs, err := ormcompat.GetByFieldEqualsSlice[models.UserSubscription](subORM, "ProviderSubscriptionId", providerSubID)
+	if err != nil {
+		return nil, err
+	}
+	var latest *models.UserSubscription
+	for i := range subs {
+		if subs[i].Provider == provider && (latest == nil || subs[i].CreatedAt.After(latest.CreatedAt)) {
+			latest = &subs[i]
+		}
+	}
+	return latest, nil
+}
+
+// RefundAmount resolves a refund of amount cents against a subscription before it is
+// sent to the provider: zero is what is left of the amount paid, and more than that
+// is refused.
+func RefundAmount(subscriptionID string, amount int) (*models.UserSubscription, int, error) {
+	sub, err := GetSubscription(subscriptionID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if amount < 0 {
+		return nil, 0, ErrInvalidAmount
+	}
+	refunded, err := refundedAmount(sub.Id)
+	if err != nil {
+		return nil, 0, err
+	}
+	left := max(0, sub.AmountPaid-refunded)
+	if amount == 0 {
+		amount = left
+	}
+	if left == 0 {
+		return nil, 0, ErrNothingToRefund
+	}
+	if amount > left {
+		return nil, 0, ErrRefundTooLarge
+	}
+	return sub, amount, nil
+}
+
+// Refund records a refund of amount cents against a subscription; zero refunds what is
+// left of the amount paid. A full refund, or revoke, ends the subscription at once.
+// Refunds made at a provider carry its refund id and are recorded once.
+func Refund(subscriptionID string, amount int, reason, actorID, providerEventID string, revoke bool) (*models.BillingEvent, error) {
+	sub, err := GetSubscription(subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	if amount < 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	refunded, err := refundedAmount(sub.Id)
+	if err != nil {
+		return nil, err
+	}
+	left := max(0, sub.AmountPaid-refunded)
+	if amount == 0 {
+		if left == 0 {
+			return nil, ErrNothingToRefund
+		}
+		amount = left
+	}
+	// Providers have already moved the money, so their amounts are recorded as reported
+	if providerEventID == "" && amount > left {
+		return nil, ErrRefundTooLarge
+	}
+	full := amount >= left
+
+	event := eventFor(sub, EventRefund)
+	event.Amount = -amount
+	event.ActorId = actorID
+	event.Reason = reason
+	event.ProviderEventId = providerEventID
+	event.Details = map[string]any{"revoke_access": revoke || full, "amount_paid": sub.AmountPaid}
+	if recorded, err := recordEvent(event); err != nil {
+		return nil, err
+	} else if !recorded {
+		return nil, ErrAlreadyRecorded
+	}
+
+	if revoke || full {
+		if err := endRefunded(sub); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("[Subscription] Refunded %d cents of subscription %s for user %s", amount, sub.Id, sub.UserId)
+	return &event, nil
+}
+
+// RevokeRefunded ends a refunded subscription's access now, for refunds recorded
+// before staff asked to revoke access.
+func RevokeRefunded(subscriptionID string) error {
+	sub, err := GetSubscription(subscriptionID)
+	if err != nil {
+		return err
+	}
+	return endRefunded(sub)
+}
+
+func endRefunded(sub *models.UserSubscription) error {
+	if sub.Status != "active" && sub.Status != "paused" {
+		return nil
+	}
+	now := time.Now()
+	sub.Status = "refunded"
+	sub.CancelledAt = &now
+	sub.UpdatedAt = now
+	if err := orm.Load(&models.UserSubscription{}).Update(sub, sub.Id); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+	if current, _ := GetUserSubscription(sub.UserId); current == nil {
+		setUserPlan(sub.UserId, PlanFree)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package subscriptions
+
+import (
+	"spark/internal/models"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+)
+
+// Limits a credit can raise
+const (
+	LimitSwipes     = "swipes_per_day"
+	LimitAiReplies  = "ai_replies_per_day"
+	LimitSuperlikes = "superlikes_per_day"
+	LimitBoosts     = "boosts_per_month"
+)
+
+// Where credits come from
+const (
+	CreditReferral = "referral"
+	CreditPromo    = "promo"
+)
+
+var ErrInvalidCredit = errors.New("credits need a known limit, a positive amount and duration")
+
+// GrantCredit raises userID's limit by amount for the next days. Each source grants a
+// limit once, so granting it again reports false.
+func GrantCredit(userID, limit string, amount, days int, source, sourceID string) (bool, error) {
+	switch limit {
+	case LimitSwipes, LimitAiReplies, LimitSuperlikes, LimitBoosts:
+	default:
+		return false, ErrInvalidCredit
+	}
+	if amount <= 0 || days <= 0 {
+		return false, ErrInvalidCredit
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	res, err := db.Exec(`
+		INSERT INTO credit_ledger (id, user_id, limit_name, amount, source, source_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT DO NOTHING
+	`, utils.GenerateID(), userID, limit, amount, source, sourceID, now.AddDate(0, 0, days), now)
+	if err != nil {
+		return false, fmt.Errorf("failed to grant credit: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ActiveCredits returns a user's credits that haven't expired, soonest to expire first.
+func ActiveCredits(userID string) ([]*models.Credit, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT id, user_id, limit_name, amount, source, source_id, expires_at, created_at
+		FROM credit_ledger
+		WHERE user_id = $1 AND expires_at > $2
+		ORDER BY expires_at, id
+	`, userID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query credits: %w", err)
+	}
+	defer rows.Close()
+
+	var credits []*models.Credit
+	for rows.Next() {
+		var c models.Credit
+		if err := rows.Scan(&c.Id, &c.UserId, &c.LimitName, &c.Amount, &c.Source, &c.SourceId, &c.ExpiresAt, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan credit: %w", err)
+		}
+		credits = append(credits, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("credits iteration error: %w", err)
+	}
+	return credits, nil
+}
+
+// withCredits adds a user's active credits on top of their plan limits. Unlimited
+// limits stay unlimited.
+func withCredits(userID string, limits models.SubscriptionLimits) models.SubscriptionLimits {
+	credits, err := ActiveCredits(userID)
+	if err != nil {
+		log.Printf("[Subscription] Failed to load credits for user %s: %v", userID, err)
+		return limits
+	}
+	for _, c := range credits {
+		switch c.LimitName {
+		case LimitSwipes:
+			addCredit(&limits.SwipesPerDay, c.Amount)
+		case LimitAiReplies:
+			addCredit(&limits.AiRepliesPerDay, c.Amount)
+		case LimitSuperlikes:
+			addCredit(&limits.SuperlikesPerDay, c.Amount)
+		case LimitBoosts:
+			addCredit(&limits.BoostsPerMonth, c.Amount)
+		}
+	}
+	return limits
+}
+
+func addCredit(limit *int, amount int) {
+	if *limit != -1 {
+		*limit += amount
+	}
+}
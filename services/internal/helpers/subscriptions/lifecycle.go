@@ -0,0 +1,369 @@
+package subscriptions
+
+import (
+	"spark/internal/anal"
+	"spark/internal/helpers/pushnotify"
+	"spark/internal/helpers/users"
+	"spark/internal/i18n"
+	"spark/internal/mailer"
+	"spark/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/MelloB1989/karma/config"
+	"github.com/MelloB1989/karma/database"
+)
+
+// EventBillingIssue is recorded when a renewal payment fails and the grace period starts.
+const EventBillingIssue = "subscription.billing_issue"
+
+// Why a subscription expired
+const (
+	ExpiryCancelled  = "cancelled"
+	ExpiryGraceEnded = "grace_ended"
+	ExpiryLapsed     = "lapsed"
+	ExpiryGrantEnded = "grant_ended"
+)
+
+const (
+	// DefaultGracePeriod is how long access continues after a failed renewal when
+	// SUBSCRIPTION_GRACE_DAYS isn't set
+	DefaultGracePeriod = 7 * 24 * time.Hour
+	// RenewalReminderLead is how long before renewal subscribers are reminded
+	RenewalReminderLead = 3 * 24 * time.Hour
+	// DunningInterval is the time between reminders to fix a failed payment
+	DunningInterval = 48 * time.Hour
+	// MaxDunningReminders is how many of those reminders a billing issue gets, the
+	// first one included
+	MaxDunningReminders = 3
+	// renewalLeeway is how long a renewing subscription stays active past its period
+	// end while the provider's renewal webhook is on its way
+	renewalLeeway = 24 * time.Hour
+	// lifecycleInterval is how often the worker looks for due subscriptions
+	lifecycleInterval = time.Hour
+)
+
+// GracePeriod is how long access continues after a failed renewal while the provider
+// retries the payment.
+func GracePeriod() time.Duration {
+	if days, err := strconv.Atoi(config.GetEnvRaw("SUBSCRIPTION_GRACE_DAYS")); err == nil && days >= 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return DefaultGracePeriod
+}
+
+// MarkBillingIssue starts the grace period for a user's active subscription after its
+// renewal payment failed, and lets them know. Repeated failures during the same
+// grace period don't extend it.
+func MarkBillingIssue(userID, providerEventID string) (*models.UserSubscription, error) {
+	sub, err := GetUserSubscription(userID)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, ErrNoSubscription
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	graceUntil := sub.CurrentPeriodEnd
+	if graceUntil.Before(now) {
+		graceUntil = now
+	}
+	graceUntil = graceUntil.Add(GracePeriod())
+
+	// The first failure also counts as the first dunning reminder, sent right away
+	var issueAt, grace time.Time
+	var first bool
+	err = db.QueryRow(`
+		WITH prev AS (SELECT id, billing_issue_at FROM user_subscriptions WHERE id = $1 FOR UPDATE)
+		UPDATE user_subscriptions s
+		SET billing_issue_at = COALESCE(s.billing_issue_at, $2),
+			grace_until = COALESCE(s.grace_until, $3),
+			dunning_reminders = CASE WHEN s.billing_issue_at IS NULL THEN 1 ELSE s.dunning_reminders END,
+			last_dunning_at = CASE WHEN s.billing_issue_at IS NULL THEN $2 ELSE s.last_dunning_at END,
+			updated_at = $2
+		FROM prev
+		WHERE s.id = prev.id AND s.status = 'active'
+		RETURNING s.billing_issue_at, s.grace_until, prev.billing_issue_at IS NULL
+	`, sub.Id, now, graceUntil).Scan(&issueAt, &grace, &first)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoSubscription
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark billing issue: %w", err)
+	}
+	sub.BillingIssueAt = &issueAt
+	sub.GraceUntil = &grace
+	if !first {
+		return sub, nil
+	}
+	sub.DunningReminders = 1
+	sub.LastDunningAt = &now
+
+	event := eventFor(sub, EventBillingIssue)
+	event.ProviderEventId = providerEventID
+	event.Details = map[string]any{"grace_until": grace}
+	logEvent(event)
+
+	remindDunning(sub)
+	log.Printf("[Subscription] Billing issue for user %s, access kept until %s", sub.UserId, grace.Format(time.RFC3339))
+	return sub, nil
+}
+
+// ExpireLapsed expires every active subscription whose access has run out: cancelled
+// ones and staff grants at period end, failed renewals once the grace period is over,
+// and renewing ones the provider never renewed. Users drop back to the free plan.
+func ExpireLapsed() (int, error) {
+	now := time.Now()
+	subs, err := claimSubscriptions(`
+		UPDATE user_subscriptions SET status = 'expired', updated_at = $1
+		WHERE status = 'active' AND current_period_end <= $1 AND (
+			cancel_at_period_end OR provider = 'manual'
+			OR grace_until <= $1
+			OR (grace_until IS NULL AND current_period_end <= $2)
+		)
+		RETURNING id
+	`, now, now.Add(-renewalLeeway))
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire subscriptions: %w", err)
+	}
+
+	for _, sub := range subs {
+		reason := expiryReason(sub)
+		setUserPlan(sub.UserId, GetUserPlanID(sub.UserId))
+
+		event := eventFor(sub, EventExpired)
+		event.Reason = reason
+		event.Details = map[string]any{"period_end": sub.CurrentPeriodEnd}
+		logEvent(event)
+
+		planName := planName(sub.PlanId)
+		notifySubscriber(sub, func(email, locale string) *mailer.Template {
+			return mailer.SubscriptionExpired(email, locale, planName)
+		}, func(locale string) pushnotify.PushNotification {
+			return pushnotify.PushNotification{
+				Title: i18n.T(locale, "push.subscription_expired.title", "plan", planName),
+				Body:  i18n.T(locale, "push.subscription_expired.body"),
+			}
+		})
+		track(sub, anal.SUBSCRIPTION_EXPIRED, map[anal.Properties]any{anal.EXPIRY_REASON: reason})
+	}
+	return len(subs), nil
+}
+
+func expiryReason(sub *models.UserSubscription) string {
+	switch {
+	case sub.CancelAtPeriodEnd:
+		return ExpiryCancelled
+	case sub.Provider == "manual":
+		return ExpiryGrantEnded
+	case sub.GraceUntil != nil:
+		return ExpiryGraceEnded
+	}
+	return ExpiryLapsed
+}
+
+// RemindRenewals reminds subscribers whose plan renews within RenewalReminderLead.
+// Each period is reminded about once.
+func RemindRenewals() (int, error) {
+	now := time.Now()
+	subs, err := claimSubscriptions(`
+		UPDATE user_subscriptions SET renewal_reminded_for = current_period_end, updated_at = $1
+		WHERE status = 'active' AND NOT cancel_at_period_end AND provider <> 'manual'
+			AND billing_issue_at IS NULL
+			AND current_period_end > $1 AND current_period_end <= $2
+			AND renewal_reminded_for IS DISTINCT FROM current_period_end
+		RETURNING id
+	`, now, now.Add(RenewalReminderLead))
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim renewal reminders: %w", err)
+	}
+
+	sent := 0
+	for _, sub := range subs {
+		amount := planPrice(sub.PlanId, sub.BillingPeriod)
+		if amount == 0 {
+			continue
+		}
+		planName, price, renewsAt := planName(sub.PlanId), formatPrice(amount, sub.Currency), sub.CurrentPeriodEnd
+		notifySubscriber(sub, func(email, locale string) *mailer.Template {
+			return mailer.RenewalReminder(email, locale, planName, price, renewsAt)
+		}, func(locale string) pushnotify.PushNotification {
+			return pushnotify.PushNotification{
+				Title: i18n.T(locale, "push.renewal_reminder.title", "plan", planName),
+				Body:  i18n.T(locale, "push.renewal_reminder.body", "date", i18n.FormatDayMonth(locale, renewsAt), "price", price),
+			}
+		})
+		track(sub, anal.SUBSCRIPTION_RENEWAL_REMINDER, map[anal.Properties]any{anal.PERIOD_END: renewsAt})
+		sent++
+	}
+	return sent, nil
+}
+
+// RemindDunning reminds subscribers in a grace period to fix their payment, every
+// DunningInterval up to MaxDunningReminders times.
+func RemindDunning() (int, error) {
+	now := time.Now()
+	subs, err := claimSubscriptions(`
+		UPDATE user_subscriptions
+		SET dunning_reminders = dunning_reminders + 1, last_dunning_at = $1, updated_at = $1
+		WHERE status = 'active' AND billing_issue_at IS NOT NULL AND grace_until > $1
+			AND dunning_reminders < $2 AND (last_dunning_at IS NULL OR last_dunning_at <= $3)
+		RETURNING id
+	`, now, MaxDunningReminders, now.Add(-DunningInterval))
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim dunning reminders: %w", err)
+	}
+	for _, sub := range subs {
+		remindDunning(sub)
+	}
+	return len(subs), nil
+}
+
+func remindDunning(sub *models.UserSubscription) {
+	if sub.GraceUntil == nil {
+		return
+	}
+	planName, graceUntil := planName(sub.PlanId), *sub.GraceUntil
+	notifySubscriber(sub, func(email, locale string) *mailer.Template {
+		return mailer.PaymentFailed(email, locale, planName, graceUntil)
+	}, func(locale string) pushnotify.PushNotification {
+		return pushnotify.PushNotification{
+			Title: i18n.T(locale, "push.payment_failed.title"),
+			Body:  i18n.T(locale, "push.payment_failed.body", "date", i18n.FormatDayMonth(locale, graceUntil), "plan", planName),
+		}
+	})
+
+	event := anal.SUBSCRIPTION_DUNNING_REMINDER
+	if sub.DunningReminders <= 1 {
+		event = anal.SUBSCRIPTION_BILLING_ISSUE
+	}
+	track(sub, event, map[anal.Properties]any{anal.REMINDER_NUMBER: sub.DunningReminders})
+}
+
+// claimSubscriptions runs an UPDATE ... RETURNING id and loads the subscriptions it
+// changed. The conditions in the update decide which replica gets each subscription,
+// so only one of them acts on it.
+func claimSubscriptions(query string, args ...any) ([]*models.UserSubscription, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	var ids []string
+	err = db.Select(&ids, query, args...)
+	db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	subs := make([]*models.UserSubscription, 0, len(ids))
+	for _, id := range ids {
+		sub, err := GetSubscription(id)
+		if err != nil {
+			log.Printf("[Subscription] Failed to load %s: %v", id, err)
+			continue
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// notifySubscriber emails and pushes a subscriber in the background, in their locale.
+func notifySubscriber(sub *models.UserSubscription, email func(to, locale string) *mailer.Template, push func(locale string) pushnotify.PushNotification) {
+	go func() {
+		locale := i18n.DefaultLocale
+		if user, err := users.GetUserByID(sub.UserId); err != nil {
+			log.Printf("[Subscription] Failed to load user %s: %v", sub.UserId, err)
+		} else {
+			locale = users.LocaleOf(user)
+			if user.Email != "" {
+				if err := email(user.Email, locale).Send(); err != nil {
+					log.Printf("[Subscription] Failed to email %s: %v", user.Email, err)
+				}
+			}
+		}
+		n := push(locale)
+		n.Data = map[string]interface{}{
+			"type":            "subscription",
+			"subscription_id": sub.Id,
+		}
+		if err := pushnotify.SendToUser(sub.UserId, n); err != nil {
+			log.Printf("[Subscription] Failed to push to user %s: %v", sub.UserId, err)
+		}
+	}()
+}
+
+// track sends a subscription lifecycle event to analytics.
+func track(sub *models.UserSubscription, event anal.Events, props map[anal.Properties]any) {
+	go func() {
+		ae := anal.CreateAnalytics(sub.UserId)
+		ae.SetProperty(anal.USER_ID, sub.UserId)
+		ae.SetProperty(anal.USER_PLAN, sub.PlanId)
+		ae.SetProperty(anal.SUBSCRIPTION_ID, sub.Id)
+		ae.SetProperty(anal.PROVIDER, sub.Provider)
+		for k, v := range props {
+			ae.SetProperty(k, v)
+		}
+		ae.SendEvent(event)
+	}()
+}
+
+func planName(planID string) string {
+	if plan, err := GetPlan(planID); err == nil && plan != nil && plan.Name != "" {
+		return plan.Name
+	}
+	return planID
+}
+
+func formatPrice(cents int, currency string) string {
+	if currency == "" || currency == "USD" {
+		return fmt.Sprintf("$%d.%02d", cents/100, cents%100)
+	}
+	return fmt.Sprintf("%d.%02d %s", cents/100, cents%100, currency)
+}
+
+// Run keeps subscriptions moving through their lifecycle until ctx is cancelled:
+// paused ones resume, lapsed ones expire, and renewal and dunning reminders go out.
+// It is safe to run on every replica; each subscription is claimed by one of them.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(lifecycleInterval)
+	defer ticker.Stop()
+	for {
+		runLifecycle()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func runLifecycle() {
+	steps := []struct {
+		name string
+		run  func() (int, error)
+	}{
+		{"resumed", ResumeDue},
+		{"expired", ExpireLapsed},
+		{"reminded of renewal", RemindRenewals},
+		{"reminded of failed payment", RemindDunning},
+	}
+	for _, step := range steps {
+		if n, err := step.run(); err != nil {
+			log.Printf("[Subscription] Lifecycle step failed: %v", err)
+		} else if n > 0 {
+			log.Printf("[Subscription] %d subscriptions %s", n, step.name)
+		}
+	}
+}
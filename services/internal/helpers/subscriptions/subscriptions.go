@@ -19,109 +19,6 @@ const (
 	PlanElite = "elite"
 )
 
-// Default limits per plan
-var PlanLimits = map[string]models.SubscriptionLimits{
-	PlanFree: {
-		SwipesPerDay:     10,
-		AiRepliesPerDay:  0,
-		SuperlikesPerDay: 1,
-		BoostsPerMonth:   0,
-	},
-	PlanPlus: {
-		SwipesPerDay:     -1, // unlimited
-		AiRepliesPerDay:  5,
-		SuperlikesPerDay: 5,
-		BoostsPerMonth:   1,
-	},
-	PlanPro: {
-		SwipesPerDay:     -1,
-		AiRepliesPerDay:  -1,
-		SuperlikesPerDay: 10,
-		BoostsPerMonth:   3,
-	},
-	PlanElite: {
-		SwipesPerDay:     -1,
-		AiRepliesPerDay:  -1,
-		SuperlikesPerDay: -1,
-		BoostsPerMonth:   10,
-	},
-}
-
-// Default features per plan
-var PlanFeatures = map[string]models.SubscriptionFeatures{
-	PlanFree: {
-		SeeWhoLiked:      false,
-		PriorityMatching: false,
-		ProfileBoost:     false,
-		AdvancedFilters:  false,
-		VerifiedPriority: false,
-		UnlimitedRewinds: false,
-		ReadReceipts:     false,
-		IncognitoMode:    false,
-	},
-	PlanPlus: {
-		SeeWhoLiked:      true,
-		PriorityMatching: false,
-		ProfileBoost:     false,
-		AdvancedFilters:  false,
-		VerifiedPriority: false,
-		UnlimitedRewinds: true,
-		ReadReceipts:     true,
-		IncognitoMode:    false,
-	},
-	PlanPro: {
-		SeeWhoLiked:      true,
-		PriorityMatching: true,
-		ProfileBoost:     false,
-		AdvancedFilters:  true,
-		VerifiedPriority: false,
-		UnlimitedRewinds: true,
-		ReadReceipts:     true,
-		IncognitoMode:    true,
-	},
-	PlanElite: {
-		SeeWhoLiked:      true,
-		PriorityMatching: true,
-		ProfileBoost:     true,
-		AdvancedFilters:  true,
-		VerifiedPriority: true,
-		UnlimitedRewinds: true,
-		ReadReceipts:     true,
-		IncognitoMode:    true,
-	},
-}
-
-// GetAllPlans returns all available subscription plans
-func GetAllPlans() ([]models.SubscriptionPlan, error) {
-	planORM := orm.Load(&models.SubscriptionPlan{})
-	plans, err := ormcompat.GetByFieldEqualsSlice[models.SubscriptionPlan](planORM, "IsActive", true)
-	if err != nil {
-		return nil, err
-	}
-	return plans, nil
-}
-
-// GetPlan returns a subscription plan by ID
-func GetPlan(planID string) (*models.SubscriptionPlan, error) {
-	planORM := orm.Load(&models.SubscriptionPlan{})
-	plans, err := ormcompat.GetByFieldEqualsSlice[models.SubscriptionPlan](planORM, "Id", planID)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(plans) == 0 {
-		// Return default plan limits/features if plan not in DB
-		return &models.SubscriptionPlan{
-			Id:       planID,
-			Name:     planID,
-			Limits:   PlanLimits[planID],
-			Features: PlanFeatures[planID],
-		}, nil
-	}
-
-	return &plans[0], nil
-}
-
 // GetUserSubscription returns the active subscription for a user
 func GetUserSubscription(userID string) (*models.UserSubscription, error) {
 	subORM := orm.Load(&models.UserSubscription{})
@@ -130,10 +27,10 @@ func GetUserSubscription(userID string) (*models.UserSubscription, error) {
 		return nil, err
 	}
 
-	// Find active subscription
+	// Find active subscription, including one kept on during a billing grace period
 	now := time.Now()
 	for _, sub := range subs {
-		if sub.Status == "active" && sub.CurrentPeriodEnd.After(now) {
+		if sub.Status == "active" && (sub.CurrentPeriodEnd.After(now) || sub.GraceUntil != nil && sub.GraceUntil.After(now)) {
 			return &sub, nil
 		}
 	}
@@ -150,22 +47,27 @@ func GetUserPlanID(userID string) string {
 	return sub.PlanId
 }
 
-// GetUserLimits returns the subscription limits for a user
-func GetUserLimits(userID string) models.SubscriptionLimits {
-	planID := GetUserPlanID(userID)
-	if limits, ok := PlanLimits[planID]; ok {
-		return limits
+// GetUserPlan returns the plan a user is on, or the free plan.
+func GetUserPlan(userID string) *models.SubscriptionPlan {
+	if plan, err := GetPlan(GetUserPlanID(userID)); err == nil {
+		return plan
+	}
+	if plan, err := GetPlan(PlanFree); err == nil {
+		return plan
 	}
-	return PlanLimits[PlanFree]
+	free := defaultPlans[0]
+	return &free
+}
+
+// GetUserLimits returns the subscription limits for a user, including any credits
+// from promotions and referrals
+func GetUserLimits(userID string) models.SubscriptionLimits {
+	return withCredits(userID, GetUserPlan(userID).Limits)
 }
 
 // GetUserFeatures returns the subscription features for a user
 func GetUserFeatures(userID string) models.SubscriptionFeatures {
-	planID := GetUserPlanID(userID)
-	if features, ok := PlanFeatures[planID]; ok {
-		return features
-	}
-	return PlanFeatures[PlanFree]
+	return GetUserPlan(userID).Features
 }
 
 // HasFeature checks if a user has access to a specific feature
@@ -305,9 +207,13 @@ func IncrementAIUsage(userID string) error {
 func CreateSubscription(userID, planID, provider, providerSubID, providerCustID string, periodStart, periodEnd time.Time) (*models.UserSubscription, error) {
 	subORM := orm.Load(&models.UserSubscription{})
 	existing, _ := ormcompat.GetByFieldEqualsSlice[models.UserSubscription](subORM, "UserId", userID)
+	eventType := EventCreated
 	if len(existing) > 0 {
 		for _, sub := range existing {
-			if sub.Status == "active" {
+			if sub.Status == "active" || sub.Status == "paused" {
+				if sub.Status == "active" && sub.PlanId == planID && sub.Provider == provider {
+					eventType = EventRenewed
+				}
 				sub.Status = "cancelled"
 				now := time.Now()
 				sub.CancelledAt = &now
@@ -318,6 +224,7 @@ func CreateSubscription(userID, planID, provider, providerSubID, providerCustID
 	}
 
 	// Create new subscription
+	period := billingPeriod(periodStart, periodEnd)
 	subscription := &models.UserSubscription{
 		Id:                     utils.GenerateID(),
 		UserId:                 userID,
@@ -329,22 +236,27 @@ func CreateSubscription(userID, planID, provider, providerSubID, providerCustID
 		CurrentPeriodStart:     periodStart,
 		CurrentPeriodEnd:       periodEnd,
 		CancelAtPeriodEnd:      false,
+		BillingPeriod:          period,
+		AmountPaid:             planPrice(planID, period),
+		Currency:               "USD",
 		CreatedAt:              time.Now(),
 		UpdatedAt:              time.Now(),
 	}
+	if provider == "manual" {
+		// Granted by staff, nothing was paid
+		subscription.AmountPaid = 0
+	}
 
 	if err := subORM.Insert(subscription); err != nil {
 		return nil, err
 	}
 
-	// Update user's plan
-	userORM := orm.Load(&models.User{})
-	users, _ := ormcompat.GetByFieldEqualsSlice[models.User](userORM, "Id", userID)
-	if len(users) > 0 {
-		users[0].SubscriptionPlanId = planID
-		users[0].UpdatedAt = time.Now()
-		userORM.Update(&users[0], users[0].Id)
-	}
+	setUserPlan(userID, planID)
+
+	event := eventFor(subscription, eventType)
+	event.Amount = subscription.AmountPaid
+	event.Details = map[string]any{"billing_period": period, "period_end": periodEnd}
+	logEvent(event)
 
 	log.Printf("[Subscription] Created %s subscription for user %s", planID, userID)
 	return subscription, nil
@@ -364,7 +276,11 @@ func CancelSubscription(userID string) error {
 	sub.CancelAtPeriodEnd = true
 	sub.UpdatedAt = time.Now()
 
-	return subORM.Update(sub, sub.Id)
+	if err := subORM.Update(sub, sub.Id); err != nil {
+		return err
+	}
+	logEvent(eventFor(sub, EventCancelled))
+	return nil
 }
 
 // ReactivateSubscription removes the cancel at period end flag
@@ -381,7 +297,11 @@ func ReactivateSubscription(userID string) error {
 	sub.CancelAtPeriodEnd = false
 	sub.UpdatedAt = time.Now()
 
-	return subORM.Update(sub, sub.Id)
+	if err := subORM.Update(sub, sub.Id); err != nil {
+		return err
+	}
+	logEvent(eventFor(sub, EventReactivated))
+	return nil
 }
 
 // ExpireSubscription marks a subscription as expired
@@ -399,83 +319,29 @@ func ExpireSubscription(subscriptionID string) error {
 	subs[0].UpdatedAt = time.Now()
 
 	// Update user's plan back to free
+	setUserPlan(subs[0].UserId, PlanFree)
+
+	if err := subORM.Update(&subs[0], subs[0].Id); err != nil {
+		return err
+	}
+	logEvent(eventFor(&subs[0], EventExpired))
+	return nil
+}
+
+// setUserPlan mirrors a user's current plan onto their profile.
+func setUserPlan(userID, planID string) {
 	userORM := orm.Load(&models.User{})
-	users, _ := ormcompat.GetByFieldEqualsSlice[models.User](userORM, "Id", subs[0].UserId)
+	users, _ := ormcompat.GetByFieldEqualsSlice[models.User](userORM, "Id", userID)
 	if len(users) > 0 {
-		users[0].SubscriptionPlanId = PlanFree
+		users[0].SubscriptionPlanId = planID
 		users[0].UpdatedAt = time.Now()
 		userORM.Update(&users[0], users[0].Id)
 	}
-
-	return subORM.Update(&subs[0], subs[0].Id)
 }
 
-// SeedDefaultPlans creates the default subscription plans in the database
-func SeedDefaultPlans() error {
-	planORM := orm.Load(&models.SubscriptionPlan{})
-	plans := []models.SubscriptionPlan{
-		{
-			Id:           PlanFree,
-			Name:         "Free",
-			Description:  "Get started with basic features",
-			PriceMonthly: 0,
-			PriceYearly:  0,
-			Features:     PlanFeatures[PlanFree],
-			Limits:       PlanLimits[PlanFree],
-			IsActive:     true,
-			SortOrder:    0,
-			CreatedAt:    time.Now(),
-		},
-		{
-			Id:           PlanPlus,
-			Name:         "Plus",
-			Description:  "See who liked you and more",
-			PriceMonthly: 999,  // $9.99
-			PriceYearly:  7999, // $79.99
-			Features:     PlanFeatures[PlanPlus],
-			Limits:       PlanLimits[PlanPlus],
-			IsActive:     true,
-			SortOrder:    1,
-			CreatedAt:    time.Now(),
-		},
-		{
-			Id:           PlanPro,
-			Name:         "Pro",
-			Description:  "Priority matching and unlimited AI",
-			PriceMonthly: 1999,  // $19.99
-			PriceYearly:  15999, // $159.99
-			Features:     PlanFeatures[PlanPro],
-			Limits:       PlanLimits[PlanPro],
-			IsActive:     true,
-			SortOrder:    2,
-			CreatedAt:    time.Now(),
-		},
-		{
-			Id:           PlanElite,
-			Name:         "Elite",
-			Description:  "All features unlocked",
-			PriceMonthly: 2999,  // $29.99
-			PriceYearly:  23999, // $239.99
-			Features:     PlanFeatures[PlanElite],
-			Limits:       PlanLimits[PlanElite],
-			IsActive:     true,
-			SortOrder:    3,
-			CreatedAt:    time.Now(),
-		},
-	}
-
-	for _, plan := range plans {
-		// Check if exists
-		existing, _ := ormcompat.GetByFieldEqualsSlice[models.SubscriptionPlan](planORM, "Id", plan.Id)
-		if len(existing) > 0 {
-			continue // Already exists
-		}
-		if err := planORM.Insert(&plan); err != nil {
-			log.Printf("[Subscription] Failed to seed plan %s: %v", plan.Id, err)
-		} else {
-			log.Printf("[Subscription] Seeded plan %s", plan.Id)
-		}
+// logEvent records a billing event the caller can't act on failing to record.
+func logEvent(e models.BillingEvent) {
+	if _, err := recordEvent(e); err != nil {
+		log.Printf("[Subscription] Failed to record %s for user %s: %v", e.Type, e.UserId, err)
 	}
-
-	return nil
 }
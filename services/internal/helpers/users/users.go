@@ -2,8 +2,11 @@ package users
 
 import (
 	"spark/internal/graph/model"
+	"spark/internal/i18n"
 	"spark/internal/models"
+	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/MelloB1989/karma/config"
@@ -16,6 +19,9 @@ func CreateUser(user models.User) (*models.User, error) {
 	if user.Id == "" {
 		user.Id = utils.GenerateID(7)
 	}
+	if user.PreferredLocale == "" {
+		user.PreferredLocale = i18n.DefaultLocale
+	}
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 
@@ -66,6 +72,21 @@ func GetUserById(id string) (*models.User, error) {
 	return &user, nil
 }
 
+// LocaleOf returns the supported locale user's emails and pushes are written in
+func LocaleOf(user *models.User) string {
+	return i18n.Normalize(user.PreferredLocale)
+}
+
+// Locale looks up the locale to write to userID in, falling back to English when the
+// user can't be loaded
+func Locale(userID string) string {
+	user, err := GetUserById(userID)
+	if err != nil {
+		return i18n.DefaultLocale
+	}
+	return LocaleOf(user)
+}
+
 // GetUserByID is an alias for GetUserById
 func GetUserByID(id string) (*models.User, error) {
 	return GetUserById(id)
@@ -108,6 +129,14 @@ func GetUserPublicById(id string, queryUser ...string) (*model.UserPublic, error
 	}
 	user := u[0]
 
+	// Banned, suspended and shadow banned users stay visible only to themselves
+	if len(queryUser) > 0 && queryUser[0] != "" && queryUser[0] != id {
+		suspended := user.SuspendedUntil != nil && user.SuspendedUntil.After(time.Now())
+		if user.IsBanned || user.IsShadowBanned || suspended {
+			return nil, fmt.Errorf("user not found")
+		}
+	}
+
 	userPublic := ToUserPublic(user)
 	userPublic.IsLocked = true
 	userPublic.IsPoked = false
@@ -211,3 +240,45 @@ func GetUserActivities(userId string, activityType ...models.ActivityType) ([]mo
 
 	return activities, nil
 }
+
+// lastActiveResolution is the most often last_active_at is written for a user.
+const lastActiveResolution = 10 * time.Minute
+
+// MarkEmailVerified records that the user proved they own their email address.
+func MarkEmailVerified(userId string) error {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(
+		`UPDATE users SET email_verified_at = COALESCE(email_verified_at, $2) WHERE id = $1`,
+		userId, time.Now(),
+	); err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+	return nil
+}
+
+// TouchLastActive records that the user is active right now. It is called on every
+// authenticated request, so writes are throttled through Redis.
+func TouchLastActive(userId string) {
+	rc := utils.RedisConnect()
+	defer rc.Close()
+
+	fresh, err := rc.SetNX(context.Background(), fmt.Sprintf("spark:user:%s:active", userId), 1, lastActiveResolution).Result()
+	if err != nil || !fresh {
+		return
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		log.Printf("[Users] Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+	if _, err := db.Exec(`UPDATE users SET last_active_at = $2 WHERE id = $1`, userId, time.Now()); err != nil {
+		log.Printf("[Users] Failed to update last active for %s: %v", userId, err)
+	}
+}
@@ -0,0 +1,234 @@
+package verification
+
+import (
+	"spark/internal/models"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MelloB1989/karma/config"
+	"github.com/MelloB1989/karma/database"
+)
+
+// FaceComparer scores how likely a verification selfie shows the same person as the
+// user's profile photos. Scores are between 0 and 1 and only guide reviewers; nothing
+// is approved or rejected automatically.
+type FaceComparer interface {
+	// Name identifies the comparer in stored scores
+	Name() string
+	// Compare returns one score per photo, in the same order as photoURLs
+	Compare(ctx context.Context, selfieURL string, photoURLs []string) ([]float64, error)
+}
+
+const faceMatchTimeout = 30 * time.Second
+
+var (
+	comparerMu sync.RWMutex
+	comparer   FaceComparer = NewLocalComparer()
+)
+
+// SetFaceComparer replaces the comparer used for new submissions.
+func SetFaceComparer(c FaceComparer) {
+	comparerMu.Lock()
+	defer comparerMu.Unlock()
+	comparer = c
+}
+
+func getFaceComparer() FaceComparer {
+	comparerMu.RLock()
+	defer comparerMu.RUnlock()
+	return comparer
+}
+
+// scoreFaceMatch stores the best selfie vs profile photo score on v. Failures are only
+// logged; the attempt can still be reviewed by hand.
+func scoreFaceMatch(v *models.UserVerification, photos []string) {
+	selfie := Selfie(v.Media)
+	if selfie == nil || len(photos) == 0 {
+		return
+	}
+
+	c := getFaceComparer()
+	ctx, cancel := context.WithTimeout(context.Background(), faceMatchTimeout)
+	defer cancel()
+
+	scores, err := c.Compare(ctx, selfie.Url, photos)
+	if err != nil {
+		log.Printf("[Verification] Face match for %s failed: %v", v.Id, err)
+		return
+	}
+	if len(scores) == 0 {
+		return
+	}
+	best := slices.Max(scores)
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		log.Printf("[Verification] Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(
+		`UPDATE user_verifications SET face_match_score = $2, face_matcher = $3 WHERE id = $1`,
+		v.Id, best, c.Name(),
+	); err != nil {
+		log.Printf("[Verification] Failed to store face match for %s: %v", v.Id, err)
+	}
+}
+
+// LocalComparer is a stand-in that needs no external service. It compares perceptual
+// hashes of the images, so it catches a selfie that reuses a profile photo and scores
+// unrelated pictures low, but it doesn't recognise faces. Swap in a real provider with
+// SetFaceComparer.
+type LocalComparer struct {
+	client    *http.Client
+	maxBytes  int64
+	maxPixels int
+}
+
+func NewLocalComparer() *LocalComparer {
+	return &LocalComparer{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			// Uploads are served straight from storage, a redirect could point anywhere
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxBytes:  15 << 20,
+		maxPixels: 50_000_000,
+	}
+}
+
+// storageHost is the host uploaded files are served from. Nothing else is fetched.
+func storageHost() string {
+	return config.GetEnvRaw("MEDIA_HOST")
+}
+
+func (c *LocalComparer) Name() string {
+	return "local-ahash"
+}
+
+func (c *LocalComparer) Compare(ctx context.Context, selfieURL string, photoURLs []string) ([]float64, error) {
+	selfie, err := c.hash(ctx, selfieURL)
+	if err != nil {
+		return nil, fmt.Errorf("selfie: %w", err)
+	}
+
+	scores := make([]float64, len(photoURLs))
+	for i, u := range photoURLs {
+		h, err := c.hash(ctx, u)
+		if err != nil {
+			// A broken profile photo shouldn't hide the scores of the others
+			log.Printf("[Verification] Skipping photo %s: %v", u, err)
+			continue
+		}
+		scores[i] = 1 - float64(bits.OnesCount64(selfie^h))/64
+	}
+	return scores, nil
+}
+
+func (c *LocalComparer) hash(ctx context.Context, rawURL string) (uint64, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, err
+	}
+	host := storageHost()
+	if host == "" || u.Scheme != "https" || !strings.EqualFold(u.Host, host) {
+		return 0, fmt.Errorf("%s is not served from the storage host", u.Redacted())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, c.maxBytes+1))
+	if err != nil {
+		return 0, err
+	}
+	if int64(len(data)) > c.maxBytes {
+		return 0, errors.New("image too large")
+	}
+
+	// Check the dimensions first so a small file can't decode into a huge bitmap
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > c.maxPixels/cfg.Height {
+		return 0, fmt.Errorf("image too large: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	return averageHash(img)
+}
+
+// averageHash shrinks img to an 8x8 grayscale grid and sets one bit per cell that is
+// brighter than the mean.
+func averageHash(img image.Image) (uint64, error) {
+	b := img.Bounds()
+	if b.Dx() < 8 || b.Dy() < 8 {
+		return 0, errors.New("image too small")
+	}
+
+	var cells [64]float64
+	for cy := 0; cy < 8; cy++ {
+		y0, y1 := b.Min.Y+cy*b.Dy()/8, b.Min.Y+(cy+1)*b.Dy()/8
+		for cx := 0; cx < 8; cx++ {
+			x0, x1 := b.Min.X+cx*b.Dx()/8, b.Min.X+(cx+1)*b.Dx()/8
+			// Sampling a few points per row and column is plenty for large photos
+			stepX, stepY := max(1, (x1-x0)/16), max(1, (y1-y0)/16)
+			var sum float64
+			var n int
+			for y := y0; y < y1; y += stepY {
+				for x := x0; x < x1; x += stepX {
+					r, g, bl, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+					n++
+				}
+			}
+			cells[cy*8+cx] = sum / float64(n)
+		}
+	}
+
+	var mean float64
+	for _, v := range cells {
+		mean += v
+	}
+	mean /= 64
+
+	var h uint64
+	for i, v := range cells {
+		if v > mean {
+			h |= 1 << uint(i)
+		}
+	}
+	return h, nil
+}
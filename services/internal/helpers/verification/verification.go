@@ -0,0 +1,435 @@
+// Package verification runs photo verification requests through review. Each attempt is
+// its own row: a first attempt starts as requested, a retry after a rejection starts as
+// resubmitted, and reviewers move either through in_review to verified or rejected.
+package verification
+
+import (
+	mediahelper "spark/internal/helpers/media"
+	"spark/internal/helpers/promotions"
+	"spark/internal/helpers/users"
+	"spark/internal/mailer"
+	"spark/internal/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+	"github.com/MelloB1989/karma/v2/orm"
+)
+
+// Verification states
+const (
+	StatusRequested   = "requested"
+	StatusInReview    = "in_review"
+	StatusVerified    = "verified"
+	StatusRejected    = "rejected"
+	StatusResubmitted = "resubmitted"
+)
+
+// transitions lists the states a single attempt can move to. Verified and rejected
+// attempts are final; retrying after a rejection creates a new resubmitted attempt.
+var transitions = map[string][]string{
+	StatusRequested:   {StatusInReview},
+	StatusResubmitted: {StatusInReview},
+	StatusInReview:    {StatusVerified, StatusRejected},
+}
+
+const (
+	// BaseCooldown is the wait after a first rejection. It doubles with every further
+	// rejection up to MaxCooldown so repeated spam submissions slow down quickly.
+	BaseCooldown       = 24 * time.Hour
+	MaxCooldown        = 7 * 24 * time.Hour
+	MaxMedia           = 5
+	maxRejectionReason = 500
+)
+
+var (
+	ErrNotFound          = errors.New("verification not found")
+	ErrNoMedia           = errors.New("media is required")
+	ErrTooManyMedia      = fmt.Errorf("at most %d media items can be submitted", MaxMedia)
+	ErrNoSelfie          = errors.New("a selfie image is required")
+	ErrAlreadyVerified   = errors.New("account is already verified")
+	ErrPending           = errors.New("a verification request is already pending")
+	ErrInvalidStatus     = errors.New("invalid status: must be verified or rejected")
+	ErrReasonRequired    = errors.New("a reason is required to reject a verification")
+	ErrInvalidTransition = errors.New("invalid verification transition")
+)
+
+// CooldownError is returned by Submit while the user has to wait before trying again.
+type CooldownError struct {
+	Until time.Time
+}
+
+func (e *CooldownError) Error() string {
+	return fmt.Sprintf("you can submit a new verification after %s", e.Until.UTC().Format(time.RFC3339))
+}
+
+// CanTransition reports whether an attempt in state from may move to state to.
+func CanTransition(from, to string) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// IsPending reports whether an attempt is still waiting on a reviewer.
+func IsPending(status string) bool {
+	return status == StatusRequested || status == StatusResubmitted || status == StatusInReview
+}
+
+// Cooldown returns how long a user has to wait after their nth attempt was rejected.
+func Cooldown(attempt int) time.Duration {
+	d := BaseCooldown
+	for i := 1; i < attempt && d < MaxCooldown; i++ {
+		d *= 2
+	}
+	return min(d, MaxCooldown)
+}
+
+// ResubmitAt returns when the user may try again after v was rejected, or nil if v
+// wasn't rejected.
+func ResubmitAt(v *models.UserVerification) *time.Time {
+	if v == nil || v.Status != StatusRejected {
+		return nil
+	}
+	reviewed := v.UpdatedAt
+	if v.ReviewedAt != nil {
+		reviewed = *v.ReviewedAt
+	}
+	at := reviewed.Add(Cooldown(v.Attempt))
+	return &at
+}
+
+// Selfie returns the first image in the submitted media, which is compared against the
+// user's profile photos.
+func Selfie(media []models.Media) *models.Media {
+	for i := range media {
+		if strings.EqualFold(media[i].Type, "image") {
+			return &media[i]
+		}
+	}
+	return nil
+}
+
+// Submit files a new verification attempt for the user. It is refused while another
+// attempt is pending, once the user is verified, and during the cooldown after a
+// rejection. The selfie is scored against the profile photos in the background.
+func Submit(userId string, media []models.Media) (*models.UserVerification, error) {
+	if len(media) == 0 {
+		return nil, ErrNoMedia
+	}
+	if len(media) > MaxMedia {
+		return nil, ErrTooManyMedia
+	}
+	if Selfie(media) == nil {
+		return nil, ErrNoSelfie
+	}
+
+	user, err := users.GetUserByID(userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	if user.IsVerified {
+		return nil, ErrAlreadyVerified
+	}
+
+	media, err = ownMedia(userId, media)
+	if err != nil {
+		return nil, err
+	}
+	photos, err := ownPhotos(userId, user.Photos)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := Latest(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	v := &models.UserVerification{
+		Id:        utils.GenerateID(),
+		UserId:    userId,
+		Media:     media,
+		Status:    StatusRequested,
+		Attempt:   1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if latest != nil {
+		switch {
+		case latest.Status == StatusVerified:
+			return nil, ErrAlreadyVerified
+		case IsPending(latest.Status):
+			return nil, ErrPending
+		}
+		if at := ResubmitAt(latest); at != nil && now.Before(*at) {
+			return nil, &CooldownError{Until: *at}
+		}
+		v.Status = StatusResubmitted
+		v.Attempt = latest.Attempt + 1
+	}
+
+	mediaJSON, err := json.Marshal(v.Media)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode media: %w", err)
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	// The partial unique index keeps a concurrent submit from opening a second
+	// pending attempt after both passed the check above
+	res, err := db.Exec(`
+		INSERT INTO user_verifications (id, user_id, media, status, attempt, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+		ON CONFLICT (user_id) WHERE status IN ('requested', 'resubmitted', 'in_review') DO NOTHING`,
+		v.Id, v.UserId, string(mediaJSON), v.Status, v.Attempt, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create verification: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to create verification: %w", err)
+	} else if n == 0 {
+		return nil, ErrPending
+	}
+
+	go scoreFaceMatch(v, photos)
+
+	return v, nil
+}
+
+// ownMedia swaps each submitted item for the upload it points at, so only files the
+// user uploaded to storage are kept and later fetched for face matching.
+func ownMedia(userId string, submitted []models.Media) ([]models.Media, error) {
+	paths := make([]string, len(submitted))
+	for i, m := range submitted {
+		paths[i] = m.Url
+	}
+	files, err := mediahelper.OwnedFilesByPath(userId, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make([]models.Media, len(submitted))
+	for i, m := range submitted {
+		file := files[m.Url]
+		if file == nil {
+			return nil, mediahelper.ErrFileNotOwned
+		}
+		if err := mediahelper.Validate(file, userId, models.MessageType(strings.ToUpper(m.Type))); err != nil {
+			return nil, err
+		}
+		resolved[i] = models.Media{
+			Id:        file.Id,
+			FileId:    file.Id,
+			Type:      m.Type,
+			Url:       file.S3Path,
+			MimeType:  file.MimeType,
+			Size:      file.Size,
+			CreatedAt: m.CreatedAt,
+		}
+	}
+	return resolved, nil
+}
+
+// ownPhotos keeps the profile photos the user uploaded themselves.
+func ownPhotos(userId string, photos []string) ([]string, error) {
+	files, err := mediahelper.OwnedFilesByPath(userId, photos)
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make([]string, 0, len(photos))
+	for _, p := range photos {
+		if files[p] != nil {
+			owned = append(owned, p)
+		}
+	}
+	return owned, nil
+}
+
+// Latest returns the user's most recent attempt, or nil if they never submitted one.
+func Latest(userId string) (*models.UserVerification, error) {
+	verificationORM := orm.Load(&models.UserVerification{})
+	defer verificationORM.Close()
+
+	var vs []models.UserVerification
+	if err := verificationORM.QueryRaw(
+		`SELECT * FROM user_verifications WHERE user_id = $1 ORDER BY created_at DESC, attempt DESC LIMIT 1`,
+		userId,
+	).Scan(&vs); err != nil {
+		return nil, fmt.Errorf("failed to get verification: %w", err)
+	}
+	if len(vs) == 0 {
+		return nil, nil
+	}
+	return &vs[0], nil
+}
+
+func Get(id string) (*models.UserVerification, error) {
+	verificationORM := orm.Load(&models.UserVerification{})
+	defer verificationORM.Close()
+
+	var vs []models.UserVerification
+	if err := verificationORM.GetByFieldEquals("Id", id).Scan(&vs); err != nil {
+		return nil, fmt.Errorf("failed to get verification: %w", err)
+	}
+	if len(vs) == 0 {
+		return nil, ErrNotFound
+	}
+	return &vs[0], nil
+}
+
+// CountPending returns the number of attempts waiting on a reviewer.
+func CountPending() (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var n int
+	err = db.QueryRow(
+		`SELECT COUNT(*) FROM user_verifications WHERE status IN ($1, $2, $3)`,
+		StatusRequested, StatusResubmitted, StatusInReview,
+	).Scan(&n)
+	return n, err
+}
+
+// StartReview claims a requested or resubmitted attempt for reviewerId.
+func StartReview(id, reviewerId string) (*models.UserVerification, error) {
+	v, err := Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransition(v.Status, StatusInReview) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, v.Status, StatusInReview)
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	res, err := db.Exec(`
+		UPDATE user_verifications SET status = $2, reviewer_id = $3, updated_at = $4
+		WHERE id = $1 AND status = $5
+	`, id, StatusInReview, reviewerId, now, v.Status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start review: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Someone else moved it first
+		return nil, fmt.Errorf("%w: verification was already picked up", ErrInvalidTransition)
+	}
+	v.Status = StatusInReview
+	v.ReviewerId = reviewerId
+	v.UpdatedAt = now
+	return v, nil
+}
+
+// Resolve verifies or rejects an attempt. Attempts that nobody picked up yet are
+// claimed for reviewerId first. Rejections need a reason, which is stored and shown to
+// the user along with when they can try again.
+func Resolve(id, reviewerId, status, reason string) (*models.UserVerification, error) {
+	if status != StatusVerified && status != StatusRejected {
+		return nil, ErrInvalidStatus
+	}
+	reason = strings.TrimSpace(reason)
+	if status == StatusRejected && reason == "" {
+		return nil, ErrReasonRequired
+	}
+	if len(reason) > maxRejectionReason {
+		reason = reason[:maxRejectionReason]
+	}
+
+	v, err := Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if v.Status == StatusRequested || v.Status == StatusResubmitted {
+		if v, err = StartReview(id, reviewerId); err != nil {
+			return nil, err
+		}
+	}
+	if !CanTransition(v.Status, status) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, v.Status, status)
+	}
+
+	rejectionReason := ""
+	if status == StatusRejected {
+		rejectionReason = reason
+	}
+
+	db, err := database.PostgresConn()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	res, err := db.Exec(`
+		UPDATE user_verifications
+		SET status = $2, rejection_reason = $3, reviewer_id = $4, reviewed_at = $5, updated_at = $5
+		WHERE id = $1 AND status = $6
+	`, id, status, rejectionReason, reviewerId, now, StatusInReview)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve verification: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("%w: verification was already resolved", ErrInvalidTransition)
+	}
+	v.Status = status
+	v.RejectionReason = rejectionReason
+	v.ReviewerId = reviewerId
+	v.ReviewedAt = &now
+	v.UpdatedAt = now
+
+	if status == StatusVerified {
+		if _, err := db.Exec(`UPDATE users SET is_verified = true, updated_at = $2 WHERE id = $1`, v.UserId, now); err != nil {
+			return nil, fmt.Errorf("failed to mark user verified: %w", err)
+		}
+		usersORM := orm.Load(&models.User{})
+		defer usersORM.Close()
+		usersORM.InvalidateCacheByPrefix(fmt.Sprintf("user-%s", v.UserId))
+
+		// Referral rewards wait for the new user to be verified
+		go func() {
+			if err := promotions.RewardReferral(v.UserId); err != nil {
+				log.Printf("[Verification] Failed to reward referral of %s: %v", v.UserId, err)
+			}
+		}()
+	}
+
+	var email, locale string
+	if err := db.QueryRow(`SELECT email, preferred_locale FROM users WHERE id = $1`, v.UserId).Scan(&email, &locale); err == nil {
+		if status == StatusVerified {
+			notify(mailer.VerificationApproved(email, locale))
+		} else {
+			notify(mailer.VerificationRejected(email, locale, reason, *ResubmitAt(v)))
+		}
+	} else if err != sql.ErrNoRows {
+		log.Printf("[Verification] Failed to load email for %s: %v", v.UserId, err)
+	}
+
+	return v, nil
+}
+
+func notify(t *mailer.Template) {
+	go func() {
+		if err := t.Send(); err != nil {
+			log.Printf("[Verification] Failed to email %s: %v", t.ToEmail, err)
+		}
+	}()
+}
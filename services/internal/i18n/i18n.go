@@ -0,0 +1,187 @@
+// Package i18n renders user-facing text from the message catalogs in locales/. Each
+// locale is a JSON file mapping keys to either a string or, for text that depends on
+// a count, an object of plural forms ("one", "other"). Text is looked up in the
+// user's locale and falls back to English.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is the locale every key is guaranteed to exist in
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// message is one catalog entry. Plain strings have only Other.
+type message struct {
+	Other  string
+	One    string
+	Plural bool
+}
+
+func (m *message) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		m.Other = s
+		return nil
+	}
+	var forms map[string]string
+	if err := json.Unmarshal(data, &forms); err != nil {
+		return fmt.Errorf("message must be a string or an object of plural forms")
+	}
+	for form := range forms {
+		if form != "one" && form != "other" {
+			return fmt.Errorf("unknown plural form %q", form)
+		}
+	}
+	m.One, m.Other, m.Plural = forms["one"], forms["other"], true
+	return nil
+}
+
+var catalogs = mustLoad()
+
+func mustLoad() map[string]map[string]message {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	out := make(map[string]map[string]message, len(entries))
+	for _, e := range entries {
+		data, err := files.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var catalog map[string]message
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", e.Name(), err))
+		}
+		out[strings.TrimSuffix(e.Name(), ".json")] = catalog
+	}
+	if _, ok := out[DefaultLocale]; !ok {
+		panic("i18n: missing " + DefaultLocale + " catalog")
+	}
+	return out
+}
+
+// Locales lists the supported locales.
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	slices.Sort(locales)
+	return locales
+}
+
+// IsSupported reports whether locale, or its language, has a catalog.
+func IsSupported(locale string) bool {
+	_, ok := catalogs[language(locale)]
+	return ok
+}
+
+// Normalize returns the supported locale for a tag such as "es-MX", or DefaultLocale
+// when there isn't one.
+func Normalize(locale string) string {
+	if lang := language(locale); IsSupported(lang) {
+		return lang
+	}
+	return DefaultLocale
+}
+
+func language(locale string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(locale)), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	return lang
+}
+
+// T renders key in locale. args are name, value pairs filling its {name} placeholders.
+func T(locale, key string, args ...any) string {
+	m, ok := lookup(locale, key)
+	if !ok {
+		return key
+	}
+	return fill(m.Other, args)
+}
+
+// N renders the plural form of key that fits count. {count} is filled in along with
+// the name, value pairs in args.
+func N(locale, key string, count int, args ...any) string {
+	m, ok := lookup(locale, key)
+	if !ok {
+		return key
+	}
+	text := m.Other
+	if m.One != "" && pluralForm(Normalize(locale), count) == "one" {
+		text = m.One
+	}
+	return fill(text, append([]any{"count", count}, args...))
+}
+
+func lookup(locale, key string) (message, bool) {
+	if m, ok := catalogs[Normalize(locale)][key]; ok {
+		return m, true
+	}
+	if m, ok := catalogs[DefaultLocale][key]; ok {
+		return m, true
+	}
+	log.Printf("[i18n] Missing message %q", key)
+	return message{}, false
+}
+
+func fill(text string, args []any) string {
+	if len(args) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// pluralForm picks the CLDR plural category of n for the catalogs' languages.
+func pluralForm(locale string, n int) string {
+	switch locale {
+	case "hi":
+		// Hindi uses the singular for zero as well
+		if n == 0 || n == 1 {
+			return "one"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+// FormatDate writes t as a date, e.g. "January 2, 2006".
+func FormatDate(locale string, t time.Time) string {
+	t = t.UTC()
+	return T(locale, "date.long", "day", t.Day(), "month", month(locale, t), "year", t.Year())
+}
+
+// FormatDayMonth writes t as a day of the month, e.g. "January 2".
+func FormatDayMonth(locale string, t time.Time) string {
+	t = t.UTC()
+	return T(locale, "date.day_month", "day", t.Day(), "month", month(locale, t))
+}
+
+// FormatDateTime writes t as a date and UTC time, e.g. "January 2, 2006 at 15:04 UTC".
+func FormatDateTime(locale string, t time.Time) string {
+	t = t.UTC()
+	return T(locale, "date.date_time", "date", FormatDate(locale, t), "time", t.Format("15:04"))
+}
+
+func month(locale string, t time.Time) string {
+	return T(locale, fmt.Sprintf("date.month.%d", int(t.Month())))
+}
@@ -0,0 +1,129 @@
+package i18n
+
+import (
+	"maps"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+)
+
+var placeholder = regexp.MustCompile(`\{[a-z_]+\}`)
+
+func placeholders(text string) map[string]bool {
+	out := make(map[string]bool)
+	for _, p := range placeholder.FindAllString(text, -1) {
+		out[p] = true
+	}
+	return out
+}
+
+func TestEveryKeyInEveryLocale(t *testing.T) {
+	en := catalogs[DefaultLocale]
+	for _, locale := range Locales() {
+		catalog := catalogs[locale]
+		for key, want := range en {
+			got, ok := catalog[key]
+			if !ok {
+				t.Errorf("%s: missing %q", locale, key)
+				continue
+			}
+			if got.Plural != want.Plural {
+				t.Errorf("%s: %q plural = %v, want %v", locale, key, got.Plural, want.Plural)
+				continue
+			}
+			if got.Plural && (got.One == "" || got.Other == "") {
+				t.Errorf("%s: %q needs both the one and other forms", locale, key)
+				continue
+			}
+			if !got.Plural {
+				if w, g := placeholders(want.Other), placeholders(got.Other); !maps.Equal(w, g) {
+					t.Errorf("%s: %q has placeholders %v, want %v", locale, key, slices.Sorted(maps.Keys(g)), slices.Sorted(maps.Keys(w)))
+				}
+				continue
+			}
+			// A plural form may leave out {count}, but may not use a placeholder English doesn't fill
+			allowed := placeholders(want.One + want.Other)
+			for _, form := range []string{got.One, got.Other} {
+				for p := range placeholders(form) {
+					if !allowed[p] {
+						t.Errorf("%s: %q uses unknown placeholder %s", locale, key, p)
+					}
+				}
+			}
+		}
+		for key := range catalog {
+			if _, ok := en[key]; !ok {
+				t.Errorf("%s: %q is not in the %s catalog", locale, key, DefaultLocale)
+			}
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("en", "push.match.body", "name", "Asha"); got != "You and Asha liked each other! Start chatting now." {
+		t.Errorf("en = %q", got)
+	}
+	if got := T("es-MX", "notification.poke", "name", "Asha"); got != "Asha te dio un toque" {
+		t.Errorf("es-MX = %q", got)
+	}
+	// Unsupported locales fall back to English, unknown keys to the key itself
+	if got := T("fr", "email.cta.open"); got != "Open Spark" {
+		t.Errorf("fr = %q", got)
+	}
+	if got := T("en", "no.such.key"); got != "no.such.key" {
+		t.Errorf("missing key = %q", got)
+	}
+}
+
+func TestN(t *testing.T) {
+	tests := []struct {
+		locale string
+		count  int
+		want   string
+	}{
+		{"en", 1, "1 person liked you"},
+		{"en", 0, "0 people liked you"},
+		{"en", 3, "3 people liked you"},
+		{"hi", 0, "0 व्यक्ति ने आपको लाइक किया"},
+		{"hi", 2, "2 लोगों ने आपको लाइक किया"},
+	}
+	for _, tt := range tests {
+		if got := N(tt.locale, "digest.like", tt.count); got != tt.want {
+			t.Errorf("N(%s, %d) = %q, want %q", tt.locale, tt.count, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for in, want := range map[string]string{
+		"en":    "en",
+		"es-MX": "es",
+		"HI_in": "hi",
+		"fr":    "en",
+		"":      "en",
+	} {
+		if got := Normalize(in); got != want {
+			t.Errorf("Normalize(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if IsSupported("fr") || !IsSupported("es-AR") {
+		t.Error("IsSupported disagrees with the catalogs")
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	at := time.Date(2025, 3, 4, 15, 4, 0, 0, time.UTC)
+	if got := FormatDate("en", at); got != "March 4, 2025" {
+		t.Errorf("en = %q", got)
+	}
+	if got := FormatDayMonth("en", at); got != "March 4" {
+		t.Errorf("en day month = %q", got)
+	}
+	if got := FormatDateTime("en", at); got != "March 4, 2025 at 15:04 UTC" {
+		t.Errorf("en date time = %q", got)
+	}
+	if got := FormatDate("hi", at); got != "4 मार्च 2025" {
+		t.Errorf("hi = %q", got)
+	}
+}
@@ -1,26 +1,34 @@
 package mailer
 
-import "fmt"
+import (
+	"spark/internal/i18n"
+	"fmt"
+)
+
+// deletionCodeMinutes is how long the confirmation code stays valid
+const deletionCodeMinutes = 15
 
 // AccountDeletion returns a template for account deletion confirmation
-func AccountDeletion(toEmail, code string) *Template {
+func AccountDeletion(toEmail, locale, code string) *Template {
+	t := func(key string, args ...any) string { return i18n.T(locale, key, args...) }
+	duration := i18n.N(locale, "duration.minutes", deletionCodeMinutes)
 	return &Template{
 		ToEmail: toEmail,
-		Subject: "Spark - Account Deletion Confirmation",
-		Text: fmt.Sprintf(`Account Deletion Request
-
-You have requested to delete your Spark account.
+		Locale:  locale,
+		Subject: t("email.account_deletion.subject"),
+		Text: signedOff(locale, fmt.Sprintf(`%s
 
-Your confirmation code is: %s
+%s
 
-This code will expire in 15 minutes.
+%s
 
-If you did not request this, please ignore this email and your account will remain safe.
+%s
 
-- The Spark Team`, code),
+%s`, t("email.account_deletion.title"), t("email.account_deletion.requested"), t("email.account_deletion.code", "code", code),
+			t("email.account_deletion.expires", "duration", duration), t("email.account_deletion.ignore"))),
 		HTML: fmt.Sprintf(`
 <!DOCTYPE html>
-<html>
+<html lang="%s">
 <head>
     <meta charset="utf-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
@@ -32,31 +40,34 @@ If you did not request this, please ignore this email and your account will rema
         </div>
 
         <div style="padding: 32px;">
-            <h2 style="color: #ffffff; font-size: 20px; margin: 0 0 16px 0;">Account Deletion Request</h2>
+            <h2 style="color: #ffffff; font-size: 20px; margin: 0 0 16px 0;">%s</h2>
 
             <p style="color: rgba(255, 255, 255, 0.7); font-size: 15px; line-height: 1.6; margin: 0 0 24px 0;">
-                You have requested to delete your Spark account. Use the code below to confirm this action.
+                %s %s
             </p>
 
             <div style="background: rgba(138, 60, 255, 0.15); border: 2px solid rgba(138, 60, 255, 0.5); border-radius: 12px; padding: 20px; text-align: center; margin-bottom: 24px;">
-                <p style="color: rgba(255, 255, 255, 0.6); font-size: 12px; margin: 0 0 8px 0; text-transform: uppercase; letter-spacing: 1px;">Your Confirmation Code</p>
+                <p style="color: rgba(255, 255, 255, 0.6); font-size: 12px; margin: 0 0 8px 0; text-transform: uppercase; letter-spacing: 1px;">%s</p>
                 <p style="color: #ffffff; font-size: 36px; font-weight: 700; margin: 0; letter-spacing: 8px;">%s</p>
             </div>
 
             <p style="color: rgba(255, 255, 255, 0.5); font-size: 13px; line-height: 1.5; margin: 0 0 8px 0;">
-                ⏱️ This code expires in <strong style="color: rgba(255, 255, 255, 0.8);">15 minutes</strong>
+                ⏱️ %s
             </p>
 
             <p style="color: rgba(255, 255, 255, 0.5); font-size: 13px; line-height: 1.5; margin: 0;">
-                ⚠️ If you did not request this, please ignore this email and your account will remain safe.
+                ⚠️ %s
             </p>
         </div>
 
         <div style="border-top: 1px solid rgba(255, 255, 255, 0.1); padding: 20px; text-align: center;">
-            <p style="color: rgba(255, 255, 255, 0.4); font-size: 12px; margin: 0;">© 2024 Spark. Built with love in India.</p>
+            <p style="color: rgba(255, 255, 255, 0.4); font-size: 12px; margin: 0;">%s</p>
         </div>
     </div>
 </body>
-</html>`, code),
+</html>`, i18n.Normalize(locale), t("email.account_deletion.title"), t("email.account_deletion.requested"), t("email.account_deletion.use_code"),
+			t("email.account_deletion.code_label"), code,
+			t("email.account_deletion.expires", "duration", `<strong style="color: rgba(255, 255, 255, 0.8);">`+duration+`</strong>`),
+			t("email.account_deletion.ignore"), t("email.account_deletion.footer")),
 	}
 }
@@ -1,12 +1,16 @@
 package mailer
 
-import "fmt"
+import (
+	"spark/internal/i18n"
+	"fmt"
+)
 
-func BuildMagicLogin(email string, code string) *Template {
+func BuildMagicLogin(email, locale, code string) *Template {
 	return &Template{
 		ToEmail: email,
-		Subject: "Magic Login",
-		Text:    fmt.Sprintf("Your magic login code is: %s", code),
-		HTML:    fmt.Sprintf("<p>Your magic login code is: <strong>%s</strong></p>", code),
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.magic_login.subject"),
+		Text:    i18n.T(locale, "email.magic_login.code", "code", code),
+		HTML:    fmt.Sprintf("<p>%s</p>", i18n.T(locale, "email.magic_login.code", "code", bold(code))),
 	}
 }
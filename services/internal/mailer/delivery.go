@@ -0,0 +1,93 @@
+package mailer
+
+import (
+	"errors"
+	"log"
+)
+
+// ErrSuppressed is returned for emails to an address that bounced or complained.
+var ErrSuppressed = errors.New("email address is suppressed")
+
+// SendError is a failed send a mailer knows won't work on a retry. Bounce means the
+// address itself doesn't exist.
+type SendError struct {
+	Err    error
+	Bounce bool
+}
+
+func (e *SendError) Error() string { return e.Err.Error() }
+func (e *SendError) Unwrap() error { return e.Err }
+
+func permanent(err error) error {
+	return &SendError{Err: err}
+}
+
+func bounced(err error) error {
+	return &SendError{Err: err, Bounce: true}
+}
+
+// IsPermanent reports whether retrying a send that failed with err is pointless.
+func IsPermanent(err error) bool {
+	var se *SendError
+	return errors.As(err, &se) || errors.Is(err, ErrSuppressed)
+}
+
+func isBounce(err error) bool {
+	var se *SendError
+	return errors.As(err, &se) && se.Bounce
+}
+
+// Tests replace them.
+var (
+	isSuppressed = IsSuppressed
+	suppress     = Suppress
+	queueRetry   = enqueue
+)
+
+// reliableMailer skips suppressed addresses, suppresses addresses that bounce and
+// queues sends that failed for a reason that may pass. A queued email counts as sent.
+type reliableMailer struct {
+	Mailer
+}
+
+func (r reliableMailer) Send(t *Template) error {
+	err := deliver(r.Mailer, t)
+	if err == nil || IsPermanent(err) {
+		return err
+	}
+	if qerr := queueRetry(t, err); qerr != nil {
+		log.Printf("[Mail] Failed to queue %q for %s: %v", t.Subject, t.ToEmail, qerr)
+		return err
+	}
+	log.Printf("[Mail] Sending %q to %s failed, will retry: %v", t.Subject, t.ToEmail, err)
+	return nil
+}
+
+// deliver sends t through m unless its address is suppressed, and suppresses the
+// address if it bounces.
+func deliver(m Mailer, t *Template) error {
+	suppressed, err := isSuppressed(t.ToEmail)
+	if err != nil {
+		log.Printf("[Mail] Failed to check suppression for %s, sending anyway: %v", t.ToEmail, err)
+	}
+	if suppressed {
+		return ErrSuppressed
+	}
+
+	err = m.Send(t)
+	if isBounce(err) {
+		if serr := suppress(t.ToEmail, ReasonBounce, err.Error()); serr != nil {
+			log.Printf("[Mail] %v", serr)
+		}
+	}
+	return err
+}
+
+// backend is the mailer under the retries, which the queue sends through
+func backend() Mailer {
+	m := Current()
+	if r, ok := m.(reliableMailer); ok {
+		return r.Mailer
+	}
+	return m
+}
@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"spark/internal/i18n"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// DigestSection is one kind of activity in a digest email
+type DigestSection struct {
+	Title string   // e.g. "3 people viewed your profile"
+	Lines []string // A few of the events
+	More  int      // Events left out of Lines
+}
+
+// Digest returns a template summing up activity since the last digest. period is
+// "daily" or "weekly".
+func Digest(toEmail, locale, period string, sections []DigestSection) *Template {
+	if period != "weekly" {
+		period = "daily"
+	}
+	subject := i18n.T(locale, "email.digest."+period+".subject")
+	intro := i18n.T(locale, "email.digest."+period+".intro")
+
+	var text, body strings.Builder
+	text.WriteString(intro + "\n")
+	body.WriteString(`<div style="text-align:left;margin:24px 0;">`)
+	for _, s := range sections {
+		fmt.Fprintf(&text, "\n%s\n", s.Title)
+		fmt.Fprintf(&body, `<div style="background: rgba(124,58,237,0.12); border-radius: 12px; padding: 18px; margin: 0 0 12px;">
+			<p style="color:#ffffff;font-size:15px;font-weight:600;margin:0 0 8px;">%s</p>`, html.EscapeString(s.Title))
+		for _, line := range s.Lines {
+			fmt.Fprintf(&text, "  - %s\n", line)
+			fmt.Fprintf(&body, `
+			<p style="color:rgba(255,255,255,0.75);font-size:14px;line-height:1.5;margin:0;">%s</p>`, html.EscapeString(line))
+		}
+		if s.More > 0 {
+			more := i18n.N(locale, "email.digest.more", s.More)
+			fmt.Fprintf(&text, "  %s\n", more)
+			fmt.Fprintf(&body, `
+			<p style="color:rgba(255,255,255,0.5);font-size:13px;margin:6px 0 0;">%s</p>`, html.EscapeString(more))
+		}
+		body.WriteString(`</div>`)
+	}
+	body.WriteString(`</div>`)
+	text.WriteString("\n" + i18n.T(locale, "email.digest.outro"))
+
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    layout(locale, i18n.T(locale, "email.digest.title"), intro, body.String(), i18n.T(locale, "email.cta.open")),
+	}
+}
@@ -0,0 +1,351 @@
+package mailer
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testTemplate() *Template {
+	return (&Template{
+		ToEmail: "maya@example.com",
+		Locale:  "es",
+		Subject: "¡Tienes un match!",
+		Text:    "Hola Maya",
+		HTML:    "<p>Hola <strong>Maya</strong></p>",
+	}).WithUnsubscribe("https://spark.test/unsubscribe?token=abc")
+}
+
+// readMessage parses a rendered email and returns its header and its parts by type
+func readMessage(t *testing.T, raw []byte) (mail.Header, map[string]string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q", msg.Header.Get("Content-Type"))
+	}
+	parts := make(map[string]string)
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		body, _ := io.ReadAll(p) // multipart decodes quoted-printable
+		contentType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		parts[contentType] = strings.ReplaceAll(string(body), "\r\n", "\n")
+	}
+	return msg.Header, parts
+}
+
+func TestMessage(t *testing.T) {
+	tmpl := testTemplate()
+	now := time.Date(2025, 11, 2, 10, 15, 30, 0, time.UTC)
+	header, parts := readMessage(t, tmpl.Message("Spark <hello@spark.test>", now))
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != tmpl.Subject {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, tmpl.Subject)
+	}
+	for name, want := range map[string]string{
+		"From":                  "Spark <hello@spark.test>",
+		"To":                    "maya@example.com",
+		"Content-Language":      "es",
+		"List-Unsubscribe":      "<https://spark.test/unsubscribe?token=abc>",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if date, err := header.Date(); err != nil || !date.Equal(now) {
+		t.Errorf("Date = %v (%v)", date, err)
+	}
+	if id := header.Get("Message-ID"); !strings.HasSuffix(id, "@spark.test>") {
+		t.Errorf("Message-ID = %q", id)
+	}
+	if parts["text/plain"] != tmpl.Text || parts["text/html"] != tmpl.HTML {
+		t.Errorf("parts = %q", parts)
+	}
+
+	// Without a link there are no unsubscribe headers
+	header, _ = readMessage(t, (&Template{ToEmail: "a@example.com", Subject: "Hi", Text: "Hi"}).Message("hello@spark.test", now))
+	if header.Get("List-Unsubscribe") != "" {
+		t.Errorf("List-Unsubscribe = %q", header.Get("List-Unsubscribe"))
+	}
+}
+
+// fakeSMTP is an SMTP server that accepts anything except the rejected recipients.
+type fakeSMTP struct {
+	addr     string
+	rejected map[string]string // recipient -> reply
+	hangUp   bool              // Drop the connection instead of answering QUIT
+	mu       sync.Mutex
+	commands []string
+	data     []string
+}
+
+func newFakeSMTP(t *testing.T, rejected map[string]string) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	s := &fakeSMTP{addr: ln.Addr().String(), rejected: rejected}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			tp.PrintfLine("250-fake")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			tp.PrintfLine("235 2.7.0 Authentication successful")
+		case "RCPT":
+			rcpt := strings.Trim(strings.TrimPrefix(line, "RCPT TO:"), "<>")
+			if reply, ok := s.rejected[rcpt]; ok {
+				tp.PrintfLine("%s", reply)
+				continue
+			}
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			body, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = append(s.data, string(body))
+			s.mu.Unlock()
+			tp.PrintfLine("250 Queued")
+		case "QUIT":
+			s.mu.Lock()
+			hangUp := s.hangUp
+			s.mu.Unlock()
+			if hangUp {
+				return
+			}
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	server := newFakeSMTP(t, map[string]string{
+		"gone@example.com": "550 5.1.1 No such user",
+		"full@example.com": "452 4.2.2 Mailbox full",
+	})
+	host, port, _ := net.SplitHostPort(server.addr)
+	m := NewSMTPMailer(SMTPConfig{Host: host, Port: port, Username: "spark", Password: "secret", From: "Spark <hello@spark.test>"})
+
+	if err := m.Send(testTemplate()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	server.mu.Lock()
+	commands := strings.Join(server.commands, "\n")
+	data := server.data
+	server.mu.Unlock()
+	for _, want := range []string{"AUTH PLAIN", "MAIL FROM:<hello@spark.test>", "RCPT TO:<maya@example.com>"} {
+		if !strings.Contains(commands, want) {
+			t.Errorf("missing %q in:\n%s", want, commands)
+		}
+	}
+	if len(data) != 1 {
+		t.Fatalf("got %d messages, want 1", len(data))
+	}
+	if _, parts := readMessage(t, []byte(data[0])); parts["text/plain"] != testTemplate().Text {
+		t.Errorf("text = %q", parts["text/plain"])
+	}
+
+	gone := testTemplate()
+	gone.ToEmail = "gone@example.com"
+	if err := m.Send(gone); !isBounce(err) {
+		t.Errorf("unknown user: got %v, want a bounce", err)
+	}
+	full := testTemplate()
+	full.ToEmail = "full@example.com"
+	if err := m.Send(full); err == nil || IsPermanent(err) {
+		t.Errorf("full mailbox: got %v, want a transient error", err)
+	}
+
+	if err := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: "1"}).Send(testTemplate()); err == nil || IsPermanent(err) {
+		t.Errorf("connection refused: got %v, want a transient error", err)
+	}
+}
+
+// Once the server has accepted DATA the message is sent; a failed QUIT must not make
+// the queue retry it and deliver a duplicate
+func TestSMTPMailerIgnoresQuitAfterData(t *testing.T) {
+	server := newFakeSMTP(t, nil)
+	server.mu.Lock()
+	server.hangUp = true
+	server.mu.Unlock()
+	host, port, _ := net.SplitHostPort(server.addr)
+	m := NewSMTPMailer(SMTPConfig{Host: host, Port: port, From: "Spark <hello@spark.test>"})
+
+	if err := m.Send(testTemplate()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.data) != 1 {
+		t.Errorf("got %d messages, want 1", len(server.data))
+	}
+}
+
+// stubMailer fails with err
+type stubMailer struct {
+	err  error
+	sent int
+}
+
+func (s *stubMailer) Name() string { return "stub" }
+
+func (s *stubMailer) Send(t *Template) error {
+	s.sent++
+	return s.err
+}
+
+func TestReliableMailer(t *testing.T) {
+	var suppressedList, queued []string
+	prevSuppressed, prevSuppress, prevQueue := isSuppressed, suppress, queueRetry
+	t.Cleanup(func() { isSuppressed, suppress, queueRetry = prevSuppressed, prevSuppress, prevQueue })
+	isSuppressed = func(email string) (bool, error) { return email == "blocked@example.com", nil }
+	suppress = func(email, reason, details string) error {
+		suppressedList = append(suppressedList, email+":"+reason)
+		return nil
+	}
+	queueRetry = func(t *Template, err error) error {
+		queued = append(queued, t.ToEmail)
+		return nil
+	}
+
+	tests := []struct {
+		name           string
+		to             string
+		err            error
+		want           error
+		wantSent       int
+		wantSuppressed []string
+		wantQueued     []string
+	}{
+		{"sent", "maya@example.com", nil, nil, 1, nil, nil},
+		{"suppressed", "blocked@example.com", nil, ErrSuppressed, 0, nil, nil},
+		{"transient failure is queued", "maya@example.com", errors.New("timeout"), nil, 1, nil, []string{"maya@example.com"}},
+		{"permanent failure", "maya@example.com", permanent(errors.New("rejected")), errors.New("rejected"), 1, nil, nil},
+		{"bounce suppresses", "gone@example.com", bounced(errors.New("no such user")), errors.New("no such user"), 1, []string{"gone@example.com:bounce"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			suppressedList, queued = nil, nil
+			inner := &stubMailer{err: tt.err}
+			tmpl := testTemplate()
+			tmpl.ToEmail = tt.to
+
+			err := reliableMailer{inner}.Send(tmpl)
+			if (err == nil) != (tt.want == nil) || (err != nil && err.Error() != tt.want.Error()) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if inner.sent != tt.wantSent {
+				t.Errorf("sent %d, want %d", inner.sent, tt.wantSent)
+			}
+			if strings.Join(suppressedList, ",") != strings.Join(tt.wantSuppressed, ",") {
+				t.Errorf("suppressed %v, want %v", suppressedList, tt.wantSuppressed)
+			}
+			if strings.Join(queued, ",") != strings.Join(tt.wantQueued, ",") {
+				t.Errorf("queued %v, want %v", queued, tt.wantQueued)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		0:  time.Minute,
+		1:  time.Minute,
+		2:  2 * time.Minute,
+		4:  8 * time.Minute,
+		10: time.Hour,
+	} {
+		if got := retryDelay(attempts); got != want {
+			t.Errorf("retryDelay(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	if err := NewFileMailer(dir, "Spark <hello@spark.test>").Send(testTemplate()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %v (%v)", files, err)
+	}
+	if !strings.HasSuffix(files[0].Name(), "-maya@example.com.eml") {
+		t.Errorf("file name = %s", files[0].Name())
+	}
+	raw, _ := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if header, _ := readMessage(t, raw); header.Get("To") != "maya@example.com" {
+		t.Errorf("To = %q", header.Get("To"))
+	}
+}
+
+func TestUseMailer(t *testing.T) {
+	memory := NewMemoryMailer()
+	prev := UseMailer(memory)
+	t.Cleanup(func() { UseMailer(prev) })
+
+	if err := testTemplate().Send(); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if sent := memory.Sent(); len(sent) != 1 || sent[0].ToEmail != "maya@example.com" {
+		t.Errorf("sent %v", sent)
+	}
+	memory.Reset()
+	if len(memory.Sent()) != 0 {
+		t.Error("Reset kept emails")
+	}
+}
@@ -1,34 +1,130 @@
 package mailer
 
 import (
+	"spark/internal/i18n"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
 	"github.com/MelloB1989/karma/config"
-	"github.com/MelloB1989/karma/mails"
-	m "github.com/MelloB1989/karma/models"
 )
 
 type Template struct {
 	ToEmail string
+	Locale  string // what the email is written in, see i18n
 	Subject string
 	Text    string
 	HTML    string
+	// UnsubscribeURL turns off this kind of email with one click, empty when it can't be
+	UnsubscribeURL string
 }
 
-func (t *Template) Send() error {
-	km := mails.NewKarmaMail(config.GetEnvRaw("MAILER_ADDRESS"), mails.AWS_SES)
-
-	// Send email
-	if err := km.SendSingleMail(m.SingleEmailRequest{
-		To: t.ToEmail,
-		Email: m.Email{
-			Subject: t.Subject,
-			Body: m.EmailBody{
-				Text: t.Text,
-				HTML: t.HTML,
-			},
-		},
-	}); err != nil {
-		return err
+// unsubscribeMarker is where baseTemplate puts the unsubscribe link
+const unsubscribeMarker = "<!-- unsubscribe -->"
+
+// WithUnsubscribe adds a link that turns off this kind of email to the footer.
+func (t *Template) WithUnsubscribe(url string) *Template {
+	if url == "" {
+		return t
+	}
+	t.UnsubscribeURL = url
+	t.Text += "\n\n" + i18n.T(t.Locale, "email.unsubscribe_text", "url", url)
+	link := fmt.Sprintf(`<p style="margin:8px 0 0;font-size:12px;"><a href="%s" style="color:rgba(255,255,255,0.35);">%s</a></p>`, url, i18n.T(t.Locale, "email.unsubscribe_link"))
+	if strings.Contains(t.HTML, unsubscribeMarker) {
+		t.HTML = strings.Replace(t.HTML, unsubscribeMarker, link, 1)
+	} else {
+		t.HTML += link
+	}
+	return t
+}
+
+// Transports MAIL_TRANSPORT can pick
+const (
+	TransportSES    = "ses"
+	TransportSMTP   = "smtp"
+	TransportFile   = "file"
+	TransportMemory = "memory"
+)
+
+// Mailer delivers emails.
+type Mailer interface {
+	// Name is the transport, for logs
+	Name() string
+	Send(t *Template) error
+}
+
+var (
+	mailerMu sync.RWMutex
+	active   Mailer
+)
+
+// UseMailer makes emails go through m and returns the mailer it replaced. nil goes
+// back to the configured one.
+func UseMailer(m Mailer) Mailer {
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	prev := active
+	active = m
+	return prev
+}
+
+// Current returns the mailer emails go through. MAIL_TRANSPORT picks it: "ses" (the
+// default) or "smtp" to deliver, with suppression and retries, or "file" or "memory"
+// to keep emails for inspection instead.
+func Current() Mailer {
+	mailerMu.RLock()
+	m := active
+	mailerMu.RUnlock()
+	if m != nil {
+		return m
 	}
 
-	return nil
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	if active == nil {
+		active = configured()
+		log.Printf("[Mail] Sending emails through %s", active.Name())
+	}
+	return active
+}
+
+func configured() Mailer {
+	from := config.GetEnvRaw("MAILER_ADDRESS")
+	switch transport := strings.ToLower(strings.TrimSpace(config.GetEnvRaw("MAIL_TRANSPORT"))); transport {
+	case TransportSMTP:
+		if f := config.GetEnvRaw("SMTP_FROM"); f != "" {
+			from = f
+		}
+		return reliableMailer{NewSMTPMailer(SMTPConfig{
+			Host:     config.GetEnvRaw("SMTP_HOST"),
+			Port:     config.GetEnvRaw("SMTP_PORT"),
+			Username: config.GetEnvRaw("SMTP_USERNAME"),
+			Password: config.GetEnvRaw("SMTP_PASSWORD"),
+			From:     from,
+		})}
+	case TransportFile:
+		return NewFileMailer(config.GetEnvRaw("MAIL_SINK_DIR"), from)
+	case TransportMemory:
+		return NewMemoryMailer()
+	case "", TransportSES:
+	default:
+		log.Printf("[Mail] Unknown MAIL_TRANSPORT %q, using %s", transport, TransportSES)
+	}
+	return reliableMailer{NewSESMailer(from)}
+}
+
+// bold wraps a value filled into an HTML line
+func bold(s string) string {
+	return "<strong>" + s + "</strong>"
+}
+
+// signedOff ends a plain text body with the team's signature
+func signedOff(locale, text string) string {
+	return text + "\n\n" + i18n.T(locale, "email.signoff")
+}
+
+// Send delivers t through the current mailer.
+func (t *Template) Send() error {
+	return Current().Send(t)
 }
@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/utils"
+)
+
+// Message renders t as a MIME email from from, with the plain text and HTML bodies as
+// alternatives. One-click unsubscribe headers are added when t has a link.
+func (t *Template) Message(from string, now time.Time) []byte {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+
+	header("From", from)
+	header("To", t.ToEmail)
+	header("Subject", mime.QEncoding.Encode("utf-8", t.Subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", utils.GenerateID(), domain(from)))
+	header("MIME-Version", "1.0")
+	if t.Locale != "" {
+		header("Content-Language", t.Locale)
+	}
+	if t.UnsubscribeURL != "" {
+		header("List-Unsubscribe", "<"+t.UnsubscribeURL+">")
+		header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+	writePart(parts, "text/plain", t.Text)
+	if t.HTML != "" {
+		writePart(parts, "text/html", t.HTML)
+	}
+	parts.Close()
+	return buf.Bytes()
+}
+
+func writePart(parts *multipart.Writer, contentType, body string) {
+	w, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return
+	}
+	qp := quotedprintable.NewWriter(w)
+	qp.Write([]byte(body))
+	qp.Close()
+}
+
+// address returns the bare address of a "Name <address>" sender
+func address(from string) string {
+	if a, err := mail.ParseAddress(from); err == nil {
+		return a.Address
+	}
+	return from
+}
+
+func domain(from string) string {
+	if _, d, ok := strings.Cut(address(from), "@"); ok && d != "" {
+		return d
+	}
+	return "localhost"
+}
@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"spark/internal/i18n"
+	"time"
+)
+
+// AccountWarning returns a template for a community guidelines warning
+func AccountWarning(toEmail, locale, reason string, strikes, strikeLimit int) *Template {
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.account_warning.subject"),
+		Text:    signedOff(locale, i18n.T(locale, "email.account_warning.text", "reason", reason, "strikes", strikes, "limit", strikeLimit)),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.account_warning.title"),
+			i18n.T(locale, "email.reason", "reason", bold(reason))+"<br>"+i18n.T(locale, "email.account_warning.strike", "strikes", strikes, "limit", strikeLimit),
+			"",
+			i18n.T(locale, "email.account_warning.cta"),
+		),
+	}
+}
+
+// AccountSuspended returns a template for a temporary suspension
+func AccountSuspended(toEmail, locale, reason string, until time.Time) *Template {
+	untilStr := i18n.FormatDateTime(locale, until)
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.account_suspended.subject"),
+		Text:    signedOff(locale, i18n.T(locale, "email.account_suspended.text", "reason", reason, "until", untilStr)),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.account_suspended.title"),
+			i18n.T(locale, "email.reason", "reason", bold(reason))+"<br>"+i18n.T(locale, "email.account_suspended.restored_on", "until", untilStr),
+			"",
+			i18n.T(locale, "email.cta.appeal"),
+		),
+	}
+}
+
+// AccountBanned returns a template for a permanent ban
+func AccountBanned(toEmail, locale, reason string) *Template {
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.account_banned.subject"),
+		Text:    signedOff(locale, i18n.T(locale, "email.account_banned.text", "reason", reason)),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.account_banned.title"),
+			i18n.T(locale, "email.reason", "reason", bold(reason)),
+			"",
+			i18n.T(locale, "email.cta.appeal"),
+		),
+	}
+}
+
+// AccountRestored returns a template for a lifted ban or suspension
+func AccountRestored(toEmail, locale string) *Template {
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.account_restored.subject"),
+		Text:    signedOff(locale, i18n.T(locale, "email.account_restored.text")),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.account_restored.title"),
+			i18n.T(locale, "email.account_restored.subtitle"),
+			"",
+			i18n.T(locale, "email.cta.open"),
+		),
+	}
+}
+
+// AppealRejected returns a template for a rejected ban appeal
+func AppealRejected(toEmail, locale, note string) *Template {
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.appeal_rejected.subject"),
+		Text:    signedOff(locale, i18n.T(locale, "email.appeal_rejected.text", "note", note)),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.appeal_rejected.title"),
+			i18n.T(locale, "email.appeal_rejected.subtitle"),
+			note,
+			i18n.T(locale, "email.cta.open"),
+		),
+	}
+}
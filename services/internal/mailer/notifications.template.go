@@ -1,111 +1,119 @@
 package mailer
 
-import "fmt"
+import (
+	"spark/internal/i18n"
+	"fmt"
+)
 
 // NewMessage returns a template for new message notification
-func NewMessage(toEmail, senderName, messagePreview string) *Template {
+func NewMessage(toEmail, locale, senderName, messagePreview string) *Template {
 	if len(messagePreview) > 100 {
 		messagePreview = messagePreview[:97] + "..."
 	}
 
 	return &Template{
 		ToEmail: toEmail,
-		Subject: "New message on Spark",
-		Text: fmt.Sprintf(`You have a new message on Spark.
-
-%s sent you a message:
-
-"%s"
-
-Open Spark to reply and continue the conversation.`, senderName, messagePreview),
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.new_message.subject"),
+		Text:    i18n.T(locale, "email.new_message.text", "name", senderName, "preview", messagePreview),
 		HTML: baseTemplate(
-			"New message",
-			fmt.Sprintf(`<strong>%s</strong> sent you a message`, senderName),
+			locale,
+			i18n.T(locale, "email.new_message.title"),
+			i18n.T(locale, "email.new_message.subtitle", "name", bold(senderName)),
 			messagePreview,
-			"Open chat",
+			i18n.T(locale, "email.new_message.cta"),
 		),
 	}
 }
 
 // ProfileViewed returns a template for profile view notification
-func ProfileViewed(toEmail, viewerName string) *Template {
+func ProfileViewed(toEmail, locale, viewerName string) *Template {
 	return &Template{
 		ToEmail: toEmail,
-		Subject: "Someone viewed your profile on Spark",
-		Text: fmt.Sprintf(`Someone viewed your profile on Spark.
-
-%s checked out your profile.
-
-Open Spark to see who’s interested.`, viewerName),
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.profile_viewed.subject"),
+		Text:    i18n.T(locale, "email.profile_viewed.text", "name", viewerName),
 		HTML: baseTemplate(
-			"Profile view",
-			fmt.Sprintf(`<strong>%s</strong> viewed your profile`, viewerName),
+			locale,
+			i18n.T(locale, "email.profile_viewed.title"),
+			i18n.T(locale, "email.profile_viewed.subtitle", "name", bold(viewerName)),
 			"",
-			"View profile",
+			i18n.T(locale, "email.profile_viewed.cta"),
 		),
 	}
 }
 
 // SuperlikeReceived returns a template for superlike notification
-func SuperlikeReceived(toEmail, senderName string) *Template {
+func SuperlikeReceived(toEmail, locale, senderName string) *Template {
 	return &Template{
 		ToEmail: toEmail,
-		Subject: "You received a superlike on Spark",
-		Text: fmt.Sprintf(`You received a superlike on Spark.
-
-%s showed strong interest in your profile.
-
-Open Spark to see more.`, senderName),
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.superlike.subject"),
+		Text:    i18n.T(locale, "email.superlike.text", "name", senderName),
 		HTML: baseTemplate(
-			"Superlike received",
-			fmt.Sprintf(`<strong>%s</strong> superliked you`, senderName),
-			"A superlike signals strong interest.",
-			"See details",
+			locale,
+			i18n.T(locale, "email.superlike.title"),
+			i18n.T(locale, "email.superlike.subtitle", "name", bold(senderName)),
+			i18n.T(locale, "email.superlike.message"),
+			i18n.T(locale, "email.superlike.cta"),
 		),
 	}
 }
 
 // NewMatch returns a template for match notification
-func NewMatch(toEmail, matchName string) *Template {
+func NewMatch(toEmail, locale, matchName string) *Template {
 	return &Template{
 		ToEmail: toEmail,
-		Subject: "It’s a match on Spark",
-		Text: fmt.Sprintf(`It’s a match.
-
-You and %s liked each other.
-
-Start a conversation on Spark.`, matchName),
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.match.subject"),
+		Text:    i18n.T(locale, "email.match.text", "name", matchName),
 		HTML: baseTemplate(
-			"It’s a match",
-			fmt.Sprintf(`You and <strong>%s</strong> liked each other`, matchName),
-			"Start a conversation and explore the connection.",
-			"Start chatting",
+			locale,
+			i18n.T(locale, "email.match.title"),
+			i18n.T(locale, "email.match.subtitle", "name", bold(matchName)),
+			i18n.T(locale, "email.match.message"),
+			i18n.T(locale, "email.match.cta"),
 		),
 	}
 }
 
 // PokeReceived returns a template for poke notification
-func PokeReceived(toEmail, senderName string) *Template {
+func PokeReceived(toEmail, locale, senderName string) *Template {
 	return &Template{
 		ToEmail: toEmail,
-		Subject: "You received a poke on Spark",
-		Text: fmt.Sprintf(`You received a poke on Spark.
-
-%s wants to get your attention.
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.poke.subject"),
+		Text:    i18n.T(locale, "email.poke.text", "name", senderName),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.poke.title"),
+			i18n.T(locale, "email.poke.subtitle", "name", bold(senderName)),
+			i18n.T(locale, "email.poke.message"),
+			i18n.T(locale, "email.poke.cta"),
+		),
+	}
+}
 
-Open Spark to respond.`, senderName),
+// UnlockRequest returns a template for a match asking to reveal photos
+func UnlockRequest(toEmail, locale, requesterName string) *Template {
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.unlock_request.subject", "name", requesterName),
+		Text:    i18n.T(locale, "email.unlock_request.text", "name", requesterName),
 		HTML: baseTemplate(
-			"You got a poke",
-			fmt.Sprintf(`<strong>%s</strong> poked you`, senderName),
-			"Curious? You can choose to engage or ignore.",
-			"View poke",
+			locale,
+			i18n.T(locale, "email.unlock_request.title"),
+			i18n.T(locale, "email.unlock_request.subtitle", "name", bold(requesterName)),
+			i18n.T(locale, "email.unlock_request.message"),
+			i18n.T(locale, "email.cta.open"),
 		),
 	}
 }
 
 /* ---------- Shared base template ---------- */
 
-func baseTemplate(title, subtitle, message, cta string) string {
+func baseTemplate(locale, title, subtitle, message, cta string) string {
 	messageBlock := ""
 	if message != "" {
 		messageBlock = fmt.Sprintf(`
@@ -115,10 +123,14 @@ func baseTemplate(title, subtitle, message, cta string) string {
 			</p>
 		</div>`, message)
 	}
+	return layout(locale, title, subtitle, messageBlock, cta)
+}
 
+// layout wraps body, raw HTML, in the shared email layout
+func layout(locale, title, subtitle, body, cta string) string {
 	return fmt.Sprintf(`
 <!DOCTYPE html>
-<html>
+<html lang="%s">
 <head>
 <meta charset="utf-8">
 <meta name="viewport" content="width=device-width, initial-scale=1">
@@ -150,11 +162,12 @@ func baseTemplate(title, subtitle, message, cta string) string {
 
 		<div style="border-top:1px solid rgba(255,255,255,0.06);padding:16px;text-align:center;">
 			<p style="margin:0;color:rgba(255,255,255,0.35);font-size:12px;">
-				© 2025 Spark · Personality first, always
+				%s
 			</p>
+			`+unsubscribeMarker+`
 		</div>
 	</div>
 </body>
 </html>
-`, title, subtitle, messageBlock, cta)
+`, i18n.Normalize(locale), title, subtitle, body, cta, i18n.T(locale, "email.footer"))
 }
@@ -0,0 +1,201 @@
+package mailer
+
+import (
+	"spark/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+	"github.com/MelloB1989/karma/utils"
+)
+
+const (
+	// maxAttempts is how many times an email is tried, counting the first send, before
+	// it's given up on. Retries wait retryBase, doubling up to retryMax.
+	maxAttempts = 6
+	retryBase   = time.Minute
+	retryMax    = time.Hour
+
+	queueInterval = 15 * time.Second
+	queueBatch    = 100
+	// sendLease is how long a claimed email is left alone before another worker
+	// assumes the send died
+	sendLease = 5 * time.Minute
+
+	// retention is how long queue rows are kept once they're created
+	retention       = 7 * 24 * time.Hour
+	cleanupInterval = time.Hour
+)
+
+// Queue statuses
+const (
+	statusPending = "pending"
+	statusSending = "sending"
+	statusSent    = "sent"
+	statusFailed  = "failed"
+)
+
+// retryDelay is how long to wait after an email's attempts-th failed try
+func retryDelay(attempts int) time.Duration {
+	if attempts < 1 {
+		attempts = 1
+	}
+	d := retryBase
+	for i := 1; i < attempts && d < retryMax; i++ {
+		d *= 2
+	}
+	return min(d, retryMax)
+}
+
+// execer is the part of a database handle the queue writes through
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// enqueue queues t for a retry after its first send failed with sendErr.
+func enqueue(t *Template, sendErr error) error {
+	now := time.Now()
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`
+		INSERT INTO email_messages (id, to_email, locale, subject, text, html, unsubscribe_url,
+			status, attempts, next_attempt_at, last_error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 1, $9, $10, $11, $11)
+	`, utils.GenerateID(), t.ToEmail, t.Locale, t.Subject, t.Text, t.HTML, t.UnsubscribeURL,
+		statusPending, now.Add(retryDelay(1)), sendErr.Error(), now); err != nil {
+		return fmt.Errorf("failed to queue email: %w", err)
+	}
+	return nil
+}
+
+// Run retries queued emails and prunes old rows until ctx is cancelled.
+func Run(ctx context.Context) {
+	ticker := time.NewTicker(queueInterval)
+	defer ticker.Stop()
+	var lastCleanup time.Time
+	for {
+		now := time.Now()
+		if n, err := ProcessQueue(now); err != nil {
+			log.Printf("[Mail] Queue run failed: %v", err)
+		} else if n > 0 {
+			log.Printf("[Mail] Retried %d queued emails", n)
+		}
+		if now.Sub(lastCleanup) >= cleanupInterval {
+			lastCleanup = now
+			cleanup(now)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessQueue claims the emails due at now, sends them and returns how many were
+// tried. Replicas skip each other's rows.
+func ProcessQueue(now time.Time) (int, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		UPDATE email_messages SET status = $1, locked_until = $2, updated_at = $3
+		WHERE id IN (
+			SELECT id FROM email_messages
+			WHERE (status = $4 AND next_attempt_at <= $3) OR (status = $1 AND locked_until < $3)
+			ORDER BY next_attempt_at
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, to_email, locale, subject, text, html, unsubscribe_url, attempts
+	`, statusSending, now.Add(sendLease), now, statusPending, queueBatch)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim emails: %w", err)
+	}
+	var claimed []models.EmailMessage
+	for rows.Next() {
+		var m models.EmailMessage
+		if err := rows.Scan(&m.Id, &m.ToEmail, &m.Locale, &m.Subject, &m.Text, &m.Html, &m.UnsubscribeUrl, &m.Attempts); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan email: %w", err)
+		}
+		claimed = append(claimed, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("emails iteration error: %w", err)
+	}
+
+	m := backend()
+	for _, msg := range claimed {
+		err := deliver(m, &Template{
+			ToEmail:        msg.ToEmail,
+			Locale:         msg.Locale,
+			Subject:        msg.Subject,
+			Text:           msg.Text,
+			HTML:           msg.Html,
+			UnsubscribeURL: msg.UnsubscribeUrl,
+		})
+		settle(db, msg, err, now)
+	}
+	return len(claimed), nil
+}
+
+// settle records the outcome of an email's latest try. Retries past maxAttempts fail.
+func settle(db execer, m models.EmailMessage, sendErr error, now time.Time) {
+	attempts := m.Attempts + 1
+	var err error
+	switch {
+	case sendErr == nil:
+		_, err = db.Exec(`
+			UPDATE email_messages SET status = $2, attempts = $3, locked_until = NULL,
+				last_error = '', updated_at = $4
+			WHERE id = $1
+		`, m.Id, statusSent, attempts, now)
+	case IsPermanent(sendErr) || attempts >= maxAttempts:
+		log.Printf("[Mail] Giving up on %q for %s after %d attempts: %v", m.Subject, m.ToEmail, attempts, sendErr)
+		_, err = db.Exec(`
+			UPDATE email_messages SET status = $2, attempts = $3, locked_until = NULL,
+				last_error = $4, updated_at = $5
+			WHERE id = $1
+		`, m.Id, statusFailed, attempts, sendErr.Error(), now)
+	default:
+		_, err = db.Exec(`
+			UPDATE email_messages SET status = $2, attempts = $3, next_attempt_at = $4,
+				locked_until = NULL, last_error = $5, updated_at = $6
+			WHERE id = $1
+		`, m.Id, statusPending, attempts, now.Add(retryDelay(attempts)), sendErr.Error(), now)
+	}
+	if err != nil {
+		log.Printf("[Mail] Failed to update email %s: %v", m.Id, err)
+	}
+}
+
+// cleanup deletes queue rows older than retention
+func cleanup(now time.Time) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		log.Printf("[Mail] Failed to connect to database: %v", err)
+		return
+	}
+	defer db.Close()
+
+	res, err := db.Exec(`DELETE FROM email_messages WHERE created_at < $1`, now.Add(-retention))
+	if err != nil {
+		log.Printf("[Mail] Failed to prune email queue: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("[Mail] Pruned %d old emails", n)
+	}
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"strings"
+
+	"github.com/MelloB1989/karma/mails"
+	m "github.com/MelloB1989/karma/models"
+)
+
+// sesPermanentErrors are SES error codes retrying won't fix
+var sesPermanentErrors = []string{"MessageRejected", "MailFromDomainNotVerified", "InvalidParameterValue"}
+
+// SESMailer sends through Amazon SES with the AWS credentials in the environment.
+// Bounces and complaints come back through the SES webhook.
+type SESMailer struct {
+	From string
+}
+
+func NewSESMailer(from string) *SESMailer {
+	return &SESMailer{From: from}
+}
+
+func (s *SESMailer) Name() string { return TransportSES }
+
+func (s *SESMailer) Send(t *Template) error {
+	km := mails.NewKarmaMail(s.From, mails.AWS_SES)
+
+	err := km.SendSingleMail(m.SingleEmailRequest{
+		To: t.ToEmail,
+		Email: m.Email{
+			Subject: t.Subject,
+			Body: m.EmailBody{
+				Text: t.Text,
+				HTML: t.HTML,
+			},
+		},
+	})
+	if err == nil {
+		return nil
+	}
+	for _, code := range sesPermanentErrors {
+		if strings.Contains(err.Error(), code) {
+			return permanent(err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultSinkDir = "tmp/mail"
+
+// FileMailer writes each email to Dir as an .eml file instead of sending it, for
+// opening in a mail client during development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	if dir == "" {
+		dir = defaultSinkDir
+	}
+	if from == "" {
+		from = "Spark <no-reply@localhost>"
+	}
+	return &FileMailer{Dir: dir, From: from}
+}
+
+func (f *FileMailer) Name() string { return TransportFile }
+
+func (f *FileMailer) Send(t *Template) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102-150405.000000"), safeName(t.ToEmail))
+	path := filepath.Join(f.Dir, name)
+	if err := os.WriteFile(path, t.Message(f.From, now), 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	log.Printf("[Mail] Wrote %q for %s to %s", t.Subject, t.ToEmail, path)
+	return nil
+}
+
+// safeName keeps the characters of an address that are safe in a file name
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// MemoryMailer keeps emails instead of sending them, for tests and local development.
+type MemoryMailer struct {
+	mu   sync.Mutex
+	sent []*Template
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Name() string { return TransportMemory }
+
+func (m *MemoryMailer) Send(t *Template) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, t)
+	return nil
+}
+
+// Sent returns the emails sent so far, oldest first.
+func (m *MemoryMailer) Sent() []*Template {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Template(nil), m.sent...)
+}
+
+// Reset forgets the emails sent so far.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = nil
+}
@@ -0,0 +1,106 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+)
+
+const (
+	defaultSMTPPort = "587"
+	smtpTimeout     = 30 * time.Second
+)
+
+// SMTPConfig says how to reach an SMTP relay.
+type SMTPConfig struct {
+	Host     string
+	Port     string // 587 when empty
+	Username string // No AUTH when empty
+	Password string
+	From     string
+}
+
+// SMTPMailer sends through an SMTP relay, upgrading the connection with STARTTLS when
+// the server offers it. Credentials are only sent over TLS, or to localhost.
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	if cfg.Port == "" {
+		cfg.Port = defaultSMTPPort
+	}
+	return &SMTPMailer{cfg: cfg}
+}
+
+func (s *SMTPMailer) Name() string { return TransportSMTP }
+
+func (s *SMTPMailer) Send(t *Template) error {
+	if s.cfg.Host == "" {
+		return permanent(errors.New("SMTP_HOST is not configured"))
+	}
+	now := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.cfg.Host, s.cfg.Port), smtpTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	conn.SetDeadline(now.Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return smtpError("greeting", err, false)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return smtpError("auth", err, false)
+		}
+	}
+	if err := c.Mail(address(s.cfg.From)); err != nil {
+		return smtpError("MAIL FROM", err, false)
+	}
+	if err := c.Rcpt(t.ToEmail); err != nil {
+		return smtpError("RCPT TO", err, true)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return smtpError("DATA", err, false)
+	}
+	if _, err := w.Write(t.Message(s.cfg.From, now)); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return smtpError("DATA", err, false)
+	}
+	if err := c.Quit(); err != nil {
+		// The server has taken the message, so retrying would send it twice
+		log.Printf("[Mail] SMTP QUIT failed after %q was accepted for %s: %v", t.Subject, t.ToEmail, err)
+	}
+	return nil
+}
+
+// smtpError classifies a failed command. 5xx replies are permanent, and a 5xx refusing
+// the recipient means the address doesn't exist; anything else can be retried.
+func smtpError(command string, err error, recipient bool) error {
+	err = fmt.Errorf("SMTP %s failed: %w", command, err)
+	var reply *textproto.Error
+	if !errors.As(err, &reply) || reply.Code < 500 {
+		return err
+	}
+	if recipient && (reply.Code == 550 || reply.Code == 551 || reply.Code == 553) {
+		return bounced(err)
+	}
+	return permanent(err)
+}
@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"spark/internal/i18n"
+	"time"
+)
+
+// RenewalReminder returns a template reminding a subscriber their plan renews soon
+func RenewalReminder(toEmail, locale, planName, price string, renewsAt time.Time) *Template {
+	renewsStr := i18n.FormatDate(locale, renewsAt)
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.renewal_reminder.subject", "plan", planName, "date", renewsStr),
+		Text:    signedOff(locale, i18n.T(locale, "email.renewal_reminder.text", "plan", planName, "date", renewsStr, "price", price)),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.renewal_reminder.title"),
+			i18n.T(locale, "email.renewal_reminder.subtitle", "plan", bold(planName), "date", renewsStr, "price", price),
+			"",
+			i18n.T(locale, "email.renewal_reminder.cta"),
+		),
+	}
+}
+
+// PaymentFailed returns a template asking a subscriber to fix a failed payment before
+// their grace period ends
+func PaymentFailed(toEmail, locale, planName string, graceUntil time.Time) *Template {
+	graceStr := i18n.FormatDate(locale, graceUntil)
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.payment_failed.subject"),
+		Text:    signedOff(locale, i18n.T(locale, "email.payment_failed.text", "plan", planName, "date", graceStr)),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.payment_failed.title"),
+			i18n.T(locale, "email.payment_failed.not_renewed", "plan", bold(planName))+"<br>"+i18n.T(locale, "email.payment_failed.update_by", "date", graceStr),
+			"",
+			i18n.T(locale, "email.payment_failed.cta"),
+		),
+	}
+}
+
+// SubscriptionExpired returns a template telling a subscriber their plan has ended
+func SubscriptionExpired(toEmail, locale, planName string) *Template {
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.subscription_expired.subject", "plan", planName),
+		Text:    signedOff(locale, i18n.T(locale, "email.subscription_expired.text", "plan", planName)),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.subscription_expired.title"),
+			i18n.T(locale, "email.subscription_expired.subtitle", "plan", bold(planName)),
+			"",
+			i18n.T(locale, "email.subscription_expired.cta"),
+		),
+	}
+}
@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/MelloB1989/karma/database"
+)
+
+// Suppression reasons
+const (
+	ReasonBounce    = "bounce"
+	ReasonComplaint = "complaint"
+	ReasonManual    = "manual"
+)
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Suppress stops emails to email. Suppressing an address again keeps the first reason.
+func Suppress(email, reason, details string) error {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`
+		INSERT INTO email_suppressions (email, reason, details, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (email) DO NOTHING
+	`, normalizeEmail(email), reason, details, time.Now()); err != nil {
+		return fmt.Errorf("failed to suppress email: %w", err)
+	}
+	log.Printf("[Mail] Suppressed %s (%s)", email, reason)
+	return nil
+}
+
+// Unsuppress lets emails go to email again, e.g. once a user fixes their mailbox.
+func Unsuppress(email string) error {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`DELETE FROM email_suppressions WHERE email = $1`, normalizeEmail(email)); err != nil {
+		return fmt.Errorf("failed to unsuppress email: %w", err)
+	}
+	return nil
+}
+
+// IsSuppressed reports whether emails to email are stopped.
+func IsSuppressed(email string) (bool, error) {
+	db, err := database.PostgresConn()
+	if err != nil {
+		return false, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var reason string
+	err = db.QueryRow(`SELECT reason FROM email_suppressions WHERE email = $1`, normalizeEmail(email)).Scan(&reason)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check email suppression: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"spark/internal/i18n"
+	"time"
+)
+
+// VerificationApproved returns a template for an approved photo verification
+func VerificationApproved(toEmail, locale string) *Template {
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.verification_approved.subject"),
+		Text:    signedOff(locale, i18n.T(locale, "email.verification_approved.text")),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.verification_approved.title"),
+			i18n.T(locale, "email.verification_approved.subtitle"),
+			"",
+			i18n.T(locale, "email.cta.open"),
+		),
+	}
+}
+
+// VerificationRejected returns a template for a rejected photo verification
+func VerificationRejected(toEmail, locale, reason string, resubmitAt time.Time) *Template {
+	resubmitStr := i18n.FormatDateTime(locale, resubmitAt)
+	return &Template{
+		ToEmail: toEmail,
+		Locale:  locale,
+		Subject: i18n.T(locale, "email.verification_rejected.subject"),
+		Text:    signedOff(locale, i18n.T(locale, "email.verification_rejected.text", "reason", reason, "date", resubmitStr)),
+		HTML: baseTemplate(
+			locale,
+			i18n.T(locale, "email.verification_rejected.title"),
+			i18n.T(locale, "email.reason", "reason", bold(reason))+"<br>"+i18n.T(locale, "email.verification_rejected.try_again", "date", resubmitStr),
+			"",
+			i18n.T(locale, "email.cta.open"),
+		),
+	}
+}
@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"spark/internal/helpers/impersonation"
+	"spark/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BlockImpersonation refuses impersonation tokens. It runs after IsUserVerified or
+// IsWebsocketVerified, on routes that would act for the user or leak what only they
+// should see.
+func BlockImpersonation(c *fiber.Ctx) error {
+	if claims, ok := c.Locals("claims").(*models.Claims); ok && claims.IsImpersonation() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Forbidden",
+			"error":   impersonation.ErrNotAllowed.Error(),
+		})
+	}
+	return c.Next()
+}
@@ -2,6 +2,9 @@ package middlewares
 
 import (
 	"spark/internal/anal"
+	"spark/internal/helpers/impersonation"
+	"spark/internal/helpers/moderation"
+	"spark/internal/helpers/users"
 	"spark/internal/models"
 	"errors"
 	"strings"
@@ -51,8 +54,27 @@ func IsUserVerified(c *fiber.Ctx) error {
 	}
 
 	if claims, ok := token.Claims.(*models.Claims); ok && token.Valid {
+		if err := moderation.CheckAccess(claims.UserID); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Forbidden",
+				"error":   err.Error(),
+			})
+		}
+		// Impersonation tokens are read-only and don't count as the user being active
+		if claims.IsImpersonation() {
+			if c.Method() != fiber.MethodGet {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"message": "Forbidden",
+					"error":   impersonation.ErrReadOnly.Error(),
+				})
+			}
+		} else {
+			go users.TouchLastActive(claims.UserID)
+		}
+
 		// Store the claims in the context's locals
 		// fmt.Println(claims.UserID)
+		c.Locals("claims", claims)
 		c.Locals("uid", claims.UserID)
 		c.Locals("email", claims.Email)
 		c.Locals("gender", claims.Gender)
@@ -2,6 +2,8 @@ package middlewares
 
 import (
 	"spark/internal/anal"
+	"spark/internal/helpers/impersonation"
+	"spark/internal/helpers/moderation"
 	"spark/internal/models"
 	"errors"
 	"strings"
@@ -61,6 +63,23 @@ func IsWebsocketVerified(c *fiber.Ctx) error {
 	}
 
 	if claims, ok := token.Claims.(*models.Claims); ok && token.Valid {
+		if err := moderation.CheckAccess(claims.UserID); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Forbidden",
+				"error":   err.Error(),
+			})
+		}
+		// Impersonated sockets are read-only; the handlers refuse anything else
+		if claims.IsImpersonation() {
+			if err := impersonation.Authorize(claims, "query", "websocket", c.Path()); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"message": "Forbidden",
+					"error":   err.Error(),
+				})
+			}
+		}
+
+		c.Locals("claims", claims)
 		c.Locals("uid", claims.UserID)
 		c.Locals("email", claims.Email)
 		c.Locals("gender", claims.Gender)
@@ -23,6 +23,15 @@ type Media struct {
 	Type      string    `json:"type"`
 	Url       string    `json:"url"`
 	CreatedAt time.Time `json:"created_at"`
+	// Set for chat media, which must reference a file uploaded through /v1/fs/upload
+	FileId     string    `json:"file_id,omitempty"`
+	MimeType   string    `json:"mime_type,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	DurationMs int       `json:"duration_ms,omitempty"` // Audio only
+	Waveform   []float64 `json:"waveform,omitempty"`    // Audio only, peaks scaled to 0-1
+	BlurredUrl string    `json:"blurred_url,omitempty"` // Shown instead of Url while the match is locked
+	// Set while the blurred copy is still being made; until then there is nothing to show
+	BlurPending bool `json:"blur_pending,omitempty"`
 }
 
 type Reaction struct {
@@ -34,6 +43,7 @@ type Reaction struct {
 
 type Message struct {
 	Id        string      `json:"id"`
+	ClientId  string      `json:"client_id,omitempty"` // Id generated by the sending client, used to dedupe resends
 	Type      MessageType `json:"type"`
 	Content   string      `json:"content"`
 	SenderId  string      `json:"sender_id"`
@@ -41,8 +51,11 @@ type Message struct {
 	Seen      bool        `json:"seen"`
 	Media     []Media     `json:"media" db:"media"`
 	Reactions []Reaction  `json:"reactions" db:"reactions"`
-	CreatedAt time.Time   `json:"created_at"`
-	UpdatedAt time.Time   `json:"updated_at"`
+	// Per recipient user id, when the message reached their device and when they read it
+	DeliveredAt map[string]time.Time `json:"delivered_at,omitempty"`
+	SeenAt      map[string]time.Time `json:"seen_at,omitempty"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
 }
 
 type Claims struct {
@@ -53,9 +66,18 @@ type Claims struct {
 	DateOfBirth string `json:"date_of_birth"`
 	Name        string `json:"name"`
 	Pfp         string `json:"pfp"`
+	// Set on read-only tokens staff use to view the app as this user
+	ImpersonatedBy  string `json:"imp_by,omitempty"`
+	ImpersonationId string `json:"imp_id,omitempty"`
 	jwt.StandardClaims
 }
 
+// IsImpersonation reports whether the token was issued to a staff member viewing the
+// app as the user.
+func (c *Claims) IsImpersonation() bool {
+	return c.ImpersonatedBy != ""
+}
+
 type ResponseHTTP struct {
 	Success bool   `json:"success"`
 	Data    any    `json:"data"`
@@ -12,6 +12,7 @@ type User struct {
 	FirstName         string         `json:"first_name"`
 	LastName          string         `json:"last_name"`
 	Email             string         `json:"email"`
+	EmailVerifiedAt   *time.Time     `json:"email_verified_at"`    // Set once the user proved they own the email
 	PasswordHash      string         `json:"-" db:"password_hash"` // bcrypt hash for native auth; empty when using WorkOS
 	Dob               time.Time      `json:"dob"`
 	Pfp               string         `json:"pfp"`
@@ -26,18 +27,22 @@ type User struct {
 	IsVerified        bool           `json:"is_verified"`
 	Address           Address        `json:"address" db:"address"`
 	Extra             ExtraMetadata  `json:"extra" db:"extra"`
+	PreferredLocale   string         `json:"preferred_locale"` // language for emails and pushes, see i18n
 	// Admin & subscription fields
-	Role               string    `json:"role"` // "user", "admin", "moderator"
-	IsBanned           bool      `json:"is_banned"`
-	SubscriptionPlanId string    `json:"subscription_plan_id"`
+	Role               string     `json:"role"` // "user", "admin", "moderator"
+	IsBanned           bool       `json:"is_banned"`
+	SuspendedUntil     *time.Time `json:"suspended_until"`
+	IsShadowBanned     bool       `json:"is_shadow_banned"` // hidden from everyone but themselves
+	SubscriptionPlanId string     `json:"subscription_plan_id"`
 	// AI usage tracking
 	AiRepliesUsedToday int       `json:"ai_replies_used_today"`
 	LastAiReset        time.Time `json:"last_ai_reset"`
 	// Swipe tracking
-	SwipesToday    int       `json:"swipes_today"`
-	LastSwipeReset time.Time `json:"last_swipe_reset"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	SwipesToday    int        `json:"swipes_today"`
+	LastSwipeReset time.Time  `json:"last_swipe_reset"`
+	LastActiveAt   *time.Time `json:"last_active_at"` // Updated at most every few minutes
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 }
 
 type Match struct {
@@ -100,6 +105,10 @@ type UserFiles struct {
 	Key        string    `json:"key"`
 	S3Path     string    `json:"s3_path"`
 	Visibility string    `json:"visibility"`
+	MimeType   string    `json:"mime_type"`
+	Size       int64     `json:"size"`
+	DurationMs int       `json:"duration_ms"`            // Audio only
+	Waveform   []float64 `json:"waveform" db:"waveform"` // Audio only
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 }
@@ -127,10 +136,16 @@ type Report struct {
 	Id             string    `json:"id" karma:"primary"`
 	UserId         string    `json:"user_id"`
 	TargetId       string    `json:"target_id"`
+	TargetType     string    `json:"target_type"` // "user", "post", "comment"
+	SubjectId      string    `json:"subject_id"`  // The reported user; the author for posts and comments
+	ChatId         string    `json:"chat_id"`     // Chat the reported user was met in, if any
+	Category       string    `json:"category"`
+	Severity       int       `json:"severity"`
+	GroupId        string    `json:"group_id"`
 	Reason         string    `json:"reason"`
 	AdditionalInfo string    `json:"additional_info"`
 	Media          []Media   `json:"media" db:"media"`
-	Status         string    `json:"status"`
+	Status         string    `json:"status"` // "pending", "resolved", "dismissed", "action_taken"
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
@@ -145,13 +160,19 @@ type AIChat struct {
 }
 
 type UserVerification struct {
-	TableName string    `karma_table:"user_verifications" json:"-"`
-	Id        string    `json:"id" karma:"primary"`
-	UserId    string    `json:"user_id"`
-	Media     []Media   `json:"media" db:"media"`
-	Status    string    `json:"status"` // "pending", "verified", "failed"
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	TableName       string     `karma_table:"user_verifications" json:"-"`
+	Id              string     `json:"id" karma:"primary"`
+	UserId          string     `json:"user_id"`
+	Media           []Media    `json:"media" db:"media"`
+	Status          string     `json:"status"` // "requested", "in_review", "verified", "rejected", "resubmitted"
+	Attempt         int        `json:"attempt"`
+	RejectionReason string     `json:"rejection_reason"`
+	ReviewerId      string     `json:"reviewer_id"`
+	ReviewedAt      *time.Time `json:"reviewed_at"`
+	FaceMatchScore  *float64   `json:"face_match_score"` // Best selfie vs profile photo similarity, 0-1
+	FaceMatcher     string     `json:"face_matcher"`     // Name of the comparer that produced FaceMatchScore
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type BlockedUser struct {
@@ -176,6 +197,99 @@ type UserPushToken struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// PushMessage is a push to one device in the delivery queue.
+type PushMessage struct {
+	TableName      string     `karma_table:"push_messages" json:"-"`
+	Id             string     `json:"id" karma:"primary"`
+	NotificationId string     `json:"notification_id"` // Shared by the rows of one notification
+	UserId         string     `json:"user_id"`
+	Token          string     `json:"token"`
+	Message        []byte     `json:"message"` // The Expo message as JSON
+	Status         string     `json:"status"`  // "pending", "sending", "sent", "delivered", "failed"
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LockedUntil    *time.Time `json:"locked_until"`
+	TicketId       string     `json:"ticket_id"`
+	LastError      string     `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// EmailMessage is an email waiting in the retry queue.
+type EmailMessage struct {
+	TableName      string     `karma_table:"email_messages" json:"-"`
+	Id             string     `json:"id" karma:"primary"`
+	ToEmail        string     `json:"to_email"`
+	Locale         string     `json:"locale"`
+	Subject        string     `json:"subject"`
+	Text           string     `json:"text"`
+	Html           string     `json:"html"`
+	UnsubscribeUrl string     `json:"unsubscribe_url"`
+	Status         string     `json:"status"` // "pending", "sending", "sent", "failed"
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LockedUntil    *time.Time `json:"locked_until"`
+	LastError      string     `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// EmailSuppression is an address that isn't emailed anymore.
+type EmailSuppression struct {
+	TableName string    `karma_table:"email_suppressions" json:"-"`
+	Email     string    `json:"email" karma:"primary"` // Lowercased
+	Reason    string    `json:"reason"`                // "bounce", "complaint", "manual"
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NotificationChannels says where one type of notification is delivered.
+type NotificationChannels struct {
+	Push  bool `json:"push"`
+	Email bool `json:"email"`
+	InApp bool `json:"in_app"`
+}
+
+// NotificationSettings are a user's notification preferences. Event types missing from
+// Events use their defaults.
+type NotificationSettings struct {
+	TableName       string                          `karma_table:"notification_preferences" json:"-"`
+	UserId          string                          `json:"user_id" karma:"primary"`
+	Events          map[string]NotificationChannels `json:"events" db:"events"`
+	QuietHoursStart string                          `json:"quiet_hours_start"` // "22:00"; empty when off
+	QuietHoursEnd   string                          `json:"quiet_hours_end"`
+	Timezone        string                          `json:"timezone"`         // IANA name, e.g. "Asia/Kolkata"
+	DigestFrequency string                          `json:"digest_frequency"` // "daily" or "weekly"
+	LastDigestAt    *time.Time                      `json:"last_digest_at"`
+	UpdatedAt       time.Time                       `json:"updated_at"`
+}
+
+// Notification is an entry in a user's in-app notification center.
+type Notification struct {
+	TableName string     `karma_table:"notifications" json:"-"`
+	Id        string     `json:"id" karma:"primary"`
+	UserId    string     `json:"user_id"`
+	Event     string     `json:"event"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Link      string     `json:"link"` // App route the entry opens, e.g. "spark://chat/abc"
+	ActorId   string     `json:"actor_id"`
+	DedupeKey string     `json:"dedupe_key"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// NotificationDigestItem is a low-priority notification waiting for the next digest email.
+type NotificationDigestItem struct {
+	TableName string    `karma_table:"notification_digest_items" json:"-"`
+	Id        string    `json:"id" karma:"primary"`
+	UserId    string    `json:"user_id"`
+	Event     string    `json:"event"`
+	ActorId   string    `json:"actor_id"`
+	Summary   string    `json:"summary"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // ==================== Subscriptions ====================
 
 type SubscriptionFeatures struct {
@@ -196,20 +310,31 @@ type SubscriptionLimits struct {
 	BoostsPerMonth  int `json:"boosts_per_month"`
 }
 
+// PlanProducts are the ids a plan is sold under at each payment provider
+type PlanProducts struct {
+	DodoMonthly   string `json:"dodo_monthly"`
+	DodoYearly    string `json:"dodo_yearly"`
+	RevcatMonthly string `json:"revcat_monthly"`
+	RevcatYearly  string `json:"revcat_yearly"`
+}
+
 type SubscriptionPlan struct {
-	TableName       string               `karma_table:"subscription_plans" json:"-"`
-	Id              string               `json:"id" karma:"primary"` // "free", "plus", "pro", "elite"
-	Name            string               `json:"name"`
-	Description     string               `json:"description"`
-	PriceMonthly    int                  `json:"price_monthly"` // cents
-	PriceYearly     int                  `json:"price_yearly"`  // cents
-	Features        SubscriptionFeatures `json:"features" db:"features"`
-	Limits          SubscriptionLimits   `json:"limits" db:"limits"`
-	DodoProductId   string               `json:"dodo_product_id"`
-	RevcatOfferingId string              `json:"revcat_offering_id"`
-	IsActive        bool                 `json:"is_active"`
-	SortOrder       int                  `json:"sort_order"`
-	CreatedAt       time.Time            `json:"created_at"`
+	TableName        string               `karma_table:"subscription_plans" json:"-"`
+	Id               string               `json:"id" karma:"primary"` // "free", "plus", "pro", "elite"
+	Name             string               `json:"name"`
+	Description      string               `json:"description"`
+	PriceMonthly     int                  `json:"price_monthly"` // cents
+	PriceYearly      int                  `json:"price_yearly"`  // cents
+	Features         SubscriptionFeatures `json:"features" db:"features"`
+	Limits           SubscriptionLimits   `json:"limits" db:"limits"`
+	ProductIds       PlanProducts         `json:"product_ids" db:"product_ids"`
+	RevcatOfferingId string               `json:"revcat_offering_id"`
+	BasePlanId       string               `json:"base_plan_id"`   // Set on A/B price variants of another plan
+	VariantWeight    int                  `json:"variant_weight"` // Percent of users offered this variant
+	IsActive         bool                 `json:"is_active"`
+	SortOrder        int                  `json:"sort_order"`
+	CreatedAt        time.Time            `json:"created_at"`
+	UpdatedAt        time.Time            `json:"updated_at"`
 }
 
 type UserSubscription struct {
@@ -217,18 +342,127 @@ type UserSubscription struct {
 	Id                     string     `json:"id" karma:"primary"`
 	UserId                 string     `json:"user_id"`
 	PlanId                 string     `json:"plan_id"`
-	Status                 string     `json:"status"` // "active", "cancelled", "expired", "paused"
-	Provider               string     `json:"provider"` // "dodo", "revcat", "manual"
+	Status                 string     `json:"status"`   // "active", "cancelled", "expired", "paused", "refunded"
+	Provider               string     `json:"provider"` // "dodo", "revcat", "ses", "manual"
 	ProviderSubscriptionId string     `json:"provider_subscription_id"`
 	ProviderCustomerId     string     `json:"provider_customer_id"`
 	CurrentPeriodStart     time.Time  `json:"current_period_start"`
 	CurrentPeriodEnd       time.Time  `json:"current_period_end"`
 	CancelAtPeriodEnd      bool       `json:"cancel_at_period_end"`
 	CancelledAt            *time.Time `json:"cancelled_at"`
+	BillingPeriod          string     `json:"billing_period"` // "monthly", "yearly"
+	AmountPaid             int        `json:"amount_paid"`    // cents, for the current period
+	Currency               string     `json:"currency"`
+	PausedAt               *time.Time `json:"paused_at"`
+	ResumeAt               *time.Time `json:"resume_at"` // When a paused subscription resumes by itself
+	BillingIssueAt         *time.Time `json:"billing_issue_at"`
+	GraceUntil             *time.Time `json:"grace_until"` // Access continues until then while a failed payment is retried
+	DunningReminders       int        `json:"dunning_reminders"`
+	LastDunningAt          *time.Time `json:"last_dunning_at"`
+	RenewalRemindedFor     *time.Time `json:"renewal_reminded_for"` // Period end the last renewal reminder was sent for
 	CreatedAt              time.Time  `json:"created_at"`
 	UpdatedAt              time.Time  `json:"updated_at"`
 }
 
+// WebhookEvent is a payment provider webhook as received, kept so redeliveries are
+// recognised and failed events can be replayed.
+type WebhookEvent struct {
+	TableName   string     `karma_table:"webhook_events" json:"-"`
+	Id          string     `json:"id" karma:"primary"`
+	Provider    string     `json:"provider"` // "dodo", "revcat", "ses"
+	EventId     string     `json:"event_id"` // The provider's id for the event
+	EventType   string     `json:"event_type"`
+	Subject     string     `json:"subject"` // Subscription or app user the event is about
+	Ordered     bool       `json:"ordered"` // Set for state changes, which are skipped when older than the last one applied
+	OccurredAt  time.Time  `json:"occurred_at"`
+	Payload     string     `json:"payload"` // Raw request body
+	Status      string     `json:"status"`  // "processing", "processed", "failed", "skipped"
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error"`
+	ReceivedAt  time.Time  `json:"received_at"`
+	AttemptedAt *time.Time `json:"attempted_at"`
+	ProcessedAt *time.Time `json:"processed_at"`
+}
+
+// BillingEvent is one entry in a user's billing history.
+type BillingEvent struct {
+	TableName       string         `karma_table:"billing_events" json:"-"`
+	Id              string         `json:"id" karma:"primary"`
+	UserId          string         `json:"user_id"`
+	SubscriptionId  string         `json:"subscription_id"`
+	Type            string         `json:"type"` // "subscription.created", "plan.changed", "refund", ...
+	PlanId          string         `json:"plan_id"`
+	PreviousPlanId  string         `json:"previous_plan_id"`
+	Amount          int            `json:"amount"` // cents; negative for refunds and credits
+	Currency        string         `json:"currency"`
+	Provider        string         `json:"provider"`
+	ProviderEventId string         `json:"provider_event_id"` // Set for events from provider webhooks
+	ActorId         string         `json:"actor_id"`          // Staff member, for admin actions
+	Reason          string         `json:"reason"`
+	Details         map[string]any `json:"details" db:"details"`
+	CreatedAt       time.Time      `json:"created_at"`
+}
+
+// PromoCode is a code users redeem for a discount or days of a plan.
+type PromoCode struct {
+	TableName      string     `karma_table:"promo_codes" json:"-"`
+	Id             string     `json:"id" karma:"primary"`
+	Code           string     `json:"code"` // Stored uppercase
+	Kind           string     `json:"kind"` // "percent_off", "plan_days", "trial"
+	PlanId         string     `json:"plan_id"`
+	PercentOff     int        `json:"percent_off"`
+	Days           int        `json:"days"`
+	MaxRedemptions int        `json:"max_redemptions"` // 0 for no limit
+	Redemptions    int        `json:"redemptions"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+	IsActive       bool       `json:"is_active"`
+	CreatedBy      string     `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// PromoRedemption records a user redeeming a promo code.
+type PromoRedemption struct {
+	TableName      string     `karma_table:"promo_redemptions" json:"-"`
+	Id             string     `json:"id" karma:"primary"`
+	CodeId         string     `json:"code_id"`
+	Code           string     `json:"code"`
+	UserId         string     `json:"user_id"`
+	Kind           string     `json:"kind"`
+	PlanId         string     `json:"plan_id"`
+	PercentOff     int        `json:"percent_off"`
+	SubscriptionId string     `json:"subscription_id"` // Granted subscription
+	CreatedAt      time.Time  `json:"created_at"`
+	UsedAt         *time.Time `json:"used_at"` // When a discount was spent on a subscription
+}
+
+// Referral is a signup through another user's referral link.
+type Referral struct {
+	TableName  string     `karma_table:"referrals" json:"-"`
+	Id         string     `json:"id" karma:"primary"`
+	ReferrerId string     `json:"referrer_id"`
+	RefereeId  string     `json:"referee_id"`
+	Code       string     `json:"code"`
+	DeviceId   string     `json:"device_id"`
+	Status     string     `json:"status"` // "pending", "rewarded", "rejected"
+	Reason     string     `json:"reason"`
+	CreatedAt  time.Time  `json:"created_at"`
+	RewardedAt *time.Time `json:"rewarded_at"`
+}
+
+// Credit temporarily raises one of a user's plan limits.
+type Credit struct {
+	TableName string    `karma_table:"credit_ledger" json:"-"`
+	Id        string    `json:"id" karma:"primary"`
+	UserId    string    `json:"user_id"`
+	LimitName string    `json:"limit_name"` // "swipes_per_day", "superlikes_per_day", "ai_replies_per_day", "boosts_per_month"
+	Amount    int       `json:"amount"`
+	Source    string    `json:"source"` // "referral", "promo"
+	SourceId  string    `json:"source_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // ==================== Streaks ====================
 
 type MatchStreak struct {
@@ -244,3 +478,125 @@ type MatchStreak struct {
 	CreatedAt       time.Time  `json:"created_at"`
 	UpdatedAt       time.Time  `json:"updated_at"`
 }
+
+// ==================== Admin ====================
+
+// AdminAuditEntry is an append-only record of an action taken by staff.
+type AdminAuditEntry struct {
+	TableName  string         `karma_table:"admin_audit_log" json:"-"`
+	Id         string         `json:"id" karma:"primary"`
+	ActorId    string         `json:"actor_id"`
+	Action     string         `json:"action"`
+	TargetType string         `json:"target_type"`
+	TargetId   string         `json:"target_id"`
+	Before     map[string]any `json:"before" db:"before"`
+	After      map[string]any `json:"after" db:"after"`
+	Reason     string         `json:"reason"`
+	CreatedAt  time.Time      `json:"created_at"`
+}
+
+// UserEnforcement is a moderation action taken against a user. Suspensions expire on
+// their own at ExpiresAt; any enforcement can be lifted early by staff or an approved appeal.
+type UserEnforcement struct {
+	TableName  string     `karma_table:"user_enforcements" json:"-"`
+	Id         string     `json:"id" karma:"primary"`
+	UserId     string     `json:"user_id"`
+	ActorId    string     `json:"actor_id"`
+	Type       string     `json:"type"` // "warning", "suspension", "shadow_ban", "ban"
+	ReasonCode string     `json:"reason_code"`
+	Note       string     `json:"note"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LiftedAt   *time.Time `json:"lifted_at"`
+	LiftedBy   string     `json:"lifted_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// BanAppeal is a user's request to have a ban or suspension reviewed.
+type BanAppeal struct {
+	TableName     string     `karma_table:"ban_appeals" json:"-"`
+	Id            string     `json:"id" karma:"primary"`
+	UserId        string     `json:"user_id"`
+	EnforcementId string     `json:"enforcement_id"`
+	Message       string     `json:"message"`
+	Status        string     `json:"status"` // "pending", "approved", "rejected"
+	ReviewerId    string     `json:"reviewer_id"`
+	ReviewNote    string     `json:"review_note"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ReportGroup collects the unresolved reports against one user so moderators triage the
+// user once instead of every report separately.
+type ReportGroup struct {
+	TableName      string     `karma_table:"report_groups" json:"-"`
+	Id             string     `json:"id" karma:"primary"`
+	SubjectId      string     `json:"subject_id"`
+	Status         string     `json:"status"`   // "open", "assigned", "escalated", "resolved"
+	Category       string     `json:"category"` // Category of the most severe report
+	Severity       int        `json:"severity"`
+	Priority       int        `json:"priority"`
+	ReportCount    int        `json:"report_count"`
+	ReporterCount  int        `json:"reporter_count"`
+	AssigneeId     string     `json:"assignee_id"`
+	EscalatedAt    *time.Time `json:"escalated_at"`
+	EscalatedBy    string     `json:"escalated_by"`
+	EscalationNote string     `json:"escalation_note"`
+	LastReportedAt time.Time  `json:"last_reported_at"`
+	ResolvedAt     *time.Time `json:"resolved_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ReportEvidence is a snapshot of the reported content taken when the report was filed.
+// Rows are never updated or deleted.
+type ReportEvidence struct {
+	TableName   string         `karma_table:"report_evidence" json:"-"`
+	Id          string         `json:"id" karma:"primary"`
+	ReportId    string         `json:"report_id"`
+	Kind        string         `json:"kind"` // "chat_messages", "post", "comment", "profile"
+	SourceId    string         `json:"source_id"`
+	Snapshot    map[string]any `json:"snapshot" db:"snapshot"`
+	ContentHash string         `json:"content_hash"` // sha256 of the snapshot JSON
+	CapturedAt  time.Time      `json:"captured_at"`
+}
+
+// AudienceSegment selects the users a notification campaign goes to. Every set field
+// must match; Preset is one of "all", "subscribers", "free" or "inactive".
+type AudienceSegment struct {
+	Preset           string     `json:"preset,omitempty"`
+	PlanIds          []string   `json:"plan_ids,omitempty"`
+	ActiveWithinDays *int       `json:"active_within_days,omitempty"`
+	InactiveForDays  *int       `json:"inactive_for_days,omitempty"`
+	Verified         *bool      `json:"verified,omitempty"`
+	Genders          []string   `json:"genders,omitempty"`
+	Countries        []string   `json:"countries,omitempty"`
+	SignedUpAfter    *time.Time `json:"signed_up_after,omitempty"`
+	SignedUpBefore   *time.Time `json:"signed_up_before,omitempty"`
+	UserIds          []string   `json:"user_ids,omitempty"`
+}
+
+// NotificationCampaign is a push broadcast to a segment, delivered in throttled batches
+// by the campaign worker.
+type NotificationCampaign struct {
+	TableName         string          `karma_table:"notification_campaigns" json:"-"`
+	Id                string          `json:"id" karma:"primary"`
+	Title             string          `json:"title"`
+	Body              string          `json:"body"`
+	Segment           AudienceSegment `json:"segment" db:"segment"`
+	Status            string          `json:"status"` // "scheduled", "sending", "sent", "cancelled", "failed"
+	SendAt            time.Time       `json:"send_at"`
+	ThrottlePerMinute int             `json:"throttle_per_minute"`
+	CreatedBy         string          `json:"created_by"`
+	TargetUsers       int             `json:"target_users"`
+	TargetDevices     int             `json:"target_devices"`
+	SentCount         int             `json:"sent_count"`
+	FailedCount       int             `json:"failed_count"`
+	Cursor            string          `json:"cursor"` // Last push token id delivered to, so an interrupted send resumes
+	LockedBy          string          `json:"locked_by"`
+	LockedUntil       *time.Time      `json:"locked_until"`
+	StartedAt         *time.Time      `json:"started_at"`
+	CompletedAt       *time.Time      `json:"completed_at"`
+	LastError         string          `json:"last_error"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
@@ -4,6 +4,7 @@ import (
 	"spark/internal/handlers/ai"
 	"spark/internal/handlers/chat"
 	"spark/internal/handlers/fs"
+	"spark/internal/handlers/notifications"
 	"spark/internal/handlers/webhooks"
 	"spark/internal/middlewares"
 
@@ -32,8 +33,12 @@ func Routes() *fiber.App {
 	chatserviceRoutes.Get("/ws/:chatId", middlewares.IsWebsocketVerified, websocket.New(chat.WSHandler))
 
 	aiRoutes := v1.Group("/ai")
-	aiRoutes.Get("/summarize_profile/:userId", middlewares.IsUserVerified, ai.GetProfileSummary)
-	aiRoutes.Get("/chat", middlewares.IsWebsocketVerified, websocket.New(ai.AIChatHandler))
+	aiRoutes.Get("/summarize_profile/:userId", middlewares.IsUserVerified, middlewares.BlockImpersonation, ai.GetProfileSummary)
+	aiRoutes.Get("/chat", middlewares.IsWebsocketVerified, middlewares.BlockImpersonation, websocket.New(ai.AIChatHandler))
+
+	notificationRoutes := v1.Group("/notifications")
+	notificationRoutes.Get("/unsubscribe", notifications.UnsubscribeConfirmHandler)
+	notificationRoutes.Post("/unsubscribe", notifications.UnsubscribeHandler)
 
 	// Register webhook routes for payment providers
 	webhooks.RegisterWebhookRoutes(app)
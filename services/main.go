@@ -19,6 +19,7 @@ func main() {
 	go cmd.StartGraphql(ctx)
 	go cmd.StartGoFiber(ctx)
 	go cmd.StartProxyServer(ctx)
+	go cmd.StartWorkers(ctx)
 
 	l := logger.NewLogger()
 	l.Startup(Version)